@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultUpdateAlertFailures is the default number of consecutive failed
+// updates of a threat list after which an UpdateAlert is raised.
+const DefaultUpdateAlertFailures = 3
+
+// UpdateAlert reports that the database is failing to update, as passed to
+// Config.OnUpdateAlert, or that it recovered.
+type UpdateAlert struct {
+	Time     time.Time
+	Resolved bool // Whether the updates recovered, ending the alert
+
+	// ConsecutiveFailures is the highest number of consecutive failed
+	// updates of a threat list.
+	ConsecutiveFailures int
+
+	// DatabaseAge is the duration since the database was last synced with
+	// the API.
+	DatabaseAge time.Duration
+
+	// Errors are the errors of the last update of every threat list failing
+	// to update.
+	Errors map[ThreatType]error
+}
+
+// String returns a description of the alert, listing its errors in the order
+// of their threat types.
+func (a UpdateAlert) String() string {
+	var b strings.Builder
+	if a.Resolved {
+		b.WriteString("database updates recovered")
+	} else {
+		fmt.Fprintf(&b, "database updates failing: %d consecutive failures", a.ConsecutiveFailures)
+	}
+	fmt.Fprintf(&b, ", database age %v", a.DatabaseAge.Round(time.Second))
+	var tds []ThreatType
+	for td := range a.Errors {
+		tds = append(tds, td)
+	}
+	sort.Slice(tds, func(i, j int) bool { return tds[i] < tds[j] })
+	for _, td := range tds {
+		fmt.Fprintf(&b, "; %v: %v", td, a.Errors[td])
+	}
+	return b.String()
+}
+
+// checkUpdateAlert raises an UpdateAlert when the updates of a threat list
+// failed Config.UpdateAlertFailures consecutive times or the database is
+// older than Config.UpdateAlertAge, and resolves it once neither holds. It is
+// called by the updater after every update.
+func (wr *UpdateClient) checkUpdateAlert() {
+	failures, errs := wr.db.UpdateFailures()
+	age := wr.db.SinceLastUpdate()
+	alerting := failures >= wr.config.UpdateAlertFailures ||
+		(wr.config.UpdateAlertAge > 0 && wr.db.Synced() && age > wr.config.UpdateAlertAge)
+	if alerting == wr.alerting {
+		return
+	}
+	wr.alerting = alerting
+	a := UpdateAlert{
+		Time:                wr.config.now().UTC(),
+		Resolved:            !alerting,
+		ConsecutiveFailures: failures,
+		DatabaseAge:         age,
+		Errors:              errs,
+	}
+	if alerting {
+		atomic.AddInt64(&wr.stats.UpdateAlerts, 1)
+	}
+	wr.log.Printf("%v", a)
+	if wr.config.OnUpdateAlert != nil {
+		wr.config.OnUpdateAlert(a)
+	}
+	if wr.config.EventSink != nil {
+		wr.config.EventSink.Emit(Event{Type: EventAlert, Time: a.Time, Error: a.String(), Resolved: a.Resolved})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestUpdateAlert(t *testing.T) {
+	var failing int32 = 1
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			if atomic.LoadInt32(&failing) != 0 {
+				return nil, errors.New("quota exceeded")
+			}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+	var alerts []UpdateAlert
+	var events bytes.Buffer
+	wr, err := NewUpdateClient(Config{
+		ThreatLists:         []ThreatType{ThreatTypeMalware},
+		UpdateAlertFailures: 2,
+		OnUpdateAlert:       func(a UpdateAlert) { alerts = append(alerts, a) },
+		EventSink:           FilterEvents(NewFileSink(&events, false), EventAlert),
+		api:                 api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	// The first update, made by NewUpdateClient, failed once.
+	if err := wr.UpdateNow(context.Background()); err == nil {
+		t.Fatalf("UpdateNow() succeeded, want an error")
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	a := alerts[0]
+	if a.Resolved || a.ConsecutiveFailures != 2 || a.Errors[ThreatTypeMalware] == nil {
+		t.Errorf("alert = %+v, want 2 failures of MALWARE", a)
+	}
+	if !strings.Contains(a.String(), "MALWARE: quota exceeded") {
+		t.Errorf("alert.String() = %q, want the error of MALWARE", a.String())
+	}
+
+	// Further failures do not raise the alert again.
+	wr.UpdateNow(context.Background())
+	if len(alerts) != 1 {
+		t.Errorf("got %d alerts, want 1", len(alerts))
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if err := wr.UpdateNow(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 2 || !alerts[1].Resolved || len(alerts[1].Errors) != 0 {
+		t.Fatalf("alerts = %+v, want the alert resolved", alerts)
+	}
+	if stats, _ := wr.Status(); stats.UpdateAlerts != 1 {
+		t.Errorf("UpdateAlerts = %d, want 1", stats.UpdateAlerts)
+	}
+
+	var resolved []bool
+	for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if e.Type != EventAlert || e.Error == "" {
+			t.Errorf("event = %+v, want an alert", e)
+		}
+		resolved = append(resolved, e.Resolved)
+	}
+	if len(resolved) != 2 || resolved[0] || !resolved[1] {
+		t.Errorf("alert events resolved = %v, want [false true]", resolved)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -52,14 +53,18 @@ type api interface {
 // netAPI is an api object that talks to the server over HTTP.
 type netAPI struct {
 	client *http.Client
-	url    *url.URL
+
+	mu  sync.Mutex // Protects url
+	url *url.URL
 }
 
 // newNetAPI creates a new netAPI object pointed at the provided root URL.
 // For every request, it will use the provided API key.
 // If a proxy URL is given, it will be used in place of the default $HTTP_PROXY.
+// If a transport is given, it is used for every request instead, and the proxy
+// URL is ignored.
 // If the protocol is not specified in root, then this defaults to using HTTPS.
-func newNetAPI(root string, key string, proxy string) (*netAPI, error) {
+func newNetAPI(root string, key string, proxy string, transport http.RoundTripper) (*netAPI, error) {
 	if !strings.Contains(root, "://") {
 		root = "https://" + root
 	}
@@ -68,14 +73,9 @@ func newNetAPI(root string, key string, proxy string) (*netAPI, error) {
 		return nil, err
 	}
 
-	httpClient := &http.Client{}
-
-	if proxy != "" {
-		proxyURL, err := url.Parse(proxy)
-		if err != nil {
-			return nil, err
-		}
-		httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	httpClient, err := newHTTPClient(proxy, transport)
+	if err != nil {
+		return nil, err
 	}
 
 	q := u.Query()
@@ -84,6 +84,40 @@ func newNetAPI(root string, key string, proxy string) (*netAPI, error) {
 	return &netAPI{url: u, client: httpClient}, nil
 }
 
+// newHTTPClient returns a client making requests with the given transport if
+// set, or through the given proxy URL otherwise, if set.
+func newHTTPClient(proxy string, transport http.RoundTripper) (*http.Client, error) {
+	if transport != nil {
+		return &http.Client{Transport: transport}, nil
+	}
+	if proxy == "" {
+		return &http.Client{}, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}, nil
+}
+
+// setKey changes the API key used by subsequent requests.
+func (a *netAPI) setKey(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := *a.url
+	q := u.Query()
+	q.Set("key", key)
+	u.RawQuery = q.Encode()
+	a.url = &u
+}
+
+// root returns a copy of the root URL of requests, including the API key.
+func (a *netAPI) root() url.URL {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return *a.url
+}
+
 // doRequests performs a GET to requestPath. It automatically unmarshals the
 // response body payload as resp.
 func (a *netAPI) doRequest(ctx context.Context, urlString string, resp proto.Message) error {
@@ -127,7 +161,7 @@ func (a *netAPI) parseError(httpResp *http.Response) error {
 // ListUpdate issues a ComputeThreatListDiff API call and returns the response.
 func (a *netAPI) ListUpdate(ctx context.Context, req *pb.ComputeThreatListDiffRequest) (*pb.ComputeThreatListDiffResponse, error) {
 	resp := new(pb.ComputeThreatListDiffResponse)
-	u := *a.url // Make a copy of URL
+	u := a.root()
 	// Add fields from ComputeThreatListDiffRequest to URL request
 	q := u.Query()
 	q.Set(threatTypeString, req.GetThreatType().String())
@@ -152,7 +186,7 @@ func (a *netAPI) ListUpdate(ctx context.Context, req *pb.ComputeThreatListDiffRe
 func (a *netAPI) HashLookup(ctx context.Context, hashPrefix []byte,
 	threatTypes []pb.ThreatType) (*pb.SearchHashesResponse, error) {
 	resp := new(pb.SearchHashesResponse)
-	u := *a.url // Make a copy of URL
+	u := a.root()
 	// Add fields from SearchHashesRequest to URL request
 	q := u.Query()
 	q.Set(hashPrefixString, base64.StdEncoding.EncodeToString(hashPrefix))
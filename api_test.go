@@ -122,7 +122,7 @@ func TestNetAPI(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	api, err := newNetAPI(ts.URL, "fizzbuzz", "")
+	api, err := newNetAPI(ts.URL, "fizzbuzz", "", nil)
 	if err != nil {
 		t.Errorf("unexpected newNetAPI error: %v", err)
 	}
@@ -290,3 +290,59 @@ func TestParseError(t *testing.T) {
 		}
 	}
 }
+
+func TestNetAPISetKey(t *testing.T) {
+	var gotKeys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKeys = append(gotKeys, r.URL.Query().Get("key"))
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	api, err := newNetAPI(ts.URL, "fizz", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected newNetAPI error: %v", err)
+	}
+	if _, err := api.HashLookup(context.Background(), []byte("aaaa"), nil); err != nil {
+		t.Errorf("unexpected HashLookup error: %v", err)
+	}
+	api.setKey("buzz")
+	if _, err := api.ListUpdate(context.Background(), &pb.ComputeThreatListDiffRequest{}); err != nil {
+		t.Errorf("unexpected ListUpdate error: %v", err)
+	}
+	if want := []string{"fizz", "buzz"}; !reflect.DeepEqual(gotKeys, want) {
+		t.Errorf("mismatching API keys:\ngot  %v\nwant %v", gotKeys, want)
+	}
+}
+
+// headerTransport is an http.RoundTripper setting a header on every request.
+type headerTransport struct {
+	key, value string
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(t.key, t.value)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNetAPITransport(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Traceparent")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	want := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	api, err := newNetAPI(ts.URL, "fizz", "http://proxy.invalid", headerTransport{"Traceparent", want})
+	if err != nil {
+		t.Fatalf("unexpected newNetAPI error: %v", err)
+	}
+	if _, err := api.HashLookup(context.Background(), []byte("aaaa"), nil); err != nil {
+		t.Errorf("unexpected HashLookup error: %v", err)
+	}
+	if got != want {
+		t.Errorf("traceparent header = %q, want %q", got, want)
+	}
+}
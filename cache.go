@@ -14,6 +14,13 @@
 package webrisk
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
 	"sync"
 	"time"
 
@@ -41,10 +48,117 @@ const (
 	cacheError
 )
 
+// Cache caches the results of the hash searches of the Web Risk API, so that
+// lookups of recently searched hashes do not query it again. It remembers the
+// threats of full hashes until their expire time, and that a searched hash
+// prefix matches no other full hash until its negative expire time.
+//
+// The default is an in-memory cache private to the client, as returned by
+// NewMemoryCache. Implementations backed by a store like Redis or memcached,
+// such as those returned by NewSharedCache, let the replicas of a service
+// share their cache. They must be safe for concurrent use, and may leave the
+// eviction of expired entries to the store. Errors are not fatal:
+// implementations should report them as cache misses, so that the API is
+// queried instead. Those with a Stats() CacheStats method have their
+// statistics reported by UpdateClient.Status.
+type Cache interface {
+	// Set caches the result of the search of prefix: the threats of the
+	// full hashes starting with it, and the time until which it matches no
+	// other threat, if not zero.
+	Set(ctx context.Context, prefix []byte, threats []HashThreat, negativeExpire time.Time)
+
+	// Get returns the unexpired threat types of fullHash and the earliest
+	// time they expire, or no threat types and the time until which
+	// fullHash is known to be safe. It reports false if the cache has no
+	// valid result for fullHash.
+	Get(ctx context.Context, fullHash []byte) ([]ThreatType, time.Time, bool)
+
+	// GetPrefix returns the unexpired threats of the full hashes starting
+	// with prefix and the negative expire time of prefix, if it was
+	// searched for before. It reports false if the cache has no valid
+	// result for prefix.
+	GetPrefix(ctx context.Context, prefix []byte) ([]HashThreat, time.Time, bool)
+
+	// Purge removes the expired entries.
+	Purge()
+
+	// Clear removes all entries, and returns the number of full hashes and
+	// hash prefixes removed.
+	Clear() int
+}
+
+// CacheStats records statistics regarding the entries of the lookup cache.
+type CacheStats struct {
+	FullHashes   int   // Number of full hashes cached as threats
+	HashPrefixes int   // Number of hash prefixes cached with a negative expire time
+	Expired      int64 // Number of full hashes and hash prefixes removed once expired
+}
+
+// cacheStatser is implemented by the caches reporting statistics regarding
+// their entries, such as the in-memory cache.
+type cacheStatser interface {
+	Stats() CacheStats
+}
+
+// staleCache is implemented by the caches keeping entries after they expired,
+// to serve them with Config.ServeStale, such as the in-memory cache.
+type staleCache interface {
+	// GetStale is like Cache.Get, but also returns the entries that
+	// expired less than maxStale ago.
+	GetStale(ctx context.Context, fullHash []byte, maxStale time.Duration) ([]ThreatType, time.Time, bool)
+}
+
+// cacheSnapshotter is implemented by the caches whose entries can be exported
+// and imported, such as the in-memory cache.
+type cacheSnapshotter interface {
+	Export(w io.Writer) error
+	Import(r io.Reader) error
+}
+
+// errNoCacheSnapshot is the error of the export and import of caches that are
+// not a cacheSnapshotter.
+var errNoCacheSnapshot = errors.New("webrisk: the cache does not support snapshots")
+
+// NewMemoryCache returns an empty in-memory Cache, the default of clients.
+func NewMemoryCache() Cache {
+	return &cache{now: time.Now}
+}
+
+// defaultCacheDuration is how long a threat found by a hash search may be
+// cached when the response gives no expire time for it.
+const defaultCacheDuration = 5 * time.Minute
+
+// threatExpireTime returns the expire time of a threat found by a hash search
+// at now, which defaults to defaultCacheDuration when the response has none.
+func threatExpireTime(threat *pb.SearchHashesResponse_ThreatHash, now time.Time) time.Time {
+	if threat.GetExpireTime() == nil {
+		return now.Add(defaultCacheDuration)
+	}
+	return threat.GetExpireTime().AsTime()
+}
+
+// cacheEntries returns the threats and the negative expire time of the
+// response of a hash search made at now, as given to Cache.Set.
+func cacheEntries(resp *pb.SearchHashesResponse, now time.Time) ([]HashThreat, time.Time) {
+	var threats []HashThreat
+	for _, threat := range resp.GetThreats() {
+		ht := HashThreat{Hash: threat.Hash, ExpireTime: threatExpireTime(threat, now)}
+		for _, tt := range threat.ThreatTypes {
+			ht.ThreatTypes = append(ht.ThreatTypes, ThreatType(tt))
+		}
+		threats = append(threats, ht)
+	}
+	var nttl time.Time
+	if resp.GetNegativeExpireTime() != nil {
+		nttl = resp.GetNegativeExpireTime().AsTime()
+	}
+	return threats, nttl
+}
+
 // cache caches results from API calls to SearchHashesRequest to reduce
 // network calls for recently requested items. Since the global blocklist is
 // constantly changing, the Web Risk API defines TTLs for how long entries
-// can stay alive in the cache.
+// can stay alive in the cache. It is the in-memory implementation of Cache.
 type cache struct {
 	sync.RWMutex
 
@@ -53,18 +167,28 @@ type cache struct {
 	// map to valid TTLs (i.e. in the future).
 	pttls map[hashPrefix]map[ThreatType]time.Time
 
+	// fullHashes indexes the full hashes of pttls by their first
+	// minHashPrefixLength bytes, so that LookupPrefix needs not scan pttls.
+	fullHashes map[hashPrefix]map[hashPrefix]bool
+
 	// nttls maps partial hashes to a negative time-to-live.
 	// If this is still valid (i.e. in the future), then this indicates that
 	// there are *no* threats under the given partial hash, unless there exist
 	// ThreatTypes with a valid positive TTL for that hash.
 	nttls map[hashPrefix]time.Time
 
+	// expired counts the full and partial hashes removed by Purge.
+	expired int64
+
+	// retain is how long Purge keeps the entries after they expired, so
+	// that they can be served stale.
+	retain time.Duration
+
 	now func() time.Time
 }
 
-// Update updates the cache according to the request that was made to the server
-// and the response given back.
-func (c *cache) Update(req *pb.SearchHashesRequest, resp *pb.SearchHashesResponse) error {
+// Set implements Cache.
+func (c *cache) Set(_ context.Context, prefix []byte, threats []HashThreat, negativeExpire time.Time) {
 	c.Lock()
 	defer c.Unlock()
 
@@ -74,74 +198,158 @@ func (c *cache) Update(req *pb.SearchHashesRequest, resp *pb.SearchHashesRespons
 	}
 
 	// Insert each threat match into the cache by full hash.
-	for _, threat := range resp.GetThreats() {
+	for _, threat := range threats {
 		fullHash := hashPrefix(threat.Hash)
 		if !fullHash.IsFull() {
 			continue
 		}
 		if c.pttls[fullHash] == nil {
 			c.pttls[fullHash] = make(map[ThreatType]time.Time)
+			c.indexFullHash(fullHash)
 		}
-		for _, tt := range threat.ThreatTypes {
-			c.pttls[fullHash][ThreatType(tt)] = threat.ExpireTime.AsTime()
+		for _, td := range threat.ThreatTypes {
+			c.pttls[fullHash][td] = threat.ExpireTime
 		}
 	}
 
 	// Insert negative TTLs for partial hashes.
-	if resp.GetNegativeExpireTime() != nil {
-		nttl := resp.GetNegativeExpireTime().AsTime()
-		partialHash := hashPrefix(req.HashPrefix)
-		c.nttls[partialHash] = nttl
+	if !negativeExpire.IsZero() {
+		c.nttls[hashPrefix(prefix)] = negativeExpire
 	}
-	return nil
 }
 
-// Lookup looks up a full hash and returns a set of ThreatTypes and the
-// validity of the result.
-func (c *cache) Lookup(hash hashPrefix) (map[ThreatType]bool, cacheResult) {
+// Get implements Cache.
+func (c *cache) Get(ctx context.Context, fullHash []byte) ([]ThreatType, time.Time, bool) {
+	return c.GetStale(ctx, fullHash, 0)
+}
+
+// GetStale implements staleCache. The entries it returns are those still
+// valid maxStale ago, which Purge keeps for up to retain.
+func (c *cache) GetStale(_ context.Context, fullHash []byte, maxStale time.Duration) ([]ThreatType, time.Time, bool) {
+	threats, ttl, r := c.lookupAt(hashPrefix(fullHash), c.now().Add(-maxStale))
+	switch r {
+	case positiveCacheHit:
+		tds := make([]ThreatType, 0, len(threats))
+		for td := range threats {
+			tds = append(tds, td)
+		}
+		sort.Slice(tds, func(i, j int) bool { return tds[i] < tds[j] })
+		return tds, ttl, true
+	case negativeCacheHit:
+		return nil, ttl, true
+	}
+	return nil, time.Time{}, false
+}
+
+// GetPrefix implements Cache. The expire time of every threat is the earliest
+// of its threat types.
+func (c *cache) GetPrefix(_ context.Context, prefix []byte) ([]HashThreat, time.Time, bool) {
+	cached, nttl, ok := c.LookupPrefix(hashPrefix(prefix))
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	var threats []HashThreat
+	for fullHash, threatTTLs := range cached {
+		ht := HashThreat{Hash: []byte(fullHash)}
+		for td, pttl := range threatTTLs {
+			ht.ThreatTypes = append(ht.ThreatTypes, td)
+			if ht.ExpireTime.IsZero() || pttl.Before(ht.ExpireTime) {
+				ht.ExpireTime = pttl
+			}
+		}
+		sort.Slice(ht.ThreatTypes, func(i, j int) bool { return ht.ThreatTypes[i] < ht.ThreatTypes[j] })
+		threats = append(threats, ht)
+	}
+	sort.Slice(threats, func(i, j int) bool { return bytes.Compare(threats[i].Hash, threats[j].Hash) < 0 })
+	return threats, nttl, true
+}
+
+// lookupAt looks up a full hash as of now, and returns a set of ThreatTypes,
+// the time until which the result is valid for cache hits, and the validity
+// of the result.
+func (c *cache) lookupAt(hash hashPrefix, now time.Time) (map[ThreatType]bool, time.Time, cacheResult) {
 	if !hash.IsFull() {
-		return nil, cacheError
+		return nil, time.Time{}, cacheError
 	}
 
 	c.Lock()
 	defer c.Unlock()
-	now := c.now()
 
 	// Check all entries to see if there *is* a threat.
 	threats := make(map[ThreatType]bool)
+	var ttl time.Time
 	threatTTLs := c.pttls[hash]
 	for td, pttl := range threatTTLs {
 		if pttl.After(now) {
 			threats[td] = true
+			if ttl.IsZero() || pttl.Before(ttl) {
+				ttl = pttl
+			}
 		} else {
 			// The PTTL has expired, we should ask the server what's going on.
-			return nil, cacheMiss
+			return nil, time.Time{}, cacheMiss
 		}
 	}
 	if len(threats) > 0 {
 		// So long as there are valid threats, we report them. The positive TTL
 		// takes precedence over the negative TTL at the partial hash level.
-		return threats, positiveCacheHit
+		return threats, ttl, positiveCacheHit
 	}
 
 	// Check the negative TTLs to see if there are *no* threats.
 	for i := minHashPrefixLength; i <= maxHashPrefixLength; i++ {
 		if nttl, ok := c.nttls[hash[:i]]; ok {
-			if nttl.After(now) {
-				return nil, negativeCacheHit
+			if nttl.After(now) && nttl.After(ttl) {
+				ttl = nttl
 			}
 		}
 	}
+	if !ttl.IsZero() {
+		return nil, ttl, negativeCacheHit
+	}
 
 	// The cache has no information; it is a *possible* threat.
-	return nil, cacheMiss
+	return nil, time.Time{}, cacheMiss
+}
+
+// LookupPrefix looks up a partial hash that was searched for before, and
+// returns the unexpired threats of the full hashes starting with it, as well
+// as the negative time-to-live of the partial hash. It reports false if the
+// cache has no valid result for the partial hash.
+func (c *cache) LookupPrefix(p hashPrefix) (map[hashPrefix]map[ThreatType]time.Time, time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	now := c.now()
+
+	nttl, ok := c.nttls[p]
+	if !ok || !nttl.After(now) || !p.IsValid() {
+		return nil, time.Time{}, false
+	}
+	threats := make(map[hashPrefix]map[ThreatType]time.Time)
+	for fullHash := range c.fullHashes[p[:minHashPrefixLength]] {
+		if !fullHash.HasPrefix(p) {
+			continue
+		}
+		for td, pttl := range c.pttls[fullHash] {
+			if !pttl.After(now) {
+				// The PTTL has expired, we should ask the server again.
+				return nil, time.Time{}, false
+			}
+			if threats[fullHash] == nil {
+				threats[fullHash] = make(map[ThreatType]time.Time)
+			}
+			threats[fullHash][td] = pttl
+		}
+	}
+	return threats, nttl, true
 }
 
-// Purge purges all expired entries from the cache.
+// Purge purges all expired entries from the cache, once they expired for
+// longer than retain.
 func (c *cache) Purge() {
 	c.Lock()
 	defer c.Unlock()
-	now := c.now()
+	now := c.now().Add(-c.retain)
 
 	// Nuke all threat entries based on their positive TTL.
 	for fullHash, threatTTLs := range c.pttls {
@@ -163,6 +371,8 @@ func (c *cache) Purge() {
 		}
 		if len(threatTTLs) == 0 {
 			delete(c.pttls, fullHash)
+			c.unindexFullHash(fullHash)
+			c.expired++
 		}
 	}
 
@@ -170,6 +380,138 @@ func (c *cache) Purge() {
 	for partialHash, nttl := range c.nttls {
 		if now.After(nttl) {
 			delete(c.nttls, partialHash)
+			c.expired++
+		}
+	}
+}
+
+// Stats returns the statistics of the entries of the cache.
+func (c *cache) Stats() CacheStats {
+	c.RLock()
+	defer c.RUnlock()
+	return CacheStats{FullHashes: len(c.pttls), HashPrefixes: len(c.nttls), Expired: c.expired}
+}
+
+// Clear removes all entries from the cache, expired or not, and returns the
+// number of full and partial hashes that were removed.
+func (c *cache) Clear() int {
+	c.Lock()
+	defer c.Unlock()
+	n := len(c.pttls) + len(c.nttls)
+	c.pttls = make(map[hashPrefix]map[ThreatType]time.Time)
+	c.nttls = make(map[hashPrefix]time.Time)
+	c.fullHashes = nil
+	return n
+}
+
+// indexFullHash adds fullHash to the index of the full hashes by prefix.
+func (c *cache) indexFullHash(fullHash hashPrefix) {
+	p := fullHash[:minHashPrefixLength]
+	if c.fullHashes == nil {
+		c.fullHashes = make(map[hashPrefix]map[hashPrefix]bool)
+	}
+	if c.fullHashes[p] == nil {
+		c.fullHashes[p] = make(map[hashPrefix]bool)
+	}
+	c.fullHashes[p][fullHash] = true
+}
+
+// unindexFullHash removes fullHash from the index of the full hashes by
+// prefix.
+func (c *cache) unindexFullHash(fullHash hashPrefix) {
+	p := fullHash[:minHashPrefixLength]
+	delete(c.fullHashes[p], fullHash)
+	if len(c.fullHashes[p]) == 0 {
+		delete(c.fullHashes, p)
+	}
+}
+
+// cacheFormat is the serialized form of the cache.
+type cacheFormat struct {
+	PTTLs map[hashPrefix]map[ThreatType]time.Time
+	NTTLs map[hashPrefix]time.Time
+}
+
+// Export writes a snapshot of all unexpired cache entries to w.
+func (c *cache) Export(w io.Writer) (err error) {
+	c.RLock()
+	now := c.now()
+	cf := cacheFormat{
+		PTTLs: make(map[hashPrefix]map[ThreatType]time.Time),
+		NTTLs: make(map[hashPrefix]time.Time),
+	}
+	for fullHash, threatTTLs := range c.pttls {
+		for td, pttl := range threatTTLs {
+			if pttl.After(now) {
+				if cf.PTTLs[fullHash] == nil {
+					cf.PTTLs[fullHash] = make(map[ThreatType]time.Time)
+				}
+				cf.PTTLs[fullHash][td] = pttl
+			}
 		}
 	}
+	for partialHash, nttl := range c.nttls {
+		if nttl.After(now) {
+			cf.NTTLs[partialHash] = nttl
+		}
+	}
+	c.RUnlock()
+
+	gz := gzip.NewWriter(w)
+	defer func() {
+		if zerr := gz.Close(); err == nil {
+			err = zerr
+		}
+	}()
+	return gob.NewEncoder(gz).Encode(cf)
+}
+
+// Import merges a snapshot written by Export into the cache. Expired entries
+// are skipped and, for entries already in the cache, the later TTL is kept.
+func (c *cache) Import(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	var cf cacheFormat
+	if err := gob.NewDecoder(gz).Decode(&cf); err != nil {
+		return err
+	}
+	for fullHash := range cf.PTTLs {
+		if !fullHash.IsFull() {
+			return errors.New("webrisk: invalid full hash in cache snapshot")
+		}
+	}
+	for partialHash := range cf.NTTLs {
+		if !partialHash.IsValid() {
+			return errors.New("webrisk: invalid partial hash in cache snapshot")
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.pttls == nil {
+		c.pttls = make(map[hashPrefix]map[ThreatType]time.Time)
+		c.nttls = make(map[hashPrefix]time.Time)
+	}
+	now := c.now()
+	for fullHash, threatTTLs := range cf.PTTLs {
+		for td, pttl := range threatTTLs {
+			if !pttl.After(now) || !pttl.After(c.pttls[fullHash][td]) {
+				continue
+			}
+			if c.pttls[fullHash] == nil {
+				c.pttls[fullHash] = make(map[ThreatType]time.Time)
+				c.indexFullHash(fullHash)
+			}
+			c.pttls[fullHash][td] = pttl
+		}
+	}
+	for partialHash, nttl := range cf.NTTLs {
+		if nttl.After(now) && nttl.After(c.nttls[partialHash]) {
+			c.nttls[partialHash] = nttl
+		}
+	}
+	return nil
 }
@@ -14,10 +14,17 @@
 package webrisk
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+
 	timepb "google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "github.com/google/webrisk/internal/webrisk_proto"
@@ -134,7 +141,7 @@ func TestCacheLookup(t *testing.T) {
 
 	for i, v := range vectors {
 		for j, l := range v.lookups {
-			gotTDs, gotR := v.gotCache.Lookup(l.h)
+			gotTDs, _, gotR := v.gotCache.lookupAt(l.h, now)
 			if !reflect.DeepEqual(gotTDs, l.tds) {
 				t.Errorf("test %d, lookup %d, threats mismatch:\ngot  %+v\nwant %+v", i, j, gotTDs, l.tds)
 			}
@@ -151,7 +158,7 @@ func TestCacheLookup(t *testing.T) {
 			t.Errorf("purge test %d, mismatching cache contents: NTTLS\ngot  %+v\nwant %+v", i, v.gotCache.nttls, v.wantCache.nttls)
 		}
 		for j, l := range v.lookups {
-			gotTDs, gotR := v.gotCache.Lookup(l.h)
+			gotTDs, _, gotR := v.gotCache.lookupAt(l.h, now)
 			if !reflect.DeepEqual(gotTDs, l.tds) {
 				t.Errorf("purge test %d, lookup %d, threats mismatch:\ngot  %+v\nwant %+v", i, j, gotTDs, l.tds)
 			}
@@ -216,10 +223,8 @@ func TestCacheUpdate(t *testing.T) {
 	}}
 
 	for i, v := range vectors {
-		err := v.gotCache.Update(v.req, v.resp)
-		if err != nil {
-			t.Fatalf("gotCache update returned unexpected error %v", err)
-		}
+		threats, nttl := cacheEntries(v.resp, now)
+		v.gotCache.Set(context.Background(), v.req.HashPrefix, threats, nttl)
 		if !reflect.DeepEqual(v.wantCache.pttls, v.gotCache.pttls) {
 			t.Errorf("test %d, mismatching cache contents: PTTLS\ngot  %+v\nwant %+v", i, v.gotCache.pttls, v.wantCache.pttls)
 		}
@@ -228,3 +233,425 @@ func TestCacheUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheEntries(t *testing.T) {
+	now := time.Unix(1451436338, 0)
+	resp := &pb.SearchHashesResponse{
+		Threats: []*pb.SearchHashesResponse_ThreatHash{{
+			ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+			Hash:        []byte("aaaabbbbccccddddeeeeffffgggghhhh"),
+			ExpireTime:  timepb.New(now.Add(time.Hour)),
+		}, {
+			// Threats without an expire time are cached for the default duration.
+			ThreatTypes: []pb.ThreatType{pb.ThreatType_SOCIAL_ENGINEERING},
+			Hash:        []byte("bbbbccccddddeeeeffffgggghhhhiiii"),
+		}},
+		NegativeExpireTime: timepb.New(now.Add(2 * time.Hour)),
+	}
+	threats, nttl := cacheEntries(resp, now)
+	want := []HashThreat{{
+		Hash:        []byte("aaaabbbbccccddddeeeeffffgggghhhh"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Hour),
+	}, {
+		Hash:        []byte("bbbbccccddddeeeeffffgggghhhhiiii"),
+		ThreatTypes: []ThreatType{ThreatTypeSocialEngineering},
+		ExpireTime:  now.Add(defaultCacheDuration),
+	}}
+	if diff := cmp.Diff(want, threats); diff != "" {
+		t.Errorf("cacheEntries() threats mismatch (-want +got):\n%s", diff)
+	}
+	if !nttl.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("cacheEntries() negative expire time = %v, want %v", nttl, now.Add(2*time.Hour))
+	}
+}
+
+func TestCacheExportImport(t *testing.T) {
+	now := time.Unix(1451436338, 951473000)
+	mockNow := func() time.Time { return now }
+
+	src := &cache{
+		pttls: map[hashPrefix]map[ThreatType]time.Time{
+			"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB": {
+				1: now.Add(DefaultUpdatePeriod),
+				2: now.Add(-time.Minute),
+			},
+			"ZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZ": {
+				1: now.Add(-DefaultUpdatePeriod),
+			},
+		},
+		nttls: map[hashPrefix]time.Time{
+			"AAAA": now.Add(DefaultUpdatePeriod),
+			"BBBB": now.Add(-time.Minute),
+			"CCCC": now.Add(time.Minute),
+		},
+		now: mockNow,
+	}
+	dst := &cache{
+		nttls: map[hashPrefix]time.Time{
+			"CCCC": now.Add(time.Hour),
+			"DDDD": now.Add(time.Hour),
+		},
+		pttls: map[hashPrefix]map[ThreatType]time.Time{},
+		now:   mockNow,
+	}
+	want := &cache{
+		pttls: map[hashPrefix]map[ThreatType]time.Time{
+			"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB": {
+				1: now.Add(DefaultUpdatePeriod),
+			},
+		},
+		nttls: map[hashPrefix]time.Time{
+			"AAAA": now.Add(DefaultUpdatePeriod),
+			"CCCC": now.Add(time.Hour),
+			"DDDD": now.Add(time.Hour),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := dst.Import(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(dst.pttls, want.pttls) {
+		t.Errorf("pttls mismatch:\ngot  %v\nwant %v", dst.pttls, want.pttls)
+	}
+	if !cmp.Equal(dst.nttls, want.nttls) {
+		t.Errorf("nttls mismatch:\ngot  %v\nwant %v", dst.nttls, want.nttls)
+	}
+
+	if err := dst.Import(bytes.NewReader([]byte("not a snapshot"))); err == nil {
+		t.Errorf("unexpected success importing invalid snapshot")
+	}
+}
+
+func TestCacheClear(t *testing.T) {
+	now := time.Unix(1451436338, 951473000)
+	c := &cache{
+		pttls: map[hashPrefix]map[ThreatType]time.Time{
+			"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB": {1: now.Add(time.Hour)},
+		},
+		nttls: map[hashPrefix]time.Time{
+			"AAAA": now.Add(time.Hour),
+			"BBBB": now.Add(-time.Minute),
+		},
+		now: func() time.Time { return now },
+	}
+	if got := c.Clear(); got != 3 {
+		t.Errorf("Clear() = %d, want 3", got)
+	}
+	if _, _, ok := c.Get(context.Background(), []byte("AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB")); ok {
+		t.Errorf("unexpected Get() hit after Clear()")
+	}
+	if got := c.Clear(); got != 0 {
+		t.Errorf("second Clear() = %d, want 0", got)
+	}
+}
+
+func TestCacheGetSet(t *testing.T) {
+	now := time.Unix(1451436338, 951473000)
+	c := &cache{now: func() time.Time { return now }}
+	ctx := context.Background()
+	c.Set(ctx, []byte("AAAA"), []HashThreat{{
+		Hash:        []byte("AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB"),
+		ThreatTypes: []ThreatType{ThreatTypeSocialEngineering, ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Minute),
+	}}, now.Add(time.Hour))
+
+	vectors := []struct {
+		hash    string
+		threats []ThreatType
+		expire  time.Time
+		ok      bool
+	}{
+		{"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB", []ThreatType{ThreatTypeMalware, ThreatTypeSocialEngineering}, now.Add(time.Minute), true},
+		{"AAAACCCCCCCCCCCCCCCCCCCCCCCCCCCC", nil, now.Add(time.Hour), true},
+		{"BBBBCCCCCCCCCCCCCCCCCCCCCCCCCCCC", nil, time.Time{}, false},
+		{"AAAA", nil, time.Time{}, false},
+	}
+	for i, v := range vectors {
+		threats, expire, ok := c.Get(ctx, []byte(v.hash))
+		if !reflect.DeepEqual(threats, v.threats) || !expire.Equal(v.expire) || ok != v.ok {
+			t.Errorf("test %d, Get() = (%v, %v, %v), want (%v, %v, %v)", i, threats, expire, ok, v.threats, v.expire, v.ok)
+		}
+	}
+
+	threats, nttl, ok := c.GetPrefix(ctx, []byte("AAAA"))
+	want := []HashThreat{{
+		Hash:        []byte("AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware, ThreatTypeSocialEngineering},
+		ExpireTime:  now.Add(time.Minute),
+	}}
+	if !cmp.Equal(threats, want) || !nttl.Equal(now.Add(time.Hour)) || !ok {
+		t.Errorf("GetPrefix() = (%v, %v, %v), want (%v, %v, true)", threats, nttl, ok, want, now.Add(time.Hour))
+	}
+	if _, _, ok := c.GetPrefix(ctx, []byte("BBBB")); ok {
+		t.Errorf("GetPrefix() of an unknown prefix succeeded")
+	}
+}
+
+func TestCacheLookupPrefix(t *testing.T) {
+	now := time.Unix(1451436338, 951473000)
+	c := &cache{now: func() time.Time { return now }}
+	ctx := context.Background()
+	c.Set(ctx, []byte("AAAA"), []HashThreat{{
+		Hash:        []byte("AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Minute),
+	}, {
+		Hash:        []byte("AAAACCCCCCCCCCCCCCCCCCCCCCCCCCCC"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Hour),
+	}}, now.Add(time.Hour))
+	c.Set(ctx, []byte("AAAAB"), nil, now.Add(time.Hour))
+	c.Set(ctx, []byte("DDDD"), []HashThreat{{
+		Hash:        []byte("DDDDEEEEEEEEEEEEEEEEEEEEEEEEEEEE"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Hour),
+	}}, now.Add(time.Hour))
+
+	lookup := func(p string) []hashPrefix {
+		threats, _, ok := c.LookupPrefix(hashPrefix(p))
+		if !ok {
+			return nil
+		}
+		var fullHashes []hashPrefix
+		for fullHash := range threats {
+			fullHashes = append(fullHashes, fullHash)
+		}
+		sort.Slice(fullHashes, func(i, j int) bool { return fullHashes[i] < fullHashes[j] })
+		return fullHashes
+	}
+	vectors := []struct {
+		prefix string
+		want   []hashPrefix
+	}{
+		{"AAAA", []hashPrefix{"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB", "AAAACCCCCCCCCCCCCCCCCCCCCCCCCCCC"}},
+		{"AAAAB", []hashPrefix{"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+		{"DDDD", []hashPrefix{"DDDDEEEEEEEEEEEEEEEEEEEEEEEEEEEE"}},
+		{"EEEE", nil},
+		{"AAA", nil},
+	}
+	for i, v := range vectors {
+		if got := lookup(v.prefix); !reflect.DeepEqual(got, v.want) {
+			t.Errorf("test %d, LookupPrefix(%q) = %v, want %v", i, v.prefix, got, v.want)
+		}
+	}
+
+	// Purged full hashes are removed from the index.
+	now = now.Add(2 * time.Minute)
+	delete(c.nttls, "AAAA")
+	delete(c.nttls, "AAAAB")
+	c.Purge()
+	c.nttls["AAAA"] = now.Add(time.Hour)
+	if got, want := lookup("AAAA"), []hashPrefix{"AAAACCCCCCCCCCCCCCCCCCCCCCCCCCCC"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupPrefix() after Purge() = %v, want %v", got, want)
+	}
+	if got := len(c.fullHashes["AAAA"]); got != 1 {
+		t.Errorf("%d full hashes indexed by AAAA, want 1", got)
+	}
+
+	// Imported full hashes are indexed.
+	var buf bytes.Buffer
+	if err := c.Export(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Clear()
+	if len(c.fullHashes) != 0 {
+		t.Errorf("unexpected index after Clear(): %v", c.fullHashes)
+	}
+	if err := c.Import(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := lookup("DDDD"), []hashPrefix{"DDDDEEEEEEEEEEEEEEEEEEEEEEEEEEEE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupPrefix() after Import() = %v, want %v", got, want)
+	}
+}
+
+// countingCache is a Cache counting the calls of its methods.
+type countingCache struct {
+	Cache
+	gets, sets int
+}
+
+func (c *countingCache) Get(ctx context.Context, fullHash []byte) ([]ThreatType, time.Time, bool) {
+	c.gets++
+	return c.Cache.Get(ctx, fullHash)
+}
+
+func (c *countingCache) Set(ctx context.Context, prefix []byte, threats []HashThreat, negativeExpire time.Time) {
+	c.sets++
+	c.Cache.Set(ctx, prefix, threats, negativeExpire)
+}
+
+func TestConfigCache(t *testing.T) {
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			prefixes := hashPrefixes{hashFromPattern("example.com/")[:4]}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: prefixes.SHA256()},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			return &pb.SearchHashesResponse{NegativeExpireTime: timepb.New(time.Now().Add(time.Hour))}, nil
+		},
+	}
+	c := &countingCache{Cache: NewMemoryCache()}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		Cache:       c,
+		api:         api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The second lookup is answered by the cache.
+	for i, want := range []LookupSource{SourceAPI, SourceCache} {
+		results, err := wr.LookupURLResults(context.Background(), []string{"http://example.com/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if results[0].Source != want {
+			t.Errorf("lookup %d, source = %v, want %v", i, results[0].Source, want)
+		}
+	}
+	if stats, _ := wr.Status(); stats.QueriesByCache != 1 || stats.CacheMisses != 1 {
+		t.Errorf("Status() = %+v, want 1 query by the cache and 1 cache miss", stats)
+	}
+	if c.gets != 2 || c.sets != 1 {
+		t.Errorf("cache gets = %d, sets = %d, want 2 and 1", c.gets, c.sets)
+	}
+	if err := wr.ExportCache(&bytes.Buffer{}); err != errNoCacheSnapshot {
+		t.Errorf("ExportCache() = %v, want %v", err, errNoCacheSnapshot)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	now := time.Unix(1451436338, 951473000)
+	c := &cache{
+		pttls: map[hashPrefix]map[ThreatType]time.Time{
+			"AAAABBBBBBBBBBBBBBBBBBBBBBBBBBBB": {1: now.Add(time.Hour)},
+			"DDDDBBBBBBBBBBBBBBBBBBBBBBBBBBBB": {1: now.Add(-time.Hour)},
+		},
+		nttls: map[hashPrefix]time.Time{
+			"AAAA": now.Add(time.Hour),
+			"BBBB": now.Add(-time.Minute),
+			"CCCC": now.Add(-time.Minute),
+		},
+		now: func() time.Time { return now },
+	}
+	if got, want := c.Stats(), (CacheStats{FullHashes: 2, HashPrefixes: 3}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	c.Purge()
+	if got, want := c.Stats(), (CacheStats{FullHashes: 1, HashPrefixes: 1, Expired: 3}); got != want {
+		t.Errorf("Stats() after Purge() = %+v, want %+v", got, want)
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	var fail bool
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			prefixes := hashPrefixes{fullHash[:4]}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: prefixes.SHA256()},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			return &pb.SearchHashesResponse{
+				Threats: []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(now.Add(time.Minute)),
+				}},
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		ServeStale:  time.Hour,
+		api:         api,
+		now: func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := wr.LookupURLResults(context.Background(), []string{"http://bad.example.com/"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		elapsed time.Duration
+		stale   bool
+	}{
+		{30 * time.Minute, true},
+		{2 * time.Hour, false},
+	}
+	for i, v := range vectors {
+		mu.Lock()
+		now, fail = time.Unix(1700000000, 0).Add(v.elapsed), true
+		mu.Unlock()
+		results, err := wr.LookupURLResults(context.Background(), []string{"http://bad.example.com/"})
+		if !v.stale {
+			if err == nil {
+				t.Errorf("test %d, LookupURLResults() succeeded, want error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		want := URLResult{
+			Threats: []URLThreat{{
+				Pattern:    "bad.example.com/",
+				ThreatType: ThreatTypeMalware,
+				HashPrefix: []byte(fullHash[:4]),
+				Source:     SourceCache,
+				ExpireTime: now,
+			}},
+			ExpireTime: now,
+			Source:     SourceCache,
+			Stale:      true,
+		}
+		if !cmp.Equal(results[0], want) {
+			t.Errorf("test %d, LookupURLResults() = %+v, want %+v", i, results[0], want)
+		}
+	}
+	if stats, _ := wr.Status(); stats.QueriesStale != 1 {
+		t.Errorf("QueriesStale = %d, want 1", stats.QueriesStale)
+	}
+}
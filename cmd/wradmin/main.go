@@ -0,0 +1,217 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wradmin inspects and maintains the database files persisted by the
+// Web Risk clients with -db, such as wrserver and wrlookup.
+//
+// The database file is an opaque binary file. wradmin reads it offline,
+// without any API key, with the following commands:
+//
+//	info     prints the format version and time of the file, and for every
+//	         threat list its number of hash prefixes by length, its version
+//	         token and its checksum.
+//	verify   verifies that the hash prefixes of every threat list are valid
+//	         and match its checksum.
+//	dump     prints the hash prefixes of the threat lists, hex encoded.
+//	compact  rewrites the file in the current format, which is smaller than
+//	         the formats of older clients.
+//
+// The exit code is 0 on success, 1 if the database is corrupted, and 2 if
+// the command failed otherwise.
+//
+// To build the tool:
+//
+//	$ go get github.com/google/webrisk/cmd/wradmin
+//
+// Example usage:
+//
+//	$ wradmin info /tmp/webrisk.db
+//	File:    /tmp/webrisk.db (1834521 bytes, format version 2)
+//	Updated: 2023-06-01T12:34:56Z
+//	MALWARE: 298734 hash prefixes (4 bytes: 298734), version token 0a0b..., checksum 5d3f...
+//	$ wradmin dump -threatType MALWARE /tmp/webrisk.db | head -1
+//	MALWARE	000004d3
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+const usage = `wradmin: command-line tool to manage Web Risk database files.
+
+Usage: %s <command> [flags] <database file>
+
+Commands:
+  info     print the format, time and threat lists of the database
+  verify   verify the hash prefixes of every threat list against its checksum
+  dump     print the hash prefixes of the threat lists, hex encoded
+  compact  rewrite the database in the current format
+
+Exit codes:
+  0  on success.
+  1  if the database is corrupted.
+  2  if the command failed otherwise.
+
+Run '%s <command> -h' for the flags of a command.
+`
+
+const (
+	codeOK = iota
+	codeCorrupted
+	codeFailed
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command of args and returns its exit code.
+func run(args []string, out, errs io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(errs, usage, os.Args[0], os.Args[0])
+		return codeFailed
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(errs)
+	var threatType, output *string
+	switch cmd {
+	case "info", "verify":
+	case "dump":
+		threatType = fs.String("threatType", "", "threat type of the list to dump; all lists if empty")
+	case "compact":
+		output = fs.String("o", "", "path of the compacted database; the database is rewritten in place if empty")
+	default:
+		fmt.Fprintf(errs, usage, os.Args[0], os.Args[0])
+		return codeFailed
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(errs, "Usage: %s %s [flags] <database file>\n", os.Args[0], cmd)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return codeFailed
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return codeFailed
+	}
+	path := fs.Arg(0)
+	f, err := webrisk.ReadDatabaseFile(path)
+	if err != nil {
+		fmt.Fprintln(errs, "Unable to read database:", err)
+		return codeFailed
+	}
+
+	switch cmd {
+	case "info":
+		return info(f, path, out)
+	case "verify":
+		return verify(f, out)
+	case "dump":
+		return dump(f, *threatType, out, errs)
+	default:
+		if *output == "" {
+			*output = path
+		}
+		if err := f.Save(*output); err != nil {
+			fmt.Fprintln(errs, "Unable to compact database:", err)
+			return codeFailed
+		}
+		if fi, err := os.Stat(*output); err == nil {
+			fmt.Fprintf(out, "Compacted %s: %d bytes, was %d bytes\n", *output, fi.Size(), f.Size)
+		}
+		return codeOK
+	}
+}
+
+// info writes the description of f, read from path, to out.
+func info(f *webrisk.DatabaseFile, path string, out io.Writer) int {
+	fmt.Fprintf(out, "File:    %s (%d bytes, format version %d)\n", path, f.Size, f.Version)
+	fmt.Fprintf(out, "Updated: %s\n", f.Time.UTC().Format(time.RFC3339))
+	for _, li := range f.Lists() {
+		var lengths []int
+		for n := range li.Lengths {
+			lengths = append(lengths, n)
+		}
+		sort.Ints(lengths)
+		var counts []string
+		for _, n := range lengths {
+			counts = append(counts, fmt.Sprintf("%d bytes: %d", n, li.Lengths[n]))
+		}
+		fmt.Fprintf(out, "%v: %d hash prefixes (%s), version token %s, checksum %s\n",
+			li.ThreatType, li.HashPrefixes, strings.Join(counts, ", "),
+			hex.EncodeToString(li.VersionToken), hex.EncodeToString(li.SHA256))
+	}
+	return codeOK
+}
+
+// verify verifies every threat list of f, and writes the result to out.
+func verify(f *webrisk.DatabaseFile, out io.Writer) int {
+	code := codeOK
+	for _, li := range f.Lists() {
+		if err := f.Verify(li.ThreatType); err != nil {
+			fmt.Fprintf(out, "%v: %v\n", li.ThreatType, err)
+			code = codeCorrupted
+			continue
+		}
+		fmt.Fprintf(out, "%v: OK\n", li.ThreatType)
+	}
+	return code
+}
+
+// dump writes the hash prefixes of the threat list named threatType of f, or
+// of all its lists if empty, to out, one per line after the name of its list.
+func dump(f *webrisk.DatabaseFile, threatType string, out, errs io.Writer) int {
+	var tds []webrisk.ThreatType
+	if threatType == "" {
+		for _, li := range f.Lists() {
+			tds = append(tds, li.ThreatType)
+		}
+	} else {
+		td := webrisk.ThreatType(pb.ThreatType_value[threatType])
+		if td == webrisk.ThreatTypeUnspecified {
+			fmt.Fprintf(errs, "Unknown threat type %q\n", threatType)
+			return codeFailed
+		}
+		tds = append(tds, td)
+	}
+	w := bufio.NewWriter(out)
+	for _, td := range tds {
+		it, err := f.HashPrefixes(td)
+		if err != nil {
+			fmt.Fprintln(errs, err)
+			return codeFailed
+		}
+		for it.Next() {
+			fmt.Fprintf(w, "%v\t%x\n", td, it.Prefix())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(errs, "Unable to write output:", err)
+		return codeFailed
+	}
+	return codeOK
+}
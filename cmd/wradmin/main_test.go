@@ -0,0 +1,132 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// writeDatabase writes the database file of a client whose malware list
+// holds the given sorted 4 byte hash prefixes, synced from a fake Web Risk
+// API, and returns its path.
+func writeDatabase(t *testing.T, hashes ...string) string {
+	t.Helper()
+	raw := strings.Join(hashes, "")
+	sum := sha256.Sum256([]byte(raw))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":computeDiff") {
+			w.Write([]byte("{}"))
+			return
+		}
+		b, _ := protojson.Marshal(&pb.ComputeThreatListDiffResponse{
+			ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+			Additions:       &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(raw)}}},
+			NewVersionToken: []byte("token"),
+			Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: sum[:]},
+		})
+		w.Write(b)
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "webrisk.db")
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "key",
+		ServerURL:    ts.URL,
+		DBPath:       path,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	path := writeDatabase(t, "aaaa", "bbbb")
+	vectors := []struct {
+		args []string
+		code int
+		want string // Regular expression matching the output
+	}{
+		{[]string{"info", path}, codeOK, `(?s)format version 2\).*\nMALWARE: 2 hash prefixes \(4 bytes: 2\), version token 746f6b656e, checksum [0-9a-f]{64}\n$`},
+		{[]string{"verify", path}, codeOK, `^MALWARE: OK\n$`},
+		{[]string{"dump", path}, codeOK, `^MALWARE\t61616161\nMALWARE\t62626262\n$`},
+		{[]string{"dump", "-threatType", "MALWARE", path}, codeOK, `^MALWARE\t61616161\nMALWARE\t62626262\n$`},
+		{[]string{"dump", "-threatType", "SOCIAL_ENGINEERING", path}, codeFailed, `^$`},
+		{[]string{"dump", "-threatType", "BOGUS", path}, codeFailed, `^$`},
+		{[]string{"compact", "-o", path + ".compact", path}, codeOK, `^Compacted .*webrisk.db.compact: \d+ bytes, was \d+ bytes\n$`},
+		{[]string{"verify", path + ".compact"}, codeOK, `^MALWARE: OK\n$`},
+		{[]string{"info", path + ".missing"}, codeFailed, `^$`},
+		{[]string{"info"}, codeFailed, `^$`},
+		{[]string{"bogus", path}, codeFailed, `^$`},
+		{nil, codeFailed, `^$`},
+	}
+	for i, v := range vectors {
+		var out, errs bytes.Buffer
+		if got := run(v.args, &out, &errs); got != v.code {
+			t.Errorf("test %d, run(%q) = %d, want %d: %s", i, v.args, got, v.code, errs.String())
+		}
+		if !regexp.MustCompile(v.want).MatchString(out.String()) {
+			t.Errorf("test %d, run(%q) output = %q, want match of %q", i, v.args, out.String(), v.want)
+		}
+	}
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	path := writeDatabase(t, "aaaa", "bbbb")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The checksum is stored as is, right before the field number and the
+	// length of the version token.
+	i := bytes.Index(b, []byte("token"))
+	if i < 3 {
+		t.Fatalf("version token not found in the database file")
+	}
+	b[i-3] ^= 0xff
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out, errs bytes.Buffer
+	if got := run([]string{"verify", path}, &out, &errs); got != codeCorrupted {
+		t.Errorf("run(verify) = %d, want %d: %s%s", got, codeCorrupted, out.String(), errs.String())
+	}
+	if got := run([]string{"compact", path}, &out, &errs); got != codeFailed {
+		t.Errorf("run(compact) = %d, want %d", got, codeFailed)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// Backends of -backend.
+const (
+	backendAPI      = "api"      // Local database synced with the Web Risk API
+	backendWRServer = "wrserver" // Lookups of a wrserver instance
+)
+
+const (
+	// batchSearchPath is the batch lookup endpoint of wrserver.
+	batchSearchPath = "/v1/uris:batchSearch"
+	// sourceHeader is the response header in which wrserver names the most
+	// costly source of its verdicts.
+	sourceHeader = "X-Webrisk-Source"
+)
+
+// looker looks up a single URL, and returns the source of its verdict.
+type looker interface {
+	lookup(ctx context.Context, url string) (string, error)
+}
+
+// clientLooker looks up URLs with a local database.
+type clientLooker struct {
+	wr *webrisk.UpdateClient
+}
+
+func (c clientLooker) lookup(ctx context.Context, url string) (string, error) {
+	results, err := c.wr.LookupURLResults(ctx, []string{url})
+	if err != nil {
+		return "", err
+	}
+	return results[0].Source.String(), nil
+}
+
+// serverLooker looks up URLs with the batch lookup endpoint of a wrserver
+// instance, one URL per request.
+type serverLooker struct {
+	url         string   // URL of the batch lookup endpoint
+	token       string   // Bearer token of the requests, if any
+	threatTypes []string // Threat types to look up, or all if empty
+	client      *http.Client
+}
+
+// newServerLooker returns a looker of URLs with the wrserver instance at
+// serverURL, through the proxy at proxyURL if not empty. If not empty, token
+// is sent as a bearer token, and threatTypes is either ALL or the
+// comma-separated threat types to look up.
+func newServerLooker(serverURL, token, proxyURL, threatTypes string) (*serverLooker, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid wrserver URL %q", serverURL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Lookups reuse connections rather than measuring their setup.
+	transport.MaxIdleConnsPerHost = 1024
+	if proxyURL != "" {
+		pu, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", proxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(pu)
+	}
+	s := &serverLooker{
+		url:    strings.TrimSuffix(u.String(), "/") + batchSearchPath,
+		token:  token,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+	if threatTypes != "" && threatTypes != "ALL" {
+		for _, name := range strings.Split(threatTypes, ",") {
+			if tt, ok := pb.ThreatType_value[name]; !ok || tt == 0 {
+				return nil, fmt.Errorf("invalid threat type %q", name)
+			}
+			s.threatTypes = append(s.threatTypes, name)
+		}
+	}
+	return s, nil
+}
+
+func (s *serverLooker) lookup(ctx context.Context, u string) (string, error) {
+	body, err := json.Marshal(struct {
+		URIs        []string `json:"uris"`
+		ThreatTypes []string `json:"threatTypes,omitempty"`
+	}{[]string{u}, s.threatTypes})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("wrserver returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	source := resp.Header.Get(sourceHeader)
+	if source == "" {
+		source = "unknown"
+	}
+	return source, nil
+}
+
+// readURLs reads the URLs of in, one per line. Blank lines are skipped.
+func readURLs(in io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if u := strings.TrimSpace(scanner.Text()); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// sourceOrder is the order of the sources in reports, from the cheapest.
+var sourceOrder = map[string]int{"database": 0, "cache": 1, "api": 2}
+
+// report is the outcome of a load test.
+type report struct {
+	qps       float64                    // Target rate
+	elapsed   time.Duration              // Time from the first lookup to the end of the last
+	failed    int                        // Lookups that failed
+	dropped   int                        // Lookups dropped for exceeding the concurrency
+	latencies map[string][]time.Duration // Latencies of the successful lookups by source
+}
+
+// run looks up urls with l, cycling through them, at qps lookups per second
+// for duration, with up to concurrency lookups in flight. It returns once
+// every lookup started is done.
+func run(l looker, urls []string, qps float64, duration time.Duration, concurrency int) *report {
+	r := &report{qps: qps, latencies: make(map[string][]time.Duration)}
+	var (
+		mu  sync.Mutex // Protects r
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	interval := time.Duration(float64(time.Second) / qps)
+	if interval <= 0 {
+		interval = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	end := time.NewTimer(duration)
+	defer end.Stop()
+	for i := 0; ; i++ {
+		select {
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func(u string) {
+				defer wg.Done()
+				t := time.Now()
+				source, err := l.lookup(context.Background(), u)
+				latency := time.Since(t)
+				<-sem
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					r.failed++
+					return
+				}
+				r.latencies[source] = append(r.latencies[source], latency)
+			}(urls[i%len(urls)])
+		default:
+			mu.Lock()
+			r.dropped++
+			mu.Unlock()
+		}
+		select {
+		case <-ticker.C:
+		case <-end.C:
+			wg.Wait()
+			r.elapsed = time.Since(start)
+			return r
+		}
+	}
+}
+
+// write writes the summary of r and its latency percentiles by source to w.
+func (r *report) write(w io.Writer) error {
+	var sources []string
+	var all []time.Duration
+	for source, ls := range r.latencies {
+		sources = append(sources, source)
+		all = append(all, ls...)
+		sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		oi, ok := sourceOrder[sources[i]]
+		if !ok {
+			oi = len(sourceOrder)
+		}
+		oj, ok := sourceOrder[sources[j]]
+		if !ok {
+			oj = len(sourceOrder)
+		}
+		return oi < oj || (oi == oj && sources[i] < sources[j])
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+
+	lookups := len(all) + r.failed
+	var achieved float64
+	if r.elapsed > 0 {
+		achieved = float64(lookups) / r.elapsed.Seconds()
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Target QPS:\t%g\n", r.qps)
+	fmt.Fprintf(tw, "Achieved QPS:\t%.1f\n", achieved)
+	fmt.Fprintf(tw, "Lookups:\t%d (%d failed, %d dropped)\n", lookups, r.failed, r.dropped)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "source\tcount\tp50\tp90\tp99\tp99.9\tmax")
+	row := func(name string, ls []time.Duration) {
+		fmt.Fprintf(tw, "%s\t%d", name, len(ls))
+		for _, p := range []float64{50, 90, 99, 99.9, 100} {
+			fmt.Fprintf(tw, "\t%v", roundLatency(percentile(ls, p)))
+		}
+		fmt.Fprintln(tw)
+	}
+	for _, source := range sources {
+		row(source, r.latencies[source])
+	}
+	row("all", all)
+	return tw.Flush()
+}
+
+// percentile returns the p-th percentile of the sorted latencies, with the
+// nearest-rank method, allowing for floating-point rounding errors.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted))/100 - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// roundLatency rounds d to 4 significant digits at most, for readability.
+func roundLatency(d time.Duration) time.Duration {
+	for _, unit := range []time.Duration{time.Second, time.Millisecond, time.Microsecond} {
+		if d >= unit {
+			return d.Round(unit / 10)
+		}
+	}
+	return d
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLooker struct {
+	delay time.Duration
+	mu    sync.Mutex
+	urls  []string
+}
+
+func (f *fakeLooker) lookup(ctx context.Context, url string) (string, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	f.urls = append(f.urls, url)
+	f.mu.Unlock()
+	switch url {
+	case "http://bad.example.com/":
+		return "", errors.New("lookup failed")
+	case "http://cached.example.com/":
+		return "cache", nil
+	}
+	return "database", nil
+}
+
+func TestRun(t *testing.T) {
+	f := &fakeLooker{}
+	urls := []string{"http://example.com/", "http://cached.example.com/", "http://bad.example.com/"}
+	r := run(f, urls, 200, 100*time.Millisecond, 4)
+	if len(f.urls) < 3 {
+		t.Fatalf("looked up %d URLs, want at least 3", len(f.urls))
+	}
+	if got := len(r.latencies["database"]) + len(r.latencies["cache"]) + r.failed; got != len(f.urls) {
+		t.Errorf("report counts %d lookups, want %d", got, len(f.urls))
+	}
+	if r.failed == 0 || len(r.latencies["cache"]) == 0 || r.dropped != 0 {
+		t.Errorf("report = %+v, want failed, cached and no dropped lookups", r)
+	}
+
+	// Lookups beyond the concurrency are dropped.
+	f = &fakeLooker{delay: 50 * time.Millisecond}
+	r = run(f, urls, 1000, 30*time.Millisecond, 1)
+	if r.dropped == 0 || len(f.urls) > 2 {
+		t.Errorf("%d lookups with %d dropped, want fewer than 3 and some dropped", len(f.urls), r.dropped)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var ls []time.Duration
+	for i := 1; i <= 1000; i++ {
+		ls = append(ls, time.Duration(i))
+	}
+	vectors := []struct {
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{ls, 50, 500},
+		{ls, 90, 900},
+		{ls, 99.9, 999},
+		{ls, 100, 1000},
+		{ls, 0, 1},
+		{ls[:1], 99, 1},
+		{nil, 50, 0},
+	}
+	for i, v := range vectors {
+		if got := percentile(v.latencies, v.p); got != v.want {
+			t.Errorf("test %d, percentile(%v) = %v, want %v", i, v.p, got, v.want)
+		}
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	r := &report{
+		qps:     100,
+		elapsed: 2 * time.Second,
+		failed:  1,
+		dropped: 2,
+		latencies: map[string][]time.Duration{
+			"api":      {42123456 * time.Nanosecond},
+			"database": {3 * time.Microsecond, 12345 * time.Nanosecond},
+		},
+	}
+	var buf bytes.Buffer
+	if err := r.write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "" +
+		"Target QPS:    100\n" +
+		"Achieved QPS:  2.0\n" +
+		"Lookups:       4 (1 failed, 2 dropped)\n" +
+		"\n" +
+		"source    count  p50     p90     p99     p99.9   max\n" +
+		"database  2      3µs     12.3µs  12.3µs  12.3µs  12.3µs\n" +
+		"api       1      42.1ms  42.1ms  42.1ms  42.1ms  42.1ms\n" +
+		"all       3      12.3µs  42.1ms  42.1ms  42.1ms  42.1ms\n"
+	if got := buf.String(); got != want {
+		t.Errorf("write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestServerLooker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != batchSearchPath || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set(sourceHeader, "api")
+		w.Write([]byte(`{"results": [{"uri": "http://example.com/"}]}`))
+	}))
+	defer srv.Close()
+
+	s, err := newServerLooker(srv.URL, "token", "", "MALWARE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source, err := s.lookup(context.Background(), "http://example.com/"); err != nil || source != "api" {
+		t.Errorf("lookup() = (%q, %v), want (api, nil)", source, err)
+	}
+	s.token = ""
+	if _, err := s.lookup(context.Background(), "http://example.com/"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("lookup() error = %v, want unauthorized", err)
+	}
+	if _, err := newServerLooker("localhost:8080", "", "", "ALL"); err == nil {
+		t.Errorf("newServerLooker() succeeded with an invalid URL")
+	}
+}
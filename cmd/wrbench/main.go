@@ -0,0 +1,164 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wrbench load tests Web Risk lookups, either with a local database
+// synced with the Web Risk API like wrlookup, or against a wrserver instance.
+//
+// It replays the URLs of a list, one per line, over and over at a target rate
+// of lookups per second for a given duration, and reports the latency
+// percentiles of the lookups by the source of their verdicts: the local
+// database, the cache, or the Web Risk API. This tells how a deployment
+// behaves under load, and how much of its latency is due to API calls.
+//
+// Lookups are started at the target rate regardless of how long the previous
+// ones take, up to -concurrency lookups in flight. Lookups that would exceed
+// that limit are dropped and counted, rather than delayed, so that a slow
+// backend shows as a lower achieved rate instead of skewed latencies.
+//
+// To build the tool:
+//
+//	$ go get github.com/google/webrisk/cmd/wrbench
+//
+// Example usage:
+//
+//	$ wrbench -apikey=$APIKEY -db=/tmp/webrisk.db -qps=200 -duration=1m < urls.txt
+//	Target QPS:    200
+//	Achieved QPS:  199.9
+//	Lookups:       11994 (0 failed, 0 dropped)
+//
+//	source    count  p50     p90     p99      p99.9    max
+//	database  11511  12µs    31µs    95µs     310µs    1.2ms
+//	cache     402    9µs     20µs    48µs     61µs     61µs
+//	api       81     41.2ms  63.5ms  120.3ms  131ms    131ms
+//	all       11994  12µs    36µs    40.8ms   118.9ms  131ms
+//
+// To load test a wrserver instance instead, with its own database and API
+// key:
+//
+//	$ wrbench -backend=wrserver -server=http://localhost:8080 -qps=1000 < urls.txt
+//
+// The verdict sources of wrserver are read from the X-Webrisk-Source header
+// of its responses.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+var (
+	apiKeyFlag      = flag.String("apikey", "", "specify your Web Risk API key, or the bearer token of wrserver with -backend=wrserver")
+	databaseFlag    = flag.String("db", "", "path to the Web Risk database. By default persistent storage is disabled (not recommended).")
+	serverURLFlag   = flag.String("server", webrisk.DefaultServerURL, "Web Risk API server address, or the URL of wrserver with -backend=wrserver.")
+	proxyFlag       = flag.String("proxy", "", "proxy to use to connect to the HTTP server")
+	backendFlag     = flag.String("backend", backendAPI, "backend of the lookups: api to sync a local database with the Web Risk API, or wrserver to query the wrserver instance at -server")
+	threatTypesFlag = flag.String("threatTypes", "ALL", "threat types to check against")
+	inputFlag       = flag.String("input", "", "file of the URLs to replay, one per line, instead of the standard input")
+	qpsFlag         = flag.Float64("qps", 100, "target number of lookups per second")
+	durationFlag    = flag.Duration("duration", 30*time.Second, "duration of the load test")
+	concurrencyFlag = flag.Int("concurrency", 64, "maximum number of lookups in flight, beyond which lookups are dropped")
+)
+
+const usage = `wrbench: load tests Web Risk lookups at a target rate.
+
+Replays the URLs read from the standard input, or from -input, at -qps lookups
+per second for -duration, and reports the latency percentiles of the lookups
+by the source of their verdicts.
+
+Usage: %s -apikey=$APIKEY [-db=$DATABASE] [-qps=100] [-duration=30s] < urls.txt
+       %s -backend=wrserver -server=$URL [-qps=100] [-duration=30s] < urls.txt
+
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *qpsFlag <= 0 || *durationFlag <= 0 || *concurrencyFlag < 1 {
+		fmt.Fprintln(os.Stderr, "-qps, -duration and -concurrency must be positive")
+		os.Exit(1)
+	}
+
+	in := os.Stdin
+	if *inputFlag != "" {
+		f, err := os.Open(*inputFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to open the input:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	urls, err := readURLs(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read the URLs:", err)
+		os.Exit(1)
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(os.Stderr, "No URL to look up")
+		os.Exit(1)
+	}
+
+	var l looker
+	switch *backendFlag {
+	case backendAPI:
+		if *apiKeyFlag == "" {
+			fmt.Fprintln(os.Stderr, "No -apikey specified")
+			os.Exit(1)
+		}
+		sb, err := webrisk.NewUpdateClient(webrisk.Config{
+			APIKey:        *apiKeyFlag,
+			DBPath:        *databaseFlag,
+			Logger:        os.Stderr,
+			ServerURL:     *serverURLFlag,
+			ProxyURL:      *proxyFlag,
+			ThreatListArg: *threatTypesFlag,
+			Strict:        true,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to initialize Web Risk client:", err)
+			os.Exit(1)
+		}
+		defer sb.Close()
+		// The load test measures lookups, not the initial sync.
+		if err := sb.WaitUntilReady(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to sync the threat lists:", err)
+			os.Exit(1)
+		}
+		l = clientLooker{sb}
+	case backendWRServer:
+		if *serverURLFlag == webrisk.DefaultServerURL {
+			fmt.Fprintln(os.Stderr, "-backend=wrserver requires the URL of wrserver as -server")
+			os.Exit(1)
+		}
+		l, err = newServerLooker(*serverURLFlag, *apiKeyFlag, *proxyFlag, *threatTypesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -backend %q, want %s or %s\n", *backendFlag, backendAPI, backendWRServer)
+		os.Exit(1)
+	}
+
+	r := run(l, urls, *qpsFlag, *durationFlag, *concurrencyFlag)
+	r.write(os.Stdout)
+}
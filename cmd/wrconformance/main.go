@@ -0,0 +1,264 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wrconformance checks that the Web Risk API can be used from the
+// host it runs on, such as to validate a proxy or egress setup before rolling
+// out the Web Risk clients to production.
+//
+// It runs the following steps against the API with the given API key, and
+// reports whether each passed:
+//
+//	sync     downloads every threat list in full into a new database.
+//	diff     reloads the database and requests a diff of every threat list
+//	         from its version token.
+//	lookup   looks up the official test URLs of the threat lists, which must
+//	         be reported unsafe, and a safe URL, which must not.
+//
+// The steps after a failed step are skipped. The exit code is 0 if every step
+// passed, 1 if a step failed, and 2 if the command failed otherwise.
+//
+// To build the tool:
+//
+//	$ go get github.com/google/webrisk/cmd/wrconformance
+//
+// Example usage:
+//
+//	$ wrconformance -apikey=... -proxy=http://proxy.internal:3128
+//	PASS  sync    (4.2s) 3 threat lists, 1234567 hash prefixes
+//	PASS  diff    (0.8s) 3 threat lists
+//	PASS  lookup  (0.3s) 4 URLs
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+const usage = `wrconformance: command-line tool to check the use of the Web Risk API.
+
+Usage: %s -apikey=... [flags]
+
+Exit codes:
+  0  if every step passed.
+  1  if a step failed.
+  2  if the command failed otherwise.
+
+`
+
+const (
+	codePassed = iota
+	codeFailed
+	codeError
+)
+
+// testURLs are the official test URLs of the threat lists.
+var testURLs = map[webrisk.ThreatType]string{
+	webrisk.ThreatTypeMalware:                   "https://testsafebrowsing.appspot.com/s/malware.html",
+	webrisk.ThreatTypeSocialEngineering:         "https://testsafebrowsing.appspot.com/s/phishing.html",
+	webrisk.ThreatTypeUnwantedSoftware:          "https://testsafebrowsing.appspot.com/s/unwanted.html",
+	webrisk.ThreatTypeSocialEngineeringExtended: "https://testsafebrowsing.appspot.com/s/social_engineering_extended_coverage.html",
+}
+
+// safeURL is a URL that is on none of the threat lists.
+const safeURL = "https://www.google.com/"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the steps with the flags of args and returns the exit code.
+func run(args []string, out, errs io.Writer) int {
+	fs := flag.NewFlagSet("wrconformance", flag.ContinueOnError)
+	fs.SetOutput(errs)
+	apiKey := fs.String("apikey", os.Getenv("APIKEY"), "specify your Web Risk API key")
+	serverURL := fs.String("serverURL", webrisk.DefaultServerURL, "URL of the Web Risk API")
+	proxy := fs.String("proxy", "", "proxy to use to connect to the Web Risk API")
+	threatTypes := fs.String("threatTypes", "", "comma separated threat types to check, or ALL; the default threat lists if empty")
+	timeout := fs.Duration("timeout", 5*time.Minute, "maximum duration of every step")
+	verbose := fs.Bool("v", false, "write the logs of the client to stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(errs, usage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return codeError
+	}
+	if fs.NArg() != 0 || *apiKey == "" {
+		fs.Usage()
+		return codeError
+	}
+	dir, err := ioutil.TempDir("", "wrconformance")
+	if err != nil {
+		fmt.Fprintf(errs, "Unable to create a database directory: %v\n", err)
+		return codeError
+	}
+	defer os.RemoveAll(dir)
+
+	c := &checker{
+		conf: webrisk.Config{
+			APIKey:         *apiKey,
+			ServerURL:      *serverURL,
+			ProxyURL:       *proxy,
+			ThreatListArg:  *threatTypes,
+			DBPath:         filepath.Join(dir, "webrisk.db"),
+			RequestTimeout: *timeout,
+		},
+		timeout: *timeout,
+	}
+	if *verbose {
+		c.conf.Logger = errs
+	}
+	defer c.close()
+	for _, s := range steps {
+		start := time.Now()
+		summary, err := c.runStep(s)
+		elapsed := time.Since(start).Round(100 * time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL  %-6s  (%v) %v\n", s.name, elapsed, err)
+			return codeFailed
+		}
+		fmt.Fprintf(out, "PASS  %-6s  (%v) %s\n", s.name, elapsed, summary)
+	}
+	return codePassed
+}
+
+// step is a step of the conformance check, which returns a summary of what
+// it checked.
+type step struct {
+	name string
+	run  func(c *checker, ctx context.Context) (string, error)
+}
+
+var steps = []step{
+	{"sync", (*checker).sync},
+	{"diff", (*checker).diff},
+	{"lookup", (*checker).lookup},
+}
+
+// checker holds the state shared by the steps.
+type checker struct {
+	conf    webrisk.Config
+	timeout time.Duration
+	wr      *webrisk.UpdateClient
+	lists   []webrisk.ThreatType // The threat lists synced by the sync step
+}
+
+// runStep runs s within the timeout of c.
+func (c *checker) runStep(s step) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return s.run(c, ctx)
+}
+
+// close closes the client of c, if any.
+func (c *checker) close() {
+	if c.wr != nil {
+		c.wr.Close()
+		c.wr = nil
+	}
+}
+
+// sync downloads the threat lists into a new database.
+func (c *checker) sync(ctx context.Context) (string, error) {
+	wr, err := webrisk.NewUpdateClient(c.conf)
+	if err != nil {
+		return "", err
+	}
+	c.wr = wr
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		return "", err
+	}
+	stats, err := wr.Status()
+	if err != nil {
+		return "", err
+	}
+	total := 0
+	for td, ls := range stats.Lists {
+		if ls.LastSynced.IsZero() {
+			return "", fmt.Errorf("threat list %v not synced", td)
+		}
+		c.lists = append(c.lists, td)
+		total += ls.HashPrefixes
+	}
+	if total == 0 {
+		return "", errors.New("no hash prefix downloaded")
+	}
+	return fmt.Sprintf("%d threat lists, %d hash prefixes", len(c.lists), total), nil
+}
+
+// diff reloads the database synced by the sync step into a new client, and
+// updates it with diffs from the version tokens of its threat lists.
+func (c *checker) diff(ctx context.Context) (string, error) {
+	c.close()
+	wr, err := webrisk.NewUpdateClient(c.conf)
+	if err != nil {
+		return "", err
+	}
+	c.wr = wr
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		return "", fmt.Errorf("unable to reload the database: %v", err)
+	}
+	start := time.Now()
+	if err := wr.UpdateNow(ctx); err != nil {
+		return "", err
+	}
+	stats, err := wr.Status()
+	if err != nil {
+		return "", err
+	}
+	for _, td := range c.lists {
+		if ls := stats.Lists[td]; ls.LastSynced.Before(start) {
+			return "", fmt.Errorf("threat list %v not updated", td)
+		}
+	}
+	return fmt.Sprintf("%d threat lists", len(c.lists)), nil
+}
+
+// lookup looks up the test URLs of the synced threat lists and a safe URL.
+func (c *checker) lookup(ctx context.Context) (string, error) {
+	var urls []string
+	var want []webrisk.ThreatType
+	for _, td := range c.lists {
+		if u, ok := testURLs[td]; ok {
+			urls, want = append(urls, u), append(want, td)
+		}
+	}
+	urls, want = append(urls, safeURL), append(want, webrisk.ThreatTypeUnspecified)
+	results, err := c.wr.LookupURLResults(ctx, urls)
+	if err != nil {
+		return "", err
+	}
+	for i, r := range results {
+		found := false
+		for _, t := range r.Threats {
+			found = found || t.ThreatType == want[i]
+		}
+		switch {
+		case want[i] == webrisk.ThreatTypeUnspecified && len(r.Threats) > 0:
+			return "", fmt.Errorf("%s reported unsafe: %v", urls[i], r.Threats[0].ThreatType)
+		case want[i] != webrisk.ThreatTypeUnspecified && !found:
+			return "", fmt.Errorf("%s not reported as %v", urls[i], want[i])
+		}
+	}
+	return fmt.Sprintf("%d URLs", len(urls)), nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+	"github.com/google/webrisk/webrisktest"
+)
+
+func TestRun(t *testing.T) {
+	vectors := []struct {
+		threats []webrisk.ThreatType // Threat lists with their test URL
+		args    []string
+		code    int
+		want    []string // Expected output lines, by prefix
+	}{{
+		threats: []webrisk.ThreatType{webrisk.ThreatTypeMalware, webrisk.ThreatTypeSocialEngineering},
+		args:    []string{"-threatTypes=MALWARE,SOCIAL_ENGINEERING"},
+		code:    codePassed,
+		want:    []string{"PASS  sync    ", "PASS  diff    ", "PASS  lookup  "},
+	}, {
+		threats: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		args:    []string{"-threatTypes=MALWARE,SOCIAL_ENGINEERING"},
+		code:    codeFailed,
+		want:    []string{"PASS  sync    ", "PASS  diff    ", "FAIL  lookup  "},
+	}, {
+		args: []string{"-apikey="},
+		code: codeError,
+	}}
+	for i, v := range vectors {
+		var threats []webrisktest.Threat
+		for _, td := range v.threats {
+			threats = append(threats, webrisktest.Threat{URL: testURLs[td], ThreatType: td})
+		}
+		srv := webrisktest.NewServer(threats...)
+		var out, errs bytes.Buffer
+		code := run(append([]string{"-apikey=key", "-serverURL=" + srv.URL, "-timeout=10s"}, v.args...), &out, &errs)
+		srv.Close()
+		if code != v.code {
+			t.Errorf("test %d, run() = %d, want %d\nstdout: %s\nstderr: %s", i, code, v.code, &out, &errs)
+		}
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(v.want) == 0 {
+			continue
+		}
+		if len(lines) != len(v.want) {
+			t.Errorf("test %d, output:\n%s\nwant %d lines", i, &out, len(v.want))
+			continue
+		}
+		for j, want := range v.want {
+			if !strings.HasPrefix(lines[j], want) {
+				t.Errorf("test %d, line %d = %q, want prefix %q", i, j, lines[j], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wrdiff compares two database files persisted by the Web Risk
+// clients with -db, such as snapshots of the database of wrserver taken a day
+// apart.
+//
+// For every threat list, it reports how many hash prefixes were added and
+// removed between the old and the new file. This helps investigating sudden
+// verdict changes, such as a URL flagged yesterday but not today: with -url,
+// wrdiff also reports which expressions of the URL matched a hash prefix of
+// either file, and whether that prefix was added or removed.
+//
+// The exit code is 0 if the threat lists of the files are the same, 1 if
+// they differ, and 2 if the comparison failed.
+//
+// To build the tool:
+//
+//	$ go get github.com/google/webrisk/cmd/wrdiff
+//
+// Example usage:
+//
+//	$ wrdiff -url=http://bad1url.org/login yesterday.db today.db
+//	Old: yesterday.db (updated 2023-06-01T12:34:56Z)
+//	New: today.db (updated 2023-06-02T12:35:02Z)
+//	MALWARE: 1523 added, 1187 removed (298734 -> 299070 hash prefixes)
+//	SOCIAL_ENGINEERING: 4210 added, 3902 removed (512044 -> 512352 hash prefixes)
+//
+//	http://bad1url.org/login:
+//	  SOCIAL_ENGINEERING  bad1url.org/  prefix 1c3e5b0a  removed
+//
+// With -prefixes, the added and removed hash prefixes are printed instead,
+// hex encoded after the name of their list and a + or - sign:
+//
+//	$ wrdiff -prefixes -threatType=MALWARE yesterday.db today.db | head -2
+//	+MALWARE	0000a9c2
+//	-MALWARE	00011f3b
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+const usage = `wrdiff: command-line tool to compare Web Risk database files.
+
+Usage: %s [flags] <old database file> <new database file>
+
+Exit codes:
+  0  if the threat lists of the databases are the same.
+  1  if they differ.
+  2  if the comparison failed.
+
+`
+
+const (
+	codeSame = iota
+	codeDifferent
+	codeFailed
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run compares the database files of args and returns the exit code.
+func run(args []string, out, errs io.Writer) int {
+	fs := flag.NewFlagSet("wrdiff", flag.ContinueOnError)
+	fs.SetOutput(errs)
+	threatType := fs.String("threatType", "", "threat type of the list to compare; all lists if empty")
+	prefixes := fs.Bool("prefixes", false, "print the added and removed hash prefixes instead of their counts")
+	url := fs.String("url", "", "URL whose expressions matching a hash prefix of either database are reported")
+	fs.Usage = func() {
+		fmt.Fprintf(errs, usage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return codeFailed
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return codeFailed
+	}
+	if *prefixes && *url != "" {
+		fmt.Fprintln(errs, "-prefixes and -url are mutually exclusive")
+		return codeFailed
+	}
+	var files [2]*webrisk.DatabaseFile
+	for i, path := range fs.Args() {
+		f, err := webrisk.ReadDatabaseFile(path)
+		if err != nil {
+			fmt.Fprintf(errs, "Unable to read database %s: %v\n", path, err)
+			return codeFailed
+		}
+		files[i] = f
+	}
+
+	var tds []webrisk.ThreatType
+	if *threatType != "" {
+		td := webrisk.ThreatType(pb.ThreatType_value[*threatType])
+		if td == webrisk.ThreatTypeUnspecified {
+			fmt.Fprintf(errs, "Unknown threat type %q\n", *threatType)
+			return codeFailed
+		}
+		tds = append(tds, td)
+	} else {
+		tds = threatLists(files[0], files[1])
+	}
+
+	var exprs []webrisk.ExpressionHash
+	if *url != "" {
+		var err error
+		if exprs, err = webrisk.ComputeHashes(*url, webrisk.ExpressionLimits{}); err != nil {
+			fmt.Fprintf(errs, "Invalid URL %q: %v\n", *url, err)
+			return codeFailed
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	if !*prefixes {
+		for i, label := range []string{"Old", "New"} {
+			fmt.Fprintf(w, "%s: %s (updated %s)\n", label, fs.Arg(i), files[i].Time.UTC().Format(time.RFC3339))
+		}
+	}
+	code := codeSame
+	var matches []match
+	for _, td := range tds {
+		d, err := diffList(files[0], files[1], td, func(p []byte, s status) {
+			if *prefixes && s != unchanged {
+				fmt.Fprintf(w, "%c%v\t%x\n", "+-"[s], td, p)
+			}
+			for _, e := range exprs {
+				if bytes.HasPrefix(e.Hash[:], p) {
+					matches = append(matches, match{td, e.Expression, append([]byte(nil), p...), s})
+				}
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(errs, err)
+			return codeFailed
+		}
+		if d.added > 0 || d.removed > 0 {
+			code = codeDifferent
+		}
+		if !*prefixes {
+			d.write(w, fs.Arg(0), fs.Arg(1))
+		}
+	}
+	if *url != "" {
+		writeMatches(w, *url, matches)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(errs, "Unable to write output:", err)
+		return codeFailed
+	}
+	return code
+}
+
+// threatLists returns the threat types of the lists of either from or to, in
+// ascending order.
+func threatLists(from, to *webrisk.DatabaseFile) []webrisk.ThreatType {
+	seen := make(map[webrisk.ThreatType]bool)
+	var tds []webrisk.ThreatType
+	for _, f := range []*webrisk.DatabaseFile{from, to} {
+		for _, li := range f.Lists() {
+			if !seen[li.ThreatType] {
+				seen[li.ThreatType] = true
+				tds = append(tds, li.ThreatType)
+			}
+		}
+	}
+	sort.Slice(tds, func(i, j int) bool { return tds[i] < tds[j] })
+	return tds
+}
+
+// status tells how a hash prefix changed between the old and the new file.
+type status int
+
+const (
+	added status = iota
+	removed
+	unchanged
+)
+
+func (s status) String() string {
+	return [...]string{"added", "removed", "unchanged"}[s]
+}
+
+// listDiff counts the changes of a threat list between two files.
+type listDiff struct {
+	td               webrisk.ThreatType
+	inOld, inNew     bool // Whether the list is in the old and new file
+	oldSize, newSize int  // Number of hash prefixes of the list in each file
+	added, removed   int
+}
+
+// diffList compares the hash prefixes of the list td of the old file from and
+// the new file to, which may lack it, and calls visit with every hash prefix
+// of either and how it changed, in sorted order.
+func diffList(from, to *webrisk.DatabaseFile, td webrisk.ThreatType, visit func(p []byte, s status)) (*listDiff, error) {
+	d := &listDiff{td: td}
+	var its [2]*webrisk.HashPrefixIterator
+	for i, f := range []*webrisk.DatabaseFile{from, to} {
+		for _, li := range f.Lists() {
+			if li.ThreatType != td {
+				continue
+			}
+			it, err := f.HashPrefixes(td)
+			if err != nil {
+				return nil, err
+			}
+			its[i] = it
+		}
+	}
+	if its[0] == nil && its[1] == nil {
+		return nil, fmt.Errorf("threat list %v in neither database", td)
+	}
+	next := func(it *webrisk.HashPrefixIterator) []byte {
+		if it == nil || !it.Next() {
+			return nil
+		}
+		return it.Prefix()
+	}
+	if its[0] != nil {
+		d.inOld, d.oldSize = true, its[0].Len()
+	}
+	if its[1] != nil {
+		d.inNew, d.newSize = true, its[1].Len()
+	}
+
+	// Both iterators are sorted, so that they are merged in a single pass.
+	a, b := next(its[0]), next(its[1])
+	for a != nil || b != nil {
+		c := bytes.Compare(a, b)
+		switch {
+		case b == nil || (a != nil && c < 0):
+			d.removed++
+			visit(a, removed)
+			a = next(its[0])
+		case a == nil || c > 0:
+			d.added++
+			visit(b, added)
+			b = next(its[1])
+		default:
+			visit(a, unchanged)
+			a, b = next(its[0]), next(its[1])
+		}
+	}
+	return d, nil
+}
+
+// write writes the summary of d to w. oldPath and newPath name the files.
+func (d *listDiff) write(w io.Writer, oldPath, newPath string) {
+	fmt.Fprintf(w, "%v: %d added, %d removed ", d.td, d.added, d.removed)
+	switch {
+	case !d.inOld:
+		fmt.Fprintf(w, "(not in %s)\n", oldPath)
+	case !d.inNew:
+		fmt.Fprintf(w, "(not in %s)\n", newPath)
+	default:
+		fmt.Fprintf(w, "(%d -> %d hash prefixes)\n", d.oldSize, d.newSize)
+	}
+}
+
+// match is a hash prefix matching an expression of the URL given with -url.
+type match struct {
+	td      webrisk.ThreatType
+	pattern string
+	prefix  []byte
+	status  status
+}
+
+// writeMatches writes the hash prefixes matching the expressions of url to w.
+func writeMatches(w io.Writer, url string, matches []match) {
+	fmt.Fprintf(w, "\n%s:\n", url)
+	if len(matches) == 0 {
+		fmt.Fprintln(w, "  no expression matches a hash prefix of either database")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, m := range matches {
+		fmt.Fprintf(tw, "  %v\t%s\tprefix %x\t%v\n", m.td, m.pattern, m.prefix, m.status)
+	}
+	tw.Flush()
+}
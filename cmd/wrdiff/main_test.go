@@ -0,0 +1,111 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// writeDatabase writes the database file of a client whose malware list
+// holds the given 4 byte hash prefixes, synced from a fake Web Risk API, and
+// returns its path.
+func writeDatabase(t *testing.T, hashes ...string) string {
+	t.Helper()
+	hashes = append([]string(nil), hashes...)
+	sort.Strings(hashes)
+	raw := strings.Join(hashes, "")
+	sum := sha256.Sum256([]byte(raw))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":computeDiff") {
+			w.Write([]byte("{}"))
+			return
+		}
+		b, _ := protojson.Marshal(&pb.ComputeThreatListDiffResponse{
+			ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+			Additions:       &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(raw)}}},
+			NewVersionToken: []byte("token"),
+			Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: sum[:]},
+		})
+		w.Write(b)
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "webrisk.db")
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "key",
+		ServerURL:    ts.URL,
+		DBPath:       path,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	bad := sha256.Sum256([]byte("bad.example.com/"))
+	prefix := string(bad[:4])
+	before := writeDatabase(t, "aaaa", "bbbb", prefix)
+	after := writeDatabase(t, "bbbb", "cccc")
+	vectors := []struct {
+		args []string
+		code int
+		want string // Regular expression matching the output
+	}{
+		{[]string{before, after}, codeDifferent, `(?s)^Old: .* \(updated .*\)\nNew: .*\nMALWARE: 1 added, 2 removed \(3 -> 2 hash prefixes\)\n$`},
+		{[]string{"-threatType", "MALWARE", after, after}, codeSame, `\nMALWARE: 0 added, 0 removed \(2 -> 2 hash prefixes\)\n$`},
+		{[]string{"-prefixes", before, after}, codeDifferent, fmt.Sprintf(`^(-MALWARE\t(61616161|%x)\n|\+MALWARE\t63636363\n){3}$`, prefix)},
+		{[]string{"-url", "http://bad.example.com/login", before, after}, codeDifferent,
+			fmt.Sprintf(`\n\nhttp://bad.example.com/login:\n  MALWARE  bad.example.com/  prefix %x  removed\n$`, prefix)},
+		{[]string{"-url", "http://good.example.com/", before, after}, codeDifferent, `\n  no expression matches a hash prefix of either database\n$`},
+		{[]string{"-threatType", "SOCIAL_ENGINEERING", before, after}, codeFailed, `^$`},
+		{[]string{"-threatType", "BOGUS", before, after}, codeFailed, `^$`},
+		{[]string{"-prefixes", "-url", "http://example.com/", before, after}, codeFailed, `^$`},
+		{[]string{before, after + ".missing"}, codeFailed, `^$`},
+		{[]string{before}, codeFailed, `^$`},
+	}
+	for i, v := range vectors {
+		var out, errs bytes.Buffer
+		if got := run(v.args, &out, &errs); got != v.code {
+			t.Errorf("test %d, run(%q) = %d, want %d: %s", i, v.args, got, v.code, errs.String())
+		}
+		if !regexp.MustCompile(v.want).MatchString(out.String()) {
+			t.Errorf("test %d, run(%q) output = %q, want match of %q", i, v.args, out.String(), v.want)
+		}
+	}
+}
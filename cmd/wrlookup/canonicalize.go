@@ -0,0 +1,100 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/webrisk"
+)
+
+// canonicalizeAll writes the canonical form of the URLs read from in, one per
+// line, and their expressions with the full SHA-256 hash and the 4-byte hash
+// prefix of every expression within limits, to out in the given format,
+// without looking them up. Blank lines are skipped, and invalid URLs reported
+// to errs. It returns the exit code, codeInvalid if a URL is invalid or the
+// input could not be read, and codeFailed if the output could not be written.
+func canonicalizeAll(in io.Reader, format string, limits webrisk.ExpressionLimits, out, errs io.Writer) int {
+	var cw *csv.Writer
+	switch format {
+	case formatText:
+	case formatCSV, formatTSV:
+		cw = csv.NewWriter(out)
+		if format == formatTSV {
+			cw.Comma = '\t'
+		}
+		cw.Write([]string{"url", "canonical_url", "expression", "hash", "hash_prefix"})
+	default:
+		fmt.Fprintf(errs, "Unknown output format %q\n", format)
+		return codeInvalid
+	}
+
+	code := codeSafe
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		url := strings.TrimSpace(scanner.Text())
+		if url == "" {
+			continue
+		}
+		canonical, err := webrisk.CanonicalURL(url)
+		var hashes []webrisk.ExpressionHash
+		if err == nil {
+			hashes, err = webrisk.ComputeHashes(url, limits)
+		}
+		if err != nil {
+			fmt.Fprintln(errs, "Invalid URL:", url)
+			code |= codeInvalid
+			continue
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\n  canonical URL: %s\n", url, canonical)
+		for _, h := range hashes {
+			hash, prefix := hex.EncodeToString(h.Hash[:]), hex.EncodeToString(h.Prefix())
+			if cw == nil {
+				fmt.Fprintf(&b, "  expression %s: hash %s, prefix %s\n", h.Expression, hash, prefix)
+			} else {
+				cw.Write([]string{url, canonical, h.Expression, hash, prefix})
+			}
+		}
+		if cw == nil {
+			_, err = io.WriteString(out, b.String())
+		} else {
+			cw.Flush()
+			err = cw.Error()
+		}
+		if err != nil {
+			fmt.Fprintln(errs, "Unable to write output:", err)
+			return code | codeFailed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(errs, "Unable to read input:", err)
+		code |= codeInvalid
+	}
+	if cw != nil {
+		// The header is written even without any URL.
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			fmt.Fprintln(errs, "Unable to write output:", err)
+			code |= codeFailed
+		}
+	}
+	return code
+}
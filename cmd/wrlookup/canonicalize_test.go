@@ -0,0 +1,62 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestCanonicalizeAll(t *testing.T) {
+	vectors := []struct {
+		input  string
+		format string
+		want   string
+		code   int
+	}{{
+		input:  "http://BAD.example.com/a/../?q=1#frag\n\n",
+		format: formatText,
+		want: "http://BAD.example.com/a/../?q=1#frag\n" +
+			"  canonical URL: http://bad.example.com/?q=1\n" +
+			"  expression bad.example.com/: hash 588120b0014050abfb3c7f5a68f61b8591bfec81b4444b984a1856be13abc8ce, prefix 588120b0\n" +
+			"  expression bad.example.com/?q=1: hash 2fbfdf88bbb51841765218e1c689e321865450325c5948dda430e3d8903df98c, prefix 2fbfdf88\n" +
+			"  expression example.com/: hash 73d986e009065f182c10bcb6a45db3d6eda9498f8930654af2653f8a938cd801, prefix 73d986e0\n" +
+			"  expression example.com/?q=1: hash 27a016a8f3d0afa9b888dabbc638539a6127b492cf6310f47de0b802cfcae410, prefix 27a016a8\n",
+		code: codeSafe,
+	}, {
+		input:  "example.com\nhttp://[::1\n",
+		format: formatTSV,
+		want: "url\tcanonical_url\texpression\thash\thash_prefix\n" +
+			"example.com\thttp://example.com/\texample.com/\t73d986e009065f182c10bcb6a45db3d6eda9498f8930654af2653f8a938cd801\t73d986e0\n",
+		code: codeInvalid,
+	}, {
+		input:  "",
+		format: formatCSV,
+		want:   "url,canonical_url,expression,hash,hash_prefix\n",
+		code:   codeSafe,
+	}}
+	for i, v := range vectors {
+		var out, errs bytes.Buffer
+		if got := canonicalizeAll(strings.NewReader(v.input), v.format, webrisk.ExpressionLimits{}, &out, &errs); got != v.code {
+			t.Errorf("test %d, canonicalizeAll() = %d, want %d", i, got, v.code)
+		}
+		if got := out.String(); got != v.want {
+			t.Errorf("test %d, output mismatch:\ngot  %q\nwant %q", i, got, v.want)
+		}
+	}
+}
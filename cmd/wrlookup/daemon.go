@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// isNamedPipe reports whether path is a named pipe.
+func isNamedPipe(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeNamedPipe != 0
+}
+
+// outputWriter records whether writing to its resultWriter ever failed.
+type outputWriter struct {
+	resultWriter
+	err error
+}
+
+func (o *outputWriter) write(r *lookupResult) error {
+	if err := o.resultWriter.write(r); err != nil {
+		o.err = err
+		return err
+	}
+	return nil
+}
+
+func (o *outputWriter) flush() error {
+	if err := o.resultWriter.flush(); err != nil {
+		o.err = err
+		return err
+	}
+	return nil
+}
+
+// serve looks up the URLs read from the inputs returned by open, one after
+// the other, and writes their results to out as they come, with up to workers
+// lookups in flight. Opening a named pipe blocks until a writer opens it, and
+// reading it ends once every writer closed it, so that reopening the pipe
+// serves every pipeline writing to it in turn.
+//
+// serve returns once open or writing to out failed, with the bitwise OR of
+// the exit codes of every input.
+func serve(ul urlLooker, open func() (io.ReadCloser, error), workers int, out resultWriter, errs io.Writer) int {
+	ow := &outputWriter{resultWriter: out}
+	code := codeSafe
+	for ow.err == nil {
+		in, err := open()
+		if err != nil {
+			fmt.Fprintln(errs, "Unable to open input:", err)
+			return code | codeInvalid
+		}
+		code |= lookupAll(ul, in, workers, ow, errs)
+		in.Close()
+	}
+	return code
+}
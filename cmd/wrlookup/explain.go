@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/webrisk"
+)
+
+// urlExplainer explains the verdicts of URLs. It is implemented by
+// explainLooker.
+type urlExplainer interface {
+	explainURL(ctx context.Context, url string) (*webrisk.URLExplanation, error)
+}
+
+// explainLooker explains the lookups of an UpdateClient, for -explain.
+type explainLooker struct {
+	urlLooker
+	wr     *webrisk.UpdateClient
+	wanted map[webrisk.ThreatType]bool // Threat types reported, or all if nil
+}
+
+func (e explainLooker) explainURL(ctx context.Context, url string) (*webrisk.URLExplanation, error) {
+	x, err := e.wr.ExplainURL(ctx, url)
+	if err != nil || e.wanted == nil {
+		return x, err
+	}
+	var threats []webrisk.URLThreat
+	for _, t := range x.Result.Threats {
+		if e.wanted[t.ThreatType] {
+			threats = append(threats, t)
+		}
+	}
+	x.Result.Threats = threats
+	for i, ex := range x.Expressions {
+		var tds []webrisk.ThreatType
+		for _, td := range ex.ThreatTypes {
+			if e.wanted[td] {
+				tds = append(tds, td)
+			}
+		}
+		x.Expressions[i].ThreatTypes = tds
+	}
+	return x, nil
+}
+
+// writeExplanation writes x as indented lines: the canonical URL, where the
+// verdict came from, and whether every expression of the URL had its hash
+// prefix in the database and its full hash on a threat list.
+func writeExplanation(w io.Writer, x *webrisk.URLExplanation) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  canonical URL: %s\n", x.CanonicalURL)
+	fmt.Fprintf(&b, "  verdict source: %v\n", x.Result.Source)
+	for _, e := range x.Expressions {
+		if len(e.HashPrefix) == 0 {
+			fmt.Fprintf(&b, "  expression %s: hash %s not in database\n", e.Pattern, hex.EncodeToString(e.Hash[:4]))
+			continue
+		}
+		matched := "no full hash match"
+		if len(e.ThreatTypes) > 0 {
+			matched = "matched " + joinThreatTypes(e.ThreatTypes)
+		}
+		fmt.Fprintf(&b, "  expression %s: hash prefix %s in %s, %s\n",
+			e.Pattern, hex.EncodeToString(e.HashPrefix), joinThreatTypes(e.PrefixThreatTypes), matched)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// joinThreatTypes returns the names of tds separated by commas.
+func joinThreatTypes(tds []webrisk.ThreatType) string {
+	var names []string
+	for _, td := range tds {
+		names = append(names, td.String())
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// threatFilter reports only the threats of the wanted types among those found
+// by its urlLooker, so that a run can be restricted to some threat lists
+// without syncing a database of fewer lists.
+type threatFilter struct {
+	urlLooker
+	wanted map[webrisk.ThreatType]bool
+}
+
+func (f threatFilter) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	results, err := f.urlLooker.LookupURLResults(ctx, urls)
+	for i, r := range results {
+		var threats []webrisk.URLThreat
+		for _, t := range r.Threats {
+			if f.wanted[t.ThreatType] {
+				threats = append(threats, t)
+			}
+		}
+		results[i].Threats = threats
+	}
+	return results, err
+}
+
+// parseThreatFilter parses the comma-separated threat types of names, which
+// must be among the threat lists of lists, in the format of -threatTypes.
+func parseThreatFilter(names, lists string) (map[webrisk.ThreatType]bool, error) {
+	parse := func(names string) (map[webrisk.ThreatType]bool, error) {
+		tds := make(map[webrisk.ThreatType]bool)
+		for _, name := range strings.Split(names, ",") {
+			if name == "ALL" {
+				for _, td := range webrisk.DefaultThreatLists {
+					tds[td] = true
+				}
+				continue
+			}
+			td := webrisk.ThreatType(pb.ThreatType_value[name])
+			if td == webrisk.ThreatTypeUnspecified {
+				return nil, fmt.Errorf("unknown threat type %q", name)
+			}
+			tds[td] = true
+		}
+		return tds, nil
+	}
+	wanted, err := parse(names)
+	if err != nil {
+		return nil, err
+	}
+	if lists == "" {
+		lists = "ALL"
+	}
+	available, err := parse(lists)
+	if err != nil {
+		return nil, err
+	}
+	for td := range wanted {
+		if !available[td] {
+			return nil, fmt.Errorf("threat type %v is not among -threatTypes", td)
+		}
+	}
+	return wanted, nil
+}
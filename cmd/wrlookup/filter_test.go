@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+// threatLooker reports every URL as matching threats of all the default
+// threat lists.
+type threatLooker struct{}
+
+func (threatLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	results := make([]webrisk.URLResult, len(urls))
+	for i, u := range urls {
+		for _, td := range webrisk.DefaultThreatLists {
+			results[i].Threats = append(results[i].Threats, webrisk.URLThreat{Pattern: u, ThreatType: td})
+		}
+	}
+	return results, nil
+}
+
+func TestThreatFilter(t *testing.T) {
+	f := threatFilter{threatLooker{}, map[webrisk.ThreatType]bool{webrisk.ThreatTypeMalware: true}}
+	results, err := f.LookupURLResults(context.Background(), []string{"http://example.com/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []webrisk.URLThreat{{Pattern: "http://example.com/", ThreatType: webrisk.ThreatTypeMalware}}
+	if !reflect.DeepEqual(results[0].Threats, want) {
+		t.Errorf("Threats = %v, want %v", results[0].Threats, want)
+	}
+}
+
+func TestParseThreatFilter(t *testing.T) {
+	vectors := []struct {
+		names string
+		lists string
+		want  []webrisk.ThreatType
+		fail  bool
+	}{{
+		names: "MALWARE,SOCIAL_ENGINEERING",
+		lists: "ALL",
+		want:  []webrisk.ThreatType{webrisk.ThreatTypeMalware, webrisk.ThreatTypeSocialEngineering},
+	}, {
+		names: "MALWARE",
+		lists: "",
+		want:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+	}, {
+		names: "ALL",
+		lists: "ALL",
+		want:  webrisk.DefaultThreatLists,
+	}, {
+		names: "UNWANTED_SOFTWARE",
+		lists: "MALWARE,UNWANTED_SOFTWARE",
+		want:  []webrisk.ThreatType{webrisk.ThreatTypeUnwantedSoftware},
+	}, {
+		names: "SOCIAL_ENGINEERING",
+		lists: "MALWARE",
+		fail:  true,
+	}, {
+		names: "BOGUS",
+		lists: "ALL",
+		fail:  true,
+	}}
+	for i, v := range vectors {
+		got, err := parseThreatFilter(v.names, v.lists)
+		if (err != nil) != v.fail {
+			t.Errorf("test %d, parseThreatFilter() error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		if v.fail {
+			continue
+		}
+		want := make(map[webrisk.ThreatType]bool)
+		for _, td := range v.want {
+			want[td] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d, parseThreatFilter() = %v, want %v", i, got, want)
+		}
+	}
+}
@@ -17,6 +17,110 @@
 // the Web Risk API. The "Safe" or "Unsafe" verdict is printed to STDOUT.
 // If an error occurred, debug information may be printed to STDERR.
 //
+// With -format=csv or -format=tsv, the results are printed as CSV or TSV
+// records instead, after a header row, for instance to be opened in a
+// spreadsheet:
+//
+//	$ wrlookup -apikey $APIKEY -format=csv < urls.txt > results.csv
+//	url,verdict,threat_types,source,latency
+//	https://google.com,safe,,database,0.012
+//	http://bad1url.org,unsafe,MALWARE,api,85.301
+//
+// The threat types of a URL are separated by commas, and the latency of its
+// lookup is in milliseconds.
+//
+// With -quiet, only the unsafe URLs are printed, one per line, to be fed to
+// the next stage of a pipeline:
+//
+//	$ wrlookup -apikey $APIKEY -quiet < urls.txt | xargs -r -n1 ./quarantine.sh
+//
+// With -explain, every verdict is followed by its explanation: the canonical
+// URL, whether the verdict came from the local database, the cache or the
+// API, and for every host suffix and path prefix expression of the URL,
+// whether its hash prefix is in the database and its full hash on a threat
+// list, such as to find out why a URL was or was not reported unsafe:
+//
+//	$ echo http://bad.example.com/a | wrlookup -apikey $APIKEY -explain
+//	Unsafe URL: [MALWARE]
+//	  canonical URL: http://bad.example.com/a
+//	  verdict source: api
+//	  expression bad.example.com/a: hash 28ee5b37 not in database
+//	  expression bad.example.com/: hash prefix 588120b0 in MALWARE, matched MALWARE
+//	  expression example.com/a: hash 036cbe16 not in database
+//	  expression example.com/: hash prefix 73d986e0 in MALWARE, no full hash match
+//
+// With -canonicalize, the URLs are not looked up. Instead, the canonical form
+// of every URL is printed, followed by its host suffix and path prefix
+// expressions with their full SHA-256 hash and 4-byte hash prefix, such as to
+// compare them with other Safe Browsing implementations. No API key is
+// needed:
+//
+//	$ echo http://BAD.example.com/a/../?q=1#frag | wrlookup -canonicalize
+//	http://BAD.example.com/a/../?q=1#frag
+//	  canonical URL: http://bad.example.com/?q=1
+//	  expression bad.example.com/: hash 588120b0..., prefix 588120b0
+//	  ...
+//
+// With -input, the URLs are read from that file rather than from STDIN, and
+// with -workers, up to that many URLs are looked up concurrently, so that
+// large lists are processed faster. The results are still printed in the
+// order of the input:
+//
+//	$ wrlookup -apikey $APIKEY -db /tmp/webrisk.db -input urls.txt -workers 32 -format=csv
+//
+// With -reportThreatTypes, only the threats of the given types are reported,
+// so that a run can be restricted to some threat lists, such as for an
+// investigation. Unlike -threatTypes, which sets the threat lists synced to
+// the database, it leaves the database untouched, so that it can be shared by
+// runs reporting different threat types:
+//
+//	$ wrlookup -apikey $APIKEY -db /tmp/webrisk.db -reportThreatTypes MALWARE,SOCIAL_ENGINEERING < urls.txt
+//
+// With -backend=wrserver, URLs are looked up with the wrserver instance at
+// -server rather than with a local database synced with the Web Risk API, so
+// that no database is synced and the API key of the server is used. The
+// -apikey, if any, is sent to wrserver as a bearer token:
+//
+//	$ wrlookup -backend=wrserver -server https://wrserver.example.com < urls.txt
+//
+// With -daemon, the tool waits for the threat lists to be synced and then
+// keeps running, so that the database stays warm and up to date. If -input is
+// a named pipe, it is reopened whenever its writers closed it, so that every
+// pipeline writing URLs to it gets its verdicts printed as the lines arrive,
+// without syncing the database again:
+//
+//	$ mkfifo /tmp/wrlookup.fifo
+//	$ wrlookup -apikey $APIKEY -db /tmp/webrisk.db -daemon -input /tmp/wrlookup.fifo &
+//	$ echo https://google.com > /tmp/wrlookup.fifo
+//	Safe URL: https://google.com
+//
+// With -progress, the number of URLs processed so far and the rate of the
+// lookups are periodically printed to STDERR, along with the number of URLs
+// remaining if -input is a regular file. With -summary, the number of safe and
+// unsafe URLs, the latter per threat type, and whether their verdicts came
+// from the local database, the cache or the API, are printed to STDERR once
+// the input is exhausted:
+//
+//	$ wrlookup -apikey $APIKEY -input urls.txt -workers 32 -progress 10s -summary > results.txt
+//	Processed 1200/5000 URLs (24.0%), 3800 remaining, 120.3 URLs/s
+//	...
+//	Processed 5000 URLs in 41.562s, 120.3 URLs/s
+//	  safe:    4893
+//	  unsafe:  102
+//	    MALWARE: 80
+//	    SOCIAL_ENGINEERING: 24
+//	  failed:  3
+//	  invalid: 2
+//	Sources: database 4812, cache 31, api 152
+//
+// The exit code is 0 only if every URL was looked up and found safe, so that
+// the tool can gate CI pipelines on the safety of links. Otherwise it is the
+// bitwise OR of 1 if a URL is unsafe, 2 if a lookup failed, and 4 if the
+// input was invalid. Lookups fail until the threat lists were synced, rather
+// than reporting URLs safe for lack of data:
+//
+//	$ grep -ohE 'https?://[^ )"]+' docs/*.md | wrlookup -apikey $APIKEY || exit 1
+//
 // To build the tool:
 //
 //	$ go get github.com/google/webrisk/cmd/wrlookup
@@ -32,9 +136,14 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/google/webrisk"
 )
@@ -42,26 +151,47 @@ import (
 var (
 	apiKeyFlag             = flag.String("apikey", "", "specify your Web Risk API key")
 	databaseFlag           = flag.String("db", "", "path to the Web Risk database. By default persistent storage is disabled (not recommended).")
-	serverURLFlag          = flag.String("server", webrisk.DefaultServerURL, "Web Risk API server address.")
+	serverURLFlag          = flag.String("server", webrisk.DefaultServerURL, "Web Risk API server address, or the URL of wrserver with -backend=wrserver.")
+	backendFlag            = flag.String("backend", backendAPI, "backend of the lookups: api to sync a local database with the Web Risk API, or wrserver to query the wrserver instance at -server")
 	proxyFlag              = flag.String("proxy", "", "proxy to use to connect to the HTTP server")
 	threatTypesFlag        = flag.String("threatTypes", "ALL", "threat types to check against")
+	reportThreatTypesFlag  = flag.String("reportThreatTypes", "", "comma-separated threat types to report for this run, among those of -threatTypes; all if empty")
 	maxDiffEntriesFlag     = flag.Int("maxDiffEntries", 0, "maximum number of diff entries to return from a ComputeThreatListDiff request")
 	maxDatabaseEntriesFlag = flag.Int("maxDatabaseEntries", 0, "maximum number of database entries to be stored in the local database")
+	listConstraintsFlag    = flag.String("listConstraints", "", "per threat list overrides of maxDiffEntries and maxDatabaseEntries")
+	maxHostComponentsFlag  = flag.Int("maxHostComponents", 0, "maximum number of trailing host components of the host suffixes looked up for every URL; 0 for the default of 7")
+	maxPathComponentsFlag  = flag.Int("maxPathComponents", 0, "maximum number of leading path components of the path prefixes looked up for every URL; 0 for the default of 4")
+	schemePolicyFlag       = flag.String("schemePolicy", "lookup", "policy for the URLs whose scheme is neither http nor https: lookup them like http URLs, skip them as unsupported, error to reject them as invalid, or normalize them to the web URL they wrap, such as the target of view-source: and intent: URLs, skipping the others")
+	inputFlag              = flag.String("input", "", "path of a file of URLs to look up, one per line; they are read from STDIN if empty or -")
+	workersFlag            = flag.Int("workers", 1, "maximum number of URLs looked up concurrently")
+	formatFlag             = flag.String("format", formatText, "output format: text, or csv or tsv for records with a header row")
+	canonicalizeFlag       = flag.Bool("canonicalize", false, "print the canonical form and the expressions of every URL with their hashes, without looking them up")
+	explainFlag            = flag.Bool("explain", false, "explain every verdict by the lookups of the expressions of the URL")
+	quietFlag              = flag.Bool("quiet", false, "print only the unsafe URLs, one per line")
+	progressFlag           = flag.Duration("progress", 0, "period of the progress reports printed to STDERR, such as 10s; disabled if zero")
+	summaryFlag            = flag.Bool("summary", false, "print a summary of the results to STDERR once the input is exhausted")
+	daemonFlag             = flag.Bool("daemon", false, "keep running once the threat lists are synced, reopening the -input named pipe whenever its writers closed it")
 )
 
 const usage = `wrlookup: command-line tool to lookup URLs with Web Risk.
 
-Tool reads one URL per line from STDIN and checks every URL against the
-Web Risk API. The Safe or Unsafe verdict is printed to STDOUT. If an error
-occurred, debug information may be printed to STDERR.
+Tool reads one URL per line from STDIN, or from the -input file, and checks
+every URL against the Web Risk API, with up to -workers lookups in flight.
+With -daemon, it keeps running and reopens the -input named pipe whenever
+its writers closed it. The Safe or Unsafe verdict is printed to STDOUT, or
+CSV or TSV records with -format=csv or -format=tsv, or only the unsafe URLs
+with -quiet. If an error occurred, debug information may be printed to
+STDERR.
 
 Exit codes (bitwise OR of following codes):
   0  if and only if all URLs were looked up and are safe.
   1  if at least one URL is not safe.
-  2  if at least one URL lookup failed.
-  4  if the input was invalid.
+  2  if at least one URL lookup failed, or the threat lists could not be
+     synced.
+  4  if the input was invalid, such as an invalid URL.
 
 Usage: %s -apikey=$APIKEY
+       %s -backend=wrserver -server=$WRSERVER_URL
 
 `
 
@@ -72,16 +202,131 @@ const (
 	codeInvalid
 )
 
+// errInvalidURL is the error of the lookups of invalid URLs.
+var errInvalidURL = errors.New("invalid URL")
+
+// schemePolicy is how lookups treat the URLs whose scheme is neither http nor
+// https, set with -schemePolicy.
+var schemePolicy webrisk.SchemePolicy
+
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		fmt.Fprintf(os.Stderr, usage, os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
-	if *apiKeyFlag == "" {
+	if *canonicalizeFlag {
+		in := os.Stdin
+		if *inputFlag != "" && *inputFlag != "-" {
+			var err error
+			if in, err = os.Open(*inputFlag); err != nil {
+				fmt.Fprintln(os.Stderr, "Unable to open input:", err)
+				os.Exit(codeInvalid)
+			}
+		}
+		os.Exit(canonicalizeAll(in, *formatFlag, expressionLimits(), os.Stdout, os.Stderr))
+	}
+	if *apiKeyFlag == "" && *backendFlag != backendWRServer {
 		fmt.Fprintln(os.Stderr, "No -apikey specified")
 		os.Exit(codeInvalid)
 	}
+	var err error
+	if schemePolicy, err = webrisk.ParseSchemePolicy(*schemePolicyFlag); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -schemePolicy:", err)
+		os.Exit(codeInvalid)
+	}
+	out, err := newResultWriter(os.Stdout, *formatFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid -format:", err)
+		os.Exit(codeInvalid)
+	}
+	if *quietFlag {
+		if *formatFlag != formatText {
+			fmt.Fprintln(os.Stderr, "-quiet cannot be used with -format")
+			os.Exit(codeInvalid)
+		}
+		out = unsafeWriter{os.Stdout}
+	}
+	stdin := *inputFlag == "" || *inputFlag == "-"
+	if *daemonFlag && !stdin && !isNamedPipe(*inputFlag) {
+		fmt.Fprintln(os.Stderr, "-daemon requires -input to be a named pipe")
+		os.Exit(codeInvalid)
+	}
+
+	if *explainFlag && (*backendFlag != backendAPI || *formatFlag != formatText || *quietFlag) {
+		fmt.Fprintln(os.Stderr, "-explain requires the api -backend and the text -format")
+		os.Exit(codeInvalid)
+	}
+
+	var ul urlLooker
+	var sb *webrisk.UpdateClient
+	switch *backendFlag {
+	case backendAPI:
+		sb = newUpdateClient()
+		ul = sb
+	case backendWRServer:
+		if *serverURLFlag == webrisk.DefaultServerURL {
+			fmt.Fprintln(os.Stderr, "-backend=wrserver requires the -server URL of wrserver")
+			os.Exit(codeInvalid)
+		}
+		if ul, err = newServerLooker(*serverURLFlag, *apiKeyFlag, *proxyFlag, *threatTypesFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to initialize wrserver client:", err)
+			os.Exit(codeInvalid)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -backend %q, want %s or %s\n", *backendFlag, backendAPI, backendWRServer)
+		os.Exit(codeInvalid)
+	}
+	var wanted map[webrisk.ThreatType]bool
+	if *reportThreatTypesFlag != "" {
+		if wanted, err = parseThreatFilter(*reportThreatTypesFlag, *threatTypesFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid -reportThreatTypes:", err)
+			os.Exit(codeInvalid)
+		}
+		ul = threatFilter{ul, wanted}
+	}
+	if *explainFlag {
+		ul = explainLooker{ul, sb, wanted}
+	}
+
+	var stats *runStats
+	done := make(chan struct{})
+	if *progressFlag > 0 || *summaryFlag {
+		total := -1
+		if !stdin && !*daemonFlag {
+			total = countURLs(*inputFlag)
+		}
+		stats = newRunStats(total)
+		out = statsWriter{out, stats}
+		if *progressFlag > 0 {
+			go stats.report(os.Stderr, *progressFlag, done)
+		}
+	}
+
+	var code int
+	switch {
+	case stdin:
+		code = lookupAll(ul, os.Stdin, *workersFlag, out, os.Stderr)
+	case *daemonFlag:
+		code = serve(ul, func() (io.ReadCloser, error) { return os.Open(*inputFlag) }, *workersFlag, out, os.Stderr)
+	default:
+		in, err := os.Open(*inputFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to open input:", err)
+			os.Exit(codeInvalid)
+		}
+		code = lookupAll(ul, in, *workersFlag, out, os.Stderr)
+	}
+	close(done)
+	if *summaryFlag {
+		fmt.Fprint(os.Stderr, stats.summary(time.Now()))
+	}
+	os.Exit(code)
+}
+
+// newUpdateClient returns a client syncing the threat lists with the Web Risk
+// API. With -daemon, it waits until they are synced.
+func newUpdateClient() *webrisk.UpdateClient {
 	sb, err := webrisk.NewUpdateClient(webrisk.Config{
 		APIKey:             *apiKeyFlag,
 		DBPath:             *databaseFlag,
@@ -91,31 +336,146 @@ func main() {
 		ThreatListArg:      *threatTypesFlag,
 		MaxDiffEntries:     int32(*maxDiffEntriesFlag),
 		MaxDatabaseEntries: int32(*maxDatabaseEntriesFlag),
+		ListConstraintsArg: *listConstraintsFlag,
+		ExpressionLimits:   expressionLimits(),
+		SchemePolicy:       schemePolicy,
+		// URLs must not be reported safe for lack of threat lists.
+		Strict: true,
 	})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Unable to initialize Web Risk client: ", err)
 		os.Exit(codeInvalid)
 	}
+	if *daemonFlag {
+		// URLs are looked up as they arrive, rather than failing until the
+		// threat lists are synced.
+		if err := sb.WaitUntilReady(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to sync the threat lists:", err)
+			os.Exit(codeFailed)
+		}
+	}
+	return sb
+}
+
+// expressionLimits returns the URL expression limits set with
+// -maxHostComponents and -maxPathComponents.
+func expressionLimits() webrisk.ExpressionLimits {
+	return webrisk.ExpressionLimits{
+		MaxHostComponents: *maxHostComponentsFlag,
+		MaxPathComponents: *maxPathComponentsFlag,
+	}
+}
+
+// urlLooker looks up URLs. It is implemented by webrisk.UpdateClient and
+// serverLooker.
+type urlLooker interface {
+	LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error)
+}
+
+// lookupAll looks up the URLs read from in, one per line, with up to workers
+// lookups in flight, and writes their results to out in the order of the
+// input, and the errors to errs. Blank lines are skipped. It returns the exit
+// code, the bitwise OR of the codes of every URL: codeUnsafe if it is unsafe,
+// codeFailed if its lookup failed and codeInvalid if it is not a valid URL.
+// Failing to read the input or to write the output is reported as
+// codeInvalid or codeFailed, respectively, and stops the lookups.
+func lookupAll(ul urlLooker, in io.Reader, workers int, out resultWriter, errs io.Writer) int {
+	if workers < 1 {
+		workers = 1
+	}
+	// Lookups are queued in the order of the input, up to workers ahead of
+	// the result being written.
+	type lookup struct {
+		r    *lookupResult
+		done chan struct{}
+	}
+	jobs := make(chan lookup)
+	pending := make(chan lookup, workers)
+	stop := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			url := strings.TrimSpace(scanner.Text())
+			if url == "" {
+				continue
+			}
+			l := lookup{&lookupResult{url: url}, make(chan struct{})}
+			select {
+			case pending <- l:
+			case <-stop:
+				return
+			}
+			jobs <- l
+		}
+		readErr = scanner.Err()
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for l := range jobs {
+				lookupURL(ul, l.r)
+				close(l.done)
+			}
+		}()
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
 	code := codeSafe
-	for scanner.Scan() {
-		url := scanner.Text()
-		threats, err := sb.LookupURLs([]string{url})
-		if err != nil {
-			fmt.Fprintln(os.Stdout, "Unknown URL:", url)
-			fmt.Fprintln(os.Stderr, "Lookup error:", err)
+	for l := range pending {
+		<-l.done
+		r := l.r
+		switch {
+		case r.err == errInvalidURL:
+			fmt.Fprintln(errs, "Invalid URL:", r.url)
+			code |= codeInvalid
+		case r.err != nil:
+			fmt.Fprintln(errs, "Lookup error:", r.err)
 			code |= codeFailed
-		} else if len(threats[0]) == 0 {
-			fmt.Fprintln(os.Stdout, "Safe URL:", url)
-		} else {
-			fmt.Fprintln(os.Stdout, "Unsafe URL:", threats[0])
+		case len(r.threats) > 0:
 			code |= codeUnsafe
 		}
+		if err := out.write(r); err != nil {
+			close(stop)
+			fmt.Fprintln(errs, "Unable to write output:", err)
+			return code | codeFailed
+		}
 	}
-	if scanner.Err() != nil {
-		fmt.Fprintln(os.Stderr, "Unable to read input:", scanner.Err())
+	if readErr != nil {
+		fmt.Fprintln(errs, "Unable to read input:", readErr)
 		code |= codeInvalid
 	}
-	os.Exit(code)
+	if err := out.flush(); err != nil {
+		fmt.Fprintln(errs, "Unable to write output:", err)
+		code |= codeFailed
+	}
+	return code
+}
+
+// lookupURL looks up the URL of r and records its result in r.
+func lookupURL(ul urlLooker, r *lookupResult) {
+	if !schemePolicy.ValidURL(r.url) {
+		r.err = errInvalidURL
+		return
+	}
+	start := time.Now()
+	var results []webrisk.URLResult
+	var err error
+	if e, ok := ul.(urlExplainer); ok {
+		if r.explanation, err = e.explainURL(context.Background(), r.url); err == nil {
+			results = []webrisk.URLResult{r.explanation.Result}
+		}
+	} else {
+		results, err = ul.LookupURLResults(context.Background(), []string{r.url})
+	}
+	r.latency = time.Since(start)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.threats, r.source = results[0].Threats, results[0].Source
+	if r.unsupported = results[0].Unsupported; r.unsupported {
+		// Unsupported URLs have nothing to explain.
+		r.explanation = nil
+	}
 }
@@ -0,0 +1,167 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// fakeLooker reports the URLs containing "evil" as malware, and fails to look
+// up those containing "fail".
+type fakeLooker struct{}
+
+func (fakeLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	results := make([]webrisk.URLResult, len(urls))
+	for i, u := range urls {
+		if strings.Contains(u, "fail") {
+			return results, errors.New("lookup failed")
+		}
+		if strings.Contains(u, "evil") {
+			results[i].Threats = []webrisk.URLThreat{{Pattern: u, ThreatType: webrisk.ThreatTypeMalware}}
+		}
+	}
+	return results, nil
+}
+
+func TestLookupAllExitCode(t *testing.T) {
+	vectors := []struct {
+		input string
+		code  int
+	}{
+		{"", codeSafe},
+		{"http://good.example.com/\n\n  http://good.example.org/  \n", codeSafe},
+		{"http://good.example.com/\nhttp://evil.example.com/\n", codeUnsafe},
+		{"http://fail.example.com/\n", codeFailed},
+		{"http://evil.example.com/\nhttp://fail.example.com/\n", codeUnsafe | codeFailed},
+		{"http://[::1\n", codeInvalid},
+		{"http://evil.example.com/\nhttp://[::1\n", codeUnsafe | codeInvalid},
+	}
+	for i, v := range vectors {
+		var out, errs bytes.Buffer
+		w, _ := newResultWriter(&out, formatCSV)
+		if got := lookupAll(fakeLooker{}, strings.NewReader(v.input), 1, w, &errs); got != v.code {
+			t.Errorf("test %d, lookupAll() = %d, want %d", i, got, v.code)
+		}
+		// Every non-blank line gets a record, after the header.
+		if got, want := strings.Count(out.String(), "\n"), 1+len(strings.Fields(v.input)); got != want {
+			t.Errorf("test %d, %d lines of output, want %d:\n%s", i, got, want, out.String())
+		}
+	}
+}
+
+// slowLooker delays the lookups of fakeLooker, the later URLs the less, and
+// records the maximum number of concurrent lookups.
+type slowLooker struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (l *slowLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	l.mu.Lock()
+	l.inFlight++
+	if l.inFlight > l.max {
+		l.max = l.inFlight
+	}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+	}()
+	var n int
+	fmt.Sscanf(urls[0], "http://%d.example.com/", &n)
+	time.Sleep(time.Duration(100-n) * 100 * time.Microsecond)
+	return fakeLooker{}.LookupURLResults(ctx, urls)
+}
+
+func TestLookupAllWorkers(t *testing.T) {
+	var input, want strings.Builder
+	want.WriteString("url,verdict,threat_types,source,latency\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&input, "http://%d.example.com/\n", i)
+		fmt.Fprintf(&want, "http://%d.example.com/,safe,,database\n", i)
+	}
+	l := new(slowLooker)
+	var out, errs bytes.Buffer
+	w, _ := newResultWriter(&out, formatCSV)
+	if got := lookupAll(l, strings.NewReader(input.String()), 8, w, &errs); got != codeSafe {
+		t.Errorf("lookupAll() = %d, want %d", got, codeSafe)
+	}
+	if l.max < 2 || l.max > 8 {
+		t.Errorf("%d concurrent lookups, want 2 to 8", l.max)
+	}
+	// Results are written in the order of the input.
+	got := regexp.MustCompile(`,[0-9.]+\n`).ReplaceAllString(out.String(), "\n")
+	if got != want.String() {
+		t.Errorf("output mismatch:\ngot  %q\nwant %q", got, want.String())
+	}
+}
+
+func TestServe(t *testing.T) {
+	inputs := []string{
+		"http://good.example.com/\n",
+		"http://evil.example.com/\nhttp://good.example.org/\n",
+		"",
+		"http://fail.example.com/\n",
+	}
+	var opened int
+	open := func() (io.ReadCloser, error) {
+		if opened == len(inputs) {
+			return nil, errors.New("no more inputs")
+		}
+		opened++
+		return ioutil.NopCloser(strings.NewReader(inputs[opened-1])), nil
+	}
+	var out, errs bytes.Buffer
+	w, _ := newResultWriter(&out, formatCSV)
+	if got, want := serve(fakeLooker{}, open, 2, w, &errs), codeUnsafe|codeFailed|codeInvalid; got != want {
+		t.Errorf("serve() = %d, want %d", got, want)
+	}
+	// The header is written once, followed by the records of every input.
+	if got, want := strings.Count(out.String(), "\n"), 1+4; got != want {
+		t.Errorf("%d lines of output, want %d:\n%s", got, want, out.String())
+	}
+	if !strings.Contains(errs.String(), "no more inputs") {
+		t.Errorf("unexpected errors: %q", errs.String())
+	}
+
+	// Serving stops once the output cannot be written.
+	opened = 0
+	if got := serve(fakeLooker{}, open, 1, failWriter{}, ioutil.Discard); got&codeFailed == 0 {
+		t.Errorf("serve() = %d, want codeFailed", got)
+	}
+	if opened != 1 {
+		t.Errorf("%d inputs opened, want 1", opened)
+	}
+}
+
+// failWriter fails to write any result.
+type failWriter struct{}
+
+func (failWriter) write(r *lookupResult) error { return errors.New("broken pipe") }
+func (failWriter) flush() error                { return nil }
@@ -0,0 +1,168 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// Output formats of -format.
+const (
+	formatText = "text"
+	formatCSV  = "csv"
+	formatTSV  = "tsv"
+)
+
+// Verdicts of the lookups.
+const (
+	verdictSafe    = "safe"
+	verdictUnsafe  = "unsafe"
+	verdictUnknown = "unknown" // The lookup failed
+
+	// The URL was not looked up because of its scheme.
+	verdictUnsupported = "unsupported"
+)
+
+// lookupResult is the result of the lookup of a URL.
+type lookupResult struct {
+	url     string
+	threats []webrisk.URLThreat
+	source  webrisk.LookupSource
+	latency time.Duration
+	err     error // Error of the lookup, if it failed
+
+	unsupported bool // Whether the URL was not looked up because of its scheme
+
+	explanation *webrisk.URLExplanation // Explanation of the verdict, with -explain
+}
+
+// verdict returns the verdict of r.
+func (r *lookupResult) verdict() string {
+	switch {
+	case r.err != nil:
+		return verdictUnknown
+	case r.unsupported:
+		return verdictUnsupported
+	case len(r.threats) > 0:
+		return verdictUnsafe
+	default:
+		return verdictSafe
+	}
+}
+
+// resultWriter writes the results of lookups in an output format.
+type resultWriter interface {
+	write(r *lookupResult) error
+	flush() error
+}
+
+// newResultWriter returns a writer of results to w in the given format.
+func newResultWriter(w io.Writer, format string) (resultWriter, error) {
+	switch format {
+	case formatText:
+		return textWriter{w}, nil
+	case formatCSV, formatTSV:
+		cw := csv.NewWriter(w)
+		if format == formatTSV {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write([]string{"url", "verdict", "threat_types", "source", "latency"}); err != nil {
+			return nil, err
+		}
+		return &csvWriter{cw}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// textWriter writes results as human readable lines.
+type textWriter struct {
+	w io.Writer
+}
+
+func (t textWriter) write(r *lookupResult) error {
+	var err error
+	switch r.verdict() {
+	case verdictUnknown:
+		_, err = fmt.Fprintln(t.w, "Unknown URL:", r.url)
+	case verdictSafe:
+		_, err = fmt.Fprintln(t.w, "Safe URL:", r.url)
+	case verdictUnsupported:
+		_, err = fmt.Fprintln(t.w, "Unsupported URL:", r.url)
+	default:
+		_, err = fmt.Fprintln(t.w, "Unsafe URL:", r.threats)
+	}
+	if err == nil && r.explanation != nil {
+		err = writeExplanation(t.w, r.explanation)
+	}
+	return err
+}
+
+func (t textWriter) flush() error { return nil }
+
+// unsafeWriter writes only the URLs of the unsafe results, one per line, to
+// be fed to other commands.
+type unsafeWriter struct {
+	w io.Writer
+}
+
+func (u unsafeWriter) write(r *lookupResult) error {
+	if r.verdict() != verdictUnsafe {
+		return nil
+	}
+	_, err := fmt.Fprintln(u.w, r.url)
+	return err
+}
+
+func (u unsafeWriter) flush() error { return nil }
+
+// csvWriter writes results as the records of a CSV or TSV file, with the
+// threat types separated by commas and the latency in milliseconds.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) write(r *lookupResult) error {
+	var names []string
+	seen := make(map[webrisk.ThreatType]bool)
+	for _, t := range r.threats {
+		if !seen[t.ThreatType] {
+			seen[t.ThreatType] = true
+			names = append(names, t.ThreatType.String())
+		}
+	}
+	source := ""
+	if r.err == nil && !r.unsupported {
+		source = r.source.String()
+	}
+	latency := strconv.FormatFloat(float64(r.latency.Microseconds())/1000, 'f', 3, 64)
+	if err := c.w.Write([]string{r.url, r.verdict(), strings.Join(names, ","), source, latency}); err != nil {
+		return err
+	}
+	// Records are written as they come, as URLs may be typed interactively.
+	return c.flush()
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
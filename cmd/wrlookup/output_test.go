@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestResultWriter(t *testing.T) {
+	results := []*lookupResult{{
+		url:     "http://example.com/",
+		source:  webrisk.SourceDatabase,
+		latency: 1500 * time.Microsecond,
+	}, {
+		url: "http://bad.example.com/a,b",
+		threats: []webrisk.URLThreat{
+			{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware},
+			{Pattern: "bad.example.com/a,b", ThreatType: webrisk.ThreatTypeMalware},
+			{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineering},
+		},
+		source:  webrisk.SourceAPI,
+		latency: 85 * time.Millisecond,
+	}, {
+		url: "http://fail.example.com/",
+		err: errors.New("lookup failed"),
+	}, {
+		url:         "javascript:alert(1)",
+		unsupported: true,
+	}}
+	vectors := []struct {
+		format string
+		want   string
+	}{{
+		format: formatText,
+		want: "Safe URL: http://example.com/\n" +
+			"Unsafe URL: [MALWARE MALWARE SOCIAL_ENGINEERING]\n" +
+			"Unknown URL: http://fail.example.com/\n" +
+			"Unsupported URL: javascript:alert(1)\n",
+	}, {
+		format: formatCSV,
+		want: "url,verdict,threat_types,source,latency\n" +
+			"http://example.com/,safe,,database,1.500\n" +
+			"\"http://bad.example.com/a,b\",unsafe,\"MALWARE,SOCIAL_ENGINEERING\",api,85.000\n" +
+			"http://fail.example.com/,unknown,,,0.000\n" +
+			"javascript:alert(1),unsupported,,,0.000\n",
+	}, {
+		format: formatTSV,
+		want: "url\tverdict\tthreat_types\tsource\tlatency\n" +
+			"http://example.com/\tsafe\t\tdatabase\t1.500\n" +
+			"http://bad.example.com/a,b\tunsafe\tMALWARE,SOCIAL_ENGINEERING\tapi\t85.000\n" +
+			"http://fail.example.com/\tunknown\t\t\t0.000\n" +
+			"javascript:alert(1)\tunsupported\t\t\t0.000\n",
+	}, {
+		// unsafeWriter, for -quiet.
+		want: "http://bad.example.com/a,b\n",
+	}}
+	for i, v := range vectors {
+		var buf bytes.Buffer
+		var w resultWriter
+		var err error
+		if v.format == "" {
+			w = unsafeWriter{&buf}
+		} else {
+			w, err = newResultWriter(&buf, v.format)
+		}
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		for _, r := range results {
+			if err := w.write(r); err != nil {
+				t.Fatalf("test %d, unexpected error: %v", i, err)
+			}
+		}
+		if err := w.flush(); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if got := buf.String(); got != v.want {
+			t.Errorf("test %d, output mismatch:\ngot  %q\nwant %q", i, got, v.want)
+		}
+	}
+
+	if _, err := newResultWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("unexpected success with an unknown format")
+	}
+}
+
+func TestWriteExplanation(t *testing.T) {
+	hash := func(s string) []byte {
+		h := sha256.Sum256([]byte(s))
+		return h[:]
+	}
+	r := &lookupResult{
+		url:     "http://bad.example.com/a",
+		threats: []webrisk.URLThreat{{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+		explanation: &webrisk.URLExplanation{
+			URL:          "http://bad.example.com/a",
+			CanonicalURL: "http://bad.example.com/a",
+			Expressions: []webrisk.ExpressionExplanation{{
+				Pattern: "bad.example.com/a",
+				Hash:    hash("bad.example.com/a"),
+			}, {
+				Pattern:           "bad.example.com/",
+				Hash:              hash("bad.example.com/"),
+				HashPrefix:        hash("bad.example.com/")[:4],
+				PrefixThreatTypes: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+				ThreatTypes:       []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+			}, {
+				Pattern:           "example.com/",
+				Hash:              hash("example.com/"),
+				HashPrefix:        hash("example.com/")[:4],
+				PrefixThreatTypes: []webrisk.ThreatType{webrisk.ThreatTypeMalware, webrisk.ThreatTypeSocialEngineering},
+			}},
+			Result: webrisk.URLResult{Source: webrisk.SourceAPI},
+		},
+	}
+	var buf bytes.Buffer
+	if err := (textWriter{&buf}).write(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Unsafe URL: [MALWARE]\n" +
+		"  canonical URL: http://bad.example.com/a\n" +
+		"  verdict source: api\n" +
+		"  expression bad.example.com/a: hash 28ee5b37 not in database\n" +
+		"  expression bad.example.com/: hash prefix 588120b0 in MALWARE, matched MALWARE\n" +
+		"  expression example.com/: hash prefix 73d986e0 in MALWARE,SOCIAL_ENGINEERING, no full hash match\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output mismatch:\ngot  %q\nwant %q", got, want)
+	}
+}
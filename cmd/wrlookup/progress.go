@@ -0,0 +1,185 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// runStats counts the results of the lookups of a run, for the progress
+// reports and the summary of -progress and -summary.
+type runStats struct {
+	start time.Time
+	total int // Number of URLs of the input, or -1 if unknown
+
+	mu          sync.Mutex
+	processed   int
+	unsafe      int
+	failed      int
+	invalid     int
+	unsupported int
+	threats     map[webrisk.ThreatType]int   // Unsafe URLs per threat type
+	sources     map[webrisk.LookupSource]int // Looked up URLs per source
+}
+
+func newRunStats(total int) *runStats {
+	return &runStats{
+		start:   time.Now(),
+		total:   total,
+		threats: make(map[webrisk.ThreatType]int),
+		sources: make(map[webrisk.LookupSource]int),
+	}
+}
+
+// add counts the result r.
+func (s *runStats) add(r *lookupResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed++
+	switch {
+	case r.err == errInvalidURL:
+		s.invalid++
+		return
+	case r.err != nil:
+		s.failed++
+		return
+	case r.unsupported:
+		s.unsupported++
+		return
+	case len(r.threats) > 0:
+		s.unsafe++
+		seen := make(map[webrisk.ThreatType]bool)
+		for _, t := range r.threats {
+			if !seen[t.ThreatType] {
+				seen[t.ThreatType] = true
+				s.threats[t.ThreatType]++
+			}
+		}
+	}
+	s.sources[r.source]++
+}
+
+// rate returns the number of URLs processed per second since the start.
+func (s *runStats) rate(now time.Time) float64 {
+	d := now.Sub(s.start).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return float64(s.processed) / d
+}
+
+// progress returns a line reporting the progress of the run at now.
+func (s *runStats) progress(now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.total < 0 {
+		return fmt.Sprintf("Processed %d URLs, %.1f URLs/s", s.processed, s.rate(now))
+	}
+	var pct float64
+	if s.total > 0 {
+		pct = 100 * float64(s.processed) / float64(s.total)
+	}
+	return fmt.Sprintf("Processed %d/%d URLs (%.1f%%), %d remaining, %.1f URLs/s",
+		s.processed, s.total, pct, s.total-s.processed, s.rate(now))
+}
+
+// summary returns the summary of the run at now: the number of safe and
+// unsafe URLs, the latter per threat type, and where their results came
+// from.
+func (s *runStats) summary(now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Processed %d URLs in %v, %.1f URLs/s\n",
+		s.processed, now.Sub(s.start).Round(time.Millisecond), s.rate(now))
+	safe := s.processed - s.unsafe - s.failed - s.invalid - s.unsupported
+	fmt.Fprintf(&b, "  safe:    %d\n", safe)
+	fmt.Fprintf(&b, "  unsafe:  %d\n", s.unsafe)
+	var tds []webrisk.ThreatType
+	for td := range s.threats {
+		tds = append(tds, td)
+	}
+	sort.Slice(tds, func(i, j int) bool { return tds[i] < tds[j] })
+	for _, td := range tds {
+		fmt.Fprintf(&b, "    %s: %d\n", td, s.threats[td])
+	}
+	fmt.Fprintf(&b, "  failed:  %d\n", s.failed)
+	fmt.Fprintf(&b, "  invalid: %d\n", s.invalid)
+	if s.unsupported > 0 {
+		fmt.Fprintf(&b, "  unsupported: %d\n", s.unsupported)
+	}
+	fmt.Fprintf(&b, "Sources: database %d, cache %d, api %d\n",
+		s.sources[webrisk.SourceDatabase], s.sources[webrisk.SourceCache], s.sources[webrisk.SourceAPI])
+	return b.String()
+}
+
+// report writes the progress of s to w every period until done is closed.
+func (s *runStats) report(w io.Writer, period time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			fmt.Fprintln(w, s.progress(now))
+		case <-done:
+			return
+		}
+	}
+}
+
+// statsWriter counts the results written to its resultWriter.
+type statsWriter struct {
+	resultWriter
+	stats *runStats
+}
+
+func (sw statsWriter) write(r *lookupResult) error {
+	sw.stats.add(r)
+	return sw.resultWriter.write(r)
+}
+
+// countURLs returns the number of non-blank lines of the regular file at
+// path, or -1 if it is not a regular file, such as a named pipe, and cannot
+// be read twice.
+func countURLs(path string) int {
+	if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+		return -1
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	var n int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			n++
+		}
+	}
+	if scanner.Err() != nil {
+		return -1
+	}
+	return n
+}
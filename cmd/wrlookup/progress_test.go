@@ -0,0 +1,68 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestRunStats(t *testing.T) {
+	input := "http://good.example.com/\nhttp://evil.example.com/\nhttp://evil.example.org/\nhttp://fail.example.com/\nhttp://[::1\n"
+	stats := newRunStats(5)
+	var out, errs bytes.Buffer
+	w, _ := newResultWriter(&out, formatCSV)
+	lookupAll(fakeLooker{}, strings.NewReader(input), 1, statsWriter{w, stats}, &errs)
+
+	now := stats.start.Add(2 * time.Second)
+	if got, want := stats.progress(now), "Processed 5/5 URLs (100.0%), 0 remaining, 2.5 URLs/s"; got != want {
+		t.Errorf("progress() = %q, want %q", got, want)
+	}
+	want := "Processed 5 URLs in 2s, 2.5 URLs/s\n" +
+		"  safe:    1\n" +
+		"  unsafe:  2\n" +
+		"    MALWARE: 2\n" +
+		"  failed:  1\n" +
+		"  invalid: 1\n" +
+		"Sources: database 3, cache 0, api 0\n"
+	if got := stats.summary(now); got != want {
+		t.Errorf("summary() mismatch:\ngot  %q\nwant %q", got, want)
+	}
+
+	stats = newRunStats(-1)
+	stats.add(&lookupResult{url: "http://good.example.com/", source: webrisk.SourceAPI})
+	if got, want := stats.progress(stats.start.Add(time.Second)), "Processed 1 URLs, 1.0 URLs/s"; got != want {
+		t.Errorf("progress() = %q, want %q", got, want)
+	}
+}
+
+func TestCountURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(path, []byte("http://a.example.com/\n\n  \nhttp://b.example.com/\nhttp://c.example.com/"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := countURLs(path); got != 3 {
+		t.Errorf("countURLs() = %d, want 3", got)
+	}
+	if got := countURLs(filepath.Dir(path)); got != -1 {
+		t.Errorf("countURLs(directory) = %d, want -1", got)
+	}
+}
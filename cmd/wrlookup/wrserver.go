@@ -0,0 +1,193 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// Backends of -backend.
+const (
+	backendAPI      = "api"      // Local database synced with the Web Risk API
+	backendWRServer = "wrserver" // Lookups of a wrserver instance
+)
+
+// batchSearchPath is the batch lookup endpoint of wrserver.
+const batchSearchPath = "/v1/uris:batchSearch"
+
+// sourceHeader is the response header in which wrserver names the most costly
+// source of its verdicts.
+const sourceHeader = "X-Webrisk-Source"
+
+// batchSearchRequest and batchSearchResponse are the bodies of the requests
+// and responses of the batch lookup endpoint of wrserver.
+type batchSearchRequest struct {
+	URIs        []string `json:"uris"`
+	ThreatTypes []string `json:"threatTypes,omitempty"`
+}
+
+type batchSearchResponse struct {
+	Results []struct {
+		URI     string `json:"uri"`
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+			Pattern    string `json:"pattern"`
+			HashPrefix string `json:"hashPrefix"`
+			Source     string `json:"source"`
+			ExpireTime string `json:"expireTime"`
+		} `json:"matches"`
+		ExpireTime   string `json:"expireTime"`
+		Unsupported  bool   `json:"unsupported"`
+		Undetermined bool   `json:"undetermined"`
+		Error        string `json:"error"`
+	} `json:"results"`
+}
+
+// serverLooker looks up URLs with the batch lookup endpoint of a wrserver
+// instance, rather than with a local database. The verdicts of a request are
+// all reported as coming from the most costly source named by wrserver, or
+// from the API if wrserver does not name it.
+type serverLooker struct {
+	url         string   // URL of the batch lookup endpoint
+	token       string   // Bearer token of the requests, if any
+	threatTypes []string // Threat types to report, or all if empty
+	client      *http.Client
+}
+
+// newServerLooker returns a looker of URLs with the wrserver instance at
+// serverURL, through the proxy at proxyURL if not empty. If not empty, token
+// is sent as a bearer token, and threatTypes is either ALL or the
+// comma-separated threat types to report.
+func newServerLooker(serverURL, token, proxyURL, threatTypes string) (*serverLooker, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid wrserver URL %q", serverURL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		pu, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %v", proxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(pu)
+	}
+	s := &serverLooker{
+		url:    strings.TrimSuffix(u.String(), "/") + batchSearchPath,
+		token:  token,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+	if threatTypes != "" && threatTypes != "ALL" {
+		for _, name := range strings.Split(threatTypes, ",") {
+			if tt, ok := pb.ThreatType_value[name]; !ok || tt == 0 {
+				return nil, fmt.Errorf("invalid threat type %q", name)
+			}
+			s.threatTypes = append(s.threatTypes, name)
+		}
+	}
+	return s, nil
+}
+
+// LookupURLResults looks up urls with a single batch lookup request. Like
+// webrisk.UpdateClient, it returns webrisk.ErrPartialResults if wrserver ran
+// out of time to look up some of them.
+func (s *serverLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	body, err := json.Marshal(batchSearchRequest{URIs: urls, ThreatTypes: s.threatTypes})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, fmt.Errorf("wrserver returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var bresp batchSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bresp); err != nil {
+		return nil, fmt.Errorf("invalid wrserver response: %v", err)
+	}
+	if len(bresp.Results) != len(urls) {
+		return nil, fmt.Errorf("invalid wrserver response: %d results for %d URLs", len(bresp.Results), len(urls))
+	}
+	source := parseSource(resp.Header.Get(sourceHeader))
+	results := make([]webrisk.URLResult, len(urls))
+	var partial bool
+	for i, v := range bresp.Results {
+		if v.Error != "" {
+			return nil, fmt.Errorf("wrserver failed to look up %s: %s", urls[i], v.Error)
+		}
+		results[i].Source, results[i].Unsupported = source, v.Unsupported
+		results[i].Undetermined = v.Undetermined
+		partial = partial || v.Undetermined
+		if v.ExpireTime != "" {
+			results[i].ExpireTime, _ = time.Parse(time.RFC3339, v.ExpireTime)
+		}
+		for _, m := range v.Matches {
+			t := webrisk.URLThreat{
+				Pattern:    m.Pattern,
+				ThreatType: webrisk.ThreatType(pb.ThreatType_value[m.ThreatType]),
+			}
+			// The details of the matches are only reported by recent
+			// instances.
+			if m.HashPrefix != "" {
+				t.HashPrefix, _ = hex.DecodeString(m.HashPrefix)
+				t.Source = parseSource(m.Source)
+			}
+			if m.ExpireTime != "" {
+				t.ExpireTime, _ = time.Parse(time.RFC3339, m.ExpireTime)
+			}
+			results[i].Threats = append(results[i].Threats, t)
+		}
+	}
+	if partial {
+		return results, webrisk.ErrPartialResults
+	}
+	return results, nil
+}
+
+// parseSource returns the source of verdicts named by wrserver, defaulting to
+// the API for older instances not naming it.
+func parseSource(name string) webrisk.LookupSource {
+	switch name {
+	case webrisk.SourceDatabase.String():
+		return webrisk.SourceDatabase
+	case webrisk.SourceCache.String():
+		return webrisk.SourceCache
+	}
+	return webrisk.SourceAPI
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestServerLooker(t *testing.T) {
+	var got batchSearchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != batchSearchPath || r.Method != "POST" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set(sourceHeader, "cache")
+		w.Write([]byte(`{"results": [
+			{"uri": "http://example.com/"},
+			{"uri": "http://bad.example.com/", "threatTypes": ["MALWARE"],
+			 "matches": [{"threatType": "MALWARE", "pattern": "bad.example.com/", "hashPrefix": "1c3e5b0a", "source": "api", "expireTime": "2023-01-02T03:04:05Z"}],
+			 "expireTime": "2023-01-02T03:04:05Z"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	s, err := newServerLooker(srv.URL+"/", "token", "", "MALWARE,SOCIAL_ENGINEERING")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	urls := []string{"http://example.com/", "http://bad.example.com/"}
+	results, err := s.LookupURLResults(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []webrisk.URLResult{{
+		Source: webrisk.SourceCache,
+	}, {
+		Threats: []webrisk.URLThreat{{
+			Pattern:    "bad.example.com/",
+			ThreatType: webrisk.ThreatTypeMalware,
+			HashPrefix: []byte{0x1c, 0x3e, 0x5b, 0x0a},
+			Source:     webrisk.SourceAPI,
+			ExpireTime: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		}},
+		ExpireTime: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Source:     webrisk.SourceCache,
+	}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("LookupURLResults() = %+v, want %+v", results, want)
+	}
+	if wantReq := (batchSearchRequest{URIs: urls, ThreatTypes: []string{"MALWARE", "SOCIAL_ENGINEERING"}}); !reflect.DeepEqual(got, wantReq) {
+		t.Errorf("request = %+v, want %+v", got, wantReq)
+	}
+
+	s.token = ""
+	if _, err := s.LookupURLResults(context.Background(), urls); err == nil {
+		t.Errorf("LookupURLResults() succeeded without token")
+	}
+}
+
+func TestNewServerLooker(t *testing.T) {
+	vectors := []struct {
+		url         string
+		threatTypes string
+		fail        bool
+	}{
+		{"http://localhost:8080", "ALL", false},
+		{"https://wrserver.example.com/", "", false},
+		{"localhost:8080", "ALL", true},
+		{"ftp://localhost", "ALL", true},
+		{"http://localhost:8080", "MALWARE,BOGUS", true},
+	}
+	for i, v := range vectors {
+		if _, err := newServerLooker(v.url, "", "", v.threatTypes); (err != nil) != v.fail {
+			t.Errorf("test %d, newServerLooker() error = %v, want failure %v", i, err, v.fail)
+		}
+	}
+}
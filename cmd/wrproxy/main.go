@@ -0,0 +1,318 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wrproxy is a forward HTTP proxy that blocks unsafe URLs.
+//
+// Every URL requested through the proxy is checked against the Web Risk
+// threat lists, using a local database kept in sync with the Web Risk API.
+// Requests for unsafe URLs are answered with an interstitial page explaining
+// why the URL was blocked, instead of being forwarded. This makes wrproxy a
+// drop-in egress filter for machines such as build farms and kiosks, which only
+// need to be configured to use it as their HTTP and HTTPS proxy.
+//
+// HTTPS requests are tunneled with the CONNECT method without being decrypted,
+// so only the host they are for can be checked, rather than their full URL.
+//
+// By default, requests whose URL could not be checked, for instance before the
+// threat lists were first synced, are rejected. They are forwarded instead
+// with -failOpen.
+//
+// To build the tool:
+//
+//	$ go get github.com/google/webrisk/cmd/wrproxy
+//
+// Example usage:
+//
+//	$ wrproxy -apikey $APIKEY -db /tmp/webrisk.db -srvaddr localhost:3128
+//	$ https_proxy=localhost:3128 http_proxy=localhost:3128 curl http://bad1url.org/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+var (
+	apiKeyFlag             = flag.String("apikey", "", "specify your Web Risk API key")
+	srvAddrFlag            = flag.String("srvaddr", "localhost:3128", "TCP network address the proxy listens on")
+	databaseFlag           = flag.String("db", "", "path to the Web Risk database. By default persistent storage is disabled (not recommended).")
+	serverURLFlag          = flag.String("server", webrisk.DefaultServerURL, "Web Risk API server address.")
+	proxyFlag              = flag.String("proxy", "", "proxy to use to connect to the Web Risk API server")
+	threatTypesFlag        = flag.String("threatTypes", "ALL", "threat types to check against")
+	maxDiffEntriesFlag     = flag.Int("maxDiffEntries", 0, "maximum number of diff entries to return from a ComputeThreatListDiff request")
+	maxDatabaseEntriesFlag = flag.Int("maxDatabaseEntries", 0, "maximum number of database entries to be stored in the local database")
+	maxHostComponentsFlag  = flag.Int("maxHostComponents", 0, "maximum number of trailing host components of the host suffixes looked up for every URL; 0 for the default of 7")
+	maxPathComponentsFlag  = flag.Int("maxPathComponents", 0, "maximum number of leading path components of the path prefixes looked up for every URL; 0 for the default of 4")
+	failOpenFlag           = flag.Bool("failOpen", false, "forward the requests whose URL could not be checked instead of rejecting them")
+)
+
+const usage = `wrproxy: forward HTTP proxy blocking unsafe URLs with Web Risk.
+
+Every URL requested through the proxy is checked against the Web Risk threat
+lists. Requests for unsafe URLs are answered with an interstitial page instead
+of being forwarded. HTTPS requests are checked by host only.
+
+Usage: %s -apikey=$APIKEY
+
+`
+
+// hopHeaders are the headers that only apply to a single connection, and must
+// not be forwarded by proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// blockedTemplate is the interstitial page served instead of unsafe URLs.
+var blockedTemplate = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Blocked: unsafe site</title>
+</head>
+<body>
+<h1>This site was blocked</h1>
+<p>The page at <code>{{.URL}}</code> was identified as unsafe by Web Risk
+({{range $i, $t := .Threats}}{{if $i}}, {{end}}{{$t}}{{end}}). Visiting it could
+harm your computer or trick you into revealing personal information.</p>
+<p>Advisory provided by Google.</p>
+</body>
+</html>
+`))
+
+// urlLooker looks up URLs in the threat lists. It is implemented by
+// webrisk.UpdateClient.
+type urlLooker interface {
+	LookupURLsContext(ctx context.Context, urls []string) ([][]webrisk.URLThreat, error)
+}
+
+// proxy is a forward HTTP proxy that blocks the URLs matching a threat list.
+type proxy struct {
+	ul        urlLooker
+	transport http.RoundTripper
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+	failOpen  bool
+}
+
+// newProxy returns a proxy checking URLs with ul and connecting directly to
+// the servers of the URLs that are safe.
+func newProxy(ul urlLooker, failOpen bool) *proxy {
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &proxy{
+		ul: ul,
+		transport: &http.Transport{
+			DialContext:           d.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		dial:     d.DialContext,
+		failOpen: failOpen,
+	}
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var target string
+	if r.Method == http.MethodConnect {
+		// Only the host of tunneled requests is known.
+		target = "https://" + strings.TrimSuffix(r.Host, ":443") + "/"
+	} else if r.URL.IsAbs() && (r.URL.Scheme == "http" || r.URL.Scheme == "https") {
+		target = r.URL.String()
+	} else {
+		http.Error(w, "wrproxy only serves requests with an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	threats, err := p.ul.LookupURLsContext(r.Context(), []string{target})
+	switch {
+	case err != nil && !p.failOpen:
+		log.Printf("Rejecting %s: lookup failed: %v", target, err)
+		http.Error(w, "unable to check the URL against Web Risk", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		log.Printf("Forwarding %s: lookup failed: %v", target, err)
+	case len(threats[0]) > 0:
+		log.Printf("Blocking %s: %v", target, threats[0])
+		serveBlocked(w, target, threats[0])
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+	} else {
+		p.forward(w, r)
+	}
+}
+
+// serveBlocked writes the interstitial page of the unsafe URL target.
+func serveBlocked(w http.ResponseWriter, target string, threats []webrisk.URLThreat) {
+	var names []string
+	seen := make(map[webrisk.ThreatType]bool)
+	for _, t := range threats {
+		if !seen[t.ThreatType] {
+			seen[t.ThreatType] = true
+			names = append(names, t.ThreatType.String())
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	blockedTemplate.Execute(w, struct {
+		URL     string
+		Threats []string
+	}{target, names})
+}
+
+// removeHopHeaders removes the hop-by-hop headers from h, including those
+// listed by its Connection header.
+func removeHopHeaders(h http.Header) {
+	for _, v := range h["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// forward sends r to its server and copies the response back to w.
+func (p *proxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header = r.Header.Clone()
+	removeHopHeaders(out.Header)
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		log.Printf("Unable to forward %s: %v", r.URL, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for k, vs := range resp.Header {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects to the host of the CONNECT request r and relays the bytes
+// exchanged with the client until either side closes its connection.
+func (p *proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	dst, err := p.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		log.Printf("Unable to connect to %s: %v", r.Host, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer dst.Close()
+	src, rw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("Unable to hijack the connection of %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer src.Close()
+	if _, err := io.WriteString(src, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+	// Pass on what the client may have sent before getting the response.
+	if n := rw.Reader.Buffered(); n > 0 {
+		b, _ := rw.Reader.Peek(n)
+		if _, err := dst.Write(b); err != nil {
+			return
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	relay := func(to, from net.Conn) {
+		defer wg.Done()
+		io.Copy(to, from)
+		// Unblock the other direction.
+		to.SetDeadline(time.Now())
+		from.SetDeadline(time.Now())
+	}
+	go relay(dst, src)
+	go relay(src, dst)
+	wg.Wait()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *apiKeyFlag == "" {
+		fmt.Fprintln(os.Stderr, "No -apikey specified")
+		os.Exit(1)
+	}
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:             *apiKeyFlag,
+		DBPath:             *databaseFlag,
+		Logger:             os.Stderr,
+		ServerURL:          *serverURLFlag,
+		ProxyURL:           *proxyFlag,
+		ThreatListArg:      *threatTypesFlag,
+		MaxDiffEntries:     int32(*maxDiffEntriesFlag),
+		MaxDatabaseEntries: int32(*maxDatabaseEntriesFlag),
+		ExpressionLimits:   webrisk.ExpressionLimits{MaxHostComponents: *maxHostComponentsFlag, MaxPathComponents: *maxPathComponentsFlag},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to initialize Web Risk client: ", err)
+		os.Exit(1)
+	}
+	defer wr.Close()
+
+	srv := &http.Server{
+		Addr:              *srvAddrFlag,
+		Handler:           newProxy(wr, *failOpenFlag),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Starting proxy at %s", *srvAddrFlag)
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, "Server error:", err)
+		os.Exit(1)
+	}
+}
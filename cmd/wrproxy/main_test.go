@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+// fakeLooker reports the URLs containing "evil" as malware, and fails to look
+// up those containing "fail".
+type fakeLooker struct{}
+
+func (fakeLooker) LookupURLsContext(ctx context.Context, urls []string) ([][]webrisk.URLThreat, error) {
+	threats := make([][]webrisk.URLThreat, len(urls))
+	for i, u := range urls {
+		if strings.Contains(u, "fail") {
+			return nil, errors.New("lookup failed")
+		}
+		if strings.Contains(u, "evil") {
+			threats[i] = []webrisk.URLThreat{{Pattern: u, ThreatType: webrisk.ThreatTypeMalware}}
+		}
+	}
+	return threats, nil
+}
+
+func TestProxy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Errorf("hop-by-hop header forwarded to %s", r.URL)
+		}
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer origin.Close()
+
+	vectors := []struct {
+		path     string
+		failOpen bool
+		code     int
+		body     string
+	}{
+		{path: "/safe", code: http.StatusOK, body: "hello /safe"},
+		{path: "/evil", code: http.StatusForbidden, body: "MALWARE"},
+		{path: "/fail", code: http.StatusServiceUnavailable},
+		{path: "/fail", failOpen: true, code: http.StatusOK, body: "hello /fail"},
+	}
+	for i, v := range vectors {
+		ps := httptest.NewServer(newProxy(fakeLooker{}, v.failOpen))
+		proxyURL, _ := url.Parse(ps.URL)
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+		req, _ := http.NewRequest("GET", origin.URL+v.path, nil)
+		req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			ps.Close()
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, resp.StatusCode, v.code)
+		}
+		if !strings.Contains(string(body), v.body) {
+			t.Errorf("test %d, body = %q, want it to contain %q", i, body, v.body)
+		}
+		ps.Close()
+	}
+}
+
+func TestProxyTunnel(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer origin.Close()
+	ps := httptest.NewServer(newProxy(fakeLooker{}, false))
+	defer ps.Close()
+	proxyURL, _ := url.Parse(ps.URL)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+
+	resp, err := client.Get(origin.URL + "/evil")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	// Only the host of HTTPS requests is checked, which is safe.
+	if string(body) != "secure" {
+		t.Errorf("body = %q, want %q", body, "secure")
+	}
+
+	// Requests for unsafe hosts are not tunneled.
+	req := httptest.NewRequest("CONNECT", "evil.example.com:443", nil)
+	req.Host = "evil.example.com:443"
+	rec := httptest.NewRecorder()
+	newProxy(fakeLooker{}, false).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("CONNECT %s, status code = %d, want %d", req.Host, rec.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(rec.Body.String(), "https://evil.example.com/") {
+		t.Errorf("CONNECT %s, interstitial does not name the blocked URL:\n%s", req.Host, rec.Body)
+	}
+}
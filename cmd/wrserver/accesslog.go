@@ -0,0 +1,247 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of the access log file.
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+)
+
+// rotatedSuffix is the layout of the time appended to the name of rotated
+// log files.
+const rotatedSuffix = "20060102-150405.000"
+
+// accessLog writes the access log to its own file, separate from the
+// application logs. If it is nil, requests are logged by appLog instead.
+var accessLog *accessLogger
+
+// accessLogger writes one line per served request in the Common Log Format,
+// the Combined Log Format or as JSON.
+type accessLogger struct {
+	format string
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// newAccessLogger returns an access logger writing to w in the given format.
+func newAccessLogger(w io.Writer, format string) (*accessLogger, error) {
+	switch format {
+	case accessLogCommon, accessLogCombined, accessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	return &accessLogger{format: format, w: w}, nil
+}
+
+// log writes the access log of req, described by e.
+func (l *accessLogger) log(e *accessEntry, req *http.Request) {
+	line := formatAccess(l.format, e, req)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		appLog.Errorf("Unable to write access log: %v", err)
+	}
+}
+
+// formatAccess returns the access log line of req, described by e, in the
+// given format.
+func formatAccess(format string, e *accessEntry, req *http.Request) []byte {
+	if format == accessLogJSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil
+		}
+		return append(b, '\n')
+	}
+	user := "-"
+	if u, _, ok := req.BasicAuth(); ok && u != "" {
+		user = strconv.Quote(u)
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - %s [%s] %s %d %s", e.RemoteIP, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(req.Method+" "+req.URL.RequestURI()+" "+req.Proto), e.Status, size)
+	if format == accessLogCombined {
+		fmt.Fprintf(&b, " %s %s", quoteOrDash(e.Referer), quoteOrDash(e.UserAgent))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// rotatingFile is a log file that is rotated once it holds maxBytes or was
+// opened maxAge ago, when they are positive. Rotated files are renamed with
+// the time of the rotation as suffix, such as access.log.20231114-221320.000,
+// and only the maxBackups most recent ones are kept, or all of them if
+// maxBackups is not positive. If maxBackupAge is positive, rotated files are
+// also removed once they were rotated that long ago.
+type rotatingFile struct {
+	path         string
+	maxBytes     int64
+	maxAge       time.Duration
+	maxBackups   int
+	maxBackupAge time.Duration
+	now          func() time.Time
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// openRotatingFile opens the log file at path, appending to it if it exists.
+func openRotatingFile(path string, maxBytes int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f, rf.size, rf.opened = f, fi.Size(), rf.now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would not fit or if the
+// file is too old.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	full := rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes
+	if full || rf.expired() {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// expired reports whether the file was opened maxAge ago. This assumes that
+// rf.mu is held.
+func (rf *rotatingFile) expired() bool {
+	return rf.maxAge > 0 && rf.now().Sub(rf.opened) >= rf.maxAge
+}
+
+// Expire rotates the file if it is too old and removes the rotated files
+// which are too old, so that old entries are removed even when nothing is
+// written.
+func (rf *rotatingFile) Expire() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.size > 0 && rf.expired() {
+		return rf.rotate()
+	}
+	return rf.prune()
+}
+
+// rotate renames the current file and opens a new one. This assumes that
+// rf.mu is held.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.path, rf.path+"."+rf.now().Local().Format(rotatedSuffix)); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return rf.prune()
+}
+
+// prune removes the rotated files beyond the maxBackups most recent ones, and
+// those rotated more than maxBackupAge ago.
+func (rf *rotatingFile) prune() error {
+	if rf.maxBackups <= 0 && rf.maxBackupAge <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, m := range matches {
+		// The suffix is in the local time zone of the rotation.
+		rotated, err := time.ParseInLocation(rotatedSuffix, strings.TrimPrefix(m, rf.path+"."), time.Local)
+		if err != nil {
+			continue
+		}
+		if rf.maxBackupAge > 0 && rf.now().Sub(rotated) >= rf.maxBackupAge {
+			if err := os.Remove(m); err != nil {
+				return err
+			}
+			continue
+		}
+		backups = append(backups, m)
+	}
+	sort.Strings(backups)
+	for rf.maxBackups > 0 && len(backups) > rf.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
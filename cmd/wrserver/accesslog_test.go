@@ -0,0 +1,119 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	oldLog := appLog
+	appLog = &appLogger{stdout: ioutil.Discard, stderr: ioutil.Discard, now: func() time.Time { return now }}
+	defer func() { appLog = oldLog }()
+
+	h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	vectors := []struct {
+		format string
+		want   string
+	}{{
+		format: accessLogCommon,
+		want:   `192.0.2.1 - "alice" [14/Nov/2023:22:13:20 +0000] "GET /v1/uris:search?uri=http://a.example/ HTTP/1.1" 200 5` + "\n",
+	}, {
+		format: accessLogCombined,
+		want:   `192.0.2.1 - "alice" [14/Nov/2023:22:13:20 +0000] "GET /v1/uris:search?uri=http://a.example/ HTTP/1.1" 200 5 "-" "test \"agent\""` + "\n",
+	}}
+	for i, v := range vectors {
+		var buf bytes.Buffer
+		var err error
+		if accessLog, err = newAccessLogger(&buf, v.format); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		req := httptest.NewRequest("GET", findThreatPath+"?uri=http://a.example/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.SetBasicAuth("alice", "secret")
+		req.Header.Set("User-Agent", `test "agent"`)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if got := buf.String(); got != v.want {
+			t.Errorf("test %d, access log mismatch:\ngot  %q\nwant %q", i, got, v.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	accessLog, _ = newAccessLogger(&buf, accessLogJSON)
+	defer func() { accessLog = nil }()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", findThreatPath, nil))
+	var got accessEntry
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || got.Bytes != 5 || got.Path != findThreatPath {
+		t.Errorf("JSON access log = %+v, %v", got, err)
+	}
+	if _, err := newAccessLogger(&buf, "apache"); err == nil {
+		t.Errorf("newAccessLogger() succeeded with an unknown format")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	rf, err := openRotatingFile(path, 10, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rf.Close()
+	now := time.Unix(1700000000, 0).UTC()
+	rf.now = func() time.Time { return now }
+	rf.opened = now
+
+	write := func(s string) {
+		if _, err := io.WriteString(rf, s); err != nil {
+			t.Fatalf("unexpected write error: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	write("12345\n")
+	write("1234\n")   // Fits in 10 bytes
+	write("abcdef\n") // Rotated by size
+	now = now.Add(time.Hour)
+	write("old\n") // Rotated by age
+	write("x\n")
+	write("0123456789\n") // Rotated by size, pruning the oldest backup
+
+	matches, _ := filepath.Glob(path + ".*")
+	sort.Strings(matches)
+	var got []string
+	for _, m := range append(matches, path) {
+		b, err := ioutil.ReadFile(m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, string(b))
+	}
+	want := []string{"abcdef\n", "old\nx\n", "0123456789\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("log files = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+const (
+	adminCacheExportPath    = "/admin/cache:export"
+	adminCacheImportPath    = "/admin/cache:import"
+	adminCachePurgePath     = "/admin/cache:purge"
+	adminDatabaseExportPath = "/admin/database:export"
+	adminUpdatePath         = "/admin/update"
+	adminStatsPath          = "/admin/stats"
+	adminConfigPath         = "/admin/config"
+	adminDashboardPath      = "/admin/dashboard"
+	adminTestThreatsPath    = "/admin/testThreats"
+)
+
+const mimeOctetStream = "application/octet-stream"
+
+// secretFlags are the flags whose values are redacted by the config endpoint.
+var secretFlags = map[string]bool{
+	"apikey":        true,
+	"adminToken":    true,
+	"submitToken":   true,
+	"snapshotToken": true,
+	"bypassKey":     true,
+	"redirectKey":   true,
+	"webhookSecret": true,
+	"sharedCache":   true, // May hold a Redis password
+}
+
+// startTime is the time wrserver started.
+var startTime = time.Now()
+
+// RuntimeStats records statistics regarding the wrserver process.
+type RuntimeStats struct {
+	GoVersion      string
+	StartTime      time.Time
+	UptimeSeconds  float64
+	Goroutines     int
+	HeapAllocBytes uint64 // Bytes of allocated heap objects
+	SysBytes       uint64 // Bytes of memory obtained from the OS
+	NumGC          uint32
+}
+
+// withAdminAuth wraps h so that it is only served to requests carrying the
+// given token as a bearer token in the Authorization header.
+func withAdminAuth(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		got := strings.TrimPrefix(auth, "Bearer ")
+		if got == auth || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// withoutAdminEndpoints wraps h so that the admin endpoints, including those
+// of tenants, are not found, for the listeners other than those of -adminAddr.
+func withoutAdminEndpoints(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(endpointPath(r.URL.Path), "/admin/") {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminAllowlist holds the clients allowed to reach the admin, metrics and
+// profiling endpoints, as set with -adminAllow. Any client is allowed if it is
+// nil, provided it is authenticated where required.
+var adminAllowlist *ipSet
+
+// isAdminPath reports whether the request path p is that of an admin or
+// metrics endpoint, including those of tenants.
+func isAdminPath(p string) bool {
+	p = endpointPath(p)
+	return strings.HasPrefix(p, "/admin/") || p == statusPath
+}
+
+// withAllowlist wraps h so that the requests to the paths for which
+// restricted returns true, or to any path if restricted is nil, are refused
+// with 403 Forbidden unless their client is in allow. Requests are not
+// restricted if allow is nil.
+func withAllowlist(allow *ipSet, restricted func(p string) bool, h http.Handler) http.Handler {
+	if allow == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (restricted == nil || restricted(r.URL.Path)) && !allow.contains(clientIP(r)) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveCacheExport writes a snapshot of the lookup cache to resp.
+func serveCacheExport(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	resp.Header().Set("Content-Type", mimeOctetStream)
+	resp.Header().Set("Content-Disposition", `attachment; filename="wrcache.gob.gz"`)
+	if err := wr.ExportCache(resp); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveCacheImport merges the cache snapshot in the request body into the
+// lookup cache.
+func serveCacheImport(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := wr.ImportCache(req.Body); err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// serveUpdate triggers an immediate update of the database.
+func serveUpdate(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := wr.UpdateNow(req.Context()); err != nil {
+		code := http.StatusServiceUnavailable
+		if errors.Is(err, webrisk.ErrUpdateTooSoon) {
+			code = http.StatusTooManyRequests
+		}
+		http.Error(resp, err.Error(), code)
+		return
+	}
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// serveDatabaseExport writes a snapshot of the local database to resp, so that
+// replicas can be bootstrapped from it. The snapshot is identified by an ETag
+// computed over its contents, so that replicas polling for it only download
+// it again once it changed.
+func serveDatabaseExport(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var buf bytes.Buffer
+	if err := wr.ExportDatabase(&buf); err != nil {
+		serveLookupError(resp, err)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	resp.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	resp.Header().Set("Content-Type", mimeOctetStream)
+	resp.Header().Set("Content-Disposition", `attachment; filename="wrdb"`)
+	http.ServeContent(resp, req, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// serveCachePurge removes all entries from the lookup cache.
+func serveCachePurge(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	n := wr.PurgeCache()
+	appLog.Infof("Purged %d entries from the lookup cache", n)
+	serveJSON(resp, struct{ PurgedEntries int }{n})
+}
+
+// serveAdminStats writes the same statistics as the status endpoint, along
+// with statistics regarding the process itself.
+func serveAdminStats(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	serveJSON(resp, struct {
+		*statusReport
+		Runtime RuntimeStats
+	}{newStatusReport(wr), newRuntimeStats()})
+}
+
+// newRuntimeStats collects the current statistics of the process.
+func newRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return RuntimeStats{
+		GoVersion:      runtime.Version(),
+		StartTime:      startTime,
+		UptimeSeconds:  time.Since(startTime).Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: ms.HeapAlloc,
+		SysBytes:       ms.Sys,
+		NumGC:          ms.NumGC,
+	}
+}
+
+// serveAdminConfig writes the effective value of every flag of fs, keyed by
+// flag name like the config file. The values of secrets are redacted.
+func serveAdminConfig(resp http.ResponseWriter, req *http.Request, fs *flag.FlagSet) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	config := make(map[string]string)
+	settingsMu.RLock()
+	fs.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if secretFlags[f.Name] && v != "" {
+			v = "REDACTED"
+		}
+		config[f.Name] = v
+	})
+	settingsMu.RUnlock()
+	serveJSON(resp, config)
+}
+
+// testThreat is a test threat of the testThreats endpoint.
+type testThreat struct {
+	URL        string `json:"url"`
+	ThreatType string `json:"threatType"`
+}
+
+// serveTestThreats lists the test threats injected into wr on GET, injects
+// those of the JSON array in the request body on POST, and removes them all
+// on DELETE.
+func serveTestThreats(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	switch req.Method {
+	case "GET":
+		threats := []testThreat{}
+		for _, t := range wr.TestThreats() {
+			threats = append(threats, testThreat{URL: t.URL, ThreatType: t.ThreatType.String()})
+		}
+		serveJSON(resp, threats)
+	case "POST":
+		var threats []testThreat
+		if err := json.NewDecoder(req.Body).Decode(&threats); err != nil {
+			http.Error(resp, fmt.Sprintf("invalid test threats: %v", err), http.StatusBadRequest)
+			return
+		}
+		var injected []webrisk.TestThreat
+		for _, t := range threats {
+			tt, err := parseThreatType(t.ThreatType)
+			if err != nil {
+				http.Error(resp, err.Error(), http.StatusBadRequest)
+				return
+			}
+			injected = append(injected, webrisk.TestThreat{URL: t.URL, ThreatType: webrisk.ThreatType(tt)})
+		}
+		if err := wr.InjectTestThreats(injected...); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		appLog.Infof("Injected %d test threats", len(injected))
+		resp.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		n := wr.ClearTestThreats()
+		appLog.Infof("Removed %d test threats", n)
+		serveJSON(resp, struct{ RemovedThreats int }{n})
+	default:
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveJSON writes v to resp as JSON.
+func serveJSON(resp http.ResponseWriter, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("unable to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", mimeJSON)
+	resp.Write(buf)
+}
+
+// registerAdminHandlers sets up the admin endpoints on mux. They are only
+// served if an admin token is configured, and the testThreats endpoint only
+// with -testThreats.
+func registerAdminHandlers(mux *http.ServeMux, wr *webrisk.UpdateClient, token string) {
+	if token == "" {
+		return
+	}
+	mux.HandleFunc(adminCacheExportPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveCacheExport(w, r, wr)
+	}))
+	mux.HandleFunc(adminCacheImportPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveCacheImport(w, r, wr)
+	}))
+	mux.HandleFunc(adminCachePurgePath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveCachePurge(w, r, wr)
+	}))
+	mux.HandleFunc(adminDatabaseExportPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveDatabaseExport(w, r, wr)
+	}))
+	mux.HandleFunc(adminUpdatePath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveUpdate(w, r, wr)
+	}))
+	mux.HandleFunc(adminStatsPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveAdminStats(w, r, wr)
+	}))
+	mux.HandleFunc(adminConfigPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveAdminConfig(w, r, flag.CommandLine)
+	}))
+	mux.HandleFunc(adminDashboardPath, withDashboardAuth(token, func(w http.ResponseWriter, r *http.Request) {
+		serveDashboard(w, r, wr)
+	}))
+	if *testThreatsFlag {
+		mux.HandleFunc(adminTestThreatsPath, withAdminAuth(token, func(w http.ResponseWriter, r *http.Request) {
+			serveTestThreats(w, r, wr)
+		}))
+	}
+}
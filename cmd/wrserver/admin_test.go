@@ -0,0 +1,214 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+	"github.com/google/webrisk/webrisktest"
+)
+
+func TestAdminAuth(t *testing.T) {
+	h := withAdminAuth("s3cret", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	vectors := []struct {
+		auth string
+		code int
+	}{
+		{"", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusNoContent},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", adminCacheExportPath, nil)
+		if v.auth != "" {
+			req.Header.Set("Authorization", v.auth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+	}
+}
+
+func TestServeAdminConfig(t *testing.T) {
+	fs := flag.NewFlagSet("wrserver", flag.ContinueOnError)
+	fs.String("apikey", "key", "")
+	fs.String("adminToken", "", "")
+	fs.Duration("updatePeriod", time.Hour, "")
+
+	rec := httptest.NewRecorder()
+	serveAdminConfig(rec, httptest.NewRequest("GET", adminConfigPath, nil), fs)
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"apikey": "REDACTED", "adminToken": "", "updatePeriod": "1h0m0s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config mismatch:\ngot  %v\nwant %v", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAdminConfig(rec, httptest.NewRequest("POST", adminConfigPath, nil), fs)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status code = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAdminAllowlist(t *testing.T) {
+	allow, err := parseIPSet("10.0.0.0/8,::1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := withAllowlist(allow, isAdminPath, ok)
+	debug := withAllowlist(allow, nil, ok)
+
+	vectors := []struct {
+		h      http.Handler
+		remote string
+		path   string
+		code   int
+	}{
+		{h, "192.0.2.1:1234", findThreatPath, http.StatusOK},
+		{h, "192.0.2.1:1234", statusPath, http.StatusForbidden},
+		{h, "192.0.2.1:1234", adminStatsPath, http.StatusForbidden},
+		{h, "192.0.2.1:1234", "/v1/../admin/config", http.StatusForbidden},
+		{h, "192.0.2.1:1234", tenantPathPrefix + "payments" + adminDashboardPath, http.StatusForbidden},
+		{h, "10.1.2.3:1234", adminStatsPath, http.StatusOK},
+		{h, "[::1]:1234", statusPath, http.StatusOK},
+		{debug, "192.0.2.1:1234", debugPprofPath, http.StatusForbidden},
+		{debug, "10.1.2.3:1234", debugPprofPath, http.StatusOK},
+		{withAllowlist(nil, isAdminPath, ok), "192.0.2.1:1234", adminStatsPath, http.StatusOK},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = v.path
+		req.RemoteAddr = v.remote
+		rec := httptest.NewRecorder()
+		v.h.ServeHTTP(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, %s from %s, status code = %d, want %d", i, v.path, v.remote, rec.Code, v.code)
+		}
+	}
+}
+
+func TestDatabaseExport(t *testing.T) {
+	// The threat lists of a client never synced cannot be exported.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	unsynced, err := webrisk.NewUpdateClient(webrisk.Config{APIKey: "key", ServerURL: ts.URL, UpdatePeriod: time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unsynced.Close()
+	rec := httptest.NewRecorder()
+	serveDatabaseExport(rec, httptest.NewRequest("GET", adminDatabaseExportPath, nil), unsynced)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("unsynced export, status code = %d, want %d with Retry-After", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	wr := newSyncedClient(t, "aaaa", "bbbb")
+	rec = httptest.NewRecorder()
+	serveDatabaseExport(rec, httptest.NewRequest("GET", adminDatabaseExportPath, nil), wr)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.Len() == 0 {
+		t.Fatalf("export, status code = %d, ETag %q, %d bytes", rec.Code, etag, rec.Body.Len())
+	}
+	if !bytes.HasPrefix(rec.Body.Bytes(), []byte("WRDB")) {
+		t.Errorf("export does not start with the database file header: %q", rec.Body.Bytes()[:8])
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("token")) {
+		t.Errorf("export does not hold the version token of the threat list")
+	}
+
+	// Replicas polling with the ETag of their snapshot do not download it again.
+	req := httptest.NewRequest("GET", adminDatabaseExportPath, nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	serveDatabaseExport(rec, req, wr)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional export, status code = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+}
+
+func TestServeTestThreats(t *testing.T) {
+	srv := webrisktest.NewServer()
+	defer srv.Close()
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:      "key",
+		ServerURL:   srv.URL,
+		ThreatLists: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		TestThreats: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+
+	vectors := []struct {
+		method string
+		body   string
+		code   int
+		want   string // Expected body, if any
+	}{
+		{"POST", `[{"url":"http://malware.test/","threatType":"MALWARE"}]`, http.StatusNoContent, ""},
+		{"POST", `[{"url":"http://malware.test/","threatType":"BOGUS"}]`, http.StatusBadRequest, ""},
+		{"POST", `{`, http.StatusBadRequest, ""},
+		{"GET", "", http.StatusOK, `[{"url":"http://malware.test/","threatType":"MALWARE"}]`},
+		{"PUT", "", http.StatusMethodNotAllowed, ""},
+		{"DELETE", "", http.StatusOK, `{"RemovedThreats":1}`},
+		{"GET", "", http.StatusOK, `[]`},
+	}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		serveTestThreats(rec, httptest.NewRequest(v.method, adminTestThreatsPath, strings.NewReader(v.body)), wr)
+		if rec.Code != v.code {
+			t.Errorf("test %d, %s status = %d, want %d", i, v.method, rec.Code, v.code)
+		}
+		if v.want != "" && rec.Body.String() != v.want {
+			t.Errorf("test %d, %s body = %s, want %s", i, v.method, rec.Body, v.want)
+		}
+		if i == 0 {
+			results, err := wr.LookupURLResults(ctx, []string{"http://malware.test/download"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results[0].Threats) != 1 {
+				t.Errorf("test %d, LookupURLResults() = %v, want a MALWARE threat", i, results[0].Threats)
+			}
+		}
+	}
+}
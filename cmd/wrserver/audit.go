@@ -0,0 +1,157 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// auditRecord is the audit log record of the lookup of a URL. It identifies
+// the URL by a short prefix of its hash only, and holds nothing about the
+// client, so that the audit trail is not a record of browsing history.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	HashPrefix  string    `json:"hashPrefix"`
+	Verdict     string    `json:"verdict"`
+	ThreatTypes []string  `json:"threatTypes,omitempty"`
+	Endpoint    string    `json:"endpoint"`
+	Tenant      string    `json:"tenant,omitempty"`
+}
+
+// lookupAudit writes the -auditLog. It is nil if no audit log is configured.
+var lookupAudit *auditLogger
+
+// auditLogger records the verdicts of lookups as lines of JSON.
+type auditLogger struct {
+	prefixBytes int // Length of the hash prefixes recorded
+	now         func() time.Time
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newAuditLogger returns an audit logger writing to w, which records the
+// first prefixBytes bytes of the SHA-256 of the URLs.
+func newAuditLogger(w io.Writer, prefixBytes int) (*auditLogger, error) {
+	if prefixBytes < 1 || prefixBytes > sha256.Size {
+		return nil, fmt.Errorf("invalid hash prefix length %d, want 1 to %d bytes", prefixBytes, sha256.Size)
+	}
+	return &auditLogger{prefixBytes: prefixBytes, now: time.Now, w: w}, nil
+}
+
+// record writes the verdicts of the lookups of urls by endpoint for tenant,
+// according to their results.
+func (l *auditLogger) record(endpoint, tenant string, urls []string, results []webrisk.URLResult) {
+	var lines []byte
+	for i, r := range results {
+		if i >= len(urls) {
+			break
+		}
+		sum := sha256.Sum256([]byte(urls[i]))
+		rec := auditRecord{
+			Time:       l.now().UTC(),
+			HashPrefix: hex.EncodeToString(sum[:l.prefixBytes]),
+			Verdict:    verdictSafe,
+			Endpoint:   endpoint,
+			Tenant:     tenant,
+		}
+		if len(r.Threats) > 0 {
+			rec.Verdict, rec.ThreatTypes = verdictUnsafe, threatTypeNames(r.Threats)
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		lines = append(append(lines, b...), '\n')
+	}
+	if len(lines) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(lines); err != nil {
+		appLog.Errorf("Unable to write audit log: %v", err)
+	}
+}
+
+// auditLookups records the lookups of urls by endpoint for tenant in the
+// -auditLog, if any.
+func auditLookups(endpoint, tenant string, urls []string, results []webrisk.URLResult) {
+	if lookupAudit != nil {
+		lookupAudit.record(endpoint, tenant, urls, results)
+	}
+}
+
+// openAuditLog opens the audit log file at path, whose records are removed
+// once they are retention old. The file is rotated daily, or twice per
+// retention if shorter, and the rotated files are removed once their newest
+// records are due. Since existing records are of unknown age, a non-empty
+// file is rotated on open. It returns the file and how often its records
+// must be expired with expireAuditLog.
+func openAuditLog(path string, retention time.Duration) (*rotatingFile, time.Duration, error) {
+	if retention <= 0 {
+		return nil, 0, fmt.Errorf("invalid retention %v", retention)
+	}
+	rotation := 24 * time.Hour
+	if retention < 2*rotation {
+		rotation = retention / 2
+	}
+	rf, err := openRotatingFile(path, 0, rotation, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	rf.maxBackupAge = retention - rotation
+	rf.mu.Lock()
+	if rf.size > 0 {
+		err = rf.rotate()
+	} else {
+		err = rf.prune()
+	}
+	rf.mu.Unlock()
+	if err != nil {
+		rf.Close()
+		return nil, 0, err
+	}
+	period := rotation / 4
+	if period > time.Hour {
+		period = time.Hour
+	}
+	return rf, period, nil
+}
+
+// expireAuditLog expires the records of rf every period, until done is
+// closed.
+func expireAuditLog(rf *rotatingFile, period time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := rf.Expire(); err != nil {
+				appLog.Errorf("Unable to expire audit log: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestAuditLog(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newAuditLogger(&buf, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.now = func() time.Time { return time.Unix(1700000000, 0) }
+	l.record(findThreatPath, "payments", []string{"http://example.com/", "http://bad.example.com/"}, []webrisk.URLResult{{}, {
+		Threats: []webrisk.URLThreat{{ThreatType: webrisk.ThreatTypeMalware}},
+	}})
+	want := `{"time":"2023-11-14T22:13:20Z","hashPrefix":"2a1b4024","verdict":"safe","endpoint":"/v1/uris:search","tenant":"payments"}
+{"time":"2023-11-14T22:13:20Z","hashPrefix":"baaf468e","verdict":"unsafe","threatTypes":["MALWARE"],"endpoint":"/v1/uris:search","tenant":"payments"}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("audit log = %q, want %q", got, want)
+	}
+	for _, n := range []int{0, sha256.Size + 1} {
+		if _, err := newAuditLogger(&buf, n); err == nil {
+			t.Errorf("unexpected success with %d bytes hash prefixes", n)
+		}
+	}
+
+	// Records are removed once they are as old as the retention.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	now := time.Now()
+	backup := func(d time.Duration) string {
+		return path + "." + now.Add(-d).Local().Format(rotatedSuffix)
+	}
+	for _, p := range []string{path, backup(25 * time.Hour), backup(23 * time.Hour)} {
+		if err := ioutil.WriteFile(p, []byte("{}\n"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	rf, period, err := openAuditLog(path, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rf.Close()
+	if period != time.Hour {
+		t.Errorf("expiry period = %v, want 1h", period)
+	}
+	count := func() int {
+		matches, _ := filepath.Glob(path + ".*")
+		return len(matches)
+	}
+	// The existing file was rotated, and the oldest backup removed.
+	if got := count(); got != 2 {
+		t.Errorf("%d rotated files after open, want 2", got)
+	}
+	io.WriteString(rf, "{}\n")
+	rf.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if err := rf.Expire(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := count(); got != 1 {
+		t.Errorf("%d rotated files after 2 hours, want 1", got)
+	}
+	// The current file is rotated once a day, and the backup rotated on open
+	// is removed.
+	rf.now = func() time.Time { return now.Add(25 * time.Hour) }
+	if err := rf.Expire(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := count(); got != 1 {
+		t.Errorf("%d rotated files after a day, want 1", got)
+	}
+	if _, _, err := openAuditLog(path, 0); err == nil {
+		t.Error("unexpected success without retention")
+	}
+}
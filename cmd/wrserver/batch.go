@@ -0,0 +1,192 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+const batchSearchPath = "/v1/uris:batchSearch"
+
+// batchSearchRequest is the body of a request to the batch lookup endpoint.
+type batchSearchRequest struct {
+	URIs        []string `json:"uris"`
+	ThreatTypes []string `json:"threatTypes,omitempty"`
+}
+
+// batchSearchResponse is the body of a response of the batch lookup endpoint.
+// It holds one verdict per URI of the request, in the same order.
+type batchSearchResponse struct {
+	Results []uriVerdict `json:"results"`
+}
+
+// uriVerdict is the verdict for a single URI of a batch lookup.
+type uriVerdict struct {
+	URI          string     `json:"uri"`
+	ThreatTypes  []string   `json:"threatTypes,omitempty"`
+	Matches      []uriMatch `json:"matches,omitempty"`
+	ExpireTime   string     `json:"expireTime,omitempty"`   // Time until which the verdict may be cached
+	Unsupported  bool       `json:"unsupported,omitempty"`  // Not looked up because of its scheme
+	Skipped      bool       `json:"skipped,omitempty"`      // Not looked up because of its private or internal host
+	Stale        bool       `json:"stale,omitempty"`        // Served from expired cache entries
+	Undetermined bool       `json:"undetermined,omitempty"` // Not fully looked up before the lookup timed out
+	Error        string     `json:"error,omitempty"`
+}
+
+// uriMatch is a URL expression of a URI that matched a threat list, along
+// with the hex encoded hash prefix it matched in the local database, the
+// source that confirmed the match and the time until which it may be cached.
+type uriMatch struct {
+	ThreatType string `json:"threatType"`
+	Pattern    string `json:"pattern"`
+	HashPrefix string `json:"hashPrefix,omitempty"`
+	Source     string `json:"source,omitempty"`
+	ExpireTime string `json:"expireTime,omitempty"`
+}
+
+// urlLooker looks up URLs in the threat lists. It is implemented by
+// webrisk.UpdateClient.
+type urlLooker interface {
+	LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error)
+}
+
+// serveBatchSearch implements the "/v1/uris:batchSearch" endpoint, which looks
+// up to maxURIs URIs in a single request. Invalid URIs are reported in their
+// verdict rather than failing the whole batch, and so are the URIs left
+// undetermined when the lookup times out. The response may be cached until the
+// earliest expiry of the verdicts.
+func serveBatchSearch(resp http.ResponseWriter, req *http.Request, ul urlLooker, maxURIs int) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var breq batchSearchRequest
+	if err := json.NewDecoder(req.Body).Decode(&breq); err != nil {
+		http.Error(resp, "invalid request: "+err.Error(), requestErrorCode(err))
+		return
+	}
+	if len(breq.URIs) == 0 {
+		http.Error(resp, "missing uris", http.StatusBadRequest)
+		return
+	}
+	if maxURIs > 0 && len(breq.URIs) > maxURIs {
+		http.Error(resp, fmt.Sprintf("too many uris: %d, at most %d are allowed", len(breq.URIs), maxURIs), http.StatusRequestEntityTooLarge)
+		return
+	}
+	wanted := make(map[webrisk.ThreatType]bool)
+	for _, s := range breq.ThreatTypes {
+		tt, err := parseThreatType(s)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wanted[webrisk.ThreatType(tt)] = true
+	}
+
+	out := batchSearchResponse{Results: make([]uriVerdict, len(breq.URIs))}
+	var urls []string
+	var idxs []int
+	for i, u := range breq.URIs {
+		out.Results[i].URI = u
+		if !schemePolicy.ValidURL(u) {
+			out.Results[i].Error = "invalid URI"
+			continue
+		}
+		urls = append(urls, u)
+		idxs = append(idxs, i)
+	}
+
+	if len(urls) > 0 {
+		ctx, cancel := withLookupDeadline(req.Context())
+		results, err := ul.LookupURLResults(ctx, urls)
+		cancel()
+		if err = lookupError(err); err != nil && !errors.Is(err, webrisk.ErrPartialResults) {
+			serveLookupError(resp, err)
+			return
+		}
+		var expires []time.Time
+		for j, r := range results {
+			expires = append(expires, r.ExpireTime)
+			out.Results[idxs[j]] = newURIVerdict(urls[j], r, wanted)
+		}
+		recordLookups(req.Context(), urls, results)
+		setSourceHeader(resp, results)
+		setCacheControl(resp, earliest(expires...), time.Now())
+	}
+
+	buf, err := json.Marshal(out)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", mimeJSON)
+	resp.Write(buf)
+}
+
+// withLookupDeadline returns a copy of ctx whose deadline, if any, is a tenth
+// of the time left earlier, so that the lookups timing out have the time to
+// answer with their partial results before the request itself times out.
+func withLookupDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-time.Until(deadline)/10))
+}
+
+// newURIVerdict returns the verdict of a URI from the result of its lookup.
+// If wanted is not empty, only the threat types in it are reported.
+func newURIVerdict(uri string, r webrisk.URLResult, wanted map[webrisk.ThreatType]bool) uriVerdict {
+	v := uriVerdict{
+		URI:          uri,
+		Unsupported:  r.Unsupported,
+		Skipped:      r.Skipped,
+		Stale:        r.Stale,
+		Undetermined: r.Undetermined,
+	}
+	if !r.ExpireTime.IsZero() {
+		v.ExpireTime = r.ExpireTime.UTC().Format(time.RFC3339)
+	}
+	tds := make(map[string]bool)
+	for _, ut := range r.Threats {
+		if len(wanted) > 0 && !wanted[ut.ThreatType] {
+			continue
+		}
+		td := ut.ThreatType.String()
+		m := uriMatch{ThreatType: td, Pattern: ut.Pattern, HashPrefix: hex.EncodeToString(ut.HashPrefix)}
+		if len(ut.HashPrefix) > 0 { // The match holds details
+			m.Source = ut.Source.String()
+		}
+		if !ut.ExpireTime.IsZero() {
+			m.ExpireTime = ut.ExpireTime.UTC().Format(time.RFC3339)
+		}
+		v.Matches = append(v.Matches, m)
+		if !tds[td] {
+			tds[td] = true
+			v.ThreatTypes = append(v.ThreatTypes, td)
+		}
+	}
+	sort.Strings(v.ThreatTypes)
+	return v
+}
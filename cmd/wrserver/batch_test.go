@@ -0,0 +1,157 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestServeBatchSearch(t *testing.T) {
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		"http://bad.example.com/login": {
+			{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineering},
+			{Pattern: "bad.example.com/login", ThreatType: webrisk.ThreatTypeSocialEngineering},
+			{
+				Pattern:    "bad.example.com/",
+				ThreatType: webrisk.ThreatTypeMalware,
+				HashPrefix: []byte{0x1c, 0x3e, 0x5b, 0x0a},
+				Source:     webrisk.SourceAPI,
+				ExpireTime: time.Unix(1700000000, 0),
+			},
+		},
+	}}
+
+	vectors := []struct {
+		method string
+		body   string
+		code   int
+		want   string
+	}{{
+		method: "POST",
+		body:   `{"uris": ["http://good.example.com/", "http://bad.example.com/login", "http://[::1/"]}`,
+		code:   http.StatusOK,
+		want: `{"results": [
+			{"uri": "http://good.example.com/"},
+			{"uri": "http://bad.example.com/login", "threatTypes": ["MALWARE", "SOCIAL_ENGINEERING"], "matches": [
+				{"threatType": "SOCIAL_ENGINEERING", "pattern": "bad.example.com/"},
+				{"threatType": "SOCIAL_ENGINEERING", "pattern": "bad.example.com/login"},
+				{"threatType": "MALWARE", "pattern": "bad.example.com/", "hashPrefix": "1c3e5b0a", "source": "api", "expireTime": "2023-11-14T22:13:20Z"}
+			]},
+			{"uri": "http://[::1/", "error": "invalid URI"}
+		]}`,
+	}, {
+		method: "POST",
+		body:   `{"uris": ["http://bad.example.com/login"], "threatTypes": ["MALWARE"]}`,
+		code:   http.StatusOK,
+		want: `{"results": [
+			{"uri": "http://bad.example.com/login", "threatTypes": ["MALWARE"], "matches": [
+				{"threatType": "MALWARE", "pattern": "bad.example.com/", "hashPrefix": "1c3e5b0a", "source": "api", "expireTime": "2023-11-14T22:13:20Z"}
+			]}
+		]}`,
+	}, {
+		method: "POST",
+		body:   `{"uris": ["http://1.example.com/", "http://2.example.com/", "http://3.example.com/", "http://4.example.com/"]}`,
+		code:   http.StatusRequestEntityTooLarge,
+	}, {
+		method: "POST",
+		body:   `{"uris": []}`,
+		code:   http.StatusBadRequest,
+	}, {
+		method: "POST",
+		body:   `{"uris": ["http://good.example.com/"], "threatTypes": ["BAD"]}`,
+		code:   http.StatusBadRequest,
+	}, {
+		method: "GET",
+		code:   http.StatusMethodNotAllowed,
+	}}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, batchSearchPath, strings.NewReader(v.body))
+		serveBatchSearch(rec, req, fl, 3)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(v.want), &want); err != nil {
+			t.Fatalf("test %d, invalid expected response: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d, response mismatch:\ngot  %s\nwant %s", i, rec.Body.String(), v.want)
+		}
+	}
+}
+
+// partialLooker looks up URLs like a lookup running out of time after the
+// first URL.
+type partialLooker struct {
+	deadline time.Time // Deadline of the context of the last lookup
+}
+
+func (pl *partialLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	pl.deadline, _ = ctx.Deadline()
+	results := make([]webrisk.URLResult, len(urls))
+	results[0].Threats = []webrisk.URLThreat{{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}}
+	for i := range results[1:] {
+		results[i+1].Undetermined = true
+	}
+	return results, webrisk.ErrPartialResults
+}
+
+func TestServeBatchSearchPartial(t *testing.T) {
+	pl := &partialLooker{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", batchSearchPath, strings.NewReader(`{"uris": ["http://bad.example.com/", "http://slow.example.com/"]}`))
+	serveBatchSearch(rec, req.WithContext(ctx), pl, 0)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	json.Unmarshal([]byte(`{"results": [
+		{"uri": "http://bad.example.com/", "threatTypes": ["MALWARE"], "matches": [
+			{"threatType": "MALWARE", "pattern": "bad.example.com/"}
+		]},
+		{"uri": "http://slow.example.com/", "undetermined": true}
+	]}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("response mismatch:\ngot  %s\nwant %v", rec.Body.String(), want)
+	}
+	// The lookup must end early enough for the partial results to be sent.
+	if !pl.deadline.Before(deadline.Add(-500 * time.Millisecond)) {
+		t.Errorf("lookup deadline = %v, want before %v", pl.deadline, deadline)
+	}
+}
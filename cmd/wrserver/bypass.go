@@ -0,0 +1,108 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bypassParam is the query parameter of /r holding a bypass token.
+const bypassParam = "bypass"
+
+// interstitialBypass issues the tokens of the "proceed anyway" links of the
+// interstitial page. The links are not offered if it is nil.
+var interstitialBypass *bypassSigner
+
+// bypassSigner issues and redeems the tokens allowing users to proceed once
+// to a URL despite its interstitial page. A token is made of its expiry time
+// in seconds since the epoch, a dot, and the base64 encoded HMAC-SHA256 of the
+// expiry time and the URL, so that it cannot be forged nor reused for another
+// URL.
+type bypassSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	used map[string]time.Time // Expiry of the tokens already redeemed
+}
+
+// newBypassSigner returns a signer of bypass tokens valid for ttl.
+func newBypassSigner(key string, ttl time.Duration) (*bypassSigner, error) {
+	if key == "" {
+		return nil, errors.New("empty bypass key")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("bypass tokens must be valid for a positive duration")
+	}
+	return &bypassSigner{
+		key:  []byte(key),
+		ttl:  ttl,
+		now:  time.Now,
+		used: make(map[string]time.Time),
+	}, nil
+}
+
+// sign returns the token for rawURL expiring at expiry.
+func (b *bypassSigner) sign(rawURL string, expiry time.Time) string {
+	exp := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(exp + "\n" + rawURL))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// params returns the query parameters of the redirector proceeding to rawURL
+// with a new bypass token.
+func (b *bypassSigner) params(rawURL string) url.Values {
+	return url.Values{"url": {rawURL}, bypassParam: {b.sign(rawURL, b.now().Add(b.ttl))}}
+}
+
+// redeem reports whether token is a valid token for rawURL that neither
+// expired nor was redeemed before, in which case it cannot be redeemed again.
+func (b *bypassSigner) redeem(rawURL, token string) bool {
+	exp, _, _ := strings.Cut(token, ".")
+	sec, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiry, now := time.Unix(sec, 0), b.now()
+	if !now.Before(expiry) || expiry.After(now.Add(b.ttl)) {
+		return false
+	}
+	if !hmac.Equal([]byte(token), []byte(b.sign(rawURL, expiry))) {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for t, e := range b.used {
+		if !now.Before(e) {
+			delete(b.used, t)
+		}
+	}
+	if _, ok := b.used[token]; ok {
+		return false
+	}
+	b.used[token] = expiry
+	return true
+}
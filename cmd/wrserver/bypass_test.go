@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestInterstitialBypass(t *testing.T) {
+	const bad, evil = "http://bad.example.com/login", "https://evil.example.com/"
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		bad:  {{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+		evil: {{Pattern: "evil.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineering}},
+	}}
+	b, err := newBypassSigner("secret", 10*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	b.now = func() time.Time { return now }
+	defer func(old *bypassSigner) { interstitialBypass = old }(interstitialBypass)
+	interstitialBypass = b
+
+	redirect := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveRedirector(rec, httptest.NewRequest("GET", "/r?"+query, nil), fl, http.Dir("public"))
+		return rec
+	}
+	rec := redirect(url.Values{"url": {bad}}.Encode())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("interstitial status code = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("interstitial Cache-Control = %q, want no-store", got)
+	}
+	link := "?" + b.params(bad).Encode()
+	if !strings.Contains(rec.Body.String(), html.EscapeString(link)) {
+		t.Fatalf("interstitial page does not link to %s:\n%s", link, rec.Body)
+	}
+	token := b.sign(bad, now.Add(10*time.Minute))
+
+	vectors := []struct {
+		query string
+		code  int
+	}{
+		// The token allows proceeding once.
+		{link[1:], http.StatusFound},
+		{link[1:], http.StatusOK},
+		// Tokens are bound to their URL, and cannot be forged.
+		{url.Values{"url": {evil}, "bypass": {b.sign(bad, now.Add(5*time.Minute))}}.Encode(), http.StatusOK},
+		{url.Values{"url": {bad}, "bypass": {token[:len(token)-1] + "A"}}.Encode(), http.StatusOK},
+		{url.Values{"url": {bad}, "bypass": {"garbage"}}.Encode(), http.StatusOK},
+		// Expired tokens and those outliving -bypassTTL are rejected.
+		{url.Values{"url": {bad}, "bypass": {b.sign(bad, now)}}.Encode(), http.StatusOK},
+		{url.Values{"url": {bad}, "bypass": {b.sign(bad, now.Add(time.Hour))}}.Encode(), http.StatusOK},
+		{url.Values{"url": {bad}, "bypass": {b.sign(bad, now.Add(time.Minute))}}.Encode(), http.StatusFound},
+	}
+	for i, v := range vectors {
+		rec := redirect(v.query)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if v.code == http.StatusFound && rec.Header().Get("Location") != bad {
+			t.Errorf("test %d, Location = %q, want %q", i, rec.Header().Get("Location"), bad)
+		}
+	}
+
+	// Redeemed tokens are forgotten once expired.
+	now = now.Add(time.Hour)
+	b.redeem(bad, b.sign(bad, now.Add(time.Minute)))
+	if len(b.used) != 1 {
+		t.Errorf("%d redeemed tokens kept, want 1", len(b.used))
+	}
+
+	// No link is offered without -bypassKey.
+	interstitialBypass = nil
+	rec = redirect(url.Values{"url": {bad}, "bypass": {b.sign(bad, now.Add(time.Minute))}}.Encode())
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "proceed-link") {
+		t.Errorf("unexpected bypass without -bypassKey: status code %d", rec.Code)
+	}
+}
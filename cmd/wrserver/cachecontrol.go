@@ -0,0 +1,78 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// earliest returns the earliest of the given expiry times. Zero times mean
+// that the expiry is unknown, so the result is zero if any of them is.
+func earliest(ts ...time.Time) time.Time {
+	var e time.Time
+	for i, t := range ts {
+		if t.IsZero() {
+			return time.Time{}
+		}
+		if i == 0 || t.Before(e) {
+			e = t
+		}
+	}
+	return e
+}
+
+// setCacheControl sets the Cache-Control header of resp so that the response
+// may be reused until expire. Responses whose expiry is unknown or has passed
+// must not be stored.
+func setCacheControl(resp http.ResponseWriter, expire, now time.Time) {
+	ttl := expire.Sub(now) / time.Second
+	if expire.IsZero() || ttl <= 0 {
+		resp.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	resp.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(int64(ttl), 10))
+}
+
+// writeCacheable writes body to resp. The responses of GET requests carry an
+// ETag derived from the body, and are answered with 304 Not Modified if the
+// client already holds the same body.
+func writeCacheable(resp http.ResponseWriter, req *http.Request, body []byte) {
+	if req.Method == "GET" || req.Method == "HEAD" {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		resp.Header().Set("ETag", etag)
+		if etagMatch(req.Header.Get("If-None-Match"), etag) {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	resp.Write(body)
+}
+
+// etagMatch reports whether the value of an If-None-Match header matches etag.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
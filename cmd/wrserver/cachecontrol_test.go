@@ -0,0 +1,65 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	vectors := []struct {
+		expires []time.Time
+		want    string
+	}{
+		{[]time.Time{now.Add(time.Hour)}, "max-age=3600"},
+		{[]time.Time{now.Add(time.Hour), now.Add(90 * time.Second)}, "max-age=90"},
+		{[]time.Time{now.Add(time.Hour), {}}, "no-store"},
+		{[]time.Time{now.Add(-time.Second)}, "no-store"},
+		{nil, "no-store"},
+	}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		setCacheControl(rec, earliest(v.expires...), now)
+		if got := rec.Header().Get("Cache-Control"); got != v.want {
+			t.Errorf("test %d, Cache-Control = %q, want %q", i, got, v.want)
+		}
+	}
+
+	body := []byte(`{"threat":{}}`)
+	rec := httptest.NewRecorder()
+	writeCacheable(rec, httptest.NewRequest("GET", findThreatPath, nil), body)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.String() != string(body) {
+		t.Fatalf("writeCacheable() = %d %q with ETag %q", rec.Code, rec.Body.String(), etag)
+	}
+	for i, inm := range []string{etag, "W/" + etag, `"other", ` + etag} {
+		rec = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", findThreatPath, nil)
+		req.Header.Set("If-None-Match", inm)
+		writeCacheable(rec, req, body)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("test %d, If-None-Match %s: status code = %d, want %d", i, inm, rec.Code, http.StatusNotModified)
+		}
+	}
+	rec = httptest.NewRecorder()
+	writeCacheable(rec, httptest.NewRequest("POST", findThreatPath, nil), body)
+	if rec.Header().Get("ETag") != "" {
+		t.Errorf("unexpected ETag on POST response")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipWriters are reused across responses, as they are costly to allocate.
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of req allows gzip.
+func acceptsGzip(req *http.Request) bool {
+	for _, v := range req.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(v, ",") {
+			params := strings.Split(coding, ";")
+			if name := strings.TrimSpace(params[0]); name != "gzip" && name != "*" {
+				continue
+			}
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					if q, err := strconv.ParseFloat(p[2:], 64); err == nil && q == 0 {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// compressible reports whether responses with the given Content-Type are
+// worth compressing.
+func compressible(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (t == mimeJSON || t == mimeProto)
+}
+
+// gzipResponseWriter compresses a response with gzip if it is of a
+// compressible type and at least minBytes long. The start of the response is
+// buffered until its length is known to be enough, or until it ends.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes int
+	status   int
+	buf      []byte
+	started  bool
+	gz       *gzip.Writer // Set once compressing
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.started {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minBytes {
+			return len(b), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// start writes the header of the response, compressed if compress is set
+// and the response allows it, followed by the buffered start of its body.
+func (w *gzipResponseWriter) start(compress bool) error {
+	w.started = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if compress && w.status != http.StatusNoContent && w.status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		// The compressed body differs from the one the ETag was computed
+		// for, but is semantically equivalent.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush implements http.Flusher if the underlying writer does. Flushed
+// responses are compressed regardless of their length, as it is not known yet.
+func (w *gzipResponseWriter) Flush() {
+	if !w.started {
+		w.start(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close writes the buffered start of the response, if it is still buffered,
+// and the end of the compressed stream.
+func (w *gzipResponseWriter) close() {
+	if !w.started {
+		w.start(len(w.buf) >= w.minBytes)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(nil)
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// withCompression wraps h so that its JSON and protobuf responses of at least
+// minBytes are compressed with gzip for the clients accepting it. Responses
+// are not compressed if minBytes is not positive.
+func withCompression(minBytes int, h http.HandlerFunc) http.HandlerFunc {
+	if minBytes <= 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == "HEAD" || !acceptsGzip(r) {
+			h(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minBytes: minBytes}
+		defer gw.close()
+		h(gw, r)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"threatTypes":["MALWARE"]},`, 100)
+	h := withCompression(1024, func(w http.ResponseWriter, r *http.Request) {
+		body := large
+		if r.URL.Query().Get("small") != "" {
+			body = "{}"
+		}
+		w.Header().Set("Content-Type", mimeJSON)
+		if r.URL.Query().Get("text") != "" {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		writeCacheable(w, r, []byte(body))
+	})
+
+	vectors := []struct {
+		query          string
+		acceptEncoding string
+		ifNoneMatch    string
+		code           int
+		gzip           bool
+	}{
+		{acceptEncoding: "", code: http.StatusOK},
+		{acceptEncoding: "gzip", code: http.StatusOK, gzip: true},
+		{acceptEncoding: "deflate, gzip;q=0.5", code: http.StatusOK, gzip: true},
+		{acceptEncoding: "gzip;q=0", code: http.StatusOK},
+		{acceptEncoding: "*", code: http.StatusOK, gzip: true},
+		{query: "small=1", acceptEncoding: "gzip", code: http.StatusOK},
+		{query: "text=1", acceptEncoding: "gzip", code: http.StatusOK},
+		{acceptEncoding: "gzip", ifNoneMatch: "*", code: http.StatusNotModified},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", findThreatPath+"?"+v.query, nil)
+		if v.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", v.acceptEncoding)
+		}
+		if v.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", v.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("test %d, Vary = %q, want Accept-Encoding", i, got)
+		}
+		if got := rec.Header().Get("Content-Encoding") == "gzip"; got != v.gzip {
+			t.Errorf("test %d, compressed = %v, want %v", i, got, v.gzip)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		body := rec.Body.Bytes()
+		if v.gzip {
+			if etag := rec.Header().Get("ETag"); !strings.HasPrefix(etag, "W/") {
+				t.Errorf("test %d, ETag = %q, want a weak ETag", i, etag)
+			}
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Errorf("test %d, unexpected error: %v", i, err)
+				continue
+			}
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				t.Errorf("test %d, unexpected error: %v", i, err)
+			}
+		}
+		want := large
+		if v.query == "small=1" {
+			want = "{}"
+		}
+		if string(body) != want {
+			t.Errorf("test %d, body = %q, want %q", i, body, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// envPrefix is the prefix of the environment variables that set flags.
+const envPrefix = "WRSERVER_"
+
+// envName returns the name of the environment variable that sets the flag
+// with the given name, e.g. WRSERVER_MAX_DIFF_ENTRIES for maxDiffEntries.
+func envName(flagName string) string {
+	var b strings.Builder
+	b.WriteString(envPrefix)
+	for i, r := range flagName {
+		if unicode.IsUpper(r) && i > 0 {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// applyConfig sets the flags of fs that were not given on the command line
+// from the environment and from the JSON config file at path, if not empty.
+// The config file is an object keyed by flag name, for example:
+//
+//	{
+//	    "apikey":       "XXXXXXXXXXXXXXXXXXXXXXX",
+//	    "threatTypes":  "MALWARE,SOCIAL_ENGINEERING",
+//	    "updatePeriod": "30m",
+//	    "db":           "/var/lib/wrserver/webrisk.db"
+//	}
+//
+// Flags given on the command line take precedence over environment variables,
+// which take precedence over the config file. Flags set by applyConfig are not
+// reported as set by fs.Visit, which only reports those of the command line.
+func applyConfig(fs *flag.FlagSet, path string, getenv func(string) string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := make(map[string]string)
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+		for name, v := range raw {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("unknown setting %q in config file %s", name, path)
+			}
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				// Numbers and booleans are used as written.
+				s = string(bytes.TrimSpace(v))
+			}
+			values[name] = s
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if v := getenv(envName(f.Name)); v != "" {
+			values[f.Name] = v
+		}
+		v, ok := values[f.Name]
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if serr := f.Value.Set(v); serr != nil {
+			err = fmt.Errorf("invalid value %q for setting %s: %v", v, f.Name, serr)
+		}
+	})
+	return err
+}
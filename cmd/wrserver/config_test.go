@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	vectors := []struct {
+		config string
+		env    map[string]string
+		args   []string
+		want   map[string]string
+		fail   bool
+	}{{
+		config: `{"apikey": "file", "maxDiffEntries": 1024, "updatePeriod": "1h", "adminToken": "file"}`,
+		want:   map[string]string{"apikey": "file", "maxDiffEntries": "1024", "updatePeriod": "1h0m0s", "adminToken": "file"},
+	}, {
+		config: `{"apikey": "file", "maxDiffEntries": 1024}`,
+		env:    map[string]string{"WRSERVER_APIKEY": "env", "WRSERVER_MAX_DIFF_ENTRIES": "2048"},
+		args:   []string{"-maxDiffEntries=4096"},
+		want:   map[string]string{"apikey": "env", "maxDiffEntries": "4096", "adminToken": ""},
+	}, {
+		env:  map[string]string{"WRSERVER_UPDATE_PERIOD": "90m"},
+		want: map[string]string{"apikey": "", "updatePeriod": "1h30m0s"},
+	}, {
+		config: `{"unknown": 1}`,
+		fail:   true,
+	}, {
+		config: `{"maxDiffEntries": "many"}`,
+		fail:   true,
+	}, {
+		config: `not json`,
+		fail:   true,
+	}}
+
+	for i, v := range vectors {
+		fs := flag.NewFlagSet("wrserver", flag.ContinueOnError)
+		fs.String("apikey", "", "")
+		fs.String("adminToken", "", "")
+		fs.Int("maxDiffEntries", 0, "")
+		fs.Duration("updatePeriod", 0, "")
+		if err := fs.Parse(v.args); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		configPath := ""
+		if v.config != "" {
+			configPath = path
+			if err := ioutil.WriteFile(path, []byte(v.config), 0644); err != nil {
+				t.Fatalf("test %d, unexpected write error: %v", i, err)
+			}
+		}
+		err := applyConfig(fs, configPath, func(k string) string { return v.env[k] })
+		if err != nil != v.fail {
+			t.Errorf("test %d, applyConfig() error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		for name, want := range v.want {
+			if got := fs.Lookup(name).Value.String(); got != want {
+				t.Errorf("test %d, flag %s = %q, want %q", i, name, got, want)
+			}
+		}
+	}
+
+	if got := envName("maxDatabaseEntries"); got != "WRSERVER_MAX_DATABASE_ENTRIES" {
+		t.Errorf("envName() = %q, want %q", got, "WRSERVER_MAX_DATABASE_ENTRIES")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverStats tracks socket level statistics of the HTTP server, so that it
+// can be verified that wrserver has drained all connections on shutdown.
+type serverStats struct {
+	mu            sync.Mutex
+	conns         map[net.Conn]http.ConnState
+	inFlight      int64
+	totalConns    int64
+	totalRequests int64
+	drainStart    time.Time
+	drainEnd      time.Time
+	recent        requestWindow
+}
+
+// rateWindowSeconds is the period over which the request rate is averaged.
+const rateWindowSeconds = 60
+
+// requestWindow counts the requests received in each second of the last
+// rateWindowSeconds.
+type requestWindow struct {
+	secs   [rateWindowSeconds]int64 // Unix time of the second counted by each slot
+	counts [rateWindowSeconds]int64
+}
+
+// add counts a request received at now.
+func (w *requestWindow) add(now time.Time) {
+	sec := now.Unix()
+	i := sec % rateWindowSeconds
+	if w.secs[i] != sec {
+		w.secs[i], w.counts[i] = sec, 0
+	}
+	w.counts[i]++
+}
+
+// rate returns the average number of requests per second received over the
+// last rateWindowSeconds before now.
+func (w *requestWindow) rate(now time.Time) float64 {
+	sec := now.Unix()
+	var n int64
+	for i, s := range w.secs {
+		if s > sec-rateWindowSeconds && s <= sec {
+			n += w.counts[i]
+		}
+	}
+	return float64(n) / rateWindowSeconds
+}
+
+// ServerStats is a snapshot of the socket level statistics of the server.
+type ServerStats struct {
+	OpenConnections   int
+	ActiveConnections int
+	IdleConnections   int
+	InFlightRequests  int64
+	TotalConnections  int64
+	TotalRequests     int64
+	RequestsPerSecond float64 // Averaged over the last minute
+	Draining          bool
+	Drained           bool
+	DrainSeconds      float64
+}
+
+// connStats holds the statistics of the server run by wrserver.
+var connStats serverStats
+
+// connState is an http.Server.ConnState hook that tracks the state of every
+// connection accepted by the server.
+func (s *serverStats) connState(c net.Conn, state http.ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]http.ConnState)
+	}
+	switch state {
+	case http.StateNew:
+		s.totalConns++
+		s.conns[c] = state
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, c)
+	default:
+		s.conns[c] = state
+	}
+}
+
+// handler wraps h so that requests currently being served are counted.
+func (s *serverStats) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.inFlight++
+		s.totalRequests++
+		s.recent.add(time.Now())
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// instrument installs the hooks needed to collect statistics on srv.
+func (s *serverStats) instrument(srv *http.Server) {
+	srv.ConnState = s.connState
+	srv.Handler = s.handler(srv.Handler)
+}
+
+// startDrain records that the server started shutting down.
+func (s *serverStats) startDrain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainStart = time.Now()
+	s.drainEnd = time.Time{}
+}
+
+// endDrain records that the server finished shutting down.
+func (s *serverStats) endDrain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainEnd = time.Now()
+}
+
+// snapshot returns the current statistics.
+func (s *serverStats) snapshot() ServerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ServerStats{
+		OpenConnections:  len(s.conns),
+		InFlightRequests: s.inFlight,
+		TotalConnections: s.totalConns,
+		TotalRequests:    s.totalRequests,
+	}
+	st.RequestsPerSecond = s.recent.rate(time.Now())
+	for _, state := range s.conns {
+		if state == http.StateIdle {
+			st.IdleConnections++
+		} else {
+			st.ActiveConnections++
+		}
+	}
+	if !s.drainStart.IsZero() {
+		end := s.drainEnd
+		st.Drained = !end.IsZero()
+		st.Draining = !st.Drained
+		if !st.Drained {
+			end = time.Now()
+		}
+		st.DrainSeconds = end.Sub(s.drainStart).Seconds()
+	}
+	return st
+}
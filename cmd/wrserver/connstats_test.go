@@ -0,0 +1,65 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerStats(t *testing.T) {
+	var s serverStats
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	s.connState(c1, http.StateNew)
+	s.connState(c2, http.StateNew)
+	s.connState(c1, http.StateActive)
+	s.connState(c2, http.StateActive)
+	s.connState(c2, http.StateIdle)
+
+	var got ServerStats
+	h := s.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = s.snapshot()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	want := ServerStats{
+		OpenConnections:   2,
+		ActiveConnections: 1,
+		IdleConnections:   1,
+		InFlightRequests:  1,
+		TotalConnections:  2,
+		TotalRequests:     1,
+		RequestsPerSecond: 1.0 / rateWindowSeconds,
+	}
+	if got != want {
+		t.Errorf("stats while serving mismatch:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	s.startDrain()
+	if got := s.snapshot(); !got.Draining || got.Drained {
+		t.Errorf("stats while draining: got %+v, want draining", got)
+	}
+	s.connState(c1, http.StateClosed)
+	s.connState(c2, http.StateClosed)
+	s.endDrain()
+	got = s.snapshot()
+	if got.Draining || !got.Drained || got.OpenConnections != 0 || got.InFlightRequests != 0 {
+		t.Errorf("stats after draining: got %+v, want drained", got)
+	}
+}
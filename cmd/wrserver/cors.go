@@ -0,0 +1,114 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsMethods are the methods allowed in cross-origin requests.
+const corsMethods = "GET, POST"
+
+// corsExposedHeaders are the response headers readable by cross-origin
+// clients in addition to the CORS safelisted ones.
+const corsExposedHeaders = requestIDHeader + ", Retry-After"
+
+// corsPolicy configures Cross-Origin Resource Sharing, so that pages served by
+// other origins can query wrserver from the browser.
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	headers   string
+	maxAge    time.Duration
+}
+
+// lookupCORS is the CORS policy of the lookup endpoints. Cross-origin
+// requests are not allowed if it is nil.
+var lookupCORS *corsPolicy
+
+// newCORSPolicy returns a policy allowing cross-origin requests from the given
+// comma separated origins, or from any origin if one of them is "*". Clients
+// may send the given comma separated request headers, and cache the result of
+// preflight requests for maxAge.
+func newCORSPolicy(origins, headers string, maxAge time.Duration) (*corsPolicy, error) {
+	p := &corsPolicy{origins: make(map[string]bool), maxAge: maxAge}
+	for _, o := range strings.Split(origins, ",") {
+		o = strings.TrimSpace(o)
+		switch {
+		case o == "":
+		case o == "*":
+			p.anyOrigin = true
+		case !strings.HasPrefix(o, "http://") && !strings.HasPrefix(o, "https://"):
+			return nil, errors.New("invalid origin " + strconv.Quote(o))
+		default:
+			p.origins[strings.TrimSuffix(o, "/")] = true
+		}
+	}
+	if !p.anyOrigin && len(p.origins) == 0 {
+		return nil, errors.New("no allowed origins")
+	}
+	var hs []string
+	for _, h := range strings.Split(headers, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hs = append(hs, http.CanonicalHeaderKey(h))
+		}
+	}
+	p.headers = strings.Join(hs, ", ")
+	return p, nil
+}
+
+// allowOrigin reports whether requests from origin are allowed.
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	return p.anyOrigin || p.origins[origin]
+}
+
+// withCORS wraps h so that it can be called from the origins allowed by p,
+// and answers the preflight requests of those origins. Cross-origin requests
+// are not allowed if p is nil.
+func withCORS(p *corsPolicy, h http.HandlerFunc) http.HandlerFunc {
+	if p == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !p.allowOrigin(origin) {
+			h(w, r)
+			return
+		}
+		if p.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			if p.headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", p.headers)
+			}
+			if p.maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		h(w, r)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	p, err := newCORSPolicy("https://app.example.com/, http://localhost:3000", "content-type, x-request-id", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := withCORS(p, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	vectors := []struct {
+		method       string
+		origin       string
+		preflight    bool
+		code         int
+		allowOrigin  string
+		allowHeaders string
+		maxAge       string
+	}{
+		{"GET", "", false, http.StatusOK, "", "", ""},
+		{"GET", "https://app.example.com", false, http.StatusOK, "https://app.example.com", "", ""},
+		{"POST", "http://localhost:3000", false, http.StatusOK, "http://localhost:3000", "", ""},
+		{"GET", "https://evil.example.com", false, http.StatusOK, "", "", ""},
+		{"OPTIONS", "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", "Content-Type, X-Request-Id", "300"},
+		{"OPTIONS", "https://evil.example.com", true, http.StatusOK, "", "", ""},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest(v.method, findThreatPath, nil)
+		if v.origin != "" {
+			req.Header.Set("Origin", v.origin)
+		}
+		if v.preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != v.allowOrigin {
+			t.Errorf("test %d, Access-Control-Allow-Origin = %q, want %q", i, got, v.allowOrigin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Headers"); got != v.allowHeaders {
+			t.Errorf("test %d, Access-Control-Allow-Headers = %q, want %q", i, got, v.allowHeaders)
+		}
+		if got := rec.Header().Get("Access-Control-Max-Age"); got != v.maxAge {
+			t.Errorf("test %d, Access-Control-Max-Age = %q, want %q", i, got, v.maxAge)
+		}
+	}
+
+	p, err = newCORSPolicy("*", "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", findThreatPath, nil)
+	req.Header.Set("Origin", "https://any.example.com")
+	withCORS(p, func(w http.ResponseWriter, r *http.Request) {})(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+
+	for _, origins := range []string{"", "app.example.com"} {
+		if _, err := newCORSPolicy(origins, "", 0); err == nil {
+			t.Errorf("newCORSPolicy(%q) succeeded, want error", origins)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// dashboardRefresh is the period after which browsers reload the dashboard.
+const dashboardRefresh = 10 * time.Second
+
+// dashboardList is the row of a threat list in the dashboard.
+type dashboardList struct {
+	Name string
+	webrisk.ListStats
+}
+
+// dashboardData is the data the dashboard template is executed with.
+type dashboardData struct {
+	Now     time.Time
+	Refresh int // Seconds
+	Status  *statusReport
+	Runtime RuntimeStats
+	Lists   []dashboardList // Sorted by name
+	Errors  []logEntry      // Newest first
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": func(now, t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return now.Sub(t).Round(time.Second).String() + " ago"
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>wrserver dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.error { color: #c5221f; }
+</style>
+</head>
+<body>
+<h1>wrserver</h1>
+{{with .Status.Error}}<p class="error">Database error: {{.}}</p>{{end}}
+<h2>Database</h2>
+<table>
+<tr><td>Age</td><td>{{duration .Status.Stats.DatabaseAge}}</td></tr>
+<tr><td>Update lag</td><td>{{duration .Status.Stats.DatabaseUpdateLag}}</td></tr>
+<tr><td>Last update duration</td><td>{{.Status.Stats.LastUpdateDuration}}</td></tr>
+<tr><td>File size (bytes)</td><td>{{.Status.Stats.DatabaseFileBytes}}</td></tr>
+</table>
+<h2>Threat lists</h2>
+<table>
+<tr><th>List</th><th>Last synced</th><th>Hash prefixes</th><th>Memory (bytes)</th><th>Last additions</th><th>Last removals</th><th>Update failures</th><th>Resets</th></tr>
+{{range .Lists}}<tr><td>{{.Name}}</td><td>{{since $.Now .LastSynced}}</td><td>{{.HashPrefixes}}</td><td>{{.MemoryBytes}}</td><td>{{.LastAdditions}}</td><td>{{.LastRemovals}}</td><td>{{.UpdateFailures}}</td><td>{{.Resets}}</td></tr>
+{{end}}</table>
+<h2>Lookups</h2>
+<table>
+<tr><td>Answered by the database</td><td>{{.Status.Stats.QueriesByDatabase}}</td></tr>
+<tr><td>Answered by the cache</td><td>{{.Status.Stats.QueriesByCache}}</td></tr>
+<tr><td>Cache misses</td><td>{{.Status.Stats.CacheMisses}}</td></tr>
+<tr><td>Answered by the API</td><td>{{.Status.Stats.QueriesByAPI}}</td></tr>
+<tr><td>Failed</td><td>{{.Status.Stats.QueriesFail}}</td></tr>
+<tr><td>Served stale</td><td>{{.Status.Stats.QueriesStale}}</td></tr>
+<tr><td>Shared API searches</td><td>{{.Status.Stats.HashLookupsShared}}</td></tr>
+<tr><td>Duplicate URLs</td><td>{{.Status.Stats.DuplicateURLs}}</td></tr>
+<tr><td>Skipped URLs</td><td>{{.Status.Stats.QueriesSkipped}}</td></tr>
+<tr><td>Update alerts</td><td>{{.Status.Stats.UpdateAlerts}}</td></tr>
+<tr><td>Shared cache hits</td><td>{{.Status.Stats.SharedCacheHits}}</td></tr>
+<tr><td>Shared cache errors</td><td>{{.Status.Stats.SharedCacheErrors}}</td></tr>
+</table>
+<h2>Cache</h2>
+<table>
+<tr><td>Cached full hashes</td><td>{{.Status.Stats.Cache.FullHashes}}</td></tr>
+<tr><td>Cached hash prefixes</td><td>{{.Status.Stats.Cache.HashPrefixes}}</td></tr>
+<tr><td>Expired entries</td><td>{{.Status.Stats.Cache.Expired}}</td></tr>
+<tr><td>Background refreshes</td><td>{{.Status.Stats.CacheRefreshes}}</td></tr>
+<tr><td>Failed background refreshes</td><td>{{.Status.Stats.CacheRefreshFails}}</td></tr>
+</table>
+<h2>Requests</h2>
+<table>
+<tr><td>Requests per second (last minute)</td><td>{{printf "%.2f" .Status.Server.RequestsPerSecond}}</td></tr>
+<tr><td>Total requests</td><td>{{.Status.Server.TotalRequests}}</td></tr>
+<tr><td>In-flight requests</td><td>{{.Status.Server.InFlightRequests}}</td></tr>
+<tr><td>Open connections</td><td>{{.Status.Server.OpenConnections}}</td></tr>
+{{with .Status.RateLimit}}<tr><td>Rate limited requests</td><td>{{.Rejected}}</td></tr>{{end}}
+</table>
+<h2>Recent errors</h2>
+{{if .Errors}}<table>
+<tr><th>Time</th><th>Message</th></tr>
+{{range .Errors}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td class="error">{{.Message}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+<h2>Process</h2>
+<table>
+<tr><td>Uptime</td><td>{{since .Now .Runtime.StartTime}}</td></tr>
+<tr><td>Go version</td><td>{{.Runtime.GoVersion}}</td></tr>
+<tr><td>Goroutines</td><td>{{.Runtime.Goroutines}}</td></tr>
+<tr><td>Heap (bytes)</td><td>{{.Runtime.HeapAllocBytes}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// withDashboardAuth wraps h so that it is only served to requests carrying the
+// given token either as a bearer token, like the other admin endpoints, or as
+// the password of HTTP basic authentication, so that browsers prompt for it.
+func withDashboardAuth(token string, h http.HandlerFunc) http.HandlerFunc {
+	bearer := withAdminAuth(token, h)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, password, ok := r.BasicAuth(); ok {
+			if subtle.ConstantTimeCompare([]byte(password), []byte(token)) == 1 {
+				h(w, r)
+				return
+			}
+		} else if r.Header.Get("Authorization") != "" {
+			bearer(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="wrserver"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// serveDashboard writes an HTML page summarizing the state of the database,
+// the lookups and requests served, and the recent errors.
+func serveDashboard(resp http.ResponseWriter, req *http.Request, wr *webrisk.UpdateClient) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	data := &dashboardData{
+		Now:     time.Now(),
+		Refresh: int(dashboardRefresh / time.Second),
+		Status:  newStatusReport(wr),
+		Runtime: newRuntimeStats(),
+		Errors:  appLog.recentErrors(),
+	}
+	for name, ls := range data.Status.Lists {
+		data.Lists = append(data.Lists, dashboardList{name, ls})
+	}
+	sort.Slice(data.Lists, func(i, j int) bool { return data.Lists[i].Name < data.Lists[j].Name })
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, data); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Write(buf.Bytes())
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestDashboard(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "key",
+		ServerURL:    ts.URL,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	oldLog := appLog
+	defer func() { appLog = oldLog }()
+	appLog = &appLogger{stdout: ioutil.Discard, stderr: ioutil.Discard, now: time.Now}
+	appLog.Errorf("Something <bad> happened")
+
+	h := withDashboardAuth("s3cret", func(w http.ResponseWriter, r *http.Request) {
+		serveDashboard(w, r, wr)
+	})
+	vectors := []struct {
+		user, password string // Basic authentication, if user is not empty
+		auth           string // Authorization header otherwise
+		code           int
+	}{
+		{code: http.StatusUnauthorized},
+		{auth: "Bearer wrong", code: http.StatusUnauthorized},
+		{user: "admin", password: "wrong", code: http.StatusUnauthorized},
+		{auth: "Bearer s3cret", code: http.StatusOK},
+		{user: "admin", password: "s3cret", code: http.StatusOK},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", adminDashboardPath, nil)
+		if v.user != "" {
+			req.SetBasicAuth(v.user, v.password)
+		} else if v.auth != "" {
+			req.Header.Set("Authorization", v.auth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code == http.StatusUnauthorized {
+			if got := rec.Header().Get("WWW-Authenticate"); got == "" && v.auth == "" {
+				t.Errorf("test %d, missing WWW-Authenticate header", i)
+			}
+			continue
+		}
+		body := rec.Body.String()
+		for _, want := range []string{"MALWARE", "Something &lt;bad&gt; happened", "Requests per second"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("test %d, dashboard does not contain %q:\n%s", i, want, body)
+			}
+		}
+	}
+
+	var w requestWindow
+	now := time.Unix(1000, 0)
+	for i := 0; i < 90; i++ {
+		w.add(now.Add(time.Duration(i) * time.Second))
+	}
+	if got, want := w.rate(now.Add(89*time.Second)), 1.0; got != want {
+		t.Errorf("requestWindow.rate() = %v, want %v", got, want)
+	}
+	if got, want := w.rate(now.Add(10*time.Minute)), 0.0; got != want {
+		t.Errorf("requestWindow.rate() after idling = %v, want %v", got, want)
+	}
+}
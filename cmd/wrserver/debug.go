@@ -0,0 +1,53 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+const debugPprofPath = "/debug/pprof/"
+
+// newDebugHandler returns a handler for the net/http/pprof profiling
+// endpoints, such as /debug/pprof/profile for CPU profiles and
+// /debug/pprof/heap for heap profiles. It is meant to be served on its own
+// listener, separate from the API, which should not be publicly reachable.
+//
+// The /debug/pprof/cmdline endpoint is not served, since the command line may
+// hold the API key.
+func newDebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(debugPprofPath, pprof.Index)
+	mux.HandleFunc(debugPprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(debugPprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(debugPprofPath+"trace", pprof.Trace)
+	mux.HandleFunc(debugPprofPath+"cmdline", http.NotFound)
+	return mux
+}
+
+// runDebugServer serves the profiling endpoints at addr, which is either a TCP
+// address or the path of a Unix domain socket prefixed with unix://, until the
+// process exits. They are only served to the clients of -adminAllow, if set.
+func runDebugServer(addr string) {
+	ln, err := listen(addr, socketMode)
+	if err != nil {
+		appLog.Fatalf("Debug server error: %s", err)
+	}
+	appLog.Infof("Starting debug server at %s", addr)
+	if err := http.Serve(ln, withAllowlist(adminAllowlist, nil, newDebugHandler())); err != nil {
+		appLog.Errorf("Debug server error: %s", err)
+	}
+}
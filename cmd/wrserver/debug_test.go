@@ -0,0 +1,42 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	vectors := []struct {
+		path string
+		code int
+	}{
+		{debugPprofPath, http.StatusOK},
+		{debugPprofPath + "heap", http.StatusOK},
+		{debugPprofPath + "goroutine?debug=1", http.StatusOK},
+		{debugPprofPath + "cmdline", http.StatusNotFound},
+		{findThreatPath, http.StatusNotFound},
+	}
+	h := newDebugHandler()
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", v.path, nil))
+		if rec.Code != v.code {
+			t.Errorf("test %d, %s status code = %d, want %d", i, v.path, rec.Code, v.code)
+		}
+	}
+}
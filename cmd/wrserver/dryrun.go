@@ -0,0 +1,91 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/google/webrisk"
+)
+
+// dryRun is set with -dryRun, in which mode the unsafe URLs are allowed by
+// the redirector and the ICAP service rather than blocked, and only logged
+// and counted.
+var dryRun bool
+
+// blockCounter counts the requests that would have been blocked by threat
+// type.
+type blockCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// wouldBlock counts the requests allowed because of -dryRun.
+var wouldBlock = new(blockCounter)
+
+// record counts a request for a URL matching threats. A request matching
+// several threat types is counted once for each of them.
+func (c *blockCounter) record(threats []webrisk.URLThreat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	for _, td := range threatTypeNames(threats) {
+		c.counts[td]++
+	}
+}
+
+// snapshot returns the current counts keyed by threat type, or nil if no
+// request was counted yet.
+func (c *blockCounter) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.counts) == 0 {
+		return nil
+	}
+	m := make(map[string]int64, len(c.counts))
+	for td, n := range c.counts {
+		m[td] = n
+	}
+	return m
+}
+
+// threatTypeNames returns the names of the distinct threat types of threats.
+func threatTypeNames(threats []webrisk.URLThreat) []string {
+	var names []string
+	seen := make(map[webrisk.ThreatType]bool)
+	for _, t := range threats {
+		if !seen[t.ThreatType] {
+			seen[t.ThreatType] = true
+			names = append(names, t.ThreatType.String())
+		}
+	}
+	return names
+}
+
+// allowDryRun reports whether the request of client for target, which matched
+// threats, is allowed because of -dryRun, in which case it is logged and
+// counted. The service is the name of the endpoint blocking such requests.
+func allowDryRun(service, client, target string, threats []webrisk.URLThreat) bool {
+	if !dryRun {
+		return false
+	}
+	wouldBlock.record(threats)
+	appLog.Infof("Dry run: %s allowed client %s to %s despite %s", service, client, target,
+		strings.Join(threatTypeNames(threats), ","))
+	return true
+}
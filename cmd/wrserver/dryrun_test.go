@@ -0,0 +1,62 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestDryRun(t *testing.T) {
+	const bad = "http://bad.example.com/login"
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		bad: {
+			{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware},
+			{Pattern: "bad.example.com/login", ThreatType: webrisk.ThreatTypeMalware},
+			{Pattern: "bad.example.com/login", ThreatType: webrisk.ThreatTypeSocialEngineering},
+		},
+	}}
+	defer func(old bool, counter *blockCounter) { dryRun, wouldBlock = old, counter }(dryRun, wouldBlock)
+	wouldBlock = new(blockCounter)
+
+	vectors := []struct {
+		dryRun bool
+		target string
+		code   int
+	}{
+		{target: bad, code: http.StatusOK},
+		{dryRun: true, target: bad, code: http.StatusFound},
+		{dryRun: true, target: "https://example.com/", code: http.StatusForbidden},
+		{dryRun: true, target: bad, code: http.StatusFound},
+	}
+	for i, v := range vectors {
+		dryRun = v.dryRun
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/r?"+url.Values{"url": {v.target}}.Encode(), nil)
+		serveRedirector(rec, req, fl, http.Dir("public"))
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+	}
+	want := map[string]int64{"MALWARE": 2, "SOCIAL_ENGINEERING": 2}
+	if got := wouldBlock.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wouldBlock.snapshot() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/google/webrisk"
+)
+
+// Privacy settings of -eventPrivacy, -webhookPrivacy and -pubsubPrivacy,
+// deciding how URLs are identified in detection events.
+const (
+	privacyHash = "hash" // Hex encoded SHA-256 of the URL
+	privacyURL  = "url"  // URL in full
+)
+
+// Labels of the detection events of the lookups made by wrserver.
+const (
+	labelClient   = "client"   // IP address of the client
+	labelEndpoint = "endpoint" // Path of the endpoint, without tenant prefix, or "icap"
+	labelTenant   = "tenant"   // Name of the tenant, if any
+)
+
+// validPrivacy reports whether privacy is a valid privacy setting.
+func validPrivacy(privacy string) bool {
+	return privacy == privacyHash || privacy == privacyURL
+}
+
+// eventSink is a destination of the events of the clients.
+type eventSink struct {
+	name  string // Key of its statistics in /status
+	sink  webrisk.EventSink
+	stats func() webrisk.SinkStats
+	close func(context.Context) error // Nil if there is nothing to flush
+}
+
+// eventSinks are the destinations of the events of the clients, set up from
+// the -event*, -webhook* and -pubsub* flags.
+var eventSinks []eventSink
+
+// parseEventTypes parses the comma separated event types of -eventTypes.
+func parseEventTypes(s string) ([]webrisk.EventType, error) {
+	var types []webrisk.EventType
+	for _, t := range splitAddrs(s) {
+		switch typ := webrisk.EventType(t); typ {
+		case webrisk.EventDetection, webrisk.EventUpdate, webrisk.EventError, webrisk.EventAlert:
+			types = append(types, typ)
+		default:
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	if len(types) == 0 {
+		return nil, errors.New("no event type")
+	}
+	return types, nil
+}
+
+// newEventSinks sets up the eventSinks configured by the flags.
+func newEventSinks() error {
+	if _, err := parseEventTypes(*eventTypesFlag); err != nil {
+		return fmt.Errorf("invalid -eventTypes: %v", err)
+	}
+	for name, privacy := range map[string]string{
+		"-eventPrivacy":   *eventPrivacyFlag,
+		"-webhookPrivacy": *webhookPrivacyFlag,
+		"-pubsubPrivacy":  *pubsubPrivacyFlag,
+	} {
+		if !validPrivacy(privacy) {
+			return fmt.Errorf("unknown %s %q", name, privacy)
+		}
+	}
+	onError := func(err error) { appLog.Errorf("%v", err) }
+
+	if *eventLogFlag != "" {
+		f, err := os.OpenFile(*eventLogFlag, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		s := webrisk.NewFileSink(f, *eventPrivacyFlag == privacyHash)
+		eventSinks = append(eventSinks, eventSink{"log", s, s.Stats, func(context.Context) error { return f.Close() }})
+	}
+	if *eventSyslogFlag {
+		s, err := webrisk.NewSyslogSink("wrserver", *eventPrivacyFlag == privacyHash)
+		if err != nil {
+			return fmt.Errorf("unable to connect to syslog: %v", err)
+		}
+		eventSinks = append(eventSinks, eventSink{"syslog", s, s.Stats, func(context.Context) error { return s.Close() }})
+	}
+	if urls := splitAddrs(*webhookURLsFlag); len(urls) > 0 {
+		s, err := webrisk.NewWebhookSink(webrisk.WebhookSinkConfig{
+			URLs:      urls,
+			Secret:    *webhookSecretFlag,
+			HashURLs:  *webhookPrivacyFlag == privacyHash,
+			QueueSize: *webhookQueueFlag,
+			OnError:   onError,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to set up webhooks: %v", err)
+		}
+		eventSinks = append(eventSinks, eventSink{"webhooks", s, s.Stats, s.Close})
+	}
+	if *pubsubTopicFlag != "" {
+		accessToken := metadataAccessToken(metadataTokenURL)
+		if *pubsubAccessTokenFlag != "" {
+			accessToken = fileAccessToken(*pubsubAccessTokenFlag)
+		}
+		s, err := webrisk.NewPubSubSink(webrisk.PubSubSinkConfig{
+			Topic:         *pubsubTopicFlag,
+			AccessToken:   accessToken,
+			HashURLs:      *pubsubPrivacyFlag == privacyHash,
+			OrderingLabel: labelTenant,
+			BatchSize:     *pubsubBatchSizeFlag,
+			BatchDelay:    *pubsubBatchDelayFlag,
+			QueueSize:     *pubsubQueueFlag,
+			OnError:       onError,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to set up Pub/Sub publishing: %v", err)
+		}
+		eventSinks = append(eventSinks, eventSink{"pubsub", s, s.Stats, s.Close})
+	}
+	return nil
+}
+
+// clientEventSink returns the sink of the events of the clients, which emits
+// the -eventTypes events to every one of eventSinks, or nil if there is none.
+func clientEventSink() webrisk.EventSink {
+	if len(eventSinks) == 0 {
+		return nil
+	}
+	types, _ := parseEventTypes(*eventTypesFlag)
+	var sinks []webrisk.EventSink
+	for _, s := range eventSinks {
+		sinks = append(sinks, s.sink)
+	}
+	return webrisk.FilterEvents(webrisk.MultiSink(sinks...), types...)
+}
+
+// logUpdateAlert logs the update alerts of the clients, set with
+// -alertFailures and -alertAge.
+func logUpdateAlert(a webrisk.UpdateAlert) {
+	if a.Resolved {
+		appLog.Infof("Update alert resolved: %v", a)
+		return
+	}
+	appLog.Errorf("Update alert: %v", a)
+}
+
+// eventStats returns the delivery statistics of eventSinks keyed by name, or
+// nil if there is none.
+func eventStats() map[string]webrisk.SinkStats {
+	if len(eventSinks) == 0 {
+		return nil
+	}
+	m := make(map[string]webrisk.SinkStats)
+	for _, s := range eventSinks {
+		m[s.name] = s.stats()
+	}
+	return m
+}
+
+// closeEventSinks waits until the events already emitted are delivered, or
+// until ctx is done, and closes eventSinks.
+func closeEventSinks(ctx context.Context) {
+	for _, s := range eventSinks {
+		if s.close == nil {
+			continue
+		}
+		if err := s.close(ctx); err != nil {
+			appLog.Errorf("Unable to deliver every event to %s: %v", s.name, err)
+		}
+	}
+}
+
+// requestEventLabels returns the labels of the detection events of the
+// lookups made for r.
+func requestEventLabels(r *http.Request) map[string]string {
+	labels := map[string]string{
+		labelClient:   clientIP(r),
+		labelEndpoint: endpointPath(r.URL.Path),
+	}
+	if tenant := pathTenant(r.URL.Path); tenant != "" {
+		labels[labelTenant] = tenant
+	}
+	return labels
+}
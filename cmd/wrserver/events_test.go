@@ -0,0 +1,145 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEvents(t *testing.T) {
+	full := sha256.Sum256([]byte("bad.example.com/"))
+	prefix := full[:4]
+	sum := sha256.Sum256(prefix)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":computeDiff"):
+			b, _ = protojson.Marshal(&pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				Additions:       &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: prefix}}},
+				NewVersionToken: []byte("token"),
+				Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: sum[:]},
+			})
+		case strings.HasSuffix(r.URL.Path, "hashes:search"):
+			b, _ = protojson.Marshal(&pb.SearchHashesResponse{Threats: []*pb.SearchHashesResponse_ThreatHash{{
+				ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+				Hash:        full[:],
+				ExpireTime:  timestamppb.New(time.Now().Add(time.Hour)),
+			}}})
+		default:
+			b = []byte("{}")
+		}
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "events.log")
+	defer func(old string) { *eventLogFlag = old }(*eventLogFlag)
+	defer func(old []eventSink) { eventSinks = old }(eventSinks)
+	*eventLogFlag, eventSinks = path, nil
+	if err := newEventSinks(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "key",
+		ServerURL:    ts.URL,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+		EventSink:    clientEventSink(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+
+	// The detection events are labelled with the client, the endpoint and
+	// the tenant of the lookup; the update of the client is not emitted.
+	h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := wr.LookupURLResults(r.Context(), []string{"http://example.com/", "http://bad.example.com/"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}))
+	req := httptest.NewRequest("GET", tenantPathPrefix+"payments"+findThreatPath, nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	closeEventSinks(context.Background())
+	if got := eventStats(); got["log"] != (webrisk.SinkStats{Sent: 1}) {
+		t.Errorf("eventStats() = %+v, want 1 event sent to the log", got)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got webrisk.Event
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got.Time = time.Time{}
+	want := webrisk.Event{
+		Type:        webrisk.EventDetection,
+		URLHash:     "baaf468e1d11d72c83fd6989c9a09cd119ef61f05486201eb0f459939c34771c",
+		ThreatTypes: []string{"MALWARE"},
+		Labels:      map[string]string{"client": "192.0.2.1", "endpoint": findThreatPath, "tenant": "payments"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("event mismatch:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestNewEventSinks(t *testing.T) {
+	defer func(old []eventSink) { eventSinks = old }(eventSinks)
+	defer func(old string) { *eventTypesFlag = old }(*eventTypesFlag)
+	defer func(old string) { *webhookPrivacyFlag = old }(*webhookPrivacyFlag)
+	vectors := []struct {
+		types   string
+		privacy string
+		fail    bool
+	}{
+		{"detection,update,error", privacyURL, false},
+		{"detection,unknown", privacyHash, true},
+		{"", privacyHash, true},
+		{"detection", "none", true},
+	}
+	for i, v := range vectors {
+		eventSinks = nil
+		*eventTypesFlag, *webhookPrivacyFlag = v.types, v.privacy
+		if err := newEventSinks(); (err != nil) != v.fail {
+			t.Errorf("test %d, newEventSinks() = %v, want failure %v", i, err, v.fail)
+		}
+		if clientEventSink() != nil {
+			t.Errorf("test %d, unexpected sink without destination", i)
+		}
+	}
+}
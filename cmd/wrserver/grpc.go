@@ -0,0 +1,502 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// Paths of the gRPC methods served with -grpcAddr. The methods of the Web
+// Risk API are served with its service name, so that its gRPC clients can be
+// pointed at wrserver.
+const (
+	grpcSearchUrisPath       = "/google.cloud.webrisk.v1.WebRiskService/SearchUris"
+	grpcSearchHashesPath     = "/google.cloud.webrisk.v1.WebRiskService/SearchHashes"
+	grpcStreamSearchUrisPath = "/wrserver.v1.LookupService/StreamSearchUris"
+)
+
+// gRPC status codes, as defined by google.golang.org/grpc/codes.
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// maxGRPCMessageBytes is the maximum size of a request message, the default
+// of gRPC servers. It also bounds the size of decompressed messages.
+const maxGRPCMessageBytes = 4 << 20
+
+// grpcAcceptEncoding lists the message encodings accepted from clients.
+const grpcAcceptEncoding = "identity,gzip"
+
+// grpcRoot serves the gRPC calls of the -grpcAddr listeners, if any.
+var grpcRoot *reloadableHandler
+
+// grpcError is an error reported to gRPC clients with its status code.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+// errGRPCNoMessage is reported for unary calls without a request message.
+var errGRPCNoMessage = &grpcError{grpcInvalidArgument, "missing request message"}
+
+// grpcLooker looks up URLs and hash prefixes in the threat lists. It is
+// implemented by webrisk.UpdateClient.
+type grpcLooker interface {
+	urlLooker
+	hashSearcher
+}
+
+// grpcHandler serves the lookups of gRPC clients, over HTTP/2. It implements
+// the following subset of the gRPC over HTTP/2 protocol:
+//
+//   - Calls are POST requests whose content type is application/grpc or
+//     application/grpc+proto. Other requests are answered with HTTP errors.
+//   - Request messages are length-prefixed, and either uncompressed or
+//     compressed with the encoding given by grpc-encoding, which must be
+//     identity or gzip; calls with other encodings fail with UNIMPLEMENTED.
+//     Response messages are never compressed.
+//   - The deadline given by grpc-timeout bounds the lookups of the call.
+//   - The status of a call is sent in the grpc-status and grpc-message
+//     trailers, without details.
+//   - Unary methods read the first message of the request only. A request
+//     without any message fails with INVALID_ARGUMENT.
+//   - Metadata other than authorization, which selects the tenant and the
+//     rate limit of the client as the Authorization header does over HTTP, is
+//     ignored.
+//
+// Other services, including server reflection and health checking, are not
+// served: clients need the definitions of the methods, and calls to unknown
+// methods fail with UNIMPLEMENTED.
+type grpcHandler struct {
+	gl      grpcLooker
+	maxURIs int // Maximum number of URIs looked up by a stream, if positive
+}
+
+// newGRPCServer returns a server of the gRPC lookup methods at addr with h,
+// over HTTP/2 with prior knowledge, or over TLS if the server is given a TLS
+// configuration.
+func newGRPCServer(addr string, h http.Handler) *http.Server {
+	h = withAccessLog(withTracing(serverTracer, withGRPCStatus(h)))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h2c.NewHandler(h, &http2.Server{}),
+		ReadHeaderTimeout: *readHeaderTimeoutFlag,
+	}
+	connStats.instrument(srv)
+	return srv
+}
+
+// newGRPCRootHandler sets up the gRPC handlers of the default client wr and of
+// serverTenants, which are selected as they are by newRootHandler. If wr is
+// nil, calls that are not routed to a tenant are rejected.
+func newGRPCRootHandler(wr *webrisk.UpdateClient) http.Handler {
+	var def http.Handler
+	if wr != nil {
+		def = newGRPCHandler(wr)
+	} else {
+		def = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown tenant", http.StatusUnauthorized)
+		})
+	}
+	if len(serverTenants) == 0 {
+		return def
+	}
+	return newTenantRouter(def, serverTenants, func(wr *webrisk.UpdateClient) http.Handler {
+		return newGRPCHandler(wr)
+	})
+}
+
+// newGRPCHandler returns the handler of the gRPC methods looking up URLs and
+// hash prefixes with gl. The methods are limited like their HTTP endpoints:
+// unary methods like the endpoints of lookups, and streams like the
+// streaming endpoint, with at most -maxBatchSize URIs per stream.
+func newGRPCHandler(gl grpcLooker) http.Handler {
+	g := &grpcHandler{gl: gl, maxURIs: *maxBatchSizeFlag}
+	maxRequestBytes, requestTimeout := *maxRequestBytesFlag, *requestTimeoutFlag
+
+	unary := func(path string) http.HandlerFunc {
+		return withRateLimit(lookupRateLimiter, withRequestLimits(maxRequestBytes, requestTimeout,
+			withExpressionLimits(path, g.ServeHTTP)))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(grpcSearchUrisPath, unary(grpcSearchUrisPath))
+	mux.HandleFunc(grpcSearchHashesPath, unary(grpcSearchHashesPath))
+	mux.HandleFunc(grpcStreamSearchUrisPath, withRateLimit(lookupRateLimiter,
+		withExpressionLimits(grpcStreamSearchUrisPath, g.ServeHTTP)))
+	mux.Handle("/", g)
+	return mux
+}
+
+// isGRPCRequest reports whether req is a gRPC call.
+func isGRPCRequest(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	return req.ProtoMajor == 2 && req.Method == "POST" &&
+		(ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+proto"))
+}
+
+func (g *grpcHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || req.Method != "POST" {
+		http.Error(resp, "gRPC requires POST requests over HTTP/2", http.StatusBadRequest)
+		return
+	}
+	if !isGRPCRequest(req) {
+		http.Error(resp, "invalid content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/grpc")
+	resp.Header().Set("Grpc-Accept-Encoding", grpcAcceptEncoding)
+	enc := req.Header.Get("Grpc-Encoding")
+	if enc != "" && enc != "identity" && enc != "gzip" {
+		writeGRPCStatus(resp, &grpcError{grpcUnimplemented, "unsupported grpc-encoding " + enc})
+		return
+	}
+	ctx := req.Context()
+	if v := req.Header.Get("Grpc-Timeout"); v != "" {
+		timeout, err := parseGRPCTimeout(v)
+		if err != nil {
+			writeGRPCStatus(resp, &grpcError{grpcInvalidArgument, err.Error()})
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	r := &grpcReader{r: req.Body, gzip: enc == "gzip"}
+	var err error
+	switch req.URL.Path {
+	case grpcSearchUrisPath:
+		err = g.searchUris(ctx, resp, r, false)
+	case grpcSearchHashesPath:
+		err = g.searchHashes(ctx, resp, r)
+	case grpcStreamSearchUrisPath:
+		err = g.searchUris(ctx, resp, r, true)
+	default:
+		err = &grpcError{grpcUnimplemented, "unknown method " + req.URL.Path}
+	}
+	writeGRPCStatus(resp, err)
+}
+
+// searchUris answers the SearchUrisRequest messages read from r, only the
+// first unless stream is set, in which case they are answered in order until
+// the client closes the stream.
+func (g *grpcHandler) searchUris(ctx context.Context, w http.ResponseWriter, r *grpcReader, stream bool) error {
+	for n := 1; ; n++ {
+		greq := new(pb.SearchUrisRequest)
+		if err := r.read(greq); err == io.EOF && stream {
+			return nil
+		} else if err == io.EOF {
+			return errGRPCNoMessage
+		} else if err != nil {
+			return err
+		}
+		if stream && g.maxURIs > 0 && n > g.maxURIs {
+			return &grpcError{grpcResourceExhausted, fmt.Sprintf("too many uris, at most %d are allowed per stream", g.maxURIs)}
+		}
+		if !schemePolicy.ValidURL(greq.Uri) {
+			return &grpcError{grpcInvalidArgument, "invalid uri"}
+		}
+		urls := []string{greq.Uri}
+		results, err := g.gl.LookupURLResults(ctx, urls)
+		if err = lookupError(err); err != nil {
+			return err
+		}
+		recordLookups(ctx, urls, results)
+		if err := writeGRPCMessage(w, newSearchUrisResponse(results[0], greq.ThreatTypes)); err != nil {
+			return err
+		}
+		if !stream {
+			return nil
+		}
+	}
+}
+
+// searchHashes answers a SearchHashesRequest message read from r.
+func (g *grpcHandler) searchHashes(ctx context.Context, w http.ResponseWriter, r *grpcReader) error {
+	greq := new(pb.SearchHashesRequest)
+	if err := r.read(greq); err == io.EOF {
+		return errGRPCNoMessage
+	} else if err != nil {
+		return err
+	}
+	if len(greq.HashPrefix) < 4 || len(greq.HashPrefix) > 32 {
+		return &grpcError{grpcInvalidArgument, "invalid hash_prefix"}
+	}
+	var tds []webrisk.ThreatType
+	for _, tt := range greq.ThreatTypes {
+		tds = append(tds, webrisk.ThreatType(tt))
+	}
+	threats, nttl, err := g.gl.SearchHashes(ctx, greq.HashPrefix, tds...)
+	if err = lookupError(err); err != nil {
+		return err
+	}
+	gresp, _ := newSearchHashesResponse(threats, nttl)
+	return writeGRPCMessage(w, gresp)
+}
+
+// grpcReader reads the length-prefixed messages of a request.
+type grpcReader struct {
+	r    io.Reader
+	gzip bool // Whether compressed messages are compressed with gzip
+}
+
+// read reads the next message into m. It returns io.EOF if there are no more
+// messages.
+func (gr *grpcReader) read(m proto.Message) error {
+	var hdr [5]byte
+	if _, err := io.ReadFull(gr.r, hdr[:]); err == io.EOF {
+		return io.EOF
+	} else if err != nil {
+		return grpcReadError(err)
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxGRPCMessageBytes {
+		return &grpcError{grpcResourceExhausted, fmt.Sprintf("message larger than %d bytes", maxGRPCMessageBytes)}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(gr.r, b); err != nil {
+		return grpcReadError(err)
+	}
+	switch {
+	case hdr[0] == 0:
+	case hdr[0] == 1 && gr.gzip:
+		var err error
+		if b, err = gunzipGRPCMessage(b); err != nil {
+			return err
+		}
+	case hdr[0] == 1:
+		return &grpcError{grpcInternal, "compressed message without grpc-encoding"}
+	default:
+		return &grpcError{grpcInternal, "invalid message flags"}
+	}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return &grpcError{grpcInvalidArgument, "invalid message: " + err.Error()}
+	}
+	return nil
+}
+
+// grpcReadError returns the error reported for a request whose body could not
+// be read because of err.
+func grpcReadError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return &grpcError{grpcResourceExhausted, fmt.Sprintf("request larger than %d bytes", mbe.Limit)}
+	}
+	return &grpcError{grpcInvalidArgument, "truncated message"}
+}
+
+// gunzipGRPCMessage decompresses a message compressed with gzip.
+func gunzipGRPCMessage(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, &grpcError{grpcInternal, "invalid compressed message: " + err.Error()}
+	}
+	b, err = ioutil.ReadAll(io.LimitReader(zr, maxGRPCMessageBytes+1))
+	if err != nil {
+		return nil, &grpcError{grpcInternal, "invalid compressed message: " + err.Error()}
+	}
+	if len(b) > maxGRPCMessageBytes {
+		return nil, &grpcError{grpcResourceExhausted, fmt.Sprintf("message larger than %d bytes", maxGRPCMessageBytes)}
+	}
+	return b, nil
+}
+
+// writeGRPCMessage writes m to w as a length-prefixed message, and flushes it
+// so that streamed responses are sent without delay.
+func writeGRPCMessage(w http.ResponseWriter, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(b)))
+	if _, err := w.Write(append(hdr[:], b...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeGRPCStatus ends the response with the gRPC status of err, in its
+// trailers.
+func writeGRPCStatus(w http.ResponseWriter, err error) {
+	code, msg := grpcOK, ""
+	var gerr *grpcError
+	switch {
+	case err == nil:
+	case errors.As(err, &gerr):
+		code, msg = gerr.code, gerr.msg
+	case errors.Is(err, context.DeadlineExceeded):
+		code, msg = grpcDeadlineExceeded, err.Error()
+	case errors.Is(err, context.Canceled):
+		code, msg = grpcCanceled, err.Error()
+	case errors.Is(err, webrisk.ErrNotReady):
+		code, msg = grpcUnavailable, err.Error()
+	case errors.Is(err, webrisk.ErrUnsupportedScheme):
+		code, msg = grpcInvalidArgument, err.Error()
+	default:
+		code, msg = grpcInternal, err.Error()
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(msg))
+	}
+}
+
+// withGRPCStatus wraps h so that the HTTP errors answered to gRPC calls, such
+// as those of the rate limiter, of the request limits and of the tenant
+// router, are reported as gRPC statuses, as determined by grpcStatusCode.
+func withGRPCStatus(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isGRPCRequest(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		sw := &grpcStatusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.code == 0 {
+			return
+		}
+		msg := strings.TrimSpace(sw.body.String())
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Del("X-Content-Type-Options")
+		writeGRPCStatus(w, &grpcError{grpcStatusCode(sw.code, msg), msg})
+	})
+}
+
+// grpcStatusWriter holds back the HTTP errors of a gRPC call, so that they
+// can be reported in its trailers.
+type grpcStatusWriter struct {
+	http.ResponseWriter
+	started bool         // Whether the response was started
+	code    int          // Status code of the HTTP error, if any
+	body    bytes.Buffer // Body of the HTTP error
+}
+
+func (w *grpcStatusWriter) WriteHeader(code int) {
+	if !w.started && code >= 400 {
+		w.code = code
+		return
+	}
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *grpcStatusWriter) Write(b []byte) (int, error) {
+	if w.code != 0 {
+		return w.body.Write(b)
+	}
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (w *grpcStatusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.code == 0 {
+		f.Flush()
+	}
+}
+
+// grpcStatusCode returns the gRPC status code reporting an HTTP error with the
+// given status code and message.
+func grpcStatusCode(code int, msg string) int {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return grpcInvalidArgument
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case http.StatusServiceUnavailable:
+		if msg == requestTimeoutMessage {
+			return grpcDeadlineExceeded
+		}
+		return grpcUnavailable
+	}
+	return grpcUnknown
+}
+
+// encodeGRPCMessage percent-encodes the bytes of msg that may not appear in
+// the grpc-message trailer.
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseGRPCTimeout parses the value of a grpc-timeout header, an integer of
+// at most 8 digits followed by a unit.
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", v)
+	}
+	unit, ok := units[v[len(v)-1]]
+	n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", v)
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,384 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcTestClient calls the gRPC methods of a server, as gRPC clients do over
+// cleartext HTTP/2.
+type grpcTestClient struct {
+	t      *testing.T
+	addr   string
+	client *http.Client
+}
+
+// newGRPCTestClient starts a gRPC server serving h, and returns a client of
+// that server.
+func newGRPCTestClient(t *testing.T, h http.Handler) *grpcTestClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := newGRPCServer(ln.Addr().String(), h)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return &grpcTestClient{t: t, addr: ln.Addr().String(), client: &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}}
+}
+
+// post sends body to the gRPC method at path with the headers of header, and
+// returns the response messages and the response, whose trailers are read.
+func (c *grpcTestClient) post(path string, header http.Header, body []byte) ([][]byte, *http.Response) {
+	req, err := http.NewRequest("POST", "http://"+c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	var msgs [][]byte
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(resp.Body, hdr[:]); err != nil {
+			break
+		}
+		b := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+		if _, err := io.ReadFull(resp.Body, b); err != nil {
+			c.t.Fatalf("unexpected error: %v", err)
+		}
+		msgs = append(msgs, b)
+	}
+	return msgs, resp
+}
+
+// call sends the messages of reqs to the gRPC method at path, and returns the
+// response messages and the gRPC status.
+func (c *grpcTestClient) call(path, timeout string, reqs ...proto.Message) ([][]byte, string) {
+	header := make(http.Header)
+	if timeout != "" {
+		header.Set("Grpc-Timeout", timeout)
+	}
+	msgs, resp := c.post(path, header, grpcFrames(c.t, false, reqs...))
+	return msgs, resp.Trailer.Get("Grpc-Status")
+}
+
+// grpcFrames returns the length-prefixed messages of msgs, compressed with
+// gzip if compress is set.
+func grpcFrames(t *testing.T, compress bool, msgs ...proto.Message) []byte {
+	var body bytes.Buffer
+	for _, m := range msgs {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var hdr [5]byte
+		if compress {
+			var zb bytes.Buffer
+			zw := gzip.NewWriter(&zb)
+			zw.Write(b)
+			zw.Close()
+			b, hdr[0] = zb.Bytes(), 1
+		}
+		binary.BigEndian.PutUint32(hdr[1:], uint32(len(b)))
+		body.Write(hdr[:])
+		body.Write(b)
+	}
+	return body.Bytes()
+}
+
+// deadlineLooker records the deadline of the lookups it forwards, and blocks
+// them until they are canceled if block is set.
+type deadlineLooker struct {
+	grpcLooker
+	block    bool
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (dl *deadlineLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	dl.mu.Lock()
+	dl.deadline, _ = ctx.Deadline()
+	dl.mu.Unlock()
+	if dl.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return dl.grpcLooker.LookupURLResults(ctx, urls)
+}
+
+func newFakeGRPCLooker() grpcLooker {
+	fullHash := append([]byte("abcd"), make([]byte, 28)...)
+	return struct {
+		*fakeLooker
+		*fakeSearcher
+	}{
+		&fakeLooker{threats: map[string][]webrisk.URLThreat{
+			"http://bad.example.com/": {{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+		}},
+		&fakeSearcher{threats: []webrisk.HashThreat{{
+			Hash:        fullHash,
+			ThreatTypes: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+			ExpireTime:  time.Unix(1700000000, 0),
+		}}},
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	fullHash := append([]byte("abcd"), make([]byte, 28)...)
+	c := newGRPCTestClient(t, newGRPCHandler(newFakeGRPCLooker()))
+
+	msgs, status := c.call(grpcSearchUrisPath, "10S", &pb.SearchUrisRequest{Uri: "http://bad.example.com/"})
+	var sresp pb.SearchUrisResponse
+	if status != "0" || len(msgs) != 1 || proto.Unmarshal(msgs[0], &sresp) != nil ||
+		!reflect.DeepEqual(sresp.GetThreat().GetThreatTypes(), []pb.ThreatType{pb.ThreatType_MALWARE}) {
+		t.Errorf("SearchUris() = %v, status %s, want MALWARE, status 0", &sresp, status)
+	}
+
+	msgs, status = c.call(grpcSearchHashesPath, "", &pb.SearchHashesRequest{HashPrefix: []byte("abcd")})
+	var hresp pb.SearchHashesResponse
+	if status != "0" || len(msgs) != 1 || proto.Unmarshal(msgs[0], &hresp) != nil ||
+		len(hresp.Threats) != 1 || !bytes.Equal(hresp.Threats[0].Hash, fullHash) {
+		t.Errorf("SearchHashes() = %v, status %s, want %x, status 0", &hresp, status, fullHash)
+	}
+
+	// Streamed lookups are answered in order.
+	msgs, status = c.call(grpcStreamSearchUrisPath, "",
+		&pb.SearchUrisRequest{Uri: "http://good.example.com/"},
+		&pb.SearchUrisRequest{Uri: "http://bad.example.com/"},
+		&pb.SearchUrisRequest{Uri: "http://bad.example.com/", ThreatTypes: []pb.ThreatType{pb.ThreatType_SOCIAL_ENGINEERING}})
+	if status != "0" || len(msgs) != 3 {
+		t.Fatalf("StreamSearchUris() = %d messages, status %s, want 3, status 0", len(msgs), status)
+	}
+	for i, want := range []int{0, 1, 0} {
+		var sresp pb.SearchUrisResponse
+		if err := proto.Unmarshal(msgs[i], &sresp); err != nil || len(sresp.GetThreat().GetThreatTypes()) != want {
+			t.Errorf("StreamSearchUris() response %d = %v, %v, want %d threat types", i, &sresp, err, want)
+		}
+	}
+
+	vectors := []struct {
+		path    string
+		timeout string
+		reqs    []proto.Message
+		status  string
+	}{
+		{grpcSearchUrisPath, "", []proto.Message{&pb.SearchUrisRequest{Uri: ""}}, "3"},
+		{grpcSearchHashesPath, "", []proto.Message{&pb.SearchHashesRequest{HashPrefix: []byte("abc")}}, "3"},
+		{grpcSearchUrisPath, "soon", []proto.Message{&pb.SearchUrisRequest{Uri: "http://bad.example.com/"}}, "3"},
+		{"/google.cloud.webrisk.v1.WebRiskService/ComputeThreatListDiff", "", []proto.Message{&pb.SearchUrisRequest{}}, "12"},
+		{grpcSearchUrisPath, "", nil, "3"},
+		{grpcSearchHashesPath, "", nil, "3"},
+		{grpcStreamSearchUrisPath, "", nil, "0"},
+	}
+	for i, v := range vectors {
+		if _, status := c.call(v.path, v.timeout, v.reqs...); status != v.status {
+			t.Errorf("test %d, status = %s, want %s", i, status, v.status)
+		}
+	}
+}
+
+func TestGRPCCompression(t *testing.T) {
+	c := newGRPCTestClient(t, newGRPCHandler(newFakeGRPCLooker()))
+	req := &pb.SearchUrisRequest{Uri: "http://bad.example.com/"}
+	vectors := []struct {
+		encoding string
+		compress bool
+		status   string
+	}{
+		{"", false, "0"},
+		{"identity", false, "0"},
+		{"gzip", false, "0"},
+		{"gzip", true, "0"},
+		{"", true, "13"},
+		{"identity", true, "13"},
+		{"snappy", false, "12"},
+	}
+	for i, v := range vectors {
+		header := make(http.Header)
+		if v.encoding != "" {
+			header.Set("Grpc-Encoding", v.encoding)
+		}
+		msgs, resp := c.post(grpcSearchUrisPath, header, grpcFrames(t, v.compress, req))
+		if got := resp.Trailer.Get("Grpc-Status"); got != v.status {
+			t.Errorf("test %d, status = %s, want %s", i, got, v.status)
+			continue
+		}
+		if got := resp.Header.Get("Grpc-Accept-Encoding"); got != grpcAcceptEncoding {
+			t.Errorf("test %d, grpc-accept-encoding = %q, want %q", i, got, grpcAcceptEncoding)
+		}
+		var sresp pb.SearchUrisResponse
+		if v.status == "0" && (len(msgs) != 1 || proto.Unmarshal(msgs[0], &sresp) != nil || sresp.GetThreat() == nil) {
+			t.Errorf("test %d, SearchUris() = %v, want a threat", i, &sresp)
+		}
+	}
+
+	// Decompressed messages are limited like uncompressed ones.
+	var zb bytes.Buffer
+	zw := gzip.NewWriter(&zb)
+	zw.Write(make([]byte, maxGRPCMessageBytes+1))
+	zw.Close()
+	body := append([]byte{1, 0, 0, 0, 0}, zb.Bytes()...)
+	binary.BigEndian.PutUint32(body[1:], uint32(zb.Len()))
+	header := http.Header{"Grpc-Encoding": {"gzip"}}
+	if _, resp := c.post(grpcSearchUrisPath, header, body); resp.Trailer.Get("Grpc-Status") != "8" {
+		t.Errorf("oversized message status = %s, want 8", resp.Trailer.Get("Grpc-Status"))
+	}
+}
+
+func TestGRPCDeadline(t *testing.T) {
+	dl := &deadlineLooker{grpcLooker: newFakeGRPCLooker()}
+	c := newGRPCTestClient(t, newGRPCHandler(dl))
+	start := time.Now()
+	if _, status := c.call(grpcSearchUrisPath, "10S", &pb.SearchUrisRequest{Uri: "http://bad.example.com/"}); status != "0" {
+		t.Fatalf("SearchUris() status = %s, want 0", status)
+	}
+	dl.mu.Lock()
+	deadline := dl.deadline
+	dl.mu.Unlock()
+	if deadline.Before(start.Add(10*time.Second)) || deadline.After(time.Now().Add(10*time.Second)) {
+		t.Errorf("lookup deadline = %v, want within 10s of %v", deadline, start)
+	}
+
+	dl.block = true
+	if _, status := c.call(grpcSearchUrisPath, "20m", &pb.SearchUrisRequest{Uri: "http://bad.example.com/"}); status != "4" {
+		t.Errorf("SearchUris() past its deadline status = %s, want 4", status)
+	}
+}
+
+func TestGRPCLimits(t *testing.T) {
+	defer func(l *rateLimiter, batch int, size int64, timeout time.Duration) {
+		lookupRateLimiter = l
+		*maxBatchSizeFlag, *maxRequestBytesFlag, *requestTimeoutFlag = batch, size, timeout
+	}(lookupRateLimiter, *maxBatchSizeFlag, *maxRequestBytesFlag, *requestTimeoutFlag)
+	req := &pb.SearchUrisRequest{Uri: "http://bad.example.com/"}
+
+	// Rate limited clients are answered with RESOURCE_EXHAUSTED.
+	var err error
+	if lookupRateLimiter, err = newRateLimiter(0.001, 2, rateLimitByIP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := newGRPCTestClient(t, newGRPCHandler(newFakeGRPCLooker()))
+	for i, want := range []string{"0", "0", "8"} {
+		_, resp := c.post(grpcSearchUrisPath, nil, grpcFrames(t, false, req))
+		if got := resp.Trailer.Get("Grpc-Status"); got != want {
+			t.Errorf("call %d, status = %s, want %s", i, got, want)
+		}
+		if want == "8" && (resp.StatusCode != http.StatusOK || resp.Header.Get("Retry-After") == "" ||
+			resp.Header.Get("Content-Type") != "application/grpc") {
+			t.Errorf("call %d, rate limited response = %d, %v", i, resp.StatusCode, resp.Header)
+		}
+	}
+	lookupRateLimiter = nil
+
+	// Streams are limited to -maxBatchSize URIs.
+	*maxBatchSizeFlag = 2
+	c = newGRPCTestClient(t, newGRPCHandler(newFakeGRPCLooker()))
+	if msgs, status := c.call(grpcStreamSearchUrisPath, "", req, req, req); len(msgs) != 2 || status != "8" {
+		t.Errorf("StreamSearchUris() = %d messages, status %s, want 2, status 8", len(msgs), status)
+	}
+
+	// Unary calls are limited by -maxRequestBytes and -requestTimeout.
+	*maxRequestBytesFlag = 16
+	c = newGRPCTestClient(t, newGRPCHandler(newFakeGRPCLooker()))
+	if _, status := c.call(grpcSearchUrisPath, "", req); status != "8" {
+		t.Errorf("SearchUris() over -maxRequestBytes status = %s, want 8", status)
+	}
+	*maxRequestBytesFlag, *requestTimeoutFlag = 0, 20*time.Millisecond
+	c = newGRPCTestClient(t, newGRPCHandler(&deadlineLooker{grpcLooker: newFakeGRPCLooker(), block: true}))
+	if _, status := c.call(grpcSearchUrisPath, "", req); status != "4" {
+		t.Errorf("SearchUris() over -requestTimeout status = %s, want 4", status)
+	}
+}
+
+func TestGRPCTenants(t *testing.T) {
+	defer func(tenants []*tenant) { serverTenants = tenants }(serverTenants)
+	serverTenants = []*tenant{
+		{name: "a", config: tenantConfig{Tokens: []string{"ta"}}, wr: new(webrisk.UpdateClient)},
+	}
+	c := newGRPCTestClient(t, newGRPCRootHandler(nil))
+	req := &pb.SearchUrisRequest{Uri: "http://bad.example.com/"}
+	vectors := []struct {
+		path   string
+		status string
+	}{
+		{grpcSearchUrisPath, "16"},
+		{"/t/a" + grpcSearchUrisPath, "16"},
+		{"/t/b" + grpcSearchUrisPath, "5"},
+	}
+	for i, v := range vectors {
+		if _, status := c.call(v.path, "", req); status != v.status {
+			t.Errorf("test %d, status = %s, want %s", i, status, v.status)
+		}
+	}
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	vectors := []struct {
+		value string
+		want  time.Duration
+		fail  bool
+	}{
+		{value: "1H", want: time.Hour},
+		{value: "30M", want: 30 * time.Minute},
+		{value: "10S", want: 10 * time.Second},
+		{value: "250m", want: 250 * time.Millisecond},
+		{value: "99999999u", want: 99999999 * time.Microsecond},
+		{value: "5n", want: 5},
+		{value: "100", fail: true},
+		{value: "S", fail: true},
+		{value: "-1S", fail: true},
+		{value: "123456789S", fail: true},
+	}
+	for i, v := range vectors {
+		got, err := parseGRPCTimeout(v.value)
+		if err != nil != v.fail {
+			t.Errorf("test %d, parseGRPCTimeout(%q) error = %v, want failure %v", i, v.value, err, v.fail)
+			continue
+		}
+		if got != v.want {
+			t.Errorf("test %d, parseGRPCTimeout(%q) = %v, want %v", i, v.value, got, v.want)
+		}
+	}
+}
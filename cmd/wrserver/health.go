@@ -0,0 +1,61 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+)
+
+// serveHealth reports that the server is alive. It succeeds as long as the
+// server is able to serve requests at all.
+func serveHealth(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(resp, "ok\n")
+}
+
+// serveReadiness reports whether the server should receive traffic. It fails
+// until the database has been synced with the API, while the database is in
+// an error state, if the database is older than maxStaleness (when positive),
+// while the cache is warmed up with -warmCache, and once the server is
+// draining connections to shut down.
+func serveReadiness(resp http.ResponseWriter, req *http.Request, status func() (webrisk.Stats, error), maxStaleness time.Duration) {
+	resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	stats, err := status()
+	switch {
+	case connStats.snapshot().Draining:
+		err = fmt.Errorf("server is shutting down")
+	case err != nil:
+	case maxStaleness > 0 && stats.DatabaseAge > maxStaleness:
+		err = fmt.Errorf("database last synced %v ago", stats.DatabaseAge.Round(time.Second))
+	case atomic.LoadInt32(&cacheWarmingUp) != 0:
+		err = fmt.Errorf("cache warming up")
+	}
+	if err != nil {
+		http.Error(resp, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(resp, "ok\n")
+}
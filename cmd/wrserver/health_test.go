@@ -0,0 +1,50 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestServeReadiness(t *testing.T) {
+	vectors := []struct {
+		age          time.Duration
+		err          error
+		maxStaleness time.Duration
+		code         int
+	}{
+		{time.Minute, nil, 0, http.StatusOK},
+		{time.Minute, errors.New("no database loaded"), 0, http.StatusServiceUnavailable},
+		{time.Hour, nil, 0, http.StatusOK},
+		{time.Hour, nil, 2 * time.Hour, http.StatusOK},
+		{time.Hour, nil, 30 * time.Minute, http.StatusServiceUnavailable},
+	}
+	for i, v := range vectors {
+		status := func() (webrisk.Stats, error) {
+			return webrisk.Stats{DatabaseAge: v.age}, v.err
+		}
+		rec := httptest.NewRecorder()
+		serveReadiness(rec, httptest.NewRequest("GET", readyPath, nil), status, v.maxStaleness)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// icapIdleTimeout is how long ICAP connections are kept open between requests.
+const icapIdleTimeout = 5 * time.Minute
+
+// icapMaxBody is the maximum size of the encapsulated body of a request.
+const icapMaxBody = 1 << 20
+
+// icapService is the ICAP service served with -icapAddr, if any.
+var icapService *icapServer
+
+// icapServer is an ICAP (RFC 3507) server offering a REQMOD service that
+// checks the URLs of the HTTP requests of proxies such as Squid. Requests for
+// unsafe URLs are answered with the interstitial page of their threat, and the
+// other ones are left unmodified.
+type icapServer struct {
+	ul    urlLooker
+	fs    http.FileSystem // Serves the interstitial templates; guarded by settingsMu
+	istag string
+}
+
+func newICAPServer(ul urlLooker, fs http.FileSystem) *icapServer {
+	return &icapServer{ul: ul, fs: fs, istag: fmt.Sprintf(`"wrserver-%x"`, startTime.Unix())}
+}
+
+// setFS sets the file system serving the interstitial templates. This assumes
+// that settingsMu is held.
+func (s *icapServer) setFS(fs http.FileSystem) {
+	s.fs = fs
+}
+
+// icapRequest is a parsed ICAP request.
+type icapRequest struct {
+	method string
+	header textproto.MIMEHeader
+	rawReq []byte        // Encapsulated HTTP request header, if any
+	req    *http.Request // Parsed from rawReq
+	body   []byte        // Encapsulated HTTP request body, if any
+
+	hasBody bool
+	preview bool // Whether body is only a preview of the full body
+}
+
+// serve accepts ICAP connections on ln until it fails.
+func (s *icapServer) serve(ln net.Listener) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+// serveConn serves the requests sent over c until the client closes it.
+func (s *icapServer) serveConn(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	for {
+		c.SetReadDeadline(time.Now().Add(icapIdleTimeout))
+		req, err := readICAPRequest(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				writeICAPStatus(bw, 400, "Bad Request", s.istag)
+				bw.Flush()
+			}
+			return
+		}
+		s.serveRequest(bw, req)
+		// The messages encapsulated by requests for other methods are not
+		// read, so the connection cannot be reused after them.
+		reusable := req.method == "OPTIONS" || req.method == "REQMOD"
+		if err := bw.Flush(); err != nil || !reusable || strings.EqualFold(req.header.Get("Connection"), "close") {
+			return
+		}
+	}
+}
+
+// serveRequest writes the response to req to w.
+func (s *icapServer) serveRequest(w *bufio.Writer, req *icapRequest) {
+	switch req.method {
+	case "OPTIONS":
+		fmt.Fprintf(w, "ICAP/1.0 200 OK\r\n"+
+			"Methods: REQMOD\r\n"+
+			"Service: wrserver Web Risk URL filter\r\n"+
+			"ISTag: %s\r\n"+
+			"Allow: 204\r\n"+
+			"Preview: 0\r\n"+
+			"Options-TTL: 3600\r\n"+
+			"Encapsulated: null-body=0\r\n\r\n", s.istag)
+	case "REQMOD":
+		s.serveReqmod(w, req)
+	default:
+		writeICAPStatus(w, 405, "Method Not Allowed", s.istag)
+	}
+}
+
+// icapClient returns the address of the client of the proxy, as given in the
+// X-Client-IP header of req by proxies such as Squid, or "-" if unknown.
+func icapClient(req *icapRequest) string {
+	if ip := req.header.Get("X-Client-IP"); ip != "" {
+		return ip
+	}
+	return "-"
+}
+
+// icapTargetURL returns the URL requested by the encapsulated request r. Only
+// the host of CONNECT requests is known.
+func icapTargetURL(r *http.Request) string {
+	if r.Method == http.MethodConnect {
+		return "https://" + strings.TrimSuffix(r.Host, ":443") + "/"
+	}
+	if r.URL.IsAbs() {
+		return r.URL.String()
+	}
+	return "http://" + r.Host + r.URL.RequestURI()
+}
+
+// serveReqmod checks the URL of the HTTP request encapsulated in req.
+func (s *icapServer) serveReqmod(w *bufio.Writer, req *icapRequest) {
+	if req.req == nil {
+		writeICAPStatus(w, 400, "Bad Request", s.istag)
+		return
+	}
+	target := icapTargetURL(req.req)
+	ctx := webrisk.WithEventLabels(req.req.Context(), map[string]string{labelClient: icapClient(req), labelEndpoint: "icap"})
+	results, err := s.ul.LookupURLResults(ctx, []string{target})
+	if err = lookupError(err); err != nil {
+		appLog.Errorf("ICAP lookup of %s failed: %v", target, err)
+		writeICAPStatus(w, 500, "Server Error", s.istag)
+		return
+	}
+	auditLookups("icap", "", []string{target}, results)
+	if threats := results[0].Threats; len(threats) > 0 && !allowDryRun("ICAP", icapClient(req), target, threats) {
+		s.writeBlocked(w, req.req, target, threats)
+		return
+	}
+
+	// A 204 response is allowed after a preview even if the client did not
+	// offer it.
+	allow204 := req.preview
+	for _, a := range strings.Split(req.header.Get("Allow"), ",") {
+		allow204 = allow204 || strings.TrimSpace(a) == "204"
+	}
+	if allow204 {
+		writeICAPStatus(w, 204, "No Content", s.istag)
+		return
+	}
+	// Send the request back unmodified.
+	fmt.Fprintf(w, "ICAP/1.0 200 OK\r\nISTag: %s\r\n", s.istag)
+	if req.hasBody {
+		fmt.Fprintf(w, "Encapsulated: req-hdr=0, req-body=%d\r\n\r\n", len(req.rawReq))
+		w.Write(req.rawReq)
+		writeChunked(w, req.body)
+	} else {
+		fmt.Fprintf(w, "Encapsulated: req-hdr=0, null-body=%d\r\n\r\n", len(req.rawReq))
+		w.Write(req.rawReq)
+	}
+}
+
+// writeBlocked writes a response replacing the request r for the unsafe URL
+// target with the interstitial page of its threat.
+func (s *icapServer) writeBlocked(w *bufio.Writer, r *http.Request, target string, threats []webrisk.URLThreat) {
+	settingsMu.RLock()
+	tr, fs := interstitialTranslations, s.fs
+	settingsMu.RUnlock()
+	fs, lang := tr.lookup(fs, r.Header.Get("Accept-Language"))
+
+	page := []byte("Blocked: " + target + " was identified as unsafe by Web Risk.\n")
+	contentType := "text/plain; charset=utf-8"
+	if u, err := url.Parse(target); err == nil {
+		for _, threat := range threats {
+			if tmpl, ok := threatTemplate[threat.ThreatType]; ok {
+				if p, err := renderInterstitial(fs, tmpl, interstitialData(threat, u, lang)); err == nil {
+					page, contentType = p, "text/html; charset=utf-8"
+				} else {
+					appLog.Errorf("Unable to render interstitial for %s: %v", target, err)
+				}
+				break
+			}
+		}
+	}
+
+	var hdr bytes.Buffer
+	fmt.Fprintf(&hdr, "HTTP/1.1 403 Forbidden\r\n"+
+		"Content-Type: %s\r\n"+
+		"Content-Length: %d\r\n"+
+		"Cache-Control: no-store\r\n"+
+		"Connection: close\r\n\r\n", contentType, len(page))
+	fmt.Fprintf(w, "ICAP/1.0 200 OK\r\nISTag: %s\r\nEncapsulated: res-hdr=0, res-body=%d\r\n\r\n", s.istag, hdr.Len())
+	w.Write(hdr.Bytes())
+	writeChunked(w, page)
+}
+
+// writeICAPStatus writes a response without an encapsulated message.
+func writeICAPStatus(w io.Writer, code int, reason, istag string) {
+	fmt.Fprintf(w, "ICAP/1.0 %d %s\r\nISTag: %s\r\nEncapsulated: null-body=0\r\n\r\n", code, reason, istag)
+}
+
+// writeChunked writes b as a chunked body.
+func writeChunked(w io.Writer, b []byte) {
+	if len(b) > 0 {
+		fmt.Fprintf(w, "%x\r\n", len(b))
+		w.Write(b)
+		io.WriteString(w, "\r\n")
+	}
+	io.WriteString(w, "0\r\n\r\n")
+}
+
+// readICAPRequest reads an ICAP request from r, along with the HTTP request
+// header and body it encapsulates.
+func readICAPRequest(r *bufio.Reader) (*icapRequest, error) {
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[2] != "ICAP/1.0" {
+		return nil, fmt.Errorf("malformed ICAP request line %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	req := &icapRequest{method: parts[0], header: header}
+	if req.method != "REQMOD" {
+		return req, nil
+	}
+
+	// The Encapsulated header lists the offsets of the sections of the
+	// encapsulated message, such as "req-hdr=0, req-body=412".
+	hasHdr, end := false, 0
+	for _, section := range strings.Split(header.Get("Encapsulated"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(section), "=")
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("malformed Encapsulated header %q", header.Get("Encapsulated"))
+		}
+		switch name {
+		case "req-hdr":
+			if offset != 0 {
+				return nil, fmt.Errorf("unexpected Encapsulated header %q", header.Get("Encapsulated"))
+			}
+			hasHdr = true
+		case "req-body":
+			req.hasBody = true
+			end = offset
+		case "null-body":
+			end = offset
+		default:
+			return nil, fmt.Errorf("unexpected Encapsulated header %q", header.Get("Encapsulated"))
+		}
+	}
+	if hasHdr {
+		if end <= 0 || end > icapMaxBody {
+			return nil, errors.New("invalid encapsulated request header")
+		}
+		req.rawReq = make([]byte, end)
+		if _, err := io.ReadFull(r, req.rawReq); err != nil {
+			return nil, err
+		}
+		if req.req, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(req.rawReq))); err != nil {
+			return nil, err
+		}
+	}
+	if req.hasBody {
+		var ieof bool
+		if req.body, ieof, err = readChunked(r, icapMaxBody); err != nil {
+			return nil, err
+		}
+		req.preview = header.Get("Preview") != "" && !ieof
+	}
+	return req, nil
+}
+
+// readChunked reads a chunked body of at most max bytes from r. It also
+// reports whether its last chunk carried the ieof extension, which marks the
+// end of the body in a preview.
+func readChunked(r *bufio.Reader, max int) (body []byte, ieof bool, err error) {
+	tp := textproto.NewReader(r)
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		size, ext, _ := strings.Cut(line, ";")
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 32)
+		if err != nil || n < 0 {
+			return nil, false, fmt.Errorf("malformed chunk size %q", line)
+		}
+		if n == 0 {
+			// Skip the trailer, if any, up to the empty line ending it.
+			for {
+				if line, err = tp.ReadLine(); err != nil {
+					return nil, false, err
+				}
+				if line == "" {
+					return body, strings.TrimSpace(ext) == "ieof", nil
+				}
+			}
+		}
+		if len(body)+int(n) > max {
+			return nil, false, errors.New("encapsulated body too large")
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, false, err
+		}
+		body = append(body, chunk[:n]...)
+	}
+}
+
+// runICAPServer serves icapService at addr, which is either a TCP address or
+// the path of a Unix domain socket prefixed with unix://, until the process
+// exits.
+func runICAPServer(addr string) {
+	ln, err := listen(addr, socketMode)
+	if err != nil {
+		appLog.Fatalf("ICAP server error: %s", err)
+	}
+	appLog.Infof("Starting ICAP server at %s", addr)
+	if err := icapService.serve(ln); err != nil {
+		appLog.Errorf("ICAP server error: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestICAPServer(t *testing.T) {
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		"http://bad.example.com/login": {{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+		"https://evil.example.com/":    {{Pattern: "evil.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineering}},
+	}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	go newICAPServer(fl, http.Dir("public")).serve(ln)
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+
+	reqmod := func(httpReq, extra string, body string) string {
+		enc := fmt.Sprintf("req-hdr=0, null-body=%d", len(httpReq))
+		if body != "" {
+			enc = fmt.Sprintf("req-hdr=0, req-body=%d", len(httpReq))
+			body = fmt.Sprintf("%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+		}
+		return "REQMOD icap://wrserver/reqmod ICAP/1.0\r\nHost: wrserver\r\n" + extra +
+			"Encapsulated: " + enc + "\r\n\r\n" + httpReq + body
+	}
+	vectors := []struct {
+		req     string
+		status  string
+		enc     string // Prefix of the Encapsulated header of the response
+		content string // Expected in the encapsulated message
+	}{{
+		req:    "OPTIONS icap://wrserver/reqmod ICAP/1.0\r\nHost: wrserver\r\nEncapsulated: null-body=0\r\n\r\n",
+		status: "ICAP/1.0 200 OK",
+		enc:    "null-body=0",
+	}, {
+		req:    reqmod("GET http://www.example.com/ HTTP/1.1\r\nHost: www.example.com\r\n\r\n", "Allow: 204\r\n", ""),
+		status: "ICAP/1.0 204 No Content",
+		enc:    "null-body=0",
+	}, {
+		req:     reqmod("POST http://www.example.com/form HTTP/1.1\r\nHost: www.example.com\r\nContent-Length: 5\r\n\r\n", "", "hello"),
+		status:  "ICAP/1.0 200 OK",
+		enc:     "req-hdr=0, req-body=",
+		content: "hello",
+	}, {
+		req:     reqmod("GET /login HTTP/1.1\r\nHost: bad.example.com\r\n\r\n", "Allow: 204\r\n", ""),
+		status:  "ICAP/1.0 200 OK",
+		enc:     "res-hdr=0, res-body=",
+		content: "HTTP/1.1 403 Forbidden",
+	}, {
+		req:     reqmod("CONNECT evil.example.com:443 HTTP/1.1\r\nHost: evil.example.com:443\r\n\r\n", "Allow: 204\r\n", ""),
+		status:  "ICAP/1.0 200 OK",
+		enc:     "res-hdr=0, res-body=",
+		content: "evil.example.com",
+	}, {
+		req:    "RESPMOD icap://wrserver/respmod ICAP/1.0\r\nHost: wrserver\r\nEncapsulated: null-body=0\r\n\r\n",
+		status: "ICAP/1.0 405 Method Not Allowed",
+		enc:    "null-body=0",
+	}}
+	for i, v := range vectors {
+		if _, err := io.WriteString(c, v.req); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		tp := textproto.NewReader(br)
+		status, err := tp.ReadLine()
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if status != v.status {
+			t.Errorf("test %d, status = %q, want %q", i, status, v.status)
+		}
+		enc := header.Get("Encapsulated")
+		if !strings.HasPrefix(enc, v.enc) {
+			t.Errorf("test %d, Encapsulated = %q, want prefix %q", i, enc, v.enc)
+		}
+		if header.Get("ISTag") == "" {
+			t.Errorf("test %d, missing ISTag", i)
+		}
+		if enc == "null-body=0" {
+			continue
+		}
+		// Read the encapsulated header, whose length is the offset of the
+		// body, and the body.
+		_, offset, _ := strings.Cut(enc, "body=")
+		n, _ := strconv.Atoi(offset)
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		body, _, err := readChunked(br, icapMaxBody)
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if got := string(msg) + string(body); !strings.Contains(got, v.content) {
+			t.Errorf("test %d, encapsulated message does not contain %q:\n%s", i, v.content, got)
+		}
+	}
+	if want := []string{"http://www.example.com/", "http://www.example.com/form", "http://bad.example.com/login", "https://evil.example.com/"}; !reflect.DeepEqual(fl.urls, want) {
+		t.Errorf("looked up %q, want %q", fl.urls, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// unixPeers is the entry of an IP set holding the peers connecting over a Unix
+// domain socket, which have no IP address.
+const unixPeers = "unix"
+
+// ipSet is a set of IP addresses, such as those of -trustedProxies.
+type ipSet struct {
+	nets []*net.IPNet
+	unix bool
+}
+
+// parseIPSet parses a comma separated list of IP addresses and CIDR ranges,
+// which may also hold "unix" for the peers connecting over a Unix domain
+// socket. It returns nil if the list is empty.
+func parseIPSet(list string) (*ipSet, error) {
+	set := new(ipSet)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+			continue
+		case s == unixPeers:
+			set.unix = true
+			continue
+		case !strings.Contains(s, "/"):
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR range %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			set.nets = append(set.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR range %q", s)
+		}
+		set.nets = append(set.nets, n)
+	}
+	if len(set.nets) == 0 && !set.unix {
+		return nil, nil
+	}
+	return set, nil
+}
+
+// contains reports whether the peer with the given IP address, as returned by
+// clientIP, is in s. A nil set is empty.
+func (s *ipSet) contains(addr string) bool {
+	if s == nil {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		// Peers connecting over a Unix domain socket have no IP address.
+		return s.unix && !strings.Contains(addr, ":")
+	}
+	for _, n := range s.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
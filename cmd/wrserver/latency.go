@@ -0,0 +1,127 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBounds are the upper bounds in seconds of the buckets of the latency
+// histograms, chosen to tell apart lookups answered locally from those which
+// required a call to the Web Risk API.
+var latencyBounds = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Verdicts counted by the endpoint statistics.
+const (
+	verdictSafe   = "safe"
+	verdictUnsafe = "unsafe"
+)
+
+// LatencyHistogram counts requests by latency. Counts[i] is the number of
+// requests served within Bounds[i] seconds but not within Bounds[i-1], and the
+// last count is that of the requests slower than every bound.
+type LatencyHistogram struct {
+	Bounds     []float64
+	Counts     []int64
+	Count      int64
+	SumSeconds float64
+}
+
+// observe counts a request served in d.
+func (h *LatencyHistogram) observe(d time.Duration) {
+	secs := d.Seconds()
+	h.Counts[sort.SearchFloat64s(h.Bounds, secs)]++
+	h.Count++
+	h.SumSeconds += secs
+}
+
+// EndpointStats is a snapshot of the statistics of the lookups served by an
+// endpoint.
+type EndpointStats struct {
+	// Latency of the requests keyed by the most costly source of their
+	// results: "database", "cache" or "api".
+	Latency map[string]*LatencyHistogram
+	// Number of URLs looked up keyed by verdict: "safe" or "unsafe".
+	Verdicts map[string]int64
+}
+
+// endpointStats tracks the latency and the verdicts of the lookups served by
+// each endpoint.
+type endpointStats struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+// lookupStats holds the statistics of the lookup endpoints of wrserver.
+var lookupStats = new(endpointStats)
+
+// record records a request to the given endpoint which looked up urls URLs,
+// unsafe of which matched a threat list. Its latency is only recorded if
+// source is set, as streams and failed lookups are not representative.
+func (s *endpointStats) record(endpoint, source string, urls, unsafe int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]*EndpointStats)
+	}
+	es := s.endpoints[endpoint]
+	if es == nil {
+		es = &EndpointStats{
+			Latency:  make(map[string]*LatencyHistogram),
+			Verdicts: make(map[string]int64),
+		}
+		s.endpoints[endpoint] = es
+	}
+	es.Verdicts[verdictSafe] += int64(urls - unsafe)
+	es.Verdicts[verdictUnsafe] += int64(unsafe)
+	if source == "" {
+		return
+	}
+	h := es.Latency[source]
+	if h == nil {
+		h = &LatencyHistogram{Bounds: latencyBounds, Counts: make([]int64, len(latencyBounds)+1)}
+		es.Latency[source] = h
+	}
+	h.observe(d)
+}
+
+// snapshot returns the current statistics keyed by endpoint, or nil if no
+// lookup was served yet.
+func (s *endpointStats) snapshot() map[string]EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.endpoints) == 0 {
+		return nil
+	}
+	m := make(map[string]EndpointStats, len(s.endpoints))
+	for endpoint, es := range s.endpoints {
+		c := EndpointStats{
+			Latency:  make(map[string]*LatencyHistogram, len(es.Latency)),
+			Verdicts: make(map[string]int64, len(es.Verdicts)),
+		}
+		for src, h := range es.Latency {
+			hc := *h
+			hc.Counts = append([]int64(nil), h.Counts...)
+			c.Latency[src] = &hc
+		}
+		for v, n := range es.Verdicts {
+			c.Verdicts[v] = n
+		}
+		m[endpoint] = c
+	}
+	return m
+}
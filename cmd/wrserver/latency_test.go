@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestEndpointStats(t *testing.T) {
+	oldStats := lookupStats
+	lookupStats = new(endpointStats)
+	defer func() { lookupStats = oldStats }()
+
+	vectors := []struct {
+		path    string
+		status  int
+		results []webrisk.URLResult
+	}{
+		{findThreatPath, http.StatusOK, []webrisk.URLResult{{}, {Source: webrisk.SourceCache}}},
+		{tenantPathPrefix + "payments" + findThreatPath, http.StatusOK, []webrisk.URLResult{{Source: webrisk.SourceAPI, Threats: []webrisk.URLThreat{{ThreatType: webrisk.ThreatTypeMalware}}}}},
+		{findThreatPath, http.StatusOK, []webrisk.URLResult{{}}},
+		{streamSearchPath, http.StatusSwitchingProtocols, []webrisk.URLResult{{Source: webrisk.SourceAPI}}},
+		{healthPath, http.StatusOK, nil},
+	}
+	for _, v := range vectors {
+		v := v
+		h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recordLookups(r.Context(), make([]string, len(v.results)), v.results)
+			w.WriteHeader(v.status)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", v.path, nil))
+	}
+
+	got := lookupStats.snapshot()
+	counts := func(es EndpointStats) map[string]int64 {
+		m := make(map[string]int64)
+		for src, h := range es.Latency {
+			var n int64
+			for _, c := range h.Counts {
+				n += c
+			}
+			if n != h.Count || len(h.Counts) != len(h.Bounds)+1 {
+				t.Errorf("%s histogram inconsistent: %+v", src, h)
+			}
+			m[src] = h.Count
+		}
+		return m
+	}
+	want := map[string]struct {
+		latency  map[string]int64
+		verdicts map[string]int64
+	}{
+		findThreatPath:   {map[string]int64{"database": 1, "cache": 1, "api": 1}, map[string]int64{"safe": 3, "unsafe": 1}},
+		streamSearchPath: {map[string]int64{}, map[string]int64{"safe": 1, "unsafe": 0}},
+	}
+	if len(got) != len(want) {
+		t.Errorf("stats of %d endpoints, want %d: %+v", len(got), len(want), got)
+	}
+	for path, w := range want {
+		es := got[path]
+		if c := counts(es); !reflect.DeepEqual(c, w.latency) {
+			t.Errorf("%s latency counts = %v, want %v", path, c, w.latency)
+		}
+		if !reflect.DeepEqual(es.Verdicts, w.verdicts) {
+			t.Errorf("%s verdicts = %v, want %v", path, es.Verdicts, w.verdicts)
+		}
+	}
+}
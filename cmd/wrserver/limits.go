@@ -0,0 +1,56 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// requestTimeoutMessage is the body of the responses to requests that timed
+// out.
+const requestTimeoutMessage = "request timed out"
+
+// withRequestLimits wraps h so that reading more than maxBytes of a request
+// body fails, and so that requests not served within timeout are answered
+// with 503 Service Unavailable and have their context canceled. Limits that
+// are not positive are not enforced.
+//
+// Handlers report bodies over the limit with 413 Request Entity Too Large, as
+// determined by requestErrorCode.
+func withRequestLimits(maxBytes int64, timeout time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	if maxBytes > 0 {
+		next := h
+		h = func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next(w, r)
+		}
+	}
+	if timeout > 0 {
+		h = http.TimeoutHandler(h, timeout, requestTimeoutMessage).ServeHTTP
+	}
+	return h
+}
+
+// requestErrorCode returns the status code of the response to a request whose
+// body could not be read or decoded because of err.
+func requestErrorCode(err error) int {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestLimits(t *testing.T) {
+	fl := &fakeLooker{}
+	h := withRequestLimits(64, 50*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			<-r.Context().Done()
+			return
+		}
+		serveBatchSearch(w, r, fl, 10)
+	})
+
+	vectors := []struct {
+		body string
+		slow bool
+		code int
+	}{
+		{`{"uris": ["http://a.example/"]}`, false, http.StatusOK},
+		{`{"uris": ["http://a.example/` + strings.Repeat("a", 64) + `"]}`, false, http.StatusRequestEntityTooLarge},
+		{`{"uris": [`, false, http.StatusBadRequest},
+		{`{"uris": ["http://a.example/"]}`, true, http.StatusServiceUnavailable},
+	}
+	for i, v := range vectors {
+		path := batchSearchPath
+		if v.slow {
+			path += "?slow=1"
+		}
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", path, strings.NewReader(v.body)))
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+	}
+}
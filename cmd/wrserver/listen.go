@@ -0,0 +1,87 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixSocketPrefix prefixes server addresses that are the path of a Unix
+// domain socket rather than a TCP address.
+const unixSocketPrefix = "unix://"
+
+// tcp4Prefix and tcp6Prefix prefix TCP addresses that are only listened on
+// over IPv4 or IPv6, respectively.
+const (
+	tcp4Prefix = "tcp4://"
+	tcp6Prefix = "tcp6://"
+)
+
+// socketMode is the file mode of the Unix domain socket the server listens
+// on, if any.
+var socketMode os.FileMode = 0660
+
+// splitAddrs returns the addresses of the comma separated list addrs.
+func splitAddrs(addrs string) []string {
+	var list []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			list = append(list, addr)
+		}
+	}
+	return list
+}
+
+// listen listens on addr, which is either a TCP address or the path of a Unix
+// domain socket prefixed with unix://, such as unix:///run/wrserver.sock.
+// TCP addresses prefixed with tcp4:// or tcp6:// are only listened on over
+// IPv4 or IPv6, so that [::]:8080 does not also accept IPv4 connections for
+// instance. A socket left over at that path by a previous run is replaced,
+// and the socket is given the given file mode so that access to the server
+// can be controlled with file system permissions.
+func listen(addr string, mode os.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, tcp4Prefix):
+		return net.Listen("tcp4", strings.TrimPrefix(addr, tcp4Prefix))
+	case strings.HasPrefix(addr, tcp6Prefix):
+		return net.Listen("tcp6", strings.TrimPrefix(addr, tcp6Prefix))
+	case !strings.HasPrefix(addr, unixSocketPrefix):
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, unixSocketPrefix)
+	if path == "" {
+		return nil, fmt.Errorf("missing socket path in %s", addr)
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wrserver.sock")
+	ln, err := listen(unixSocketPrefix+path, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want socket with 0600", fi.Mode())
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(serveHealth)}
+	go srv.Serve(ln)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://wrserver" + healthPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok\n" {
+		t.Errorf("GET %s over socket = %d %q", healthPath, resp.StatusCode, body)
+	}
+
+	// A file that is not a socket is never replaced.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ln, err := listen(unixSocketPrefix+file, 0600); err == nil {
+		ln.Close()
+		t.Errorf("listen on a regular file succeeded, want error")
+	}
+	if _, err := listen(unixSocketPrefix, 0600); err == nil {
+		t.Errorf("listen without socket path succeeded, want error")
+	}
+}
+
+func TestListenAddressFamily(t *testing.T) {
+	if got, want := splitAddrs(" 127.0.0.1:8080,,[::1]:8080 "), []string{"127.0.0.1:8080", "[::1]:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitAddrs = %q, want %q", got, want)
+	}
+	ln, err := listen(tcp4Prefix+"127.0.0.1:0", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ln.Close()
+	if ln.Addr().Network() != "tcp" || ln.Addr().(*net.TCPAddr).IP.To4() == nil {
+		t.Errorf("tcp4 listener address = %v, want an IPv4 address", ln.Addr())
+	}
+	if ln, err := listen(tcp4Prefix+"[::1]:0", 0); err == nil {
+		ln.Close()
+		t.Errorf("tcp4 listen on an IPv6 address succeeded, want error")
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// Formats of the logs written by wrserver.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// requestIDHeader carries the ID of a request. It is set on every response,
+// and an ID given by the client in the request is used instead of generating
+// a new one.
+const requestIDHeader = "X-Request-Id"
+
+// appLogger writes the logs of wrserver. In text mode, messages are written as
+// plain lines, informational ones to stdout and errors to stderr. In JSON
+// mode, every message and every served request is written to stderr as a
+// single line JSON object, so that logs can be ingested by log processors.
+type appLogger struct {
+	mu     sync.Mutex
+	json   bool
+	stdout io.Writer
+	stderr io.Writer
+	now    func() time.Time
+	errors []logEntry // Most recent errors, oldest first
+}
+
+// maxRecentErrors is the number of recent errors kept by the logger.
+const maxRecentErrors = 20
+
+// appLog is the logger used by wrserver.
+var appLog = &appLogger{stdout: os.Stdout, stderr: os.Stderr, now: time.Now}
+
+// logEntry is the JSON form of an application log message.
+type logEntry struct {
+	Time     time.Time `json:"time"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+}
+
+// accessEntry is the JSON form of the access log of a request.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Severity  string    `json:"severity"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"requestId"`
+	TraceID   string    `json:"traceId,omitempty"`
+	RemoteIP  string    `json:"remoteIp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"` // Size of the response body
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	URLs      int       `json:"urls"`              // Number of URLs looked up
+	Unsafe    int       `json:"unsafe"`            // Number of URLs matching a threat list
+	Threats   []string  `json:"threats,omitempty"` // Threat types matched by any URL
+	Source    string    `json:"source,omitempty"`  // Most costly source of the results
+	LatencyMs float64   `json:"latencyMs"`
+
+	source webrisk.LookupSource // Source, compared when recording lookups
+}
+
+// Infof logs an informational message.
+func (l *appLogger) Infof(format string, args ...interface{}) {
+	l.logf(l.stdout, "INFO", format, args...)
+}
+
+// Errorf logs an error message.
+func (l *appLogger) Errorf(format string, args ...interface{}) {
+	l.logf(l.stderr, "ERROR", format, args...)
+}
+
+// Fatalf logs an error message and exits the process.
+func (l *appLogger) Fatalf(format string, args ...interface{}) {
+	l.logf(l.stderr, "CRITICAL", format, args...)
+	os.Exit(1)
+}
+
+func (l *appLogger) logf(w io.Writer, severity, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if severity != "INFO" {
+		if len(l.errors) == maxRecentErrors {
+			l.errors = append(l.errors[:0], l.errors[1:]...)
+		}
+		l.errors = append(l.errors, logEntry{l.now(), severity, strings.TrimSpace(msg)})
+	}
+	if !l.json {
+		fmt.Fprintln(w, msg)
+		return
+	}
+	l.writeJSON(logEntry{l.now(), severity, strings.TrimSpace(msg)})
+}
+
+// recentErrors returns the most recent errors logged, newest first.
+func (l *appLogger) recentErrors() []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := make([]logEntry, len(l.errors))
+	for i, e := range l.errors {
+		errs[len(errs)-1-i] = e
+	}
+	return errs
+}
+
+// Write implements io.Writer so that the logs of the Web Risk client can be
+// routed through the logger. Every line is logged as a separate message.
+func (l *appLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.json {
+		return l.stderr.Write(p)
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		l.writeJSON(logEntry{l.now(), "INFO", string(line)})
+	}
+	return len(p), nil
+}
+
+// access logs a served request. It is a no-op in text mode.
+func (l *appLogger) access(e *accessEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		l.writeJSON(e)
+	}
+}
+
+// writeJSON writes v as a line of JSON. This assumes that l.mu is held.
+func (l *appLogger) writeJSON(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("unable to encode log entry: %v", err)
+		return
+	}
+	l.stderr.Write(append(b, '\n'))
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether a request ID given by a client can be used.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+type accessKey struct{}
+
+// lookupsMu guards the lookup statistics of access log entries, which are
+// recorded concurrently while serving streams.
+var lookupsMu sync.Mutex
+
+// recordLookups records the URLs looked up while serving a request, and the
+// threats they matched and where they came from according to their results,
+// in the access log of the request and in the -auditLog.
+func recordLookups(ctx context.Context, urls []string, results []webrisk.URLResult) {
+	e, ok := ctx.Value(accessKey{}).(*accessEntry)
+	if !ok {
+		return
+	}
+	auditLookups(endpointPath(e.Path), pathTenant(e.Path), urls, results)
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+	e.URLs += len(urls)
+	for _, r := range results {
+		if e.Source == "" || r.Source > e.source {
+			e.Source, e.source = r.Source.String(), r.Source
+		}
+		if len(r.Threats) > 0 {
+			e.Unsafe++
+		}
+		for _, ut := range r.Threats {
+			td := ut.ThreatType.String()
+			i := sort.SearchStrings(e.Threats, td)
+			if i == len(e.Threats) || e.Threats[i] != td {
+				e.Threats = append(e.Threats, "")
+				copy(e.Threats[i+1:], e.Threats[i:])
+				e.Threats[i] = td
+			}
+		}
+	}
+}
+
+// sourceHeader is the response header naming the most costly source of the
+// verdicts of a lookup: database, cache or api.
+const sourceHeader = "X-Webrisk-Source"
+
+// setSourceHeader sets the sourceHeader of resp from the results of a lookup.
+func setSourceHeader(resp http.ResponseWriter, results []webrisk.URLResult) {
+	if len(results) == 0 {
+		return
+	}
+	source := results[0].Source
+	for _, r := range results[1:] {
+		if r.Source > source {
+			source = r.Source
+		}
+	}
+	resp.Header().Set(sourceHeader, source.String())
+}
+
+// statusRecorder records the status code and the body size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying writer does, so that
+// WebSocket connections can be served.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// withAccessLog wraps h so that every request is assigned a request ID and
+// is written to the access log once served, either by accessLog if it is set
+// or by appLog. The detection events of the lookups made for the request are
+// labelled with its client, endpoint and tenant.
+func withAccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		e := &accessEntry{
+			Severity:  "INFO",
+			Message:   "request",
+			RequestID: id,
+			RemoteIP:  clientIP(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), accessKey{}, e)
+		ctx = webrisk.WithEventLabels(ctx, requestEventLabels(r))
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		e.Time = appLog.now()
+		e.Status = rec.status
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+		e.Bytes = rec.bytes
+		d := time.Since(start)
+		e.LatencyMs = float64(d.Microseconds()) / 1000
+		if e.URLs > 0 {
+			// The latency of streams spans the whole connection.
+			source := e.Source
+			if e.Status == http.StatusSwitchingProtocols {
+				source = ""
+			}
+			lookupStats.record(endpointPath(e.Path), source, e.URLs, e.Unsafe, d)
+		}
+		if accessLog != nil {
+			accessLog.log(e, r)
+			return
+		}
+		appLog.access(e)
+	})
+}
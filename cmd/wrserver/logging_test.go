@@ -0,0 +1,121 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Unix(1700000000, 0).UTC()
+	oldLog := appLog
+	appLog = &appLogger{json: true, stdout: &buf, stderr: &buf, now: func() time.Time { return now }}
+	defer func() { appLog = oldLog }()
+
+	h := withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordLookups(r.Context(), []string{"http://example.com/", "http://bad.example.com/"}, []webrisk.URLResult{
+			{Source: webrisk.SourceCache},
+			{Threats: []webrisk.URLThreat{{ThreatType: webrisk.ThreatTypeMalware}, {ThreatType: webrisk.ThreatTypeMalware}, {ThreatType: webrisk.ThreatTypeUnwantedSoftware}}},
+		})
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	vectors := []struct {
+		reqID string
+		keep  bool // Whether the request ID given by the client is used
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"bad id", false},
+		{strings.Repeat("x", 65), false},
+	}
+	for i, v := range vectors {
+		buf.Reset()
+		req := httptest.NewRequest("POST", findThreatPath, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if v.reqID != "" {
+			req.Header.Set(requestIDHeader, v.reqID)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var got accessEntry
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error decoding %q: %v", i, buf.String(), err)
+			continue
+		}
+		id := rec.Header().Get(requestIDHeader)
+		if id == "" || got.RequestID != id || (id == v.reqID) != v.keep {
+			t.Errorf("test %d, request ID = %q, header %q, client %q", i, got.RequestID, id, v.reqID)
+		}
+		got.RequestID, got.LatencyMs = "", 0
+		want := accessEntry{
+			Time:     now,
+			Severity: "INFO",
+			Message:  "request",
+			RemoteIP: "192.0.2.1",
+			Method:   "POST",
+			Path:     findThreatPath,
+			Status:   http.StatusTeapot,
+			URLs:     2,
+			Unsafe:   1,
+			Threats:  []string{"MALWARE", "UNWANTED_SOFTWARE"},
+			Source:   "cache",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d, access log mismatch:\ngot  %+v\nwant %+v", i, got, want)
+		}
+	}
+
+	buf.Reset()
+	appLog.Write([]byte("webrisk: first\nwebrisk: second\n"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %q", len(lines), buf.String())
+	}
+	var entry logEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry.Message != "webrisk: second" {
+		t.Errorf("log entry = %+v, %v, want message %q", entry, err, "webrisk: second")
+	}
+}
+
+func TestSourceHeader(t *testing.T) {
+	vectors := []struct {
+		results []webrisk.URLResult
+		want    string
+	}{
+		{[]webrisk.URLResult{{}}, "database"},
+		{[]webrisk.URLResult{{Source: webrisk.SourceCache}, {}}, "cache"},
+		{[]webrisk.URLResult{{}, {Source: webrisk.SourceAPI}, {Source: webrisk.SourceCache}}, "api"},
+		{nil, ""},
+	}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		setSourceHeader(rec, v.results)
+		if got := rec.Header().Get(sourceHeader); got != v.want {
+			t.Errorf("test %d, %s = %q, want %q", i, sourceHeader, got, v.want)
+		}
+	}
+}
@@ -64,19 +64,182 @@
 // the Web Risk servers on fewer TCP connections, reducing the cost for
 // comparatively more expensive internet transfers.
 //
-// By default, the wrserver listens on localhost:8080 and serves the following
-// API endpoints:
+// By default, the wrserver listens on localhost:8080, or on the Unix domain
+// socket given with -srvaddr=unix:///path/to/wrserver.sock, and serves the
+// following API endpoints over HTTP, or over HTTPS if a certificate and its
+// private key are given with -tlsCert and -tlsKey:
 //
 //	/v4/threatMatches:find
-//	/v4/threatLists
+//	/v1/uris:search
+//	/v1/uris:batchSearch
+//	/v1/uris:stream
+//	/v1/hashes:search
+//	/v5/hashes:search
 //	/status
+//	/healthz
+//	/readyz
 //	/r
+//	/openapi.json
+//
+// If an admin token is configured with -adminToken, it also serves the
+// following admin endpoints, which require the token as a bearer token in the
+// Authorization header:
+//
+//	/admin/cache:export
+//	/admin/cache:import
+//	/admin/cache:purge
+//	/admin/database:export
+//	/admin/update
+//	/admin/stats
+//	/admin/config
+//	/admin/dashboard
+//	/admin/testThreats (with -testThreats)
+//
+// The dashboard is an HTML page summarizing the state of the threat lists,
+// lookups, requests and recent errors. It also accepts the admin token as the
+// password of HTTP basic authentication, so that browsers prompt for it.
+//
+// The -srvaddr flag may list several addresses separated by commas, such as
+// -srvaddr=127.0.0.1:8080,[::1]:8080. TCP addresses prefixed with tcp4:// or
+// tcp6:// are only listened on over IPv4 or IPv6. With -adminAddr, the admin
+// endpoints are only served on the listeners of its addresses, such as
+// -adminAddr=localhost:9090, and are not found on those of -srvaddr.
+// With -adminAllow, such as -adminAllow=10.0.0.0/8,::1, the admin endpoints,
+// /status and the profiling endpoints of -pprofAddr are only served to the
+// clients in the given IP addresses and CIDR ranges, and others are answered
+// with 403 Forbidden.
+//
+// Every response carries an X-Request-Id header identifying the request. With
+// -logFormat=json, logs are written as one JSON object per line, including an
+// access log entry per request with its ID, client IP, path, status, number
+// of URLs looked up, matched threat types and latency.
+//
+// Behind a reverse proxy, the addresses of the proxies may be listed with
+// -trustedProxies, such as -trustedProxies=10.0.0.0/8,unix, so that clients
+// are identified by the X-Forwarded-For or X-Real-IP header of the requests
+// forwarded by these proxies in the logs and for rate limiting. The headers of
+// requests from other peers are ignored, as clients could spoof them.
+//
+// The lookup endpoints may be called from web pages served by other origins if
+// these are allowed with -corsOrigins, in which case wrserver also answers the
+// CORS preflight requests of browsers.
+//
+// The responses of the lookup endpoints carry a Cache-Control header allowing
+// them to be reused for as long as the verdicts they hold are valid according
+// to the local database and cache, or forbidding it if that is unknown. The
+// responses of GET requests also carry an ETag, so that clients can revalidate
+// them with If-None-Match. Their X-Webrisk-Source header tells where the
+// verdicts came from: the local database, the cache, or the Web Risk API.
+//
+// The /openapi.json endpoint serves an OpenAPI 3.0 document describing these
+// endpoints, from which typed clients can be generated.
+//
+// Endpoint: /v1/uris:search, /v1/hashes:search
+//
+// These endpoints implement the Web Risk Lookup API methods of the same name
+// with the schema of the official API, answering from the local database and
+// cache whenever possible. Existing Web Risk clients can thus be pointed at
+// wrserver instead of each needing its own API key and quota. Both accept GET
+// requests with the query parameters of the official API; uris:search also
+// accepts POST requests with a JSON or ProtoBuf body.
+//
+// The threats found by uris:search carry the expireTime of their match in the
+// local cache, and the max-age of its Cache-Control header tells clients how
+// long verdicts without threats remain valid, so that they do not need to
+// look the same URIs up again in the meantime.
+//
+// Example usage:
+//
+//	$ curl 'localhost:8080/v1/uris:search?uri=http://bad1url.org/&threatTypes=MALWARE'
+//	{
+//	    "threat": {
+//	        "threatTypes": ["MALWARE"],
+//	        "expireTime": "2023-11-14T22:18:20Z"
+//	    }
+//	}
+//
+//	$ curl 'localhost:8080/v1/hashes:search?hashPrefix=WwuJdQ==&threatTypes=MALWARE'
+//	{
+//	    "threats": [{
+//	        "threatTypes": ["MALWARE"],
+//	        "hash": "WwuJdQx48jP+4lxr4y2Sj82AWoxUVcIRDSk1PC9Rf+4=",
+//	        "expireTime": "2023-11-14T22:18:20Z"
+//	    }],
+//	    "negativeExpireTime": "2023-11-14T22:18:20Z"
+//	}
+//
+// Endpoint: /v1/uris:batchSearch
+//
+// The batch endpoint looks up many URIs in a single POST request, up to the
+// number given with -maxBatchSize, and returns a verdict per URI in the same
+// order. Each verdict lists the threat types the URI matched, if any, along
+// with the URL expressions that matched them, the hex encoded hash prefix
+// each matched in the local database, the source that confirmed the match
+// and its expire time, to explain the verdict. Invalid URIs get an error in
+// their verdict instead of failing the whole batch. URIs skipped because of
+// their scheme according to -schemePolicy are marked unsupported, and those
+// skipped because of their host according to -skipPrivateHosts and
+// -internalHostSuffixes are marked skipped. With -serveStale, the verdicts
+// served from expired cache entries because the Web Risk API failed are
+// marked stale. If the lookup runs out of time, as set
+// with -requestTimeout, the verdicts already determined are returned and the
+// URIs that could not be fully looked up are marked undetermined.
+//
+// Example usage:
+//
+//	$ curl -H "Content-Type: application/json" -X POST -d '{
+//	      "uris": ["http://google.com/", "http://bad1url.org/login", "http://[::1/"],
+//	      "threatTypes": ["MALWARE", "SOCIAL_ENGINEERING"]
+//	  }' localhost:8080/v1/uris:batchSearch
+//	{
+//	    "results": [{
+//	        "uri": "http://google.com/"
+//	    }, {
+//	        "uri": "http://bad1url.org/login",
+//	        "threatTypes": ["MALWARE"],
+//	        "matches": [{
+//	            "threatType": "MALWARE",
+//	            "pattern": "bad1url.org/",
+//	            "hashPrefix": "1c3e5b0a",
+//	            "source": "api",
+//	            "expireTime": "2023-11-14T22:18:20Z"
+//	        }],
+//	        "expireTime": "2023-11-14T22:18:20Z"
+//	    }, {
+//	        "uri": "http://[::1/",
+//	        "error": "invalid URI"
+//	    }]
+//	}
+//
+// Endpoint: /v1/uris:stream
+//
+// The streaming endpoint avoids the overhead of an HTTP request per URI for
+// clients that look up URIs continuously, such as crawlers. Clients connect
+// with a WebSocket and send a JSON message per URI, with an optional ID. The
+// verdict of each URI is sent back, with the same schema as those of the
+// batch endpoint and the ID of the request, as soon as it is known, so
+// verdicts may arrive out of order. Connections from web pages are only
+// accepted from the same origin or from the origins allowed by -corsOrigins.
+//
+// Example messages:
+//
+//	> {"id": "1", "uri": "http://google.com/"}
+//	> {"id": "2", "uri": "http://bad1url.org/"}
+//	< {"id": "2", "uri": "http://bad1url.org/", "threatTypes": ["MALWARE"],
+//	   "matches": [{"threatType": "MALWARE", "pattern": "bad1url.org/"}]}
+//	< {"id": "1", "uri": "http://google.com/"}
 //
 // Endpoint: /v4/threatMatches:find
 //
-// This is a lightweight implementation of the API v4 threatMatches endpoint.
-// Essentially, it takes in a list of URLs, and returns a list of threat matches
-// for those URLs. Unlike the Web Risk API, it does not require an API key.
+// This is a lightweight implementation of the Safe Browsing API v4
+// threatMatches.find method. It takes in a list of URLs, and returns a list
+// of threat matches for those URLs. Unlike the Web Risk API, it does not
+// require an API key. Every match carries a cacheDuration, the time left until
+// it expires in the local cache, during which clients need not look the URL up
+// again.
+//
+// Like the API, it exchanges binary protobuf messages with the clients sending
+// an application/x-protobuf body, or asking for it with the Accept header.
 //
 // Example usage:
 //
@@ -90,8 +253,7 @@
 //	          "threatEntryTypes": ["URL"],
 //	          "threatEntries": [
 //	              {"url": "google.com"},
-//	              {"url": "bad1url.org"},
-//	              {"url": "bad2url.org"}
+//	              {"url": "bad1url.org"}
 //	          ]
 //	      }
 //	  }' \
@@ -100,49 +262,31 @@
 //	# Receive response from server:
 //	{
 //	    "matches": [{
-//	        "threat":          {"url": "bad1url.org"},
-//	        "platformType":    "ANY_PLATFORM",
-//	        "threatType":      "UNWANTED_SOFTWARE",
-//	        "threatEntryType": "URL"
-//	    }, {
-//	        "threat":          {"url": "bad2url.org"},
-//	        "platformType":    "ANY_PLATFORM",
-//	        "threatType":      "UNWANTED_SOFTWARE",
-//	        "threatEntryType": "URL"
-//	    }, {
-//	        "threat":          {"url": "bad2url.org"},
-//	        "platformType":    "ANY_PLATFORM",
 //	        "threatType":      "MALWARE",
-//	        "threatEntryType": "URL"
+//	        "platformType":    "ANY_PLATFORM",
+//	        "threatEntryType": "URL",
+//	        "threat":          {"url": "bad1url.org"},
+//	        "cacheDuration":   "300s"
 //	    }]
 //	}
 //
-// Endpoint: /v4/threatLists
+// Endpoint: /v5/hashes:search
 //
-// The endpoint returns a list of the threat lists that the wrserver is
-// currently subscribed to. The threats returned by the earlier threatMatches
-// API call may only be one of these types.
+// This is an implementation of the Safe Browsing API v5 hashes.search method,
+// so that clients of the v5 protocol can use wrserver as a local proxy. It
+// takes base64 encoded hash prefixes and returns the full hashes of threats
+// starting with them. Hash prefixes not in the local database are answered
+// locally, as are those searched for recently enough to be cached.
 //
 // Example usage:
 //
-//	# Send request to server:
-//	$ curl -X GET localhost:8080/v4/threatLists
-//
-//	# Receive response from server:
+//	$ curl 'localhost:8080/v5/hashes:search?hashPrefixes=WwuJdQ=='
 //	{
-//	    "threatLists": [{
-//	        "threatType":      "MALWARE"
-//	        "platformType":    "ANY_PLATFORM",
-//	        "threatEntryType": "URL",
-//	    }, {
-//	        "threatType":      "SOCIAL_ENGINEERING",
-//	        "platformType":    "ANY_PLATFORM"
-//	        "threatEntryType": "URL",
-//	    }, {
-//	        "threatType":      "UNWANTED_SOFTWARE"
-//	        "platformType":    "ANY_PLATFORM",
-//	        "threatEntryType": "URL",
-//	    }]
+//	    "fullHashes": [{
+//	        "fullHash": "WwuJdQx48jP+4lxr4y2Sj82AWoxUVcIRDSk1PC9Rf+4=",
+//	        "fullHashDetails": [{"threatType": "MALWARE"}]
+//	    }],
+//	    "cacheDuration": "300s"
 //	}
 //
 // Endpoint: /status
@@ -150,7 +294,17 @@
 // The status endpoint allows a client to obtain some statistical information
 // regarding the health of wrserver. It can be used to determine how many
 // requests were satisfied locally by wrserver alone and how many requests
-// were forwarded to the Web Risk API servers.
+// were forwarded to the Web Risk API servers. The "Server" section reports
+// the open connections and in-flight requests, as well as the progress of
+// draining them once the server is shutting down. If rate limiting is enabled
+// with -rateLimit, the "RateLimit" section reports the number of clients being
+// tracked and of requests allowed and rejected. The "Endpoints" section
+// reports, for every lookup endpoint, histograms of the latency of the
+// requests keyed by the most costly source of their results ("database",
+// "cache" or "api"), and the number of URLs found safe and unsafe. Tenants
+// are counted along with the endpoint they are served by, and streams are only
+// counted in the verdicts. With -dryRun, the "WouldBlock" section counts the
+// requests allowed despite their threats by threat type.
 //
 // Example usage:
 //
@@ -161,15 +315,126 @@
 //	        "QueriesByCache" : 31,
 //	        "QueriesByAPI" : 6,
 //	        "QueriesFail" : 0,
+//	        "CacheMisses" : 9,
+//	        "DatabaseUpdateLag" : 0,
+//	        "DatabaseAge" : 604810212000,
+//	        "DatabaseFileBytes" : 1843203,
+//	        "LastUpdateDuration" : 1203994810,
+//	        "Cache" : {
+//	            "FullHashes" : 2,
+//	            "HashPrefixes" : 5,
+//	            "Expired" : 14
+//	        }
+//	    },
+//	    "Lists" : {
+//	        "MALWARE" : {
+//	            "HashPrefixes" : 98304,
+//	            "MemoryBytes" : 491520,
+//	            "LastAdditions" : 12,
+//	            "LastRemovals" : 7,
+//	            "Additions" : 98321,
+//	            "Removals" : 17,
+//	            "ChecksumFailures" : 0
+//	        },
+//	        ...
+//	    },
+//	    "Server" : {
+//	        "OpenConnections" : 3,
+//	        "ActiveConnections" : 1,
+//	        "IdleConnections" : 2,
+//	        "InFlightRequests" : 1,
+//	        "TotalConnections" : 41,
+//	        "TotalRequests" : 169,
+//	        "Draining" : false,
+//	        "Drained" : false,
+//	        "DrainSeconds" : 0
+//	    },
+//	    "RateLimit" : {
+//	        "Clients" : 4,
+//	        "Allowed" : 169,
+//	        "Rejected" : 12
+//	    },
+//	    "Endpoints" : {
+//	        "/v1/uris:search" : {
+//	            "Latency" : {
+//	                "database" : {
+//	                    "Bounds" : [0.0005, 0.001, ..., 10],
+//	                    "Counts" : [120, 9, ..., 0],
+//	                    "Count" : 132,
+//	                    "SumSeconds" : 0.061
+//	                },
+//	                ...
+//	            },
+//	            "Verdicts" : {
+//	                "safe" : 165,
+//	                "unsafe" : 4
+//	            }
+//	        }
 //	    },
 //	    "Error" : ""
 //	}
 //
+// Endpoint: /healthz, /readyz
+//
+// The health endpoints are meant for liveness and readiness probes. /healthz
+// always succeeds while the server is running. /readyz responds with status
+// 503 until the local database has been synced with the Web Risk API, while
+// the database is in an error state, and once the server is shutting down, so
+// that no traffic is routed to an instance that would report every URL as
+// safe. With -maxStaleness, it also fails if the database was last synced
+// longer ago than that.
+//
+// Once the updates of a threat list failed 3 consecutive times, as set with
+// -alertFailures, or the database is older than -alertAge, an update alert is
+// logged with the errors of the failing lists, and emitted as an alert event.
+// Another one is logged and emitted once the updates recover. The number of
+// alerts raised is reported by /status as UpdateAlerts.
+//
+// Until the database is first synced, lookups are answered according to
+// -warmUp: with 503 Service Unavailable and a Retry-After header by default,
+// as safe with -warmUp=safe, or by querying the Web Risk API for every URL
+// expression with -warmUp=live.
+//
+// With -warmCache=/etc/wrserver/popular.txt, the URLs of that file, one per
+// line, are looked up once the database is synced, so that the cache holds
+// the verdicts of the popular URLs before they are requested. /readyz fails
+// until they were, for up to 5 minutes.
+//
+// Example usage:
+//
+//	$ curl -i localhost:8080/readyz
+//	HTTP/1.1 503 Service Unavailable
+//	Content-Type: text/plain; charset=utf-8
+//
+//	not ready: no database loaded
+//
 // Endpoint: /r
 //
 // The redirector endpoint allows a client to pass in a query URL.
 // If the URL is safe, the client is automatically redirected to the target.
 // If the URL is unsafe, then an interstitial warning page is shown instead.
+// The templates and assets of the warning page can be overridden with files of
+// the same name in the directory given with -templateDir, for instance to add
+// branding, contact links and policy text. With -translationsDir, the page is
+// shown in the language that best matches the Accept-Language header of the
+// request among the translations provided, and in English otherwise.
+//
+// Only absolute HTTP and HTTPS URLs without credentials are redirected to,
+// and others are answered with 400 Bad Request. With -redirectKey, the URL must
+// also be signed in the sig parameter, with the base64url encoded HMAC-SHA256
+// of the URL with the key, or is answered with 403 Forbidden, so that the
+// redirector only serves the links generated by applications holding the key
+// rather than being an open redirector. Without -redirectKey, the redirector
+// never redirects to safe URLs: they are answered with 403 Forbidden, and only
+// the warning page of unsafe URLs is shown. Rejected targets are logged.
+//
+// With -bypassKey, the warning page links to the URL through the redirector
+// with a token signed with the key, allowing users to proceed to the URL once
+// within -bypassTTL. Each bypass is logged with the client and the threats of
+// the URL. Tokens are bound to their URL and remembered as redeemed by the
+// instance that served them only, so replicas behind a load balancer may each
+// accept a token once. Custom templates must show {{.BypassURL}} to offer the
+// link.
 //
 // Example usage:
 //
@@ -185,26 +450,280 @@
 //
 //	<!-- Warning interstitial page shown -->
 //	...
+//
+// Endpoint: /admin/cache:export, /admin/cache:import
+//
+// The cache endpoints export a snapshot of the unexpired lookup cache entries
+// and merge such a snapshot into the cache of another instance, so that newly
+// started replicas can be warmed up from a peer.
+//
+// Example usage:
+//
+//	$ curl -H "Authorization: Bearer $ADMIN_TOKEN" \
+//	  -o wrcache.gob.gz localhost:8080/admin/cache:export
+//
+//	$ curl -H "Authorization: Bearer $ADMIN_TOKEN" \
+//	  --data-binary @wrcache.gob.gz localhost:8081/admin/cache:import
+//
+// Endpoint: /admin/cache:purge
+//
+// The purge endpoint removes all entries from the lookup cache, for instance
+// if it holds stale results, without restarting the server. Lookups of URLs
+// matching the local database then query the Web Risk API again.
+//
+// Example usage:
+//
+//	$ curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/cache:purge
+//	{"PurgedEntries":1532}
+//
+// Endpoint: /admin/database:export
+//
+// The database endpoint downloads a snapshot of the local database, in the
+// format of the -db file, holding the hash prefixes, version token and
+// checksum of every threat list. Replicas can be bootstrapped from it instead
+// of each downloading the threat lists in full from the Web Risk API. The
+// snapshot carries an ETag, so that replicas polling it with If-None-Match
+// only download it again once it changed. It responds with status 503 until
+// the threat lists are synced.
+//
+// Example usage:
+//
+//	$ curl -H "Authorization: Bearer $ADMIN_TOKEN" \
+//	  -o wrdb localhost:8080/admin/database:export
+//
+// Replicas started with -snapshotURL seed their database from such a snapshot
+// when it cannot be loaded from -db, and then only download diffs from the
+// Web Risk API:
+//
+//	$ wrserver -apikey=... -snapshotURL=http://primary:8080/admin/database:export \
+//	  -snapshotToken=$ADMIN_TOKEN
+//
+// With -updateOnly, wrserver serves no endpoint and only runs the updater of
+// the threat lists, writing them to -db. This allows a single instance of a
+// cluster to spend quota on updates, while the others load its database file:
+//
+//	$ wrserver -apikey=... -updateOnly -db=/shared/wrdb
+//
+// With -readOnly, wrserver never requests updates of the threat lists from
+// the Web Risk API, and serves lookups from the -db file instead. The file is
+// checked every -reloadPeriod and swapped in whenever it changed, either as
+// written by a wrserver run with -updateOnly or replaced by other means, such
+// as a copy from a bucket. A file that cannot be read, such as one partially
+// copied, is ignored until the next check:
+//
+//	$ wrserver -apikey=... -readOnly -db=/shared/wrdb -reloadPeriod=30s
+//
+// Endpoint: /admin/update
+//
+// The update endpoint triggers an immediate update of the local database
+// instead of waiting for the next scheduled one. It responds with status 429
+// if the Web Risk API requested to wait longer before the next update.
+//
+// Example usage:
+//
+//	$ curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/update
+//
+// Endpoint: /admin/testThreats
+//
+// With -testThreats, the test threats endpoint injects harmless URLs, such as
+// under the reserved .test top level domain, that lookups then report unsafe
+// along with the URLs under them, so that end-to-end pipelines can verify
+// their handling of unsafe URLs. They are kept in memory only. GET lists
+// them, POST adds those of a JSON array and DELETE removes them all. The flag
+// is meant for test and staging deployments only.
+//
+// Example usage:
+//
+//	$ curl -X POST -H "Authorization: Bearer $ADMIN_TOKEN" \
+//	  -d '[{"url":"http://malware.test/","threatType":"MALWARE"}]' \
+//	  localhost:8080/admin/testThreats
+//
+//	$ curl 'localhost:8080/v1/uris:search?uri=http://malware.test/download&threatTypes=MALWARE'
+//
+// Endpoint: /admin/stats, /admin/config
+//
+// The stats endpoint reports the same statistics as the status endpoint, and
+// in the "Runtime" section the uptime, goroutines and memory usage of the
+// process. The config endpoint reports the effective value of every setting,
+// keyed by flag name like the config file, with the API key and the admin
+// token redacted.
+//
+// Example usage:
+//
+//	$ curl -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8080/admin/config
+//	{
+//	    "adminToken": "REDACTED",
+//	    "apikey": "REDACTED",
+//	    "db": "/var/lib/wrserver/webrisk.db",
+//	    "threatTypes": "ALL",
+//	    "updatePeriod": "30m0s",
+//	    ...
+//	}
+//
+// On SIGTERM or an interrupt, the wrserver stops accepting connections and
+// waits for the requests in flight to finish for up to 5 seconds, as set with
+// -drainTimeout, before closing the remaining connections.
+//
+// The body of lookup requests is limited to 1 MiB and serving them to 30
+// seconds, as set with -maxRequestBytes and -requestTimeout. Larger requests
+// are answered with 413 Request Entity Too Large, and slower ones with 503
+// Service Unavailable.
+//
+// Lookup responses of at least 1 KiB, as set with -gzipMinBytes, are
+// compressed with gzip for clients sending "Accept-Encoding: gzip".
+//
+// With -sharedCache=redis://host:6379 or -sharedCache=memcached://host:11211,
+// the cache of the results of hash lookups is kept in Redis or memcached, and
+// shared with the other servers using the same cache server, instead of in
+// memory.
+//
+// With -tenants=/etc/wrserver/tenants.json, the wrserver serves several
+// tenants, each with its own API key, threat types, database and bearer
+// tokens. The endpoints of a tenant are served under /t/ followed by its
+// name, such as /t/payments/v1/uris:search, and for requests with one of its
+// tokens.
+//
+// With -accessLog=/var/log/wrserver/access.log, every request is logged to that
+// file in the Combined Log Format, or as set with -accessLogFormat, instead of
+// with the application logs. The file is rotated by size and by age, as set
+// with -accessLogMaxSize and -accessLogMaxAge.
+//
+// With -auditLog=/var/log/wrserver/audit.log, the verdict of every URL looked
+// up is appended to that file as a line of JSON, with its time, its threat
+// types and the endpoint and tenant of the lookup. URLs are only identified by
+// the first -auditPrefixBytes bytes of their SHA-256, and clients not at all,
+// so that the audit trail does not record browsing history. Records are
+// removed once they are -auditRetention old, 30 days by default:
+//
+//	{"time": "2023-11-14T22:13:20Z", "hashPrefix": "baaf468e", "verdict": "unsafe",
+//	 "threatTypes": ["MALWARE"], "endpoint": "/r"}
+//
+// With -otlpEndpoint=http://localhost:4318, requests are traced and their
+// spans, along with those of the calls to the Web Risk API they required, are
+// exported to that OpenTelemetry collector over OTLP/HTTP. Requests carrying a
+// W3C traceparent header are traced as part of the trace of their client,
+// whose sampling decision is honored, while traces started by wrserver are
+// sampled with -traceSampleRatio.
+//
+// With -pprofAddr=localhost:6060, the net/http/pprof profiling endpoints are
+// served under /debug/pprof/ on a separate listener at that address, for
+// instance to take CPU profiles with:
+//
+//	$ go tool pprof http://localhost:6060/debug/pprof/profile?seconds=30
+//
+// With -icapAddr=localhost:1344, an ICAP (RFC 3507) REQMOD service is served
+// on a separate listener at that address, so that proxies such as Squid can
+// have the URLs they are asked for checked. Requests for unsafe URLs are
+// answered with the interstitial page of their threat, with 403 Forbidden.
+//
+// With -grpcAddr=localhost:9443, the lookups are also served over gRPC on a
+// separate listener at that address, over TLS with -tlsCert and -tlsKey, or
+// otherwise over cleartext HTTP/2. The SearchUris and SearchHashes methods of
+// the google.cloud.webrisk.v1.WebRiskService service are served, so that the
+// gRPC clients of the Web Risk API can be pointed at wrserver, as well as a
+// method streaming the lookups of URIs, whose responses are sent in the order
+// of the requests:
+//
+//	service LookupService {
+//	  rpc StreamSearchUris(stream google.cloud.webrisk.v1.SearchUrisRequest)
+//	      returns (stream google.cloud.webrisk.v1.SearchUrisResponse);
+//	}
+//
+// The package of LookupService is wrserver.v1. Calls are limited like the
+// HTTP lookups: by -rateLimit, by -maxRequestBytes and -requestTimeout for
+// unary calls, by -maxBatchSize for the URIs of a stream, and by the
+// -expressionLimits of their method path. Their errors are reported with gRPC
+// status codes, such as RESOURCE_EXHAUSTED for rate limited clients. Tenants
+// are selected by the /t/ prefix of the method path or by the tokens given in
+// the authorization metadata. Deadlines set by clients bound the lookups.
+// Request messages may be compressed with gzip, and responses are not
+// compressed. Server reflection is not served, so clients need the
+// definitions of the methods.
+//
+// Events are emitted to the destinations configured by the flags below: a
+// detection event whenever a lookup finds a URL unsafe, an update event
+// whenever the threat lists were updated, an error event whenever an update
+// failed, and an alert event whenever an update alert was raised or resolved.
+// Only the types of -eventTypes are emitted, detections by default. Detections hold the threat types of the URL and, as labels, the
+// client, the endpoint and the tenant of the lookup. The "Events" section of
+// /status counts the events sent, failed and dropped by each destination:
+//
+//	{"type": "detection", "time": "2023-11-14T22:13:20Z",
+//	 "urlHash": "baaf468e1d11d72c83fd6989c9a09cd119ef61f05486201eb0f459939c34771c",
+//	 "threatTypes": ["MALWARE"], "labels": {"client": "192.0.2.1", "endpoint": "/r"}}
+//
+// With -eventLog, every event is appended as a line to that file, and with
+// -eventSyslog, written to the local syslog daemon. The URL is identified by
+// the hex encoded SHA-256 of its text, or given in full with
+// -eventPrivacy=url.
+//
+// With -webhookURLs, every event is posted to every webhook, identifying URLs
+// as set by -webhookPrivacy. With -webhookSecret, the body is signed in the
+// X-Webrisk-Signature header as "sha256=" followed by its hex encoded
+// HMAC-SHA256. Failed deliveries are retried with exponential backoff. Every
+// webhook has its own queue of -webhookQueue events, and events are dropped
+// once it is full rather than slowing down lookups.
+//
+// With -pubsubTopic, every event is published to a Cloud Pub/Sub topic, for
+// instance to be streamed into BigQuery, identifying URLs as set by
+// -pubsubPrivacy. Events are published in batches of up to -pubsubBatchSize
+// at least every -pubsubBatchDelay, with the name of the tenant of the lookup,
+// or "default", as ordering key, and with their type, threat types and labels
+// as attributes. Requests are authenticated as the service account of the
+// instance, or with the token in -pubsubAccessTokenFile, and are sent to the
+// emulator at PUBSUB_EMULATOR_HOST if set. Events are dropped once
+// -pubsubQueue is full:
+//
+//	$ wrserver -apikey=... -pubsubTopic=projects/my-project/topics/webrisk-detections
+//
+// With -dryRun, the unsafe URLs requested through /r and the ICAP service are
+// allowed rather than blocked. Each of them is logged with the client and its
+// threats, and counted by threat type in the "WouldBlock" section of /status,
+// so that the impact of enforcement can be measured before turning it on. The
+// lookup endpoints are not affected, and report the threats of URLs as usual.
+//
+// With -submitProject and -submitToken, suspected phishing and malware URLs
+// reported by internal tools are forwarded to the Web Risk Submission API, so
+// that its credentials are held by the wrserver alone:
+//
+//	$ curl -H "Authorization: Bearer $SUBMIT_TOKEN" \
+//	    -d '{"uri": "http://phish.example/login"}' localhost:8080/v1/uris:submit
+//	{"operation": "projects/123456789/operations/abcdef"}
+//
+// The optional "abuseType" is SOCIAL_ENGINEERING by default. A URI submitted
+// again within -submitDedupWindow is not forwarded again, and the operation of
+// its first submission is returned with "duplicate": true. Every submission is
+// recorded in the -submitAuditLog file, or in the application logs.
+//
+// On SIGHUP, the wrserver reads the environment and the config file again and
+// applies changes of the API key, the admin token, the lookup limits, the CORS
+// settings and the interstitial templates and translations, without dropping
+// connections or discarding the local database. Other settings, such as the
+// threat lists, require a restart.
 package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io/ioutil"
-	"log"
+	"mime"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"github.com/rakyll/statik/fs"
 	_ "github.com/google/webrisk/cmd/wrserver/statik"
 	pb "github.com/google/webrisk/internal/webrisk_proto"
@@ -212,9 +731,10 @@ import (
 )
 
 const (
-	statusPath     = "/status"
-	findThreatPath = "/v1/uris:search"
-	redirectPath   = "/r"
+	statusPath       = "/status"
+	findThreatPath   = "/v1/uris:search"
+	searchHashesPath = "/v1/hashes:search"
+	redirectPath     = "/r"
 )
 
 const (
@@ -224,14 +744,116 @@ const (
 
 var (
 	apiKeyFlag             = flag.String("apikey", os.Getenv("APIKEY"), "specify your Web Risk API key")
-	srvAddrFlag            = flag.String("srvaddr", "0.0.0.0:8080", "TCP network address the HTTP server should use")
+	srvAddrFlag            = flag.String("srvaddr", "0.0.0.0:8080", "comma separated network addresses the HTTP server should use: TCP addresses, optionally prefixed with tcp4:// or tcp6:// to restrict the address family, or unix:// followed by the path of a Unix domain socket")
+	adminAddrFlag          = flag.String("adminAddr", "", "comma separated network addresses, in the format of -srvaddr, serving the admin endpoints instead of -srvaddr, such as localhost:9090")
+	trustedProxiesFlag     = flag.String("trustedProxies", "", "comma separated IP addresses and CIDR ranges of the reverse proxies whose X-Forwarded-For and X-Real-IP headers identify clients, and unix for those connecting over a Unix domain socket; the headers are ignored if empty")
+	socketModeFlag         = flag.String("socketMode", "0660", "octal file mode of the Unix domain socket given with -srvaddr")
 	proxyFlag              = flag.String("proxy", "", "proxy to use to connect to the HTTP server")
+	configFlag             = flag.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a JSON config file setting any of these flags by name")
 	databaseFlag           = flag.String("db", "", "path to the Web Risk database.")
+	updateOnlyFlag         = flag.Bool("updateOnly", false, "only run the updater of the threat lists, writing them to -db for other replicas, without serving any endpoint but -pprofAddr")
+	readOnlyFlag           = flag.Bool("readOnly", false, "serve lookups from the -db file kept up to date by another process, such as a wrserver run with -updateOnly, reloading it whenever it changes instead of requesting updates from the Web Risk API")
+	reloadPeriodFlag       = flag.Duration("reloadPeriod", webrisk.DefaultReloadPeriod, "how often the -db file is checked for changes with -readOnly")
+	snapshotURLFlag        = flag.String("snapshotURL", "", "URL of a database snapshot, such as the /admin/database:export endpoint of another wrserver or a gs:// object, seeding the database at startup if it cannot be loaded from -db")
+	snapshotTokenFlag      = flag.String("snapshotToken", os.Getenv("SNAPSHOT_TOKEN"), "bearer token sent when downloading -snapshotURL, such as the -adminToken of the wrserver serving it")
+	updatePeriodFlag       = flag.Duration("updatePeriod", webrisk.DefaultUpdatePeriod, "how often to update the local database")
+	cacheRefreshAheadFlag  = flag.Duration("cacheRefreshAhead", 0, "refresh the cached threats of hot hash prefixes in the background when they expire within this duration, such as 1m; disabled if zero")
+	serveStaleFlag         = flag.Duration("serveStale", 0, "how long after they expired cached verdicts may still be served when the Web Risk API fails, such as 1h; lookups fail instead if zero")
+	cacheRefreshHitsFlag   = flag.Int("cacheRefreshMinHits", webrisk.DefaultCacheRefreshMinHits, "number of cache hits within an update period after which a hash prefix is refreshed with -cacheRefreshAhead")
 	threatTypesFlag        = flag.String("threatTypes", "ALL", "threat types to check against")
 	maxDiffEntriesFlag     = flag.Int("maxDiffEntries", 0, "maximum number of diff entries to return from a ComputeThreatListDiff request")
 	maxDatabaseEntriesFlag = flag.Int("maxDatabaseEntries", 0, "maximum number of database entries to be stored in the local database")
+	listConstraintsFlag    = flag.String("listConstraints", "", "per threat list overrides of maxDiffEntries and maxDatabaseEntries")
+	maxHostComponentsFlag  = flag.Int("maxHostComponents", 0, "maximum number of trailing host components of the host suffixes looked up for every URL; 0 for the default of 7")
+	maxPathComponentsFlag  = flag.Int("maxPathComponents", 0, "maximum number of leading path components of the path prefixes looked up for every URL; 0 for the default of 4")
+	schemePolicyFlag       = flag.String("schemePolicy", "lookup", "policy for the URLs whose scheme is neither http nor https: lookup them like http URLs, skip them as unsupported, error to reject them, or normalize them to the web URL they wrap, such as the target of view-source: and intent: URLs, skipping the others")
+	skipPrivateHostsFlag   = flag.Bool("skipPrivateHosts", false, "skip the lookups of URLs whose host is a loopback, private, link-local or unspecified IP address, or localhost, reporting them as skipped")
+	internalSuffixesFlag   = flag.String("internalHostSuffixes", "", "comma separated host suffixes, such as corp.example.com, of internal hosts whose URLs are skipped like with -skipPrivateHosts")
+	expressionLimitsFlag   = flag.String("expressionLimits", "", "path to a JSON file with URL expression limits per endpoint")
+	adminTokenFlag         = flag.String("adminToken", os.Getenv("ADMIN_TOKEN"), "bearer token required by the admin endpoints; they are disabled if empty")
+	adminAllowFlag         = flag.String("adminAllow", "", "comma separated IP addresses and CIDR ranges of the clients allowed to reach the admin endpoints, /status and the -pprofAddr endpoints, and unix for those connecting over a Unix domain socket; any client is allowed if empty")
+	tlsCertFlag            = flag.String("tlsCert", "", "path to a PEM encoded TLS certificate; if set with -tlsKey, the server serves HTTPS")
+	tlsKeyFlag             = flag.String("tlsKey", "", "path to the PEM encoded private key of the -tlsCert certificate")
+	logFormatFlag          = flag.String("logFormat", logFormatText, "format of the logs: text, or json for structured logs including access logs")
+	warmUpFlag             = flag.String("warmUp", warmUpUnavailable, "how lookups are answered until the threat lists are first synced: unavailable for 503 Service Unavailable with Retry-After, safe to report every URL as safe, or live to look up URLs with the Web Risk API alone")
+	warmCacheFlag          = flag.String("warmCache", "", "path to a file of popular URLs, one per line, looked up at startup to populate the cache before /readyz succeeds; disabled if empty")
+	maxStalenessFlag       = flag.Duration("maxStaleness", 0, "maximum age of the database for /readyz to succeed; 0 only fails on database errors")
+	alertFailuresFlag      = flag.Int("alertFailures", webrisk.DefaultUpdateAlertFailures, "number of consecutive failed updates of a threat list after which an update alert is logged and emitted as an alert event")
+	alertAgeFlag           = flag.Duration("alertAge", 0, "age of the database after which an update alert is logged and emitted as an alert event; disabled if 0")
+	rateLimitFlag          = flag.Float64("rateLimit", 0, "maximum sustained rate of lookup requests per second per client; 0 disables rate limiting")
+	rateBurstFlag          = flag.Int("rateBurst", 0, "maximum burst of lookup requests per client; defaults to -rateLimit rounded up")
+	rateLimitKeyFlag       = flag.String("rateLimitKey", rateLimitByIP, "how clients are identified for rate limiting: ip, or token for the bearer token of the Authorization header")
+	maxBatchSizeFlag       = flag.Int("maxBatchSize", 500, "maximum number of URIs looked up by a single /v1/uris:batchSearch request or gRPC stream")
+	corsOriginsFlag        = flag.String("corsOrigins", "", "comma separated origins allowed to call the lookup endpoints from the browser, or * for any; CORS is disabled if empty")
+	corsHeadersFlag        = flag.String("corsHeaders", "Content-Type,Authorization", "comma separated request headers allowed in cross-origin requests")
+	corsMaxAgeFlag         = flag.Duration("corsMaxAge", 10*time.Minute, "how long browsers may cache the result of CORS preflight requests")
+	templateDirFlag        = flag.String("templateDir", "", "directory of interstitial templates and assets overriding the built-in ones of the same name")
+	testThreatsFlag        = flag.Bool("testThreats", false, "enable the /admin/testThreats endpoint injecting test URLs reported unsafe by lookups, for test deployments only")
+	dryRunFlag             = flag.Bool("dryRun", false, "allow the unsafe URLs requested through /r and -icapAddr instead of blocking them, only logging them and counting them in /status, to measure the impact of enforcement")
+	redirectKeyFlag        = flag.String("redirectKey", os.Getenv("REDIRECT_KEY"), "secret key with which the URLs redirected to by /r must be signed in its sig parameter; if empty, /r only shows the warning page of unsafe URLs and rejects safe ones")
+	bypassKeyFlag          = flag.String("bypassKey", os.Getenv("BYPASS_KEY"), "secret key signing the tokens of the links of the interstitial page allowing users to proceed once to the URL; the links are not offered if empty")
+	bypassTTLFlag          = flag.Duration("bypassTTL", 10*time.Minute, "how long the -bypassKey links of an interstitial page can be followed")
+	translationsDirFlag    = flag.String("translationsDir", "", "directory of interstitial templates translated to other languages, with a subdirectory per language tag")
+	accessLogFlag          = flag.String("accessLog", "", "path of a file to write the access log to, separately from the application logs")
+	accessLogFormatFlag    = flag.String("accessLogFormat", accessLogCombined, "format of the -accessLog file: common, combined or json")
+	accessLogMaxSizeFlag   = flag.Int("accessLogMaxSize", 100, "size in megabytes at which the -accessLog file is rotated; 0 disables rotation by size")
+	accessLogMaxAgeFlag    = flag.Duration("accessLogMaxAge", 24*time.Hour, "age at which the -accessLog file is rotated; 0 disables rotation by age")
+	accessLogBackupsFlag   = flag.Int("accessLogBackups", 7, "number of rotated -accessLog files to keep; 0 keeps all of them")
+	auditLogFlag           = flag.String("auditLog", "", "path of a file to which the verdict of every lookup is appended as a line of JSON, identifying URLs by a hash prefix only; disabled if empty")
+	auditRetentionFlag     = flag.Duration("auditRetention", 30*24*time.Hour, "how long the records of the -auditLog are kept")
+	auditPrefixBytesFlag   = flag.Int("auditPrefixBytes", 4, "length in bytes of the prefixes of the SHA-256 of URLs identifying them in the -auditLog")
+	maxRequestBytesFlag    = flag.Int64("maxRequestBytes", 1<<20, "maximum size in bytes of the body of lookup requests; 0 disables the limit")
+	requestTimeoutFlag     = flag.Duration("requestTimeout", 30*time.Second, "maximum time to serve a lookup request before answering 503 Service Unavailable; 0 disables the timeout")
+	gzipMinBytesFlag       = flag.Int("gzipMinBytes", 1024, "minimum size in bytes of the lookup responses compressed with gzip for clients accepting it; 0 disables compression")
+	readHeaderTimeoutFlag  = flag.Duration("readHeaderTimeout", 10*time.Second, "maximum time to read the headers of a request; 0 disables the timeout")
+	sharedCacheFlag        = flag.String("sharedCache", "", "URL of a cache of hash lookups shared by a fleet of servers: redis://[:password@]host[:port][/db] or memcached://host[:port]")
+	sharedCacheTimeoutFlag = flag.Duration("sharedCacheTimeout", 100*time.Millisecond, "timeout of the requests to the -sharedCache server, after which the Web Risk API is queried instead")
+	tenantsFlag            = flag.String("tenants", "", "path to a JSON file configuring tenants, each with its own API key, threat types, database and tokens")
+	drainTimeoutFlag       = flag.Duration("drainTimeout", 5*time.Second, "how long to wait on shutdown for requests in flight to finish before closing their connections")
+	icapAddrFlag           = flag.String("icapAddr", "", "address of a separate listener serving an ICAP REQMOD service for proxies such as Squid, such as localhost:1344; disabled if empty")
+	grpcAddrFlag           = flag.String("grpcAddr", "", "comma separated addresses of separate listeners serving the lookups over gRPC, such as localhost:9443; disabled if empty")
+	submitProjectFlag      = flag.String("submitProject", "", "Google Cloud project whose Submission API quota is used to forward the URLs reported to /v1/uris:submit; the endpoint is disabled if empty")
+	submitTokenFlag        = flag.String("submitToken", os.Getenv("SUBMIT_TOKEN"), "bearer token required by /v1/uris:submit")
+	submitAccessTokenFlag  = flag.String("submitAccessTokenFile", "", "path to a file holding an OAuth 2.0 access token for the Submission API, read on every submission; by default the token of the service account is fetched from the metadata server")
+	submitRateLimitFlag    = flag.Float64("submitRateLimit", 10, "maximum sustained rate of submissions per minute per client; 0 disables rate limiting")
+	submitDedupWindowFlag  = flag.Duration("submitDedupWindow", 24*time.Hour, "how long a submitted URI is not submitted again")
+	submitAuditLogFlag     = flag.String("submitAuditLog", "", "path of a file to which every submission is appended as a line of JSON; by default submissions are written to the application logs")
+	eventTypesFlag         = flag.String("eventTypes", string(webrisk.EventDetection), "comma separated types of the events emitted to -eventLog, -eventSyslog, -webhookURLs and -pubsubTopic: detection, update, error and alert")
+	eventLogFlag           = flag.String("eventLog", "", "path of a file to which every event is appended as a line of JSON; disabled if empty")
+	eventSyslogFlag        = flag.Bool("eventSyslog", false, "write every event to the local syslog daemon")
+	eventPrivacyFlag       = flag.String("eventPrivacy", privacyHash, "how URLs are identified in the -eventLog and -eventSyslog events: hash for the hex encoded SHA-256 of the URL, or url for the URL in full")
+	webhookURLsFlag        = flag.String("webhookURLs", "", "comma separated URLs to which every event is posted as JSON; disabled if empty")
+	webhookPrivacyFlag     = flag.String("webhookPrivacy", privacyHash, "how URLs are identified in the -webhookURLs events: hash for the hex encoded SHA-256 of the URL, or url for the URL in full")
+	webhookSecretFlag      = flag.String("webhookSecret", os.Getenv("WEBHOOK_SECRET"), "secret key with which the -webhookURLs events are signed in the X-Webrisk-Signature header")
+	webhookQueueFlag       = flag.Int("webhookQueue", 1000, "maximum number of events queued for each of the -webhookURLs, after which new events are dropped")
+	pubsubTopicFlag        = flag.String("pubsubTopic", "", "Pub/Sub topic, as projects/<project>/topics/<topic>, to which every event is published as JSON; disabled if empty")
+	pubsubPrivacyFlag      = flag.String("pubsubPrivacy", privacyHash, "how URLs are identified in the -pubsubTopic events: hash for the hex encoded SHA-256 of the URL, or url for the URL in full")
+	pubsubAccessTokenFlag  = flag.String("pubsubAccessTokenFile", "", "path to a file holding an OAuth 2.0 access token for the Pub/Sub API, read on every publication; by default the token of the service account is fetched from the metadata server")
+	pubsubBatchSizeFlag    = flag.Int("pubsubBatchSize", 100, "maximum number of events published to -pubsubTopic by a single request")
+	pubsubBatchDelayFlag   = flag.Duration("pubsubBatchDelay", time.Second, "maximum time an event waits to be published to -pubsubTopic along with others")
+	pubsubQueueFlag        = flag.Int("pubsubQueue", 10000, "maximum number of events queued for -pubsubTopic, after which new events are dropped")
+	otlpEndpointFlag       = flag.String("otlpEndpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "base URL of an OpenTelemetry collector to which the traces of requests are exported over OTLP/HTTP, such as http://localhost:4318; tracing is disabled if empty")
+	traceSampleRatioFlag   = flag.Float64("traceSampleRatio", 1, "ratio of the traces started by wrserver that are sampled; the traces of requests with a traceparent header are sampled as decided by their client")
+	pprofAddrFlag          = flag.String("pprofAddr", "", "address of a separate listener serving the net/http/pprof profiling endpoints, such as localhost:6060; disabled if empty")
 )
 
+// lookupPaths are the endpoints that look up URLs and thus may be configured
+// with their own URL expression limits.
+var lookupPaths = []string{findThreatPath, batchSearchPath, streamSearchPath, v4FindThreatMatchesPath, redirectPath,
+	grpcSearchUrisPath, grpcStreamSearchUrisPath}
+
+// expressionLimits maps endpoint paths to the URL expression limits used by
+// lookups on that endpoint. Endpoints without an entry use the defaults.
+var expressionLimits map[string]webrisk.ExpressionLimits
+
+// schemePolicy is how lookups treat the URLs whose scheme is neither http nor
+// https, set with -schemePolicy.
+var schemePolicy webrisk.SchemePolicy
+
+// lookupRateLimiter limits the rate of requests of every client to the lookup
+// endpoints. Requests are not limited if it is nil.
+var lookupRateLimiter *rateLimiter
+
 var threatTemplate = map[webrisk.ThreatType]string{
 	webrisk.ThreatTypeMalware:                   "/malware.tmpl",
 	webrisk.ThreatTypeUnwantedSoftware:          "/unwanted.tmpl",
@@ -251,14 +873,54 @@ Web Risk API over the internet.
 
 Usage: %s -apikey=$APIKEY
 
+Every flag may also be set with an environment variable named after it, such
+as WRSERVER_MAX_DIFF_ENTRIES for -maxDiffEntries, or in the JSON config file
+given with -config. Flags take precedence over environment variables, which
+take precedence over the config file. Send SIGHUP to reload the environment
+and the config file.
+
 `
 
-// unmarshal reads pbResp from req. The mime will either be JSON or ProtoBuf.
+// mediaType returns the media type of the Content-Type header value v,
+// without its parameters such as charset.
+func mediaType(v string) string {
+	t, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return v
+	}
+	return t
+}
+
+// acceptedMIME returns the first of JSON or ProtoBuf listed by the Accept
+// header of req, or "" if it lists neither, so that clients of the Safe
+// Browsing API sending binary protobuf bodies can ask for the same back.
+func acceptedMIME(req *http.Request) string {
+	for _, v := range req.Header.Values("Accept") {
+		for _, accepted := range strings.Split(v, ",") {
+			t, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+			if err != nil || params["q"] == "0" {
+				continue
+			}
+			if t == mimeJSON || t == mimeProto {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// unmarshal reads pbReq from req. The mime of the response is given by the alt
+// query parameter, or else by the Accept header, and defaults to the mime of
+// the request body. It will either be JSON or ProtoBuf.
 func unmarshal(req *http.Request, pbReq proto.Message) (string, error) {
 	var mime string
+	contentType := mediaType(req.Header.Get("Content-Type"))
 	alt := req.URL.Query().Get("alt")
 	if alt == "" {
-		alt = req.Header.Get("Content-Type")
+		alt = acceptedMIME(req)
+	}
+	if alt == "" {
+		alt = contentType
 	}
 	switch alt {
 	case "json", mimeJSON:
@@ -269,7 +931,7 @@ func unmarshal(req *http.Request, pbReq proto.Message) (string, error) {
 		return mime, errors.New("invalid interchange format")
 	}
 
-	switch req.Header.Get("Content-Type") {
+	switch contentType {
 	case mimeJSON:
 		body, err := ioutil.ReadAll(req.Body)
 		if err != nil {
@@ -290,43 +952,69 @@ func unmarshal(req *http.Request, pbReq proto.Message) (string, error) {
 	return mime, nil
 }
 
+// unmarshalQuery reads the parameters of a GET request of the Web Risk
+// Lookup API from the query string of req, as the official endpoints do. It
+// returns the mime of the response, which is JSON unless alt=proto is given
+// or the Accept header asks for ProtoBuf, and the threat types given with
+// threatTypes parameters.
+func unmarshalQuery(req *http.Request) (string, []pb.ThreatType, error) {
+	query := req.URL.Query()
+	mime := mimeJSON
+	switch query.Get("alt") {
+	case "":
+		if acceptedMIME(req) == mimeProto {
+			mime = mimeProto
+		}
+	case "json":
+	case "proto":
+		mime = mimeProto
+	default:
+		return mime, nil, errors.New("invalid interchange format")
+	}
+	var tts []pb.ThreatType
+	for _, name := range query["threatTypes"] {
+		tt, err := parseThreatType(name)
+		if err != nil {
+			return mime, nil, err
+		}
+		tts = append(tts, tt)
+	}
+	return mime, tts, nil
+}
+
+// parseThreatType returns the threat type with the given name.
+func parseThreatType(name string) (pb.ThreatType, error) {
+	tt, ok := pb.ThreatType_value[name]
+	if !ok || tt == 0 {
+		return 0, fmt.Errorf("invalid threat type %q", name)
+	}
+	return pb.ThreatType(tt), nil
+}
+
 // marshal writes pbResp into resp. The mime can either be JSON or ProtoBuf.
-func marshal(resp http.ResponseWriter, pbResp proto.Message, mime string) error {
-	resp.Header().Set("Content-Type", mime)
+func marshal(resp http.ResponseWriter, req *http.Request, pbResp proto.Message, mime string) error {
+	var body []byte
+	var err error
 	switch mime {
 	case mimeProto:
-		body, err := proto.Marshal(pbResp)
-		if err != nil {
-			return err
-		}
-		if _, err := resp.Write(body); err != nil {
-			return err
-		}
+		body, err = proto.Marshal(pbResp)
 	case mimeJSON:
-		b, err := protojson.Marshal(pbResp)
-		if err != nil {
-			return err
-		}
-		if _, err := resp.Write(b); err != nil {
-			return err
-		}
+		body, err = protojson.Marshal(pbResp)
 	default:
-		return errors.New("invalid interchange format")
+		err = errors.New("invalid interchange format")
 	}
+	if err != nil {
+		return err
+	}
+	resp.Header().Set("Content-Type", mime)
+	resp.Header().Add("Vary", "Accept")
+	writeCacheable(resp, req, body)
 	return nil
 }
 
 // serveStatus writes a simple JSON with server status information to resp.
 func serveStatus(resp http.ResponseWriter, req *http.Request, sb *webrisk.UpdateClient) {
-	stats, sbErr := sb.Status()
-	errStr := ""
-	if sbErr != nil {
-		errStr = sbErr.Error()
-	}
-	buf, err := json.Marshal(struct {
-		Stats webrisk.Stats
-		Error string
-	}{stats, errStr})
+	buf, err := json.Marshal(newStatusReport(sb))
 	if err != nil {
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
@@ -335,58 +1023,215 @@ func serveStatus(resp http.ResponseWriter, req *http.Request, sb *webrisk.Update
 	resp.Write(buf)
 }
 
-// serveLookups is a light-weight implementation of the "/v4/threatMatches:find"
+// statusReport is the document served by the status endpoint.
+type statusReport struct {
+	Stats      webrisk.Stats
+	Lists      map[string]webrisk.ListStats
+	Server     ServerStats
+	RateLimit  *RateLimitStats              `json:",omitempty"`
+	Events     map[string]webrisk.SinkStats `json:",omitempty"` // Keyed by sink
+	Endpoints  map[string]EndpointStats     `json:",omitempty"` // Keyed by path
+	WouldBlock map[string]int64             `json:",omitempty"` // Requests allowed by -dryRun, keyed by threat type
+	Error      string
+}
+
+// newStatusReport collects the current statistics of sb and of the server.
+func newStatusReport(sb *webrisk.UpdateClient) *statusReport {
+	stats, sbErr := sb.Status()
+	r := &statusReport{Server: connStats.snapshot(), Events: eventStats(), Endpoints: lookupStats.snapshot(), WouldBlock: wouldBlock.snapshot()}
+	if sbErr != nil {
+		r.Error = sbErr.Error()
+	}
+	// Key the threat list statistics by name rather than by number.
+	r.Lists = make(map[string]webrisk.ListStats)
+	for td, ls := range stats.Lists {
+		r.Lists[td.String()] = ls
+	}
+	stats.Lists = nil
+	r.Stats = stats
+	settingsMu.RLock()
+	limiter := lookupRateLimiter
+	settingsMu.RUnlock()
+	if limiter != nil {
+		rl := limiter.snapshot()
+		r.RateLimit = &rl
+	}
+	return r
+}
+
+// serveLookups is a light-weight implementation of the "/v1/uris:search"
 // API endpoint. This allows clients to look up whether a given URL is safe.
 // Unlike the official API, it does not require an API key.
-// It supports both JSON and ProtoBuf.
+// It supports both JSON and ProtoBuf, and both GET requests with query
+// parameters like the official API and POST requests with a request body.
 func serveLookups(resp http.ResponseWriter, req *http.Request, sb *webrisk.UpdateClient) {
-	if req.Method != "POST" {
+	// Decode the request message.
+	pbReq := new(pb.SearchUrisRequest)
+	var mime string
+	var err error
+	switch req.Method {
+	case "GET":
+		mime, pbReq.ThreatTypes, err = unmarshalQuery(req)
+		pbReq.Uri = req.URL.Query().Get("uri")
+	case "POST":
+		mime, err = unmarshal(req, pbReq)
+	default:
 		http.Error(resp, "invalid method", http.StatusBadRequest)
 		return
 	}
-
-	// Decode the request message.
-	pbReq := new(pb.SearchUrisRequest)
-	mime, err := unmarshal(req, pbReq)
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusBadRequest)
+		http.Error(resp, err.Error(), requestErrorCode(err))
 		return
 	}
 
-	// TODO: Should this handler use the information in threatTypes,
-	// platformTypes, and threatEntryTypes?
-
-	// Parse the request message.
+	// Lookup the URL.
 	urls := []string{pbReq.Uri}
+	results, err := sb.LookupURLResults(req.Context(), urls)
+	if err = lookupError(err); err != nil {
+		serveLookupError(resp, err)
+		return
+	}
+	recordLookups(req.Context(), urls, results)
+	pbResp := newSearchUrisResponse(results[0], pbReq.ThreatTypes)
+	setSourceHeader(resp, results)
+	setCacheControl(resp, results[0].ExpireTime, time.Now())
 
-	// Lookup the URL.
-	utss, err := sb.LookupURLsContext(req.Context(), urls)
-	if err != nil {
+	// Encode the response message.
+	if err := marshal(resp, req, pbResp, mime); err != nil {
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
 
-	// Compose the response message.
+// newSearchUrisResponse returns the response message of the lookup of a URI
+// with result r. If tts is not empty, only the threat types in it are
+// reported.
+func newSearchUrisResponse(r webrisk.URLResult, tts []pb.ThreatType) *pb.SearchUrisResponse {
+	wanted := make(map[webrisk.ThreatType]bool)
+	for _, tt := range tts {
+		wanted[webrisk.ThreatType(tt)] = true
+	}
 	pbResp := &pb.SearchUrisResponse{
 		Threat: &pb.SearchUrisResponse_ThreatUri{},
 	}
-	for _, uts := range utss {
-		// Use map to condense duplicate ThreatDescriptor entries.
-		tdm := make(map[webrisk.ThreatType]bool)
-		for _, ut := range uts {
+	// Use map to condense duplicate ThreatDescriptor entries.
+	tdm := make(map[webrisk.ThreatType]bool)
+	for _, ut := range r.Threats {
+		if len(wanted) == 0 || wanted[ut.ThreatType] {
 			tdm[ut.ThreatType] = true
 		}
+	}
+	for td := range tdm {
+		pbResp.Threat.ThreatTypes = append(pbResp.Threat.ThreatTypes, pb.ThreatType(td))
+	}
+	if len(pbResp.Threat.ThreatTypes) > 0 && !r.ExpireTime.IsZero() {
+		pbResp.Threat.ExpireTime = timestamppb.New(r.ExpireTime)
+	}
+	return pbResp
+}
 
-		for td := range tdm {
-			pbResp.Threat.ThreatTypes = append(pbResp.Threat.ThreatTypes, pb.ThreatType(td))
-		}
+// serveSearchHashes is an implementation of the "/v1/hashes:search" API
+// endpoint, answered from the local database and cache whenever possible. The
+// hash prefix is given as a base64 encoded hashPrefix query parameter and the
+// response uses the schema of the official API, so that Web Risk clients that
+// compute URL hashes themselves can use wrserver instead of the API.
+func serveSearchHashes(resp http.ResponseWriter, req *http.Request, hs hashSearcher) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	mime, tts, err := unmarshalQuery(req)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix, err := decodeBase64(req.URL.Query().Get("hashPrefix"))
+	if err != nil || len(prefix) < 4 || len(prefix) > 32 {
+		http.Error(resp, "invalid hashPrefix", http.StatusBadRequest)
+		return
+	}
+	var tds []webrisk.ThreatType
+	for _, tt := range tts {
+		tds = append(tds, webrisk.ThreatType(tt))
 	}
 
-	// Encode the response message.
-	if err := marshal(resp, pbResp, mime); err != nil {
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	threats, nttl, err := hs.SearchHashes(req.Context(), prefix, tds...)
+	if err = lookupError(err); err != nil {
+		serveLookupError(resp, err)
 		return
 	}
+
+	pbResp, expire := newSearchHashesResponse(threats, nttl)
+	setCacheControl(resp, expire, time.Now())
+	if err := marshal(resp, req, pbResp, mime); err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// newSearchHashesResponse returns the response message of the search of a
+// hash prefix which found threats, and matches no other full hash until nttl.
+// It also returns the earliest expiry of the response.
+func newSearchHashesResponse(threats []webrisk.HashThreat, nttl time.Time) (*pb.SearchHashesResponse, time.Time) {
+	pbResp := new(pb.SearchHashesResponse)
+	if !nttl.IsZero() {
+		pbResp.NegativeExpireTime = timestamppb.New(nttl)
+	}
+	expire := nttl
+	for _, ht := range threats {
+		expire = earliest(expire, ht.ExpireTime)
+		th := &pb.SearchHashesResponse_ThreatHash{
+			Hash:       ht.Hash,
+			ExpireTime: timestamppb.New(ht.ExpireTime),
+		}
+		for _, td := range ht.ThreatTypes {
+			th.ThreatTypes = append(th.ThreatTypes, pb.ThreatType(td))
+		}
+		pbResp.Threats = append(pbResp.Threats, th)
+	}
+	return pbResp, expire
+}
+
+// loadExpressionLimits reads the per-endpoint URL expression limits from the
+// JSON file at path. The file maps endpoint paths to limits, for example:
+//
+//	{
+//	    "/r":              {"MaxHostComponents": 7, "MaxPathComponents": 4},
+//	    "/v1/uris:search": {"MaxHostComponents": 3, "MaxPathComponents": 2}
+//	}
+func loadExpressionLimits(path string) (map[string]webrisk.ExpressionLimits, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var limits map[string]webrisk.ExpressionLimits
+	if err := json.Unmarshal(b, &limits); err != nil {
+		return nil, err
+	}
+	for endpoint, l := range limits {
+		known := false
+		for _, p := range lookupPaths {
+			known = known || p == endpoint
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown lookup endpoint %q", endpoint)
+		}
+		if l.MaxHostComponents < 0 || l.MaxPathComponents < 0 {
+			return nil, fmt.Errorf("negative expression limits for endpoint %q", endpoint)
+		}
+	}
+	return limits, nil
+}
+
+// withExpressionLimits wraps h so that URL lookups made while serving path are
+// bounded by the expression limits configured for it, if any.
+func withExpressionLimits(path string, h http.HandlerFunc) http.HandlerFunc {
+	limits, ok := expressionLimits[path]
+	if !ok {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(webrisk.WithExpressionLimits(r.Context(), limits)))
+	}
 }
 
 func parseTemplates(fs http.FileSystem, t *template.Template, paths ...string) (*template.Template, error) {
@@ -408,103 +1253,267 @@ func parseTemplates(fs http.FileSystem, t *template.Template, paths ...string) (
 }
 
 // serveRedirector implements a basic HTTP redirector that will filter out
-// redirect URLs that are unsafe according to the Web Risk API.
-func serveRedirector(resp http.ResponseWriter, req *http.Request, sb *webrisk.UpdateClient, fs http.FileSystem) {
-	rawURL := req.URL.Query().Get("url")
+// redirect URLs that are unsafe according to the Web Risk API. Targets that
+// are not absolute HTTP or HTTPS URLs, or not signed with the -redirectKey if
+// set, are rejected so that it cannot be abused as an open redirector. Without
+// a -redirectKey, safe targets are rejected too, and only the warning page of
+// unsafe ones is shown.
+func serveRedirector(resp http.ResponseWriter, req *http.Request, sb urlLooker, fs http.FileSystem) {
+	query := req.URL.Query()
+	rawURL := query.Get("url")
 	if rawURL == "" || req.URL.Path != "/r" {
 		http.NotFound(resp, req)
 		return
 	}
-	parsedURL, err := url.Parse(rawURL)
+	parsedURL, err := checkRedirect(redirectKey, rawURL, query.Get(redirectSigParam))
 	if err != nil {
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		rejectRedirect(resp, req, rawURL, err)
 		return
 	}
-	threats, err := sb.LookupURLsContext(req.Context(), []string{rawURL})
-	if err != nil {
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	results, err := sb.LookupURLResults(req.Context(), []string{rawURL})
+	if err = lookupError(err); err != nil {
+		serveLookupError(resp, err)
+		return
+	}
+	recordLookups(req.Context(), []string{rawURL}, results)
+	if len(results) == 0 || len(results[0].Threats) == 0 {
+		if redirectKey == nil {
+			rejectRedirect(resp, req, rawURL, errRedirectUnsigned)
+			return
+		}
+		http.Redirect(resp, req, rawURL, http.StatusFound)
 		return
 	}
-	if len(threats[0]) == 0 {
+	if allowDryRun(redirectPath, clientIP(req), rawURL, results[0].Threats) {
+		http.Redirect(resp, req, rawURL, http.StatusFound)
+		return
+	}
+	bypass := interstitialBypass
+	if token := query.Get(bypassParam); token != "" && bypass != nil && bypass.redeem(rawURL, token) {
+		appLog.Infof("Client %s proceeded to %s despite the %s warning", clientIP(req), rawURL,
+			strings.Join(threatTypeNames(results[0].Threats), ","))
+		resp.Header().Set("Cache-Control", "no-store")
 		http.Redirect(resp, req, rawURL, http.StatusFound)
 		return
 	}
 
-	t := template.New("Web Risk Interstitial")
-	for _, threat := range threats[0] {
+	settingsMu.RLock()
+	tr := interstitialTranslations
+	settingsMu.RUnlock()
+	fs, lang := tr.lookup(fs, req.Header.Get("Accept-Language"))
+	for _, threat := range results[0].Threats {
 		if tmpl, ok := threatTemplate[threat.ThreatType]; ok {
-			t, err = parseTemplates(fs, t, tmpl, "/interstitial.html")
+			data := interstitialData(threat, parsedURL, lang)
+			if bypass != nil {
+				q := bypass.params(rawURL)
+				if sig := query.Get(redirectSigParam); sig != "" {
+					q.Set(redirectSigParam, sig)
+				}
+				data["BypassURL"] = "?" + q.Encode()
+			}
+			page, err := renderInterstitial(fs, tmpl, data)
 			if err != nil {
 				http.Error(resp, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			err = t.Execute(resp, map[string]any{
-				"Threat": threat,
-				"Url":    parsedURL})
-			if err != nil {
-				http.Error(resp, err.Error(), http.StatusInternalServerError)
+			resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+			resp.Header().Set("Content-Language", lang.String())
+			if bypass != nil {
+				// The page holds a bypass token, which must not be shared.
+				resp.Header().Set("Cache-Control", "no-store")
 			}
+			resp.Header().Add("Vary", "Accept-Language")
+			resp.Write(page)
 			return
 		}
 	}
 }
 
-// newServer sets up handlers and an http server for status, findThreatMatches,
-// redirect endpoint, and content for the interstitial warning page.
-func newServer(wr *webrisk.UpdateClient, fs http.FileSystem) *http.Server {
+// rejectRedirect logs and answers a request of /r whose target rawURL was
+// rejected with err.
+func rejectRedirect(resp http.ResponseWriter, req *http.Request, rawURL string, err error) {
+	appLog.Infof("Rejected redirect of client %s to %q: %v", clientIP(req), rawURL, err)
+	code := http.StatusBadRequest
+	if errors.Is(err, errRedirectSignature) || errors.Is(err, errRedirectUnsigned) {
+		code = http.StatusForbidden
+	}
+	http.Error(resp, "invalid redirect target: "+err.Error(), code)
+}
+
+// loadTLSConfig loads the certificate and private key at the given paths into
+// a TLS configuration for the server.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a TLS certificate and key must be specified")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// newHandler sets up handlers for status, findThreatMatches, redirect
+// endpoint, and content for the interstitial warning page. The flags and the
+// settings derived from them are read once, so a new handler must be set up
+// for changes to take effect.
+func newHandler(wr *webrisk.UpdateClient, fs http.FileSystem) http.Handler {
 	mux := http.NewServeMux()
+	maxBatchSize, maxStaleness := *maxBatchSizeFlag, *maxStalenessFlag
+	maxRequestBytes, requestTimeout := *maxRequestBytesFlag, *requestTimeoutFlag
+	gzipMinBytes := *gzipMinBytesFlag
 
+	// lookup wraps the handlers of the endpoints used by API clients.
+	lookup := func(h http.HandlerFunc) http.HandlerFunc {
+		return withCompression(gzipMinBytes, withCORS(lookupCORS, withRateLimit(lookupRateLimiter,
+			withRequestLimits(maxRequestBytes, requestTimeout, h))))
+	}
 	mux.HandleFunc(statusPath, func(w http.ResponseWriter, r *http.Request) {
 		serveStatus(w, r, wr)
 	})
-	mux.HandleFunc(findThreatPath, func(w http.ResponseWriter, r *http.Request) {
-		serveLookups(w, r, wr)
+	mux.HandleFunc(batchSearchPath, lookup(withExpressionLimits(batchSearchPath, func(w http.ResponseWriter, r *http.Request) {
+		serveBatchSearch(w, r, wr, maxBatchSize)
+	})))
+	mux.HandleFunc(streamSearchPath, withRateLimit(lookupRateLimiter, withExpressionLimits(streamSearchPath,
+		newStreamSearchHandler(wr, lookupCORS).ServeHTTP)))
+	mux.HandleFunc(searchHashesPath, lookup(func(w http.ResponseWriter, r *http.Request) {
+		serveSearchHashes(w, r, wr)
+	}))
+	mux.HandleFunc(v5SearchHashesPath, lookup(func(w http.ResponseWriter, r *http.Request) {
+		serveV5SearchHashes(w, r, wr, time.Now)
+	}))
+	mux.HandleFunc(v4FindThreatMatchesPath, lookup(withExpressionLimits(v4FindThreatMatchesPath, func(w http.ResponseWriter, r *http.Request) {
+		serveV4FindThreatMatches(w, r, wr, maxBatchSize, time.Now)
+	})))
+	mux.HandleFunc(healthPath, serveHealth)
+	mux.HandleFunc(readyPath, func(w http.ResponseWriter, r *http.Request) {
+		serveReadiness(w, r, wr.Status, maxStaleness)
 	})
-	mux.HandleFunc(redirectPath, func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(findThreatPath, lookup(withExpressionLimits(findThreatPath, func(w http.ResponseWriter, r *http.Request) {
+		serveLookups(w, r, wr)
+	})))
+	mux.HandleFunc(redirectPath, withRateLimit(lookupRateLimiter, withExpressionLimits(redirectPath, func(w http.ResponseWriter, r *http.Request) {
 		serveRedirector(w, r, wr, fs)
-	})
+	})))
 	mux.Handle("/public/", http.StripPrefix("/public/", http.FileServer(fs)))
+	openAPI := newOpenAPIDoc(*adminTokenFlag != "")
+	mux.HandleFunc(openAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		serveOpenAPI(w, r, openAPI)
+	})
+	if submissions != nil {
+		mux.HandleFunc(submitPath, withAdminAuth(*submitTokenFlag, withRateLimit(submissions.limiter, submissions.serveSubmit)))
+	}
+	registerAdminHandlers(mux, wr, *adminTokenFlag)
+	return mux
+}
 
-	return &http.Server{
-		Addr:    *srvAddrFlag,
-		Handler: mux,
+// newServer sets up an http server serving the requests with h.
+func newServer(h http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              *srvAddrFlag,
+		Handler:           withAccessLog(withTracing(serverTracer, h)),
+		ReadHeaderTimeout: *readHeaderTimeoutFlag,
 	}
+	connStats.instrument(srv)
+	return srv
 }
 
 // runServer sets up a listener for interrupts, starts the passed HTTP server, and shuts down
 // gracefully on an interrupt signal. It returns an exit channel that can be used to trigger
 // cleanup and a server down channel that notifies the caller when the server is finished shutting
-// down.
-func runServer(srv *http.Server) (chan os.Signal, <-chan struct{}) {
+// down. On shutdown, the server stops accepting connections and waits up to drainTimeout for the
+// requests in flight to finish, after which the remaining connections are closed.
+func runServer(srv *http.Server, drainTimeout time.Duration) (chan os.Signal, <-chan struct{}) {
+	return runServers([]*http.Server{srv}, drainTimeout)
+}
+
+// runServers is like runServer, but starts and shuts down several HTTP servers together, such as
+// the public and the admin servers. The Addr of every server may list several addresses separated
+// by commas, which are all listened on.
+func runServers(srvs []*http.Server, drainTimeout time.Duration) (chan os.Signal, <-chan struct{}) {
 	// start listening for interrupts
 	exit := make(chan os.Signal, 1)
 	down := make(chan struct{})
 
 	// runs shutdown and cleanup on an exit signal
 	go func() {
+		defer close(down)
 		<-exit
-		fmt.Fprintln(os.Stdout, "\nStarting server shutdown...")
+		appLog.Infof("\nStarting server shutdown, draining for up to %v...", drainTimeout)
 
-		timeout, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		timeout, cancel := context.WithTimeout(context.Background(), drainTimeout)
 		defer cancel()
 
-		srv.SetKeepAlivesEnabled(false)
+		for _, srv := range srvs {
+			srv.SetKeepAlivesEnabled(false)
+		}
+
+		// report drain progress until shutdown completes
+		connStats.startDrain()
+		drained := make(chan struct{})
+		defer close(drained)
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-drained:
+					return
+				case <-ticker.C:
+					st := connStats.snapshot()
+					appLog.Infof("Draining: %d open connections, %d requests in flight",
+						st.OpenConnections, st.InFlightRequests)
+				}
+			}
+		}()
 
-		if err := srv.Shutdown(timeout); err != nil {
-			log.Fatalf("Server error when shutting down: %s", err)
+		var wg sync.WaitGroup
+		for _, srv := range srvs {
+			wg.Add(1)
+			go func(srv *http.Server) {
+				defer wg.Done()
+				if err := srv.Shutdown(timeout); err != nil {
+					st := connStats.snapshot()
+					appLog.Errorf("Drain timeout elapsed, closing %d open connections with %d requests in flight",
+						st.OpenConnections, st.InFlightRequests)
+					srv.Close()
+				}
+			}(srv)
 		}
-		fmt.Fprintln(os.Stdout, "Server shutdown completed.")
+		wg.Wait()
+		connStats.endDrain()
+		st := connStats.snapshot()
+		appLog.Infof("Server shutdown completed: drained in %.3fs, %d open connections, %d requests in flight.",
+			st.DrainSeconds, st.OpenConnections, st.InFlightRequests)
 	}()
 
-	// runs our server until an exit signal is received
-	go func() {
-		fmt.Fprintln(os.Stdout, "Starting server at", srv.Addr)
-		// this blocks our main thread until an interrupt signal
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %s", err)
+	// runs our servers until an exit signal is received
+	for _, srv := range srvs {
+		// Serve sets up a TLSConfig for HTTP/2, so whether to serve TLS is
+		// decided before starting to serve any of the listeners.
+		useTLS := srv.TLSConfig != nil
+		for _, addr := range splitAddrs(srv.Addr) {
+			go func(srv *http.Server, addr string) {
+				appLog.Infof("Starting server at %s", addr)
+				ln, err := listen(addr, socketMode)
+				if err != nil {
+					appLog.Fatalf("Server error: %s", err)
+				}
+				if useTLS {
+					err = srv.ServeTLS(ln, "", "")
+				} else {
+					err = srv.Serve(ln)
+				}
+				// down is closed once shutdown completes, since Serve returns as soon as it starts.
+				if err != nil && err != http.ErrServerClosed {
+					appLog.Fatalf("Server error: %s", err)
+				}
+			}(srv, addr)
 		}
-		close(down)
-	}()
+	}
 
 	return exit, down
 }
@@ -515,33 +1524,271 @@ func main() {
 		flag.PrintDefaults()
 	}
 	flag.Parse()
-	if *apiKeyFlag == "" {
-		fmt.Fprintln(os.Stderr, "No -apikey specified")
+	if err := applyConfig(flag.CommandLine, *configFlag, os.Getenv); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to load configuration:", err)
+		os.Exit(1)
+	}
+	switch *logFormatFlag {
+	case logFormatText:
+	case logFormatJSON:
+		appLog.json = true
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown -logFormat:", *logFormatFlag)
+		os.Exit(1)
+	}
+	var tenantConfigs map[string]tenantConfig
+	if *tenantsFlag != "" {
+		var err error
+		if tenantConfigs, err = loadTenants(*tenantsFlag); err != nil {
+			appLog.Errorf("Unable to load tenants: %v", err)
+			os.Exit(1)
+		}
+	}
+	if *apiKeyFlag == "" && len(tenantConfigs) == 0 {
+		appLog.Errorf("No -apikey specified")
+		os.Exit(1)
+	}
+	if *updateOnlyFlag {
+		if err := checkUpdateOnly(*apiKeyFlag, *databaseFlag, len(tenantConfigs)); err != nil {
+			appLog.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+	if *readOnlyFlag {
+		if err := checkReadOnly(*databaseFlag, *updateOnlyFlag, *snapshotURLFlag); err != nil {
+			appLog.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+	if *accessLogFlag != "" {
+		f, err := openRotatingFile(*accessLogFlag, int64(*accessLogMaxSizeFlag)<<20, *accessLogMaxAgeFlag, *accessLogBackupsFlag)
+		if err != nil {
+			appLog.Errorf("Unable to open access log: %v", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if accessLog, err = newAccessLogger(f, *accessLogFormatFlag); err != nil {
+			appLog.Errorf("Unable to set up access log: %v", err)
+			os.Exit(1)
+		}
+	}
+	if *auditLogFlag != "" {
+		f, period, err := openAuditLog(*auditLogFlag, *auditRetentionFlag)
+		if err != nil {
+			appLog.Errorf("Unable to open audit log: %v", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if lookupAudit, err = newAuditLogger(f, *auditPrefixBytesFlag); err != nil {
+			appLog.Errorf("Unable to set up audit log: %v", err)
+			os.Exit(1)
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go expireAuditLog(f, period, done)
+	}
+	mode, err := strconv.ParseUint(*socketModeFlag, 8, 32)
+	if err != nil || mode > 0777 {
+		appLog.Errorf("Invalid -socketMode: %s", *socketModeFlag)
+		os.Exit(1)
+	}
+	socketMode = os.FileMode(mode)
+	if trustedProxies, err = parseIPSet(*trustedProxiesFlag); err != nil {
+		appLog.Errorf("Invalid -trustedProxies: %v", err)
+		os.Exit(1)
+	}
+	if adminAllowlist, err = parseIPSet(*adminAllowFlag); err != nil {
+		appLog.Errorf("Invalid -adminAllow: %v", err)
+		os.Exit(1)
+	}
+	if schemePolicy, err = webrisk.ParseSchemePolicy(*schemePolicyFlag); err != nil {
+		appLog.Errorf("Invalid -schemePolicy: %v", err)
+		os.Exit(1)
+	}
+	dryRun = *dryRunFlag
+	if *redirectKeyFlag != "" {
+		redirectKey = []byte(*redirectKeyFlag)
+	}
+	if *bypassKeyFlag != "" {
+		if interstitialBypass, err = newBypassSigner(*bypassKeyFlag, *bypassTTLFlag); err != nil {
+			appLog.Errorf("Invalid -bypassTTL: %v", err)
+			os.Exit(1)
+		}
+	}
+	var tlsConfig *tls.Config
+	if *tlsCertFlag != "" || *tlsKeyFlag != "" {
+		var err error
+		tlsConfig, err = loadTLSConfig(*tlsCertFlag, *tlsKeyFlag)
+		if err != nil {
+			appLog.Errorf("Unable to load TLS certificate: %v", err)
+			os.Exit(1)
+		}
+	}
+	if *otlpEndpointFlag != "" {
+		if serverTracer, err = newTracer(*otlpEndpointFlag, *traceSampleRatioFlag); err != nil {
+			appLog.Errorf("Unable to set up tracing: %v", err)
+			os.Exit(1)
+		}
+		go serverTracer.run(5 * time.Second)
+	}
+	if err := newEventSinks(); err != nil {
+		appLog.Errorf("Unable to set up event sinks: %v", err)
+		os.Exit(1)
+	}
+	transport, err := newTracingTransport(serverTracer, *proxyFlag)
+	if err != nil {
+		appLog.Errorf("Invalid -proxy: %v", err)
 		os.Exit(1)
 	}
 	conf := webrisk.Config{
 		APIKey:             *apiKeyFlag,
 		ProxyURL:           *proxyFlag,
 		DBPath:             *databaseFlag,
+		ReadOnlyDB:         *readOnlyFlag,
+		ReloadPeriod:       *reloadPeriodFlag,
+		UpdatePeriod:       *updatePeriodFlag,
 		ThreatListArg:      *threatTypesFlag,
 		MaxDiffEntries:     int32(*maxDiffEntriesFlag),
 		MaxDatabaseEntries: int32(*maxDatabaseEntriesFlag),
-		Logger:             os.Stderr,
+		ListConstraintsArg: *listConstraintsFlag,
+		ExpressionLimits:   webrisk.ExpressionLimits{MaxHostComponents: *maxHostComponentsFlag, MaxPathComponents: *maxPathComponentsFlag},
+		SchemePolicy:       schemePolicy,
+		SkipPrivateHosts:   *skipPrivateHostsFlag,
+		TestThreats:        *testThreatsFlag,
+		CacheRefreshAhead:  *cacheRefreshAheadFlag,
+		SnapshotURL:        *snapshotURLFlag,
+		Transport:          transport,
+		EventSink:          clientEventSink(),
+		Logger:             appLog,
 	}
-	wr, err := webrisk.NewUpdateClient(conf)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Unable to initialize Web Risk client: ", err)
+	conf.CacheRefreshMinHits = *cacheRefreshHitsFlag
+	conf.ServeStale = *serveStaleFlag
+	conf.UpdateAlertFailures = *alertFailuresFlag
+	conf.UpdateAlertAge = *alertAgeFlag
+	conf.OnUpdateAlert = logUpdateAlert
+	if *internalSuffixesFlag != "" {
+		conf.InternalHostSuffixes = strings.Split(*internalSuffixesFlag, ",")
+	}
+	if *snapshotTokenFlag != "" {
+		conf.SnapshotHeader = http.Header{"Authorization": {"Bearer " + *snapshotTokenFlag}}
+	}
+	if err := applyWarmUpPolicy(*warmUpFlag, &conf); err != nil {
+		appLog.Errorf("%v", err)
+		os.Exit(1)
+	}
+	if *sharedCacheFlag != "" {
+		store, err := newCacheStore(*sharedCacheFlag, *sharedCacheTimeoutFlag)
+		if err != nil {
+			appLog.Errorf("Unable to set up the shared cache: %v", err)
+			os.Exit(1)
+		}
+		conf.Cache = webrisk.NewSharedCache(store)
+	}
+	var wr *webrisk.UpdateClient
+	if *apiKeyFlag != "" {
+		if wr, err = webrisk.NewUpdateClient(conf); err != nil {
+			appLog.Errorf("Unable to initialize Web Risk client: %v", err)
+			os.Exit(1)
+		}
+	}
+	if *updateOnlyFlag {
+		if *pprofAddrFlag != "" {
+			go runDebugServer(*pprofAddrFlag)
+		}
+		exit := make(chan os.Signal, 1)
+		signal.Notify(exit, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+		runUpdater(wr, exit)
+		if serverTracer != nil {
+			if err := serverTracer.flush(context.Background()); err != nil {
+				appLog.Errorf("%v", err)
+			}
+		}
+		appLog.Infof("wrserver exiting.")
+		return
+	}
+	if *warmCacheFlag != "" && wr != nil {
+		urls, err := readURLList(*warmCacheFlag)
+		if err != nil {
+			appLog.Errorf("Unable to read the URLs to warm up the cache: %v", err)
+			os.Exit(1)
+		}
+		startCacheWarmUp(wr, urls)
+	}
+	if serverTenants, err = newTenants(tenantConfigs, conf); err != nil {
+		appLog.Errorf("Unable to initialize Web Risk client: %v", err)
 		os.Exit(1)
 	}
 	statikFS, err := fs.New()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Unable to initialize static files: ", err)
+		appLog.Errorf("Unable to initialize static files: %v", err)
 		os.Exit(1)
 	}
+	s, err := loadSettings(statikFS)
+	if err != nil {
+		appLog.Errorf("%v", err)
+		os.Exit(1)
+	}
+	s.apply()
+	if *submitProjectFlag != "" {
+		if submissions, err = newSubmitterFromFlags(); err != nil {
+			appLog.Errorf("Unable to set up submissions: %v", err)
+			os.Exit(1)
+		}
+	}
 
-	srv := newServer(wr, statikFS)
-	exit, down := runServer(srv)
+	handler := new(reloadableHandler)
+	handler.store(newRootHandler(wr, s.publicFS))
+	root := withAllowlist(adminAllowlist, isAdminPath, handler)
+	srvs := []*http.Server{newServer(root)}
+	if *adminAddrFlag != "" {
+		// Only the admin listeners serve the admin endpoints.
+		srvs[0] = newServer(withoutAdminEndpoints(root))
+		admin := newServer(root)
+		admin.Addr = *adminAddrFlag
+		srvs = append(srvs, admin)
+	}
+	if *grpcAddrFlag != "" {
+		grpcRoot = new(reloadableHandler)
+		grpcRoot.store(newGRPCRootHandler(wr))
+		srvs = append(srvs, newGRPCServer(*grpcAddrFlag, grpcRoot))
+	}
+	for _, srv := range srvs {
+		srv.TLSConfig = tlsConfig
+	}
+	if *pprofAddrFlag != "" {
+		go runDebugServer(*pprofAddrFlag)
+	}
+	if *icapAddrFlag != "" {
+		if wr == nil {
+			appLog.Errorf("-icapAddr requires -apikey")
+			os.Exit(1)
+		}
+		icapService = newICAPServer(wr, s.publicFS)
+		go runICAPServer(*icapAddrFlag)
+	}
+	exit, down := runServers(srvs, *drainTimeoutFlag)
 	signal.Notify(exit, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			appLog.Infof("Reloading configuration...")
+			if err := reloadConfig(flag.CommandLine, wr, statikFS, handler); err != nil {
+				appLog.Errorf("Unable to reload configuration, keeping the current one: %v", err)
+				continue
+			}
+			appLog.Infof("Configuration reloaded.")
+		}
+	}()
 	<-down
-	fmt.Fprintln(os.Stdout, "wrserver exiting.")
+	ctx, cancel := context.WithTimeout(context.Background(), *drainTimeoutFlag)
+	closeEventSinks(ctx)
+	cancel()
+	if serverTracer != nil {
+		if err := serverTracer.flush(context.Background()); err != nil {
+			appLog.Errorf("%v", err)
+		}
+	}
+	appLog.Infof("wrserver exiting.")
 }
@@ -14,12 +14,36 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 // Provide an override hostname so that we can run the test within Docker's build step.
@@ -90,7 +114,7 @@ func TestServerShutdown(t *testing.T) {
 	}
 
 	// Start server and wait for it to be ready.
-	exit, down := runServer(testServer)
+	exit, down := runServer(testServer, 5*time.Second)
 	time.Sleep(1 * time.Second)
 
 	// Open a test connection.
@@ -117,3 +141,402 @@ func TestServerShutdown(t *testing.T) {
 		t.Errorf("Server accepted connection when it should be shut down.")
 	}
 }
+
+// fakeSearcher is a hashSearcher answering from a fixed set of full hashes.
+type fakeSearcher struct {
+	threats []webrisk.HashThreat
+	nttl    time.Time
+}
+
+func (f *fakeSearcher) SearchHashes(ctx context.Context, prefix []byte, _ ...webrisk.ThreatType) ([]webrisk.HashThreat, time.Time, error) {
+	var out []webrisk.HashThreat
+	for _, ht := range f.threats {
+		if bytes.HasPrefix(ht.Hash, prefix) {
+			out = append(out, ht)
+		}
+	}
+	return out, f.nttl, nil
+}
+
+func TestUnmarshal(t *testing.T) {
+	protoBody, _ := proto.Marshal(&pb.SearchUrisRequest{Uri: "http://proto.example/"})
+	vectors := []struct {
+		method      string
+		query       string
+		contentType string
+		accept      string
+		body        string
+		mime        string
+		uri         string
+		fail        bool
+	}{
+		{method: "GET", query: "uri=http://a.example/", mime: mimeJSON},
+		{method: "GET", query: "uri=http://a.example/", accept: "text/html, */*", mime: mimeJSON},
+		{method: "GET", query: "uri=http://a.example/", accept: mimeProto, mime: mimeProto},
+		{method: "GET", query: "uri=http://a.example/&alt=json", accept: mimeProto, mime: mimeJSON},
+		{method: "POST", contentType: mimeJSON, body: `{"uri":"http://json.example/"}`, mime: mimeJSON, uri: "http://json.example/"},
+		{method: "POST", contentType: mimeJSON + "; charset=utf-8", body: `{"uri":"http://json.example/"}`, mime: mimeJSON, uri: "http://json.example/"},
+		{method: "POST", contentType: mimeProto, body: string(protoBody), mime: mimeProto, uri: "http://proto.example/"},
+		{method: "POST", contentType: mimeProto, accept: mimeJSON, body: string(protoBody), mime: mimeJSON, uri: "http://proto.example/"},
+		{method: "POST", contentType: mimeJSON, accept: mimeProto + ";q=0, " + mimeJSON, body: `{"uri":"http://json.example/"}`, mime: mimeJSON, uri: "http://json.example/"},
+		{method: "POST", query: "alt=proto", contentType: mimeJSON, accept: mimeJSON, body: `{"uri":"http://json.example/"}`, mime: mimeProto, uri: "http://json.example/"},
+		{method: "POST", contentType: "text/plain", body: "http://a.example/", fail: true},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest(v.method, findThreatPath+"?"+v.query, strings.NewReader(v.body))
+		if v.contentType != "" {
+			req.Header.Set("Content-Type", v.contentType)
+		}
+		if v.accept != "" {
+			req.Header.Set("Accept", v.accept)
+		}
+		var mime string
+		var err error
+		pbReq := new(pb.SearchUrisRequest)
+		if v.method == "GET" {
+			mime, _, err = unmarshalQuery(req)
+		} else {
+			mime, err = unmarshal(req, pbReq)
+		}
+		if gotFail := err != nil; gotFail != v.fail {
+			t.Errorf("test %d, error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		if v.fail {
+			continue
+		}
+		if mime != v.mime {
+			t.Errorf("test %d, mime = %q, want %q", i, mime, v.mime)
+		}
+		if pbReq.Uri != v.uri {
+			t.Errorf("test %d, uri = %q, want %q", i, pbReq.Uri, v.uri)
+		}
+	}
+}
+
+func TestServeSearchHashes(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	fullHash := append([]byte("abcd"), make([]byte, 28)...)
+	hs := &fakeSearcher{
+		threats: []webrisk.HashThreat{{
+			Hash:        fullHash,
+			ThreatTypes: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+			ExpireTime:  now.Add(10 * time.Minute),
+		}},
+		nttl: now.Add(5 * time.Minute),
+	}
+
+	vectors := []struct {
+		query string
+		code  int
+		want  string
+	}{{
+		query: "hashPrefix=YWJjZA==&threatTypes=MALWARE",
+		code:  http.StatusOK,
+		want:  `{"threats":[{"threatTypes":["MALWARE"],"hash":"YWJjZAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","expireTime":"2023-11-14T22:23:20Z"}],"negativeExpireTime":"2023-11-14T22:18:20Z"}`,
+	}, {
+		query: "hashPrefix=d3h5eg==",
+		code:  http.StatusOK,
+		want:  `{"negativeExpireTime":"2023-11-14T22:18:20Z"}`,
+	}, {
+		query: "hashPrefix=YWJjZA==&threatTypes=NOT_A_THREAT",
+		code:  http.StatusBadRequest,
+	}, {
+		query: "hashPrefix=YWJjZA==&alt=xml",
+		code:  http.StatusBadRequest,
+	}, {
+		query: "threatTypes=MALWARE",
+		code:  http.StatusBadRequest,
+	}}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", searchHashesPath+"?"+v.query, nil)
+		serveSearchHashes(rec, req, hs)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		json.Unmarshal([]byte(v.want), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d, response mismatch:\ngot  %s\nwant %s", i, rec.Body.String(), v.want)
+		}
+	}
+}
+
+func TestLoadExpressionLimits(t *testing.T) {
+	vectors := []struct {
+		input  string
+		output map[string]webrisk.ExpressionLimits
+		fail   bool
+	}{{
+		input: `{"/r": {"MaxHostComponents": 7, "MaxPathComponents": 4}, "/v1/uris:search": {"MaxHostComponents": 2}}`,
+		output: map[string]webrisk.ExpressionLimits{
+			redirectPath:   {MaxHostComponents: 7, MaxPathComponents: 4},
+			findThreatPath: {MaxHostComponents: 2},
+		},
+	}, {
+		input:  `{}`,
+		output: map[string]webrisk.ExpressionLimits{},
+	}, {
+		input: `{"/v4/threatMatches:find": {"MaxPathComponents": 3}}`,
+		output: map[string]webrisk.ExpressionLimits{
+			v4FindThreatMatchesPath: {MaxPathComponents: 3},
+		},
+	}, {
+		input: `{"/status": {"MaxHostComponents": 2}}`,
+		fail:  true,
+	}, {
+		input: `{"/r": {"MaxPathComponents": -1}}`,
+		fail:  true,
+	}, {
+		input: `not json`,
+		fail:  true,
+	}}
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("unexpected error on ioutil.TempFile: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	for i, v := range vectors {
+		if err := ioutil.WriteFile(path, []byte(v.input), 0644); err != nil {
+			t.Fatalf("test %d, unexpected write error: %v", i, err)
+		}
+		limits, err := loadExpressionLimits(path)
+		if err != nil != v.fail {
+			t.Errorf("test %d, loadExpressionLimits() error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		if !v.fail && !reflect.DeepEqual(limits, v.output) {
+			t.Errorf("test %d, loadExpressionLimits() = %v, want %v", i, limits, v.output)
+		}
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		cert, key string
+		fail      bool
+	}{
+		{certFile, keyFile, false},
+		{certFile, "", true},
+		{"", keyFile, true},
+		{keyFile, certFile, true},
+		{filepath.Join(dir, "missing.pem"), keyFile, true},
+	}
+
+	for i, v := range vectors {
+		config, err := loadTLSConfig(v.cert, v.key)
+		if err != nil != v.fail {
+			t.Errorf("test %d, loadTLSConfig() error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		if !v.fail && len(config.Certificates) != 1 {
+			t.Errorf("test %d, loadTLSConfig() loaded %d certificates, want 1", i, len(config.Certificates))
+		}
+	}
+}
+
+type fakeLooker struct {
+	threats map[string][]webrisk.URLThreat
+	expire  time.Time
+	err     error // Returned along with the results, if set
+	mu      sync.Mutex
+	urls    []string
+}
+
+func (fl *fakeLooker) LookupURLResults(ctx context.Context, urls []string) ([]webrisk.URLResult, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.urls = append(fl.urls, urls...)
+	results := make([]webrisk.URLResult, len(urls))
+	for i, u := range urls {
+		results[i] = webrisk.URLResult{Threats: fl.threats[u], ExpireTime: fl.expire}
+	}
+	return results, fl.err
+}
+
+func TestServerDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	sock := filepath.Join(t.TempDir(), "wrserver.sock")
+	srv := &http.Server{
+		Addr: unixSocketPrefix + sock,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+	}
+	exit, down := runServer(srv, 100*time.Millisecond)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			for {
+				conn, err := d.DialContext(ctx, "unix", sock)
+				if err == nil || ctx.Err() != nil {
+					return conn, err
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		},
+	}}
+	failed := make(chan error, 1)
+	go func() {
+		_, err := client.Get("http://wrserver/")
+		failed <- err
+	}()
+	closeOrTimeout(t, 1000, started, "Request Received")
+
+	// The request never finishes, so its connection is closed once the
+	// drain timeout elapses.
+	exit <- syscall.SIGTERM
+	closeOrTimeout2(t, 1000, down, "Server Shutting Down")
+	select {
+	case err := <-failed:
+		if err == nil {
+			t.Errorf("request in flight succeeded after the drain timeout")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("request in flight not interrupted after the drain timeout")
+	}
+}
+
+func TestRunServers(t *testing.T) {
+	dir := t.TempDir()
+	sock := func(name string) string { return filepath.Join(dir, name) }
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminStatsPath, func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "stats") })
+	mux.HandleFunc(tenantPathPrefix+"payments"+adminStatsPath, func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "stats") })
+	mux.HandleFunc(healthPath, serveHealth)
+	public := &http.Server{
+		Addr:    unixSocketPrefix + sock("public1.sock") + ", " + unixSocketPrefix + sock("public2.sock"),
+		Handler: withoutAdminEndpoints(mux),
+	}
+	admin := &http.Server{Addr: unixSocketPrefix + sock("admin.sock"), Handler: mux}
+	exit, down := runServers([]*http.Server{public, admin}, time.Second)
+
+	get := func(socket, path string) int {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				for {
+					conn, err := d.DialContext(ctx, "unix", sock(socket))
+					if err == nil || ctx.Err() != nil {
+						return conn, err
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			},
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://wrserver"+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("GET %s on %s, unexpected error: %v", path, socket, err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	vectors := []struct {
+		socket string
+		path   string
+		code   int
+	}{
+		{"public1.sock", healthPath, http.StatusOK},
+		{"public2.sock", healthPath, http.StatusOK},
+		{"public1.sock", adminStatsPath, http.StatusNotFound},
+		{"public2.sock", tenantPathPrefix + "payments" + adminStatsPath, http.StatusNotFound},
+		{"admin.sock", adminStatsPath, http.StatusOK},
+		{"admin.sock", tenantPathPrefix + "payments" + adminStatsPath, http.StatusOK},
+		{"admin.sock", healthPath, http.StatusOK},
+	}
+	for i, v := range vectors {
+		if code := get(v.socket, v.path); code != v.code {
+			t.Errorf("test %d, GET %s on %s = %d, want %d", i, v.path, v.socket, code, v.code)
+		}
+	}
+
+	exit <- syscall.SIGTERM
+	closeOrTimeout2(t, 1000, down, "Server Shutting Down")
+}
+
+// newSyncedClient returns a client whose malware list holds the given sorted
+// 4 byte hash prefixes, synced from a fake Web Risk API.
+func newSyncedClient(t *testing.T, hashes ...string) *webrisk.UpdateClient {
+	t.Helper()
+	raw := strings.Join(hashes, "")
+	sum := sha256.Sum256([]byte(raw))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":computeDiff") {
+			w.Write([]byte("{}"))
+			return
+		}
+		b, _ := protojson.Marshal(&pb.ComputeThreatListDiffResponse{
+			ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+			Additions:       &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(raw)}}},
+			NewVersionToken: []byte("token"),
+			Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: sum[:]},
+		})
+		w.Write(b)
+	}))
+	t.Cleanup(ts.Close)
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "key",
+		ServerURL:    ts.URL,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { wr.Close() })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+	return wr
+}
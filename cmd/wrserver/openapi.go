@@ -0,0 +1,476 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+const openAPIPath = "/openapi.json"
+
+// openAPIDoc is an OpenAPI 3.0 document, restricted to the parts needed to
+// describe the endpoints of wrserver.
+type openAPIDoc struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// openAPIPathItem holds the operations of a path, keyed by lower case method.
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIBody               `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Explode     *bool          `json:"explode,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref,omitempty"`
+	Type        string                    `json:"type,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Enum        []string                  `json:"enum,omitempty"`
+	Items       *openAPISchema            `json:"items,omitempty"`
+	Properties  map[string]*openAPISchema `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type openAPISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+// Helpers to describe schemas and responses concisely.
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func schemaOf(typ, format, description string) *openAPISchema {
+	return &openAPISchema{Type: typ, Format: format, Description: description}
+}
+
+func arrayOf(items *openAPISchema) *openAPISchema {
+	return &openAPISchema{Type: "array", Items: items}
+}
+
+func jsonContent(s *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{mimeJSON: {Schema: s}}
+}
+
+func jsonResponse(description string, s *openAPISchema) openAPIResponse {
+	return openAPIResponse{Description: description, Content: jsonContent(s)}
+}
+
+// threatTypesParameter is the repeated threatTypes query parameter restricting
+// lookups to some threat types.
+func threatTypesParameter() openAPIParameter {
+	explode := true
+	return openAPIParameter{
+		Name:        "threatTypes",
+		In:          "query",
+		Description: "Threat types to look up; all the configured ones if omitted.",
+		Explode:     &explode,
+		Schema:      arrayOf(schemaRef("ThreatType")),
+	}
+}
+
+// openAPISchemas returns the schemas of the messages exchanged with wrserver.
+func openAPISchemas() map[string]*openAPISchema {
+	var threatTypes []string
+	for name, v := range pb.ThreatType_value {
+		if v != 0 {
+			threatTypes = append(threatTypes, name)
+		}
+	}
+	sort.Strings(threatTypes)
+	timestamp := schemaOf("string", "date-time", "")
+
+	return map[string]*openAPISchema{
+		"ThreatType": {Type: "string", Enum: threatTypes},
+		"SearchUrisRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"uri":         schemaOf("string", "", "URI to look up."),
+				"threatTypes": arrayOf(schemaRef("ThreatType")),
+			},
+			Required: []string{"uri"},
+		},
+		"SearchUrisResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"threat": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"threatTypes": arrayOf(schemaRef("ThreatType")),
+						"expireTime":  schemaOf("string", "date-time", "Time until which the match may be cached."),
+					},
+				},
+			},
+		},
+		"SearchHashesResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"threats": arrayOf(&openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"threatTypes": arrayOf(schemaRef("ThreatType")),
+						"hash":        schemaOf("string", "byte", "SHA256 hash of the URL expression."),
+						"expireTime":  timestamp,
+					},
+				}),
+				"negativeExpireTime": schemaOf("string", "date-time", "Time until which hashes with the prefix that are not listed may be considered safe."),
+			},
+		},
+		"BatchSearchRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"uris":        arrayOf(schemaOf("string", "", "")),
+				"threatTypes": arrayOf(schemaRef("ThreatType")),
+			},
+			Required: []string{"uris"},
+		},
+		"BatchSearchResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"results": {Type: "array", Description: "Verdict of every URI, in the order of the request.", Items: schemaRef("UriVerdict")},
+			},
+		},
+		"UriVerdict": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"uri":         schemaOf("string", "", ""),
+				"threatTypes": arrayOf(schemaRef("ThreatType")),
+				"matches": arrayOf(&openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"threatType": schemaRef("ThreatType"),
+						"pattern":    schemaOf("string", "", "URL expression that matched the threat list."),
+					},
+				}),
+				"expireTime": schemaOf("string", "date-time", "Time until which the verdict may be cached."),
+				"error":      schemaOf("string", "", "Reason why the URI could not be looked up."),
+			},
+		},
+		"V5SearchHashesResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"fullHashes": arrayOf(&openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"fullHash": schemaOf("string", "byte", ""),
+						"fullHashDetails": arrayOf(&openAPISchema{
+							Type:       "object",
+							Properties: map[string]*openAPISchema{"threatType": schemaOf("string", "", "")},
+						}),
+					},
+				}),
+				"cacheDuration": schemaOf("string", "", "Duration for which the response may be cached, such as \"300s\"."),
+			},
+		},
+		"V4FindThreatMatchesRequest": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"threatInfo": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"threatTypes":      arrayOf(schemaOf("string", "", "")),
+						"platformTypes":    arrayOf(schemaOf("string", "", "")),
+						"threatEntryTypes": arrayOf(schemaOf("string", "", "")),
+						"threatEntries": arrayOf(&openAPISchema{
+							Type:       "object",
+							Properties: map[string]*openAPISchema{"url": schemaOf("string", "", "")},
+						}),
+					},
+				},
+			},
+		},
+		"V4FindThreatMatchesResponse": {
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"matches": arrayOf(&openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"threatType":      schemaOf("string", "", ""),
+						"platformType":    schemaOf("string", "", ""),
+						"threatEntryType": schemaOf("string", "", ""),
+						"threat": {
+							Type:       "object",
+							Properties: map[string]*openAPISchema{"url": schemaOf("string", "", "")},
+						},
+						"cacheDuration": schemaOf("string", "", "Duration for which the match may be cached, such as \"300s\"."),
+					},
+				}),
+			},
+		},
+		"Status": schemaOf("object", "", "Statistics of the local database, the lookups and the server."),
+	}
+}
+
+// newOpenAPIDoc returns the OpenAPI document describing the endpoints of
+// wrserver. The admin endpoints are only described if admin is true, since
+// they are not served otherwise.
+func newOpenAPIDoc(admin bool) *openAPIDoc {
+	doc := &openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "wrserver",
+			Description: "Web Risk lookups answered from a local database and cache.",
+			Version:     "1.0",
+		},
+		Components: openAPIComponents{Schemas: openAPISchemas()},
+	}
+	alt := openAPIParameter{
+		Name:        "alt",
+		In:          "query",
+		Description: "Interchange format of the response.",
+		Schema:      &openAPISchema{Type: "string", Enum: []string{"json", "proto"}},
+	}
+	uri := openAPIParameter{Name: "uri", In: "query", Required: true, Schema: schemaOf("string", "", "")}
+	searchUris := jsonResponse("Threat types matched by the URI, if any.", schemaRef("SearchUrisResponse"))
+	noContent := map[string]openAPIResponse{"204": {Description: "Done."}}
+
+	doc.Paths = map[string]openAPIPathItem{
+		findThreatPath: {
+			"get": {
+				OperationID: "searchUris",
+				Summary:     "Looks up a URI in the threat lists.",
+				Parameters:  []openAPIParameter{uri, threatTypesParameter(), alt},
+				Responses:   map[string]openAPIResponse{"200": searchUris},
+			},
+			"post": {
+				OperationID: "searchUrisPost",
+				Summary:     "Looks up a URI in the threat lists, given in the request body.",
+				RequestBody: &openAPIBody{Required: true, Content: jsonContent(schemaRef("SearchUrisRequest"))},
+				Responses:   map[string]openAPIResponse{"200": searchUris},
+			},
+		},
+		batchSearchPath: {
+			"post": {
+				OperationID: "batchSearchUris",
+				Summary:     "Looks up many URIs in the threat lists.",
+				RequestBody: &openAPIBody{Required: true, Content: jsonContent(schemaRef("BatchSearchRequest"))},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Verdict of every URI.", schemaRef("BatchSearchResponse")),
+				},
+			},
+		},
+		streamSearchPath: {
+			"get": {
+				OperationID: "streamSearchUris",
+				Summary:     "Opens a WebSocket on which URIs are looked up as they are sent.",
+				Responses:   map[string]openAPIResponse{"101": {Description: "Switched to the WebSocket protocol."}},
+			},
+		},
+		searchHashesPath: {
+			"get": {
+				OperationID: "searchHashes",
+				Summary:     "Returns the full hashes of threats with the given hash prefix.",
+				Parameters: []openAPIParameter{
+					{Name: "hashPrefix", In: "query", Required: true, Schema: schemaOf("string", "byte", "")},
+					threatTypesParameter(),
+					alt,
+				},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Full hashes of threats.", schemaRef("SearchHashesResponse")),
+				},
+			},
+		},
+		v5SearchHashesPath: {
+			"get": {
+				OperationID: "searchHashesV5",
+				Summary:     "Returns the full hashes of threats with the given hash prefixes, like Safe Browsing v5.",
+				Parameters: []openAPIParameter{{
+					Name:     "hashPrefixes",
+					In:       "query",
+					Required: true,
+					Schema:   arrayOf(schemaOf("string", "byte", "")),
+				}},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Full hashes of threats.", schemaRef("V5SearchHashesResponse")),
+				},
+			},
+		},
+		v4FindThreatMatchesPath: {
+			"post": {
+				OperationID: "findThreatMatchesV4",
+				Summary:     "Looks up URLs in the threat lists, like Safe Browsing v4.",
+				RequestBody: &openAPIBody{Required: true, Content: jsonContent(schemaRef("V4FindThreatMatchesRequest"))},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Threat matches of the URLs.", schemaRef("V4FindThreatMatchesResponse")),
+				},
+			},
+		},
+		redirectPath: {
+			"get": {
+				OperationID: "redirect",
+				Summary:     "Redirects to a URL if it is safe, or shows an interstitial page otherwise.",
+				Parameters: []openAPIParameter{
+					{Name: "url", In: "query", Required: true, Schema: schemaOf("string", "", "")},
+					{Name: redirectSigParam, In: "query", Schema: schemaOf("string", "", "")},
+					{Name: bypassParam, In: "query", Schema: schemaOf("string", "", "")},
+				},
+				Responses: map[string]openAPIResponse{
+					"302": {Description: "The URL is safe, or the bypass token allows proceeding to it."},
+					"400": {Description: "The URL is not an absolute HTTP or HTTPS URL."},
+					"403": {Description: "The URL is not signed with the redirect key, or is safe and no redirect key is set."},
+					"200": {Description: "Interstitial page warning about the threats of the URL."},
+				},
+			},
+		},
+		statusPath: {
+			"get": {
+				OperationID: "status",
+				Summary:     "Reports the statistics of the server.",
+				Responses:   map[string]openAPIResponse{"200": jsonResponse("Statistics.", schemaRef("Status"))},
+			},
+		},
+		healthPath: {
+			"get": {
+				OperationID: "health",
+				Summary:     "Reports whether the server is alive.",
+				Responses:   map[string]openAPIResponse{"200": {Description: "Alive."}},
+			},
+		},
+		readyPath: {
+			"get": {
+				OperationID: "ready",
+				Summary:     "Reports whether the threat lists are synced and lookups can be served.",
+				Responses: map[string]openAPIResponse{
+					"200": {Description: "Ready."},
+					"503": {Description: "Not ready."},
+				},
+			},
+		},
+		openAPIPath: {
+			"get": {
+				OperationID: "openAPI",
+				Summary:     "Returns this document.",
+				Responses:   map[string]openAPIResponse{"200": {Description: "OpenAPI document."}},
+			},
+		},
+	}
+	doc.Components.SecuritySchemes = make(map[string]openAPISecurityScheme)
+	if submissions != nil {
+		doc.Components.SecuritySchemes["submitToken"] = openAPISecurityScheme{Type: "http", Scheme: "bearer"}
+		doc.Paths[submitPath] = openAPIPathItem{
+			"post": {
+				OperationID: "submitUri",
+				Summary:     "Reports a suspected phishing or malware URI to the Web Risk Submission API.",
+				RequestBody: &openAPIBody{Required: true, Content: jsonContent(&openAPISchema{
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"uri":       schemaOf("string", "", "URI to submit."),
+						"abuseType": {Type: "string", Enum: []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE"}},
+						"comment":   schemaOf("string", "", "Note recorded in the audit log."),
+					},
+					Required: []string{"uri"},
+				})},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("Operation of the Submission API processing the URI.", &openAPISchema{
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"operation": schemaOf("string", "", "Name of the operation."),
+							"duplicate": schemaOf("boolean", "", "Whether the URI was submitted recently, and not submitted again."),
+						},
+					}),
+				},
+				Security: []map[string][]string{{"submitToken": {}}},
+			},
+		}
+	}
+	if !admin {
+		return doc
+	}
+
+	doc.Components.SecuritySchemes["adminToken"] = openAPISecurityScheme{Type: "http", Scheme: "bearer"}
+	adminOp := func(id, summary string, responses map[string]openAPIResponse) *openAPIOperation {
+		return &openAPIOperation{
+			OperationID: id,
+			Summary:     summary,
+			Responses:   responses,
+			Security:    []map[string][]string{{"adminToken": {}}},
+		}
+	}
+	snapshot := map[string]openAPIMediaType{mimeOctetStream: {Schema: schemaOf("string", "binary", "")}}
+	importOp := adminOp("importCache", "Merges a snapshot into the lookup cache.", noContent)
+	importOp.RequestBody = &openAPIBody{Required: true, Content: snapshot}
+	doc.Paths[adminCacheExportPath] = openAPIPathItem{"get": adminOp("exportCache", "Downloads a snapshot of the lookup cache.",
+		map[string]openAPIResponse{"200": {Description: "Snapshot.", Content: snapshot}})}
+	doc.Paths[adminCacheImportPath] = openAPIPathItem{"post": importOp}
+	doc.Paths[adminCachePurgePath] = openAPIPathItem{"post": adminOp("purgeCache", "Empties the lookup cache.",
+		map[string]openAPIResponse{"200": jsonResponse("Number of entries removed.", schemaOf("object", "", ""))})}
+	doc.Paths[adminDatabaseExportPath] = openAPIPathItem{"get": adminOp("exportDatabase", "Downloads a snapshot of the local database.",
+		map[string]openAPIResponse{"200": {Description: "Snapshot.", Content: snapshot}})}
+	doc.Paths[adminUpdatePath] = openAPIPathItem{"post": adminOp("update", "Updates the database now.", noContent)}
+	doc.Paths[adminStatsPath] = openAPIPathItem{"get": adminOp("stats", "Reports the statistics of the server and process.",
+		map[string]openAPIResponse{"200": jsonResponse("Statistics.", schemaRef("Status"))})}
+	doc.Paths[adminConfigPath] = openAPIPathItem{"get": adminOp("config", "Reports the effective settings, with secrets redacted.",
+		map[string]openAPIResponse{"200": jsonResponse("Settings keyed by flag name.", schemaOf("object", "", ""))})}
+	doc.Paths[adminDashboardPath] = openAPIPathItem{"get": adminOp("dashboard", "Shows a status dashboard.",
+		map[string]openAPIResponse{"200": {Description: "HTML page."}})}
+	return doc
+}
+
+// serveOpenAPI writes doc as JSON.
+func serveOpenAPI(resp http.ResponseWriter, req *http.Request, doc *openAPIDoc) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	serveJSON(resp, doc)
+}
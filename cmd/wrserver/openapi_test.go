@@ -0,0 +1,59 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	public := []string{findThreatPath, batchSearchPath, streamSearchPath, searchHashesPath, v5SearchHashesPath,
+		v4FindThreatMatchesPath, redirectPath, statusPath, healthPath, readyPath, openAPIPath}
+	admin := []string{adminCacheExportPath, adminCacheImportPath, adminCachePurgePath, adminDatabaseExportPath, adminUpdatePath,
+		adminStatsPath, adminConfigPath, adminDashboardPath}
+	for _, withAdmin := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		serveOpenAPI(rec, httptest.NewRequest("GET", openAPIPath, nil), newOpenAPIDoc(withAdmin))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("admin %v, status code = %d, want %d", withAdmin, rec.Code, http.StatusOK)
+		}
+		var doc struct {
+			Paths      map[string]map[string]json.RawMessage
+			Components struct{ Schemas map[string]json.RawMessage }
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("admin %v, invalid document: %v", withAdmin, err)
+		}
+		for _, p := range public {
+			if len(doc.Paths[p]) == 0 {
+				t.Errorf("admin %v, path %s not described", withAdmin, p)
+			}
+		}
+		for _, p := range admin {
+			if got := len(doc.Paths[p]) > 0; got != withAdmin {
+				t.Errorf("admin %v, path %s described = %v, want %v", withAdmin, p, got, withAdmin)
+			}
+		}
+		for _, m := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+			if _, ok := doc.Components.Schemas[m[1]]; !ok {
+				t.Errorf("admin %v, undefined schema %s", withAdmin, m[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ways of identifying the clients that rate limits apply to.
+const (
+	rateLimitByIP    = "ip"
+	rateLimitByToken = "token"
+)
+
+// rateLimiter limits the rate of requests of every client with a token bucket
+// per client, holding up to burst tokens and refilled at rate tokens per
+// second.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	byToken bool
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	allowed   int64
+	rejected  int64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimitStats is a snapshot of the statistics of the rate limiter.
+type RateLimitStats struct {
+	Clients  int   // Number of clients currently tracked
+	Allowed  int64 // Number of requests allowed
+	Rejected int64 // Number of requests rejected with 429 Too Many Requests
+}
+
+// newRateLimiter returns a rate limiter allowing rate requests per second and
+// bursts of up to burst requests per client. If burst is not positive, it is
+// set to rate rounded up. Clients are identified by IP, or by the bearer token
+// of their requests if by is rateLimitByToken.
+func newRateLimiter(rate float64, burst int, by string) (*rateLimiter, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %v", rate)
+	}
+	if by != rateLimitByIP && by != rateLimitByToken {
+		return nil, fmt.Errorf("unknown rate limit key %q", by)
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		byToken: by == rateLimitByToken,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}, nil
+}
+
+// clientKey returns the key identifying the client sending req. With token
+// keys, requests without a bearer token are identified by IP.
+func (l *rateLimiter) clientKey(req *http.Request) string {
+	if l.byToken {
+		auth := req.Header.Get("Authorization")
+		if token := strings.TrimPrefix(auth, "Bearer "); token != auth && token != "" {
+			return "token:" + token
+		}
+	}
+	return "ip:" + clientIP(req)
+}
+
+// allow reports whether the client with the given key may send a request
+// now. If not, it also returns how long the client should wait.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		l.rejected++
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	l.allowed++
+	return true, 0
+}
+
+// sweep forgets the clients whose bucket has since been refilled, as they
+// are indistinguishable from new clients. This assumes that l.mu is held.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// snapshot returns the current statistics.
+func (l *rateLimiter) snapshot() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return RateLimitStats{
+		Clients:  len(l.buckets),
+		Allowed:  l.allowed,
+		Rejected: l.rejected,
+	}
+}
+
+// withRateLimit wraps h so that requests exceeding the rate limit of their
+// client are rejected with 429 Too Many Requests. Requests are not limited
+// if l is nil.
+func withRateLimit(l *rateLimiter, h http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(l.clientKey(r)); !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	l, err := newRateLimiter(2, 3, rateLimitByToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	h := withRateLimit(l, func(w http.ResponseWriter, r *http.Request) {})
+
+	vectors := []struct {
+		advance time.Duration
+		addr    string
+		token   string
+		code    int
+	}{
+		{0, "10.0.0.1:1234", "", http.StatusOK},
+		{0, "10.0.0.1:1234", "", http.StatusOK},
+		{0, "10.0.0.1:1235", "", http.StatusOK},
+		{0, "10.0.0.1:1236", "", http.StatusTooManyRequests},
+		{0, "10.0.0.2:1234", "", http.StatusOK},
+		{0, "10.0.0.1:1234", "secret", http.StatusOK},
+		{500 * time.Millisecond, "10.0.0.1:1234", "", http.StatusOK},
+		{0, "10.0.0.1:1234", "", http.StatusTooManyRequests},
+		{2 * time.Second, "10.0.0.1:1234", "", http.StatusOK},
+	}
+	for i, v := range vectors {
+		now = now.Add(v.advance)
+		req := httptest.NewRequest("GET", findThreatPath, nil)
+		req.RemoteAddr = v.addr
+		if v.token != "" {
+			req.Header.Set("Authorization", "Bearer "+v.token)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if v.code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("test %d, Retry-After = %q, want 1", i, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	got := l.snapshot()
+	want := RateLimitStats{Clients: 3, Allowed: 7, Rejected: 2}
+	if got != want {
+		t.Errorf("snapshot() = %+v, want %+v", got, want)
+	}
+
+	now = now.Add(time.Hour)
+	l.allow("ip:10.0.0.3")
+	if got := l.snapshot().Clients; got != 1 {
+		t.Errorf("snapshot().Clients = %d after sweep, want 1", got)
+	}
+
+	if _, err := newRateLimiter(1, 0, "user"); err == nil {
+		t.Errorf("newRateLimiter with unknown key succeeded, want error")
+	}
+}
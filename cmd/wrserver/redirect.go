@@ -0,0 +1,72 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+)
+
+// redirectSigParam is the query parameter of /r holding the signature of the
+// URL to redirect to.
+const redirectSigParam = "sig"
+
+var (
+	// errRedirectSignature is returned by checkRedirect for targets not
+	// signed with the -redirectKey.
+	errRedirectSignature = errors.New("invalid signature")
+
+	// errRedirectUnsigned rejects the safe targets of /r without a
+	// -redirectKey, which are not redirected to.
+	errRedirectUnsigned = errors.New("only unsafe URLs are accepted without a signing key")
+)
+
+// redirectKey is the -redirectKey signing the URLs that /r redirects to. If it
+// is nil, /r only shows the warning page of unsafe URLs, and does not redirect
+// to safe ones.
+var redirectKey []byte
+
+// signRedirect returns the signature of rawURL with key, which is the base64
+// encoded HMAC-SHA256 of the URL, without padding and with the URL alphabet.
+func signRedirect(key []byte, rawURL string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(rawURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkRedirect validates the target of /r, which must be an absolute HTTP or
+// HTTPS URL without credentials, so that it cannot be made to look like
+// another host, and signed with key if set.
+func checkRedirect(key []byte, rawURL, sig string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return nil, errors.New("not an HTTP or HTTPS URL")
+	case u.Host == "":
+		return nil, errors.New("no host")
+	case u.User != nil:
+		return nil, errors.New("credentials in URL")
+	}
+	if key != nil && !hmac.Equal([]byte(sig), []byte(signRedirect(key, rawURL))) {
+		return nil, errRedirectSignature
+	}
+	return u, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestRedirectTargets(t *testing.T) {
+	const bad = "http://bad.example.com/login"
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		bad: {{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+	}}
+	key := []byte("secret")
+	vectors := []struct {
+		key    []byte
+		target string
+		sig    string
+		code   int
+	}{
+		// Without a key, safe URLs are not redirected to.
+		{target: "https://example.com/"},
+		{target: bad, code: http.StatusOK},
+		{target: "//evil.example.com/", code: http.StatusBadRequest},
+		{target: "javascript:alert(1)", code: http.StatusBadRequest},
+		{target: "https://example.com@evil.example.com/", code: http.StatusBadRequest},
+		{target: "http://%zz", code: http.StatusBadRequest},
+		{key: key, target: "https://example.com/", sig: signRedirect(key, "https://example.com/"), code: http.StatusFound},
+		{key: key, target: bad, sig: signRedirect(key, bad), code: http.StatusOK},
+		{key: key, target: "https://example.com/"},
+		{key: key, target: "https://example.com/", sig: signRedirect(key, "https://example.com/x")},
+		{key: key, target: "https://example.com/", sig: signRedirect([]byte("other"), "https://example.com/")},
+	}
+	defer func(old []byte) { redirectKey = old }(redirectKey)
+	for i, v := range vectors {
+		if v.code == 0 {
+			v.code = http.StatusForbidden
+		}
+		redirectKey = v.key
+		q := url.Values{"url": {v.target}}
+		if v.sig != "" {
+			q.Set(redirectSigParam, v.sig)
+		}
+		rec := httptest.NewRecorder()
+		serveRedirector(rec, httptest.NewRequest("GET", "/r?"+q.Encode(), nil), fl, http.Dir("public"))
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if v.code == http.StatusFound && rec.Header().Get("Location") != v.target {
+			t.Errorf("test %d, Location = %q, want %q", i, rec.Header().Get("Location"), v.target)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/webrisk"
+)
+
+// reloadableFlags are the flags whose changes are applied when the
+// configuration is reloaded. Changing any other flag requires a restart, for
+// instance because it affects the local database or the listener.
+var reloadableFlags = map[string]bool{
+	"apikey":           true,
+	"adminToken":       true,
+	"expressionLimits": true,
+	"maxStaleness":     true,
+	"rateLimit":        true,
+	"rateBurst":        true,
+	"rateLimitKey":     true,
+	"maxBatchSize":     true,
+	"maxRequestBytes":  true,
+	"requestTimeout":   true,
+	"gzipMinBytes":     true,
+	"corsOrigins":      true,
+	"corsHeaders":      true,
+	"corsMaxAge":       true,
+	"templateDir":      true,
+	"translationsDir":  true,
+}
+
+// settingsMu guards the flags and the package-level settings derived from
+// them, which are changed when the configuration is reloaded.
+var settingsMu sync.RWMutex
+
+// settings are the settings of the handlers derived from the flags.
+type settings struct {
+	expressionLimits map[string]webrisk.ExpressionLimits
+	rateLimiter      *rateLimiter
+	cors             *corsPolicy
+	publicFS         http.FileSystem
+	translations     *translations
+}
+
+// loadSettings derives the settings of the handlers from the flags. The
+// built-in templates and assets are served by base.
+func loadSettings(base http.FileSystem) (*settings, error) {
+	s := &settings{publicFS: base}
+	var err error
+	if *expressionLimitsFlag != "" {
+		if s.expressionLimits, err = loadExpressionLimits(*expressionLimitsFlag); err != nil {
+			return nil, fmt.Errorf("unable to load expression limits: %v", err)
+		}
+	}
+	if *rateLimitFlag > 0 {
+		if s.rateLimiter, err = newRateLimiter(*rateLimitFlag, *rateBurstFlag, *rateLimitKeyFlag); err != nil {
+			return nil, fmt.Errorf("unable to set up rate limiting: %v", err)
+		}
+	}
+	if *corsOriginsFlag != "" {
+		if s.cors, err = newCORSPolicy(*corsOriginsFlag, *corsHeadersFlag, *corsMaxAgeFlag); err != nil {
+			return nil, fmt.Errorf("unable to set up CORS: %v", err)
+		}
+	}
+	if *templateDirFlag != "" {
+		if s.publicFS, err = newTemplateFS(*templateDirFlag, base); err != nil {
+			return nil, fmt.Errorf("unable to load templates: %v", err)
+		}
+	}
+	if *translationsDirFlag != "" {
+		if s.translations, err = loadTranslations(*translationsDirFlag, s.publicFS); err != nil {
+			return nil, fmt.Errorf("unable to load translations: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// apply sets the package-level settings read by the handlers.
+func (s *settings) apply() {
+	expressionLimits = s.expressionLimits
+	lookupRateLimiter = s.rateLimiter
+	lookupCORS = s.cors
+	interstitialTranslations = s.translations
+	if icapService != nil {
+		icapService.setFS(s.publicFS)
+	}
+}
+
+// reloadableHandler serves requests with the handler it was last given, so
+// that handlers can be replaced without interrupting the requests being
+// served by the previous ones.
+type reloadableHandler struct {
+	h atomic.Value // Holds a handlerBox
+}
+
+// handlerBox gives handlers a single concrete type to be stored in an
+// atomic.Value.
+type handlerBox struct{ http.Handler }
+
+func (rh *reloadableHandler) store(h http.Handler) {
+	rh.h.Store(handlerBox{h})
+}
+
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.h.Load().(handlerBox).ServeHTTP(w, r)
+}
+
+// reloadConfig reads the flags not given on the command line again from the
+// environment and from the config file, and the tenants file, and applies the
+// changes of the reloadable flags and tenant settings by setting up new
+// handlers for rh, and for grpcRoot if it is set. The built-in templates and
+// assets are served by base.
+//
+// Changes of other flags are logged and ignored. The configuration is left
+// unchanged if the new one is invalid. The local database and the cache of wr
+// are kept, so that lookups are served from them throughout.
+func reloadConfig(fs *flag.FlagSet, wr *webrisk.UpdateClient, base http.FileSystem, rh *reloadableHandler) (err error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	old := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		old[f.Name] = f.Value.String()
+		if !set[f.Name] {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	defer func() {
+		if err != nil {
+			fs.VisitAll(func(f *flag.Flag) { f.Value.Set(old[f.Name]) })
+		}
+	}()
+
+	if err := applyConfig(fs, *configFlag, os.Getenv); err != nil {
+		return err
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if v := f.Value.String(); v != old[f.Name] && !reloadableFlags[f.Name] {
+			appLog.Errorf("Ignoring the new value of -%s, which requires a restart", f.Name)
+			f.Value.Set(old[f.Name])
+		}
+	})
+	if *apiKeyFlag == "" && len(serverTenants) == 0 {
+		return errors.New("no -apikey specified")
+	}
+	s, err := loadSettings(base)
+	if err != nil {
+		return err
+	}
+	var tenantConfigs map[string]tenantConfig
+	if *tenantsFlag != "" {
+		if tenantConfigs, err = loadTenants(*tenantsFlag); err != nil {
+			return fmt.Errorf("unable to load tenants: %v", err)
+		}
+	}
+	if *apiKeyFlag != old["apikey"] {
+		if wr == nil || *apiKeyFlag == "" {
+			return errors.New("adding or removing the -apikey client requires a restart")
+		}
+		if err := wr.SetAPIKey(*apiKeyFlag); err != nil {
+			return err
+		}
+		appLog.Infof("Rotated the API key")
+	}
+	if err := reloadTenants(serverTenants, tenantConfigs); err != nil {
+		return err
+	}
+
+	// Keep the clients tracked by the rate limiter if its settings did not
+	// change, so that reloading does not reset their limits.
+	if cur, l := lookupRateLimiter, s.rateLimiter; cur != nil && l != nil &&
+		cur.rate == l.rate && cur.burst == l.burst && cur.byToken == l.byToken {
+		s.rateLimiter = cur
+	}
+	s.apply()
+	rh.store(newRootHandler(wr, s.publicFS))
+	if grpcRoot != nil {
+		grpcRoot.store(newGRPCRootHandler(wr))
+	}
+	return nil
+}
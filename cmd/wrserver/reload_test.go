@@ -0,0 +1,122 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestReloadConfig(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.URL.Query().Get("key"))
+		mu.Unlock()
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:       "old-key",
+		ServerURL:    ts.URL,
+		ThreatLists:  []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		UpdatePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	setFlag := func(name, value string) {
+		if err := flag.Lookup(name).Value.Set(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	defer func() {
+		for _, name := range []string{"apikey", "maxBatchSize", "db", "rateLimit", "rateLimitKey"} {
+			setFlag(name, flag.Lookup(name).DefValue)
+		}
+		lookupRateLimiter = nil
+	}()
+	setFlag("apikey", "old-key")
+	base := http.Dir(t.TempDir())
+	rh := new(reloadableHandler)
+	rh.store(newHandler(wr, base))
+
+	batch := func() int {
+		rec := httptest.NewRecorder()
+		body := `{"uris": ["http://1.example.com/", "http://2.example.com/"]}`
+		rh.ServeHTTP(rec, httptest.NewRequest("POST", batchSearchPath, strings.NewReader(body)))
+		return rec.Code
+	}
+	if code := batch(); code == http.StatusRequestEntityTooLarge {
+		t.Fatalf("batch status code = %d before reload", code)
+	}
+
+	t.Setenv(envName("apikey"), "new-key")
+	t.Setenv(envName("maxBatchSize"), "1")
+	t.Setenv(envName("db"), "/tmp/other.db")
+	t.Setenv(envName("rateLimit"), "5")
+	if err := reloadConfig(flag.CommandLine, wr, base, rh); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if code := batch(); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("batch status code = %d after reload, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+	if *databaseFlag != "" {
+		t.Errorf("-db = %q after reload, want it unchanged", *databaseFlag)
+	}
+	if lookupRateLimiter == nil || lookupRateLimiter.rate != 5 {
+		t.Errorf("rate limiter not set up by reload")
+	}
+	limiter := lookupRateLimiter
+	if err := reloadConfig(flag.CommandLine, wr, base, rh); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if lookupRateLimiter != limiter {
+		t.Errorf("rate limiter replaced by reload with the same settings")
+	}
+	if err := wr.UpdateNow(context.Background()); errors.Is(err, webrisk.ErrUpdateTooSoon) {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+	mu.Lock()
+	if got := keys[len(keys)-1]; got != "new-key" {
+		t.Errorf("API key = %q after reload, want %q", got, "new-key")
+	}
+	mu.Unlock()
+
+	// Invalid configurations are rejected as a whole.
+	t.Setenv(envName("maxBatchSize"), "2")
+	t.Setenv(envName("rateLimitKey"), "bogus")
+	if err := reloadConfig(flag.CommandLine, wr, base, rh); err == nil {
+		t.Errorf("reload with an invalid configuration succeeded")
+	}
+	if *maxBatchSizeFlag != 1 || *rateLimitKeyFlag != rateLimitByIP {
+		t.Errorf("flags changed by a failed reload: maxBatchSize = %d, rateLimitKey = %q", *maxBatchSizeFlag, *rateLimitKeyFlag)
+	}
+	if code := batch(); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("batch status code = %d after failed reload, want %d", code, http.StatusRequestEntityTooLarge)
+	}
+}
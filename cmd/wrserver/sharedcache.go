@@ -0,0 +1,296 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// maxIdleCacheConns is the maximum number of idle connections kept open to
+// the shared cache server.
+const maxIdleCacheConns = 16
+
+// maxMemcachedTTL is the longest expiry that memcached accepts as a duration
+// rather than as a Unix time.
+const maxMemcachedTTL = 30 * 24 * time.Hour
+
+// newCacheStore returns a client of the cache server at rawURL, which is
+// either redis://[:password@]host[:port][/db] or memcached://host[:port].
+// Commands taking longer than timeout fail.
+func newCacheStore(rawURL string, timeout time.Duration) (webrisk.CacheStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %s", rawURL)
+	}
+	switch u.Scheme {
+	case "redis":
+		c := &redisCache{}
+		if p, ok := u.User.Password(); ok {
+			c.password = p
+		} else if u.User != nil {
+			c.password = u.User.Username()
+		}
+		if db := strings.Trim(u.Path, "/"); db != "" {
+			if _, err := strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("invalid Redis database %q", db)
+			}
+			c.db = db
+		}
+		c.pool = newConnPool(withDefaultPort(u.Host, "6379"), timeout, c.setup)
+		return c, nil
+	case "memcached":
+		return &memcachedCache{pool: newConnPool(withDefaultPort(u.Host, "11211"), timeout, nil)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported shared cache %q, want redis:// or memcached://", rawURL)
+	}
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// cacheConn is a connection to a cache server.
+type cacheConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// connPool is a pool of connections to a cache server. Connections are set up
+// with setup, if not nil, once dialed.
+type connPool struct {
+	addr    string
+	timeout time.Duration
+	setup   func(*cacheConn) error
+	idle    chan *cacheConn
+}
+
+func newConnPool(addr string, timeout time.Duration, setup func(*cacheConn) error) *connPool {
+	return &connPool{addr: addr, timeout: timeout, setup: setup, idle: make(chan *cacheConn, maxIdleCacheConns)}
+}
+
+// do calls f with a connection, which is closed if f fails since its state is
+// unknown.
+func (p *connPool) do(ctx context.Context, f func(*cacheConn) error) error {
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	var c *cacheConn
+	select {
+	case c = <-p.idle:
+	default:
+		d := net.Dialer{Deadline: deadline}
+		conn, err := d.DialContext(ctx, "tcp", p.addr)
+		if err != nil {
+			return err
+		}
+		c = &cacheConn{Conn: conn, r: bufio.NewReader(conn)}
+		if p.setup != nil {
+			c.SetDeadline(deadline)
+			if err := p.setup(c); err != nil {
+				c.Close()
+				return err
+			}
+		}
+	}
+	c.SetDeadline(deadline)
+	if err := f(c); err != nil {
+		c.Close()
+		return err
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+	return nil
+}
+
+// readLine reads a line terminated by CRLF, without the terminator.
+func (c *cacheConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("malformed response line")
+	}
+	return line[:len(line)-2], nil
+}
+
+// readBlock reads n bytes followed by CRLF.
+func (c *cacheConn) readBlock(n int) ([]byte, error) {
+	b := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, b); err != nil {
+		return nil, err
+	}
+	if string(b[n:]) != "\r\n" {
+		return nil, errors.New("malformed response block")
+	}
+	return b[:n], nil
+}
+
+// redisCache is a webrisk.CacheStore backed by Redis.
+type redisCache struct {
+	password string
+	db       string
+	pool     *connPool
+}
+
+// setup authenticates c and selects the database, if configured.
+func (rc *redisCache) setup(c *cacheConn) error {
+	if rc.password != "" {
+		if _, err := rc.command(c, "AUTH", []byte(rc.password)); err != nil {
+			return err
+		}
+	}
+	if rc.db != "" {
+		if _, err := rc.command(c, "SELECT", []byte(rc.db)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command sends a command with the given arguments and returns the value of
+// its reply, which is nil for a nil bulk string.
+func (rc *redisCache) command(c *cacheConn, name string, args ...[]byte) ([]byte, error) {
+	w := bufio.NewWriter(c)
+	fmt.Fprintf(w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(name), name)
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n", len(a))
+		w.Write(a)
+		w.WriteString("\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("empty Redis reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed Redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		return c.readBlock(n)
+	default:
+		return nil, fmt.Errorf("unexpected Redis reply %q", line)
+	}
+}
+
+func (rc *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var v []byte
+	err := rc.pool.do(ctx, func(c *cacheConn) error {
+		var err error
+		v, err = rc.command(c, "GET", []byte(key))
+		return err
+	})
+	return v, err
+}
+
+func (rc *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := strconv.FormatInt(int64((ttl+time.Millisecond-1)/time.Millisecond), 10)
+	return rc.pool.do(ctx, func(c *cacheConn) error {
+		_, err := rc.command(c, "SET", []byte(key), value, []byte("PX"), []byte(ms))
+		return err
+	})
+}
+
+// memcachedCache is a webrisk.CacheStore backed by memcached, using its text
+// protocol.
+type memcachedCache struct {
+	pool *connPool
+}
+
+func (mc *memcachedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	var v []byte
+	err := mc.pool.do(ctx, func(c *cacheConn) error {
+		if _, err := fmt.Fprintf(c, "get %s\r\n", key); err != nil {
+			return err
+		}
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("unexpected memcached reply %q", line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("malformed memcached reply %q", line)
+			}
+			if v, err = c.readBlock(n); err != nil {
+				return err
+			}
+		}
+	})
+	return v, err
+}
+
+func (mc *memcachedCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl > maxMemcachedTTL {
+		ttl = maxMemcachedTTL
+	}
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	return mc.pool.do(ctx, func(c *cacheConn) error {
+		if _, err := fmt.Fprintf(c, "set %s 0 %d %d\r\n%s\r\n", key, secs, len(value), value); err != nil {
+			return err
+		}
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return fmt.Errorf("unexpected memcached reply %q", line)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCacheServer serves a minimal subset of the Redis and memcached
+// protocols from memory.
+type fakeCacheServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	entries  map[string]string
+	ttls     map[string]string
+	commands []string
+}
+
+func newFakeCacheServer(t *testing.T, serve func(*fakeCacheServer, *bufio.Reader, io.Writer) error) *fakeCacheServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &fakeCacheServer{ln: ln, entries: make(map[string]string), ttls: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for serve(s, r, conn) == nil {
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeCacheServer) record(cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+}
+
+func serveFakeRedis(s *fakeCacheServer, r *bufio.Reader, w io.Writer) error {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var l int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &l); err != nil {
+			return err
+		}
+		b := make([]byte, l+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		args[i] = string(b[:l])
+	}
+	s.record(args[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "pw" {
+			_, err := io.WriteString(w, "-WRONGPASS invalid password\r\n")
+			return err
+		}
+		_, err := io.WriteString(w, "+OK\r\n")
+		return err
+	case "SELECT":
+		_, err := io.WriteString(w, "+OK\r\n")
+		return err
+	case "GET":
+		v, ok := s.entries[args[1]]
+		if !ok {
+			_, err := io.WriteString(w, "$-1\r\n")
+			return err
+		}
+		_, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+		return err
+	case "SET":
+		s.entries[args[1]] = args[2]
+		s.ttls[args[1]] = args[4]
+		_, err := io.WriteString(w, "+OK\r\n")
+		return err
+	}
+	return errors.New("unknown command")
+}
+
+func serveFakeMemcached(s *fakeCacheServer, r *bufio.Reader, w io.Writer) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	s.record(fields[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch fields[0] {
+	case "get":
+		if v, ok := s.entries[fields[1]]; ok {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+		}
+		_, err := io.WriteString(w, "END\r\n")
+		return err
+	case "set":
+		var n int
+		fmt.Sscan(fields[4], &n)
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		s.entries[fields[1]] = string(b[:n])
+		s.ttls[fields[1]] = fields[3]
+		_, err := io.WriteString(w, "STORED\r\n")
+		return err
+	}
+	return errors.New("unknown command")
+}
+
+func TestCacheStore(t *testing.T) {
+	redis := newFakeCacheServer(t, serveFakeRedis)
+	defer redis.ln.Close()
+	memcached := newFakeCacheServer(t, serveFakeMemcached)
+	defer memcached.ln.Close()
+
+	vectors := []struct {
+		url     string
+		server  *fakeCacheServer
+		ttl     string
+		setup   []string
+		getFail bool
+	}{
+		{url: "redis://:pw@" + redis.ln.Addr().String() + "/2", server: redis, ttl: "1500", setup: []string{"AUTH", "SELECT"}},
+		{url: "redis://bad@" + redis.ln.Addr().String(), server: redis, getFail: true},
+		{url: "memcached://" + memcached.ln.Addr().String(), server: memcached, ttl: "2"},
+	}
+	for i, v := range vectors {
+		v.server.mu.Lock()
+		v.server.commands = nil
+		v.server.mu.Unlock()
+		sc, err := newCacheStore(v.url, time.Second)
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		key := fmt.Sprintf("webrisk:test%d", i)
+		value := []byte("a\r\nbinary\x00value")
+		got, err := sc.Get(context.Background(), key)
+		if err != nil != v.getFail {
+			t.Errorf("test %d, Get() error = %v, want failure %v", i, err, v.getFail)
+		}
+		if v.getFail {
+			continue
+		}
+		if got != nil {
+			t.Errorf("test %d, Get() = %q before Set, want nil", i, got)
+		}
+		if err := sc.Set(context.Background(), key, value, 1500*time.Millisecond); err != nil {
+			t.Errorf("test %d, unexpected Set error: %v", i, err)
+		}
+		if got, err := sc.Get(context.Background(), key); err != nil || !bytes.Equal(got, value) {
+			t.Errorf("test %d, Get() = %q, %v, want %q", i, got, err, value)
+		}
+		v.server.mu.Lock()
+		if ttl := v.server.ttls[key]; ttl != v.ttl {
+			t.Errorf("test %d, TTL = %q, want %q", i, ttl, v.ttl)
+		}
+		// Connections are set up once and reused.
+		if want := append(v.setup, "GET", "SET", "GET"); len(v.server.commands) != len(want) ||
+			!strings.EqualFold(strings.Join(v.server.commands, ","), strings.Join(want, ",")) {
+			t.Errorf("test %d, commands = %q, want %q", i, v.server.commands, want)
+		}
+		v.server.mu.Unlock()
+	}
+
+	for _, u := range []string{"http://localhost", "redis://", "redis://localhost/db"} {
+		if _, err := newCacheStore(u, time.Second); err == nil {
+			t.Errorf("newCacheStore(%q) succeeded", u)
+		}
+	}
+}
@@ -36,6 +36,6 @@ import (
 
 
 func init() {
-	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x0b\x8dmN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00interstitial.cssUT\x05\x00\x01\x87@\x89\\\xbcXm\x8f\xdb\xb8\x11\xfe\xee_1@p\xcd&\xb0\xbc\x92\xfc\xb2^-p\xe85wh\x0b\\\x83\xe2\xae\xed\xd7\x82\x96\xc66\x1b\x8a\x14(\xcak\xe7\xb0\xff\xbd\xa0(\xc9\xa4D\xd9JQ\xdc\x97dM\x91\xc3yyf\x9e\x19>~\x84O\xa2\xb8Hz8*\x88\xc3h\x05\xff8\"|:J\x91\xd3*\x87\x1f*u\x14\xb2\\\xc0\x0f\x8cA\xbd\xa9\x04\x89%\xca\x13f\x8b\x19\x00\xfc\xb3D\x10{PGZB)*\x99\"\xa4\"C\xa0%\x1c\xc4	%\xc7\x0cv\x17 \xf0\xa7_\x7f\x0cJua\x08\x8c\xa6\xc8K\x04u$\nR\xc2a\x87Z\xd2^T<\x03\xcaA\x1d\x11~\xfe\xeb\xa7\x9f>\xff\xfa\x13\xec)\xc3\x05||\x9c\xcd\x08\xfc6\x03H\x05\x132\x01y\xd8=\xac\x9e\xe7\xb0^\xcda\xbd\xf9\xf02{\x9b\xcdv\"\xbb\xd4{v$\xfdr\x90ZZ\xd0l\x7f=R\x85/7\x8e\xeb\xdb\xb9\n\xf6$\xa7\xec\x92\xc0\xfb\xbf ;\xa1\xa2)\x81\xcfX\xe1\xfb9\xbc\xff\xb9JiF\xe0\xcf\x92\xf0L/\x94\x84\x97A\x89\x92\xee\xbb\xd3%\xfd\x8a	<\xad\xbf3\xeaTJ	>\xa2\x90<\xec\xc8\xc3\xf2i\x0eO\x9b9<Gs\x88j%vBf(\x13\x08\xaf?\x02I2Z\x95	\xc4\xc5\xd9\xac\x9e\xf5E\x94\x1f\x92v\xc7N\x9c-\xdb\xde\xed\xf7\xb5Ji%K\xfd\xbb\x10\x94+\x94\xb5\x96L\x10\x95\x980\xf6\xb4^l\x9f\xd6\x98\xeb\xc5\x9c\xc8\x03\xe5\x8d\x0e\x05\xc9\xb2\xfa\xaa(,\xce\x10\xaf\x8c\x0eJ\x12^RE\x05O\x8c>G\x92\x89W\x88\xc30/!\xadv4\x0dv\xf8\x95\xa2|\x08\x17\xab9\x84s\x08\x17qkcU\xa2\x0cJd\x98\xaa\x04\xb8\xe0u\\\x82\\|\x0dF\xbe\x94#\x1f^q\xf7\x85*\xdf\xc7\xce\xfb	I\x15=\xe1\xb7\x05AT\x8aQ\x8e\xb5\x07\xae\x92\x8e\x1a\xccFPgq\x02\xa1\x0e\x0b,\x8b\xb3\x11\x16\x1ac\xe7\xb0X\x1aL\xbe\xcbP\x11\xca\xca\x9b\xd8\xbd\xfa|\xb5.\xce\x10\xc2:\xd4~\xb6\x8f\x17	\x17\xea!\xd9SY\xaa@\xec\x03u)\xf0C-\xd4\x1c\x0d\x94(\x12\x88\xfb\xe7\x02/\x08\x13\xa0\xfc\x88\x92\xaa\x01\xe4n\xa4\x87\x81N\xeb\xfc\x1b \xa9\x97\x14\x9eU\x90a*$10\xa9x\x86R\xbb\xb5\xfbZ\x83h/d\x9e@U\x14(SR\xa2O\xf9\x11\xcf[&\xdc\xba\xecm6;F}\xef\xc7\xe1j\x0e\xcb\xcd\x1c\xa2\xf0C/\x0f\xa2\xc5\xc6\xa4A\xbd\xf6\x8a:U\xb4\xd92'L/k\xa9\xc1\xb1Y\x8e\x16\xb1\x934\xc1N(%\xf2\x04\xa2M\x13\x88c\xfcMw\xc77\xee~\x9b\xcd\x16G\x9aeh\xc2\x99\xd1\xb2`\xe4bA\xfe\xa8rV\x7f\xb2E\xc6\xba\x1a5.\xd2K\x01\xc9\xfeS\x95Z\xf70\xfc\xaeM<\xff\xd76\xfbn|mRpl\x87V\x99\xa6\xc3\"Hsr\xc0\x04*\xc9\x1e\x1e\x8bj\xc7h\xfa\xf8J$\xa7\xfc\xf0o%)\xe1\x07\x86\x8b\xf2t0%\xf1zLb\x81\x06\x84\xcd\x9f\xbd\xef\x8d\xc9\x8drm\x90\x9e\x9a\xc2\xd9A\x16BX\x85f\xed\x95f\xea\xd8n\xa9\xb5\xd5\xa5\xb2TTQ\xc2\x82WI40\xaf\xd0\xf3\x96]\xdb\xdb&|=\x8cl\xdc\xba\x1a\x85:KH\xa5\x84I\x95\x9c\x9c\x83F\x8fM\xe8\xea\xd5y\xf1\x1d\x13\x07Q\xeb\xd1\x8a]mm\xab:\xe0-\xcd\xea	\xa5&/\x16\x10F\x0f<\x81\x9cf\x19C[\xf2\xd3\xba-\x15Zt\xb0c\"\xfd\xd2\x87j\xb4Y\xce\xa1\xfd\xa7\x0f\xd6\xc5\xb31\xabI~S\x80\xd6\x8d\xfe5 \x9a\xbbS4\xf4\xa3\xef\xca	\xe5A\x8eeI\x0e\x08\xdfC\xe1\"\x99\xf2.g\x17\x9c\x9c\x1c\xff\xdben\x1d\xb5\xe1\xb2v%	\xd9\xabfs\xca\x90H\x1d'u4U\x8d+\xe4*\x81\xf7\xef_\xec\xfb\x14\xd9\xb9N\xe9@[\xe6\x84\xb1\x80Q>\xf0\x89\xafkp\x19\xf4m6\xfbc\x8e\x19%\xf0`\x85\xf6I\x87\xd6T\xecq\x90Y\xa54\x84\xc8\xc0\xf8mD\xe0*\xee\x04\x9a:9\xd7\xa2{\x8a\x0f\xeavO\xe3\xb6|\xf5J\xce*\x0c\xcd\xaaS\xe6o\xd6m\xfd\xd9q\xa3\xd6|\x06\xe0\x10\xe0U`\\3E\xf3\xdfp\xf38\xdd\xb9H\x88\x1a\xbc9\xa7m\xd2\xb3\xa2]C\xfce \"nD\xf8A;f\xd6\xc4\x18\xae-G\xf4\xf2lP\xc1[\xc9}\xe4\xbb\xea.;\x8b\xdff\xb3\xc7\x8f\x1fg\xf0\x11\xfe&v\x94!\x94\x05\xa6tOS\xd0]6\xe5\x879\xec\x85\xd4\xa9_\x87;\x832\x95\x88\xbc\x84?\x00#\xf2\x80r\xa1\xcf~&'z\xa8i\xb3\x81Q	D\"\x10\x9e\x1e\x85\xc4\x0c\x94\xa8\xdbqS_L\xa3\x8f\x8d\xa4\xfa\xfc\x8fM\xc4\xda\xa4\x96X0\x92bY\xefS\xa2h\x93O\xf7\xf5T\x95 ^\xb9>.\x18\xd3\xc9\xa7\xef\"Z\xce\xe3-\x8c\x13\x9e\x99\xe5\xae\xa4/7\xdd\xba\x90\x14\xb9j\x88\xbf\x10RIB\x95\xc1\x8a\x1f\x10N\xc3sE\xe4\xb6\x06\xe4\x15\x8b\x8b\x12S\xc13\"/\xee\xf1\x96\xf3\x9a\xa0\xa0n\xa7\xc2!\xacL\x07\xd0O_\xca[\xd3\xe2\x95k\xda\xc0\xe2Z\"\x809\xd4U\xfd0\xfa&\x87t\xfe\x98;\xe2\xba\xcb\"\x9f\x0e\xb60\xfb\xf2\xab\xcaWa\x96\x0ev\xb0l\x1d\x18\xe1Y\x99\x926\x81\xeb)\xcd\x03r\xbb=\xed\xc65\x80\x96\xd8\xc2\xf6\xa7\xdd{\x07\xb1\xee\xbe\xb5Z\xf6\x11\x86{5\x08o\xf7\xd35\xf3\xc5\xce\xd8\xc0\x9cl\xa7\x9c\xeb\xbal\x1d\xd0}\x10\xed\xf8\xb3\xa7g\xcc\xcc\xe2\xd7\x80\xf2\x0c\xcf	D\x93\xca\x84O\x15\xa7\x8e\xe9\x98\x19\xc6ls\xc8\xa9/\x1d\xe7\xafB\x1f\xd4\xfe\x1fY4w\x02\xed\x83\xc7\x84\xf8\x83\x0f\x00.\x1b\x84u;\xd49\xe0\xcag\xe6/\x0f\xab\xd9\xc3\xfa/b'\x94\x08~\xc1C\xc5\x88\x9cw\xa3\xfb\x90\xef\x9e\x97K/\xdfm\xfa|\xb7ii\xe9\x0e\xe7\x8dU\xec\xf1nq\x18\xbem\x0b\xaa	\xf4yKn\x1b\x87\xd6\x95\x03\xec\x8b\x82\xa4T]\x1a|\xbaS|\xf3\x0d\xe2\xf5\x94\x11\xdeQ\xad\x19J\x06h\xb5\x87\x15?\x0d\xb7\x1a\xf7\xf5k\x7f\x9fP\xee\x99\xcet#i\xa8\xb5C\x9c\xfej\xdf\xf7v4H\xfa^\xb9\xd6=vd\xc3\xac\x9d\xcd\xbaV\xa9\xd7ro\xad\x93\xd7ig8\x12\xc6\xce\xbe\xf1\xbap+\xc6]\xfb\xb4jG\x88V\xac\xd3v\xf8\n\x95DF\x14=\xe1\x1d\x1d\x8a\xa1\xe9\x8b\xe7\xce\xf4\xfed\x13\xf5|R\xfb\xd2v\x88\xaf~\xf5\x9bJ\x0f\x0c\xa3I/I\x0dO\xf7\x8b\x83C\xf0\xcd\x9e\xeap\xc0RaV\x97x\xf8\x1e\xdei\x95\xa4`\x0dX\xca\xb9\xbb\xcb\xbc\x86\x0e\xb7\x8d5\xd5\x8eI\x03\xca\xbf\xb2\xb7\xbfB\xba]\xcbm\xcep1\xb5Z\x8ft\x19\x1dg??O\xb9rX\xc1\xc6\xf2\xe6\x86q\xeb;,S\xcb\xed\x91\xc9\x18i\xf4]2\x9aV-\xd4\xef\xa6\x95\x8d\xd0\xcd\xea\x9e1\xdb\xc9\xdd\xd9\xffJ\xa8\xd6m\xcb\xe5\xf6.\xa3z	\xb8\x93v\x8bo';\xef>\x08\xe2{~[\x87~\xbfE\xab)\xfd\xfa\xd4\xf0=o\x9c\x19\x08\xfe~\xd4\xb3\x84\x02S5\xf50\xe1i\xb8\x97OkoW\xbbY\xddk\xa9\xbd\xb8\x9df\xd1\xcd\xc9|\xf0n\xe4\xc9\xba~uo\xd8\xca\xe6\x12\xddO\xd5\xe3\xf2B\xec\xf7\xba@\x7fpB\xde\xda\xb3\x0d{}\xc6\xf6\xfe\xec\xec\xcc\xc9\xdb\xbb\x0c\xf9d\xcc\xb8\xc7\x84\xf1vb\xcav\x8c6\xe1\x84\x87\xb7\xa2E\xb8\xb65\x1a\xc5\xb7}\x81\x7fZ\x9b\x9e\x89\xfe\x81\xc9\x85V\xfc\xbc\xbd\x95\xc0\x9e~yB|\xd7\xfd\xf8\xae\xc3\x91\xc6\xc4\x81R8)\x12\xfe\xc9\xf6\x8eSM\x1f\x02\xbf\xabk=\x15\xfa\x86ko\xa1\xfe\x1b]\xd3\x82\xfb)\xbc\xed\x1d\xdb\x93\xd6\xc3\x17\x9e\x15\xf2\x0c\xeb7n!\x95\x0e\x8f(T@}\x99\x18\xfaj_g\xd9H\xf9\xdblG\x1cf\n\xd9\xb4\xf2k5\x9e\xf7m4H\xb1\x1e\xba\x07\xf3\xa9/\x98#L\xe6N\xa2>\x9a\xbeK\xb8v\xf1~\xf6\xfab\x19/[_LM\xbaM?\xe96\x13\xa7\x81\x1e\x85\xfd\x0b\xe5\x05j\x8a\x80\xbcy\xcd3\xafu\x0b\xf8,\xcc#\x03prZ8\xd1\xb5=1\xd2Z\x8ey\xa2s\xfd\xd2\xdf\x1f\x8e\xba\xfe\x9e\x0bM\xbfy\x0fN\xdd4\xb8g\xd88P\xff\x15dTbj\x14H\x05\xab\xf2f\xe6\xeb9\xcf\xf3`\xfc['#\x81\x08\"k\x08\x1e\x0c\x03\xbe\x91d\xd2A\x0f\xd2\xcd\xb9\xd09\xe7\x19\x85:a\xcd\xe4\xed\xbe7\x85\xee\xa2t\x86b\xff\x00\xe7y,\xf0\xbf\xfd\x8c\xc6w\xf2\x00pWG}\xf5\x7f\x03\x00\x00\xff\xffPK\x07\x08{\xdc\x9d\xdbg\x08\x00\x00E\"\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00J\x94mN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x11\x00	\x00interstitial.htmlUT\x05\x00\x01,M\x89\\t\x93\xc1\x92\xdb \x0c\x86\xefy\nU\xe7z=\xb9\xf5\x00>t\xfa\x06}\x02\x02J\xac.`\x06\x94d<;\xfb\xee\x1dC\xe28\x99]_,K\xbf>	Y\xa8\x1fn\xb22'\x82Q\x82\x1fvjy\x81\xe3\xac\xd1KF\xf0&\x9e4R\xc4%D\xc6\x0d;\x00\x15H\x0c\xd8\xd1\xe4B\xa2\xf1,\xc7\xee\x17>\x02\xd1\x04\xd2xa\xba\xa6)\x0b\xee\xa0>v\x8aBQ4rda\xe3\xbbb\x8d'\xbd\xff	\x81#\x87sx8\xae\xecd\xd4\x8e.l\xa9\xab\x1f\x8d.,\x9e\x86\xbfd\xcf\x99e\x06\xcay\xca\xaao\xde%\xee9\xbeC&\xaf\xb1\xc8\xec\xa9\x8cD\x820f:j\xec\xd3\xf9\xe0\xd9\xf6\x1c\x85r\x91\xda\xc2\x9b-\xa5\x91\x8b\xcd\x9c\x04J\xb6\xdf(\xff\x15\x1cT\xdfd\xc3N\xf5m\x14\xea0\xb9\x19\xd8i\\\x8c\x86r|\x01\xebM)\xcbI\x1f\x84\xee\x9aMJ\x94\xab\xe8&[\x12\x83\xe1\xd8\xddfs\x8b\xbd@\xec\x14\xb1J\xab5\xa8\xde\xf1\xe5I\xb8b\x02\x95bN\xb4b\x00\xd4\xb8\x1f>>\x84B\xf2F\x08pi\x9b\xe3	\xe1\xed\xf3S\xf5\xe3~\xa3LO\xc2;\xaa	\xd3Z\xefQ|kn\xda\x8d\xe6\xf2rT\x00u8\x8bL\xb16\x9a2\x07\x93\xe7\xae\xb9p\xf8m\xec;\xc8\x04\xc5\x1cIf\xd57\xffW\x99\x8e\xc4\xb0/\xf7\xcc{\xc1\x12\x8c\xf7\xdd\xf2\xebq\xf8\xd3$\xcf\x94\xd7F7\xac\x152\xb2su\xc7\xbf\x1c\xc6\xaa\xde\x0ec\xc5\xde\x0c\xd5/;Pw\xa3^\xa4\xff\x01\x00\x00\xff\xffPK\x07\x08\xe9\x02\xe6\xcb\x89\x01\x00\x00Y\x03\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x0b\x8dmN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0f\x00	\x00interstitial.jsUT\x05\x00\x01\x87@\x89\\\x94UmO#G\x13\xfc\xbe\xbf\xa2\x8e\xe7\xa4\xb5y`\xcd\x11\x94HXV\xc2\xdb	$\xe0\x94\xc0)\x1f\xa3\xf1N\xdb;bvf3\xd3k\xf0q\xfe\xef\xd1\xcc\xdaf\xfdF.\xdf`\xdc]\xdd]\xd5]\xdb\xeb\xe1\xc2VS\xa7\xc6\x05\xe3\xf8\xe8\xd3	\x1e\x0b\xc2E\xe1l\xa9\xea\x12g5\x17\xd6\xf9\x0cgZ#\x06y8\xf2\xe4&$\xb3\xa4\xd7\xc3WO\xb0#p\xa1<\xbc\xad]N\xc8\xad$(\x8f\xb1\x9d\x903$1\x9cB\xe0\xfc\xe1\xf2\xd0\xf3T\x13\xb4\xca\xc9x\x02\x17\x82\x91\x0b\x83!\x05\xa4\x91\xad\x8d\x842\xe0\x82p{squ\xffp\x85\x91\xd2\x94%Io\x7f?\xc1>\xce\xb4\x12\x1e#\xeb m^\x97d8\x1b\x13_i\n\x7f\x9eOod\x86\xcf\x11\x85\x9a'\x8f\xb2\xf6\x8c!\xe1\xfa\xf1\xeev\x1e\xe7\xb3\x00\xf5[%\x9c(\xf1\xea\xd9)3\x9eA\xc98\xf8\xcde3\x0d- \xc0\x16#ed\x93\xe4\x88kg\xf0\xda\x82\x9b\xc5\xbcQ\xbb,\xac\x83\xa9\xb5\x86\x1a\xc1Xn~\x0c\x00\xbddT\x9b\x9c\x955\xf8\xd8Q\xb2\x8b\xd7\x04\x98\x08\x07\xd2\x18\xec\x9a)\x04\xf6\x13`^\x9bt?\x99EFp/J\xf2\x95\xc8)\x0b\xd0\x01G\x19&\xe7Y\xb1\x12\x01q\xe5\xdf\xef\xdf\xf1:\xeb'K2\xff,\x88\x0brq\xd8J\x8c\xa3dy\xed\x1c\x19\xd6S\x0cI\x991&\x8a\x9eIB0\x04\xf6J;T\x9a\xf6\xe0sGd\xe0\xd57jX\xe1iEx\x1dZ\xabI\x98Y\xc3\xaeS\x13\xc1\x14gnw\x915 \xf7b\xf2\x17\x06\x18	\xed\xa9\xd5\xd2\x031\xea\n4	$\x16\xc2HM\xae\xd1\xfb\xeb\xcdR\xd3l\x13\xd4\x13\xd7\xd5\xd5$*>\xc0\x82\xe3N\xc3o\xaf\x17\x15\xda\x1b\x8a\xfc)\xa8\xe9\xc5\x88x\xba\x87a\xcdlM\x96\x00\x1f;i\xe5T)\xdc\xf4\xb0yL\xbb\x99\x902\x02\xde*\xcfd\xc8u\xd2\\\xab\xfc)=X\x87\x07\x9e\x95\x91\xf69+\x94g\xeb\xa6Y\xa8\xd3\x89\x8a\xcd\xba\xfd\xa4\xd5\xc0%\xb1P\xda\xafU\x96\xcd\xeb\x7f\xaa\x1c	Z\x94\x0f\xba\x17JJ2\xf3\x02\x18\xb4p\xd3n\x96k\xe1}@\xcb\xd8\x8e\xc7\x9a:i\x13\x9e6\xed!\xacig\x87H\xdd\x18\x10\x1b-\x852\x87\xb95L\x86\xdfC=\xc0\x87\x95v\"\x15\x00iO?\x00\xe6\xa8\xb4\x93\xcd\x16\xb7\x11\xa5\x8c!\xf7H/\x8c\xc1\x1a\x01\xbf\"\x9d\xff\x99\xe2\x14\xe9\xb5\x92\x84\x05\x1f\xab\xc2\\\xc7%\x0b\x96\xa6\xbeQ\xb3xa\xc1\x16\x9anj\xd1D\xa6\x07+\xb7\x95Y\xf3G|\x8f\xb3n\xfd%lD\xfb\xfa>[\x07_\n\xad\x17\xe7\xd4p~\x10\xcf\xd1\x88\x89\x1a\x8b\xe8\x13\xcd\xb4\x1e\xc2\x11\x023\x12C\xd2\xf69\x86	9\x11&'\x19\xf0\x98^x\xcbe,\xcao\x9eE\\\x1b\xd2\xd5\x97\x9a\xc9\x9d\xdb\x97\xb6\x01\xfd]\x93\x9b>\x90\xa6\x9c\xad\xeb\xa4\xff[\xeeR\x7f\x9e\x18\xe4\xbbh\xd4{/oU\xe5e2I%~\x0f\xa1\x18 \xed\x94\xca\x1c>+\xc9\xc5)\x8eO\x8e\xaa\x97.\x84\x91\xe8\x94\xe2e\xf1|r\xbc|N\xf1\xff\xf9\x12\xa51\xa2\xa0\xf0M:\xc5/?\xfd\xfc\x96\xa9\xcc\xf2\xfd\xe4\xe8\xd3\xb6T\xeb\x14\x19\x8e\x0c\x9f\xa2\xb2\x8e\x9dP\xdc=X\xa9\xda\x82\xdcU\xb5\xd5\xd8J\xd5\xd6\x1c+\xa9o\x93\x9e\x1c/\xfbZmF\x0b#}.*\xea\xa6qG\x03as\xfa\xaf\xe3\x8e\x87eo\xc9\xd6:\x9d@\xb4P\xc6\xaf\x1dO\xf8\xc2\x17\x94?E\x1f\xcd\x0ba\x82\xd5\x9b\xb0c\xf0,\xb8\x8e\xfb\xfe\x8e\x05\xe0\xc3`q\x0e\xa5\xe0\xbc\xb8\x0b\xf2u\xdeD\xec6\xcf\xe4\x17\x86\xb4\xdb\xef?\xec\xf8\xe9\x07|h\x8e\x8d\xf6\xea\xbd\xebA+\xa4\xcd=\x08\xbb\xa8\xdbH\xdf\x96=\x8b\x1e\x16\xbb\\C\xff\x97\xe66=\xed\xddf\xb6\x87\xcf\x82o5\x16\xb2\xbc\xb7M{\xba\xfcr7\xaf\x7fk\x85$\xb9nT\xad/e\xb7\x9f\xfc\x13\x00\x00\xff\xffPK\x07\x08fg\xf4\x1a\xe6\x03\x00\x00\xfd	\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8b\x8emN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0c\x00	\x00malware.tmplUT\x05\x00\x01WC\x89\\d\x91Ao\xd5@\x0c\x84\xef\xfc\n+\\@z$w\xd4W\xc4	\xce@\xc5\xd9\xddu\xb2\xab\xee\xda+\xdbQ\xfa\x14\xed\x7fGi(\x1cz\xb5\xec\xf1\xcc7\xfb\x1ei\xceL0$\xc2\x98y\x19z\xff\x95\x08,;\x01\x1e3\x08\xc2\x8e\x99\x0d*\x96\x0d\x95\xf6\x9d8\xf6\xfe\xee\xffi%3\\h\xe8\xfd\xab;\x86'R\x83\xb0\xaa\x12{\xb9\x810\xec\xfb\xf8\xa0e\xfc.\xe6\xbdC\xcdKr@w\xaa\xcd\xc1\x052\x9bc)\x10\x91\x17RY\x0d\x9a\xca\xa2X\xed8\xbe\xc9\xaa\x10\xa4\xb6\xd5I\xc1\x13:\x98\x13\x16\x10\x85H\x85\x9c\xce\x95\xcc\xb3hE\xcf\xc2\xf0a\x16\x05z\xc6\xda\n]\xa0%q\xb1\x0b44\xdbD\xa3]\xe0\xafe\xbb\x00r\x84\xa0\x14\xb3C@\x8d\xf6q|\x1b0\x92c.6\xf4\xfeMd)\x04\xbf\xe9\x11~d{\x02\xa5p\xa6\xbcCHJ\xf3uH\xee\xcd>O\xd3\xb6m\xe3\xf2\xb2=\x06\xa9\x93+\xb25T\xe2pSj\xa2>\x19\xce\xf4\xa8\xb2Y\xe6e\x8a\x19\x17\x16\xf3\x1c\xa6\xcc\x91\x9e\xc7\xe4\xb5|I\xe5J\xfc\xe9\xe1\xe7\xfbU\xcb\xf5\xa4\xd8\xfbp\x1f\xc9)8\xc5\xd7J\xee&\xbc\x7f\xc3y<\\\x1e=\xda	\x0d\x95\x80\x0fB\xa5\xdc\xe0\xf8\xfd21\xa9\xe4\xb9\x92\x1d\xfcN\xd1-{zU\xfe\x07\xe3O\x00\x00\x00\xff\xffPK\x07\x08\xe5\xab\x14\xc9X\x01\x00\x00)\x02\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8d\x8emN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00	\x00social_engineering.tmplUT\x05\x00\x01ZC\x89\\d\x91A\x8b\xd4L\x10\x86\xef\xdf\xaf(r\xfa\x841\xb9\xcb\xee\x8a \xe8Q\x94\xc5sM\xfaM\xd2L\xa7\xaa\xa9\xaa\xd98\x84\xfe\xef\x92\x11W\xd0[\xf3\xf6\xc3[<U\xfb\x9e0e\x01u\x0b8e\x99\xbb\xd6>bD\x8d\xfc\x02\xf2\x1c >~\xf6\x1d\x92Z\xfb\xef\x0f\xbf\xc2\x9dgt\xad}\x88\xe0\xf1\x02sR\xa1}\xef\x9f\xad\xf4\x9f\xd5\xa35Z\xf9Fay\xbc\xd0M\xaf\x94%\x94\x92f\x99\xc9uE,\xc7+\xb1\xcc0\xbd:\x95|\x01e\xf1\xe0R~1Sll 52\xbc\x80\xef\xe9M\xafF\x15\xe6*\\(\xcb\xa4\xb6rd\x15\xfa\x7fR#\xfc\xe0\xb5\x16\x9c\xa8\xb2\xfb\xa6\x96\xfcDuQ\x01\xc9u=\xc3\xfct\xd4\x8d\x86\x94\x83F\xb6\xe4o\xfa\x7f\xe5\x12\x82s\xf1\xae\xb5O\xaas\x01}\xc7\x99\xbef\xbf\x90a\x84D\xb9QB`\x0c$\xaaK\xf6\xbb\xc9\xdf\xf6==0-\x86\xe9\xb1[\"\xaa\xbf\x1b\x86m\xdb\xfa\xf9\xde\xd8\x8f\xba\x0ea,^\xd9 \xe3\xcdP\xd5bp\x9ep6\xdd<\xcb<\xbc_\xca#\xe4\xed\xf3\xb7\xee\xe9\xcb\xef)\xc7M\xfca\xe0'\xaa\x86\x80$\n\xa53Hc\x81\xd1\x86\xf3\x1d8\xc2\xd7\xc5\xbf\n\xfe\x0c\x00\x00\xff\xffPK\x07\x08\xa5\xae\x1a9>\x01\x00\x00\xee\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8d\x8emN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00	\x00unwanted.tmplUT\x05\x00\x01[C\x89\\d\x91\xc1\x8e\xd40\x0c\x86\xef<\x85U. As_\xed.\xe2\x04g`\xc5\xd9\x93\xbaI4\x89]\xd9\x1e:\xa3*\xef\x8e\xda\x15\xcba\xae\xd1g\xfb\xff\xfel\xdbDsa\x82!\x13N\x85\xd3\xd0\xfb\xafL`\xc5	p\x7f\x83(\xecX\xd8 \xa3\xb6\xf9RaQI\x8a\xcd\xb6\x8dx\xea\xfd\xdd\xff\x1d\x8d\xcc0\xd1\xd0\xfbWw\x8cgR\x03a\xd8\xb6\xf1E\xeb\xf8]\xcc{\x87VRv@wj\x8b\x83\x0b\xb8\x96x\x86\x9b\\\xa0\xb0\x0b\x146\xc7Z\x0b\xa7\xb7K\xe0\x19\xfd\xb8\xbfc\n'\x95\xd5v\x80\xae\x0bi!\x8e\x04\x1ffQ\xa0+\xb6\xa5\xd2'8\xdd f\xe4\xb4C\xc7H\x96F\x0b&\x02Q\xb0,\xeb\xeb\xb4+\x02NG\xc8\xdd\xd8\x8e\x14\x7f\x8a\x15\xff8\xde\xebM\xe4X\xaa\x0d\xbd\x7f\x13I\x95\xe07\x9d\xe0G\xb13(Eb\xaf7xD\xc8J\xf3\xd3\x90\xdd\x17{\x08a]\xd71\x1d\xf4\x18\xa5\x05Wd[P\x89\xe3Mi\x11\xf5`8\xd3?\xa10\x15L,\xe6%\x86\xc2\x13]\xc7\xec\xad~\xc9\xf5\x89\xf8\xf3\xcb\xcf\xf7\x17\xadO\xfb\xe6\x87\x10^K\xed}x\x9e\xe5\xc2\xd3\xdd\xef<\x06|\xbe+\xffM\xeao\x00\x00\x00\xff\xffPK\x07\x08\xcar\xc9\xae:\x01\x00\x00\xf8\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x0b\x8dmN\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00	\x00warning_triangle.svgUT\x05\x00\x01\x87@\x89\\\\\xce=j\xc40\x10\xc5\xf1~O1Lj\xaf\xc6\xcf\x03\x81`m\xb1\xa4H\x91\x1c\"\xb0\x8eF\xe0/b!\x19\x9d>8\xe0f\xcb\x1f\xfcy\xbc~\xcb\x81\xf6i\x9c7\xcf\x96\xd2\xfa\xe6\\)\xe5Z\xba\xeb\xf2\x1b\x1cD\xc4m90\x95\xf8H\xe6\x19\xba\xeeL6\xc4`\xe9T\x8eC\xb9/\xbbg!!(A\x99~\xe28z~y\xbf\xabv\xaf|\xbb\x10\x11\xf5\xebw2zx\xfe\x12\x12\x83f\xe8\x87\xd4\xb3\x9d\x97y`\xf7\\\xb6\x84\xd6\x80\xcf\x16\x04:P\xa7\x16Mg\x0dr\x03CF\x9d\xa4\xd1\x7f\xaa!k=&\xfa\xe3\xf2\xed\xf2\x17\x00\x00\xff\xffPK\x07\x08\xde\xf7\xb8\xd5\xa7\x00\x00\x00\xdb\x00\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x0b\x8dmN{\xdc\x9d\xdbg\x08\x00\x00E\"\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xe8\x81\x00\x00\x00\x00interstitial.cssUT\x05\x00\x01\x87@\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00J\x94mN\xe9\x02\xe6\xcb\x89\x01\x00\x00Y\x03\x00\x00\x11\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa0\x81\xae\x08\x00\x00interstitial.htmlUT\x05\x00\x01,M\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x0b\x8dmNfg\xf4\x1a\xe6\x03\x00\x00\xfd	\x00\x00\x0f\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xe8\x81\x7f\n\x00\x00interstitial.jsUT\x05\x00\x01\x87@\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8b\x8emN\xe5\xab\x14\xc9X\x01\x00\x00)\x02\x00\x00\x0c\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa0\x81\xab\x0e\x00\x00malware.tmplUT\x05\x00\x01WC\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8d\x8emN\xa5\xae\x1a9>\x01\x00\x00\xee\x01\x00\x00\x17\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa0\x81F\x10\x00\x00social_engineering.tmplUT\x05\x00\x01ZC\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8d\x8emN\xcar\xc9\xae:\x01\x00\x00\xf8\x01\x00\x00\x0d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa0\x81\xd2\x11\x00\x00unwanted.tmplUT\x05\x00\x01[C\x89\\PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x0b\x8dmN\xde\xf7\xb8\xd5\xa7\x00\x00\x00\xdb\x00\x00\x00\x14\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa0\x81P\x13\x00\x00warning_triangle.svgUT\x05\x00\x01\x87@\x89\\PK\x05\x06\x00\x00\x00\x00\x07\x00\x07\x00\xf5\x01\x00\x00B\x14\x00\x00\x00\x00"
+	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00interstitial.cssUT\x05\x00\x01\x14R_f\xbcXmo\xe3\xb8\xf1\x7f\xafO1@\xb0\xffM\x02K\x91\xe4\x87\xd8\np\xf8_\xf7\x0em\x81\xeb\xa2\xb8k\xfb\xb6\xa0\xa5\xb1\xcd.E\n\x14\x9d\xd8\xbb\xc8w/HQ\x12)\xcb\x0fyS`\xb1\x88)r8\x0f\xbf\xf9\xcd\x0c\x9f\x1e\xe1\x8b\xa8\x8e\x92nw\n\xd28\x99\xc1?v\x08_vR\x94t_\xc2\xcf{\xb5\x13\xb2\x8e\xe0g\xc6\xc0l\xaaAb\x8d\xf2\x15\x8b(\x00\x80\x7f\xd6\x08b\x03jGk\xa8\xc5^\xe6\x08\xb9(\x10h\x0d[\xf1\x8a\x92c\x01\xeb#\x10\xf8\xd3\x1f\xbf\x84\xb5:2\x04Fs\xe45\x82\xda\x11\x059\xe1\xb0\xc6\x00\x006b\xcf\x0b\xa0\x1c\xd4\x0e\xe1\xb7\xbf~\xf9\xf5\xeb\x1f\xbf\xc2\x862\x8c\xe0\xf1)\x08\x08\xfc\x08\x00r\xc1\x84\xcc@n\xd7\xf7\xb3\xd5\x04\xe6\xb3	\xcc\x17\x0f/\xc1{\x10\xacEq4{\xd6$\xff\xb6\x95ZZh\xb7\xbf\xed\xa8\xc2\x97\x0b\xc7\x016\x82\xabpCJ\xca\x8e\x19|\xfe\x0b\xb2WT4'\xf0\x15\xf7\xf8y\x02\x9f\x7f\xdb\xe7\xb4 \xf0gIx\xa1\x17j\xc2\xeb\xb0FI7\xdd\xe9\x9a~\xc7\x0c\x9e\xe7\x9f\x1au\xf6J	~F!\xb9]\x93\xfb\xe9\xf3\x04\x9e\x17\x13X%\x13H\x8c\x12k!\x0b\x94\x19\xc4\xfd\x8fP\x92\x82\xee\xeb\x0c\xd2\xea\xd0\xac\x1e\xf4E\x94o3\xbb=\\\x8b\x83c\xdb\xddfcT\xca\xf7\xb2\xd6\xb6V\x82r\x85R/m\x98 *k\xc28\xd0:Z>\xcf\xb1\xd4\x8b%\x91[\xca\xad\x0e\x15)\nsU\x12W\x07Hg\x8d\x0eJ\x12^SE\x05\xd7:\x1c\xc2zG\n\xf1\x06i\x1c\x975\xe4\xfb5\xcd\xc35~\xa7(\xef\xe3h6\x81x\x02q\x94\xb66\xeek\x94a\x8d\x0cs\x95\x01\x17\xdc\xc4%,\xc5\xf7\xf0\xcc\x97\xfa\xcc\x877\\\x7f\xa3j\xecc\xe7\xfd\x8c\xe4\x8a\xbe\xe2\xc7\x82 \xf6\x8aQ\x8e\xc6\x03\xbd\xa4\x9d\x06s#\xa8\xb38\x83X\x87\x05\xa6\xd5\xa1\x89\xa8\xb6\xd4\xfc\x8b\xa6\x0f\xe6\xf0]\x81\x8aPV_\xc4n\xef\xf3\xd9\xbc:@\x0c\xf3\xb8:\xf8\xc7\xab\x8c\x0bu\x9fm\xa8\xacU(6\xa1:V\xf8`\x846\xe1\n\x95\xa82H\x87\xe7\xc2Q\x10f@\xf9\x0e%U=\xcal\xb8\xcfkh\xa1\xd3:\xff\x02H\x0cv\x15\x1eTX`.$i`\xb2\xe7\x05J\xed\xd6\xee\xab\x01\xd1F\xc82\x83}U\xa1\xccI\x8dc\xca\x9f\xf1\xbcc\xc2\xa5\xcb\xde\x83`\x97\x0c\xbd\x9f\xc6\xb3	L\x17\x13H\xe2\x87A\x1e$\xd1\xa2I\x03\xc3\x07o\xa8\x19O\xc3J\x96\x84\xe9\xad\xda\x84pg\x97\x93(\xf5\x92&\\\x0b\xa5D\x99A\xb2\xb0\x81\xd8\xa5\x1f\xba;\xbdp\xf7{\x10D;Z\x14\xd8pJA\xeb\x8a\x91c\x1b\x12m\xa7*\x19\xfc\x18\x88L\xe7\x9f:\x8fk\x0bCR\xfcg_+\x9d\xd0\xf1\xa76\xf1\xc6\xbf\xb6\xd9w\xe1\xabM\xc1s;\xb4\xca4?%AZ\x92-f\xb0\x97\xec\xfe\xa9\xda\xaf\x19\xcd\x9f\xde\x88\xe4\x94o\xff\xad$%|\xcb0\xaa_\xb7\x0f/\x1elC\x89\x156 \xb4\x7f\x0e\xbe[\x93\xadrm\x90\x9e-qv\x90\x85\x18f&Q\x00\xdeh\xa1v\xed\x16\xa3\xad\xa6\xcaZQE	\x0b\xdf$\xa9*7\xe9Gi\xd7\x0d \x96#\x18\xb1\x80j\xefObM\xa5d\xafD\x93*%9\x84V\x8fE\xec\xeb\xd5\x98\xf2\x1e\x04wLl\x05\xfcp\xac\x9a-\xab\xc3\x08\xf0\xa6\xcd\xea+J]\xbcXH\x18\xdd\xf2\x0cJZ\x14\xcc\xa4\x9e\xbd)y\x9e\xb7T\xa1E\x87k&\xf2oC\xa8&\x8b\xe9\x04\xda\xff\x86\x89\x12\xad\x1a\xb3l\x85h\x08hn\xf57\x80\xb0w\xe7\xa8}j\xdc{W\x12\xca\xc3\x12\xeb\x9al\x11~\x82\xcaG2\xe5]\xceF\x9c\xbcz\xfewin\x9eT\x87\x93]YF6\xca2t\xce\x90H]\x9a\xd4Nk\x93\x0b\xae\x90\xab\x0c>\x7f~q\xefSd\xcdp\xcc\xddQ]\x12\xc6BF\xf9\x89O\xc6\xba\x06\xbf\x82\xbe\x07\xc1\xff\x97XP\x02\xf7Nh\x9fuh\x1b\xc6>\x0f2\x87JcH\x1a\x18\xbf\x9f\x118K;\x81\x0d\xc9O\xb4\xe8\x81\xe2'\xbc\xed\x91C\xb4l\xe9k@9\xb3\xd8 \xb3\xf5\xba-\x0e\x17y\x1b\xa0\xc7\x96M\xc0\xf7 \x00h\xc9\x1c~x\x02\xb5\xf2\xbaxv\x05\xc3\xdf|\xbe\xdc\xf9HH,\xde\xbc\xd3n\xd1s\xa2m \xee\x9a\xe5\xd6L\x80q\xd0\x9e3\xeb\xc6\x18\xce\xfb\x13\xc3<s4k\x8b\xaa\xb1\xe2\x04\xf9\xbe\xc5\xd3\xce\xe2\xf7 xz|\x0c\xe0\x11\xfe&\xd6\x94!\xd4\x15\xe6tCs\xd0]6\xe5\xdb	l\x84\xd4\xa9o\xc2]@\x9dKD^\xc3\xff\x01#r\x8b2\xd2g\xbf\x92W\xba55\xda\xc2\xa8\x06\"\x11\x08\xcfwBb\x01J\x98v\xbc\xe1\x97\xa6\xd1G+\xc9\x9c\xff\xc5\x86\xb7Mj\x89\x15#9\xd6f\x9f\x12U\x9b|\xba\xaf\xa7\xaa\x06\xf1\xc6\xf5q\xc1\x98N>}\x17\xd1r\x9e.a\x9c\xf0\xa2\xc9\xa5\x8e\xd2\xa7\x8bn]H\x8a\\\xd9.\xa3\x12RIBU\x93\x17\xe3\x80\xf0z\xec\xd6\xb9\x19,5\x12\x1d,F5\xe6\x82\x17D\x1e\xfd\xe3m\xcd\xb3AA^t\xe9\xe1\xc6)Y8q\xeaL\xa3\xbc\xa5\xfat\xe6\x9b\xe6g5\xe1\x85\xb9\x0c\xa09\xd4\x1a>\x8b\x13\xef\xd45\x87t\xfe\x98x\xe2\xba\xcb|iv\xd9\x15\xe6^\xde\xab\xdc\x0bs\x82b	\xe9D\x07FxQ\xe7\xa4\xedW\xd7\xa28\x8e\x81\xdcmO\xbbq\x0d,\xf0:\x17\xfb\xbdw\x98\xea\xee[\xab\xe5\x1ea\xb8Q\x83\x988?{F\x9e\xda\x10u\x19\x1b6'\xd3\xd9p\xdd\x0cL\xde\x07\xd1\x8e?\x1bz\xc0\xa2Y\xfc\x1eR^\xe0!\x83\xe4&\x9a\x18S\xc5\xe31\x1d\xb3\xa6b\xb69\xe4\xf1K\xd7l\xb6\xcd\xcc\x95Jq3h`\x0c5\x03eG\xc4\x9d\x8b?\x8c\x01\xc0\xaf\x06\xb1i\x87:\xaf\xf5\xf5\xac\xf9k\xa4\xaa\xb9\xc3\xfa\xefb-\x94\x08\x7f\xc7\xed\x9e\x119\xe9Fw\xa7\xb0\xd9\n\xbd\x9aNG\xeb\xddbX\xef\x16\xd5\xe1\xa6\x9aw\x8e\xb1\xcfw\x8b\xa7\xe1\xb3\x8d\xdcx\x9di\xb1p\x83\xdc6\x0e\xad+{j\xb3\x96\x88\x8a\xe4T\x1d->\xfd)\xde~\x83t~\xcb\x08\xef\xa9f\x87\x92\x13\xb4\xba\xc3\xcax\x19n5\x1e\xea\xd7\xfe~E\xb9a\xe2-\x83F\x92\x8d\x87\xf3\xf6\xe0\x15\xceV\x1f\x9f\xae\x87\xdeny\xb9\x8f\xc3\x80\xae\x03\x00;0z\xbdR\x12u\xad\x92\xa5\xf9A\xfc\x8cO\xfai\xe7d[\x92z\xfb\xce\xf3\xc2%\xec\xb4\x11\xd5\x14e\x02\xdd\x89\xed\xec\xd1\xd94FT\x12\x19\xd1o!Wt\xa8NM\x8fV\x9d\xe9\x83\xe9wa\x07\x9e\xceX\xe3K\xd7!c\xfc5\x80\xe5\x18\x0c\x93\x9b^\x92\x1aW\x9e\x90\x83W\xe0\xed\x9e\xfdv\x8b\xb5\xc2\xc2P<\xfc\x04wZ%)\x98\x05K=\xf1w\x19\xc2\x1f\xd9\xd6:\xc7\x7f\x0c\xe9\xe3\x12\x9f\xf2\xb0S@g\xf18Cv|{u<\x18bJ\xbf\x17]\xbc2]\xadn\xb9\xf2\xb4\x1c\xb7\xd91\xcc\x9b\x0b\xc6\xcd\xafT\x19\xafk\x18\xa9M\x97\\r6\xad\xd2\x99\x97~W]g\x10\xba\x98]3f\xd9G\xca)}}\x89\x1b\xed\x80>TP\x9d\xdb\xa6\xd3\xa5w[\xa7E:\xaaE\x7fM'\xedR\xbd\xbd\xd9y\xd7A\x90^\xf3\xdb<\x1e\xf7[2\xeb\x96=U?\x8c|\x13\xbe\x95\xe5p\x13\xbe\xa7G\xf8\xfbN\xcf\x12\n\x9a\xf7\x19x|\xf2t\xb3:L\x9f\x1d|:\xce_\xcc\xae\xb5\xd4}\xcc>l\xd1\xc5\xc9\xfc\xe4\xdd\xe8\xd4\xe1I:^\xad\xec\xb2\x01\xbd\xee\xa7\xcc\xb8\x1c\x89\xcdF\x13\xf4\x83\x17\xf2\xd6\x9ee<\xe83\xda\x85\x0b\xc5\xd3\xcd\x99ty\xb5B>cyK%\xf4$]\x8a\xb9\xb5\xf9\xa6\x13#u+\x89b[\xb8\xae\xe0\xdb\xbd`@\x08\xd6W\xb7g\xe2\xf8\xc0\xe4C+]-\x87\xd0r\xb3b\xa4_\xbe!\xbe\xf3x\xd0G\xcec\xcf\xcd\xfd	\x0fJ\xf1M\x91p\x81\xe0\xb5J\x97\x9c\x1a\x1b\xbe\x80\xff\xa9k\xfb@\xdd\xe2\xdaK\xa8\xff\xa0kZ\x8a|\x8e/{\xc7\xf5d\x7f\xc1\x1d\x1e\x14\xf2\x02\xcd\x1b\xb7\x90Jg\xba\xa8TH}\x9d\xbcc>\xf7u\xa09C\x7f\x8b\xe5\x19\x875\xd4|[\xe3\xe14\x9e\xd7mlz\x06\xe7\xa1\xfbd>=}X\x18\x90i\x9f	\xce\xfb\x85\xab\xfc\xf2\xcc\xc1\x8e\x85\xfds\x16[\xb3\xa4o\x8a\\q\xd3t\xda=\xa9\xdeF\xaa\xf3\xc5`x\x9b/<n\xcb\xc5 \x80-L\xbcv\xea\xe9\x11\xfe\x85\xf2\x08\xa6\x93\x85\xd2\xbe\xe65\xafu\x11|\x15\xcd#\x03p\xf2\x1ay\xd1%\x87\xab\xad\xe59Ot\xae\x9f\xae>\xe6\xfak.\\\xadn\x81S7\x0dn\x18Z\x07\xea\xbf\xc2\x82J\xcc\x9b\xd8\xe7\x82\xedK\xfe2\xe6<'ol\x02[\xb1ZF\x06	$\xce\x10|2\x0c\x8c\x8d$7\x1d\x1c\xc9\xe6\xe6\\\xec]82\nu\xc2\x92\x17\x8f\x81\xbd\x97\xaa\xc1cS<|ir\x07\xb8\x91\xc7\x82An\xd9\xefg\xe3\xdb\xe1\x02~\x8c\x9bv\xb3\x8e\xef\xc1{\xf0\xdf\x01\x00PK\x07\x08{\xdc\x9d\xdb\xdb\x08\x00\x00E\"\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x03&O]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x11\x00	\x00interstitial.htmlUT\x05\x00\x01\x07[\xd0jt\x92\xb1n\xdc0\x0c\x86\xf7{\nVS\x0b\xd4'd\xeb k\x08:t\xc8P\xb4\xc8\x03(\x12\xef\xccF\x92\x05\x89\xbe\xc00\xfc\xee\x85-_\xe2;\xb4^LS\x1f\x7f\xfe\xa4\xa5>\xb9\xde\xf2\x98\x10:\x0e^\x1f\xd4\xf2\x02G\xb9\x15\x9e\xb3\x00o\xe2\xb9\x15\xd3t|2\xf1<\xcfb!\xd08}\x00P\x01\xd9\x80\xedL.\xc8\xad\x18\xf8\xd4|\x13\x1f\x07\xd1\x04l\xc5\x85\xf0-\xf5\x99\xc5\x01\xd6\xc7\xf6\x911r+(\x12\x93\xf1M\xb1\xc6c\xfb\xf0\x15\x02E\nC\xf8H\xbc\x91\xe3\xaeux!\x8b\xcd\xfaQ\xd5\x99\xd8\xa3\xfe\x8dv\xc8\xc4#`\xce}V\xb2f\x97\xee\x9e\xe2+d\xf4\xad(<z,\x1d\"\x0b\xe82\x9eZ!\xd3\xf0\xe2\xc9J\x8a\x8c\xb9\xf0j\xe1hK\xa9\xca\xc5fJ\x0c%\xdb\xff\x90\x7f\x8a\xd0JVL\x1f\x94\xac\xabP/\xbd\x1b\x81\\+\x96\xa0J9\xba\x80\xf5\xa6\x94V\xec{5o\xd9\xa4\x84y\x856l)\x0c\x86b\xb3\xedf;\xbb\x13\xb1}\x14+\xbaFZIG\x97\x1b\xf0]&`)\xe6\x8c\xef2\x00\xaa{\xd0\xd3\xc4\x18\x927\x8c \x16\xdb\x14\xcf\x02\x8e\xf3\xacd\xf7\xb0#\xd3\x0dx\x95\xaa`\xbar\xbb\xe6\xfbp7s4\x97\xbbQ\x01\xd4\xcb\xc0\xdc\xc7\xd5h\xca\x14L\x1e\x9b\x9a\x12\xfa\xd1\xd8W\xe0\x1e\x8a9!\x8fJ\xd6\xfc\xbf*\x1d\xb2!_\xae\x95\xd7%\x97`\xbco\x96_/\xf4\xf7\x8a\xdc\xaa\xdc\x1b\xddi\xbd\x8bt\xe4\x1c\xc6\x0f\xc3\xb7\xcb\xd8:\xdf/c\x9a\xe8\x04\xc7\xc71\x99R\x9e\x7f=\xcd\xb3JZ\x99m\xca\xde\"\xbajk\xbb\x81\xd3\xb4g\x85\xfeY\x99e\xf8i:>g\x7f\xfc\xd1\x17\x9eg\xf8<\xc4e\x1b_\x944Z\xc9\xc5\nF7\xcf\xb7\xc3l\x81\x92\xcb\xcd\xd3\x07%;\x0e^\x1f\xfe\x0e\x00PK\x07\x08\x02\x0fc\xc9\xd2\x01\x00\x00\xd6\x03\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0f\x00	\x00interstitial.jsUT\x05\x00\x01\x14R_f\x94V_o\xdb\xb6\x17}\xd7\xa78\xf5\xaf\x80l\xff\x1c9K\x83\x0dH`\xaci\x92.\xc6R\x07\x8b\xd3\x15}\x1ah\xf1\xda\"J\x91*I\xd9\xf1R\x7f\xf7\x81\x94\x94J\xf9\xb7\xee-!\xef=\xf7\xf2\x9cs\xaf<\x1e\x0e#\x9c\xeabk\xc4*s8\xd8?x\x83\xdf\xb4^I\xc2\xe5\xe5i\x14a\x88K\x91\x92\xb2\xc4Q*N\x06.#\x9c\x14,\xcd\xa8\xb9\x19\xe1O2Vh\x85\x83d\x1f}\x1f\xd0\xab\xafz\x83c\x0f\xb1\xd5%r\xb6\x85\xd2\x0e\xa5%\xb8LX,\x85$\xd0mJ\x85\x83PHu^H\xc1TJ\xd8\x08\x97\x85:5J\xe21>\xd7\x18z\xe1\x98P`Hu\xb1\x85^\xb6\x03\xc1\\\x14\x01\xc0\x10\x99s\x85=\x1a\x8f7\x9bM\xc2B\xbb\x896\xab\xb1\xac\x02\xed\xf8rzz>\x9b\x9f\xef\x1d$\xfbM\xcaG%\xc9Z\x18\xfaZ\nC\x1c\x8b-XQH\x91\xb2\x85$H\xb6\x816`+C\xc4\xe1\xb4\xefyc\x84\x13j5\x82\xd5K\xb7a\x86j$.\xac3bQ\xba\x0ekM\x93\xc2v\x02\xb4\x02S\xe8\x9d\xcc1\x9d\xf7\xf0\xeed>\x9d\x8fj\x9cO\xd3\x9b\x8b\xab\x8f7\xf8tr}}2\xbb\x99\x9e\xcfqu\x8d\xd3\xab\xd9\xd9\xf4fz5\x9b\xe3\xea=Nf\x9f\xf1\xfbtv6\x02	\x97\x91\x01\xdd\x16\xc6\xbfC\x1b\x08O)\xf1\xa4\x86\x9b\x13u\x1aY\xeaJN[P*\x96\"\x85djU\xb2\x15a\xa5\xd7d\x94P+\x14dra\xbd\xba\x16L\xf1\x1aI\x8a\\8\xe6\xc2\xe9w[\xd4\xb8I4\x1cGQp\xd6\x10'R0\x1b*q\x9d\x969)\x97\xac\xc8\x9dK\xf2\x7f\xbe\xdbNy\x82\xf7\xbaT\x1cT\x1dY\xe4\xa5uX\x10.n>\\\xd6q68\xe0m\xc1\x0c\xcbq\xe7\xa9S\xab\x1d\x04\xc7MF\x98\x9e5.\xa8!\xbc8K\xa1\xfc\xb3\x87xk\xc8\x95F\xe1\xae\x05\xb7\x0by\xcbvY\xcf\x96*\xa5\x84X\x06\x97\x86K\x0f0\x8e\x96\xa5J\xfdK\xf1\xba/\xf8\x00w\x11\xb0f\x06$1y\xeeM>\xf08\x02\xea\xda$\x8f\xa3]`\x043\x96\x93-XJ	\x86\xe3\xc8\xe3\x08\xe5\xc8X'\x9c`\x1e\xb1\xf3\xef\xb7o\xb8\xdb\x1dG\xf7d~\xca(H\xec\xc9.\xbcN\xc2\"-\x8d!\xe5\xe4\x16\x0b\xf2\x82\xad\x05m\x88\x8390\xf4r\xbd\x10\x92z\xb0\xa9!R\xb0\xe2\xefj\x98\xde\xbamA\xb8[h-\x89\xa9]\xc5\xae\x11k\xe6(\xbc\xb9\xddER\x81\xcc\xd8\xfa/L\xb0d\xd2R\xab\xa599\x94\x05h\xedI\xcc\x98\xe2\x92L\xa5\xf7\xc7\xe9\xbd\xa6\xc9cPK\xae,\xce}\x96\xf5\xa85\xc7\xfd\x8a\xdf\xf18(\xd4[\xb0\xf4\x8bW\xd3\xb2%\xb9m\x0f\x8b\xd29\xad\xbc\x9d_\xf7\xe3\xc2\x88\x9c\x99\xed^u\x18\x0f\x12\xc6y\x00\xbc\x14\xd6\x91\"\xd3\x8fS)\xd2/\xf1\xe8!<\xb0\x11\x8a\xebM\x92	\xeb\xb4\xd9&\xbeN?(\xb6\x1b\x1cG\xad\x06\xce\xc81!\xed\x83\xca\xbc:\xfdO\x95\x03AMy\xaf{&8'U\x17\xc0\xa4\x85\x1b\x0f\x92T2k=Z\xe2\xf4j%\xa9\x1fW\xe1q\xd5\x1e\xbcM\xfb\xcf\x884\x08\x01\xf0\x809\x13j/\xd5\xca\x91r/\xa1\x8e\xf0\xaa\xd3N\xa0\x02 i\xe9\x07\xc0\x0c\xe5z\xfd\xb8\xc5\xa7\x88\x12J\x91\xb9\xa1[\x87\xc9\x03\x02~E\\s\x11\xe3\x08\xf1\x85\xe0\x84\x9a\xe7\xb8+\xccE0\x19\x0cy7W\xc6\xf3\x06k4}\xec\x82*2\x1euf+\xd1\xea:\x9c\x87\xb7>y\xe3\x1d\xd1\x9e\xbe\xf7\xda\xc0\xe6L\xcaf\x9c\xaa\xc1\x18\x85qTl-Va#\xd6^\xb1`\x86\xe0\x99\xe1X\x90\xd4\x9b\x10\xc6\xf8\xda\x7f\xe2\xb8\x9f8G\xb7\xee\x89\xc9h\x1a{<\x16\xc16$\x8b\xab\xd2\x91y\xa7o\xdb\x0b\xe8kIf;'I\xa9\xd3\xa6\x1f\xff\xaf\xe1.<\xcf'z/\x9cVVx)\xafk\x99\xfbd\xe2\x82\xfd\xe1K`\x82\xb8\x9f\x0b\xb5\xb7\x11\xdceG88\xdc/n\x07\xfe\xd3\x80~\xcen\x9b\xe3\xc3\x83\xfb\xe3\x18\xff\xafM\x14\x87\x88\x8c\xfcO\x8d#\xfc\xf2\xe6\xe7&$\x006\xe7\x87\xfb?=\x95\xaa\x8d U}s\x8ePh\xe3\x0c\x13n0\xeaTmA>W\xb5\xd5X\xa7j\xeb\x1d\x9d\xd4\xef/=<\xb8\xef\xab\xdb\x8cd\x8a\xdb\x94\x154\x88\x83G=\xdb5\xfd\x17a\xaa0\xe9\xc8\xd6\x9aC?NL(\xfb`x\xc6c\x9cf\x94~	{4\xcd\x98\xf2\xab^y\x8f\xc1:\xe6\xca\xe0\xf7\x17V\x00^M\x9aq\xc8\x99K\xb3\x0f^\xbe\xfew\x11\x07\xd51\xd9f!=\x873\xc1\xabg\xae~`\x0f\xd5\xd8h[\xef\xc5\x1d\xd4!\xad\xdeAx\x8e\xbaG\xe9Oe\xef\xc2\x0e\x0b]>@\xff\x97\xe6\x1e\xef\xb4\x17\x9by:|\xe7\xf7V\xb5B\xee\x7f(<^OgW\x1fjr.5\xe3\xc4\x1f.\xaa\xd6\x97rp\x1c\xfd3\x00PK\x07\x08\\/\xbd\x95\xd1\x04\x00\x00\xb1\x0b\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0c\x00	\x00malware.tmplUT\x05\x00\x01\x14R_fd\x91Ao\xd5@\x0c\x84\xef\xfd\x15V\xb8\x80\xf4H\xee\xa8\xaf\x88\x13\x9c\x81\x8a\xb3\xbb\xebdW\xdd\xb5W\xb6\xa3\xf4)\xda\xff\x8e\xd2Pq\xe8\xd5\xb2\xc73\xdf\xec{\xa493\xc1\x90\x08c\xe6e\xe8\xfdw\"\xb0\xec\x04x\xcc \x08;f6\xa8X6T\xdaw\xe2\xd8\xfb\xdd\xff\xd3Jf\xb8\xd0\xd0\xfb7w\x0c\xcf\xa4\x06aU%\xf6r\x03a\xd8\xf7\xf1Q\xcb\xf8C\xcc{\x87\x9a\x97\xe4\x80\xeeT\x9b\x83\x0bd6\xc7R \"/\xa4\xb2\x1a4\x95E\xb1\xdaq|\x93U!Hm\xab\x93\x82't0', \n\x91\n9\x9d+\x99g\xd1\x8a\x9e\x85\xe1\xe3,\n\xf4\x82\xb5\x15\xba@K\xe2b\x17hh\xb6\x89F\xbb\xc0?\xcbv\x01\xe4\x08A)f\x87\x80\x1a\xed\xd3\xf8>`$\xc7\\l\xe8\xfd\xbb\xc8R\x08\xfe\xd0\x13\xfc\xcc\xf6\x0cJ\xe1Ly\x8f\x90\x94\xe6\xeb\x90\xdc\x9b}\x99\xa6m\xdb\xc6\xe5u{\x0cR'Wdk\xa8\xc4\xe1\xa6\xd4D}2\x9c\xe9Ie\xb3\xcc\xcb\x143.,\xe69L\x99#\xbd\x8c\xc9k\xf9\x9a\xca\x95\xf8\xf3\xe3\xaf\x0f\xab\x96\xebI\xb1\xf7\xe1!\x92Sp\x8ao\x95\xdcO\xf8\xf0\x8e\xf3x\xb8<z\xb4\x13\x1a*\x01\x1f\x84J\xb9\xc1\xf1\xfbubR\xc9s%;\xf8\x9d\xa2[\xf6\xf4\xa6<\xee;q\xec\xfd\xee\xef\x00PK\x07\x08\xe5\xab\x14\xc9X\x01\x00\x00)\x02\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x17\x00	\x00social_engineering.tmplUT\x05\x00\x01\x14R_fd\x91A\x8b\xd5P\x0c\x85\xf7\xf3+BW\n\xcfv/3#\x82\xa0KQ\x06\xd7y\xbd\xa7\xed\xe5\xdd&\x97$o\xea\xa3\xdc\xff.}\xa0\x82\xee\xc29\x87$_\xb2\xef	S\x16P\xb7\x80S\x96\xb9k\xed\x13F\xd4\xc8\xaf \xcf\x01\xe2\xc3\xd9wHj\xed\xe1o~\x85;\xcf\xe8Z\xfb\x18\xc1\xe3\x05\xe6\xa4B\xfb\xde\xbfX\xe9\xbf\xa8Gk\xb4\xf2\x8d\xc2\xf2x\xa1\x9b^)K(%\xcd2\x93\xeb\x8aX\x8e*\xb1\xcc0\xbd:\x95|\x01e\xf1\xe0R\x0e\xc7u\x8a\x8d\x0d\xa4F\x86W\xf0]\xbd\xe9\xd5\xa8\xc2\\\x85\x0be\x99\xd4V\x8e\xacBo&5\xc2O^k\xc1\x89*\xbboj\xc9OT\x17\x15\x90\\\xd73\xccO\xa4F\xa3!\xe5\xa0\x91-\xf9\xdb\xfe\x7f\xb8\x84\xe0\\\xbck\xed\xb3\xea\\@?p\xa6o\xd9/d\x18!Qn\x94\x10\x18\x03\x89\xea\x92}96\xfb\x97\xbe\xa7G\xa6\xc50=uKD\xf5\xf7\xc3\xb0m[?\xdf;\xf6\xa3\xaeC\x18\x8bW6\xc8x3T\xb5\x18\x9c'\x9cM7\xcf2\x0f\x1f\x96\xf2\x04y\xf7\xf2\xbd{\xfe\xfa{\xca\xf1\x13\x7f\x1c\xf8\x99\xaa! \x89B\xe9\x0c\xd2X`\xb4\xe1|\x0f\x1c\xe2\x9f\xc3\xf7\xfb\x0eI\xad=\xfc\x1a\x00PK\x07\x08\xa5\xae\x1a9?\x01\x00\x00\xee\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00	\x00unwanted.tmplUT\x05\x00\x01\x14R_fd\x91A\x8f\x131\x0c\x85\xef\xfb+\xac\xe1\x02\x12\xcc\xdcW\xdbE\x9c\xe0\x0cT\x9c\xdd\xc4\x93DM\xec\x91\xed2\xadF\xf9\xefh\x8a`\x0f\xbd&\x9f\xdf\xf3{\xde\xb6Hsa\x82!\x13\xc6\xc2i\xe8\xfdg&\xb0\xe2\x04\xb8\xbfA\x10v,l\x90Q\xdb|\xa9\xb0\xa8$\xc5f\xdbF\x1c{\x7fz\xd3hd\x86\x89\x86\xde\xbf\xb8c8\x93\x1a\x08\xc3\xb6\x8dG\xad\xe371\xef\x1dZI\xd9\x01\xdd\xa9-\x0e.\xe0Z\xc2\x19nr\x81\xc2.P\xd8\x1ck-\x9c\xfe;\x81g\xf4\xbb\xff\x8e)\x9cTV\xdb\x01\xba.\xa4\x858\x10\xbc\x9fE\x81\xae\xd8\x96J\x1f\xe1t\x83\x90\x91\xd3\x0e\xddG\xb24Z0\x11\x88\x82eY\xf7\x0f\xba\xba\"`\xbc/\xb9'\xb6\x9d\x85\xdf\xc5\x8a\x7f\x18\x1f\xe3Er,\xd5\x86\xde\xbf\x8a\xa4J\xf0\x8bN\xf0\xbd\xd8\x19\x94\x02\xb1\xd7\x1b\xbc d\xa5\xf90d\xf7\xc5\x9e\xa7i]\xd71\xdd\xe91H\x9b\\\x91mA%\x0e7\xa5E\xd4'\xc3\x99\xfe\x05\x9ab\xc1\xc4b^\xc2T8\xd2u\xcc\xde\xea\xe7\\\x0f\xc4\x9f\x8e?\xde]\xb4\x1ev\xe5\xe7i\xfa[j\xef\xc3\xeb,\x17\x8e\x0f\xd7y\x99\xf0\xf5\xa1\xfcq\xdb\x88c\xefO\x7f\x06\x00PK\x07\x08\xcar\xc9\xae<\x01\x00\x00\xf8\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00V\x8d\xc4X\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x14\x00	\x00warning_triangle.svgUT\x05\x00\x01\x14R_f\\\xca\xbdJ\xc5@\x10\x06\xd0>O1\x8cu\xeeN\xbe\x0c\x08\x92Mq\xb1\xb0\xd0\x87\x10n\xdc	\xe4\x0f\xb3\xcc\x86<\xbd(\xa4\xb1<p\xba\xdd\x13\x1d\xf3\xb4\xec\x91-\xe7\xed%\x84R\xca\xad\xb4\xb7\xf5;\x05\x88H\xd8=1\x95\xf1\x91-2t;\x98l\x18\x93\xe5K>\x0e\xe5\xbe\x1e\x91\x85\x84\xa0\x04e\xfa\x1a\xa7)\xf2\xd3\xeb]\xb5}\xe6\xbe\"\"\xea\xb6\xcfl\xf4\x88\xfc!$\x06u\xe8\x9b\x9c\xd7]\xd6e\xe0\xf0\x7f6\x84\xc6\x80\xf7\x06\x04\xfa\xc597\xa8[\xab\xe15\x0c\x8es\x96Z\xff\xa8\x06\xd7\x93C_ua\xf7\xd4W?\x03\x00PK\x07\x08\xde\xf7\xb8\xd5\xa3\x00\x00\x00\xdb\x00\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X{\xdc\x9d\xdb\xdb\x08\x00\x00E\"\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x00\x00\x00\x00interstitial.cssUT\x05\x00\x01\x14R_fPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x03&O]\x02\x0fc\xc9\xd2\x01\x00\x00\xd6\x03\x00\x00\x11\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\"	\x00\x00interstitial.htmlUT\x05\x00\x01\x07[\xd0jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X\\/\xbd\x95\xd1\x04\x00\x00\xb1\x0b\x00\x00\x0f\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81<\x0b\x00\x00interstitial.jsUT\x05\x00\x01\x14R_fPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X\xe5\xab\x14\xc9X\x01\x00\x00)\x02\x00\x00\x0c\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81S\x10\x00\x00malware.tmplUT\x05\x00\x01\x14R_fPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X\xa5\xae\x1a9?\x01\x00\x00\xee\x01\x00\x00\x17\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xee\x11\x00\x00social_engineering.tmplUT\x05\x00\x01\x14R_fPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X\xcar\xc9\xae<\x01\x00\x00\xf8\x01\x00\x00\x0d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81{\x13\x00\x00unwanted.tmplUT\x05\x00\x01\x14R_fPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00V\x8d\xc4X\xde\xf7\xb8\xd5\xa3\x00\x00\x00\xdb\x00\x00\x00\x14\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xfb\x14\x00\x00warning_triangle.svgUT\x05\x00\x01\x14R_fPK\x05\x06\x00\x00\x00\x00\x07\x00\x07\x00\xf5\x01\x00\x00\xe9\x15\x00\x00\x00\x00"
 	fs.Register(data)
 }
@@ -0,0 +1,149 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+const streamSearchPath = "/v1/uris:stream"
+
+const (
+	// streamConcurrency is the number of URIs looked up concurrently for
+	// each stream.
+	streamConcurrency = 16
+
+	// maxStreamMessageBytes is the maximum size of a message sent by a
+	// stream client.
+	maxStreamMessageBytes = 64 << 10
+)
+
+// streamRequest is a message sent by a client of the streaming endpoint.
+type streamRequest struct {
+	ID  string `json:"id,omitempty"`
+	URI string `json:"uri"`
+}
+
+// streamVerdict is a message sent to a client of the streaming endpoint.
+// The ID is that of the request the verdict is for.
+type streamVerdict struct {
+	ID string `json:"id,omitempty"`
+	uriVerdict
+}
+
+// streamHandshake accepts the WebSocket connections of clients that are not
+// browsers, which do not send an Origin header, and of pages served by the
+// same origin or by an origin allowed by the CORS policy p.
+func streamHandshake(p *corsPolicy) func(*websocket.Config, *http.Request) error {
+	return func(config *websocket.Config, req *http.Request) error {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			return nil
+		}
+		if strings.TrimPrefix(strings.TrimPrefix(origin, "http://"), "https://") == req.Host {
+			return nil
+		}
+		if p != nil && p.allowOrigin(origin) {
+			return nil
+		}
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+}
+
+// newStreamSearchHandler returns the handler of the "/v1/uris:stream"
+// endpoint. Clients connect with a WebSocket and send a JSON message with a
+// URI, and optionally an ID, for every URI to look up. The verdict of every
+// URI is sent back as a JSON message as soon as it is known, along with the ID
+// of the request. Verdicts are thus not necessarily sent in the order of the
+// requests.
+func newStreamSearchHandler(ul urlLooker, p *corsPolicy) http.Handler {
+	return websocket.Server{
+		Handshake: streamHandshake(p),
+		Handler: func(ws *websocket.Conn) {
+			serveStream(ws, ul)
+		},
+	}
+}
+
+// serveStream looks up the URIs received on ws until the client closes it.
+func serveStream(ws *websocket.Conn, ul urlLooker) {
+	defer ws.Close()
+	ws.MaxPayloadBytes = maxStreamMessageBytes
+	ctx := ws.Request().Context()
+
+	reqs := make(chan streamRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < streamConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sreq := range reqs {
+				v := streamVerdict{ID: sreq.ID, uriVerdict: uriVerdict{URI: sreq.URI}}
+				if schemePolicy.ValidURL(sreq.URI) {
+					results, err := ul.LookupURLResults(ctx, []string{sreq.URI})
+					if err = lookupError(err); err != nil {
+						v.Error = err.Error()
+					} else {
+						recordLookups(ctx, []string{sreq.URI}, results)
+						v.uriVerdict = newURIVerdict(sreq.URI, results[0], nil)
+					}
+				} else {
+					v.Error = "invalid URI"
+				}
+				// Conn serializes concurrent writes of whole messages.
+				if err := websocket.JSON.Send(ws, v); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(reqs)
+
+	for {
+		var sreq streamRequest
+		err := websocket.JSON.Receive(ws, &sreq)
+		var serr *json.SyntaxError
+		var terr *json.UnmarshalTypeError
+		switch {
+		case err == nil:
+		case errors.Is(err, websocket.ErrFrameTooLarge):
+			err = errors.New("message too large")
+		case errors.As(err, &serr), errors.As(err, &terr):
+			err = fmt.Errorf("invalid request: %v", err)
+		default:
+			// The client closed the stream.
+			return
+		}
+		if err != nil {
+			if err := websocket.JSON.Send(ws, streamVerdict{uriVerdict: uriVerdict{Error: err.Error()}}); err != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case reqs <- sreq:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
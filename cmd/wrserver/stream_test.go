@@ -0,0 +1,88 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+	"golang.org/x/net/websocket"
+)
+
+func TestStreamSearch(t *testing.T) {
+	fl := &fakeLooker{threats: map[string][]webrisk.URLThreat{
+		"http://bad.example.com/": {{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware}},
+	}}
+	srv := httptest.NewServer(withAccessLog(newStreamSearchHandler(fl, nil)))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	ws, err := websocket.Dial(wsURL, "", "http://evil.example.com")
+	if err == nil {
+		ws.Close()
+		t.Errorf("unexpected success connecting from a cross-origin page")
+	}
+	if err := streamHandshake(nil)(nil, httptest.NewRequest("GET", streamSearchPath, nil)); err != nil {
+		t.Errorf("unexpected error accepting a client without origin: %v", err)
+	}
+	ws, err = websocket.Dial(wsURL, "", srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ws.Close()
+
+	reqs := []streamRequest{
+		{ID: "1", URI: "http://good.example.com/"},
+		{ID: "2", URI: "http://bad.example.com/"},
+		{ID: "3", URI: "http://[::1/"},
+	}
+	for _, r := range reqs {
+		if err := websocket.JSON.Send(ws, r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := websocket.Message.Send(ws, "not json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]streamVerdict)
+	for i := 0; i < len(reqs)+1; i++ {
+		var v streamVerdict
+		if err := websocket.JSON.Receive(ws, &v); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got[v.ID] = v
+	}
+	want := map[string]streamVerdict{
+		"1": {ID: "1", uriVerdict: uriVerdict{URI: "http://good.example.com/"}},
+		"2": {ID: "2", uriVerdict: uriVerdict{
+			URI:         "http://bad.example.com/",
+			ThreatTypes: []string{"MALWARE"},
+			Matches:     []uriMatch{{ThreatType: "MALWARE", Pattern: "bad.example.com/"}},
+		}},
+		"3": {ID: "3", uriVerdict: uriVerdict{URI: "http://[::1/", Error: "invalid URI"}},
+	}
+	for id, w := range want {
+		if !reflect.DeepEqual(got[id], w) {
+			t.Errorf("verdict %s = %+v, want %+v", id, got[id], w)
+		}
+	}
+	if v := got[""]; !strings.HasPrefix(v.Error, "invalid request") {
+		t.Errorf("verdict of invalid message = %+v, want an invalid request error", v)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const submitPath = "/v1/uris:submit"
+
+// submissionAPIURL is the root URL of the Web Risk Submission API.
+const submissionAPIURL = "https://webrisk.googleapis.com"
+
+// metadataTokenURL is the URL of the access token of the default service
+// account in the metadata server of Google Cloud.
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// submissionAbuseTypes are the abuse types that URLs may be reported for.
+var submissionAbuseTypes = map[string]bool{
+	"MALWARE":            true,
+	"SOCIAL_ENGINEERING": true,
+	"UNWANTED_SOFTWARE":  true,
+}
+
+// submissions forwards the URLs reported to the submission endpoint, if it is
+// enabled with -submitProject.
+var submissions *submitter
+
+// submitRequest is the body of a request to the submission endpoint.
+type submitRequest struct {
+	URI       string `json:"uri"`
+	AbuseType string `json:"abuseType,omitempty"` // Defaults to SOCIAL_ENGINEERING
+	Comment   string `json:"comment,omitempty"`   // Only recorded in the audit log
+}
+
+// submitResponse is the body of a response of the submission endpoint.
+type submitResponse struct {
+	Operation string `json:"operation"`           // Name of the operation of the Submission API
+	Duplicate bool   `json:"duplicate,omitempty"` // Whether the URI was already submitted recently
+}
+
+// submitAuditEntry is the record of a submission in the audit log.
+type submitAuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	RemoteIP  string    `json:"remoteIp"`
+	URI       string    `json:"uri"`
+	AbuseType string    `json:"abuseType"`
+	Comment   string    `json:"comment,omitempty"`
+	Operation string    `json:"operation,omitempty"`
+	Duplicate bool      `json:"duplicate,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// submitter forwards reports of suspected phishing and malware URLs to the Web
+// Risk Submission API on behalf of internal tools, so that the credentials of
+// the Submission API are held by wrserver alone. URIs submitted again within
+// dedupWindow are not forwarded again, and every submission is recorded in an
+// audit log.
+type submitter struct {
+	project     string
+	apiURL      string
+	accessToken func(ctx context.Context) (string, error)
+	client      *http.Client
+	dedupWindow time.Duration
+	limiter     *rateLimiter // Limits the submissions of every client, if not nil
+	now         func() time.Time
+
+	mu     sync.Mutex
+	audit  io.Writer             // Written to the application logs if nil
+	recent map[string]submission // Keyed by URI
+}
+
+// submission is a URI recently submitted, or being submitted if operation is
+// empty.
+type submission struct {
+	operation string
+	time      time.Time
+}
+
+// newSubmitter returns a submitter of the URIs reported to the Submission API
+// with the quota of project, authenticated with the access tokens returned by
+// accessToken. Submissions are recorded as lines of JSON written to audit, or
+// to the application logs if audit is nil.
+func newSubmitter(project string, accessToken func(context.Context) (string, error), dedupWindow time.Duration, audit io.Writer) *submitter {
+	return &submitter{
+		project:     project,
+		apiURL:      submissionAPIURL,
+		accessToken: accessToken,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		dedupWindow: dedupWindow,
+		now:         time.Now,
+		audit:       audit,
+		recent:      make(map[string]submission),
+	}
+}
+
+// fileAccessToken returns a function returning the access token stored in the
+// file at path. The file is read on every call, so that the token can be
+// refreshed by another process.
+func fileAccessToken(path string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("no access token in %s", path)
+		}
+		return token, nil
+	}
+}
+
+// metadataAccessToken returns a function returning the access token of the
+// default service account of the Compute Engine instance, GKE pod or Cloud Run
+// service wrserver runs on, fetched from tokenURL. Tokens are reused until
+// shortly before they expire.
+func metadataAccessToken(tokenURL string) func(context.Context) (string, error) {
+	var mu sync.Mutex
+	var token string
+	var expiry time.Time
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expiry) {
+			return token, nil
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("metadata server returned %s", resp.Status)
+		}
+		var t struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int64  `json:"expires_in"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+			return "", err
+		}
+		token = t.AccessToken
+		expiry = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+		return token, nil
+	}
+}
+
+// reserve returns the operation of uri if it was submitted within the dedup
+// window. Otherwise, it records that uri is being submitted and returns ok.
+func (s *submitter) reserve(uri string) (operation string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for u, sub := range s.recent {
+		if sub.operation != "" && now.Sub(sub.time) >= s.dedupWindow {
+			delete(s.recent, u)
+		}
+	}
+	if sub, dup := s.recent[uri]; dup {
+		return sub.operation, false
+	}
+	s.recent[uri] = submission{time: now}
+	return "", true
+}
+
+// release records the outcome of the submission of uri reserved earlier.
+func (s *submitter) release(uri, operation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if operation == "" {
+		delete(s.recent, uri)
+		return
+	}
+	s.recent[uri] = submission{operation: operation, time: s.now()}
+}
+
+// submit submits uri to the Submission API and returns the name of the
+// operation processing it.
+func (s *submitter) submit(ctx context.Context, uri, abuseType string) (string, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to get an access token: %v", err)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"submission": map[string]string{"uri": uri},
+		"threatInfo": map[string]string{"abuseType": abuseType},
+	})
+	if err != nil {
+		return "", err
+	}
+	u := s.apiURL + "/v1/projects/" + url.PathEscape(s.project) + "/uris:submit"
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", mimeJSON)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Submission API returned %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	var op struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &op); err != nil || op.Name == "" {
+		return "", fmt.Errorf("unexpected Submission API response: %s", bytes.TrimSpace(b))
+	}
+	return op.Name, nil
+}
+
+// record writes e to the audit log.
+func (s *submitter) record(e *submitAuditEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		appLog.Errorf("Unable to encode submission audit entry: %v", err)
+		return
+	}
+	if s.audit == nil {
+		appLog.Infof("Submission: %s", b)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.audit.Write(append(b, '\n')); err != nil {
+		appLog.Errorf("Unable to write submission audit entry: %v", err)
+	}
+}
+
+// serveSubmit implements the "/v1/uris:submit" endpoint, which forwards the
+// URI in the request body to the Submission API unless it was submitted
+// recently.
+func (s *submitter) serveSubmit(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	var sreq submitRequest
+	if err := json.NewDecoder(req.Body).Decode(&sreq); err != nil {
+		http.Error(resp, "invalid request: "+err.Error(), requestErrorCode(err))
+		return
+	}
+	sreq.URI = strings.TrimSpace(sreq.URI)
+	if u, err := url.Parse(sreq.URI); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(resp, "invalid uri", http.StatusBadRequest)
+		return
+	}
+	if sreq.AbuseType == "" {
+		sreq.AbuseType = "SOCIAL_ENGINEERING"
+	}
+	if !submissionAbuseTypes[sreq.AbuseType] {
+		http.Error(resp, fmt.Sprintf("invalid abuseType %q", sreq.AbuseType), http.StatusBadRequest)
+		return
+	}
+
+	e := &submitAuditEntry{
+		Time:      s.now(),
+		RequestID: resp.Header().Get(requestIDHeader),
+		RemoteIP:  clientIP(req),
+		URI:       sreq.URI,
+		AbuseType: sreq.AbuseType,
+		Comment:   sreq.Comment,
+	}
+	defer s.record(e)
+
+	op, ok := s.reserve(sreq.URI)
+	if !ok {
+		e.Operation, e.Duplicate = op, true
+		if op == "" {
+			http.Error(resp, "uri is being submitted", http.StatusConflict)
+			return
+		}
+		serveJSON(resp, submitResponse{Operation: op, Duplicate: true})
+		return
+	}
+	op, err := s.submit(req.Context(), sreq.URI, sreq.AbuseType)
+	s.release(sreq.URI, op)
+	if err != nil {
+		e.Error = err.Error()
+		appLog.Errorf("Unable to submit %s: %v", sreq.URI, err)
+		code := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			code = http.StatusGatewayTimeout
+		}
+		http.Error(resp, err.Error(), code)
+		return
+	}
+	e.Operation = op
+	serveJSON(resp, submitResponse{Operation: op})
+}
+
+// newSubmitterFromFlags returns a submitter configured with the -submit flags.
+func newSubmitterFromFlags() (*submitter, error) {
+	if *submitTokenFlag == "" {
+		return nil, errors.New("-submitProject requires -submitToken")
+	}
+	accessToken := metadataAccessToken(metadataTokenURL)
+	if *submitAccessTokenFlag != "" {
+		accessToken = fileAccessToken(*submitAccessTokenFlag)
+	}
+	var audit io.Writer
+	if *submitAuditLogFlag != "" {
+		f, err := os.OpenFile(*submitAuditLogFlag, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		audit = f
+	}
+	s := newSubmitter(*submitProjectFlag, accessToken, *submitDedupWindowFlag, audit)
+	if *submitRateLimitFlag > 0 {
+		var err error
+		if s.limiter, err = newRateLimiter(*submitRateLimitFlag/60, int(math.Ceil(*submitRateLimitFlag)), rateLimitByIP); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
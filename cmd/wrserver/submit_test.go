@@ -0,0 +1,126 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubmit(t *testing.T) {
+	var mu sync.Mutex
+	var forwarded []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Path, "/v1/projects/my-project/uris:submit"; got != want {
+			t.Errorf("Submission API path = %q, want %q", got, want)
+		}
+		if got, want := r.Header.Get("Authorization"), "Bearer access-token"; got != want {
+			t.Errorf("Submission API Authorization = %q, want %q", got, want)
+		}
+		var body struct {
+			Submission struct{ URI string }
+			ThreatInfo struct{ AbuseType string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.Contains(body.Submission.URI, "reject") {
+			http.Error(w, `{"error":{"code":400}}`, http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		forwarded = append(forwarded, body.Submission.URI+" "+body.ThreatInfo.AbuseType)
+		n := len(forwarded)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"name":"projects/my-project/operations/%d"}`, n)
+	}))
+	defer api.Close()
+
+	var audit bytes.Buffer
+	s := newSubmitter("my-project", func(context.Context) (string, error) { return "access-token", nil }, time.Hour, &audit)
+	s.apiURL = api.URL
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	h := withAdminAuth("secret", s.serveSubmit)
+
+	vectors := []struct {
+		token     string
+		body      string
+		after     time.Duration
+		code      int
+		operation string
+		duplicate bool
+	}{
+		{token: "wrong", body: `{"uri":"http://a.example/"}`, code: http.StatusUnauthorized},
+		{token: "secret", body: `{"uri":"ftp://a.example/"}`, code: http.StatusBadRequest},
+		{token: "secret", body: `{"uri":"http://a.example/","abuseType":"SPAM"}`, code: http.StatusBadRequest},
+		{token: "secret", body: `{"uri":"http://a.example/"}`, code: http.StatusOK, operation: "projects/my-project/operations/1"},
+		{token: "secret", body: `{"uri":"http://a.example/","abuseType":"MALWARE"}`, code: http.StatusOK, operation: "projects/my-project/operations/1", duplicate: true},
+		{token: "secret", body: `{"uri":"http://reject.example/"}`, code: http.StatusBadGateway},
+		{token: "secret", body: `{"uri":"http://b.example/","abuseType":"MALWARE"}`, code: http.StatusOK, operation: "projects/my-project/operations/2"},
+		{token: "secret", body: `{"uri":"http://a.example/"}`, after: time.Hour, code: http.StatusOK, operation: "projects/my-project/operations/3"},
+	}
+	for i, v := range vectors {
+		now = now.Add(v.after)
+		req := httptest.NewRequest("POST", submitPath, strings.NewReader(v.body))
+		req.Header.Set("Authorization", "Bearer "+v.token)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d: %s", i, rec.Code, v.code, rec.Body)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		var got submitResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+		}
+		if want := (submitResponse{Operation: v.operation, Duplicate: v.duplicate}); got != want {
+			t.Errorf("test %d, response = %+v, want %+v", i, got, want)
+		}
+	}
+
+	wantForwarded := []string{"http://a.example/ SOCIAL_ENGINEERING", "http://b.example/ MALWARE", "http://a.example/ SOCIAL_ENGINEERING"}
+	if !reflect.DeepEqual(forwarded, wantForwarded) {
+		t.Errorf("forwarded = %q, want %q", forwarded, wantForwarded)
+	}
+	// Every authorized and valid submission is audited, including failures.
+	var entries []submitAuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var e submitAuditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("got %d audit entries, want 5:\n%s", len(entries), audit.String())
+	}
+	if e := entries[1]; !e.Duplicate || e.RemoteIP != "192.0.2.1" {
+		t.Errorf("audit entry of duplicate = %+v", e)
+	}
+	if e := entries[2]; e.Error == "" || e.Operation != "" {
+		t.Errorf("audit entry of failed submission = %+v", e)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/google/webrisk"
+	"golang.org/x/text/language"
+)
+
+const interstitialTemplate = "/interstitial.html"
+
+// overlayFS serves the files of dir, falling back to those of base for files
+// that do not exist in dir. It allows overriding some of the embedded
+// interstitial templates and assets while keeping the defaults for others.
+type overlayFS struct {
+	dir  http.FileSystem
+	base http.FileSystem
+}
+
+func (o *overlayFS) Open(name string) (http.File, error) {
+	f, err := o.dir.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// newTemplateFS returns a file system serving the templates and assets in dir
+// in place of those of base. All the interstitial templates are parsed and
+// executed once, so that errors in custom templates are reported up front.
+func newTemplateFS(dir string, base http.FileSystem) (http.FileSystem, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	o := &overlayFS{dir: http.Dir(dir), base: base}
+	if err := validateTemplates(o, defaultLanguage); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// validateTemplates renders the interstitial page of every threat type from
+// the templates in fs.
+func validateTemplates(fs http.FileSystem, lang language.Tag) error {
+	sample := &url.URL{Scheme: "http", Host: "example.com", Path: "/"}
+	for td, tmpl := range threatTemplate {
+		data := interstitialData(webrisk.URLThreat{Pattern: "example.com/", ThreatType: td}, sample, lang)
+		if _, err := executeTemplates(fs, data, tmpl, interstitialTemplate); err != nil {
+			return fmt.Errorf("invalid template for %v: %v", td, err)
+		}
+	}
+	return nil
+}
+
+// interstitialData returns the data the interstitial templates are executed
+// with.
+func interstitialData(threat webrisk.URLThreat, u *url.URL, lang language.Tag) map[string]any {
+	return map[string]any{
+		"Threat": threat,
+		"Url":    u,
+		"Lang":   lang.String(),
+	}
+}
+
+// executeTemplates parses the templates at paths in fs and executes them with
+// data.
+func executeTemplates(fs http.FileSystem, data any, paths ...string) ([]byte, error) {
+	t, err := parseTemplates(fs, template.New("Web Risk Interstitial"), paths...)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderInterstitial renders the interstitial page for a threat using the
+// given threat template. If custom templates fail to render, for instance
+// because they were edited since wrserver started, the templates they
+// override are used instead.
+func renderInterstitial(fs http.FileSystem, tmpl string, data any) ([]byte, error) {
+	page, err := executeTemplates(fs, data, tmpl, interstitialTemplate)
+	if o, ok := fs.(*overlayFS); ok && err != nil {
+		appLog.Errorf("Unable to render custom interstitial template %s, using the default: %v", tmpl, err)
+		return renderInterstitial(o.base, tmpl, data)
+	}
+	return page, err
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestTemplateFS(t *testing.T) {
+	dir := t.TempDir()
+	custom := `{{define "heading"}}Blocked by Example Corp{{end}}
+{{define "message"}}Contact security@example.com about {{.Url.Host}}.{{end}}
+{{define "details"}}See our acceptable use policy.{{end}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "malware.tmpl"), []byte(custom), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fs, err := newTemplateFS(dir, http.Dir("public"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	u, _ := url.Parse("http://bad.example.org/")
+	render := func(td webrisk.ThreatType) string {
+		page, err := renderInterstitial(fs, threatTemplate[td], interstitialData(webrisk.URLThreat{ThreatType: td}, u, defaultLanguage))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(page)
+	}
+	if page := render(webrisk.ThreatTypeMalware); !strings.Contains(page, "Blocked by Example Corp") {
+		t.Errorf("custom malware template not used:\n%s", page)
+	}
+	if page := render(webrisk.ThreatTypeUnwantedSoftware); !strings.Contains(page, "harmful programs") {
+		t.Errorf("default unwanted software template not used:\n%s", page)
+	}
+
+	// Broken templates are rejected at startup, and replaced by the defaults
+	// if broken afterwards.
+	if err := ioutil.WriteFile(filepath.Join(dir, "malware.tmpl"), []byte(`{{define "heading"}}`), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := newTemplateFS(dir, http.Dir("public")); err == nil {
+		t.Errorf("newTemplateFS with a broken template succeeded, want error")
+	}
+	if page := render(webrisk.ThreatTypeMalware); !strings.Contains(page, "contains malware") {
+		t.Errorf("default malware template not used as fallback:\n%s", page)
+	}
+
+	if _, err := newTemplateFS(filepath.Join(dir, "missing"), http.Dir("public")); err == nil {
+		t.Errorf("newTemplateFS with a missing directory succeeded, want error")
+	}
+}
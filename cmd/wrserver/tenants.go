@@ -0,0 +1,302 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/webrisk"
+)
+
+// tenantPathPrefix prefixes the paths of the endpoints of a tenant, followed
+// by the name of the tenant, such as /t/payments/v1/uris:search.
+const tenantPathPrefix = "/t/"
+
+// endpointPath returns the path of the endpoint serving the given request
+// path, which is stripped of the tenant prefix if any.
+func endpointPath(p string) string {
+	p = path.Clean("/" + p)
+	if strings.HasPrefix(p, tenantPathPrefix) {
+		_, rest, _ := strings.Cut(strings.TrimPrefix(p, tenantPathPrefix), "/")
+		p = "/" + rest
+	}
+	return p
+}
+
+// pathTenant returns the name of the tenant whose endpoints the path p is
+// under, or "" if it is not under the endpoints of a tenant.
+func pathTenant(p string) string {
+	p = path.Clean("/" + p)
+	if !strings.HasPrefix(p, tenantPathPrefix) {
+		return ""
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(p, tenantPathPrefix), "/")
+	return name
+}
+
+// validTenantName matches the names that tenants may be given.
+var validTenantName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tenantConfig is the configuration of a tenant in the -tenants file.
+type tenantConfig struct {
+	APIKey      string   `json:"apikey"`
+	ThreatTypes string   `json:"threatTypes"` // Defaults to -threatTypes
+	DB          string   `json:"db"`          // Path of the database of the tenant, if persisted
+	Tokens      []string `json:"tokens"`      // Bearer tokens identifying the clients of the tenant
+}
+
+// tenant is a set of clients served by wrserver with its own Web Risk API
+// key, threat lists and database.
+type tenant struct {
+	name   string
+	config tenantConfig
+	wr     *webrisk.UpdateClient
+}
+
+// serverTenants are the tenants served in addition to the default client
+// configured with -apikey. They are set up once at startup.
+var serverTenants []*tenant
+
+// loadTenants loads the configuration of tenants from the JSON file at path,
+// which is an object keyed by tenant name, for example:
+//
+//	{
+//	    "payments": {
+//	        "apikey":      "XXXXXXXXXXXXXXXXXXXXXXX",
+//	        "threatTypes": "MALWARE,SOCIAL_ENGINEERING",
+//	        "db":          "/var/lib/wrserver/payments.db",
+//	        "tokens":      ["s3cr3t"]
+//	    },
+//	    "search": {
+//	        "apikey":      "YYYYYYYYYYYYYYYYYYYYYYY"
+//	    }
+//	}
+func loadTenants(path string) (map[string]tenantConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]tenantConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %v", path, err)
+	}
+	tokens := make(map[string]string)
+	dbs := make(map[string]string)
+	for name, tc := range configs {
+		if !validTenantName.MatchString(name) {
+			return nil, fmt.Errorf("invalid tenant name %q", name)
+		}
+		if tc.APIKey == "" {
+			return nil, fmt.Errorf("no apikey specified for tenant %s", name)
+		}
+		for _, token := range tc.Tokens {
+			if token == "" {
+				return nil, fmt.Errorf("empty token for tenant %s", name)
+			}
+			if other, ok := tokens[token]; ok {
+				return nil, fmt.Errorf("tenants %s and %s share a token", other, name)
+			}
+			tokens[token] = name
+		}
+		if tc.DB != "" {
+			if other, ok := dbs[tc.DB]; ok {
+				return nil, fmt.Errorf("tenants %s and %s share the database %s", other, name, tc.DB)
+			}
+			dbs[tc.DB] = name
+		}
+	}
+	return configs, nil
+}
+
+// newTenants creates a client for every tenant of configs. The clients are
+// configured like base, apart from the settings of the tenant.
+func newTenants(configs map[string]tenantConfig, base webrisk.Config) ([]*tenant, error) {
+	var names []string
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var tenants []*tenant
+	for _, name := range names {
+		tc := configs[name]
+		conf := base
+		conf.APIKey = tc.APIKey
+		conf.DBPath = tc.DB
+		if tc.ThreatTypes != "" {
+			conf.ThreatListArg = tc.ThreatTypes
+		}
+		wr, err := webrisk.NewUpdateClient(conf)
+		if err != nil {
+			for _, t := range tenants {
+				t.wr.Close()
+			}
+			return nil, fmt.Errorf("tenant %s: %v", name, err)
+		}
+		tenants = append(tenants, &tenant{name: name, config: tc, wr: wr})
+	}
+	return tenants, nil
+}
+
+// reloadTenants applies the changes of the API keys and tokens of tenants in
+// configs. Other changes, including added or removed tenants, require a
+// restart and are logged and ignored.
+func reloadTenants(tenants []*tenant, configs map[string]tenantConfig) error {
+	for _, t := range tenants {
+		tc, ok := configs[t.name]
+		if !ok {
+			appLog.Errorf("Ignoring the removal of tenant %s, which requires a restart", t.name)
+			continue
+		}
+		if tc.DB != t.config.DB || tc.ThreatTypes != t.config.ThreatTypes {
+			appLog.Errorf("Ignoring the new database or threat types of tenant %s, which require a restart", t.name)
+		}
+		if tc.APIKey != t.config.APIKey {
+			if err := t.wr.SetAPIKey(tc.APIKey); err != nil {
+				return fmt.Errorf("tenant %s: %v", t.name, err)
+			}
+			appLog.Infof("Rotated the API key of tenant %s", t.name)
+			t.config.APIKey = tc.APIKey
+		}
+		t.config.Tokens = tc.Tokens
+	}
+	for name := range configs {
+		known := false
+		for _, t := range tenants {
+			known = known || t.name == name
+		}
+		if !known {
+			appLog.Errorf("Ignoring the new tenant %s, which requires a restart", name)
+		}
+	}
+	return nil
+}
+
+// bearerToken returns the bearer token of the Authorization header of req, if
+// any.
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if token := strings.TrimPrefix(auth, "Bearer "); token != auth {
+		return token
+	}
+	return ""
+}
+
+// tenantRoute serves the requests of a tenant.
+type tenantRoute struct {
+	tokens []string
+	h      http.Handler
+}
+
+// authorized reports whether req may be served for the tenant. Requests are
+// authorized if the tenant has no tokens, or with one of its tokens.
+func (tr *tenantRoute) authorized(req *http.Request) bool {
+	if len(tr.tokens) == 0 {
+		return true
+	}
+	got := []byte(bearerToken(req))
+	ok := false
+	for _, token := range tr.tokens {
+		ok = subtle.ConstantTimeCompare(got, []byte(token)) == 1 || ok
+	}
+	return ok
+}
+
+// tenantRouter routes requests to the handler of their tenant. Requests to
+// paths prefixed with /t/ and the name of a tenant are served by that tenant,
+// with the prefix removed. Other requests are served by the tenant of their
+// bearer token, if any, or else by the default handler.
+type tenantRouter struct {
+	def     http.Handler
+	byName  map[string]*tenantRoute
+	byToken map[string]*tenantRoute
+}
+
+// newTenantRouter returns a router serving the requests of tenants with the
+// handlers returned by handler for their clients, and the other ones with def.
+func newTenantRouter(def http.Handler, tenants []*tenant, handler func(*webrisk.UpdateClient) http.Handler) *tenantRouter {
+	r := &tenantRouter{
+		def:     def,
+		byName:  make(map[string]*tenantRoute),
+		byToken: make(map[string]*tenantRoute),
+	}
+	for _, t := range tenants {
+		h := handler(t.wr)
+		r.byName[t.name] = &tenantRoute{
+			tokens: t.config.Tokens,
+			h:      http.StripPrefix(tenantPathPrefix+t.name, h),
+		}
+		for _, token := range t.config.Tokens {
+			r.byToken[token] = &tenantRoute{h: h}
+		}
+	}
+	return r
+}
+
+func (r *tenantRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, tenantPathPrefix) {
+		name := strings.TrimPrefix(req.URL.Path, tenantPathPrefix)
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		route, ok := r.byName[name]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		if !route.authorized(req) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		route.h.ServeHTTP(w, req)
+		return
+	}
+	if route, ok := r.byToken[bearerToken(req)]; ok {
+		route.h.ServeHTTP(w, req)
+		return
+	}
+	r.def.ServeHTTP(w, req)
+}
+
+// newRootHandler sets up the handlers of the default client wr and of
+// serverTenants. If wr is nil, requests that are not routed to a tenant are
+// rejected, apart from those for health checks and static assets.
+func newRootHandler(wr *webrisk.UpdateClient, fs http.FileSystem) http.Handler {
+	var def http.Handler
+	if wr != nil {
+		def = newHandler(wr, fs)
+	} else {
+		mux := http.NewServeMux()
+		mux.HandleFunc(healthPath, serveHealth)
+		mux.Handle("/public/", http.StripPrefix("/public/", http.FileServer(fs)))
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown tenant", http.StatusUnauthorized)
+		})
+		def = mux
+	}
+	if len(serverTenants) == 0 {
+		return def
+	}
+	return newTenantRouter(def, serverTenants, func(wr *webrisk.UpdateClient) http.Handler {
+		return newHandler(wr, fs)
+	})
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestLoadTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	vectors := []struct {
+		config string
+		fail   bool
+	}{
+		{`{"a": {"apikey": "k1", "tokens": ["t1"], "db": "a.db"}, "b-2": {"apikey": "k2", "db": "b.db"}}`, false},
+		{`{"a": {"apikey": "k1"}, "b": {"apikey": "k2"}}`, false},
+		{`{"a/b": {"apikey": "k1"}}`, true},
+		{`{"a": {}}`, true},
+		{`{"a": {"apikey": "k1", "tokens": [""]}}`, true},
+		{`{"a": {"apikey": "k1", "tokens": ["t1"]}, "b": {"apikey": "k2", "tokens": ["t1"]}}`, true},
+		{`{"a": {"apikey": "k1", "db": "x.db"}, "b": {"apikey": "k2", "db": "x.db"}}`, true},
+		{`{"a": {"apikey": "k1", "unknown": 1}`, true},
+	}
+	for i, v := range vectors {
+		if err := ioutil.WriteFile(path, []byte(v.config), 0644); err != nil {
+			t.Fatalf("test %d, unexpected write error: %v", i, err)
+		}
+		if _, err := loadTenants(path); err != nil != v.fail {
+			t.Errorf("test %d, loadTenants() error = %v, want failure %v", i, err, v.fail)
+		}
+	}
+}
+
+func TestTenantRouter(t *testing.T) {
+	tenants := []*tenant{
+		{name: "a", config: tenantConfig{Tokens: []string{"ta1", "ta2"}}, wr: new(webrisk.UpdateClient)},
+		{name: "b", wr: new(webrisk.UpdateClient)},
+	}
+	names := map[*webrisk.UpdateClient]string{tenants[0].wr: "a", tenants[1].wr: "b"}
+	handler := func(wr *webrisk.UpdateClient) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, names[wr]+" "+r.URL.Path)
+		})
+	}
+	def := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "default "+r.URL.Path)
+	})
+	router := newTenantRouter(def, tenants, handler)
+
+	vectors := []struct {
+		path  string
+		token string
+		code  int
+		want  string
+	}{
+		{"/t/a" + findThreatPath, "ta2", http.StatusOK, "a " + findThreatPath},
+		{"/t/a" + findThreatPath, "", http.StatusUnauthorized, ""},
+		{"/t/a" + findThreatPath, "other", http.StatusUnauthorized, ""},
+		{"/t/b" + statusPath, "", http.StatusOK, "b " + statusPath},
+		{"/t/c" + statusPath, "", http.StatusNotFound, ""},
+		{findThreatPath, "ta1", http.StatusOK, "a " + findThreatPath},
+		{findThreatPath, "other", http.StatusOK, "default " + findThreatPath},
+		{findThreatPath, "", http.StatusOK, "default " + findThreatPath},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", v.path, nil)
+		if v.token != "" {
+			req.Header.Set("Authorization", "Bearer "+v.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code == http.StatusOK && rec.Body.String() != v.want {
+			t.Errorf("test %d, served by %q, want %q", i, rec.Body.String(), v.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the W3C Trace Context propagating traces across services.
+const (
+	traceparentHeader = "Traceparent"
+	tracestateHeader  = "Tracestate"
+)
+
+// otlpTracesPath is the path of the OTLP/HTTP endpoint receiving traces,
+// relative to the base URL of -otlpEndpoint.
+const otlpTracesPath = "/v1/traces"
+
+// maxQueuedSpans is the number of spans kept until they are exported, beyond
+// which new spans are dropped.
+const maxQueuedSpans = 4096
+
+// Kinds of spans, as defined by OpenTelemetry.
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+)
+
+// spanStatusError is the OpenTelemetry status of spans that failed.
+const spanStatusError = 2
+
+// spanContext identifies a span of a trace, as propagated by the traceparent
+// header.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+	state   string // The tracestate header, passed on as is
+}
+
+// parseTraceparent parses the value of a traceparent header, such as
+// 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01. It reports false if
+// the header is invalid, in which case a new trace should be started.
+func parseTraceparent(h string) (spanContext, bool) {
+	var sc spanContext
+	h = strings.TrimSpace(h)
+	// Later versions may append fields, which are ignored.
+	if len(h) < 55 || (len(h) > 55 && (h[:2] == "00" || h[55] != '-')) {
+		return sc, false
+	}
+	if h[2] != '-' || h[35] != '-' || h[52] != '-' || h[:2] == "ff" {
+		return sc, false
+	}
+	var version, flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{{version[:], h[:2]}, {sc.traceID[:], h[3:35]}, {sc.spanID[:], h[36:52]}, {flags[:], h[53:55]}} {
+		// Only lowercase hexadecimal digits are valid.
+		if strings.ToLower(f.src) != f.src {
+			return sc, false
+		}
+		if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return sc, false
+		}
+	}
+	if sc.traceID == ([16]byte{}) || sc.spanID == ([8]byte{}) {
+		return sc, false
+	}
+	sc.sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// traceparent returns the value of the traceparent header propagating sc.
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.traceID[:]) + "-" + hex.EncodeToString(sc.spanID[:]) + "-" + flags
+}
+
+// span is an operation being traced.
+type span struct {
+	sc     spanContext
+	parent [8]byte // Zero for the root span of a trace
+	name   string
+	kind   int
+	start  time.Time
+	attrs  []otlpKeyValue
+	failed bool
+}
+
+// setAttr sets an attribute of s, which must be a string or an int.
+func (s *span) setAttr(key string, value interface{}) {
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		kv.Value.StringValue = v
+	case int:
+		kv.Value.IntValue = strconv.Itoa(v)
+	}
+	s.attrs = append(s.attrs, kv)
+}
+
+// The JSON encoding of the traces exported with the OpenTelemetry Protocol.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue,omitempty"`
+		IntValue    string `json:"intValue,omitempty"` // 64-bit integers are encoded as strings
+	}
+	otlpStatus struct {
+		Code int `json:"code,omitempty"`
+	}
+)
+
+// tracer records the spans of the requests served by wrserver and of the
+// requests it makes to the Web Risk API, and exports them to an OpenTelemetry
+// collector over OTLP/HTTP.
+type tracer struct {
+	url         string // URL receiving the exported spans
+	sampleRatio float64
+	client      *http.Client
+	now         func() time.Time
+	newID       func(b []byte)
+
+	mu      sync.Mutex
+	spans   []otlpSpan
+	dropped int64
+}
+
+// serverTracer is the tracer set up with -otlpEndpoint, or nil if tracing is
+// disabled.
+var serverTracer *tracer
+
+// newTracer returns a tracer exporting spans to the OTLP/HTTP collector at
+// the base URL endpoint, such as http://localhost:4318. Traces started by
+// wrserver are sampled with the given ratio, while those propagated by
+// clients are sampled as decided by the clients.
+func newTracer(endpoint string, sampleRatio float64) (*tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio %v", sampleRatio)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + otlpTracesPath
+	return &tracer{
+		url:         u.String(),
+		sampleRatio: sampleRatio,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+		newID: func(b []byte) {
+			if _, err := rand.Read(b); err != nil {
+				binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+			}
+		},
+	}, nil
+}
+
+// start starts a span of the given name and kind, as a child of parent if it
+// is valid, or as the root of a new trace otherwise.
+func (t *tracer) start(name string, kind int, parent spanContext, hasParent bool) *span {
+	s := &span{name: name, kind: kind, start: t.now()}
+	if hasParent {
+		s.sc.traceID, s.sc.sampled, s.sc.state = parent.traceID, parent.sampled, parent.state
+		s.parent = parent.spanID
+	} else {
+		t.newID(s.sc.traceID[:])
+		// The trace ID is random, so its last bytes are used to sample it
+		// consistently, like the TraceIDRatioBased sampler of OpenTelemetry.
+		n := binary.BigEndian.Uint64(s.sc.traceID[8:]) >> 1
+		s.sc.sampled = float64(n) < t.sampleRatio*(1<<63)
+	}
+	t.newID(s.sc.spanID[:])
+	return s
+}
+
+// end ends s, which is queued for export if its trace is sampled.
+func (t *tracer) end(s *span) {
+	if !s.sc.sampled {
+		return
+	}
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.traceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.spanID[:]),
+		TraceState:        s.sc.state,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(t.now().UnixNano(), 10),
+		Attributes:        s.attrs,
+	}
+	if s.parent != ([8]byte{}) {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if s.failed {
+		out.Status.Code = spanStatusError
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) >= maxQueuedSpans {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, out)
+}
+
+// flush exports the queued spans.
+func (t *tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		appLog.Errorf("Dropped %d spans exceeding the export queue", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{Key: "service.name", Value: otlpAnyValue{StringValue: "wrserver"}},
+		}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "wrserver"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mimeJSON)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to export %d spans: %v", len(spans), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unable to export %d spans: %s", len(spans), resp.Status)
+	}
+	return nil
+}
+
+// run exports the queued spans every period, until the process exits.
+func (t *tracer) run(period time.Duration) {
+	for range time.Tick(period) {
+		if err := t.flush(context.Background()); err != nil {
+			appLog.Errorf("%v", err)
+		}
+	}
+}
+
+type traceKey struct{}
+
+// spanFromContext returns the span of the request being served with ctx.
+func spanFromContext(ctx context.Context) (*span, bool) {
+	s, ok := ctx.Value(traceKey{}).(*span)
+	return s, ok
+}
+
+// withTracing wraps h so that every request is traced by t, as part of the
+// trace given by its traceparent header if any. Requests are not traced if t
+// is nil.
+func withTracing(t *tracer, h http.Handler) http.Handler {
+	if t == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent, ok := parseTraceparent(r.Header.Get(traceparentHeader))
+		if ok {
+			parent.state = r.Header.Get(tracestateHeader)
+		}
+		s := t.start(r.Method, spanKindServer, parent, ok)
+		if e, ok := r.Context().Value(accessKey{}).(*accessEntry); ok {
+			e.TraceID = hex.EncodeToString(s.sc.traceID[:])
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), traceKey{}, s)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// The paths not found are left out of the span name, so that its
+		// cardinality is bounded. The query is left out of the attributes, as
+		// it may hold the URLs looked up.
+		route := endpointPath(r.URL.Path)
+		if status != http.StatusNotFound {
+			s.name += " " + route
+			s.setAttr("http.route", route)
+		}
+		s.setAttr("http.request.method", r.Method)
+		s.setAttr("url.path", r.URL.Path)
+		s.setAttr("http.response.status_code", status)
+		s.failed = status >= 500
+		t.end(s)
+	})
+}
+
+// tracingTransport is an http.RoundTripper tracing the requests made while
+// serving a traced request, and propagating the trace to the server.
+type tracingTransport struct {
+	t    *tracer
+	base http.RoundTripper
+}
+
+func (tt *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent, ok := spanFromContext(req.Context())
+	if !ok {
+		// Requests made on behalf of wrserver itself, such as database
+		// updates, are not part of any trace.
+		return tt.base.RoundTrip(req)
+	}
+	s := tt.t.start(req.Method, spanKindClient, parent.sc, true)
+	req = req.Clone(req.Context())
+	req.Header.Set(traceparentHeader, s.sc.traceparent())
+	if s.sc.state != "" {
+		req.Header.Set(tracestateHeader, s.sc.state)
+	}
+	// The query is left out of the attributes, as it holds the API key.
+	s.setAttr("http.request.method", req.Method)
+	s.setAttr("server.address", req.URL.Hostname())
+	s.setAttr("url.path", req.URL.Path)
+	resp, err := tt.base.RoundTrip(req)
+	if err != nil {
+		s.failed = true
+		s.setAttr("error.type", fmt.Sprintf("%T", err))
+	} else {
+		s.setAttr("http.response.status_code", resp.StatusCode)
+		s.failed = resp.StatusCode >= 500
+	}
+	tt.t.end(s)
+	return resp, err
+}
+
+// newTracingTransport returns the transport of the requests made to the Web
+// Risk API, through the given proxy if set, traced by t if it is not nil.
+func newTracingTransport(t *tracer, proxy string) (http.RoundTripper, error) {
+	if t == nil {
+		return nil, nil
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		base.Proxy = http.ProxyURL(u)
+	}
+	return &tracingTransport{t: t, base: base}, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+	"github.com/google/webrisk/webrisktest"
+)
+
+func TestTracing(t *testing.T) {
+	for i, v := range []struct {
+		h  string
+		ok bool
+	}{
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true},
+		{"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00-future", true},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", false},
+		{"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false},
+		{"00-00000000000000000000000000000000-b7ad6b7169203331-01", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false},
+		{"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333", false},
+	} {
+		if sc, ok := parseTraceparent(v.h); ok != v.ok || (ok && sc.traceparent()[3:52] != v.h[3:52]) {
+			t.Errorf("test %d, parseTraceparent(%q) = %v, %v, want %v", i, v.h, sc, ok, v.ok)
+		}
+	}
+
+	var exported otlpTraces
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			t.Errorf("spans exported to %s, want %s", r.URL.Path, otlpTracesPath)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&exported); err != nil {
+			t.Errorf("unexpected error decoding spans: %v", err)
+		}
+	}))
+	defer collector.Close()
+	var upstreamParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamParent = r.Header.Get(traceparentHeader)
+	}))
+	defer upstream.Close()
+
+	tr, err := newTracer(collector.URL, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	transport, err := newTracingTransport(tr, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := withTracing(tr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL+"/v1/uris:search?key=secret", nil)
+		resp, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}))
+
+	// Traces started by wrserver are not sampled with a ratio of 0.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", findThreatPath, nil))
+	if len(tr.spans) != 0 {
+		t.Errorf("%d spans recorded, want 0", len(tr.spans))
+	}
+	if sc, ok := parseTraceparent(upstreamParent); !ok || sc.sampled {
+		t.Errorf("upstream traceparent = %q, want a valid unsampled one", upstreamParent)
+	}
+
+	// Traces sampled by the client are recorded.
+	req := httptest.NewRequest("GET", findThreatPath+"?uri=http://example.com/", nil)
+	req.Header.Set(traceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if err := tr.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(exported.ResourceSpans) != 1 || len(exported.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("exported traces = %+v, want one scope", exported)
+	}
+	spans := exported.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want 2: %+v", len(spans), spans)
+	}
+	client, server := spans[0], spans[1]
+	if server.Name != "GET "+findThreatPath || server.Kind != spanKindServer || server.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("server span = %+v", server)
+	}
+	if client.Kind != spanKindClient || client.ParentSpanID != server.SpanID {
+		t.Errorf("client span = %+v, want a child of %s", client, server.SpanID)
+	}
+	for _, s := range spans {
+		if s.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("span %s trace ID = %s", s.Name, s.TraceID)
+		}
+		for _, kv := range s.Attributes {
+			if strings.Contains(kv.Value.StringValue, "?") {
+				t.Errorf("span %s attribute %s = %q holds a query", s.Name, kv.Key, kv.Value.StringValue)
+			}
+		}
+	}
+	if want := "00-0af7651916cd43dd8448eb211c80319c-" + client.SpanID + "-01"; upstreamParent != want {
+		t.Errorf("upstream traceparent = %q, want %q", upstreamParent, want)
+	}
+}
+
+func TestTracingHashLookup(t *testing.T) {
+	var exported otlpTraces
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&exported); err != nil {
+			t.Errorf("unexpected error decoding spans: %v", err)
+		}
+	}))
+	defer collector.Close()
+	tr, err := newTracer(collector.URL, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	transport, err := newTracingTransport(tr, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv := webrisktest.NewServer(webrisktest.Threat{URL: "http://malware.test/", ThreatType: webrisk.ThreatTypeMalware})
+	defer srv.Close()
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:      "key",
+		ServerURL:   srv.URL,
+		ThreatLists: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		Transport:   transport,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error waiting for the client: %v", err)
+	}
+
+	// The hash searches of a traced lookup are traced as its children.
+	h := withTracing(tr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := wr.LookupURLResults(r.Context(), []string{"http://malware.test/"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}))
+	req := httptest.NewRequest("GET", findThreatPath, nil)
+	req.Header.Set(traceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if err := tr.flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(exported.ResourceSpans) != 1 || len(exported.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("exported traces = %+v, want one scope", exported)
+	}
+	spans := exported.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want 2: %+v", len(spans), spans)
+	}
+	client, server := spans[0], spans[1]
+	if client.Kind != spanKindClient || client.ParentSpanID != server.SpanID {
+		t.Errorf("client span = %+v, want a child of %s", client, server.SpanID)
+	}
+	var path string
+	for _, kv := range client.Attributes {
+		if kv.Key == "url.path" {
+			path = kv.Value.StringValue
+		}
+	}
+	if path != "/v1/hashes:search" {
+		t.Errorf("client span url.path = %q, want %q", path, "/v1/hashes:search")
+	}
+}
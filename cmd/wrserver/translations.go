@@ -0,0 +1,91 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"golang.org/x/text/language"
+)
+
+// defaultLanguage is the language of the built-in interstitial templates.
+var defaultLanguage = language.English
+
+// translations holds the interstitial templates translated to other
+// languages than the default one.
+type translations struct {
+	matcher language.Matcher
+	tags    []language.Tag    // Supported languages, starting with the default
+	fs      []http.FileSystem // Templates of every language in tags
+}
+
+// interstitialTranslations are the translations of the interstitial templates
+// used by the redirector. Pages are only served in the default language if
+// it is nil.
+var interstitialTranslations *translations
+
+// loadTranslations loads the translations in dir, which holds a subdirectory
+// named after a BCP 47 language tag, such as "fr" or "pt-BR", for every
+// language. Each subdirectory holds translations of the templates of base
+// with the same file names. Templates missing from a subdirectory are taken
+// from base.
+func loadTranslations(dir string, base http.FileSystem) (*translations, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	t := &translations{
+		tags: []language.Tag{defaultLanguage},
+		fs:   []http.FileSystem{base},
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		tag, err := language.Parse(e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("invalid language directory %s: %v", e.Name(), err)
+		}
+		fs := &overlayFS{dir: http.Dir(filepath.Join(dir, e.Name())), base: base}
+		if err := validateTemplates(fs, tag); err != nil {
+			return nil, fmt.Errorf("language %v: %v", tag, err)
+		}
+		t.tags = append(t.tags, tag)
+		t.fs = append(t.fs, fs)
+	}
+	t.matcher = language.NewMatcher(t.tags)
+	return t, nil
+}
+
+// lookup returns the templates in the language that best matches the given
+// Accept-Language header, and that language. If t is nil, it returns the
+// templates of defaultFS in the default language.
+func (t *translations) lookup(defaultFS http.FileSystem, acceptLanguage string) (http.FileSystem, language.Tag) {
+	if t == nil {
+		return defaultFS, defaultLanguage
+	}
+	prefs, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(prefs) == 0 {
+		return t.fs[0], t.tags[0]
+	}
+	_, i, conf := t.matcher.Match(prefs...)
+	if conf == language.No {
+		i = 0
+	}
+	return t.fs[i], t.tags[i]
+}
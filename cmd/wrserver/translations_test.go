@@ -0,0 +1,86 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/webrisk"
+)
+
+func TestTranslations(t *testing.T) {
+	dir := t.TempDir()
+	fr := `{{define "heading"}}Le site suivant contient des logiciels malveillants{{end}}
+{{define "message"}}Des pirates sur {{.Url.Host}} pourraient tenter d'installer des programmes dangereux.{{end}}
+{{define "details"}}Google Web Risk a récemment détecté des logiciels malveillants.{{end}}`
+	if err := os.MkdirAll(filepath.Join(dir, "fr"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "fr", "malware.tmpl"), []byte(fr), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := http.Dir("public")
+	tr, err := loadTranslations(dir, base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		acceptLanguage string
+		lang           string
+		heading        string
+	}{
+		{"fr-CA,fr;q=0.9,en;q=0.5", "fr", "Le site suivant contient des logiciels malveillants"},
+		{"de;q=0.9,fr;q=0.8", "fr", "Le site suivant contient des logiciels malveillants"},
+		{"ja", "en", "The site ahead contains malware"},
+		{"en-US", "en", "The site ahead contains malware"},
+		{"", "en", "The site ahead contains malware"},
+		{"!!invalid", "en", "The site ahead contains malware"},
+	}
+	u, _ := url.Parse("http://bad.example.org/")
+	for i, v := range vectors {
+		fs, lang := tr.lookup(base, v.acceptLanguage)
+		if lang.String() != v.lang {
+			t.Errorf("test %d, lookup(%q) language = %v, want %v", i, v.acceptLanguage, lang, v.lang)
+		}
+		threat := webrisk.URLThreat{ThreatType: webrisk.ThreatTypeMalware}
+		page, err := renderInterstitial(fs, threatTemplate[threat.ThreatType], interstitialData(threat, u, lang))
+		if err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if !strings.Contains(string(page), v.heading) || !strings.Contains(string(page), `lang="`+v.lang+`"`) {
+			t.Errorf("test %d, page is not in %v:\n%s", i, v.lang, page)
+		}
+	}
+
+	var none *translations
+	if fs, lang := none.lookup(base, "fr"); fs != http.FileSystem(base) || lang != defaultLanguage {
+		t.Errorf("lookup without translations = %v, %v, want defaults", fs, lang)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "not a language"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := loadTranslations(dir, base); err == nil {
+		t.Errorf("loadTranslations with an invalid language directory succeeded, want error")
+	}
+}
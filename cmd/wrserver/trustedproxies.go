@@ -0,0 +1,62 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the proxies set with -trustedProxies, whose
+// X-Forwarded-For and X-Real-IP headers are trusted to tell the IP of the
+// clients. No proxy is trusted if it is nil, in which case clients are
+// identified by the address of their connection alone.
+var trustedProxies *ipSet
+
+// clientIP returns the IP address of the client sending req. If the request
+// comes from a trusted proxy, this is the address of the last hop of the
+// X-Forwarded-For header that is not a trusted proxy itself, or else the
+// address of the X-Real-IP header. Headers of other peers are ignored, as they
+// could be set by clients to spoof their address.
+func clientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	t := trustedProxies
+	if !t.contains(ip) {
+		return ip
+	}
+	if xff := req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// The hops before a malformed one cannot be trusted.
+				break
+			}
+			ip = hop
+			if !t.contains(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if xri := strings.TrimSpace(req.Header.Get("X-Real-IP")); net.ParseIP(xri) != nil {
+		return xri
+	}
+	return ip
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	oldTrusted := trustedProxies
+	defer func() { trustedProxies = oldTrusted }()
+	var err error
+	if trustedProxies, err = parseIPSet("10.0.0.0/8, 192.0.2.1,unix"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		remote string
+		xff    []string
+		xri    string
+		want   string
+	}{
+		{"198.51.100.7:1234", nil, "", "198.51.100.7"},
+		// Headers of untrusted peers are ignored.
+		{"198.51.100.7:1234", []string{"203.0.113.9"}, "203.0.113.8", "198.51.100.7"},
+		{"192.0.2.1:1234", []string{"203.0.113.9"}, "203.0.113.8", "203.0.113.9"},
+		{"192.0.2.1:1234", nil, "203.0.113.8", "203.0.113.8"},
+		{"192.0.2.1:1234", nil, "bogus", "192.0.2.1"},
+		// Spoofed hops before the first untrusted one are skipped.
+		{"10.1.2.3:1234", []string{"1.1.1.1, 203.0.113.9", "10.0.0.1"}, "", "203.0.113.9"},
+		{"10.1.2.3:1234", []string{"203.0.113.9, bogus, 10.0.0.1"}, "", "10.0.0.1"},
+		{"10.1.2.3:1234", []string{"10.0.0.2, 10.0.0.1"}, "", "10.0.0.2"},
+		{"@", []string{"203.0.113.9"}, "", "203.0.113.9"},
+	}
+	for i, v := range vectors {
+		req := httptest.NewRequest("GET", findThreatPath, nil)
+		req.RemoteAddr = v.remote
+		for _, h := range v.xff {
+			req.Header.Add("X-Forwarded-For", h)
+		}
+		if v.xri != "" {
+			req.Header.Set("X-Real-IP", v.xri)
+		}
+		if got := clientIP(req); got != v.want {
+			t.Errorf("test %d, clientIP() = %q, want %q", i, got, v.want)
+		}
+	}
+
+	for _, list := range []string{"10.0.0.0/33", "localhost"} {
+		if _, err := parseIPSet(list); err == nil {
+			t.Errorf("parseIPSet(%q) succeeded, want error", list)
+		}
+	}
+	if pt, err := parseIPSet(" , "); pt != nil || err != nil {
+		t.Errorf("parseIPSet(%q) = %v, %v, want nil", " , ", pt, err)
+	}
+}
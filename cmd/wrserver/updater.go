@@ -0,0 +1,73 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/google/webrisk"
+)
+
+// checkUpdateOnly validates the flags of -updateOnly, in which mode wrserver
+// needs an API key to update the threat lists and a database file to write
+// them to, and serves no tenants.
+func checkUpdateOnly(apiKey, dbPath string, tenants int) error {
+	switch {
+	case apiKey == "":
+		return errors.New("-updateOnly requires -apikey")
+	case dbPath == "":
+		return errors.New("-updateOnly requires -db")
+	case tenants > 0:
+		return errors.New("-updateOnly does not support -tenants")
+	}
+	return nil
+}
+
+// checkReadOnly validates the flags of -readOnly, in which mode wrserver
+// serves lookups from the database file maintained by another process, such
+// as a wrserver run with -updateOnly, and never updates it itself.
+func checkReadOnly(dbPath string, updateOnly bool, snapshotURL string) error {
+	switch {
+	case dbPath == "":
+		return errors.New("-readOnly requires -db")
+	case updateOnly:
+		return errors.New("-readOnly and -updateOnly are exclusive")
+	case snapshotURL != "":
+		return errors.New("-readOnly does not support -snapshotURL")
+	}
+	return nil
+}
+
+// runUpdater runs the updater of wr until a signal is received on exit. The
+// database is written to its file after every update, to be shared with the
+// replicas reading the same file or copied to where they download their
+// -snapshotURL from.
+func runUpdater(wr *webrisk.UpdateClient, exit <-chan os.Signal) {
+	appLog.Infof("Starting updater of %s, serving no lookups", *databaseFlag)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := wr.WaitUntilReady(ctx); err == nil {
+			appLog.Infof("Threat lists synced to %s", *databaseFlag)
+		}
+	}()
+	<-exit
+	appLog.Infof("\nStopping updater...")
+	if err := wr.Close(); err != nil {
+		appLog.Errorf("%v", err)
+	}
+}
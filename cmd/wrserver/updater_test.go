@@ -0,0 +1,79 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUpdateOnly(t *testing.T) {
+	vectors := []struct {
+		apiKey, db string
+		tenants    int
+		ok         bool
+	}{
+		{apiKey: "key", db: "/tmp/wrdb", ok: true},
+		{db: "/tmp/wrdb"},
+		{apiKey: "key"},
+		{apiKey: "key", db: "/tmp/wrdb", tenants: 1},
+	}
+	for i, v := range vectors {
+		err := checkUpdateOnly(v.apiKey, v.db, v.tenants)
+		if (err == nil) != v.ok {
+			t.Errorf("test %d, checkUpdateOnly() = %v, want ok %v", i, err, v.ok)
+		}
+	}
+
+	// The updater runs until an exit signal, after which the client is closed.
+	wr := newSyncedClient(t)
+	exit := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runUpdater(wr, exit)
+	}()
+	exit <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("runUpdater did not return on exit")
+	}
+	if err := wr.WaitUntilReady(context.Background()); err == nil {
+		t.Error("client not closed by runUpdater")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	vectors := []struct {
+		db          string
+		updateOnly  bool
+		snapshotURL string
+		ok          bool
+	}{
+		{db: "/shared/wrdb", ok: true},
+		{},
+		{db: "/shared/wrdb", updateOnly: true},
+		{db: "/shared/wrdb", snapshotURL: "gs://bucket/wrdb"},
+	}
+	for i, v := range vectors {
+		err := checkReadOnly(v.db, v.updateOnly, v.snapshotURL)
+		if (err == nil) != v.ok {
+			t.Errorf("test %d, checkReadOnly() = %v, want ok %v", i, err, v.ok)
+		}
+	}
+}
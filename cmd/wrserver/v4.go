@@ -0,0 +1,253 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/webrisk"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	sbpb "github.com/google/webrisk/internal/safebrowsing_proto"
+)
+
+const v4FindThreatMatchesPath = "/v4/threatMatches:find"
+
+// v4FindThreatMatchesRequest is the JSON form of the Safe Browsing v4
+// FindThreatMatchesRequest message. The client information is ignored.
+type v4FindThreatMatchesRequest struct {
+	ThreatInfo v4ThreatInfo `json:"threatInfo"`
+}
+
+type v4ThreatInfo struct {
+	ThreatTypes      []string        `json:"threatTypes"`
+	PlatformTypes    []string        `json:"platformTypes"`
+	ThreatEntryTypes []string        `json:"threatEntryTypes"`
+	ThreatEntries    []v4ThreatEntry `json:"threatEntries"`
+}
+
+type v4ThreatEntry struct {
+	URL string `json:"url"`
+}
+
+// v4FindThreatMatchesResponse is the JSON form of the Safe Browsing v4
+// FindThreatMatchesResponse message.
+type v4FindThreatMatchesResponse struct {
+	Matches []v4ThreatMatch `json:"matches,omitempty"`
+}
+
+type v4ThreatMatch struct {
+	ThreatType      string        `json:"threatType"`
+	PlatformType    string        `json:"platformType"`
+	ThreatEntryType string        `json:"threatEntryType"`
+	Threat          v4ThreatEntry `json:"threat"`
+	CacheDuration   string        `json:"cacheDuration,omitempty"`
+}
+
+// serveV4FindThreatMatches implements the "/v4/threatMatches:find" endpoint
+// of the Safe Browsing API v4, so that clients of that protocol can use
+// wrserver as a local proxy. Matches are reported for every requested
+// platform type, and carry the time left until they expire in the cache as
+// their cacheDuration, so that clients do not look them up again meanwhile.
+// The response may be cached until the earliest expiry of the verdicts.
+//
+// Requests are read in JSON, or in binary protobuf if their Content-Type is
+// application/x-protobuf. Responses are written in the format asked for by
+// the Accept header, and otherwise in the format of the request.
+func serveV4FindThreatMatches(resp http.ResponseWriter, req *http.Request, ul urlLooker, maxURLs int, now func() time.Time) {
+	if req.Method != "POST" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := mediaType(req.Header.Get("Content-Type"))
+	mime := acceptedMIME(req)
+	if mime == "" {
+		mime = mimeJSON
+		if contentType == mimeProto {
+			mime = mimeProto
+		}
+	}
+	freq, err := decodeV4Request(req.Body, contentType)
+	if err != nil {
+		http.Error(resp, "invalid request: "+err.Error(), requestErrorCode(err))
+		return
+	}
+	info := freq.ThreatInfo
+	if maxURLs > 0 && len(info.ThreatEntries) > maxURLs {
+		http.Error(resp, fmt.Sprintf("too many threatEntries: %d, at most %d are allowed", len(info.ThreatEntries), maxURLs), http.StatusRequestEntityTooLarge)
+		return
+	}
+	for _, t := range info.ThreatEntryTypes {
+		if t != "URL" {
+			http.Error(resp, fmt.Sprintf("unsupported threat entry type %q", t), http.StatusBadRequest)
+			return
+		}
+	}
+	wanted := make(map[webrisk.ThreatType]bool)
+	for _, s := range info.ThreatTypes {
+		tt, err := parseThreatType(s)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wanted[webrisk.ThreatType(tt)] = true
+	}
+	platforms := info.PlatformTypes
+	if len(platforms) == 0 {
+		platforms = []string{"ANY_PLATFORM"}
+	}
+
+	var out v4FindThreatMatchesResponse
+	var urls []string
+	for _, e := range info.ThreatEntries {
+		if schemePolicy.ValidURL(e.URL) {
+			urls = append(urls, e.URL)
+		}
+	}
+	if len(urls) > 0 {
+		results, err := ul.LookupURLResults(req.Context(), urls)
+		if err = lookupError(err); err != nil {
+			serveLookupError(resp, err)
+			return
+		}
+		t := now()
+		var expires []time.Time
+		for i, r := range results {
+			expires = append(expires, r.ExpireTime)
+			seen := make(map[webrisk.ThreatType]bool)
+			for _, ut := range r.Threats {
+				if (len(wanted) > 0 && !wanted[ut.ThreatType]) || seen[ut.ThreatType] {
+					continue
+				}
+				seen[ut.ThreatType] = true
+				m := v4ThreatMatch{
+					ThreatType:      ut.ThreatType.String(),
+					ThreatEntryType: "URL",
+					Threat:          v4ThreatEntry{URL: urls[i]},
+					CacheDuration:   v4CacheDuration(matchExpireTime(r, ut.ThreatType), t),
+				}
+				for _, p := range platforms {
+					m.PlatformType = p
+					out.Matches = append(out.Matches, m)
+				}
+			}
+		}
+		recordLookups(req.Context(), urls, results)
+		setSourceHeader(resp, results)
+		setCacheControl(resp, earliest(expires...), t)
+	}
+
+	buf, err := encodeV4Response(out, mime)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", mime)
+	resp.Header().Add("Vary", "Accept")
+	resp.Write(buf)
+}
+
+// decodeV4Request reads a FindThreatMatchesRequest from r, in binary protobuf
+// if contentType is application/x-protobuf, and in JSON otherwise.
+func decodeV4Request(r io.Reader, contentType string) (v4FindThreatMatchesRequest, error) {
+	var freq v4FindThreatMatchesRequest
+	if contentType != mimeProto {
+		err := json.NewDecoder(r).Decode(&freq)
+		return freq, err
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return freq, err
+	}
+	var pbReq sbpb.FindThreatMatchesRequest
+	if err := proto.Unmarshal(body, &pbReq); err != nil {
+		return freq, err
+	}
+	info := pbReq.GetThreatInfo()
+	for _, tt := range info.GetThreatTypes() {
+		freq.ThreatInfo.ThreatTypes = append(freq.ThreatInfo.ThreatTypes, tt.String())
+	}
+	for _, pt := range info.GetPlatformTypes() {
+		freq.ThreatInfo.PlatformTypes = append(freq.ThreatInfo.PlatformTypes, pt.String())
+	}
+	for _, tet := range info.GetThreatEntryTypes() {
+		freq.ThreatInfo.ThreatEntryTypes = append(freq.ThreatInfo.ThreatEntryTypes, tet.String())
+	}
+	for _, e := range info.GetThreatEntries() {
+		freq.ThreatInfo.ThreatEntries = append(freq.ThreatInfo.ThreatEntries, v4ThreatEntry{URL: e.GetUrl()})
+	}
+	return freq, nil
+}
+
+// encodeV4Response returns out encoded as a FindThreatMatchesResponse in the
+// given mime, JSON or ProtoBuf. The matches of threat types unknown to Safe
+// Browsing, such as SOCIAL_ENGINEERING_EXTENDED_COVERAGE, are left out of
+// ProtoBuf responses, which cannot represent them.
+func encodeV4Response(out v4FindThreatMatchesResponse, mime string) ([]byte, error) {
+	if mime != mimeProto {
+		return json.Marshal(out)
+	}
+	pbResp := new(sbpb.FindThreatMatchesResponse)
+	for _, m := range out.Matches {
+		tt, ok := sbpb.ThreatType_value[m.ThreatType]
+		if !ok {
+			continue
+		}
+		pm := &sbpb.ThreatMatch{
+			ThreatType:      sbpb.ThreatType(tt),
+			PlatformType:    sbpb.PlatformType(sbpb.PlatformType_value[m.PlatformType]),
+			ThreatEntryType: sbpb.ThreatEntryType(sbpb.ThreatEntryType_value[m.ThreatEntryType]),
+			Threat:          &sbpb.ThreatEntry{Url: m.Threat.URL},
+		}
+		if d, err := time.ParseDuration(m.CacheDuration); err == nil {
+			pm.CacheDuration = durationpb.New(d)
+		}
+		pbResp.Matches = append(pbResp.Matches, pm)
+	}
+	return proto.Marshal(pbResp)
+}
+
+// matchExpireTime returns the time until which the match of r with td may be
+// cached: the earliest expiry of the matches of its expressions, or the
+// expiry of the whole result if they have none.
+func matchExpireTime(r webrisk.URLResult, td webrisk.ThreatType) time.Time {
+	var expires []time.Time
+	for _, ut := range r.Threats {
+		if ut.ThreatType == td && !ut.ExpireTime.IsZero() {
+			expires = append(expires, ut.ExpireTime)
+		}
+	}
+	if len(expires) == 0 {
+		return r.ExpireTime
+	}
+	return earliest(expires...)
+}
+
+// v4CacheDuration returns the duration until expire in the format of the
+// cacheDuration of Safe Browsing v4, or an empty string if the match must not
+// be cached.
+func v4CacheDuration(expire, now time.Time) string {
+	ttl := expire.Sub(now) / time.Second
+	if expire.IsZero() || ttl <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%ds", ttl)
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+	sbpb "github.com/google/webrisk/internal/safebrowsing_proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestServeV4FindThreatMatches(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fl := &fakeLooker{
+		threats: map[string][]webrisk.URLThreat{
+			"http://bad.example.com/": {
+				{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware, ExpireTime: now.Add(10 * time.Minute)},
+				{Pattern: "example.com/", ThreatType: webrisk.ThreatTypeMalware, ExpireTime: now.Add(5 * time.Minute)},
+				{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineering},
+			},
+		},
+		expire: now.Add(time.Minute),
+	}
+
+	vectors := []struct {
+		method string
+		body   string
+		code   int
+		want   v4FindThreatMatchesResponse
+		cache  string // Cache-Control header
+	}{{
+		method: "POST",
+		body:   `{"threatInfo": {"threatEntryTypes": ["URL"], "threatEntries": [{"url": "http://bad.example.com/"}, {"url": "http://good.example.com/"}]}}`,
+		code:   http.StatusOK,
+		want: v4FindThreatMatchesResponse{Matches: []v4ThreatMatch{{
+			ThreatType:      "MALWARE",
+			PlatformType:    "ANY_PLATFORM",
+			ThreatEntryType: "URL",
+			Threat:          v4ThreatEntry{URL: "http://bad.example.com/"},
+			CacheDuration:   "300s",
+		}, {
+			ThreatType:      "SOCIAL_ENGINEERING",
+			PlatformType:    "ANY_PLATFORM",
+			ThreatEntryType: "URL",
+			Threat:          v4ThreatEntry{URL: "http://bad.example.com/"},
+			CacheDuration:   "60s",
+		}}},
+		cache: "max-age=60",
+	}, {
+		method: "POST",
+		body:   `{"threatInfo": {"threatTypes": ["MALWARE"], "platformTypes": ["WINDOWS", "LINUX"], "threatEntries": [{"url": "http://bad.example.com/"}]}}`,
+		code:   http.StatusOK,
+		want: v4FindThreatMatchesResponse{Matches: []v4ThreatMatch{{
+			ThreatType:      "MALWARE",
+			PlatformType:    "WINDOWS",
+			ThreatEntryType: "URL",
+			Threat:          v4ThreatEntry{URL: "http://bad.example.com/"},
+			CacheDuration:   "300s",
+		}, {
+			ThreatType:      "MALWARE",
+			PlatformType:    "LINUX",
+			ThreatEntryType: "URL",
+			Threat:          v4ThreatEntry{URL: "http://bad.example.com/"},
+			CacheDuration:   "300s",
+		}}},
+		cache: "max-age=60",
+	}, {
+		method: "POST",
+		body:   `{"threatInfo": {"threatEntries": [{"url": "http://good.example.com/"}]}}`,
+		code:   http.StatusOK,
+		cache:  "max-age=60",
+	}, {
+		method: "POST",
+		body:   `{"threatInfo": {"threatEntryTypes": ["EXECUTABLE"], "threatEntries": [{"url": "http://bad.example.com/"}]}}`,
+		code:   http.StatusBadRequest,
+	}, {
+		method: "POST",
+		body:   `{"threatInfo": {"threatTypes": ["BOGUS"], "threatEntries": [{"url": "http://bad.example.com/"}]}}`,
+		code:   http.StatusBadRequest,
+	}, {
+		method: "POST",
+		body:   `{"threatInfo": {"threatEntries": [{"url": "a"}, {"url": "b"}, {"url": "c"}]}}`,
+		code:   http.StatusRequestEntityTooLarge,
+	}, {
+		method: "GET",
+		code:   http.StatusMethodNotAllowed,
+	}}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, v4FindThreatMatchesPath, strings.NewReader(v.body))
+		serveV4FindThreatMatches(rec, req, fl, 2, func() time.Time { return now })
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		var got v4FindThreatMatchesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("test %d, response mismatch:\ngot  %+v\nwant %+v", i, got, v.want)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != v.cache {
+			t.Errorf("test %d, Cache-Control = %q, want %q", i, got, v.cache)
+		}
+	}
+}
+
+func TestServeV4FindThreatMatchesProto(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fl := &fakeLooker{
+		threats: map[string][]webrisk.URLThreat{
+			"http://bad.example.com/": {
+				{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeMalware},
+				{Pattern: "bad.example.com/", ThreatType: webrisk.ThreatTypeSocialEngineeringExtended},
+			},
+		},
+		expire: now.Add(5 * time.Minute),
+	}
+	pbReq, err := proto.Marshal(&sbpb.FindThreatMatchesRequest{
+		Client: &sbpb.ClientInfo{ClientId: "test", ClientVersion: "1.0"},
+		ThreatInfo: &sbpb.ThreatInfo{
+			ThreatTypes:      []sbpb.ThreatType{sbpb.ThreatType_MALWARE},
+			PlatformTypes:    []sbpb.PlatformType{sbpb.PlatformType_WINDOWS},
+			ThreatEntryTypes: []sbpb.ThreatEntryType{sbpb.ThreatEntryType_URL},
+			ThreatEntries: []*sbpb.ThreatEntry{
+				{Url: "http://bad.example.com/"},
+				{Url: "http://good.example.com/"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jsonReq := `{"threatInfo": {"threatEntries": [{"url": "http://bad.example.com/"}]}}`
+	want := &sbpb.FindThreatMatchesResponse{Matches: []*sbpb.ThreatMatch{{
+		ThreatType:      sbpb.ThreatType_MALWARE,
+		PlatformType:    sbpb.PlatformType_WINDOWS,
+		ThreatEntryType: sbpb.ThreatEntryType_URL,
+		Threat:          &sbpb.ThreatEntry{Url: "http://bad.example.com/"},
+		CacheDuration:   durationpb.New(5 * time.Minute),
+	}}}
+	// Matches of threat types unknown to Safe Browsing are left out.
+	wantAny := &sbpb.FindThreatMatchesResponse{Matches: []*sbpb.ThreatMatch{{
+		ThreatType:      sbpb.ThreatType_MALWARE,
+		PlatformType:    sbpb.PlatformType_ANY_PLATFORM,
+		ThreatEntryType: sbpb.ThreatEntryType_URL,
+		Threat:          &sbpb.ThreatEntry{Url: "http://bad.example.com/"},
+		CacheDuration:   durationpb.New(5 * time.Minute),
+	}}}
+
+	vectors := []struct {
+		body        string
+		contentType string
+		accept      string
+		code        int
+		mime        string                          // Content-Type of the response
+		want        *sbpb.FindThreatMatchesResponse // Expected ProtoBuf response, if any
+	}{
+		{string(pbReq), mimeProto, "", http.StatusOK, mimeProto, want},
+		{string(pbReq), mimeProto + "; charset=utf-8", "*/*", http.StatusOK, mimeProto, want},
+		{jsonReq, mimeJSON, mimeProto, http.StatusOK, mimeProto, wantAny},
+		{string(pbReq), mimeProto, mimeJSON, http.StatusOK, mimeJSON, nil},
+		{"\xff\xff", mimeProto, "", http.StatusBadRequest, "", nil},
+	}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", v4FindThreatMatchesPath, strings.NewReader(v.body))
+		req.Header.Set("Content-Type", v.contentType)
+		if v.accept != "" {
+			req.Header.Set("Accept", v.accept)
+		}
+		serveV4FindThreatMatches(rec, req, fl, 10, func() time.Time { return now })
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != v.mime {
+			t.Errorf("test %d, Content-Type = %q, want %q", i, got, v.mime)
+		}
+		switch v.mime {
+		case mimeProto:
+			got := new(sbpb.FindThreatMatchesResponse)
+			if err := proto.Unmarshal(rec.Body.Bytes(), got); err != nil {
+				t.Errorf("test %d, unexpected error: %v", i, err)
+				continue
+			}
+			if !proto.Equal(got, v.want) {
+				t.Errorf("test %d, response mismatch:\ngot  %v\nwant %v", i, got, v.want)
+			}
+		case mimeJSON:
+			var got v4FindThreatMatchesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got.Matches) != 1 || got.Matches[0].CacheDuration != "300s" {
+				t.Errorf("test %d, response = %s, %v, want a MALWARE match", i, rec.Body, err)
+			}
+		}
+	}
+}
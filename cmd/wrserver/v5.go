@@ -0,0 +1,132 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+const v5SearchHashesPath = "/v5/hashes:search"
+
+// maxV5HashPrefixes is the maximum number of hash prefixes accepted by a
+// single v5 hashes:search request.
+const maxV5HashPrefixes = 1000
+
+// v5SearchHashesResponse is the JSON form of the Safe Browsing v5
+// SearchHashesResponse message.
+type v5SearchHashesResponse struct {
+	FullHashes    []v5FullHash `json:"fullHashes,omitempty"`
+	CacheDuration string       `json:"cacheDuration"`
+}
+
+type v5FullHash struct {
+	FullHash        []byte             `json:"fullHash"`
+	FullHashDetails []v5FullHashDetail `json:"fullHashDetails"`
+}
+
+type v5FullHashDetail struct {
+	ThreatType string `json:"threatType"`
+}
+
+// hashSearcher searches for the full hashes of threats by hash prefix.
+// It is implemented by webrisk.UpdateClient.
+type hashSearcher interface {
+	SearchHashes(ctx context.Context, prefix []byte, threatTypes ...webrisk.ThreatType) ([]webrisk.HashThreat, time.Time, error)
+}
+
+// decodeBase64 decodes a bytes field given as a query parameter, which may use
+// either the standard or the URL safe base64 alphabet.
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64 value %q", s)
+}
+
+// serveV5SearchHashes implements the "/v5/hashes:search" endpoint of the
+// Safe Browsing API v5, so that clients of that protocol can use wrserver as
+// a local proxy. The hash prefixes are given as repeated base64 encoded
+// hashPrefixes query parameters.
+func serveV5SearchHashes(resp http.ResponseWriter, req *http.Request, hs hashSearcher, now func() time.Time) {
+	if req.Method != "GET" {
+		http.Error(resp, "invalid method", http.StatusMethodNotAllowed)
+		return
+	}
+	params := req.URL.Query()["hashPrefixes"]
+	if len(params) == 0 {
+		http.Error(resp, "missing hashPrefixes", http.StatusBadRequest)
+		return
+	}
+	if len(params) > maxV5HashPrefixes {
+		http.Error(resp, "too many hashPrefixes", http.StatusBadRequest)
+		return
+	}
+
+	var out v5SearchHashesResponse
+	var minTTL time.Duration = -1
+	updateTTL := func(t time.Time) {
+		if ttl := t.Sub(now()); minTTL < 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+	for _, p := range params {
+		prefix, err := decodeBase64(p)
+		if err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(prefix) < 4 || len(prefix) > 32 {
+			http.Error(resp, "hash prefixes must be between 4 and 32 bytes long", http.StatusBadRequest)
+			return
+		}
+		threats, nttl, err := hs.SearchHashes(req.Context(), prefix)
+		if err = lookupError(err); err != nil {
+			serveLookupError(resp, err)
+			return
+		}
+		updateTTL(nttl)
+		for _, ht := range threats {
+			fh := v5FullHash{FullHash: ht.Hash}
+			for _, td := range ht.ThreatTypes {
+				fh.FullHashDetails = append(fh.FullHashDetails, v5FullHashDetail{ThreatType: td.String()})
+			}
+			out.FullHashes = append(out.FullHashes, fh)
+			updateTTL(ht.ExpireTime)
+		}
+	}
+	if minTTL < 0 {
+		minTTL = 0
+	}
+	out.CacheDuration = fmt.Sprintf("%ds", minTTL/time.Second)
+
+	buf, err := json.Marshal(out)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", mimeJSON)
+	t := now()
+	setCacheControl(resp, t.Add(minTTL), t)
+	writeCacheable(resp, req, buf)
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestServeV5SearchHashes(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := append([]byte("abcd"), make([]byte, 28)...)
+	hs := &fakeSearcher{
+		threats: []webrisk.HashThreat{{
+			Hash:        fullHash,
+			ThreatTypes: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+			ExpireTime:  now.Add(10 * time.Minute),
+		}},
+		nttl: now.Add(5 * time.Minute),
+	}
+
+	vectors := []struct {
+		method string
+		query  string
+		code   int
+		want   v5SearchHashesResponse
+	}{{
+		method: "GET",
+		query:  "hashPrefixes=YWJjZA==",
+		code:   http.StatusOK,
+		want: v5SearchHashesResponse{
+			FullHashes:    []v5FullHash{{FullHash: fullHash, FullHashDetails: []v5FullHashDetail{{ThreatType: "MALWARE"}}}},
+			CacheDuration: "300s",
+		},
+	}, {
+		method: "GET",
+		query:  "hashPrefixes=d3h5eg&hashPrefixes=d3h5eg",
+		code:   http.StatusOK,
+		want:   v5SearchHashesResponse{CacheDuration: "300s"},
+	}, {
+		method: "GET",
+		query:  "",
+		code:   http.StatusBadRequest,
+	}, {
+		method: "GET",
+		query:  "hashPrefixes=YWJj",
+		code:   http.StatusBadRequest,
+	}, {
+		method: "GET",
+		query:  "hashPrefixes=!!!",
+		code:   http.StatusBadRequest,
+	}, {
+		method: "POST",
+		query:  "hashPrefixes=YWJjZA==",
+		code:   http.StatusMethodNotAllowed,
+	}}
+	for i, v := range vectors {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(v.method, v5SearchHashesPath+"?"+v.query, nil)
+		serveV5SearchHashes(rec, req, hs, func() time.Time { return now })
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+			continue
+		}
+		if v.code != http.StatusOK {
+			continue
+		}
+		var got v5SearchHashesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("test %d, response mismatch:\ngot  %+v\nwant %+v", i, got, v.want)
+		}
+	}
+}
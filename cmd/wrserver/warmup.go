@@ -0,0 +1,128 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+// Policies of -warmUp, deciding how lookups are answered until the threat
+// lists are synced for the first time.
+const (
+	warmUpUnavailable = "unavailable" // 503 Service Unavailable with Retry-After
+	warmUpSafe        = "safe"        // Every URL is reported as safe
+	warmUpLive        = "live"        // URLs are looked up with the Web Risk API alone
+)
+
+// warmUpRetryAfter is the delay in seconds after which clients are asked to
+// retry the lookups made before the threat lists are synced.
+const warmUpRetryAfter = 10
+
+// warmUpPolicy is the -warmUp policy.
+var warmUpPolicy = warmUpUnavailable
+
+// applyWarmUpPolicy validates the -warmUp policy and sets up conf for it.
+func applyWarmUpPolicy(policy string, conf *webrisk.Config) error {
+	switch policy {
+	case warmUpUnavailable, warmUpSafe:
+		conf.Strict = true
+	case warmUpLive:
+		conf.LiveLookupsUntilSynced = true
+	default:
+		return fmt.Errorf("unknown -warmUp policy %q", policy)
+	}
+	warmUpPolicy = policy
+	return nil
+}
+
+// lookupError returns the error of a lookup to report to clients. Lookups
+// failing only because the threat lists are not synced yet are answered as
+// if no threat was found with -warmUp=safe, in which case it returns nil.
+// Their results hold no expire time, so they are not cached.
+func lookupError(err error) error {
+	if warmUpPolicy == warmUpSafe && errors.Is(err, webrisk.ErrNotReady) {
+		return nil
+	}
+	return err
+}
+
+// serveLookupError answers a request whose lookup failed with err, with 503
+// Service Unavailable and a Retry-After header if the threat lists are not
+// synced yet, with 400 Bad Request if the scheme of the URL is rejected by
+// -schemePolicy, or with 500 Internal Server Error otherwise.
+func serveLookupError(resp http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, webrisk.ErrNotReady):
+		code = http.StatusServiceUnavailable
+		resp.Header().Set("Retry-After", strconv.Itoa(warmUpRetryAfter))
+	case errors.Is(err, webrisk.ErrUnsupportedScheme):
+		code = http.StatusBadRequest
+	}
+	http.Error(resp, err.Error(), code)
+}
+
+// warmCacheTimeout bounds the warm-up of the cache with -warmCache.
+const warmCacheTimeout = 5 * time.Minute
+
+// cacheWarmingUp is set while the cache is warmed up with -warmCache, during
+// which the server is not ready.
+var cacheWarmingUp int32
+
+// readURLList returns the URLs of the file at path, one per line. Blank lines
+// and lines starting with # are ignored.
+func readURLList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var urls []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls, sc.Err()
+}
+
+// startCacheWarmUp looks up urls with wr in the background, so that the cache
+// holds their verdicts, and keeps the server from being ready meanwhile.
+func startCacheWarmUp(wr *webrisk.UpdateClient, urls []string) {
+	atomic.StoreInt32(&cacheWarmingUp, 1)
+	go func() {
+		defer atomic.StoreInt32(&cacheWarmingUp, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), warmCacheTimeout)
+		defer cancel()
+		start := time.Now()
+		fetched, err := wr.WarmCache(ctx, urls)
+		if err != nil {
+			appLog.Errorf("Unable to warm up the cache: %v", err)
+		}
+		appLog.Infof("Warmed up the cache with %d URLs in %v, %d fetched from the Web Risk API", len(urls), time.Since(start).Round(time.Millisecond), fetched)
+	}()
+}
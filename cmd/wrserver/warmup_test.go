@@ -0,0 +1,113 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestCacheWarmUp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "popular.txt")
+	if err := ioutil.WriteFile(path, []byte("# Popular URLs\nhttp://example.com/\n\n  http://example.org/a  \n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	urls, err := readURLList(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"http://example.com/", "http://example.org/a"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("readURLList() = %q, want %q", urls, want)
+	}
+
+	// The server is not ready until the warm-up is done.
+	wr := newSyncedClient(t)
+	status := func() (webrisk.Stats, error) { return webrisk.Stats{}, nil }
+	atomic.StoreInt32(&cacheWarmingUp, 1)
+	rec := httptest.NewRecorder()
+	serveReadiness(rec, httptest.NewRequest("GET", readyPath, nil), status, 0)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code while warming up = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	startCacheWarmUp(wr, urls)
+	for deadline := time.Now().Add(10 * time.Second); atomic.LoadInt32(&cacheWarmingUp) != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("cache warm-up not done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	serveReadiness(rec, httptest.NewRequest("GET", readyPath, nil), status, 0)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status code after warming up = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	defer func(policy string) { warmUpPolicy = policy }(warmUpPolicy)
+	notReady := fmt.Errorf("%w: no database loaded", webrisk.ErrNotReady)
+
+	vectors := []struct {
+		policy     string
+		err        error
+		code       int
+		retryAfter string
+		strict     bool
+		live       bool
+	}{
+		{policy: warmUpUnavailable, err: notReady, code: http.StatusServiceUnavailable, retryAfter: "10", strict: true},
+		{policy: warmUpSafe, err: notReady, code: http.StatusOK, strict: true},
+		{policy: warmUpSafe, err: errors.New("lookup failed"), code: http.StatusInternalServerError, strict: true},
+		{policy: warmUpLive, err: errors.New("lookup failed"), code: http.StatusInternalServerError, live: true},
+		{policy: warmUpUnavailable, err: fmt.Errorf("%w: ftp", webrisk.ErrUnsupportedScheme), code: http.StatusBadRequest, strict: true},
+	}
+	for i, v := range vectors {
+		var conf webrisk.Config
+		if err := applyWarmUpPolicy(v.policy, &conf); err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if conf.Strict != v.strict || conf.LiveLookupsUntilSynced != v.live {
+			t.Errorf("test %d, Strict = %v, LiveLookupsUntilSynced = %v, want %v and %v",
+				i, conf.Strict, conf.LiveLookupsUntilSynced, v.strict, v.live)
+		}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", batchSearchPath, strings.NewReader(`{"uris": ["http://example.com/"]}`))
+		serveBatchSearch(rec, req, &fakeLooker{err: v.err}, 10)
+		if rec.Code != v.code {
+			t.Errorf("test %d, status code = %d, want %d", i, rec.Code, v.code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != v.retryAfter {
+			t.Errorf("test %d, Retry-After = %q, want %q", i, got, v.retryAfter)
+		}
+		if v.code == http.StatusOK && rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("test %d, Cache-Control = %q, want no-store", i, rec.Header().Get("Cache-Control"))
+		}
+	}
+	if err := applyWarmUpPolicy("open", new(webrisk.Config)); err == nil {
+		t.Errorf("applyWarmUpPolicy(%q) succeeded, want error", "open")
+	}
+}
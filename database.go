@@ -14,14 +14,23 @@
 package webrisk
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -51,16 +60,29 @@ const (
 //     changed since the last sync.
 //   - Anytime tfu is updated, generate a new tfl.
 //
+// When several processes share a database file, only one of them updates it
+// from the API. The others are configured with Config.ReadOnlyDB and call
+// Reload periodically, which loads the file whenever the generation counter
+// kept in the lock file next to it or the modification time of the file has
+// changed, the latter for files replaced by other means, such as copies of a
+// file updated elsewhere.
+//
 // The process for querying the database is as follows:
 //   - Check if the requested full hash matches any partial hash in tfl.
 //     If a match is found, return a set of ThreatTypes with a partial match.
 type database struct {
-	ml sync.RWMutex // Protects tfl, err, and last
+	ml sync.RWMutex // Protects tfl, err, last, synced, and the statistics
 	// threatsForLookup maps ThreatTypes to sets of partial hashes.
 	// This data structure is in a format that is easily queried.
-	tfl  threatsForLookup
-	err  error     // Last error encountered
-	last time.Time // Last time the threat list were synced
+	tfl    threatsForLookup
+	err    error     // Last error encountered
+	last   time.Time // Last time the threat list were synced
+	synced bool      // Whether the threat lists were ever successfully synced
+
+	listStats      map[ThreatType]ListStats // Update statistics per threat list
+	fileSize       int64                    // Size of the database file
+	loadFailures   int64                    // Number of failures to load the database file
+	updateDuration time.Duration            // Wall time of the last update
 
 	config *Config
 	// threatsForUpdate maps ThreatTypes to lists of partial hashes.
@@ -69,8 +91,15 @@ type database struct {
 	tfu threatsForUpdate
 	mu  sync.Mutex // Protects tfu
 
-	readyCh         chan struct{} // Used for waiting until not in an error state.
-	updateAPIErrors uint          // Number of times we attempted to contact the api and failed
+	readyCh       chan struct{} // Used for waiting until not in an error state.
+	generation    uint64        // Generation of the database file last loaded or saved
+	modTime       time.Time     // Modification time of the database file last reloaded
+	minNextUpdate time.Time     // Earliest next update allowed by the API
+
+	nextUpdate  map[ThreatType]time.Time // Time each threat list is due for an update
+	listErrors  map[ThreatType]uint      // Number of consecutive failed updates of each threat list
+	listLastErr map[ThreatType]error     // Error of the last update of each failing threat list
+	listSynced  map[ThreatType]time.Time // Last time each threat list was synced
 
 	log *log.Logger
 }
@@ -90,13 +119,144 @@ type partialHashes struct {
 type threatsForLookup map[ThreatType]hashSet
 
 // databaseFormat is a light struct used only for gob encoding and decoding.
-// As written to disk, the format of the database file is basically the gzip
-// compressed version of the gob encoding of databaseFormat.
+// As written to disk, the database file starts with a header made of dbMagic
+// and the version of the format, followed by the gob encoding of
+// riceDatabaseFormat, the Rice encoded form of databaseFormat.
 type databaseFormat struct {
 	Table threatsForUpdate
 	Time  time.Time
 }
 
+// Versions of the database file format.
+const (
+	dbVersionGob  = 1 // Gzip compressed gob of databaseFormat
+	dbVersionRice = 2 // Gob of riceDatabaseFormat
+
+	dbVersion = dbVersionRice // Version written by saveDatabase
+)
+
+// dbMagic starts the header of the database file.
+const dbMagic = "WRDB"
+
+// gzipID1 is the first byte of a gzip stream, with which files written
+// before the database file format was versioned start.
+const gzipID1 = 0x1f
+
+// databaseLoaders decode the contents of the database file following the
+// header, by version of the format. Loaders of older versions are kept so that
+// files written by older clients are migrated instead of being discarded.
+// Format changes must add a new version rather than modify an existing one.
+var databaseLoaders = map[int]func(io.Reader) (databaseFormat, error){
+	dbVersionGob:  loadGobDatabase,
+	dbVersionRice: loadRiceDatabase,
+}
+
+// riceDatabaseFormat is databaseFormat with the hash prefixes of every threat
+// list Rice encoded, using the same delta encoding as the Web Risk API.
+type riceDatabaseFormat struct {
+	Table map[ThreatType]riceList
+	Time  time.Time
+}
+
+type riceList struct {
+	Hashes  []riceHashes // One entry per hash prefix length, shortest first
+	Invalid hashPrefixes // Hashes of invalid length, stored as is
+	SHA256  []byte
+	State   []byte
+}
+
+// riceHashes holds sorted hash prefixes of the same length. The first four
+// bytes of every hash are Rice encoded as big endian integers, the remaining
+// bytes are stored as is in Suffixes.
+type riceHashes struct {
+	PrefixSize    int
+	FirstValue    int64
+	RiceParameter int32
+	EntryCount    int32
+	EncodedData   []byte
+	Suffixes      []byte
+}
+
+// encodeList Rice encodes the sorted list of hash prefixes.
+func encodeList(hashes hashPrefixes) riceList {
+	var out riceList
+	for _, h := range hashes {
+		if !h.IsValid() {
+			out.Invalid = append(out.Invalid, h)
+		}
+	}
+	for n := minHashPrefixLength; n <= maxHashPrefixLength; n++ {
+		var values []uint32
+		var suffixes []byte
+		for _, h := range hashes {
+			if len(h) != n {
+				continue
+			}
+			b := byte4(h)
+			values = append(values, binary.BigEndian.Uint32(b[:]))
+			suffixes = append(suffixes, h[minHashPrefixLength:]...)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		rice := encodeRiceIntegers(values)
+		out.Hashes = append(out.Hashes, riceHashes{
+			PrefixSize:    n,
+			FirstValue:    rice.FirstValue,
+			RiceParameter: rice.RiceParameter,
+			EntryCount:    rice.EntryCount,
+			EncodedData:   rice.EncodedData,
+			Suffixes:      suffixes,
+		})
+	}
+	return out
+}
+
+// decodeList decodes the hash prefixes encoded by encodeList.
+func decodeList(rl riceList) (hashPrefixes, error) {
+	total := len(rl.Invalid)
+	for _, rh := range rl.Hashes {
+		total += int(rh.EntryCount) + 1
+	}
+	if total == 0 {
+		return nil, nil
+	}
+
+	hashes := make(hashPrefixes, 0, total)
+	for _, rh := range rl.Hashes {
+		n := rh.PrefixSize
+		if n < minHashPrefixLength || n > maxHashPrefixLength {
+			return nil, errors.New("webrisk: invalid hash prefix length")
+		}
+		values, err := decodeRiceIntegers(&pb.RiceDeltaEncoding{
+			FirstValue:    rh.FirstValue,
+			RiceParameter: rh.RiceParameter,
+			EntryCount:    rh.EntryCount,
+			EncodedData:   rh.EncodedData,
+		})
+		if err != nil {
+			return nil, err
+		}
+		suffixes := rh.Suffixes
+		if len(suffixes) != len(values)*(n-minHashPrefixLength) {
+			return nil, errors.New("webrisk: invalid hash suffixes")
+		}
+
+		group := make(hashPrefixes, len(values))
+		var buf [maxHashPrefixLength]byte
+		for i, v := range values {
+			binary.BigEndian.PutUint32(buf[:], v)
+			copy(buf[minHashPrefixLength:n], suffixes)
+			suffixes = suffixes[n-minHashPrefixLength:]
+			group[i] = hashPrefix(buf[:n])
+		}
+		hashes = hashes.merge(group)
+	}
+	invalid := append(hashPrefixes(nil), rl.Invalid...)
+	invalid.Sort()
+	return hashes.merge(invalid), nil
+}
+
 // Init initializes the database from the specified file in config.DBPath.
 // It reports true if the database was successfully loaded. If it reports false
 // use Status for more details on the failure.
@@ -111,12 +271,96 @@ func (db *database) Init(config *Config, logger *log.Logger) bool {
 		db.setError(errors.New("no database loaded"))
 		return false
 	}
-	dbf, err := loadDatabase(db.config.DBPath)
+	// The generation and modification time are read before the file, so
+	// that Reload only loads it again once another one was saved.
+	gen, modTime := db.fileVersion()
+	dbf, version, err := loadDatabaseVersion(db.config.DBPath)
 	if err != nil {
 		db.log.Printf("load failure: %v", err)
+		db.recordLoadFailure()
 		db.setError(err)
 		return false
 	}
+	db.recordFileSize()
+	if version != dbVersion && !db.config.ReadOnlyDB {
+		db.log.Printf("migrating database file from format version %d to %d", version, dbVersion)
+		if err := db.save(dbf); err != nil {
+			db.log.Printf("migration failure: %v", err)
+		} else {
+			gen, modTime = db.fileVersion()
+		}
+	}
+	if !db.load(dbf, gen) {
+		return false
+	}
+	db.modTime = modTime
+	return true
+}
+
+// fileVersion returns the generation and the modification time of the
+// database file in config.DBPath, or zero values for those that cannot be
+// read.
+func (db *database) fileVersion() (gen uint64, modTime time.Time) {
+	if lock, err := lockDatabase(db.config.DBPath, false); err == nil {
+		gen, _ = readGeneration(lock)
+		unlockDatabase(lock)
+	}
+	if fi, err := os.Stat(db.config.DBPath); err == nil {
+		modTime = fi.ModTime()
+	}
+	return gen, modTime
+}
+
+// Reload reloads the database from the file in config.DBPath if another
+// process saved a new generation of it, or if the file was modified, since it
+// was last loaded. It reports true if a new generation was loaded. A file that
+// cannot be read, such as one partially copied, is not swapped in: the
+// database last loaded is kept until the next attempt.
+func (db *database) Reload() bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	lock, err := lockDatabase(db.config.DBPath, false)
+	if err != nil {
+		db.log.Printf("lock failure: %v", err)
+		return false
+	}
+	defer unlockDatabase(lock)
+
+	gen, err := readGeneration(lock)
+	if err != nil {
+		db.log.Printf("reload failure: %v", err)
+		return false
+	}
+	var modTime time.Time
+	if fi, err := os.Stat(db.config.DBPath); err == nil {
+		modTime = fi.ModTime()
+	}
+	if gen == db.generation && modTime.Equal(db.modTime) && db.tfu != nil {
+		return false
+	}
+	dbf, err := loadDatabase(db.config.DBPath)
+	if err != nil {
+		db.log.Printf("load failure: %v", err)
+		db.recordLoadFailure()
+		if db.tfu == nil {
+			db.setError(err)
+		}
+		return false
+	}
+	db.recordFileSize()
+	if !db.load(dbf, gen) {
+		return false
+	}
+	db.modTime = modTime
+	return true
+}
+
+// load validates the database file contents and makes them the current state
+// with the given generation.
+//
+// This assumes that the db.mu lock is already held.
+func (db *database) load(dbf databaseFormat, gen uint64) bool {
 	// Validate that the database threat list stored on disk is not too stale.
 	if db.isStale(dbf.Time) {
 		db.log.Printf("database loaded is stale")
@@ -128,20 +372,58 @@ func (db *database) Init(config *Config, logger *log.Logger) bool {
 	// Validate that the database threat list stored on disk is at least a
 	// superset of the specified configuration.
 	tfuNew := make(threatsForUpdate)
+	var missing bool
 	for _, td := range db.config.ThreatLists {
 		if row, ok := dbf.Table[td]; ok {
 			tfuNew[td] = row
 		} else {
 			db.log.Printf("database configuration mismatch, missing %v", td)
-			db.setError(errors.New("database configuration mismatch"))
-			return false
+			missing = true
 		}
 	}
+	if missing {
+		db.setError(errors.New("database configuration mismatch"))
+		if !db.config.ReadOnlyDB {
+			// Keep the lists that are present, so that the next update only
+			// needs to download the missing ones in full.
+			db.tfu = tfuNew
+		}
+		return false
+	}
 	db.tfu = tfuNew
+	db.generation = gen
+	db.listSynced = make(map[ThreatType]time.Time)
+	for td := range tfuNew {
+		db.listSynced[td] = dbf.Time
+	}
 	db.generateThreatsForLookups(dbf.Time)
 	return true
 }
 
+// Bootstrap seeds the database with the snapshot read from r, in the format
+// of the database file, which is then also saved to config.DBPath if set. The
+// snapshot is rejected if the checksum of a threat list does not match or if
+// it is stale. If it misses some of the configured threat lists, the others
+// are kept so that the next update only downloads the missing ones in full.
+func (db *database) Bootstrap(r io.Reader) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	dbf, _, err := readDatabase(r)
+	if err != nil {
+		return err
+	}
+	if !db.load(dbf, db.generation) {
+		return db.Status()
+	}
+	if db.config.DBPath != "" && !db.config.ReadOnlyDB {
+		// Semantically, we ignore save errors, but we do log them.
+		if err := db.save(dbf); err != nil {
+			db.log.Printf("unable to save database: %v", err)
+		}
+	}
+	return nil
+}
+
 // Status reports the health of the database. The database is considered faulted
 // if there was an error during update or if the last update has gone stale. If
 // in a faulted state, the db may repair itself on the next Update.
@@ -159,6 +441,14 @@ func (db *database) Status() error {
 	return nil
 }
 
+// Synced reports whether the threat lists were ever successfully synced,
+// either by an update or by loading the database file.
+func (db *database) Synced() bool {
+	db.ml.RLock()
+	defer db.ml.RUnlock()
+	return db.synced
+}
+
 // UpdateLag reports the amount of time in between when we expected to run
 // a database update and the current time
 func (db *database) UpdateLag() time.Duration {
@@ -177,6 +467,37 @@ func (db *database) SinceLastUpdate() time.Duration {
 	return db.config.now().Sub(db.last)
 }
 
+// MinUpdateWait reports how long the API requested to wait before the next
+// update. It is zero if an update may be made right away.
+func (db *database) MinUpdateWait() time.Duration {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if wait := time.Until(db.minNextUpdate); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// UpdateFailures returns the highest number of consecutive failed updates of
+// a threat list, and the error of the last update of every failing list.
+func (db *database) UpdateFailures() (int, map[ThreatType]error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var failures uint
+	errs := make(map[ThreatType]error)
+	for td, n := range db.listErrors {
+		if n > failures {
+			failures = n
+		}
+		if err := db.listLastErr[td]; n > 0 && err != nil {
+			errs[td] = err
+		}
+	}
+	return int(failures), errs
+}
+
 // Ready returns a channel that's closed when the database is ready for queries.
 func (db *database) Ready() <-chan struct{} {
 	return db.readyCh
@@ -185,77 +506,158 @@ func (db *database) Ready() <-chan struct{} {
 // Update synchronizes the local threat lists with those maintained by the
 // global Web Risk API servers. If the update is successful, Status should
 // report a nil error.
+//
+// Every threat list is updated on its own schedule: only the lists that are
+// due are requested, and a list that fails to update retries on its own
+// backoff without affecting the others. The database is only considered
+// faulted once every threat list is failing. Update reports the delay until
+// the next list is due and whether any list was updated.
 func (db *database) Update(ctx context.Context, api api) (time.Duration, bool) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	// Construct and make the requests.
+	start := time.Now()
+	defer func() {
+		db.ml.Lock()
+		db.updateDuration = time.Since(start)
+		db.ml.Unlock()
+	}()
+
+	if db.nextUpdate == nil {
+		db.nextUpdate = make(map[ThreatType]time.Time)
+		db.listErrors = make(map[ThreatType]uint)
+		db.listLastErr = make(map[ThreatType]error)
+	}
+	if db.listSynced == nil {
+		db.listSynced = make(map[ThreatType]time.Time)
+	}
+	now := db.config.now()
+
+	// Construct and make the requests for the lists that are due.
 	var s []*pb.ComputeThreatListDiffRequest
 	for _, td := range db.config.ThreatLists {
+		if now.Before(db.nextUpdate[td]) {
+			continue
+		}
 		var state []byte
 		if row, ok := db.tfu[td]; ok {
 			state = row.State
 		}
 
+		maxDiffEntries, maxDatabaseEntries := db.config.constraints(td)
 		s = append(s, &pb.ComputeThreatListDiffRequest{
 			ThreatType: pb.ThreatType(td),
 			Constraints: &pb.ComputeThreatListDiffRequest_Constraints{
 				SupportedCompressions: db.config.compressionTypes,
-				MaxDiffEntries:        db.config.MaxDiffEntries,
-				MaxDatabaseEntries:    db.config.MaxDatabaseEntries,
+				MaxDiffEntries:        maxDiffEntries,
+				MaxDatabaseEntries:    maxDatabaseEntries,
 			},
 			VersionToken: state,
 		})
 	}
+	if len(s) == 0 {
+		return db.nextDelay(now), false
+	}
+
+	// Query the API for all threat lists concurrently, with at most
+	// config.UpdateConcurrency requests in flight.
+	resps := make([]*pb.ComputeThreatListDiffResponse, len(s))
+	errs := make([]error, len(s))
+	concurrency := db.config.UpdateConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultUpdateConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, req := range s {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req *pb.ComputeThreatListDiffRequest) {
+			defer wg.Done()
+			resps[i], errs[i] = api.ListUpdate(ctx, req)
+			<-sem
+		}(i, req)
+	}
+	wg.Wait()
 
-	var resps []*pb.ComputeThreatListDiffResponse
+	// Update the threat database with the responses.
+	db.generateThreatsForUpdate()
+	diffs := make(map[ThreatType][2]int)
+	var lastErr error
+	for i, resp := range resps {
+		// Assume a 1:1 correspondence between request and response
+		td := ThreatType(s[i].ThreatType)
+		if err := errs[i]; err != nil {
+			db.log.Printf("ListUpdate failure for %v (%d): %v", td, db.listErrors[td]+1, err)
+			db.nextUpdate[td] = now.Add(db.backoff(td))
+			db.listLastErr[td] = err
+			lastErr = err
+			continue
+		}
 
-	// add jitter to wait time to avoid all servers lining up
-	nextUpdateWait := db.config.UpdatePeriod + time.Duration(rand.Int31n(60)-30)*time.Second
-	last := db.config.now()
-	for _, req := range s {
-		// Query the API for the threat list and update the database.
-		resp, err := api.ListUpdate(ctx, req)
+		adds, dels, err := db.tfu.update(resp, td)
 		if err != nil {
-			db.log.Printf("ListUpdate failure (%d): %v", db.updateAPIErrors+1, err)
-			db.setError(err)
-			// backoff strategy: MIN((2**N-1 * 15 minutes) * (RAND + 1), 24 hours)
-			n := 1 << db.updateAPIErrors
-			delay := time.Duration(float64(n) * (rand.Float64() + 1) * float64(baseRetryDelay))
-			if delay > maxRetryDelay {
-				delay = maxRetryDelay
+			if err == errChecksum {
+				db.recordChecksumFailure(td)
 			}
-			db.updateAPIErrors++
-			return delay, false
+			db.log.Printf("update failure for %v (%d): %v", td, db.listErrors[td]+1, err)
+			db.log.Printf("resetting threat list %v for a full download", td)
+			db.recordReset(td)
+
+			// Every other list is consistent with its own version token,
+			// so only the corrupt list is downloaded again in full by its
+			// next update. Until then, lookups use its previous contents.
+			delete(db.tfu, td)
+			db.nextUpdate[td] = now.Add(db.backoff(td))
+			db.listLastErr[td] = err
+			lastErr = err
+			continue
 		}
-		resps = append(resps, resp)
+		diffs[td] = [2]int{adds, dels}
+
+		// add jitter to wait time to avoid all servers lining up
+		nextUpdateWait := db.config.UpdatePeriod + time.Duration(rand.Int31n(60)-30)*time.Second
 		if resp.RecommendedNextDiff != nil {
 			ndiff := resp.RecommendedNextDiff.AsTime()
+			if ndiff.After(db.minNextUpdate) {
+				db.minNextUpdate = ndiff
+			}
 			serverMinWait := time.Duration(ndiff.Sub(time.Now()))
 			if serverMinWait > nextUpdateWait {
 				nextUpdateWait = serverMinWait
-				db.log.Printf("Server requested next update in %v", nextUpdateWait)
+				db.log.Printf("Server requested next update of %v in %v", td, nextUpdateWait)
 			}
 		}
+		db.nextUpdate[td] = now.Add(nextUpdateWait)
+		db.listErrors[td] = 0
+		delete(db.listLastErr, td)
+		db.listSynced[td] = now
 	}
+	db.recordDiffs(diffs)
 
-	// If for some reason we missed a request or didn't get a response the
-	// rest of the logic may fail.
-	if len(s) != len(resps) {
-		db.setError(errors.New("mismatch between requests sent and responses received"))
-		return nextUpdateWait, false
+	failing := 0
+	for _, td := range db.config.ThreatLists {
+		if db.listErrors[td] > 0 {
+			failing++
+		}
+	}
+	if failing == len(db.config.ThreatLists) {
+		// Keep the lists that are consistent with their version tokens, so
+		// that they do not need to be downloaded again in full.
+		tfu := db.tfu
+		db.setError(lastErr)
+		if len(tfu) > 0 {
+			db.tfu = tfu
+		}
+		return db.nextDelay(now), false
 	}
 
-	db.updateAPIErrors = 0
-	// Update the threat database with the response.
-	db.generateThreatsForUpdate()
-	for i, resp := range resps {
-		// Assume a 1:1 correspondence between request and response
-		if err := db.tfu.update(resp, ThreatType(s[i].ThreatType)); err != nil {
-			db.setError(err)
-			db.log.Printf("update failure: %v", err)
-			db.tfu = nil
-			return nextUpdateWait, false
+	// The database is only as fresh as its least recently synced list.
+	last := now
+	for _, td := range db.config.ThreatLists {
+		if t, ok := db.listSynced[td]; ok && t.Before(last) {
+			last = t
 		}
 	}
 
@@ -265,16 +667,69 @@ func (db *database) Update(ctx context.Context, api api) (time.Duration, bool) {
 		dbf.Table[td] = phs
 	}
 
+	// Lists that were reset keep their previous contents for lookups
+	// until they are downloaded again.
+	db.ml.RLock()
+	tfl := db.tfl
+	db.ml.RUnlock()
 	db.generateThreatsForLookups(last)
+	db.ml.Lock()
+	for td, hs := range tfl {
+		if _, ok := db.tfu[td]; !ok {
+			db.tfl[td] = hs
+		}
+	}
+	db.ml.Unlock()
 
 	// Regenerate the database and store it.
 	if db.config.DBPath != "" {
 		// Semantically, we ignore save errors, but we do log them.
-		if err := saveDatabase(db.config.DBPath, dbf); err != nil {
+		if err := db.save(dbf); err != nil {
 			db.log.Printf("save failure: %v", err)
 		}
 	}
-	return nextUpdateWait, true
+	return db.nextDelay(now), len(diffs) > 0
+}
+
+// nextDelay returns the delay until the next threat list is due for an update.
+//
+// This assumes that the db.mu lock is already held.
+func (db *database) nextDelay(now time.Time) time.Duration {
+	var next time.Time
+	for _, td := range db.config.ThreatLists {
+		if t := db.nextUpdate[td]; next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	if delay := next.Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// ScheduleNow makes every threat list due for an update.
+func (db *database) ScheduleNow() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for td := range db.nextUpdate {
+		delete(db.nextUpdate, td)
+	}
+}
+
+// backoff returns the delay before retrying a failed update of the threat
+// list td and counts the failure.
+// The strategy is MIN((2**N-1 * 15 minutes) * (RAND + 1), 24 hours).
+//
+// This assumes that the db.mu lock is already held.
+func (db *database) backoff(td ThreatType) time.Duration {
+	n := 1 << db.listErrors[td]
+	delay := time.Duration(float64(n) * (rand.Float64() + 1) * float64(baseRetryDelay))
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	db.listErrors[td]++
+	db.recordUpdateFailure(td)
+	return delay
 }
 
 // Lookup looks up the full hash in the threat list and returns a partial
@@ -295,6 +750,126 @@ func (db *database) Lookup(hash hashPrefix) (h hashPrefix, tds []ThreatType) {
 	return h, tds
 }
 
+// LookupPrefix looks up a partial hash in all of the threat lists and returns
+// the threat lists that may hold full hashes starting with it.
+func (db *database) LookupPrefix(p hashPrefix) (tds []ThreatType) {
+	db.ml.RLock()
+	for td, hs := range db.tfl {
+		if hs.LookupPrefix(p) {
+			tds = append(tds, td)
+		}
+	}
+	db.ml.RUnlock()
+	return tds
+}
+
+// HashPrefixes returns the sorted hash prefixes stored for the threat list td,
+// and reports whether the list is loaded.
+func (db *database) HashPrefixes(td ThreatType) (hashPrefixes, bool) {
+	db.ml.RLock()
+	hs, ok := db.tfl[td]
+	var phs hashPrefixes
+	if ok {
+		phs = hs.Export()
+	}
+	db.ml.RUnlock()
+	phs.Sort()
+	return phs, ok
+}
+
+// Stats returns the statistics of every threat list, the size of the
+// database file, the wall time of the last update, and the number of failures
+// to load the database file.
+func (db *database) Stats() (map[ThreatType]ListStats, int64, time.Duration, int64) {
+	db.ml.RLock()
+	defer db.ml.RUnlock()
+
+	lists := make(map[ThreatType]ListStats)
+	for td, ls := range db.listStats {
+		lists[td] = ls
+	}
+	for td, hs := range db.tfl {
+		ls := lists[td]
+		ls.HashPrefixes = hs.Len()
+		ls.MemoryBytes = hs.Bytes()
+		lists[td] = ls
+	}
+	return lists, db.fileSize, db.updateDuration, db.loadFailures
+}
+
+// recordDiffs records the number of hash prefixes added and removed for
+// every threat list by an update.
+func (db *database) recordDiffs(diffs map[ThreatType][2]int) {
+	db.ml.Lock()
+	defer db.ml.Unlock()
+	if db.listStats == nil {
+		db.listStats = make(map[ThreatType]ListStats)
+	}
+	for td, d := range diffs {
+		ls := db.listStats[td]
+		ls.LastAdditions, ls.LastRemovals = d[0], d[1]
+		ls.Additions += int64(d[0])
+		ls.Removals += int64(d[1])
+		db.listStats[td] = ls
+	}
+}
+
+// recordChecksumFailure records that an update of the threat list td failed
+// checksum validation.
+func (db *database) recordChecksumFailure(td ThreatType) {
+	db.ml.Lock()
+	defer db.ml.Unlock()
+	if db.listStats == nil {
+		db.listStats = make(map[ThreatType]ListStats)
+	}
+	ls := db.listStats[td]
+	ls.ChecksumFailures++
+	db.listStats[td] = ls
+}
+
+// recordUpdateFailure records that an update of the threat list td failed.
+func (db *database) recordUpdateFailure(td ThreatType) {
+	db.ml.Lock()
+	defer db.ml.Unlock()
+	if db.listStats == nil {
+		db.listStats = make(map[ThreatType]ListStats)
+	}
+	ls := db.listStats[td]
+	ls.UpdateFailures++
+	db.listStats[td] = ls
+}
+
+// recordReset records that the threat list td was reset to recover from an
+// update that could not be applied.
+func (db *database) recordReset(td ThreatType) {
+	db.ml.Lock()
+	defer db.ml.Unlock()
+	if db.listStats == nil {
+		db.listStats = make(map[ThreatType]ListStats)
+	}
+	ls := db.listStats[td]
+	ls.Resets++
+	db.listStats[td] = ls
+}
+
+// recordLoadFailure records that the database file could not be loaded.
+func (db *database) recordLoadFailure() {
+	db.ml.Lock()
+	db.loadFailures++
+	db.ml.Unlock()
+}
+
+// recordFileSize records the size of the database file at config.DBPath.
+func (db *database) recordFileSize() {
+	fi, err := os.Stat(db.config.DBPath)
+	if err != nil {
+		return
+	}
+	db.ml.Lock()
+	db.fileSize = fi.Size()
+	db.ml.Unlock()
+}
+
 // setError clears the database state and sets the last error to be err.
 //
 // This assumes that the db.mu lock is already held.
@@ -353,7 +928,10 @@ func (db *database) generateThreatsForUpdate() {
 
 	db.ml.RLock()
 	for td, hs := range db.tfl {
-		phs := db.tfu[td]
+		phs, ok := db.tfu[td]
+		if !ok {
+			continue // The list was reset and needs a full download
+		}
 		phs.Hashes = hs.Export()
 		db.tfu[td] = phs
 	}
@@ -361,7 +939,8 @@ func (db *database) generateThreatsForUpdate() {
 }
 
 // generateThreatsForLookups regenerates the threatsForLookup data structure
-// from the threatsForUpdate data structure and stores the last timestamp.
+// from the threatsForUpdate data structure and stores the last timestamp, along
+// with the time every threat list was last synced.
 // Since the hashes are effectively stored as a set inside the threatsForLookup,
 // we clear out the hashes slice in threatsForUpdate so that it can be GCed.
 //
@@ -379,7 +958,15 @@ func (db *database) generateThreatsForLookups(last time.Time) {
 
 	db.ml.Lock()
 	wasBad := db.err != nil
-	db.tfl, db.last = tfl, last
+	db.tfl, db.last, db.synced = tfl, last, true
+	if db.listStats == nil {
+		db.listStats = make(map[ThreatType]ListStats)
+	}
+	for td, t := range db.listSynced {
+		ls := db.listStats[td]
+		ls.LastSynced = t
+		db.listStats[td] = ls
+	}
 	db.ml.Unlock()
 
 	if wasBad {
@@ -388,10 +975,116 @@ func (db *database) generateThreatsForLookups(last time.Time) {
 	}
 }
 
-// saveDatabase saves the database threat list to a file.
+// snapshot returns the current state of the database, with the hash prefixes
+// of every threat list, as saved to the database file. It reports false if the
+// threat lists were never synced.
+func (db *database) snapshot() (databaseFormat, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ml.RLock()
+	defer db.ml.RUnlock()
+	if !db.synced {
+		return databaseFormat{}, false
+	}
+	dbf := databaseFormat{make(threatsForUpdate), db.last}
+	for td, phs := range db.tfu {
+		hs, ok := db.tfl[td]
+		if !ok {
+			continue
+		}
+		phs.Hashes = hs.Export()
+		phs.Hashes.Sort()
+		dbf.Table[td] = phs
+	}
+	return dbf, true
+}
+
+// save saves dbf to config.DBPath as the next generation of the database file
+// while holding an exclusive lock, so that readers in other processes never
+// observe a generation that does not match the file contents.
+//
+// This assumes that the db.mu lock is already held.
+func (db *database) save(dbf databaseFormat) error {
+	lock, err := lockDatabase(db.config.DBPath, true)
+	if err != nil {
+		return err
+	}
+	defer unlockDatabase(lock)
+
+	gen, err := readGeneration(lock)
+	if err != nil {
+		return err
+	}
+	if gen < db.generation {
+		gen = db.generation
+	}
+	if err := saveDatabase(db.config.DBPath, dbf); err != nil {
+		return err
+	}
+	db.recordFileSize()
+	db.generation = gen + 1
+	return writeGeneration(lock, db.generation)
+}
+
+// lockDatabase opens and locks the lock file that accompanies the database
+// file at path. Writers take an exclusive lock, readers a shared one.
+func lockDatabase(path string, exclusive bool) (*os.File, error) {
+	flag := os.O_RDONLY | os.O_CREATE
+	if exclusive {
+		flag = os.O_RDWR | os.O_CREATE
+	}
+	f, err := os.OpenFile(path+".lock", flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockDatabase releases and closes a lock file opened by lockDatabase.
+func unlockDatabase(f *os.File) error {
+	if err := unlockFile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readGeneration reads the generation counter stored in the lock file.
+// An empty lock file is generation zero.
+func readGeneration(f *os.File) (uint64, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// writeGeneration stores the generation counter in the lock file.
+func writeGeneration(f *os.File, gen uint64) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.FormatUint(gen, 10)+"\n"), 0)
+	return err
+}
+
+// saveDatabase saves the database threat list to a file. The file is written
+// to a temporary location first and then renamed over path, so that a
+// concurrent reader never observes a partially written database.
 func saveDatabase(path string, db databaseFormat) (err error) {
 	var file *os.File
-	file, err = os.Create(path)
+	file, err = ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
 	if err != nil {
 		return err
 	}
@@ -399,31 +1092,58 @@ func saveDatabase(path string, db databaseFormat) (err error) {
 		if cerr := file.Close(); err == nil {
 			err = cerr
 		}
+		if err == nil {
+			err = os.Rename(file.Name(), path)
+		}
+		if err != nil {
+			os.Remove(file.Name())
+		}
 	}()
 
-	gz, err := gzip.NewWriterLevel(file, gzip.BestCompression)
-	if err != nil {
+	// ioutil.TempFile creates the file readable by its owner only, while
+	// -readOnly processes reading the database may run as other users.
+	if err = file.Chmod(0644); err != nil {
 		return err
 	}
-	defer func() {
-		if zerr := gz.Close(); err == nil {
-			err = zerr
-		}
-	}()
+	w := bufio.NewWriter(file)
+	if err = writeDatabase(w, db); err != nil {
+		return err
+	}
+	return w.Flush()
+}
 
-	encoder := gob.NewEncoder(gz)
-	if err = encoder.Encode(db); err != nil {
+// writeDatabase writes the database state to w in the format of the database
+// file, header included.
+func writeDatabase(w io.Writer, db databaseFormat) error {
+	rdf := riceDatabaseFormat{Time: db.Time}
+	if len(db.Table) > 0 {
+		rdf.Table = make(map[ThreatType]riceList, len(db.Table))
+	}
+	for td, phs := range db.Table {
+		rl := encodeList(phs.Hashes)
+		rl.SHA256, rl.State = phs.SHA256, phs.State
+		rdf.Table[td] = rl
+	}
+
+	if _, err := w.Write(append([]byte(dbMagic), dbVersion)); err != nil {
 		return err
 	}
-	return nil
+	return gob.NewEncoder(w).Encode(rdf)
 }
 
 // loadDatabase loads the database state from a file.
 func loadDatabase(path string) (db databaseFormat, err error) {
+	db, _, err = loadDatabaseVersion(path)
+	return db, err
+}
+
+// loadDatabaseVersion loads the database state from a file, and reports the
+// version of the format the file was written in.
+func loadDatabaseVersion(path string) (db databaseFormat, version int, err error) {
 	var file *os.File
 	file, err = os.Open(path)
 	if err != nil {
-		return db, err
+		return db, 0, err
 	}
 	defer func() {
 		if cerr := file.Close(); err == nil {
@@ -431,7 +1151,60 @@ func loadDatabase(path string) (db databaseFormat, err error) {
 		}
 	}()
 
-	gz, err := gzip.NewReader(file)
+	return readDatabase(file)
+}
+
+// readDatabase reads the database state from r, in the format of the
+// database file, and reports the version of the format it was written in.
+// The checksum of every threat list is verified.
+func readDatabase(rd io.Reader) (db databaseFormat, version int, err error) {
+	if db, version, err = decodeDatabase(rd); err != nil {
+		return db, version, err
+	}
+	for _, dv := range db.Table {
+		if !bytes.Equal(dv.SHA256, dv.Hashes.SHA256()) {
+			return db, version, errChecksum
+		}
+	}
+	return db, version, nil
+}
+
+// decodeDatabase decodes the database state from r like readDatabase,
+// without verifying the checksums of the threat lists.
+func decodeDatabase(rd io.Reader) (db databaseFormat, version int, err error) {
+	r := bufio.NewReader(rd)
+	version, err = readDatabaseHeader(r)
+	if err != nil {
+		return db, 0, err
+	}
+	load, ok := databaseLoaders[version]
+	if !ok {
+		return db, version, fmt.Errorf("webrisk: unsupported database format version %d", version)
+	}
+	db, err = load(r)
+	return db, version, err
+}
+
+// readDatabaseHeader reads the header of the database file from r, and
+// returns the version of the format of the rest of the file.
+func readDatabaseHeader(r *bufio.Reader) (int, error) {
+	b, err := r.Peek(len(dbMagic) + 1)
+	switch {
+	case len(b) > 0 && b[0] == gzipID1:
+		// Files without a header, from before the format was versioned.
+		return dbVersionGob, nil
+	case err != nil:
+		return 0, err
+	case string(b[:len(dbMagic)]) != dbMagic:
+		return 0, errors.New("webrisk: invalid database file header")
+	}
+	r.Discard(len(b))
+	return int(b[len(dbMagic)]), nil
+}
+
+// loadGobDatabase decodes a database file in the dbVersionGob format.
+func loadGobDatabase(r io.Reader) (db databaseFormat, err error) {
+	gz, err := gzip.NewReader(r)
 	if err != nil {
 		return db, err
 	}
@@ -442,25 +1215,50 @@ func loadDatabase(path string) (db databaseFormat, err error) {
 	}()
 
 	decoder := gob.NewDecoder(gz)
-	if err = decoder.Decode(&db); err != nil {
+	err = decoder.Decode(&db)
+	return db, err
+}
+
+// loadRiceDatabase decodes a database file in the dbVersionRice format.
+func loadRiceDatabase(r io.Reader) (db databaseFormat, err error) {
+	var rdf riceDatabaseFormat
+	decoder := gob.NewDecoder(r)
+	if err = decoder.Decode(&rdf); err != nil {
 		return db, err
 	}
-	for _, dv := range db.Table {
-		if !bytes.Equal(dv.SHA256, dv.Hashes.SHA256()) {
-			return db, errors.New("webrisk: threat list SHA256 mismatch")
+
+	db.Time = rdf.Time
+	if len(rdf.Table) > 0 {
+		db.Table = make(threatsForUpdate, len(rdf.Table))
+	}
+	for td, rl := range rdf.Table {
+		hashes, err := decodeList(rl)
+		if err != nil {
+			return db, err
 		}
+		db.Table[td] = partialHashes{Hashes: hashes, SHA256: rl.SHA256, State: rl.State}
 	}
 	return db, nil
 }
 
 // update updates the threat list according to the API response.
-func (tfu threatsForUpdate) update(resp *pb.ComputeThreatListDiffResponse, td ThreatType) error {
+// It returns the number of hash prefixes added and removed.
+func (tfu threatsForUpdate) update(resp *pb.ComputeThreatListDiffResponse, td ThreatType) (adds, dels int, err error) {
 	phs, ok := tfu[td]
 
 	removalQuantity := 0
 	if resp.ResponseType == pb.ComputeThreatListDiffResponse_RESET {
+		dels = len(phs.Hashes)
 		phs = partialHashes{}
 	}
+
+	// Hashes must be sorted for removal logic to work properly and for the
+	// SHA256 checksum to be correct. Lists are kept sorted across updates, so
+	// this is usually a single pass over the hashes.
+	if !sort.IsSorted(phs.Hashes) {
+		phs.Hashes.Sort()
+	}
+
 	if resp.Removals != nil {
 		if resp.Removals.RawIndices != nil {
 			removalQuantity += len(resp.Removals.RawIndices.Indices)
@@ -475,27 +1273,25 @@ func (tfu threatsForUpdate) update(resp *pb.ComputeThreatListDiffResponse, td Th
 		switch resp.ResponseType {
 		case pb.ComputeThreatListDiffResponse_DIFF:
 			if !ok {
-				return errors.New("webrisk: partial update received for non-existent key")
+				return 0, 0, errors.New("webrisk: partial update received for non-existent key")
 			}
 		case pb.ComputeThreatListDiffResponse_RESET:
 			if removalQuantity > 0 {
-				return errors.New("webrisk: indices to be removed included in a full update")
+				return 0, 0, errors.New("webrisk: indices to be removed included in a full update")
 			}
 		default:
-			return errors.New("webrisk: unknown response type")
+			return 0, 0, errors.New("webrisk: unknown response type")
 		}
 
-		// Hashes must be sorted for removal logic to work properly.
-		phs.Hashes.Sort()
-
 		idxs, err := decodeIndices(resp.Removals)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
+		dels += len(idxs)
 
 		for _, i := range idxs {
 			if i < 0 || i >= int32(len(phs.Hashes)) {
-				return errors.New("webrisk: invalid removal index")
+				return 0, 0, errors.New("webrisk: invalid removal index")
 			}
 			phs.Hashes[i] = ""
 		}
@@ -513,28 +1309,31 @@ func (tfu threatsForUpdate) update(resp *pb.ComputeThreatListDiffResponse, td Th
 	}
 
 	if resp.Additions != nil {
-
 		hashes, err := decodeHashes(resp.Additions)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
-		phs.Hashes = append(phs.Hashes, hashes...)
+		adds = len(hashes)
+
+		// Only the additions need sorting, as they are merged into the
+		// existing list which is already sorted.
+		hashPrefixes(hashes).Sort()
+		phs.Hashes = phs.Hashes.merge(hashes)
 	}
 
-	// Hashes must be sorted for SHA256 checksum to be correct.
-	phs.Hashes.Sort()
-	if err := phs.Hashes.Validate(); err != nil {
-		return err
+	sum, err := phs.Hashes.checksum()
+	if err != nil {
+		return 0, 0, err
 	}
 
 	if cs := resp.GetChecksum(); cs != nil {
 		phs.SHA256 = cs.Sha256
 	}
-	if !bytes.Equal(phs.SHA256, phs.Hashes.SHA256()) {
-		return errors.New("webrisk: threat list SHA256 mismatch")
+	if !bytes.Equal(phs.SHA256, sum) {
+		return 0, 0, errChecksum
 	}
 
 	phs.State = resp.NewVersionToken
 	tfu[td] = phs
-	return nil
+	return adds, dels, nil
 }
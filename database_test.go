@@ -14,7 +14,11 @@
 package webrisk
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -23,9 +27,12 @@ import (
 	"log"
 	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -62,6 +69,7 @@ func newHashSet(phs hashPrefixes) (hs hashSet) {
 func TestDatabaseInit(t *testing.T) {
 	path := mustGetTempFile(t)
 	defer os.Remove(path)
+	defer os.Remove(path + ".lock")
 
 	now := time.Unix(1451436338, 951473000)
 	mockNow := func() time.Time { return now }
@@ -96,7 +104,8 @@ func TestDatabaseInit(t *testing.T) {
 			},
 		},
 		newDB: &database{
-			last: now.Add(-DefaultUpdatePeriod + time.Minute),
+			synced: true,
+			last:   now.Add(-DefaultUpdatePeriod + time.Minute),
 			tfu: threatsForUpdate{
 				ThreatTypeUnspecified: partialHashes{
 					SHA256: mustDecodeHex(t, "e5c1edb50ff8b4fcc3ead3a845ffbe1ad51c9dae5d44335a5c333b57ac8df062"),
@@ -137,7 +146,8 @@ func TestDatabaseInit(t *testing.T) {
 			},
 		},
 		newDB: &database{
-			last: now.Add(-DefaultUpdatePeriod + (30 * time.Minute)),
+			synced: true,
+			last:   now.Add(-DefaultUpdatePeriod + (30 * time.Minute)),
 			tfu: threatsForUpdate{
 				ThreatTypeUnspecified: partialHashes{
 					SHA256: mustDecodeHex(t, "e5c1edb50ff8b4fcc3ead3a845ffbe1ad51c9dae5d44335a5c333b57ac8df062"),
@@ -178,7 +188,8 @@ func TestDatabaseInit(t *testing.T) {
 			},
 		},
 		newDB: &database{
-			last: now,
+			synced: true,
+			last:   now,
 			tfu: threatsForUpdate{
 				ThreatTypeUnspecified: partialHashes{
 					SHA256: mustDecodeHex(t, "e5c1edb50ff8b4fcc3ead3a845ffbe1ad51c9dae5d44335a5c333b57ac8df062"),
@@ -271,7 +282,14 @@ func TestDatabaseInit(t *testing.T) {
 			t.Errorf("test %d, mismatching status: got %v, want %v", i, fail, v.fail)
 		}
 
-		db2.config, db2.log, db2.readyCh = nil, nil, nil
+		if !v.fail && db2.fileSize == 0 {
+			t.Errorf("test %d, database file size not recorded", i)
+		}
+		if !v.fail && db2.modTime.IsZero() {
+			t.Errorf("test %d, database file modification time not recorded", i)
+		}
+		db2.config, db2.log, db2.readyCh, db2.fileSize, db2.listSynced, db2.listStats = nil, nil, nil, 0, nil, nil
+		db2.modTime = time.Time{}
 		if !v.fail && !reflect.DeepEqual(db2, v.newDB) {
 			t.Errorf("test %d, mismatching database contents:\ngot  %+v\nwant %+v", i, db2, v.newDB)
 		}
@@ -347,9 +365,9 @@ func TestDatabaseUpdate(t *testing.T) {
 		t.Fatalf("update 0, unexpected update success")
 	}
 
-	// MinimumWaitDuration is less than the jitter generated by the db code so don't use it
-	if math.Abs((config.UpdatePeriod - delay).Seconds()) > 31 {
-		t.Fatalf("update 0, jitter was more than 30 seconds")
+	// A list that cannot be updated is reset and downloaded again with backoff.
+	if delay < baseRetryDelay || delay > 2*baseRetryDelay {
+		t.Fatalf("update 0, delay %v not within backoff range", delay)
 	}
 
 	// Update 1: full update to all values.
@@ -445,8 +463,8 @@ func TestDatabaseUpdate(t *testing.T) {
 	if db.err == nil || updated {
 		t.Fatalf("update 4, unexpected update success")
 	}
-	if math.Abs((config.UpdatePeriod - delay).Seconds()) > 31 {
-		t.Fatalf("update 4, delay jitter was more than 30 seconds")
+	if delay < baseRetryDelay || delay > 2*baseRetryDelay {
+		t.Fatalf("update 4, delay %v not within backoff range", delay)
 	}
 	gotDB = &database{last: db.last, tfu: db.tfu, tfl: db.tfl}
 	wantDB = &database{}
@@ -462,8 +480,8 @@ func TestDatabaseUpdate(t *testing.T) {
 	if db.err == nil || updated {
 		t.Fatalf("update 5, unexpected update success")
 	}
-	if math.Abs((config.UpdatePeriod - delay).Seconds()) > 31 {
-		t.Fatalf("update 5, delay jitter was more than 30 seconds")
+	if delay < 2*baseRetryDelay || delay > 4*baseRetryDelay {
+		t.Fatalf("update 5, delay %v not within backoff range", delay)
 	}
 	gotDB = &database{last: db.last, tfu: db.tfu, tfl: db.tfl}
 	wantDB = &database{}
@@ -472,40 +490,266 @@ func TestDatabaseUpdate(t *testing.T) {
 	}
 
 	// Update 6: api is broken for some unknown reason. Checks the backoff
+	// keeps growing after the failures of the previous updates.
+	now = now.Add(maxRetryDelay)
 	errResponse = errors.New("Something broke")
 	delay, updated = db.Update(context.Background(), mockAPI)
 	if db.err == nil || updated {
 		t.Fatalf("update 6, unexpected update success")
 	}
-	minDelay := baseRetryDelay.Seconds() * float64(1) * float64(1)
-	maxDelay := baseRetryDelay.Seconds() * float64(2) * float64(1)
+	minDelay := baseRetryDelay.Seconds() * float64(1) * float64(4)
+	maxDelay := baseRetryDelay.Seconds() * float64(2) * float64(4)
 	if delay.Seconds() < minDelay || delay.Seconds() > maxDelay {
 		t.Fatalf("update 6, Expected delay %v to be between %v and %v", delay.Seconds(), minDelay, maxDelay)
 	}
 
 	// Update 7: api is still broken, check backoff is larger
+	now = now.Add(maxRetryDelay)
 	delay, updated = db.Update(context.Background(), mockAPI)
 	if db.err == nil || updated {
 		t.Fatalf("update 7, unexpected update success")
 	}
-	minDelay = baseRetryDelay.Seconds() * float64(1) * float64(2)
-	maxDelay = baseRetryDelay.Seconds() * float64(2) * float64(2)
+	minDelay = baseRetryDelay.Seconds() * float64(1) * float64(8)
+	maxDelay = baseRetryDelay.Seconds() * float64(2) * float64(8)
 	if delay.Seconds() < minDelay || delay.Seconds() > maxDelay {
 		t.Fatalf("update 7, Expected delay %v to be between %v and %v", delay.Seconds(), minDelay, maxDelay)
 	}
 
 	// Update 8: api is still broken, check that backoff is larger than before
+	now = now.Add(maxRetryDelay)
 	delay, updated = db.Update(context.Background(), mockAPI)
 	if db.err == nil || updated {
 		t.Fatalf("update 8, unexpected update success")
 	}
-	minDelay = baseRetryDelay.Seconds() * float64(1) * float64(4)
-	maxDelay = baseRetryDelay.Seconds() * float64(2) * float64(4)
+	minDelay = baseRetryDelay.Seconds() * float64(1) * float64(16)
+	maxDelay = baseRetryDelay.Seconds() * float64(2) * float64(16)
 	if delay.Seconds() < minDelay || delay.Seconds() > maxDelay {
 		t.Fatalf("update 8, Expected delay %v to be between %v and %v", delay.Seconds(), minDelay, maxDelay)
 	}
 }
 
+func TestDatabaseUpdateConcurrency(t *testing.T) {
+	config := &Config{
+		ThreatLists: []ThreatType{
+			ThreatTypeMalware,
+			ThreatTypeSocialEngineering,
+			ThreatTypeUnwantedSoftware,
+			ThreatTypeSocialEngineeringExtended,
+		},
+		UpdatePeriod:      1800 * time.Second,
+		UpdateConcurrency: 2,
+		now:               time.Now,
+	}
+
+	var mu sync.Mutex
+	var inflight, maxInflight int
+	var got []pb.ThreatType
+	mockAPI := &mockAPI{
+		listUpdate: func(_ context.Context, tt pb.ThreatType, _ []byte, _ []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			mu.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			got = append(got, tt)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inflight--
+			mu.Unlock()
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte(tt.String()),
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+
+	db := &database{config: config, log: log.New(ioutil.Discard, "", 0)}
+	if _, updated := db.Update(context.Background(), mockAPI); !updated {
+		t.Fatalf("unexpected update failure: %v", db.err)
+	}
+	if len(got) != len(config.ThreatLists) {
+		t.Errorf("ListUpdate called %d times, want %d", len(got), len(config.ThreatLists))
+	}
+	if maxInflight != config.UpdateConcurrency {
+		t.Errorf("max concurrent updates = %d, want %d", maxInflight, config.UpdateConcurrency)
+	}
+	for _, td := range config.ThreatLists {
+		if state := string(db.tfu[td].State); state != pb.ThreatType(td).String() {
+			t.Errorf("mismatching state for %v: got %q, want %q", td, state, pb.ThreatType(td).String())
+		}
+	}
+}
+
+func TestDatabaseStats(t *testing.T) {
+	now := time.Now()
+	config := &Config{
+		ThreatLists:  []ThreatType{ThreatTypeMalware},
+		UpdatePeriod: 1800 * time.Second,
+		now:          func() time.Time { return now },
+	}
+	var resp *pb.ComputeThreatListDiffResponse
+	mockAPI := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return resp, nil
+		},
+	}
+	db := &database{config: config, log: log.New(ioutil.Discard, "", 0)}
+
+	vectors := []struct {
+		rtype   pb.ComputeThreatListDiffResponse_ResponseType
+		dels    []int32
+		adds    string
+		chksum  hashPrefixes
+		updated bool
+		want    ListStats
+	}{{
+		rtype:   pb.ComputeThreatListDiffResponse_RESET,
+		adds:    "aaaabbbbcccc",
+		chksum:  hashPrefixes{"aaaa", "bbbb", "cccc"},
+		updated: true,
+		want:    ListStats{HashPrefixes: 3, MemoryBytes: 15, LastAdditions: 3, Additions: 3},
+	}, {
+		rtype:   pb.ComputeThreatListDiffResponse_DIFF,
+		dels:    []int32{0, 2},
+		adds:    "dddd",
+		chksum:  hashPrefixes{"bbbb", "dddd"},
+		updated: true,
+		want:    ListStats{HashPrefixes: 2, MemoryBytes: 10, LastAdditions: 1, LastRemovals: 2, Additions: 4, Removals: 2},
+	}, {
+		rtype:   pb.ComputeThreatListDiffResponse_DIFF,
+		adds:    "eeee",
+		chksum:  hashPrefixes{"ffff"},
+		updated: false,
+		want:    ListStats{LastAdditions: 1, LastRemovals: 2, Additions: 4, Removals: 2, UpdateFailures: 1, ChecksumFailures: 1, Resets: 1},
+	}}
+	var synced time.Time
+	for i, v := range vectors {
+		resp = &pb.ComputeThreatListDiffResponse{
+			ResponseType:    v.rtype,
+			NewVersionToken: []byte{byte(i)},
+			Additions: &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{
+				PrefixSize: 4,
+				RawHashes:  []byte(v.adds),
+			}}},
+			Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: v.chksum.SHA256()},
+		}
+		if v.dels != nil {
+			resp.Removals = &pb.ThreatEntryRemovals{RawIndices: &pb.RawIndices{Indices: v.dels}}
+		}
+		now = now.Add(time.Hour)
+		if _, updated := db.Update(context.Background(), mockAPI); updated != v.updated {
+			t.Errorf("test %d, updated = %v, want %v", i, updated, v.updated)
+		}
+		if v.updated {
+			synced = now
+		}
+		v.want.LastSynced = synced
+		lists, _, d, _ := db.Stats()
+		if got := lists[ThreatTypeMalware]; got != v.want {
+			t.Errorf("test %d, stats mismatch:\ngot  %+v\nwant %+v", i, got, v.want)
+		}
+		if d <= 0 {
+			t.Errorf("test %d, update duration not recorded", i)
+		}
+	}
+}
+
+func TestDatabaseRecovery(t *testing.T) {
+	now := time.Now()
+	config := &Config{
+		ThreatLists:  []ThreatType{ThreatTypeMalware, ThreatTypeUnwantedSoftware},
+		UpdatePeriod: 1800 * time.Second,
+		now:          func() time.Time { return now },
+	}
+	var mu sync.Mutex
+	tokens := make(map[pb.ThreatType]string)
+	failure := make(map[pb.ThreatType]string)
+	mockAPI := &mockAPI{
+		listUpdate: func(_ context.Context, tt pb.ThreatType, token []byte, _ []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			tokens[tt] = string(token)
+			chksum := hashPrefixes{"aaaa"}.SHA256()
+			switch failure[tt] {
+			case "checksum":
+				chksum = hashPrefixes{"bbbb"}.SHA256()
+			case "api":
+				return nil, errors.New("Something broke")
+			}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte(tt.String()),
+				Additions: &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{
+					PrefixSize: 4,
+					RawHashes:  []byte("aaaa"),
+				}}},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: chksum},
+			}, nil
+		},
+	}
+	db := &database{config: config, log: log.New(ioutil.Discard, "", 0)}
+
+	// Update 0: the second list fails checksum validation, which does not
+	// prevent the first one from being updated.
+	failure[pb.ThreatType_UNWANTED_SOFTWARE] = "checksum"
+	delay, updated := db.Update(context.Background(), mockAPI)
+	if !updated || db.err != nil {
+		t.Fatalf("update 0, unexpected update failure: %v", db.err)
+	}
+	if delay < baseRetryDelay || delay > 2*baseRetryDelay {
+		t.Errorf("update 0, delay %v not within backoff range", delay)
+	}
+	if _, ok := db.tfu[ThreatTypeUnwantedSoftware]; ok {
+		t.Errorf("update 0, corrupt threat list was not reset")
+	}
+	if _, ok := db.tfu[ThreatTypeMalware]; !ok {
+		t.Errorf("update 0, healthy threat list was not updated")
+	}
+	if lists, _, _, _ := db.Stats(); lists[ThreatTypeUnwantedSoftware].Resets != 1 {
+		t.Errorf("update 0, reset not recorded: %+v", lists[ThreatTypeUnwantedSoftware])
+	}
+
+	// Update 1: once its backoff elapsed, only the corrupt list is downloaded
+	// again in full. The backoff of a first failure is random, up to twice
+	// baseRetryDelay.
+	failure[pb.ThreatType_UNWANTED_SOFTWARE] = ""
+	tokens = make(map[pb.ThreatType]string)
+	now = now.Add(2*baseRetryDelay + time.Minute)
+	if _, updated := db.Update(context.Background(), mockAPI); !updated {
+		t.Fatalf("update 1, unexpected update failure: %v", db.err)
+	}
+	if token, ok := tokens[pb.ThreatType_UNWANTED_SOFTWARE]; !ok || token != "" {
+		t.Errorf("update 1, reset list requested with token %q, %v", token, ok)
+	}
+	if token, ok := tokens[pb.ThreatType_MALWARE]; ok && token != "MALWARE" {
+		t.Errorf("update 1, healthy list requested with token %q", token)
+	}
+
+	// Update 2: the API fails for the first list, which keeps its contents
+	// for lookups while the second one is updated.
+	failure[pb.ThreatType_MALWARE] = "api"
+	now = now.Add(time.Hour)
+	if _, updated := db.Update(context.Background(), mockAPI); !updated || db.err != nil {
+		t.Fatalf("update 2, unexpected update failure: %v", db.err)
+	}
+	if _, tds := db.Lookup(hashPrefix("aaaa") + hashPrefix(make([]byte, 28))); len(tds) != 2 {
+		t.Errorf("update 2, lookup matched %v, want both lists", tds)
+	}
+
+	// Update 3: once every list is failing, the database is faulted.
+	failure[pb.ThreatType_UNWANTED_SOFTWARE] = "api"
+	now = now.Add(time.Hour)
+	if _, updated := db.Update(context.Background(), mockAPI); updated || db.err == nil {
+		t.Fatalf("update 3, unexpected update success")
+	}
+}
+
 func TestDatabaseLookup(t *testing.T) {
 	threatsEqual := func(a, b []ThreatType) bool {
 		ma := make(map[ThreatType]struct{})
@@ -627,6 +871,89 @@ func TestDatabasePersistence(t *testing.T) {
 	}
 }
 
+func TestDatabaseMigration(t *testing.T) {
+	path := mustGetTempFile(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".lock")
+
+	// Write a database file in the format used before files were versioned.
+	dbf1 := databaseFormat{
+		Table: threatsForUpdate{
+			3: partialHashes{
+				Hashes: []hashPrefix{"aaaa", "bbbb", "cccc", "dddd"},
+				State:  []byte("meow meow meow!!!"),
+				SHA256: mustDecodeHex(t, "147eb9dcde0e090429c01dbf634fd9b69a7f141f005c387a9c00498908499dde"),
+			},
+		},
+		Time: time.Unix(123456789, 0),
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz := gzip.NewWriter(file)
+	if err := gob.NewEncoder(gz).Encode(dbf1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz.Close()
+	file.Close()
+
+	dbf2, version, err := loadDatabaseVersion(path)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if version != dbVersionGob {
+		t.Errorf("loadDatabaseVersion() version = %d, want %d", version, dbVersionGob)
+	}
+	if !reflect.DeepEqual(dbf1, dbf2) {
+		t.Errorf("mismatching database contents:\ngot  %v\nwant %v", dbf2, dbf1)
+	}
+
+	// Loading the file into a database migrates it to the current format.
+	config := &Config{
+		DBPath:      path,
+		ThreatLists: []ThreatType{3},
+		now:         func() time.Time { return time.Unix(123456789, 0) },
+	}
+	db := new(database)
+	if !db.Init(config, log.New(ioutil.Discard, "", 0)) {
+		t.Fatalf("unexpected init failure: %v", db.err)
+	}
+	dbf3, version, err := loadDatabaseVersion(path)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if version != dbVersion {
+		t.Errorf("loadDatabaseVersion() version = %d, want %d", version, dbVersion)
+	}
+	if !reflect.DeepEqual(dbf1.Table[3].SHA256, dbf3.Table[3].SHA256) {
+		t.Errorf("mismatching database contents:\ngot  %v\nwant %v", dbf3, dbf1)
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(buf[:len(dbMagic)]) != dbMagic {
+		t.Errorf("file header = %q, want %q", buf[:len(dbMagic)], dbMagic)
+	}
+	buf[len(dbMagic)] = 0x7f
+	if err := ioutil.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := loadDatabase(path); err == nil {
+		t.Errorf("unexpected load success of unknown version")
+	}
+
+	// Only the versioned header or the legacy gzip format are accepted.
+	if err := ioutil.WriteFile(path, append([]byte{dbVersionRice}, buf[len(dbMagic)+1:]...), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := loadDatabase(path); err == nil {
+		t.Errorf("unexpected load success of file without header")
+	}
+}
+
 // Disabled test, fails remotely, passes locally.
 func TestDatabaseSaveErrors(t *testing.T) {
 	t.Skip()
@@ -650,6 +977,29 @@ func TestDatabaseSaveErrors(t *testing.T) {
 	}
 }
 
+func TestDatabaseSaveMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	dir, err := ioutil.TempDir("", "webrisk")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "db")
+	if err := saveDatabase(path, databaseFormat{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0644); got != want {
+		t.Errorf("mismatching mode: got %v, want %v", got, want)
+	}
+}
+
 func TestDatabaseLoadErrors(t *testing.T) {
 	path := mustGetTempFile(t)
 	defer os.Remove(path)
@@ -750,3 +1100,171 @@ func TestIsStale(t *testing.T) {
 		}
 	}
 }
+
+func TestDatabaseReload(t *testing.T) {
+	path := mustGetTempFile(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".lock")
+
+	now := time.Unix(1451436338, 951473000)
+	logger := log.New(ioutil.Discard, "", 0)
+	config := &Config{
+		DBPath:       path,
+		ThreatLists:  []ThreatType{ThreatTypeMalware},
+		UpdatePeriod: DefaultUpdatePeriod,
+		ReadOnlyDB:   true,
+		now:          func() time.Time { return now },
+	}
+	writer := &database{config: config, log: logger}
+	reader := new(database)
+
+	// The reader cannot load anything before the writer saved once.
+	if reader.Init(config, logger) {
+		t.Fatalf("unexpected init success on empty database file")
+	}
+
+	tables := []threatsForUpdate{{
+		ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb"),
+	}, {
+		ThreatTypeMalware: newPartialHashes("s2", "bbbb", "cccc", "dddd"),
+	}}
+	for i, table := range tables {
+		if err := writer.save(databaseFormat{table, now}); err != nil {
+			t.Fatalf("test %d, unexpected save error: %v", i, err)
+		}
+		if writer.generation != uint64(i+1) {
+			t.Errorf("test %d, writer generation: got %d, want %d", i, writer.generation, i+1)
+		}
+		if !reader.Reload() {
+			t.Fatalf("test %d, new generation was not reloaded", i)
+		}
+		if reader.Reload() {
+			t.Errorf("test %d, unexpected reload of the same generation", i)
+		}
+		if err := reader.Status(); err != nil {
+			t.Errorf("test %d, unexpected status error: %v", i, err)
+		}
+		want := newHashSet(table[ThreatTypeMalware].Hashes)
+		if got := reader.tfl[ThreatTypeMalware]; !reflect.DeepEqual(got, want) {
+			t.Errorf("test %d, threats for lookup mismatch:\ngot  %+v\nwant %+v", i, got, want)
+		}
+	}
+
+	// A reader does not load the file it was initialized from again.
+	reader = new(database)
+	if !reader.Init(config, logger) {
+		t.Fatalf("unexpected init failure")
+	}
+	if reader.Reload() {
+		t.Errorf("unexpected reload of the file loaded by Init")
+	}
+}
+
+func TestDatabaseReloadModified(t *testing.T) {
+	path := mustGetTempFile(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".lock")
+
+	now := time.Unix(1451436338, 951473000)
+	logger := log.New(ioutil.Discard, "", 0)
+	config := &Config{
+		DBPath:       path,
+		ThreatLists:  []ThreatType{ThreatTypeMalware},
+		UpdatePeriod: DefaultUpdatePeriod,
+		ReadOnlyDB:   true,
+		now:          func() time.Time { return now },
+	}
+	reader := &database{config: config, log: logger}
+
+	// Files replaced without a new generation, as by a copy from another
+	// host, are reloaded once their modification time changed.
+	tables := []threatsForUpdate{{
+		ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb"),
+	}, {
+		ThreatTypeMalware: newPartialHashes("s2", "bbbb", "cccc", "dddd"),
+	}}
+	for i, table := range tables {
+		if err := saveDatabase(path, databaseFormat{table, now}); err != nil {
+			t.Fatalf("test %d, unexpected save error: %v", i, err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if !reader.Reload() {
+			t.Fatalf("test %d, modified file was not reloaded", i)
+		}
+		if reader.Reload() {
+			t.Errorf("test %d, unexpected reload of an unmodified file", i)
+		}
+	}
+
+	// A file that cannot be read does not replace the database loaded last.
+	if err := ioutil.WriteFile(path, []byte("partial"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mtime := now.Add(time.Hour)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reader.Reload() {
+		t.Errorf("unexpected reload of a corrupted file")
+	}
+	if err := reader.Status(); err != nil {
+		t.Errorf("unexpected status error: %v", err)
+	}
+	want := newHashSet(tables[1][ThreatTypeMalware].Hashes)
+	if got := reader.tfl[ThreatTypeMalware]; !reflect.DeepEqual(got, want) {
+		t.Errorf("threats for lookup mismatch:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDatabaseSnapshot(t *testing.T) {
+	path := mustGetTempFile(t)
+	defer os.Remove(path)
+	defer os.Remove(path + ".lock")
+
+	now := time.Unix(1451436338, 0)
+	logger := log.New(ioutil.Discard, "", 0)
+	config := &Config{
+		DBPath:       path,
+		ThreatLists:  []ThreatType{ThreatTypeMalware, ThreatTypeUnwantedSoftware},
+		UpdatePeriod: DefaultUpdatePeriod,
+		ReadOnlyDB:   true,
+		now:          func() time.Time { return now },
+	}
+	db := new(database)
+	if _, ok := db.snapshot(); ok {
+		t.Errorf("unexpected snapshot of a database never synced")
+	}
+
+	want := databaseFormat{threatsForUpdate{
+		ThreatTypeMalware:          newPartialHashes("s1", "aaaa", "bbbbbb", "cccc"),
+		ThreatTypeUnwantedSoftware: newPartialHashes("s2", "dddd"),
+	}, now}
+	if err := saveDatabase(path, want); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+	if !db.Init(config, logger) {
+		t.Fatalf("unexpected init failure: %v", db.Status())
+	}
+	dbf, ok := db.snapshot()
+	if !ok {
+		t.Fatalf("no snapshot of a synced database")
+	}
+	var buf bytes.Buffer
+	if err := writeDatabase(&buf, dbf); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+	r := bufio.NewReader(&buf)
+	if version, err := readDatabaseHeader(r); err != nil || version != dbVersion {
+		t.Fatalf("snapshot header = %d, %v, want version %d", version, err, dbVersion)
+	}
+	got, err := loadRiceDatabase(r)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mismatching snapshot:\ngot  %v\nwant %v", got, want)
+	}
+}
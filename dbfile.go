@@ -0,0 +1,142 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// DatabaseFile is a database file persisted by UpdateClient at Config.DBPath,
+// read for inspection and maintenance, such as by the wradmin command.
+type DatabaseFile struct {
+	Version int       // Version of the format the file was written in
+	Time    time.Time // Time of the last update of the database
+	Size    int64     // Size of the file, in bytes
+
+	table threatsForUpdate
+}
+
+// DatabaseListInfo describes a threat list of a DatabaseFile.
+type DatabaseListInfo struct {
+	ThreatType   ThreatType
+	HashPrefixes int
+	Lengths      map[int]int // Number of hash prefixes by length, in bytes
+
+	// VersionToken is the opaque state of the list given by the Web Risk API
+	// with its last update, and SHA256 the checksum of the hash prefixes of
+	// the list given along.
+	VersionToken []byte
+	SHA256       []byte
+}
+
+// ReadDatabaseFile reads the database file at path. Unlike UpdateClient, it
+// does not verify the checksums of the threat lists, so that a corrupted file
+// can be inspected: use Verify for that.
+func ReadDatabaseFile(path string) (*DatabaseFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	dbf, version, err := decodeDatabase(f)
+	if err != nil {
+		return nil, err
+	}
+	return &DatabaseFile{Version: version, Time: dbf.Time, Size: fi.Size(), table: dbf.Table}, nil
+}
+
+// Lists describes the threat lists of the file, ordered by threat type.
+func (f *DatabaseFile) Lists() []DatabaseListInfo {
+	var lists []DatabaseListInfo
+	for td, phs := range f.table {
+		li := DatabaseListInfo{
+			ThreatType:   td,
+			HashPrefixes: len(phs.Hashes),
+			Lengths:      make(map[int]int),
+			VersionToken: phs.State,
+			SHA256:       phs.SHA256,
+		}
+		for _, h := range phs.Hashes {
+			li.Lengths[len(h)]++
+		}
+		lists = append(lists, li)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ThreatType < lists[j].ThreatType })
+	return lists
+}
+
+// Verify checks that the hash prefixes of the threat list td are valid, sorted
+// and unique, and match the checksum of the list.
+func (f *DatabaseFile) Verify(td ThreatType) error {
+	phs, ok := f.table[td]
+	if !ok {
+		return errors.New("webrisk: threat list not in database: " + td.String())
+	}
+	sum, err := phs.Hashes.checksum()
+	if err != nil {
+		return fmt.Errorf("webrisk: threat list %v: %v", td, err)
+	}
+	if !bytes.Equal(sum, phs.SHA256) {
+		return fmt.Errorf("webrisk: threat list %v: %v", td, errChecksum)
+	}
+	return nil
+}
+
+// HashPrefixes returns an iterator over the hash prefixes of the threat list
+// td, in sorted order.
+func (f *DatabaseFile) HashPrefixes(td ThreatType) (*HashPrefixIterator, error) {
+	phs, ok := f.table[td]
+	if !ok {
+		return nil, errors.New("webrisk: threat list not in database: " + td.String())
+	}
+	hashes := append(hashPrefixes(nil), phs.Hashes...)
+	hashes.Sort()
+	return &HashPrefixIterator{phs: hashes}, nil
+}
+
+// Save writes the database to path in the current format, which compacts
+// files written in older formats, with every threat list verified first.
+// As UpdateClient does, the file is saved as the next generation of the
+// database file, under its lock, so that clients sharing it reload it.
+func (f *DatabaseFile) Save(path string) error {
+	for td := range f.table {
+		if err := f.Verify(td); err != nil {
+			return err
+		}
+	}
+	lock, err := lockDatabase(path, true)
+	if err != nil {
+		return err
+	}
+	defer unlockDatabase(lock)
+
+	gen, err := readGeneration(lock)
+	if err != nil {
+		return err
+	}
+	if err := saveDatabase(path, databaseFormat{f.table, f.Time}); err != nil {
+		return err
+	}
+	return writeGeneration(lock, gen+1)
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDatabaseFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "webrisk.db")
+
+	// A file in the format used before files were versioned.
+	malware := newPartialHashes("s1", "aaaa", "bbbb", "cccccc")
+	corrupted := newPartialHashes("s2", "dddd")
+	corrupted.SHA256 = []byte("bogus")
+	dbf := databaseFormat{threatsForUpdate{
+		ThreatTypeMalware:           malware,
+		ThreatTypeSocialEngineering: corrupted,
+	}, time.Unix(1000, 0)}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz := gzip.NewWriter(file)
+	if err := gob.NewEncoder(gz).Encode(dbf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gz.Close()
+	file.Close()
+
+	f, err := ReadDatabaseFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Version != dbVersionGob || !f.Time.Equal(dbf.Time) || f.Size == 0 {
+		t.Errorf("ReadDatabaseFile() = version %d, time %v, size %d", f.Version, f.Time, f.Size)
+	}
+	want := []DatabaseListInfo{{
+		ThreatType:   ThreatTypeMalware,
+		HashPrefixes: 3,
+		Lengths:      map[int]int{4: 2, 6: 1},
+		VersionToken: []byte("s1"),
+		SHA256:       malware.SHA256,
+	}, {
+		ThreatType:   ThreatTypeSocialEngineering,
+		HashPrefixes: 1,
+		Lengths:      map[int]int{4: 1},
+		VersionToken: []byte("s2"),
+		SHA256:       []byte("bogus"),
+	}}
+	if got := f.Lists(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lists() = %+v, want %+v", got, want)
+	}
+
+	if err := f.Verify(ThreatTypeMalware); err != nil {
+		t.Errorf("Verify(MALWARE) = %v, want nil", err)
+	}
+	if err := f.Verify(ThreatTypeSocialEngineering); err == nil {
+		t.Errorf("Verify(SOCIAL_ENGINEERING) = nil, want checksum error")
+	}
+	if err := f.Verify(ThreatTypeUnwantedSoftware); err == nil {
+		t.Errorf("Verify(UNWANTED_SOFTWARE) = nil, want error")
+	}
+
+	it, err := f.HashPrefixes(ThreatTypeMalware)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var prefixes []string
+	for it.Next() {
+		prefixes = append(prefixes, string(it.Prefix()))
+	}
+	if want := []string{"aaaa", "bbbb", "cccccc"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("HashPrefixes() = %q, want %q", prefixes, want)
+	}
+
+	// Corrupted files are not saved.
+	if err := f.Save(path); err == nil {
+		t.Errorf("Save() succeeded with a corrupted list")
+	}
+	delete(f.table, ThreatTypeSocialEngineering)
+	compacted := filepath.Join(dir, "compacted.db")
+	if err := f.Save(compacted); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, version, err := loadDatabaseVersion(compacted)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != dbVersion || !reflect.DeepEqual(got.Table, threatsForUpdate{ThreatTypeMalware: malware}) {
+		t.Errorf("saved database = version %d, %+v", version, got)
+	}
+	lock, err := os.Open(compacted + ".lock")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer lock.Close()
+	if gen, err := readGeneration(lock); err != nil || gen != 1 {
+		t.Errorf("readGeneration() = %d, %v, want 1", gen, err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// deltaFormat is a light struct used only for gob encoding and decoding of
+// the delta between two database files. Each threat list is stored as a
+// serialized ComputeThreatListDiffResponse so that applying a delta goes
+// through exactly the same logic as an update received from the API.
+//
+// The set of threat lists in Diffs is the set of threat lists in the newer
+// database. Lists that only exist in the older database are dropped when the
+// delta is applied.
+type deltaFormat struct {
+	Diffs map[ThreatType][]byte
+	Time  time.Time
+}
+
+// ExportDatabaseDelta computes the prefix-level delta between the database
+// files at oldPath and newPath and writes it to w. Applying the delta with
+// ApplyDatabaseDelta to a copy of the older database yields the newer one.
+//
+// This allows replicating a database across network boundaries while only
+// transferring the changes between two snapshots.
+func ExportDatabaseDelta(w io.Writer, oldPath, newPath string) error {
+	oldDB, err := loadDatabase(oldPath)
+	if err != nil {
+		return err
+	}
+	newDB, err := loadDatabase(newPath)
+	if err != nil {
+		return err
+	}
+
+	df := deltaFormat{Diffs: make(map[ThreatType][]byte), Time: newDB.Time}
+	for td, newPHS := range newDB.Table {
+		oldPHS, ok := oldDB.Table[td]
+		resp := diffPartialHashes(oldPHS, newPHS, ok)
+		b, err := proto.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		df.Diffs[td] = b
+	}
+	return writeDelta(w, df)
+}
+
+// ApplyDatabaseDelta reads a delta produced by ExportDatabaseDelta from r and
+// applies it to the database file at path. The file is only overwritten if
+// every threat list in the delta applied cleanly and matched its checksum.
+func ApplyDatabaseDelta(path string, r io.Reader) error {
+	dbf, err := loadDatabase(path)
+	if err != nil {
+		return err
+	}
+	df, err := readDelta(r)
+	if err != nil {
+		return err
+	}
+
+	tfu := make(threatsForUpdate)
+	for td, b := range df.Diffs {
+		resp := new(pb.ComputeThreatListDiffResponse)
+		if err := proto.Unmarshal(b, resp); err != nil {
+			return err
+		}
+		if phs, ok := dbf.Table[td]; ok {
+			tfu[td] = phs
+		}
+		if _, _, err := tfu.update(resp, td); err != nil {
+			return err
+		}
+	}
+	return saveDatabase(path, databaseFormat{tfu, df.Time})
+}
+
+// diffPartialHashes returns the response that transforms oldPHS into newPHS.
+// If the older list does not exist, then a full reset is returned.
+func diffPartialHashes(oldPHS, newPHS partialHashes, exists bool) *pb.ComputeThreatListDiffResponse {
+	resp := &pb.ComputeThreatListDiffResponse{
+		ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+		NewVersionToken: newPHS.State,
+		Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: newPHS.SHA256},
+	}
+	oldHashes := append(hashPrefixes(nil), oldPHS.Hashes...)
+	newHashes := append(hashPrefixes(nil), newPHS.Hashes...)
+	oldHashes.Sort()
+	newHashes.Sort()
+
+	var removals []int32
+	var additions hashPrefixes
+	if exists {
+		resp.ResponseType = pb.ComputeThreatListDiffResponse_DIFF
+		i, j := 0, 0
+		for i < len(oldHashes) || j < len(newHashes) {
+			switch {
+			case j == len(newHashes) || (i < len(oldHashes) && oldHashes[i] < newHashes[j]):
+				removals = append(removals, int32(i))
+				i++
+			case i == len(oldHashes) || newHashes[j] < oldHashes[i]:
+				additions = append(additions, newHashes[j])
+				j++
+			default:
+				i++
+				j++
+			}
+		}
+	} else {
+		additions = newHashes
+	}
+
+	if len(removals) > 0 {
+		resp.Removals = &pb.ThreatEntryRemovals{
+			RawIndices: &pb.RawIndices{Indices: removals},
+		}
+	}
+	if len(additions) > 0 {
+		resp.Additions = &pb.ThreatEntryAdditions{RawHashes: encodeRawHashes(additions)}
+	}
+	return resp
+}
+
+// encodeRawHashes groups the sorted hashes by their prefix size.
+func encodeRawHashes(hashes hashPrefixes) []*pb.RawHashes {
+	bySize := make(map[int][]string)
+	for _, h := range hashes {
+		bySize[len(h)] = append(bySize[len(h)], string(h))
+	}
+	var sizes []int
+	for n := range bySize {
+		sizes = append(sizes, n)
+	}
+	sort.Ints(sizes)
+
+	var raws []*pb.RawHashes
+	for _, n := range sizes {
+		raws = append(raws, &pb.RawHashes{
+			PrefixSize: int32(n),
+			RawHashes:  []byte(strings.Join(bySize[n], "")),
+		})
+	}
+	return raws
+}
+
+// writeDelta writes the gzip compressed gob encoding of df to w.
+func writeDelta(w io.Writer, df deltaFormat) (err error) {
+	gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if zerr := gz.Close(); err == nil {
+			err = zerr
+		}
+	}()
+	return gob.NewEncoder(gz).Encode(df)
+}
+
+// readDelta reads a delta written by writeDelta from r.
+func readDelta(r io.Reader) (df deltaFormat, err error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return df, err
+	}
+	defer func() {
+		if zerr := gz.Close(); err == nil {
+			err = zerr
+		}
+	}()
+	err = gob.NewDecoder(gz).Decode(&df)
+	return df, err
+}
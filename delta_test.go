@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newPartialHashes(state string, hashes ...hashPrefix) partialHashes {
+	phs := partialHashes{Hashes: hashes, State: []byte(state)}
+	phs.Hashes.Sort()
+	phs.SHA256 = phs.Hashes.SHA256()
+	return phs
+}
+
+func TestDatabaseDelta(t *testing.T) {
+	oldPath := mustGetTempFile(t)
+	defer os.Remove(oldPath)
+	newPath := mustGetTempFile(t)
+	defer os.Remove(newPath)
+
+	vectors := []struct {
+		oldDB databaseFormat
+		newDB databaseFormat
+	}{{
+		// No changes at all.
+		oldDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb"),
+		}, time.Unix(1000, 0)},
+		newDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb"),
+		}, time.Unix(2000, 0)},
+	}, {
+		// Additions and removals of various prefix lengths.
+		oldDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb", "cccccc", "dddd"),
+		}, time.Unix(1000, 0)},
+		newDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware: newPartialHashes("s2", "0000", "bbbb", "dddd", "eeeeeeee"),
+		}, time.Unix(2000, 0)},
+	}, {
+		// Lists are added and dropped.
+		oldDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware:           newPartialHashes("s1", "aaaa"),
+			ThreatTypeSocialEngineering: newPartialHashes("s2", "bbbb"),
+		}, time.Unix(1000, 0)},
+		newDB: databaseFormat{threatsForUpdate{
+			ThreatTypeMalware:          newPartialHashes("s3", "cccc"),
+			ThreatTypeUnwantedSoftware: newPartialHashes("s4", "dddd", "eeee"),
+		}, time.Unix(2000, 0)},
+	}}
+
+	for i, v := range vectors {
+		if err := saveDatabase(oldPath, v.oldDB); err != nil {
+			t.Fatalf("test %d, unexpected save error: %v", i, err)
+		}
+		if err := saveDatabase(newPath, v.newDB); err != nil {
+			t.Fatalf("test %d, unexpected save error: %v", i, err)
+		}
+
+		var buf bytes.Buffer
+		if err := ExportDatabaseDelta(&buf, oldPath, newPath); err != nil {
+			t.Errorf("test %d, unexpected export error: %v", i, err)
+			continue
+		}
+		if err := ApplyDatabaseDelta(oldPath, &buf); err != nil {
+			t.Errorf("test %d, unexpected apply error: %v", i, err)
+			continue
+		}
+
+		got, err := loadDatabase(oldPath)
+		if err != nil {
+			t.Errorf("test %d, unexpected load error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v.newDB) {
+			t.Errorf("test %d, mismatching database contents:\ngot  %v\nwant %v", i, got, v.newDB)
+		}
+	}
+}
+
+func TestDatabaseDeltaMismatch(t *testing.T) {
+	oldPath := mustGetTempFile(t)
+	defer os.Remove(oldPath)
+	newPath := mustGetTempFile(t)
+	defer os.Remove(newPath)
+	otherPath := mustGetTempFile(t)
+	defer os.Remove(otherPath)
+
+	oldDB := databaseFormat{threatsForUpdate{
+		ThreatTypeMalware: newPartialHashes("s1", "aaaa", "bbbb"),
+	}, time.Unix(1000, 0)}
+	newDB := databaseFormat{threatsForUpdate{
+		ThreatTypeMalware: newPartialHashes("s2", "bbbb", "cccc"),
+	}, time.Unix(2000, 0)}
+	otherDB := databaseFormat{threatsForUpdate{
+		ThreatTypeMalware: newPartialHashes("s3", "0000", "1111", "2222"),
+	}, time.Unix(1500, 0)}
+	for path, dbf := range map[string]databaseFormat{oldPath: oldDB, newPath: newDB, otherPath: otherDB} {
+		if err := saveDatabase(path, dbf); err != nil {
+			t.Fatalf("unexpected save error: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ExportDatabaseDelta(&buf, oldPath, newPath); err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+	// Applying the delta to a database it was not computed against must fail
+	// and leave the database untouched.
+	if err := ApplyDatabaseDelta(otherPath, &buf); err == nil {
+		t.Errorf("unexpected apply success")
+	}
+	got, err := loadDatabase(otherPath)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if !reflect.DeepEqual(got, otherDB) {
+		t.Errorf("mismatching database contents:\ngot  %v\nwant %v", got, otherDB)
+	}
+}
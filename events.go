@@ -0,0 +1,254 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventDetection is emitted for every URL found unsafe by a lookup.
+	EventDetection EventType = "detection"
+	// EventUpdate is emitted whenever the database was updated, or reloaded
+	// with Config.ReadOnlyDB set.
+	EventUpdate EventType = "update"
+	// EventError is emitted whenever an update of the database failed.
+	EventError EventType = "error"
+	// EventAlert is emitted whenever an UpdateAlert is raised or resolved,
+	// as passed to Config.OnUpdateAlert.
+	EventAlert EventType = "alert"
+)
+
+// Event is an event emitted by UpdateClient to Config.EventSink.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// URL is the URL found unsafe by a detection. Sinks configured to hash
+	// URLs replace it by URLHash, the hex encoded SHA-256 of the URL.
+	URL         string   `json:"url,omitempty"`
+	URLHash     string   `json:"urlHash,omitempty"`
+	ThreatTypes []string `json:"threatTypes,omitempty"`
+
+	// Labels are the labels of the context of the lookup of a detection, set
+	// with WithEventLabels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// HashPrefixes is the number of hash prefixes in the database after an
+	// update.
+	HashPrefixes int `json:"hashPrefixes,omitempty"`
+
+	// Error is the error of a failed update, or the description of an
+	// alert.
+	Error string `json:"error,omitempty"`
+
+	// Resolved reports that an alert was resolved.
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// hashURL returns a copy of e identifying its URL by URLHash only.
+func (e Event) hashURL() Event {
+	if e.URL != "" {
+		sum := sha256.Sum256([]byte(e.URL))
+		e.URL, e.URLHash = "", hex.EncodeToString(sum[:])
+	}
+	return e
+}
+
+// EventSink receives the events of UpdateClient, such as to notify another
+// system of the URLs found unsafe.
+//
+// Emit is called synchronously by lookups and updates, so implementations
+// must be safe for concurrent use and should queue events rather than block
+// on slow destinations.
+type EventSink interface {
+	Emit(e Event)
+}
+
+// SinkStats reports the delivery of events by a sink.
+type SinkStats struct {
+	Sent    int64 // Events delivered
+	Failed  int64 // Events not delivered, after every retry if any
+	Dropped int64 // Events dropped because the queue was full
+}
+
+// sinkStats is the atomically updated counterpart of SinkStats.
+type sinkStats struct {
+	sent    int64
+	failed  int64
+	dropped int64
+}
+
+func (s *sinkStats) snapshot() SinkStats {
+	return SinkStats{
+		Sent:    atomic.LoadInt64(&s.sent),
+		Failed:  atomic.LoadInt64(&s.failed),
+		Dropped: atomic.LoadInt64(&s.dropped),
+	}
+}
+
+// eventLabelsKey is the context key for the labels of detection events.
+type eventLabelsKey struct{}
+
+// WithEventLabels returns a copy of ctx whose labels are attached to the
+// detection events of the lookups made with it, such as to identify the
+// client or the endpoint the lookup was made for. The labels are added to
+// those already in ctx, if any.
+func WithEventLabels(ctx context.Context, labels map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range eventLabels(ctx) {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, eventLabelsKey{}, merged)
+}
+
+// eventLabels returns the labels set in ctx by WithEventLabels.
+func eventLabels(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(eventLabelsKey{}).(map[string]string)
+	return labels
+}
+
+// MultiSink returns a sink emitting every event to each of sinks.
+func MultiSink(sinks ...EventSink) EventSink {
+	return multiSink(append([]EventSink(nil), sinks...))
+}
+
+type multiSink []EventSink
+
+func (m multiSink) Emit(e Event) {
+	for _, s := range m {
+		s.Emit(e)
+	}
+}
+
+// FilterEvents returns a sink emitting the events of the given types to sink,
+// and ignoring the others.
+func FilterEvents(sink EventSink, types ...EventType) EventSink {
+	f := &filterSink{sink: sink, types: make(map[EventType]bool)}
+	for _, t := range types {
+		f.types[t] = true
+	}
+	return f
+}
+
+type filterSink struct {
+	sink  EventSink
+	types map[EventType]bool
+}
+
+func (f *filterSink) Emit(e Event) {
+	if f.types[e.Type] {
+		f.sink.Emit(e)
+	}
+}
+
+// FileSink writes events to an io.Writer, such as a file, as JSON objects
+// separated by newlines.
+type FileSink struct {
+	hashURLs bool
+	stats    sinkStats
+
+	mu sync.Mutex // Serializes writes to w
+	w  io.Writer
+}
+
+// NewFileSink returns a sink writing events to w. If hashURLs is set, the
+// URLs of the events are replaced by their hash.
+func NewFileSink(w io.Writer, hashURLs bool) *FileSink {
+	return &FileSink{w: w, hashURLs: hashURLs}
+}
+
+// Emit writes e.
+func (s *FileSink) Emit(e Event) {
+	if s.hashURLs {
+		e = e.hashURL()
+	}
+	b, err := json.Marshal(e)
+	if err == nil {
+		s.mu.Lock()
+		_, err = s.w.Write(append(b, '\n'))
+		s.mu.Unlock()
+	}
+	if err != nil {
+		atomic.AddInt64(&s.stats.failed, 1)
+		return
+	}
+	atomic.AddInt64(&s.stats.sent, 1)
+}
+
+// Stats returns the current delivery statistics.
+func (s *FileSink) Stats() SinkStats {
+	return s.stats.snapshot()
+}
+
+// emitDetections emits a detection event for every URL of urls found unsafe
+// according to results, labelled with the labels of ctx.
+func (wr *UpdateClient) emitDetections(ctx context.Context, urls []string, results []URLResult) {
+	if wr.config.EventSink == nil {
+		return
+	}
+	labels := eventLabels(ctx)
+	for i, r := range results {
+		if len(r.Threats) == 0 || i >= len(urls) {
+			continue
+		}
+		var names []string
+		seen := make(map[ThreatType]bool)
+		for _, t := range r.Threats {
+			if !seen[t.ThreatType] {
+				seen[t.ThreatType] = true
+				names = append(names, t.ThreatType.String())
+			}
+		}
+		wr.config.EventSink.Emit(Event{
+			Type:        EventDetection,
+			Time:        wr.config.now().UTC(),
+			URL:         urls[i],
+			ThreatTypes: names,
+			Labels:      labels,
+		})
+	}
+}
+
+// emitUpdate emits the event of an update of the database, which failed with
+// err if not nil.
+func (wr *UpdateClient) emitUpdate(err error) {
+	if wr.config.EventSink == nil {
+		return
+	}
+	e := Event{Type: EventUpdate, Time: wr.config.now().UTC()}
+	if err != nil {
+		e.Type, e.Error = EventError, err.Error()
+	} else {
+		lists, _, _, _ := wr.db.Stats()
+		for _, ls := range lists {
+			e.HashPrefixes += ls.HashPrefixes
+		}
+	}
+	wr.config.EventSink.Emit(e)
+}
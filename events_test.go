@@ -0,0 +1,180 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// recordSink is an EventSink recording the events emitted.
+type recordSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *recordSink) Emit(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+}
+
+// take returns the events recorded since the last call.
+func (s *recordSink) take() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestClientEvents(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	var mu sync.Mutex
+	var fail bool
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return nil, errors.New("unavailable")
+			}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(fullHash[:4])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: hashPrefixes{fullHash[:4]}.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			return &pb.SearchHashesResponse{Threats: []*pb.SearchHashesResponse_ThreatHash{{
+				ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+				Hash:        []byte(fullHash),
+				ExpireTime:  timepb.New(now.Add(time.Hour)),
+			}}}, nil
+		},
+	}
+	sink := new(recordSink)
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		EventSink:   sink,
+		api:         api,
+		now:         func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Event{{Type: EventUpdate, Time: now.UTC(), HashPrefixes: 1}}
+	if got := sink.take(); !cmp.Equal(got, want) {
+		t.Errorf("events after the first update = %+v, want %+v", got, want)
+	}
+
+	ctx := WithEventLabels(context.Background(), map[string]string{"client": "192.0.2.1"})
+	ctx = WithEventLabels(ctx, map[string]string{"endpoint": "/v1/uris:search"})
+	if _, err := wr.LookupURLResults(ctx, []string{"http://example.com/", "http://bad.example.com/"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []Event{{
+		Type:        EventDetection,
+		Time:        now.UTC(),
+		URL:         "http://bad.example.com/",
+		ThreatTypes: []string{"MALWARE"},
+		Labels:      map[string]string{"client": "192.0.2.1", "endpoint": "/v1/uris:search"},
+	}}
+	if got := sink.take(); !cmp.Equal(got, want) {
+		t.Errorf("events after lookup = %+v, want %+v", got, want)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if err := wr.UpdateNow(context.Background()); err == nil {
+		t.Fatal("unexpected success of a failing update")
+	}
+	got := sink.take()
+	if len(got) != 1 || got[0].Type != EventError || got[0].Error == "" {
+		t.Errorf("events after failed update = %+v, want an error event", got)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	e := Event{
+		Type:        EventDetection,
+		Time:        time.Unix(1700000000, 0).UTC(),
+		URL:         "http://bad.example.com/",
+		ThreatTypes: []string{"MALWARE"},
+	}
+	vectors := []struct {
+		hashURLs bool
+		want     string
+	}{{
+		hashURLs: false,
+		want:     `{"type":"detection","time":"2023-11-14T22:13:20Z","url":"http://bad.example.com/","threatTypes":["MALWARE"]}`,
+	}, {
+		hashURLs: true,
+		want:     `{"type":"detection","time":"2023-11-14T22:13:20Z","urlHash":"baaf468e1d11d72c83fd6989c9a09cd119ef61f05486201eb0f459939c34771c","threatTypes":["MALWARE"]}`,
+	}}
+	for i, v := range vectors {
+		var buf bytes.Buffer
+		s := NewFileSink(&buf, v.hashURLs)
+		s.Emit(e)
+		s.Emit(Event{Type: EventUpdate, Time: e.Time, HashPrefixes: 2})
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 2 || lines[0] != v.want {
+			t.Errorf("test %d, output = %q, want first line %q", i, buf.String(), v.want)
+		}
+		var got Event
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &got); err != nil || got.HashPrefixes != 2 {
+			t.Errorf("test %d, unexpected update event %q: %v", i, lines[len(lines)-1], err)
+		}
+		if got := s.Stats(); got != (SinkStats{Sent: 2}) {
+			t.Errorf("test %d, stats = %+v, want 2 events sent", i, got)
+		}
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	all, detections := new(recordSink), new(recordSink)
+	s := MultiSink(all, FilterEvents(detections, EventDetection))
+	for _, typ := range []EventType{EventUpdate, EventDetection, EventError} {
+		s.Emit(Event{Type: typ})
+	}
+	if got := len(all.take()); got != 3 {
+		t.Errorf("%d events emitted to the first sink, want 3", got)
+	}
+	if got := detections.take(); len(got) != 1 || got[0].Type != EventDetection {
+		t.Errorf("events emitted to the filtered sink = %+v, want a detection", got)
+	}
+}
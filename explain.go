@@ -0,0 +1,89 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"sort"
+)
+
+// URLExplanation explains the verdict of a URL, as returned by ExplainURL.
+type URLExplanation struct {
+	URL          string
+	CanonicalURL string // The URL as canonicalized by lookups
+
+	// Expressions explains the lookup of every host suffix and path prefix
+	// expression of the URL.
+	Expressions []ExpressionExplanation
+
+	// Result is the result of the lookup of the URL.
+	Result URLResult
+}
+
+// ExpressionExplanation explains the lookup of a URL expression.
+type ExpressionExplanation struct {
+	Pattern string // The URL expression, such as "example.com/a/"
+	Hash    []byte // The SHA256 hash of Pattern
+
+	// HashPrefix is the prefix of Hash found in the local database, and
+	// PrefixThreatTypes the threat lists it was found in. If empty, the
+	// expression was ruled out by the database alone.
+	HashPrefix        []byte
+	PrefixThreatTypes []ThreatType
+
+	// ThreatTypes are the threat lists the full hash was confirmed to be on,
+	// by the cache or the Web Risk API.
+	ThreatTypes []ThreatType
+}
+
+// ExplainURL looks up url like LookupURLResults, and explains its verdict by
+// the lookups of its expressions, such as to find out why a URL was or was
+// not reported unsafe.
+func (wr *UpdateClient) ExplainURL(ctx context.Context, url string) (*URLExplanation, error) {
+	results, err := wr.LookupURLResults(ctx, []string{url})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Unsupported {
+		return &URLExplanation{URL: url, Result: results[0]}, nil
+	}
+	// The lookup already failed if the scheme policy rejects url.
+	target, _, _ := wr.config.SchemePolicy.apply(url)
+	canonical, err := CanonicalURL(target)
+	if err != nil {
+		return nil, err
+	}
+	limits := wr.expressionLimits(ctx)
+	patterns, err := URLExpressions(target, limits)
+	if err != nil {
+		return nil, err
+	}
+	x := &URLExplanation{URL: url, CanonicalURL: canonical, Result: results[0]}
+	for _, p := range patterns {
+		hash := hashFromPattern(p)
+		e := ExpressionExplanation{Pattern: p, Hash: []byte(hash)}
+		if prefix, tds := wr.db.Lookup(hash); len(tds) > 0 {
+			sort.Slice(tds, func(i, j int) bool { return tds[i] < tds[j] })
+			e.HashPrefix, e.PrefixThreatTypes = []byte(prefix), tds
+		}
+		for _, t := range results[0].Threats {
+			if t.Pattern == p {
+				e.ThreatTypes = append(e.ThreatTypes, t.ThreatType)
+			}
+		}
+		x.Expressions = append(x.Expressions, e)
+	}
+	return x, nil
+}
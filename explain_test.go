@@ -0,0 +1,116 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestExplainURL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	prefixes := hashPrefixes{fullHash[:4], hashFromPattern("example.com/")[:4]}
+	prefixes.Sort()
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0] + prefixes[1])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: prefixes.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(_ context.Context, hp []byte, _ []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			resp := &pb.SearchHashesResponse{NegativeExpireTime: timepb.New(now.Add(2 * time.Hour))}
+			if hashPrefix(hp) == fullHash[:4] {
+				resp.Threats = []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(now.Add(time.Hour)),
+				}}
+			}
+			return resp, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+		now:         func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := wr.ExplainURL(context.Background(), "http://BAD.example.com/a/../?q=1#frag")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &URLExplanation{
+		URL:          "http://BAD.example.com/a/../?q=1#frag",
+		CanonicalURL: "http://bad.example.com/?q=1",
+		Expressions: []ExpressionExplanation{{
+			Pattern:           "bad.example.com/",
+			Hash:              []byte(fullHash),
+			HashPrefix:        []byte(fullHash[:4]),
+			PrefixThreatTypes: []ThreatType{ThreatTypeMalware},
+			ThreatTypes:       []ThreatType{ThreatTypeMalware},
+		}, {
+			Pattern: "bad.example.com/?q=1",
+			Hash:    []byte(hashFromPattern("bad.example.com/?q=1")),
+		}, {
+			// Matched by a hash prefix, but not by a full hash.
+			Pattern:           "example.com/",
+			Hash:              []byte(hashFromPattern("example.com/")),
+			HashPrefix:        []byte(hashFromPattern("example.com/")[:4]),
+			PrefixThreatTypes: []ThreatType{ThreatTypeMalware},
+		}, {
+			Pattern: "example.com/?q=1",
+			Hash:    []byte(hashFromPattern("example.com/?q=1")),
+		}},
+		Result: URLResult{
+			Threats: []URLThreat{{
+				Pattern:    "bad.example.com/",
+				ThreatType: ThreatTypeMalware,
+				HashPrefix: []byte(hashFromPattern("bad.example.com/")[:4]),
+				Source:     SourceAPI,
+				ExpireTime: now.Add(time.Hour),
+			}},
+			ExpireTime: now.Add(localNegativeTTL),
+			Source:     SourceAPI,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ExplainURL() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := wr.ExplainURL(context.Background(), "http://[::1"); err == nil {
+		t.Errorf("ExplainURL() succeeded with an invalid URL")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"math/bits"
 	"sort"
 	"strings"
 
@@ -63,6 +64,36 @@ func (p hashPrefixes) Less(i, j int) bool { return p[i] < p[j] }
 func (p hashPrefixes) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p hashPrefixes) Sort()              { sort.Sort(p) }
 
+// merge merges the sorted hash prefixes in adds into the sorted list p and
+// returns the result. The merge is done in place if p has enough capacity,
+// otherwise p is copied into a buffer of the exact size needed.
+func (p hashPrefixes) merge(adds hashPrefixes) hashPrefixes {
+	if len(adds) == 0 {
+		return p
+	}
+	n := len(p) + len(adds)
+	out := p[:cap(p)]
+	if len(out) < n {
+		out = make(hashPrefixes, n)
+		copy(out, p)
+	}
+	out = out[:n]
+
+	// Merge from the back so that hashes in p are never overwritten before
+	// they have been moved.
+	i, j := len(p)-1, len(adds)-1
+	for k := n - 1; j >= 0; k-- {
+		if i >= 0 && out[i] > adds[j] {
+			out[k] = out[i]
+			i--
+		} else {
+			out[k] = adds[j]
+			j--
+		}
+	}
+	return out
+}
+
 // Validate checks that the list of hash prefixes is valid. It checks the
 // following parameters:
 //   - That each hash prefix is valid; that is, it has a length within
@@ -70,6 +101,37 @@ func (p hashPrefixes) Sort()              { sort.Sort(p) }
 //   - That the list of prefixes is sorted.
 //   - That none of the hashes are prefixes of each other.
 func (p hashPrefixes) Validate() error {
+	return p.validate(nil)
+}
+
+func (p hashPrefixes) SHA256() []byte {
+	hash := sha256.New()
+	var buf [maxHashPrefixLength]byte
+	for _, h := range p {
+		if len(h) > len(buf) {
+			hash.Write([]byte(h))
+			continue
+		}
+		hash.Write(buf[:copy(buf[:], h)])
+	}
+	return hash.Sum(nil)
+}
+
+// checksum validates the list of hash prefixes like Validate and returns
+// its SHA256. Both are computed in a single pass over the hashes, without
+// copying the list.
+func (p hashPrefixes) checksum() ([]byte, error) {
+	hash := sha256.New()
+	if err := p.validate(hash); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// validate implements Validate. If w is not nil, every hash is written to it
+// once validated.
+func (p hashPrefixes) validate(w io.Writer) error {
+	var buf [maxHashPrefixLength]byte
 	var hp hashPrefix // Previous hash
 	for _, h := range p {
 		switch {
@@ -80,19 +142,14 @@ func (p hashPrefixes) Validate() error {
 		case h.HasPrefix(hp) && hp != "":
 			return errors.New("webrisk: non-unique hash prefix")
 		}
+		if w != nil {
+			w.Write(buf[:copy(buf[:], h)])
+		}
 		hp = h
 	}
 	return nil
 }
 
-func (p hashPrefixes) SHA256() []byte {
-	hash := sha256.New()
-	for _, b := range p {
-		hash.Write([]byte(b))
-	}
-	return hash.Sum(nil)
-}
-
 // hashSet is a set of hash prefixes optimized for the fact that most hashes
 // are only 4 bytes in length.
 type hashSet struct {
@@ -108,6 +165,16 @@ func byte4(h hashPrefix) (b [4]byte) {
 
 func (hs *hashSet) Len() int { return hs.n }
 
+// Bytes returns the approximate size of the hash prefixes in the set,
+// excluding the overhead of the maps holding them.
+func (hs *hashSet) Bytes() int64 {
+	n := int64(len(hs.h4)) * (minHashPrefixLength + 1)
+	for h := range hs.hx {
+		n += int64(len(h))
+	}
+	return n
+}
+
 func (hs *hashSet) Import(phs hashPrefixes) {
 	hs.h4 = make(map[[minHashPrefixLength]byte]uint8, len(phs))
 	hs.hx = make(map[hashPrefix]struct{})
@@ -152,6 +219,18 @@ func (hs *hashSet) Lookup(h hashPrefix) int {
 	return 0
 }
 
+// LookupPrefix reports whether the set may hold a hash prefix that matches
+// the given partial hash, either by being a prefix of it or by starting with
+// it. Hashes starting with p are only checked by their first 4 bytes, so it
+// may report false positives.
+func (hs *hashSet) LookupPrefix(p hashPrefix) bool {
+	n := int(hs.h4[byte4(p)])
+	if n > len(p) {
+		return true
+	}
+	return n > 0 && hs.Lookup(p) > 0
+}
+
 // decodeHashes takes a ThreatEntrySet and returns a list of hashes that should
 // be added to the local database.
 func decodeHashes(input *pb.ThreatEntryAdditions) ([]hashPrefix, error) {
@@ -244,6 +323,54 @@ func decodeRiceIntegers(rice *pb.RiceDeltaEncoding) ([]uint32, error) {
 	return values, nil
 }
 
+// encodeRiceIntegers encodes a sorted list of integers using Golomb-Rice
+// delta encoding. It is the inverse of decodeRiceIntegers.
+func encodeRiceIntegers(values []uint32) *pb.RiceDeltaEncoding {
+	if len(values) == 0 {
+		return nil
+	}
+
+	// The Rice parameter is chosen such that 1<<k is close to the mean delta,
+	// which keeps the unary coded quotients short.
+	var k int
+	if n := len(values) - 1; n > 0 {
+		if mean := (values[n] - values[0]) / uint32(n); mean > 0 {
+			k = bits.Len32(mean) - 1
+		}
+	}
+
+	bw := new(bitWriter)
+	re := newRiceEncoder(bw, uint32(k))
+	for i := 1; i < len(values); i++ {
+		re.WriteValue(values[i] - values[i-1])
+	}
+	return &pb.RiceDeltaEncoding{
+		FirstValue:    int64(values[0]),
+		RiceParameter: int32(k),
+		EntryCount:    int32(len(values) - 1),
+		EncodedData:   bw.Bytes(),
+	}
+}
+
+// riceEncoder implements Golomb-Rice encoding in the format read by
+// riceDecoder.
+type riceEncoder struct {
+	bw *bitWriter
+	k  uint32 // Golomb-Rice parameter
+}
+
+func newRiceEncoder(bw *bitWriter, k uint32) *riceEncoder {
+	return &riceEncoder{bw, k}
+}
+
+func (re *riceEncoder) WriteValue(v uint32) {
+	for q := v >> re.k; q > 0; q-- {
+		re.bw.WriteBits(1, 1)
+	}
+	re.bw.WriteBits(0, 1)
+	re.bw.WriteBits(v, int(re.k))
+}
+
 // riceDecoder implements Golomb-Rice decoding for the Web Risk API.
 //
 // In a Rice decoder every number n is encoded as q and r where n = (q<<k) + r.
@@ -335,3 +462,31 @@ func (br *bitReader) BitsRemaining() int {
 	}
 	return n
 }
+
+// The bitWriter writes bits to a slice of bytes in the bit stream format read
+// by bitReader.
+type bitWriter struct {
+	buf  []byte
+	mask byte
+}
+
+func (bw *bitWriter) WriteBits(v uint32, n int) {
+	if n < 0 || n > 32 {
+		panic("invalid number of bits")
+	}
+
+	for i := 0; i < n; i++ {
+		if bw.mask == 0 {
+			bw.buf, bw.mask = append(bw.buf, 0), 0x01
+		}
+		if v&(1<<uint(i)) > 0 {
+			bw.buf[len(bw.buf)-1] |= bw.mask
+		}
+		bw.mask <<= 1
+	}
+}
+
+// Bytes returns the bits written so far, padded with zeros to a whole byte.
+func (bw *bitWriter) Bytes() []byte {
+	return bw.buf
+}
@@ -113,6 +113,57 @@ func TestHashComputeSHA256(t *testing.T) {
 	}
 }
 
+func TestHashChecksum(t *testing.T) {
+	vectors := []hashPrefixes{
+		nil,
+		{"bbb"},
+		{"bbbb", "aaaa"},
+		{"aaaa", "bbbbb", "bbbbbc"},
+		{"xxxx", "yyyy", "zzzz"},
+		{"aaaa", "bbbbbc", "bbbbbd", hashPrefix(mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))},
+	}
+
+	for i, v := range vectors {
+		sum, err := v.checksum()
+		if verr := v.Validate(); (err == nil) != (verr == nil) {
+			t.Errorf("test %d, checksum() error = %v, want %v", i, err, verr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(sum, v.SHA256()) {
+			t.Errorf("test %d, mismatching hash:\ngot  %x\nwant %x", i, sum, v.SHA256())
+		}
+	}
+}
+
+func TestHashMerge(t *testing.T) {
+	vectors := []struct {
+		hashes hashPrefixes
+		adds   hashPrefixes
+		extra  int // Spare capacity of hashes
+		want   hashPrefixes
+	}{
+		{nil, nil, 0, nil},
+		{nil, hashPrefixes{"aaaa", "bbbb"}, 0, hashPrefixes{"aaaa", "bbbb"}},
+		{hashPrefixes{"aaaa", "bbbb"}, nil, 0, hashPrefixes{"aaaa", "bbbb"}},
+		{hashPrefixes{"bbbb", "dddd"}, hashPrefixes{"aaaa", "cccc", "eeee"}, 0, hashPrefixes{"aaaa", "bbbb", "cccc", "dddd", "eeee"}},
+		{hashPrefixes{"bbbb", "dddd"}, hashPrefixes{"aaaa", "cccc", "eeee"}, 3, hashPrefixes{"aaaa", "bbbb", "cccc", "dddd", "eeee"}},
+		{hashPrefixes{"aaaa", "bbbb"}, hashPrefixes{"cccc", "dddd"}, 1, hashPrefixes{"aaaa", "bbbb", "cccc", "dddd"}},
+		{hashPrefixes{"cccc", "dddd"}, hashPrefixes{"aaaa", "bbbb"}, 2, hashPrefixes{"aaaa", "bbbb", "cccc", "dddd"}},
+	}
+
+	for i, v := range vectors {
+		hashes := make(hashPrefixes, len(v.hashes), len(v.hashes)+v.extra)
+		copy(hashes, v.hashes)
+		got := hashes.merge(v.adds)
+		if len(got) != len(v.want) || (len(got) > 0 && !reflect.DeepEqual(got, v.want)) {
+			t.Errorf("test %d, merge() = %v, want %v", i, got, v.want)
+		}
+	}
+}
+
 func TestHashFromPattern(t *testing.T) {
 	got := hashFromPattern("foo.com/")
 	want := hashPrefix(mustDecodeHex(t, "af30010e4c011fc77e1ab03ef898ab2f8dec17c0bd178a875ad0cd9b7a6e5973"))
@@ -428,6 +479,32 @@ loop:
 	}
 }
 
+func TestRiceEncoder(t *testing.T) {
+	vectors := [][]uint32{
+		{0},
+		{5, 5, 5},
+		{1, 2, 3, 4, 1000},
+		{0, 0x01010101, 0x7fffffff, 0xffffffff},
+		{3, 20, 1 << 20, 1<<20 + 1, 1 << 30},
+	}
+
+	for i, v := range vectors {
+		rice := encodeRiceIntegers(v)
+		values, err := decodeRiceIntegers(rice)
+		if err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, v) {
+			t.Errorf("test %d, output mismatch:\ngot  %v\nwant %v", i, values, v)
+		}
+	}
+
+	if rice := encodeRiceIntegers(nil); rice != nil {
+		t.Errorf("encodeRiceIntegers(nil) = %v, want nil", rice)
+	}
+}
+
 func TestBitReader(t *testing.T) {
 	vectors := []struct {
 		cnt int    // Number of bits to read
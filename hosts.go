@@ -0,0 +1,63 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"net"
+	"strings"
+)
+
+// isPrivateHost reports whether the canonical host is a loopback, private
+// (RFC 1918 or RFC 4193), link-local or unspecified IP address, or localhost,
+// which can never be on the threat lists.
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// normalizeHostSuffixes returns suffixes lowercased and stripped of leading
+// and trailing dots, and reports whether none is empty.
+func normalizeHostSuffixes(suffixes []string) ([]string, bool) {
+	var normalized []string
+	for _, s := range suffixes {
+		s = strings.ToLower(strings.Trim(s, "."))
+		if s == "" {
+			return nil, false
+		}
+		normalized = append(normalized, s)
+	}
+	return normalized, true
+}
+
+// skipHost reports whether lookups skip the URLs with the canonical host,
+// according to Config.SkipPrivateHosts and Config.InternalHostSuffixes.
+func (c *Config) skipHost(host string) bool {
+	if c.SkipPrivateHosts && isPrivateHost(host) {
+		return true
+	}
+	for _, s := range c.InternalHostSuffixes {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestSkipHost(t *testing.T) {
+	vectors := []struct {
+		host string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"[::1]", true},
+		{"[fe80::1]", true},
+		{"[fd00::1]", true},
+		{"localhost", true},
+		{"app.localhost", true},
+		{"wiki.corp.example.com", true},
+		{"corp.example.com", true},
+		{"build.internal", true},
+		{"8.8.8.8", false},
+		{"[2001:4860:4860::8888]", false},
+		{"example.com", false},
+		{"notcorp.example.com", false},
+		{"internal.example.com", false},
+	}
+	conf := Config{SkipPrivateHosts: true, InternalHostSuffixes: []string{".Corp.Example.com", "internal."}}
+	if !conf.setDefaults() {
+		t.Fatalf("setDefaults() = false, want true")
+	}
+	for i, v := range vectors {
+		if got := conf.skipHost(v.host); got != v.want {
+			t.Errorf("test %d, skipHost(%q) = %v, want %v", i, v.host, got, v.want)
+		}
+	}
+
+	if conf := (Config{InternalHostSuffixes: []string{"."}}); conf.setDefaults() {
+		t.Errorf("setDefaults() with an empty suffix = true, want false")
+	}
+}
+
+func TestLookupURLResultsSkipped(t *testing.T) {
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists:          []ThreatType{ThreatTypeMalware},
+		SkipPrivateHosts:     true,
+		InternalHostSuffixes: []string{"corp.example.com"},
+		api:                  api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	urls := []string{"http://192.168.0.1/admin", "http://example.com/", "https://wiki.corp.example.com/", "http://0x7f000001/"}
+	results, err := wr.LookupURLResults(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, want := range []bool{true, false, true, true} {
+		if results[i].Skipped != want {
+			t.Errorf("test %d, Skipped = %v, want %v", i, results[i].Skipped, want)
+		}
+	}
+	if stats, _ := wr.Status(); stats.QueriesSkipped != 3 {
+		t.Errorf("QueriesSkipped = %d, want 3", stats.QueriesSkipped)
+	}
+}
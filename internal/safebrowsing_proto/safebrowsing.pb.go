@@ -0,0 +1,903 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Copyright 2023 Google LLC.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// The subset of the Safe Browsing API v4 messages used by the
+// threatMatches:find method, which wrserver serves for the clients of that
+// API.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.29.0
+// 	protoc        v3.21.12
+// source: safebrowsing.proto
+
+package safebrowsing
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Types of threats.
+type ThreatType int32
+
+const (
+	// Unknown.
+	ThreatType_THREAT_TYPE_UNSPECIFIED ThreatType = 0
+	// Malware threat type.
+	ThreatType_MALWARE ThreatType = 1
+	// Social engineering threat type.
+	ThreatType_SOCIAL_ENGINEERING ThreatType = 2
+	// Unwanted software threat type.
+	ThreatType_UNWANTED_SOFTWARE ThreatType = 3
+	// Potentially harmful application threat type.
+	ThreatType_POTENTIALLY_HARMFUL_APPLICATION ThreatType = 4
+)
+
+// Enum value maps for ThreatType.
+var (
+	ThreatType_name = map[int32]string{
+		0: "THREAT_TYPE_UNSPECIFIED",
+		1: "MALWARE",
+		2: "SOCIAL_ENGINEERING",
+		3: "UNWANTED_SOFTWARE",
+		4: "POTENTIALLY_HARMFUL_APPLICATION",
+	}
+	ThreatType_value = map[string]int32{
+		"THREAT_TYPE_UNSPECIFIED":         0,
+		"MALWARE":                         1,
+		"SOCIAL_ENGINEERING":              2,
+		"UNWANTED_SOFTWARE":               3,
+		"POTENTIALLY_HARMFUL_APPLICATION": 4,
+	}
+)
+
+func (x ThreatType) Enum() *ThreatType {
+	p := new(ThreatType)
+	*p = x
+	return p
+}
+
+func (x ThreatType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ThreatType) Descriptor() protoreflect.EnumDescriptor {
+	return file_safebrowsing_proto_enumTypes[0].Descriptor()
+}
+
+func (ThreatType) Type() protoreflect.EnumType {
+	return &file_safebrowsing_proto_enumTypes[0]
+}
+
+func (x ThreatType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ThreatType.Descriptor instead.
+func (ThreatType) EnumDescriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{0}
+}
+
+// Types of platforms.
+type PlatformType int32
+
+const (
+	// Unknown platform.
+	PlatformType_PLATFORM_TYPE_UNSPECIFIED PlatformType = 0
+	// Threat posed to Windows.
+	PlatformType_WINDOWS PlatformType = 1
+	// Threat posed to Linux.
+	PlatformType_LINUX PlatformType = 2
+	// Threat posed to Android.
+	PlatformType_ANDROID PlatformType = 3
+	// Threat posed to OS X.
+	PlatformType_OSX PlatformType = 4
+	// Threat posed to iOS.
+	PlatformType_IOS PlatformType = 5
+	// Threat posed to at least one of the defined platforms.
+	PlatformType_ANY_PLATFORM PlatformType = 6
+	// Threat posed to all defined platforms.
+	PlatformType_ALL_PLATFORMS PlatformType = 7
+	// Threat posed to Chrome.
+	PlatformType_CHROME PlatformType = 8
+)
+
+// Enum value maps for PlatformType.
+var (
+	PlatformType_name = map[int32]string{
+		0: "PLATFORM_TYPE_UNSPECIFIED",
+		1: "WINDOWS",
+		2: "LINUX",
+		3: "ANDROID",
+		4: "OSX",
+		5: "IOS",
+		6: "ANY_PLATFORM",
+		7: "ALL_PLATFORMS",
+		8: "CHROME",
+	}
+	PlatformType_value = map[string]int32{
+		"PLATFORM_TYPE_UNSPECIFIED": 0,
+		"WINDOWS":                   1,
+		"LINUX":                     2,
+		"ANDROID":                   3,
+		"OSX":                       4,
+		"IOS":                       5,
+		"ANY_PLATFORM":              6,
+		"ALL_PLATFORMS":             7,
+		"CHROME":                    8,
+	}
+)
+
+func (x PlatformType) Enum() *PlatformType {
+	p := new(PlatformType)
+	*p = x
+	return p
+}
+
+func (x PlatformType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PlatformType) Descriptor() protoreflect.EnumDescriptor {
+	return file_safebrowsing_proto_enumTypes[1].Descriptor()
+}
+
+func (PlatformType) Type() protoreflect.EnumType {
+	return &file_safebrowsing_proto_enumTypes[1]
+}
+
+func (x PlatformType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PlatformType.Descriptor instead.
+func (PlatformType) EnumDescriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{1}
+}
+
+// Types of entries that pose threats. Threat lists are collections of entries
+// of a single type.
+type ThreatEntryType int32
+
+const (
+	// Unspecified.
+	ThreatEntryType_THREAT_ENTRY_TYPE_UNSPECIFIED ThreatEntryType = 0
+	// A URL.
+	ThreatEntryType_URL ThreatEntryType = 1
+	// An executable program.
+	ThreatEntryType_EXECUTABLE ThreatEntryType = 2
+	// An IP range.
+	ThreatEntryType_IP_RANGE ThreatEntryType = 3
+)
+
+// Enum value maps for ThreatEntryType.
+var (
+	ThreatEntryType_name = map[int32]string{
+		0: "THREAT_ENTRY_TYPE_UNSPECIFIED",
+		1: "URL",
+		2: "EXECUTABLE",
+		3: "IP_RANGE",
+	}
+	ThreatEntryType_value = map[string]int32{
+		"THREAT_ENTRY_TYPE_UNSPECIFIED": 0,
+		"URL":                           1,
+		"EXECUTABLE":                    2,
+		"IP_RANGE":                      3,
+	}
+)
+
+func (x ThreatEntryType) Enum() *ThreatEntryType {
+	p := new(ThreatEntryType)
+	*p = x
+	return p
+}
+
+func (x ThreatEntryType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ThreatEntryType) Descriptor() protoreflect.EnumDescriptor {
+	return file_safebrowsing_proto_enumTypes[2].Descriptor()
+}
+
+func (ThreatEntryType) Type() protoreflect.EnumType {
+	return &file_safebrowsing_proto_enumTypes[2]
+}
+
+func (x ThreatEntryType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ThreatEntryType.Descriptor instead.
+func (ThreatEntryType) EnumDescriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{2}
+}
+
+// Request to check entries against lists.
+type FindThreatMatchesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The client metadata.
+	Client *ClientInfo `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	// The lists and entries to be checked for matches.
+	ThreatInfo *ThreatInfo `protobuf:"bytes,2,opt,name=threat_info,json=threatInfo,proto3" json:"threat_info,omitempty"`
+}
+
+func (x *FindThreatMatchesRequest) Reset() {
+	*x = FindThreatMatchesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FindThreatMatchesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindThreatMatchesRequest) ProtoMessage() {}
+
+func (x *FindThreatMatchesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindThreatMatchesRequest.ProtoReflect.Descriptor instead.
+func (*FindThreatMatchesRequest) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FindThreatMatchesRequest) GetClient() *ClientInfo {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *FindThreatMatchesRequest) GetThreatInfo() *ThreatInfo {
+	if x != nil {
+		return x.ThreatInfo
+	}
+	return nil
+}
+
+// Response type for requests to find threat matches.
+type FindThreatMatchesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The threat list matches.
+	Matches []*ThreatMatch `protobuf:"bytes,1,rep,name=matches,proto3" json:"matches,omitempty"`
+}
+
+func (x *FindThreatMatchesResponse) Reset() {
+	*x = FindThreatMatchesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FindThreatMatchesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindThreatMatchesResponse) ProtoMessage() {}
+
+func (x *FindThreatMatchesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindThreatMatchesResponse.ProtoReflect.Descriptor instead.
+func (*FindThreatMatchesResponse) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FindThreatMatchesResponse) GetMatches() []*ThreatMatch {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+// The client metadata associated with Safe Browsing API requests.
+type ClientInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// A client ID that (hopefully) uniquely identifies the client implementation
+	// of the Safe Browsing API.
+	ClientId string `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	// The version of the client implementation.
+	ClientVersion string `protobuf:"bytes,2,opt,name=client_version,json=clientVersion,proto3" json:"client_version,omitempty"`
+}
+
+func (x *ClientInfo) Reset() {
+	*x = ClientInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ClientInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientInfo) ProtoMessage() {}
+
+func (x *ClientInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientInfo.ProtoReflect.Descriptor instead.
+func (*ClientInfo) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ClientInfo) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *ClientInfo) GetClientVersion() string {
+	if x != nil {
+		return x.ClientVersion
+	}
+	return ""
+}
+
+// The information regarding one or more threats that a client submits when
+// checking for matches in threat lists.
+type ThreatInfo struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The threat types to be checked.
+	ThreatTypes []ThreatType `protobuf:"varint,1,rep,packed,name=threat_types,json=threatTypes,proto3,enum=google.safebrowsing.v4.ThreatType" json:"threat_types,omitempty"`
+	// The platform types to be checked.
+	PlatformTypes []PlatformType `protobuf:"varint,2,rep,packed,name=platform_types,json=platformTypes,proto3,enum=google.safebrowsing.v4.PlatformType" json:"platform_types,omitempty"`
+	// The entry types to be checked.
+	ThreatEntryTypes []ThreatEntryType `protobuf:"varint,4,rep,packed,name=threat_entry_types,json=threatEntryTypes,proto3,enum=google.safebrowsing.v4.ThreatEntryType" json:"threat_entry_types,omitempty"`
+	// The threat entries to be checked.
+	ThreatEntries []*ThreatEntry `protobuf:"bytes,3,rep,name=threat_entries,json=threatEntries,proto3" json:"threat_entries,omitempty"`
+}
+
+func (x *ThreatInfo) Reset() {
+	*x = ThreatInfo{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ThreatInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ThreatInfo) ProtoMessage() {}
+
+func (x *ThreatInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ThreatInfo.ProtoReflect.Descriptor instead.
+func (*ThreatInfo) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ThreatInfo) GetThreatTypes() []ThreatType {
+	if x != nil {
+		return x.ThreatTypes
+	}
+	return nil
+}
+
+func (x *ThreatInfo) GetPlatformTypes() []PlatformType {
+	if x != nil {
+		return x.PlatformTypes
+	}
+	return nil
+}
+
+func (x *ThreatInfo) GetThreatEntryTypes() []ThreatEntryType {
+	if x != nil {
+		return x.ThreatEntryTypes
+	}
+	return nil
+}
+
+func (x *ThreatInfo) GetThreatEntries() []*ThreatEntry {
+	if x != nil {
+		return x.ThreatEntries
+	}
+	return nil
+}
+
+// A match when checking a threat entry in the Safe Browsing threat lists.
+type ThreatMatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The threat type matching this threat.
+	ThreatType ThreatType `protobuf:"varint,1,opt,name=threat_type,json=threatType,proto3,enum=google.safebrowsing.v4.ThreatType" json:"threat_type,omitempty"`
+	// The platform type matching this threat.
+	PlatformType PlatformType `protobuf:"varint,2,opt,name=platform_type,json=platformType,proto3,enum=google.safebrowsing.v4.PlatformType" json:"platform_type,omitempty"`
+	// The threat entry type matching this threat.
+	ThreatEntryType ThreatEntryType `protobuf:"varint,6,opt,name=threat_entry_type,json=threatEntryType,proto3,enum=google.safebrowsing.v4.ThreatEntryType" json:"threat_entry_type,omitempty"`
+	// The threat matching this threat.
+	Threat *ThreatEntry `protobuf:"bytes,3,opt,name=threat,proto3" json:"threat,omitempty"`
+	// The cache lifetime for the returned match. Clients must not cache this
+	// response for more than this duration to avoid false positives.
+	CacheDuration *durationpb.Duration `protobuf:"bytes,5,opt,name=cache_duration,json=cacheDuration,proto3" json:"cache_duration,omitempty"`
+}
+
+func (x *ThreatMatch) Reset() {
+	*x = ThreatMatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ThreatMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ThreatMatch) ProtoMessage() {}
+
+func (x *ThreatMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ThreatMatch.ProtoReflect.Descriptor instead.
+func (*ThreatMatch) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ThreatMatch) GetThreatType() ThreatType {
+	if x != nil {
+		return x.ThreatType
+	}
+	return ThreatType_THREAT_TYPE_UNSPECIFIED
+}
+
+func (x *ThreatMatch) GetPlatformType() PlatformType {
+	if x != nil {
+		return x.PlatformType
+	}
+	return PlatformType_PLATFORM_TYPE_UNSPECIFIED
+}
+
+func (x *ThreatMatch) GetThreatEntryType() ThreatEntryType {
+	if x != nil {
+		return x.ThreatEntryType
+	}
+	return ThreatEntryType_THREAT_ENTRY_TYPE_UNSPECIFIED
+}
+
+func (x *ThreatMatch) GetThreat() *ThreatEntry {
+	if x != nil {
+		return x.Threat
+	}
+	return nil
+}
+
+func (x *ThreatMatch) GetCacheDuration() *durationpb.Duration {
+	if x != nil {
+		return x.CacheDuration
+	}
+	return nil
+}
+
+// An individual threat; for example, a malicious URL or its hash
+// representation. Only one of these fields should be set.
+type ThreatEntry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// A hash prefix, consisting of the most significant 4-32 bytes of a SHA256
+	// hash.
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	// A URL.
+	Url string `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// The digest of an executable in SHA256 format.
+	Digest []byte `protobuf:"bytes,3,opt,name=digest,proto3" json:"digest,omitempty"`
+}
+
+func (x *ThreatEntry) Reset() {
+	*x = ThreatEntry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_safebrowsing_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ThreatEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ThreatEntry) ProtoMessage() {}
+
+func (x *ThreatEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_safebrowsing_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ThreatEntry.ProtoReflect.Descriptor instead.
+func (*ThreatEntry) Descriptor() ([]byte, []int) {
+	return file_safebrowsing_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ThreatEntry) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+func (x *ThreatEntry) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ThreatEntry) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+var File_safebrowsing_proto protoreflect.FileDescriptor
+
+var file_safebrowsing_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x16, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66,
+	0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34, 0x1a, 0x1e, 0x67, 0x6f,
+	0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x64, 0x75,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x9b, 0x01, 0x0a,
+	0x18, 0x46, 0x69, 0x6e, 0x64, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68,
+	0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x3a, 0x0a, 0x06, 0x63, 0x6c, 0x69,
+	0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e,
+	0x76, 0x34, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x63,
+	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x43, 0x0a, 0x0b, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x5f,
+	0x69, 0x6e, 0x66, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67,
+	0x2e, 0x76, 0x34, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x0a,
+	0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x22, 0x5a, 0x0a, 0x19, 0x46, 0x69,
+	0x6e, 0x64, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3d, 0x0a, 0x07, 0x6d, 0x61, 0x74, 0x63, 0x68,
+	0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76,
+	0x34, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x52, 0x07, 0x6d,
+	0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x22, 0x50, 0x0a, 0x0a, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49,
+	0x64, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x76, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x22, 0xc3, 0x02, 0x0a, 0x0a, 0x54, 0x68, 0x72,
+	0x65, 0x61, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x45, 0x0a, 0x0c, 0x74, 0x68, 0x72, 0x65, 0x61,
+	0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x22, 0x2e,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73,
+	0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x54, 0x79, 0x70,
+	0x65, 0x52, 0x0b, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x54, 0x79, 0x70, 0x65, 0x73, 0x12, 0x4b,
+	0x0a, 0x0e, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x24, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34, 0x2e,
+	0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0d, 0x70, 0x6c,
+	0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x73, 0x12, 0x55, 0x0a, 0x12, 0x74,
+	0x68, 0x72, 0x65, 0x61, 0x74, 0x5f, 0x65, 0x6e, 0x74, 0x72, 0x79, 0x5f, 0x74, 0x79, 0x70, 0x65,
+	0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0e, 0x32, 0x27, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
+	0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34,
+	0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65,
+	0x52, 0x10, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x54, 0x79, 0x70,
+	0x65, 0x73, 0x12, 0x4a, 0x0a, 0x0e, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x5f, 0x65, 0x6e, 0x74,
+	0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67,
+	0x2e, 0x76, 0x34, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
+	0x0d, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x22, 0xf7,
+	0x02, 0x0a, 0x0b, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x12, 0x43,
+	0x0a, 0x0b, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x22, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66,
+	0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34, 0x2e, 0x54, 0x68, 0x72,
+	0x65, 0x61, 0x74, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0a, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x49, 0x0a, 0x0d, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x5f,
+	0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x24, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67,
+	0x2e, 0x76, 0x34, 0x2e, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x54, 0x79, 0x70, 0x65,
+	0x52, 0x0c, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x54, 0x79, 0x70, 0x65, 0x12, 0x53,
+	0x0a, 0x11, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x5f, 0x65, 0x6e, 0x74, 0x72, 0x79, 0x5f, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x27, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e,
+	0x76, 0x34, 0x2e, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x54, 0x79,
+	0x70, 0x65, 0x52, 0x0f, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x3b, 0x0a, 0x06, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x73, 0x61, 0x66,
+	0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x2e, 0x76, 0x34, 0x2e, 0x54, 0x68, 0x72,
+	0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x74, 0x68, 0x72, 0x65, 0x61, 0x74,
+	0x12, 0x40, 0x0a, 0x0e, 0x63, 0x61, 0x63, 0x68, 0x65, 0x5f, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x44, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x52, 0x0d, 0x63, 0x61, 0x63, 0x68, 0x65, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x4a, 0x04, 0x08, 0x04, 0x10, 0x05, 0x22, 0x4b, 0x0a, 0x0b, 0x54, 0x68, 0x72, 0x65,
+	0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x61, 0x73, 0x68, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x68, 0x61, 0x73, 0x68, 0x12, 0x10, 0x0a, 0x03, 0x75,
+	0x72, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x16, 0x0a,
+	0x06, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x64,
+	0x69, 0x67, 0x65, 0x73, 0x74, 0x2a, 0x8a, 0x01, 0x0a, 0x0a, 0x54, 0x68, 0x72, 0x65, 0x61, 0x74,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x1b, 0x0a, 0x17, 0x54, 0x48, 0x52, 0x45, 0x41, 0x54, 0x5f, 0x54,
+	0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10,
+	0x00, 0x12, 0x0b, 0x0a, 0x07, 0x4d, 0x41, 0x4c, 0x57, 0x41, 0x52, 0x45, 0x10, 0x01, 0x12, 0x16,
+	0x0a, 0x12, 0x53, 0x4f, 0x43, 0x49, 0x41, 0x4c, 0x5f, 0x45, 0x4e, 0x47, 0x49, 0x4e, 0x45, 0x45,
+	0x52, 0x49, 0x4e, 0x47, 0x10, 0x02, 0x12, 0x15, 0x0a, 0x11, 0x55, 0x4e, 0x57, 0x41, 0x4e, 0x54,
+	0x45, 0x44, 0x5f, 0x53, 0x4f, 0x46, 0x54, 0x57, 0x41, 0x52, 0x45, 0x10, 0x03, 0x12, 0x23, 0x0a,
+	0x1f, 0x50, 0x4f, 0x54, 0x45, 0x4e, 0x54, 0x49, 0x41, 0x4c, 0x4c, 0x59, 0x5f, 0x48, 0x41, 0x52,
+	0x4d, 0x46, 0x55, 0x4c, 0x5f, 0x41, 0x50, 0x50, 0x4c, 0x49, 0x43, 0x41, 0x54, 0x49, 0x4f, 0x4e,
+	0x10, 0x04, 0x2a, 0x95, 0x01, 0x0a, 0x0c, 0x50, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x1d, 0x0a, 0x19, 0x50, 0x4c, 0x41, 0x54, 0x46, 0x4f, 0x52, 0x4d, 0x5f,
+	0x54, 0x59, 0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44,
+	0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x57, 0x49, 0x4e, 0x44, 0x4f, 0x57, 0x53, 0x10, 0x01, 0x12,
+	0x09, 0x0a, 0x05, 0x4c, 0x49, 0x4e, 0x55, 0x58, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x41, 0x4e,
+	0x44, 0x52, 0x4f, 0x49, 0x44, 0x10, 0x03, 0x12, 0x07, 0x0a, 0x03, 0x4f, 0x53, 0x58, 0x10, 0x04,
+	0x12, 0x07, 0x0a, 0x03, 0x49, 0x4f, 0x53, 0x10, 0x05, 0x12, 0x10, 0x0a, 0x0c, 0x41, 0x4e, 0x59,
+	0x5f, 0x50, 0x4c, 0x41, 0x54, 0x46, 0x4f, 0x52, 0x4d, 0x10, 0x06, 0x12, 0x11, 0x0a, 0x0d, 0x41,
+	0x4c, 0x4c, 0x5f, 0x50, 0x4c, 0x41, 0x54, 0x46, 0x4f, 0x52, 0x4d, 0x53, 0x10, 0x07, 0x12, 0x0a,
+	0x0a, 0x06, 0x43, 0x48, 0x52, 0x4f, 0x4d, 0x45, 0x10, 0x08, 0x2a, 0x5b, 0x0a, 0x0f, 0x54, 0x68,
+	0x72, 0x65, 0x61, 0x74, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x54, 0x79, 0x70, 0x65, 0x12, 0x21, 0x0a,
+	0x1d, 0x54, 0x48, 0x52, 0x45, 0x41, 0x54, 0x5f, 0x45, 0x4e, 0x54, 0x52, 0x59, 0x5f, 0x54, 0x59,
+	0x50, 0x45, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00,
+	0x12, 0x07, 0x0a, 0x03, 0x55, 0x52, 0x4c, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x45, 0x58, 0x45,
+	0x43, 0x55, 0x54, 0x41, 0x42, 0x4c, 0x45, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x49, 0x50, 0x5f,
+	0x52, 0x41, 0x4e, 0x47, 0x45, 0x10, 0x03, 0x42, 0x44, 0x5a, 0x42, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x77, 0x65, 0x62,
+	0x72, 0x69, 0x73, 0x6b, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x73, 0x61,
+	0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x3b, 0x73, 0x61, 0x66, 0x65, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x69, 0x6e, 0x67, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_safebrowsing_proto_rawDescOnce sync.Once
+	file_safebrowsing_proto_rawDescData = file_safebrowsing_proto_rawDesc
+)
+
+func file_safebrowsing_proto_rawDescGZIP() []byte {
+	file_safebrowsing_proto_rawDescOnce.Do(func() {
+		file_safebrowsing_proto_rawDescData = protoimpl.X.CompressGZIP(file_safebrowsing_proto_rawDescData)
+	})
+	return file_safebrowsing_proto_rawDescData
+}
+
+var file_safebrowsing_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_safebrowsing_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_safebrowsing_proto_goTypes = []interface{}{
+	(ThreatType)(0),                   // 0: google.safebrowsing.v4.ThreatType
+	(PlatformType)(0),                 // 1: google.safebrowsing.v4.PlatformType
+	(ThreatEntryType)(0),              // 2: google.safebrowsing.v4.ThreatEntryType
+	(*FindThreatMatchesRequest)(nil),  // 3: google.safebrowsing.v4.FindThreatMatchesRequest
+	(*FindThreatMatchesResponse)(nil), // 4: google.safebrowsing.v4.FindThreatMatchesResponse
+	(*ClientInfo)(nil),                // 5: google.safebrowsing.v4.ClientInfo
+	(*ThreatInfo)(nil),                // 6: google.safebrowsing.v4.ThreatInfo
+	(*ThreatMatch)(nil),               // 7: google.safebrowsing.v4.ThreatMatch
+	(*ThreatEntry)(nil),               // 8: google.safebrowsing.v4.ThreatEntry
+	(*durationpb.Duration)(nil),       // 9: google.protobuf.Duration
+}
+var file_safebrowsing_proto_depIdxs = []int32{
+	5,  // 0: google.safebrowsing.v4.FindThreatMatchesRequest.client:type_name -> google.safebrowsing.v4.ClientInfo
+	6,  // 1: google.safebrowsing.v4.FindThreatMatchesRequest.threat_info:type_name -> google.safebrowsing.v4.ThreatInfo
+	7,  // 2: google.safebrowsing.v4.FindThreatMatchesResponse.matches:type_name -> google.safebrowsing.v4.ThreatMatch
+	0,  // 3: google.safebrowsing.v4.ThreatInfo.threat_types:type_name -> google.safebrowsing.v4.ThreatType
+	1,  // 4: google.safebrowsing.v4.ThreatInfo.platform_types:type_name -> google.safebrowsing.v4.PlatformType
+	2,  // 5: google.safebrowsing.v4.ThreatInfo.threat_entry_types:type_name -> google.safebrowsing.v4.ThreatEntryType
+	8,  // 6: google.safebrowsing.v4.ThreatInfo.threat_entries:type_name -> google.safebrowsing.v4.ThreatEntry
+	0,  // 7: google.safebrowsing.v4.ThreatMatch.threat_type:type_name -> google.safebrowsing.v4.ThreatType
+	1,  // 8: google.safebrowsing.v4.ThreatMatch.platform_type:type_name -> google.safebrowsing.v4.PlatformType
+	2,  // 9: google.safebrowsing.v4.ThreatMatch.threat_entry_type:type_name -> google.safebrowsing.v4.ThreatEntryType
+	8,  // 10: google.safebrowsing.v4.ThreatMatch.threat:type_name -> google.safebrowsing.v4.ThreatEntry
+	9,  // 11: google.safebrowsing.v4.ThreatMatch.cache_duration:type_name -> google.protobuf.Duration
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_safebrowsing_proto_init() }
+func file_safebrowsing_proto_init() {
+	if File_safebrowsing_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_safebrowsing_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FindThreatMatchesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_safebrowsing_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FindThreatMatchesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_safebrowsing_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ClientInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_safebrowsing_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ThreatInfo); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_safebrowsing_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ThreatMatch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_safebrowsing_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ThreatEntry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_safebrowsing_proto_rawDesc,
+			NumEnums:      3,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_safebrowsing_proto_goTypes,
+		DependencyIndexes: file_safebrowsing_proto_depIdxs,
+		EnumInfos:         file_safebrowsing_proto_enumTypes,
+		MessageInfos:      file_safebrowsing_proto_msgTypes,
+	}.Build()
+	File_safebrowsing_proto = out.File
+	file_safebrowsing_proto_rawDesc = nil
+	file_safebrowsing_proto_goTypes = nil
+	file_safebrowsing_proto_depIdxs = nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// HashPrefixIterator iterates over the hash prefixes stored in the local
+// database for a threat list, in sorted order. It works on a snapshot of the
+// list, so it is unaffected by database updates made while iterating.
+//
+// Typical usage:
+//
+//	it, err := wr.HashPrefixes(webrisk.ThreatTypeMalware)
+//	if err != nil {
+//		...
+//	}
+//	for it.Next() {
+//		prefix := it.Prefix()
+//		...
+//	}
+type HashPrefixIterator struct {
+	phs hashPrefixes
+	i   int
+}
+
+// Next advances the iterator to the next hash prefix. It reports false when
+// there are no more hash prefixes.
+func (it *HashPrefixIterator) Next() bool {
+	if it.i >= len(it.phs) {
+		return false
+	}
+	it.i++
+	return true
+}
+
+// Prefix returns the current hash prefix. Its length is the prefix length,
+// between 4 and 32 bytes.
+func (it *HashPrefixIterator) Prefix() []byte {
+	return []byte(it.phs[it.i-1])
+}
+
+// Len returns the total number of hash prefixes of the iterator.
+func (it *HashPrefixIterator) Len() int {
+	return len(it.phs)
+}
+
+// HashPrefixes returns an iterator over the hash prefixes currently stored in
+// the local database for the threat list td. This is intended for auditing
+// the coverage of the local database, for example to compute the intersection
+// with other threat feeds.
+func (wr *UpdateClient) HashPrefixes(td ThreatType) (*HashPrefixIterator, error) {
+	if atomic.LoadUint32(&wr.closed) != 0 {
+		return nil, errClosed
+	}
+	if !wr.lists[td] {
+		return nil, errors.New("webrisk: threat list not configured: " + td.String())
+	}
+	phs, ok := wr.db.HashPrefixes(td)
+	if !ok {
+		if err := wr.db.Status(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("webrisk: threat list not loaded: " + td.String())
+	}
+	return &HashPrefixIterator{phs: phs}, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHashPrefixes(t *testing.T) {
+	wr := &UpdateClient{
+		db: database{
+			config: &Config{UpdatePeriod: DefaultUpdatePeriod, now: time.Now},
+			tfl: threatsForLookup{
+				ThreatTypeMalware: newHashSet([]hashPrefix{"cccc", "aaaa", "bbbbbbbb", "dddddddddd"}),
+			},
+		},
+		lists: map[ThreatType]bool{
+			ThreatTypeMalware:          true,
+			ThreatTypeUnwantedSoftware: true,
+		},
+	}
+
+	it, err := wr.HashPrefixes(ThreatTypeMalware)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if it.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", it.Len())
+	}
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.Prefix()))
+	}
+	want := []string{"aaaa", "bbbbbbbb", "cccc", "dddddddddd"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("prefixes mismatch:\ngot  %q\nwant %q", got, want)
+	}
+
+	if _, err := wr.HashPrefixes(ThreatTypeUnwantedSoftware); err == nil {
+		t.Errorf("unexpected success for list that is not loaded")
+	}
+	if _, err := wr.HashPrefixes(ThreatTypeSocialEngineering); err == nil {
+		t.Errorf("unexpected success for list that is not configured")
+	}
+}
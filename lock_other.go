@@ -0,0 +1,27 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package webrisk
+
+import "os"
+
+// lockFile is a no-op on platforms without advisory file locks. Since the
+// database file is always replaced atomically, readers never observe a
+// partially written file; they may only briefly see a stale generation.
+func lockFile(f *os.File, exclusive bool) error { return nil }
+
+// unlockFile is a no-op on platforms without advisory file locks.
+func unlockFile(f *os.File) error { return nil }
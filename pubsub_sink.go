@@ -0,0 +1,353 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultPubSubBatchSize is the default number of events published by a
+	// single request of a PubSubSink.
+	DefaultPubSubBatchSize = 100
+	// DefaultPubSubBatchDelay is the default maximum time an event waits to
+	// be published by a PubSubSink along with others.
+	DefaultPubSubBatchDelay = time.Second
+	// DefaultPubSubQueueSize is the default number of events queued by a
+	// PubSubSink.
+	DefaultPubSubQueueSize = 10000
+	// MaxPubSubBatchSize is the maximum number of messages of a publish
+	// request of the Pub/Sub API.
+	MaxPubSubBatchSize = 1000
+)
+
+// pubsubAPIURL is the root URL of the Cloud Pub/Sub API.
+const pubsubAPIURL = "https://pubsub.googleapis.com"
+
+// pubsubDefaultKey is the ordering key of the events without the ordering
+// label.
+const pubsubDefaultKey = "default"
+
+// validTopic matches the names of Pub/Sub topics.
+var validTopic = regexp.MustCompile(`^projects/[^/]+/topics/[^/]+$`)
+
+// PubSubSinkConfig sets up a PubSubSink.
+type PubSubSinkConfig struct {
+	// Topic is the Pub/Sub topic, as projects/<project>/topics/<topic>, to
+	// which events are published. This field is required.
+	Topic string
+
+	// AccessToken returns the OAuth 2.0 access token authenticating the
+	// requests to the Pub/Sub API. It is required unless the
+	// PUBSUB_EMULATOR_HOST environment variable is set, in which case events
+	// are published to the Pub/Sub emulator at that address without
+	// authentication.
+	AccessToken func(context.Context) (string, error)
+
+	// HashURLs replaces the URLs of the events by their hash.
+	HashURLs bool
+
+	// OrderingLabel is the label of the events used as their ordering key, so
+	// that the events with the same label are delivered in order. Events
+	// without the label have the "default" ordering key.
+	// If empty, events are published without ordering key.
+	OrderingLabel string
+
+	// BatchSize is the maximum number of events published by a single
+	// request, up to MaxPubSubBatchSize.
+	// If zero value, it defaults to DefaultPubSubBatchSize.
+	BatchSize int
+
+	// BatchDelay is the maximum time an event waits to be published along
+	// with others.
+	// If zero value, it defaults to DefaultPubSubBatchDelay.
+	BatchDelay time.Duration
+
+	// QueueSize is the maximum number of events queued, after which new
+	// events are dropped.
+	// If zero value, it defaults to DefaultPubSubQueueSize.
+	QueueSize int
+
+	// OnError is called with the error of every batch of events that could
+	// not be published. If nil, errors are ignored.
+	OnError func(error)
+}
+
+// pubsubMessage is a message of a publish request of the Pub/Sub API.
+type pubsubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// PubSubSink publishes events to a Cloud Pub/Sub topic with the REST API.
+// Events are queued, up to a bound beyond which they are dropped rather than
+// slowing down lookups, and published in batches by a single goroutine, so
+// that events with the same ordering key are published in order. Every
+// message has the type of the event, its threat types and its labels as
+// attributes.
+type PubSubSink struct {
+	topic         string
+	apiURL        string
+	accessToken   func(context.Context) (string, error) // Nil for the emulator
+	hashURLs      bool
+	orderingLabel string
+	onError       func(error)
+	client        *http.Client
+	batchSize     int
+	batchDelay    time.Duration // Maximum delay before a batch is published
+	retries       int           // Retries of a failed publish request
+	backoff       time.Duration // Delay before the first retry, doubled for every other
+	events        chan pubsubMessage
+	done          chan struct{}
+	stats         sinkStats
+
+	mu     sync.RWMutex // Protects closed
+	closed bool         // Whether the queue was closed
+}
+
+// NewPubSubSink returns a sink publishing events to the topic of conf, and
+// starts publishing them.
+func NewPubSubSink(conf PubSubSinkConfig) (*PubSubSink, error) {
+	if !validTopic.MatchString(conf.Topic) {
+		return nil, fmt.Errorf("webrisk: invalid topic %q, want projects/<project>/topics/<topic>", conf.Topic)
+	}
+	if conf.BatchSize == 0 {
+		conf.BatchSize = DefaultPubSubBatchSize
+	}
+	if conf.BatchDelay == 0 {
+		conf.BatchDelay = DefaultPubSubBatchDelay
+	}
+	if conf.QueueSize == 0 {
+		conf.QueueSize = DefaultPubSubQueueSize
+	}
+	if conf.BatchSize < 0 || conf.BatchSize > MaxPubSubBatchSize {
+		return nil, fmt.Errorf("webrisk: invalid batch size %d, want 1 to %d", conf.BatchSize, MaxPubSubBatchSize)
+	}
+	if conf.BatchDelay < 0 || conf.QueueSize < 0 {
+		return nil, errors.New("webrisk: invalid batch delay or queue size")
+	}
+	s := &PubSubSink{
+		topic:         conf.Topic,
+		apiURL:        pubsubAPIURL,
+		accessToken:   conf.AccessToken,
+		hashURLs:      conf.HashURLs,
+		orderingLabel: conf.OrderingLabel,
+		onError:       conf.OnError,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		batchSize:     conf.BatchSize,
+		batchDelay:    conf.BatchDelay,
+		retries:       3,
+		backoff:       time.Second,
+		events:        make(chan pubsubMessage, conf.QueueSize),
+		done:          make(chan struct{}),
+	}
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		s.apiURL, s.accessToken = "http://"+host, nil
+	} else if s.accessToken == nil {
+		return nil, errors.New("webrisk: no Pub/Sub access token")
+	}
+	go s.run()
+	return s, nil
+}
+
+// Emit queues e unless the queue is full.
+func (s *PubSubSink) Emit(e Event) {
+	if s.hashURLs {
+		e = e.hashURL()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		atomic.AddInt64(&s.stats.failed, 1)
+		s.fail(err)
+		return
+	}
+	m := pubsubMessage{Data: data, Attributes: map[string]string{"type": string(e.Type)}}
+	for k, v := range e.Labels {
+		m.Attributes[k] = v
+	}
+	if len(e.ThreatTypes) > 0 {
+		m.Attributes["threatTypes"] = strings.Join(e.ThreatTypes, ",")
+	}
+	if s.orderingLabel != "" {
+		m.OrderingKey = e.Labels[s.orderingLabel]
+		if m.OrderingKey == "" {
+			m.OrderingKey = pubsubDefaultKey
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- m:
+	default:
+		atomic.AddInt64(&s.stats.dropped, 1)
+	}
+}
+
+// fail reports err to the OnError callback.
+func (s *PubSubSink) fail(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// run publishes the queued events in batches until the queue is closed.
+func (s *PubSubSink) run() {
+	defer close(s.done)
+	var batch []pubsubMessage
+	timer := time.NewTimer(s.batchDelay)
+	timer.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for _, msgs := range groupByOrderingKey(batch) {
+			if err := s.publish(msgs); err != nil {
+				atomic.AddInt64(&s.stats.failed, int64(len(msgs)))
+				s.fail(fmt.Errorf("webrisk: unable to publish %d events to %s: %v", len(msgs), s.topic, err))
+				continue
+			}
+			atomic.AddInt64(&s.stats.sent, int64(len(msgs)))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case m, ok := <-s.events:
+			if !ok {
+				timer.Stop()
+				flush()
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) == 1 {
+				timer.Reset(s.batchDelay)
+			}
+			if len(batch) >= s.batchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// groupByOrderingKey splits batch into groups of messages with the same
+// ordering key, published by separate requests. The order of the messages of
+// every key is kept.
+func groupByOrderingKey(batch []pubsubMessage) [][]pubsubMessage {
+	var groups [][]pubsubMessage
+	index := make(map[string]int)
+	for _, m := range batch {
+		i, ok := index[m.OrderingKey]
+		if !ok {
+			i = len(groups)
+			index[m.OrderingKey] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+	return groups
+}
+
+// publish publishes the messages of batch, retrying with exponential backoff
+// on network errors, 429 Too Many Requests and 5xx responses.
+func (s *PubSubSink) publish(batch []pubsubMessage) error {
+	body, err := json.Marshal(struct {
+		Messages []pubsubMessage `json:"messages"`
+	}{batch})
+	if err != nil {
+		return err
+	}
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil || !retry || attempt == s.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes a single publish request, and reports whether it is worth
+// retrying if it failed.
+func (s *PubSubSink) post(body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiURL+"/v1/"+s.topic+":publish", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.accessToken != nil {
+		token, err := s.accessToken(ctx)
+		if err != nil {
+			return true, fmt.Errorf("unable to get an access token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("pubsub API returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// Stats returns the current publication statistics.
+func (s *PubSubSink) Stats() SinkStats {
+	return s.stats.snapshot()
+}
+
+// Close stops queuing events and waits until those already queued are
+// published, or until ctx is done. Events emitted after are dropped.
+func (s *PubSubSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPubSubSink(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+	var mu sync.Mutex
+	var requests [][]pubsubMessage
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/p/topics/events:publish" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, want Bearer token", got)
+		}
+		var req struct{ Messages []pubsubMessage }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls == 1 {
+			// The first request is retried.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests = append(requests, req.Messages)
+		w.Write([]byte(`{"messageIds": []}`))
+	}))
+	defer ts.Close()
+
+	token := func(context.Context) (string, error) { return "token", nil }
+	s, err := NewPubSubSink(PubSubSinkConfig{
+		Topic:         "projects/p/topics/events",
+		AccessToken:   token,
+		OrderingLabel: "tenant",
+		BatchDelay:    time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.apiURL, s.backoff = ts.URL, time.Millisecond
+	detection := func(u, tenant string) Event {
+		e := Event{Type: EventDetection, URL: u, ThreatTypes: []string{"MALWARE"}, Labels: map[string]string{"endpoint": "/v1/uris:search"}}
+		if tenant != "" {
+			e.Labels["tenant"] = tenant
+		}
+		return e
+	}
+	s.Emit(detection("http://bad1.example.com/", "payments"))
+	s.Emit(detection("http://bad2.example.com/", ""))
+	s.Emit(detection("http://bad3.example.com/", "payments"))
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := s.Stats(); got != (SinkStats{Sent: 3}) {
+		t.Errorf("stats = %+v, want 3 events published", got)
+	}
+
+	// Events are published in order, by a request per ordering key.
+	want := []struct {
+		key  string
+		urls []string
+	}{
+		{"payments", []string{"http://bad1.example.com/", "http://bad3.example.com/"}},
+		{pubsubDefaultKey, []string{"http://bad2.example.com/"}},
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("%d publish requests, want %d", len(requests), len(want))
+	}
+	for i, w := range want {
+		var urls []string
+		for _, m := range requests[i] {
+			if m.OrderingKey != w.key {
+				t.Errorf("request %d, ordering key = %q, want %q", i, m.OrderingKey, w.key)
+			}
+			if m.Attributes["type"] != "detection" || m.Attributes["threatTypes"] != "MALWARE" || m.Attributes["endpoint"] != "/v1/uris:search" {
+				t.Errorf("request %d, unexpected attributes %v", i, m.Attributes)
+			}
+			var e Event
+			if err := json.Unmarshal(m.Data, &e); err != nil {
+				t.Fatalf("request %d, unexpected error: %v", i, err)
+			}
+			urls = append(urls, e.URL)
+		}
+		if !cmp.Equal(urls, w.urls) {
+			t.Errorf("request %d, URLs = %v, want %v", i, urls, w.urls)
+		}
+	}
+
+	for _, topic := range []string{"events", "projects/p/topics/", "projects/p/subscriptions/s"} {
+		if _, err := NewPubSubSink(PubSubSinkConfig{Topic: topic, AccessToken: token}); err == nil {
+			t.Errorf("unexpected success with topic %q", topic)
+		}
+	}
+	if _, err := NewPubSubSink(PubSubSinkConfig{Topic: "projects/p/topics/t", AccessToken: token, BatchSize: MaxPubSubBatchSize + 1}); err == nil {
+		t.Error("unexpected success with a batch size over the limit")
+	}
+	if _, err := NewPubSubSink(PubSubSinkConfig{Topic: "projects/p/topics/t"}); err == nil {
+		t.Error("unexpected success without access token")
+	}
+}
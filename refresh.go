@@ -0,0 +1,106 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// DefaultCacheRefreshMinHits is the default number of cache hits after which
+// a hash prefix is refreshed in the background with Config.CacheRefreshAhead.
+const DefaultCacheRefreshMinHits = 10
+
+// hotPrefixes counts the positive cache hits of hash prefixes, to refresh the
+// hot ones before their cache entries expire.
+type hotPrefixes struct {
+	mu       sync.Mutex
+	prefixes map[hashPrefix]*hotPrefix
+}
+
+// hotPrefix is a hash prefix whose full hashes were answered by the cache.
+type hotPrefix struct {
+	hits       int
+	refreshing bool // Whether a refresh is in flight
+}
+
+// noteCacheHit records a positive cache hit of a full hash starting with
+// prefix, looked up for the threat types tds, whose cache entry expires at
+// expire. It refreshes prefix in the background if it is hot and expire is
+// within Config.CacheRefreshAhead.
+func (wr *UpdateClient) noteCacheHit(prefix hashPrefix, tds []ThreatType, expire time.Time) {
+	if wr.config.CacheRefreshAhead <= 0 {
+		return
+	}
+	wr.hot.mu.Lock()
+	if wr.hot.prefixes == nil {
+		wr.hot.prefixes = make(map[hashPrefix]*hotPrefix)
+	}
+	h := wr.hot.prefixes[prefix]
+	if h == nil {
+		h = new(hotPrefix)
+		wr.hot.prefixes[prefix] = h
+	}
+	h.hits++
+	due := h.hits >= wr.config.CacheRefreshMinHits && !h.refreshing &&
+		expire.Sub(wr.config.now()) < wr.config.CacheRefreshAhead
+	if due {
+		h.refreshing = true
+	}
+	wr.hot.mu.Unlock()
+	if due && atomic.LoadUint32(&wr.closed) == 0 {
+		go wr.refreshPrefix(prefix, tds)
+	}
+}
+
+// refreshPrefix searches prefix with the Web Risk API and caches the result,
+// then resets its count of hits.
+func (wr *UpdateClient) refreshPrefix(prefix hashPrefix, tds []ThreatType) {
+	ctx, cancel := context.WithTimeout(context.Background(), wr.config.RequestTimeout)
+	defer cancel()
+	tts := make([]pb.ThreatType, len(tds))
+	for i, td := range tds {
+		tts[i] = pb.ThreatType(td)
+	}
+	resp, err := wr.hashLookup(ctx, []byte(prefix), tts)
+	if err != nil {
+		wr.log.Printf("cache refresh failure: %v", err)
+		atomic.AddInt64(&wr.stats.CacheRefreshFails, 1)
+	} else {
+		threats, nttl := cacheEntries(resp, wr.config.now())
+		wr.c.Set(ctx, []byte(prefix), threats, nttl)
+		atomic.AddInt64(&wr.stats.CacheRefreshes, 1)
+	}
+	wr.hot.mu.Lock()
+	delete(wr.hot.prefixes, prefix)
+	wr.hot.mu.Unlock()
+}
+
+// pruneHotPrefixes forgets the hits of the hash prefixes not being refreshed,
+// so that prefixes must be hot again within every update period to be
+// refreshed.
+func (wr *UpdateClient) pruneHotPrefixes() {
+	wr.hot.mu.Lock()
+	defer wr.hot.mu.Unlock()
+	for prefix, h := range wr.hot.prefixes {
+		if !h.refreshing {
+			delete(wr.hot.prefixes, prefix)
+		}
+	}
+}
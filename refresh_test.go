@@ -0,0 +1,101 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestCacheRefresh(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	var lookups int64
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			prefixes := hashPrefixes{fullHash[:4]}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: prefixes.SHA256()},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			atomic.AddInt64(&lookups, 1)
+			return &pb.SearchHashesResponse{
+				Threats: []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(now.Add(30 * time.Second)),
+				}},
+				NegativeExpireTime: timepb.New(now.Add(30 * time.Second)),
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists:         []ThreatType{ThreatTypeMalware},
+		CacheRefreshAhead:   time.Minute,
+		CacheRefreshMinHits: 2,
+		api:                 api,
+		now:                 func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The first lookup queries the API, and the second hit of the cache
+	// refreshes the prefix as it expires within CacheRefreshAhead.
+	for i, want := range []LookupSource{SourceAPI, SourceCache, SourceCache} {
+		results, err := wr.LookupURLResults(context.Background(), []string{"http://bad.example.com/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if results[0].Source != want || len(results[0].Threats) != 1 {
+			t.Errorf("lookup %d, LookupURLResults() = %+v, want a threat from %v", i, results[0], want)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, _ := wr.Status()
+		if stats.CacheRefreshes == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CacheRefreshes = %d, want 1", stats.CacheRefreshes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt64(&lookups); got != 2 {
+		t.Errorf("API lookups = %d, want 2", got)
+	}
+	wr.hot.mu.Lock()
+	if n := len(wr.hot.prefixes); n != 0 {
+		t.Errorf("%d hot prefixes after the refresh, want 0", n)
+	}
+	wr.hot.mu.Unlock()
+}
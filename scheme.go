@@ -0,0 +1,107 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/webrisk/urls"
+)
+
+// ErrUnsupportedScheme is wrapped by the errors of lookups of URLs whose
+// scheme is neither http nor https under SchemeError.
+var ErrUnsupportedScheme = errors.New("webrisk: unsupported URL scheme")
+
+// SchemePolicy is how lookups treat the URLs whose scheme is neither http nor
+// https, such as ftp:, data:, javascript: or intent: URLs. URLs without a
+// scheme are always looked up as http URLs.
+type SchemePolicy int
+
+// List of SchemePolicy constants.
+const (
+	// SchemeLookup looks up the URLs of other schemes like http URLs if they
+	// have a host, such as ftp://example.com/, and fails on the others, such
+	// as javascript: URLs. This is the default.
+	SchemeLookup SchemePolicy = iota
+
+	// SchemeSkip does not look up the URLs of other schemes, and reports
+	// them as unsupported in their URLResult.
+	SchemeSkip
+
+	// SchemeError fails the lookups of URLs of other schemes with an error
+	// wrapping ErrUnsupportedScheme.
+	SchemeError
+
+	// SchemeNormalize looks up the http or https URL that URLs of other
+	// schemes stand for, such as the URL wrapped by a view-source: URL or
+	// the web URL of an intent: URL, and reports the others as unsupported
+	// like SchemeSkip. See urls.Unwrap for the URLs normalized.
+	SchemeNormalize
+)
+
+var schemePolicyNames = [...]string{
+	SchemeLookup:    "lookup",
+	SchemeSkip:      "skip",
+	SchemeError:     "error",
+	SchemeNormalize: "normalize",
+}
+
+func (p SchemePolicy) String() string {
+	if p < 0 || int(p) >= len(schemePolicyNames) {
+		return fmt.Sprintf("SchemePolicy(%d)", int(p))
+	}
+	return schemePolicyNames[p]
+}
+
+// ParseSchemePolicy returns the policy named name: lookup, skip, error or
+// normalize. It is used to load command line arguments.
+func ParseSchemePolicy(name string) (SchemePolicy, error) {
+	for p, n := range schemePolicyNames {
+		if n == name {
+			return SchemePolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("webrisk: unknown scheme policy %q, want lookup, skip, error or normalize", name)
+}
+
+// apply returns the URL to look up for url under p, or reports that url is
+// unsupported and must not be looked up, or fails.
+func (p SchemePolicy) apply(url string) (target string, unsupported bool, err error) {
+	scheme := urls.Scheme(url)
+	if scheme == "" || scheme == "http" || scheme == "https" {
+		return url, false, nil
+	}
+	switch p {
+	case SchemeSkip:
+		return "", true, nil
+	case SchemeError:
+		return "", false, fmt.Errorf("%w: %s", ErrUnsupportedScheme, scheme)
+	case SchemeNormalize:
+		if target, ok := urls.Unwrap(url); ok {
+			return target, false, nil
+		}
+		return "", true, nil
+	}
+	return url, false, nil
+}
+
+// ValidURL reports whether lookups accept url under p: like ValidURL, but
+// the URLs that p reports as unsupported are accepted too, and those it
+// fails are not.
+func (p SchemePolicy) ValidURL(url string) bool {
+	target, unsupported, err := p.apply(url)
+	return err == nil && (unsupported || ValidURL(target))
+}
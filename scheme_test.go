@@ -0,0 +1,113 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestSchemePolicy(t *testing.T) {
+	vectors := []struct {
+		policy      SchemePolicy
+		url         string
+		target      string
+		unsupported bool
+		err         error
+	}{
+		{SchemeSkip, "example.com/", "example.com/", false, nil},
+		{SchemeError, "HTTPS://example.com/", "HTTPS://example.com/", false, nil},
+		{SchemeLookup, "ftp://example.com/", "ftp://example.com/", false, nil},
+		{SchemeLookup, "javascript:alert(1)", "javascript:alert(1)", false, nil},
+		{SchemeSkip, "ftp://example.com/", "", true, nil},
+		{SchemeSkip, "data:text/html,hello", "", true, nil},
+		{SchemeError, "javascript:alert(1)", "", false, ErrUnsupportedScheme},
+		{SchemeNormalize, "view-source:http://example.com/", "http://example.com/", false, nil},
+		{SchemeNormalize, "intent://example.com/#Intent;scheme=https;end", "https://example.com/", false, nil},
+		{SchemeNormalize, "javascript:alert(1)", "", true, nil},
+	}
+	for i, v := range vectors {
+		target, unsupported, err := v.policy.apply(v.url)
+		if target != v.target || unsupported != v.unsupported || !errors.Is(err, v.err) {
+			t.Errorf("test %d, %v.apply(%q) = (%q, %v, %v), want (%q, %v, %v)", i, v.policy, v.url, target, unsupported, err, v.target, v.unsupported, v.err)
+		}
+	}
+
+	for p := SchemeLookup; p <= SchemeNormalize; p++ {
+		if got, err := ParseSchemePolicy(p.String()); got != p || err != nil {
+			t.Errorf("ParseSchemePolicy(%q) = (%v, %v), want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParseSchemePolicy("ignore"); err == nil {
+		t.Errorf("ParseSchemePolicy(%q) succeeded, want error", "ignore")
+	}
+}
+
+func TestLookupUnsupportedURLs(t *testing.T) {
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+	urls := []string{"http://example.com/", "data:text/html,hello", "view-source:http://example.com/"}
+	vectors := []struct {
+		policy      SchemePolicy
+		unsupported []bool
+		err         error
+	}{
+		{SchemeSkip, []bool{false, true, true}, nil},
+		{SchemeNormalize, []bool{false, true, false}, nil},
+		{SchemeError, nil, ErrUnsupportedScheme},
+	}
+	for i, v := range vectors {
+		wr, err := NewUpdateClient(Config{
+			ThreatLists:  []ThreatType{ThreatTypeMalware},
+			SchemePolicy: v.policy,
+			api:          api,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := wr.WaitUntilReady(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results, err := wr.LookupURLResults(context.Background(), urls)
+		wr.Close()
+		if !errors.Is(err, v.err) {
+			t.Errorf("test %d, LookupURLResults() error = %v, want %v", i, err, v.err)
+		}
+		if err != nil {
+			continue
+		}
+		for j, r := range results {
+			if r.Unsupported != v.unsupported[j] {
+				t.Errorf("test %d, LookupURLResults()[%d].Unsupported = %v, want %v", i, j, r.Unsupported, v.unsupported[j])
+			}
+		}
+	}
+
+	if _, err := NewUpdateClient(Config{SchemePolicy: SchemeNormalize + 1}); err == nil {
+		t.Errorf("NewUpdateClient() succeeded with an invalid scheme policy")
+	}
+}
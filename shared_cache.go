@@ -0,0 +1,166 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStore is a key-value store, like Redis or memcached, holding the
+// entries of a Cache shared by several clients, such as the replicas of a
+// horizontally scaled service, so that they do not each query the Web Risk
+// API for the same hash prefixes.
+//
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored under key, or nil if there is none.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value under key until ttl has elapsed.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// sharedCacheKeyPrefix prefixes the keys of the entries of the shared cache.
+const sharedCacheKeyPrefix = "webrisk:"
+
+// sharedCache is a Cache kept in a CacheStore. The results of the searches
+// of the hash prefixes starting with the same minHashPrefixLength bytes are
+// stored together, in the format of cache snapshots, so that every lookup
+// takes a single read of the store. Concurrent updates of an entry by
+// several clients may lose some of the results, which are then searched
+// again.
+type sharedCache struct {
+	store CacheStore
+	now   func() time.Time
+
+	hits   int64
+	errors int64
+}
+
+// NewSharedCache returns a Cache kept in store, and shared with the other
+// clients using the same store. The store is left to evict expired entries.
+// Errors of the store are reported as cache misses, and counted by
+// Stats.SharedCacheErrors.
+func NewSharedCache(store CacheStore) Cache {
+	return &sharedCache{store: store, now: time.Now}
+}
+
+// sharedCacheKey returns the key of the entry holding the results of the
+// searches of the hash prefixes starting like p.
+func sharedCacheKey(p hashPrefix) string {
+	return sharedCacheKeyPrefix + hex.EncodeToString([]byte(p[:minHashPrefixLength]))
+}
+
+// load returns the results stored in the entry of p as an in-memory cache,
+// which is empty if there are none or the store fails.
+func (c *sharedCache) load(ctx context.Context, p hashPrefix) *cache {
+	m := &cache{now: c.now}
+	b, err := c.store.Get(ctx, sharedCacheKey(p))
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+	if len(b) == 0 {
+		return m
+	}
+	var cf cacheFormat
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&cf); err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		return m
+	}
+	m.pttls, m.nttls = cf.PTTLs, cf.NTTLs
+	for fullHash := range m.pttls {
+		if !fullHash.IsFull() {
+			atomic.AddInt64(&c.errors, 1)
+			return &cache{now: c.now}
+		}
+		m.indexFullHash(fullHash)
+	}
+	return m
+}
+
+// Set implements Cache. The entry of prefix is kept in the store until the
+// last of its results expires.
+func (c *sharedCache) Set(ctx context.Context, prefix []byte, threats []HashThreat, negativeExpire time.Time) {
+	p := hashPrefix(prefix)
+	if !p.IsValid() {
+		return
+	}
+	m := c.load(ctx, p)
+	m.Set(ctx, prefix, threats, negativeExpire)
+	m.Purge()
+
+	var expire time.Time
+	for _, threatTTLs := range m.pttls {
+		for _, pttl := range threatTTLs {
+			if pttl.After(expire) {
+				expire = pttl
+			}
+		}
+	}
+	for _, nttl := range m.nttls {
+		if nttl.After(expire) {
+			expire = nttl
+		}
+	}
+	ttl := expire.Sub(c.now())
+	if ttl <= 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cacheFormat{PTTLs: m.pttls, NTTLs: m.nttls}); err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		return
+	}
+	if err := c.store.Set(ctx, sharedCacheKey(p), buf.Bytes(), ttl); err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+// Get implements Cache.
+func (c *sharedCache) Get(ctx context.Context, fullHash []byte) ([]ThreatType, time.Time, bool) {
+	if !hashPrefix(fullHash).IsFull() {
+		return nil, time.Time{}, false
+	}
+	tds, ttl, ok := c.load(ctx, hashPrefix(fullHash)).Get(ctx, fullHash)
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	}
+	return tds, ttl, ok
+}
+
+// GetPrefix implements Cache.
+func (c *sharedCache) GetPrefix(ctx context.Context, prefix []byte) ([]HashThreat, time.Time, bool) {
+	if !hashPrefix(prefix).IsValid() {
+		return nil, time.Time{}, false
+	}
+	threats, nttl, ok := c.load(ctx, hashPrefix(prefix)).GetPrefix(ctx, prefix)
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	}
+	return threats, nttl, ok
+}
+
+// Purge implements Cache. It does nothing, since the store evicts the
+// expired entries.
+func (c *sharedCache) Purge() {}
+
+// Clear implements Cache. It does nothing and returns 0, since the entries
+// of the store are shared with other clients.
+func (c *sharedCache) Clear() int { return 0 }
@@ -0,0 +1,179 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+// mapStore is a CacheStore kept in memory.
+type mapStore struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+	fail    bool
+}
+
+func (s *mapStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return nil, errors.New("unavailable")
+	}
+	return s.entries[key], nil
+}
+
+func (s *mapStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	s.entries[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func TestSharedCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ctx := context.Background()
+	store := &mapStore{entries: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+	replicas := []*sharedCache{
+		{store: store, now: func() time.Time { return now }},
+		{store: store, now: func() time.Time { return now }},
+	}
+	replicas[0].Set(ctx, []byte("abcd"), []HashThreat{{
+		Hash:        []byte("abcd0123456789012345678901234567"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Hour),
+	}}, now.Add(2*time.Hour))
+	replicas[1].Set(ctx, []byte("abcde"), nil, now.Add(3*time.Hour))
+
+	// Both searches are stored in the same entry.
+	if got, want := store.ttls["webrisk:61626364"], 3*time.Hour; len(store.entries) != 1 || got != want {
+		t.Errorf("store TTLs = %v, want %v for the entry of abcd", store.ttls, want)
+	}
+	vectors := []struct {
+		hash    string
+		threats []ThreatType
+		expire  time.Time
+		ok      bool
+	}{
+		{"abcd0123456789012345678901234567", []ThreatType{ThreatTypeMalware}, now.Add(time.Hour), true},
+		{"abcdffffffffffffffffffffffffffff", nil, now.Add(2 * time.Hour), true},
+		{"abcdefffffffffffffffffffffffffff", nil, now.Add(3 * time.Hour), true},
+		{"bcdeffffffffffffffffffffffffffff", nil, time.Time{}, false},
+		{"abcd", nil, time.Time{}, false},
+	}
+	for i, v := range vectors {
+		threats, expire, ok := replicas[1].Get(ctx, []byte(v.hash))
+		if !cmp.Equal(threats, v.threats) || !expire.Equal(v.expire) || ok != v.ok {
+			t.Errorf("test %d, Get() = (%v, %v, %v), want (%v, %v, %v)", i, threats, expire, ok, v.threats, v.expire, v.ok)
+		}
+	}
+	threats, nttl, ok := replicas[0].GetPrefix(ctx, []byte("abcd"))
+	want := []HashThreat{{
+		Hash:        []byte("abcd0123456789012345678901234567"),
+		ThreatTypes: []ThreatType{ThreatTypeMalware},
+		ExpireTime:  now.Add(time.Hour),
+	}}
+	if !cmp.Equal(threats, want) || !nttl.Equal(now.Add(2*time.Hour)) || !ok {
+		t.Errorf("GetPrefix() = (%v, %v, %v), want (%v, %v, true)", threats, nttl, ok, want, now.Add(2*time.Hour))
+	}
+	if replicas[0].hits != 1 || replicas[1].hits != 3 {
+		t.Errorf("shared cache hits = %d, %d, want 1, 3", replicas[0].hits, replicas[1].hits)
+	}
+
+	// Expired results are dropped from the entry.
+	now = now.Add(150 * time.Minute)
+	replicas[0].Set(ctx, []byte("abcdf"), nil, now.Add(time.Minute))
+	if _, _, ok := replicas[0].GetPrefix(ctx, []byte("abcd")); ok {
+		t.Errorf("unexpected GetPrefix() hit of expired results")
+	}
+	if got, want := store.ttls["webrisk:61626364"], 30*time.Minute; got != want {
+		t.Errorf("store TTL = %v, want %v", got, want)
+	}
+
+	// Errors of the store are cache misses.
+	store.fail = true
+	replicas[0].Set(ctx, []byte("abcdf"), nil, now.Add(time.Minute))
+	if _, _, ok := replicas[0].Get(ctx, []byte("abcdffffffffffffffffffffffffffff")); ok {
+		t.Errorf("unexpected Get() hit with a failing store")
+	}
+	if replicas[0].errors != 3 {
+		t.Errorf("shared cache errors = %d, want 3", replicas[0].errors)
+	}
+}
+
+func TestConfigSharedCache(t *testing.T) {
+	lookups := 0
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			prefixes := hashPrefixes{hashFromPattern("example.com/")[:4]}
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{Sha256: prefixes.SHA256()},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			lookups++
+			return &pb.SearchHashesResponse{NegativeExpireTime: timepb.New(time.Now().Add(time.Hour))}, nil
+		},
+	}
+	store := &mapStore{entries: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+
+	// The second replica is answered by the cache filled by the first.
+	for i, want := range []LookupSource{SourceAPI, SourceCache} {
+		wr, err := NewUpdateClient(Config{
+			ThreatLists: []ThreatType{ThreatTypeMalware},
+			Cache:       NewSharedCache(store),
+			api:         api,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer wr.Close()
+		if err := wr.WaitUntilReady(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results, err := wr.LookupURLResults(context.Background(), []string{"http://example.com/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if results[0].Source != want {
+			t.Errorf("replica %d, source = %v, want %v", i, results[0].Source, want)
+		}
+		if stats, _ := wr.Status(); stats.SharedCacheHits != int64(i) {
+			t.Errorf("replica %d, SharedCacheHits = %d, want %d", i, stats.SharedCacheHits, i)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("got %d API lookups, want 1", lookups)
+	}
+}
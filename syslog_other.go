@@ -0,0 +1,37 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+package webrisk
+
+import "errors"
+
+// SyslogSink writes events to the local syslog daemon, which is not supported
+// on this platform.
+type SyslogSink struct{}
+
+// NewSyslogSink returns an error as syslog is not supported on this platform.
+func NewSyslogSink(tag string, hashURLs bool) (*SyslogSink, error) {
+	return nil, errors.New("webrisk: syslog is not supported on this platform")
+}
+
+// Emit does nothing.
+func (s *SyslogSink) Emit(e Event) {}
+
+// Stats returns empty statistics.
+func (s *SyslogSink) Stats() SinkStats { return SinkStats{} }
+
+// Close does nothing.
+func (s *SyslogSink) Close() error { return nil }
@@ -0,0 +1,76 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package webrisk
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"sync/atomic"
+)
+
+// SyslogSink writes events to the local syslog daemon as JSON objects.
+// Errors are logged with the error severity, detections with the warning
+// severity and updates with the informational severity.
+type SyslogSink struct {
+	w        *syslog.Writer
+	hashURLs bool
+	stats    sinkStats
+}
+
+// NewSyslogSink returns a sink writing events to the local syslog daemon with
+// the given tag, with the daemon facility. If hashURLs is set, the URLs of
+// the events are replaced by their hash.
+func NewSyslogSink(tag string, hashURLs bool) (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w, hashURLs: hashURLs}, nil
+}
+
+// Emit writes e.
+func (s *SyslogSink) Emit(e Event) {
+	if s.hashURLs {
+		e = e.hashURL()
+	}
+	b, err := json.Marshal(e)
+	if err == nil {
+		switch e.Type {
+		case EventError:
+			err = s.w.Err(string(b))
+		case EventDetection:
+			err = s.w.Warning(string(b))
+		default:
+			err = s.w.Info(string(b))
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&s.stats.failed, 1)
+		return
+	}
+	atomic.AddInt64(&s.stats.sent, 1)
+}
+
+// Stats returns the current delivery statistics.
+func (s *SyslogSink) Stats() SinkStats {
+	return s.stats.snapshot()
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
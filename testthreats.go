@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/webrisk/urls"
+)
+
+// ErrTestThreatsDisabled is returned by InjectTestThreats unless
+// Config.TestThreats is set.
+var ErrTestThreatsDisabled = errors.New("webrisk: test threats are disabled")
+
+// TestThreat is a URL reported unsafe by lookups once injected with
+// InjectTestThreats, along with the URLs under it, such as
+// http://unsafe.test/page for http://unsafe.test/.
+type TestThreat struct {
+	URL        string
+	ThreatType ThreatType
+}
+
+// testThreats holds the injected test threats by the full hash of the
+// expression of their URL.
+type testThreats struct {
+	mu      sync.RWMutex
+	threats []TestThreat
+	hashes  map[hashPrefix][]ThreatType
+}
+
+// lookup returns the threat types injected for fullHash.
+func (tt *testThreats) lookup(fullHash hashPrefix) []ThreatType {
+	tt.mu.RLock()
+	defer tt.mu.RUnlock()
+	return tt.hashes[fullHash]
+}
+
+// testThreatHash returns the full hash of the expression of url made of its
+// exact host, path and query, which matches url and the URLs under it.
+func testThreatHash(url string) (hashPrefix, error) {
+	hosts, err := urls.Hosts(url, urls.Limits{})
+	if err != nil {
+		return "", err
+	}
+	paths, err := urls.Paths(url, urls.Limits{})
+	if err != nil {
+		return "", err
+	}
+	return hashFromPattern(hosts[0] + paths[len(paths)-1]), nil
+}
+
+// InjectTestThreats adds threats to those reported by lookups in addition to
+// the threat lists, so that end-to-end pipelines can verify how unsafe URLs
+// are handled with harmless URLs, such as under the reserved .test top level
+// domain. Lookups report them as answered by the database, without querying
+// the cache or the Web Risk API. Test threats are kept in memory only, until
+// ClearTestThreats is called.
+//
+// It returns ErrTestThreatsDisabled unless Config.TestThreats is set, so that
+// production clients cannot be made to block arbitrary URLs.
+func (wr *UpdateClient) InjectTestThreats(threats ...TestThreat) error {
+	if !wr.config.TestThreats {
+		return ErrTestThreatsDisabled
+	}
+	hashes := make([]hashPrefix, len(threats))
+	for i, t := range threats {
+		if !wr.lists[t.ThreatType] {
+			return fmt.Errorf("webrisk: test threat type %v is not a configured threat list", t.ThreatType)
+		}
+		h, err := testThreatHash(t.URL)
+		if err != nil {
+			return fmt.Errorf("webrisk: invalid test threat URL %q: %v", t.URL, err)
+		}
+		hashes[i] = h
+	}
+
+	wr.test.mu.Lock()
+	defer wr.test.mu.Unlock()
+	if wr.test.hashes == nil {
+		wr.test.hashes = make(map[hashPrefix][]ThreatType)
+	}
+next:
+	for i, t := range threats {
+		for _, td := range wr.test.hashes[hashes[i]] {
+			if td == t.ThreatType {
+				continue next
+			}
+		}
+		wr.test.hashes[hashes[i]] = append(wr.test.hashes[hashes[i]], t.ThreatType)
+		wr.test.threats = append(wr.test.threats, t)
+	}
+	return nil
+}
+
+// TestThreats returns the threats injected with InjectTestThreats.
+func (wr *UpdateClient) TestThreats() []TestThreat {
+	wr.test.mu.RLock()
+	defer wr.test.mu.RUnlock()
+	return append([]TestThreat(nil), wr.test.threats...)
+}
+
+// ClearTestThreats removes every threat injected with InjectTestThreats, and
+// returns how many there were.
+func (wr *UpdateClient) ClearTestThreats() int {
+	wr.test.mu.Lock()
+	defer wr.test.mu.Unlock()
+	n := len(wr.test.threats)
+	wr.test.threats, wr.test.hashes = nil, nil
+	return n
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+)
+
+func TestInjectTestThreats(t *testing.T) {
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+	newClient := func(enabled bool) *UpdateClient {
+		wr, err := NewUpdateClient(Config{
+			ThreatLists: []ThreatType{ThreatTypeMalware, ThreatTypeSocialEngineering},
+			TestThreats: enabled,
+			api:         api,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := wr.WaitUntilReady(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return wr
+	}
+
+	wr := newClient(false)
+	err := wr.InjectTestThreats(TestThreat{URL: "http://unsafe.test/", ThreatType: ThreatTypeMalware})
+	wr.Close()
+	if !errors.Is(err, ErrTestThreatsDisabled) {
+		t.Errorf("InjectTestThreats() error = %v, want %v", err, ErrTestThreatsDisabled)
+	}
+
+	wr = newClient(true)
+	defer wr.Close()
+	if err := wr.InjectTestThreats(TestThreat{URL: "http://unsafe.test/", ThreatType: ThreatTypeUnwantedSoftware}); err == nil {
+		t.Errorf("InjectTestThreats() succeeded with an unconfigured threat list")
+	}
+	if err := wr.InjectTestThreats(
+		TestThreat{URL: "http://unsafe.test/", ThreatType: ThreatTypeMalware},
+		TestThreat{URL: "http://phishing.test/login?user=1", ThreatType: ThreatTypeSocialEngineering},
+		TestThreat{URL: "http://unsafe.test/", ThreatType: ThreatTypeMalware},
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(wr.TestThreats()); n != 2 {
+		t.Errorf("len(TestThreats()) = %d, want 2", n)
+	}
+
+	vectors := []struct {
+		url    string
+		threat ThreatType // Zero if the URL is safe
+	}{
+		{"http://unsafe.test/", ThreatTypeMalware},
+		{"http://www.unsafe.test/page?q=1", ThreatTypeMalware},
+		{"http://phishing.test/login?user=1", ThreatTypeSocialEngineering},
+		{"http://phishing.test/login", 0},
+		{"http://safe.test/", 0},
+	}
+	for i, v := range vectors {
+		results, err := wr.LookupURLResults(context.Background(), []string{v.url})
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		r := results[0]
+		switch {
+		case v.threat == 0 && len(r.Threats) > 0:
+			t.Errorf("test %d, LookupURLResults(%q) = %v, want no threat", i, v.url, r.Threats)
+		case v.threat != 0 && (len(r.Threats) != 1 || r.Threats[0].ThreatType != v.threat):
+			t.Errorf("test %d, LookupURLResults(%q) = %v, want %v", i, v.url, r.Threats, v.threat)
+		case r.Source != SourceDatabase:
+			t.Errorf("test %d, LookupURLResults(%q).Source = %v, want %v", i, v.url, r.Source, SourceDatabase)
+		}
+	}
+
+	if n := wr.ClearTestThreats(); n != 2 {
+		t.Errorf("ClearTestThreats() = %d, want 2", n)
+	}
+	results, err := wr.LookupURLResults(context.Background(), []string{"http://unsafe.test/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results[0].Threats) > 0 {
+		t.Errorf("LookupURLResults() = %v after ClearTestThreats(), want no threat", results[0].Threats)
+	}
+}
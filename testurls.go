@@ -0,0 +1,75 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// testURLDomain is the reserved top level domain (RFC 2606) under which
+	// synthetic test URLs are generated, so that they never refer to a real
+	// and potentially malicious site.
+	testURLDomain = "test"
+
+	// maxTestURLAttempts bounds the number of candidate URLs tried for every
+	// requested test URL. Finding a URL that hits the database takes about
+	// 2**32 divided by the number of 4 byte prefixes in the database attempts.
+	maxTestURLAttempts = 1 << 20
+)
+
+// GenerateTestURLs returns n synthetic URLs under the reserved ".test" top
+// level domain. If hit is set, every URL matches a hash prefix in the local
+// database, and thus requires a cache or API lookup to get a verdict.
+// Otherwise every URL is guaranteed to be found safe by the database alone.
+//
+// This is intended for load testing both code paths without having to use
+// real malicious URLs. Since hits are found by brute force, generating them
+// takes longer the fewer hash prefixes the database has.
+func (wr *UpdateClient) GenerateTestURLs(n int, hit bool) ([]string, error) {
+	if err := wr.db.Status(); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return generateTestURLs(&wr.db, rng, n, hit)
+}
+
+// generateTestURLs generates n random test URLs and keeps those that hit
+// (or miss) the database.
+func generateTestURLs(db *database, rng *rand.Rand, n int, hit bool) ([]string, error) {
+	var urls []string
+	for attempts := 0; len(urls) < n; attempts++ {
+		if attempts >= n*maxTestURLAttempts {
+			return urls, errors.New("webrisk: unable to generate enough test URLs")
+		}
+		url := fmt.Sprintf("http://webrisk-%016x.%s/", rng.Uint64(), testURLDomain)
+		hashes, err := generateHashes(url, ExpressionLimits{})
+		if err != nil {
+			return urls, err
+		}
+		found := false
+		for fullHash := range hashes {
+			if _, tds := db.Lookup(fullHash); len(tds) > 0 {
+				found = true
+			}
+		}
+		if found == hit {
+			urls = append(urls, url)
+		}
+	}
+	return urls, nil
+}
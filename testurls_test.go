@@ -0,0 +1,62 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package webrisk
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateTestURLs(t *testing.T) {
+	db := &database{tfl: threatsForLookup{
+		ThreatTypeMalware: newHashSet([]hashPrefix{"aaaa", "bbbb"}),
+	}}
+
+	misses, err := generateTestURLs(db, rand.New(rand.NewSource(1)), 10, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(misses) != 10 {
+		t.Fatalf("len(misses) = %d, want 10", len(misses))
+	}
+
+	// Add the prefixes of the URLs that just missed to the database, so that
+	// regenerating from the same seed must hit every one of them.
+	var phs hashPrefixes
+	for i, u := range misses {
+		if !ValidURL(u) {
+			t.Errorf("test %d, invalid test URL: %q", i, u)
+		}
+		hashes, err := generateHashes(u, ExpressionLimits{})
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		for h := range hashes {
+			if _, tds := db.Lookup(h); len(tds) > 0 {
+				t.Errorf("test %d, URL %q unexpectedly hits the database", i, u)
+			}
+			phs = append(phs, h[:minHashPrefixLength])
+		}
+	}
+	db.tfl[ThreatTypeSocialEngineering] = newHashSet(phs)
+
+	hits, err := generateTestURLs(db, rand.New(rand.NewSource(1)), 10, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(hits, misses) {
+		t.Errorf("hits mismatch:\ngot  %q\nwant %q", hits, misses)
+	}
+}
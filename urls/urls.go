@@ -0,0 +1,704 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package urls implements the canonicalization of URLs and the generation of
+// their host-suffix and path-prefix expressions as done by the Web Risk and
+// Safe Browsing clients, so that other services can canonicalize URLs
+// identically without depending on the client.
+//
+// Expressions are all the possible host-suffix and path-prefix fragments for
+// the input URL. For example, the expressions of the given URL are the
+// following:
+//
+//	input: "http://a.b.c/1/2.html?param=1/2"
+//	patterns: [
+//		"a.b.c/1/2.html?param=1/2",
+//		"a.b.c/1/2.html",
+//		"a.b.c/1/",
+//		"a.b.c/",
+//		"b.c/1/2.html?param=1/2",
+//		"b.c/1/2.html",
+//		"b.c/1/",
+//		"b.c/"
+//	]
+//
+// The process that Web Risk uses predates Chrome and many RFC standards
+// and is partly based on how legacy browsers typically parse URLs. Thus, URLs
+// are parsed in a way that is not strictly standards compliant.
+package urls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/idna"
+
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Default limits on the expressions generated for a URL.
+const (
+	DefaultMaxHostComponents = 7
+	DefaultMaxPathComponents = 4
+)
+
+// Limits bounds the host-suffix and path-prefix expressions that are
+// generated for a URL. Lower limits trade coverage of deeply nested hosts and
+// paths for fewer hashes and lookups per URL. A zero field selects the
+// corresponding default limit.
+type Limits struct {
+	// MaxHostComponents is the maximum number of trailing host components
+	// used to form host suffixes. The exact host is always checked.
+	MaxHostComponents int
+
+	// MaxPathComponents is the maximum number of leading path components
+	// used to form path prefixes. The root path, the exact path, and the
+	// path with its query are always checked.
+	MaxPathComponents int
+}
+
+// withDefaults returns a copy of l with zero fields replaced by defaults.
+func (l Limits) withDefaults() Limits {
+	if l.MaxHostComponents <= 0 {
+		l.MaxHostComponents = DefaultMaxHostComponents
+	}
+	if l.MaxPathComponents <= 0 {
+		l.MaxPathComponents = DefaultMaxPathComponents
+	}
+	return l
+}
+
+var (
+	dotsRegexp          = regexp.MustCompile("[.]+")
+	portRegexp          = regexp.MustCompile(`:\d+$`)
+	possibleIPRegexp    = regexp.MustCompile(`^(?i)((?:0x[0-9a-f]+|[0-9\.])+)$`)
+	trailingSpaceRegexp = regexp.MustCompile(`^(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}) `)
+)
+
+// idnaProfile converts internationalized hostnames to ASCII as Chrome does:
+// with the non-transitional UTS #46 processing of IDNA2008 and the Bidi rule,
+// but without the STD3, hyphen and joiner checks, so that hostnames such as
+// those with underscores remain valid. The mapping lowercases the hostnames,
+// maps compatibility characters such as full-width letters and ideographic
+// full stops, and keeps deviation characters such as ß and ς rather than
+// transliterating them as IDNA2003 did.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+	idna.CheckJoiners(false),
+)
+
+// Valid parses the given string and returns true if it is a Web Risk
+// compatible URL.
+func Valid(url string) bool {
+	parsed, err := Parse(url)
+	return parsed != nil && err == nil
+}
+
+// Canonicalize returns url canonicalized as by lookups: with its host and
+// path normalized and its fragment removed, such as to compare it with other
+// Safe Browsing implementations. Unlike the expressions of the URL, it keeps
+// the scheme.
+func Canonicalize(url string) (string, error) {
+	parsed, err := Parse(url)
+	if err != nil {
+		return "", err
+	}
+	canonical := parsed.Scheme + "://" + parsed.Host + parsed.Path
+	if parsed.RawQuery != "" {
+		canonical += "?" + parsed.RawQuery
+	}
+	return canonical, nil
+}
+
+// Expressions returns all the host-suffix and path-prefix expressions of url
+// within limits, in the order they are looked up by the Web Risk clients.
+// The zero value of limits stands for the default limits.
+func Expressions(url string, limits Limits) ([]string, error) {
+	hosts, err := Hosts(url, limits)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := Paths(url, limits)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			patterns = append(patterns, h+p)
+		}
+	}
+	return patterns, nil
+}
+
+// isHex reports whether c is a hexadecimal character.
+func isHex(c byte) bool {
+	switch {
+	case '0' <= c && c <= '9':
+		return true
+	case 'a' <= c && c <= 'f':
+		return true
+	case 'A' <= c && c <= 'F':
+		return true
+	}
+	return false
+}
+
+// unhex converts a hexadecimal character to byte value in 0..15, inclusive.
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+// isUnicode reports whether s is a Unicode string.
+func isUnicode(s string) bool {
+	for _, c := range []byte(s) {
+		// For legacy reasons, 0x80 is not considered a Unicode character.
+		if c > 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// split splits the string s around the delimiter c.
+//
+// Let string s be of the form:
+//
+//	"%s%s%s" % (t, c, u)
+//
+// Then split returns (t, u) if cutc is set, otherwise, it returns (t, c+u).
+// If c does not exist in s, then (s, "") is returned.
+func split(s string, c string, cutc bool) (string, string) {
+	i := strings.Index(s, c)
+	if i < 0 {
+		return s, ""
+	}
+	if cutc {
+		return s[:i], s[i+len(c):]
+	}
+	return s[:i], s[i:]
+}
+
+// escape returns the percent-encoded form of the string s.
+func escape(s string) string {
+	var b bytes.Buffer
+	for _, c := range []byte(s) {
+		if c < 0x20 || c >= 0x7f || c == ' ' || c == '#' || c == '%' {
+			b.WriteString(fmt.Sprintf("%%%02X", c))
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescape returns the decoded form of a percent-encoded string s.
+func unescape(s string) string {
+	var b bytes.Buffer
+	for len(s) > 0 {
+		if len(s) >= 3 && s[0] == '%' && isHex(s[1]) && isHex(s[2]) {
+			b.WriteByte(unhex(s[1])<<4 | unhex(s[2]))
+			s = s[3:]
+		} else {
+			b.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	return b.String()
+}
+
+// recursiveUnescape unescapes the string s recursively until it cannot be
+// unescaped anymore. It reports an error if the unescaping process seemed to
+// have no end.
+func recursiveUnescape(s string) (string, error) {
+	const maxDepth = 1024
+	for i := 0; i < maxDepth; i++ {
+		t := unescape(s)
+		if t == s {
+			return s, nil
+		}
+		s = t
+	}
+	return "", errors.New("webrisk: unescaping is too recursive")
+}
+
+// normalizeEscape performs a recursive unescape and then escapes the string
+// exactly once. It reports an error if it was unable to unescape the string.
+func normalizeEscape(s string) (string, error) {
+	u, err := recursiveUnescape(s)
+	if err != nil {
+		return "", err
+	}
+	return escape(u), nil
+}
+
+// getScheme splits the url into (scheme, path) where scheme is the protocol.
+// If the scheme cannot be determined ("", url) is returned.
+func getScheme(url string) (scheme, path string) {
+	for i, c := range []byte(url) {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			// Do nothing.
+		case '0' <= c && c <= '9' || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return "", url
+			}
+		case c == ':':
+			return url[:i], url[i+1:]
+		default:
+			// Invalid character, so there is no valid scheme.
+			return "", url
+		}
+	}
+	return "", url
+}
+
+// parseHost parses a string to get host by the stripping the
+// username, password, and port.
+func parseHost(hostish string) (host string, err error) {
+	i := strings.LastIndex(hostish, "@")
+	if i < 0 {
+		host = hostish
+	} else {
+		host = hostish[i+1:]
+	}
+	if strings.HasPrefix(host, "[") {
+		// Parse an IP-Literal per RFC 3986 and RFC 6874.
+		// For example: "[fe80::1] or "[fe80::1%25en0]"
+		i := strings.LastIndex(host, "]")
+		if i < 0 {
+			return "", errors.New("webrisk: missing ']' in host")
+		}
+		if rest := host[i+1:]; rest != "" && !portRegexp.MatchString(rest) {
+			return "", errors.New("webrisk: invalid port")
+		}
+		return canonicalIPv6(host[1:i])
+	}
+	// Remove the port if it is there.
+	host = portRegexp.ReplaceAllString(host, "")
+
+	// Convert internationalized hostnames to IDNA. Hostnames with invalid
+	// labels are rejected, as browsers do not load them.
+	u := unescape(host)
+	if isUnicode(u) {
+		host, err = idnaProfile.ToASCII(u)
+		if err != nil {
+			return "", fmt.Errorf("webrisk: invalid internationalized hostname: %v", err)
+		}
+	}
+
+	// Remove any superfluous '.' characters in the hostname.
+	host = dotsRegexp.ReplaceAllString(host, ".")
+	host = strings.Trim(host, ".")
+	// Canonicalize IP addresses.
+	if iphost := parseIPAddress(host); iphost != "" {
+		host = iphost
+	} else {
+		// In order to properly escape urls, first get the unescaped
+		// version.
+		host, err = recursiveUnescape(host)
+		if err != nil {
+			return "", err
+		}
+		// Then apply a to lower but only to ascii characters [a-z|A-Z].
+		var tempHost bytes.Buffer
+		for _, c := range []byte(host) {
+			if (c >= 0x41 && c <= 0x5A) || (c >= 0x61 && c <= 0x7A) {
+				tempHost.WriteByte(byte(unicode.ToLower(rune(c))))
+			} else {
+				tempHost.WriteByte(c)
+			}
+		}
+		host = tempHost.String()
+
+		// Then escape the result.
+		host = escape(host)
+	}
+	return host, nil
+}
+
+// Parse parses urlStr as a url.URL with its host and path canonicalized, and
+// reports an error if not possible. The scheme defaults to http, and the
+// fragment is removed.
+func Parse(urlStr string) (parsedURL *url.URL, err error) {
+	// For legacy reasons, this is a simplified version of the net/url logic.
+	//
+	// Few cases where net/url was not helpful:
+	// 1. URLs are are expected to have no escaped encoding in the host but to
+	// be escaped in the path. Web Risk allows escaped characters in both.
+	// 2. Also it has different behavior with and without a scheme for absolute
+	// paths. Web Risk test web URLs only; and a scheme is optional.
+	// If missing, we assume that it is an "http".
+	// 3. We strip off the fragment and the escaped query as they are not
+	// required for building patterns for Web Risk.
+
+	parsedURL = new(url.URL)
+	// Remove the URL fragment.
+	// Also, we decode and encode the URL.
+	// The '#' in a fragment is not friendly to that.
+	rest, _ := split(urlStr, "#", true)
+	// Start by stripping any leading and trailing whitespace.
+	rest = strings.TrimSpace(rest)
+	// Remove any embedded tabs and CR/LF characters which aren't escaped.
+	rest = strings.Replace(rest, "\t", "", -1)
+	rest = strings.Replace(rest, "\r", "", -1)
+	rest = strings.Replace(rest, "\n", "", -1)
+	rest, err = normalizeEscape(rest)
+	if err != nil {
+		return nil, err
+	}
+	parsedURL.Scheme, rest = getScheme(rest)
+	rest, parsedURL.RawQuery = split(rest, "?", true)
+
+	// Add HTTP as scheme if none.
+	var hostish string
+	if !strings.HasPrefix(rest, "//") && parsedURL.Scheme != "" {
+		return nil, errors.New("webrisk: invalid path")
+	}
+	if parsedURL.Scheme == "" {
+		parsedURL.Scheme = "http"
+		hostish, rest = split(rest, "/", false)
+	} else {
+		hostish, rest = split(rest[2:], "/", false)
+	}
+	if hostish == "" {
+		return nil, errors.New("webrisk: missing hostname")
+	}
+
+	parsedURL.Host, err = parseHost(hostish)
+	if err != nil {
+		return nil, err
+	}
+	// Format the path.
+	p := path.Clean(rest)
+	if p == "." {
+		p = "/"
+	} else if rest[len(rest)-1] == '/' && p[len(p)-1] != '/' {
+		p += "/"
+	}
+	parsedURL.Path = p
+	return parsedURL, nil
+}
+
+// canonicalIPv6 returns the IP-literal of the IPv6 address s, given without
+// brackets, in the form serialized by browsers: bracketed, in lowercase
+// hexadecimal, with the longest run of two or more zero fields compressed and
+// without zone. Embedded IPv4 addresses are serialized in hexadecimal too, so
+// that "[::ffff:1.2.3.4]" becomes "[::ffff:102:304]".
+func canonicalIPv6(s string) (string, error) {
+	// Zones only make sense on the local host, as in "[fe80::1%25en0]".
+	if i := strings.Index(s, "%"); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || !strings.Contains(s, ":") {
+		return "", errors.New("webrisk: invalid IPv6 address")
+	}
+	var fields [8]uint16
+	for i := range fields {
+		fields[i] = uint16(ip[2*i])<<8 | uint16(ip[2*i+1])
+	}
+	// Find the longest run of zero fields, the first one if there are ties.
+	start, n := -1, 1
+	for i := 0; i < len(fields); {
+		j := i
+		for j < len(fields) && fields[j] == 0 {
+			j++
+		}
+		if j-i > n {
+			start, n = i, j-i
+		}
+		i = j + 1
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < len(fields); i++ {
+		if i == start {
+			b.WriteString("::")
+			i += n - 1
+			continue
+		}
+		if i > 0 && i != start+n {
+			b.WriteByte(':')
+		}
+		b.WriteString(strconv.FormatUint(uint64(fields[i]), 16))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func parseIPAddress(iphostname string) string {
+	// The Windows resolver allows a 4-part dotted decimal IP address to have a
+	// space followed by any old rubbish, so long as the total length of the
+	// string doesn't get above 15 characters. So, "10.192.95.89 xy" is
+	// resolved to 10.192.95.89. If the string length is greater than 15
+	// characters, e.g. "10.192.95.89 xy.wildcard.example.com", it will be
+	// resolved through DNS.
+	if len(iphostname) <= 15 {
+		match := trailingSpaceRegexp.FindString(iphostname)
+		if match != "" {
+			iphostname = strings.TrimSpace(match)
+		}
+	}
+	if !possibleIPRegexp.MatchString(iphostname) {
+		return ""
+	}
+	parts := strings.Split(iphostname, ".")
+	if len(parts) > 4 {
+		return ""
+	}
+	ss := make([]string, len(parts))
+	for i, n := range parts {
+		if i == len(parts)-1 {
+			ss[i] = canonicalNum(n, 5-len(parts))
+		} else {
+			ss[i] = canonicalNum(n, 1)
+		}
+		if ss[i] == "" {
+			return ""
+		}
+	}
+	return strings.Join(ss, ".")
+}
+
+// canonicalNum parses s as an integer and attempts to encode it as a '.'
+// separated string where each element is the base-10 encoded value of each byte
+// for the corresponding number, starting with the MSB. The result is one that
+// is usable as an IP address.
+//
+// For example:
+//
+//	s:"01234",      n:2  =>  "2.156"
+//	s:"0x10203040", n:4  =>  "16.32.48.64"
+func canonicalNum(s string, n int) string {
+	if n <= 0 || n > 4 {
+		return ""
+	}
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return ""
+	}
+	ss := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		ss[i] = strconv.Itoa(int(v) & 0xff)
+		v = v >> 8
+	}
+	return strings.Join(ss, ".")
+}
+
+// canonicalURL parses a URL string and returns it as scheme://hostname/path.
+// It strips off fragments and queries.
+func canonicalURL(u string) (string, error) {
+	parsedURL, err := Parse(u)
+	if err != nil {
+		return "", err
+	}
+	// Assemble the URL ourselves to skip encodings from the net/url package.
+	u = parsedURL.Scheme + "://" + parsedURL.Host
+	if parsedURL.Path == "" {
+		return u + "/", nil
+	}
+	u += parsedURL.Path
+	return u, nil
+}
+
+func canonicalHost(urlStr string) (string, error) {
+	parsedURL, err := Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	return parsedURL.Host, nil
+}
+
+// Scheme returns the lowercase scheme of url, or an empty string if it has
+// none, in which case it is handled as an http URL.
+func Scheme(url string) string {
+	scheme, _ := getScheme(strings.TrimSpace(url))
+	return strings.ToLower(scheme)
+}
+
+// Unwrap returns the http or https URL that url, of another scheme, stands
+// for, and whether there is one: the URL wrapped by view-source:, blob: and
+// filesystem: URLs, and the URL loaded by browsers for Android intent: URLs,
+// which is either their host and path with the http or https scheme given in
+// their fragment, or their browser fallback URL.
+func Unwrap(url string) (string, bool) {
+	scheme, rest := getScheme(strings.TrimSpace(url))
+	switch strings.ToLower(scheme) {
+	case "view-source", "blob", "filesystem":
+		if s := Scheme(rest); s == "http" || s == "https" {
+			return rest, true
+		}
+	case "intent":
+		target, fragment := split(rest, "#", true)
+		var webScheme, fallback string
+		for _, param := range strings.Split(strings.TrimSuffix(fragment, ";end"), ";") {
+			name, value := split(param, "=", true)
+			switch name {
+			case "scheme":
+				webScheme = strings.ToLower(value)
+			case "S.browser_fallback_url":
+				fallback = unescape(value)
+			}
+		}
+		if (webScheme == "http" || webScheme == "https") && strings.HasPrefix(target, "//") {
+			return webScheme + ":" + target, true
+		}
+		if s := Scheme(fallback); s == "http" || s == "https" {
+			return fallback, true
+		}
+	}
+	return "", false
+}
+
+// HashPrefixLength is the length of the hash prefixes of expressions sent to
+// the Web Risk API, and the shortest one stored in threat lists.
+const HashPrefixLength = 4
+
+// ExpressionHash is an expression of a URL and its hash, as looked up in the
+// threat lists.
+type ExpressionHash struct {
+	Expression string
+	Hash       [sha256.Size]byte // Full SHA-256 hash of Expression
+}
+
+// Prefix returns the HashPrefixLength-byte prefix of the hash.
+func (h ExpressionHash) Prefix() []byte {
+	return h.Hash[:HashPrefixLength]
+}
+
+// ComputeHashes returns the expressions of url within limits, in the order
+// they are looked up, with their hash. The zero value of limits stands for the
+// default limits.
+func ComputeHashes(url string, limits Limits) ([]ExpressionHash, error) {
+	patterns, err := Expressions(url, limits)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]ExpressionHash, len(patterns))
+	for i, p := range patterns {
+		hashes[i] = ExpressionHash{Expression: p, Hash: sha256.Sum256([]byte(p))}
+	}
+	return hashes, nil
+}
+
+// Hosts returns the host suffixes of the input URL within limits, starting
+// with its exact host.
+func Hosts(urlStr string, limits Limits) ([]string, error) {
+	// Web Risk policy asks to generate lookup hosts for the URL.
+	// Those are formed by the domain and also up to 4 hostnames suffixes.
+	// The last component or sometimes the pair isn't examined alone,
+	// since it's the TLD or country code. The database for TLDs is here:
+	//	https://publicsuffix.org/list/
+	//
+	// Note that we do not need to be clever about stopping at the "real" TLD.
+	// We just check a few extra components regardless. It's not significantly
+	// slower on the server side to check some extra hashes. Also the client
+	// does not need to keep a database of TLDs.
+	maxHostComponents := limits.withDefaults().MaxHostComponents
+
+	host, err := canonicalHost(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	// handle IPv4 and IPv6 addresses. IPv4-mapped IPv6 addresses are also
+	// looked up as the IPv4 address they stand for, which is how threat lists
+	// hold them.
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip != nil {
+		if ip4 := ip.To4(); ip4 != nil && strings.HasPrefix(host, "[") {
+			return []string{host, ip4.String()}, nil
+		}
+		return []string{host}, nil
+	}
+	hostComponents := strings.Split(host, ".")
+
+	numComponents := len(hostComponents) - maxHostComponents
+	if numComponents < 1 {
+		numComponents = 1
+	}
+
+	hosts := []string{host}
+	for i := numComponents; i < len(hostComponents)-1; i++ {
+		hosts = append(hosts, strings.Join(hostComponents[i:], "."))
+	}
+	return hosts, nil
+}
+
+func canonicalPath(urlStr string) (string, error) {
+	// Note that this function is not used, but remains to ensure that the
+	// parsedURL.Path output matches C++ implementation.
+	parsedURL, err := Parse(urlStr)
+	if err != nil {
+		return "", err
+	}
+	return parsedURL.Path, nil
+}
+
+// Paths returns the path prefixes of the input URL within limits, starting
+// with the root path.
+func Paths(urlStr string, limits Limits) ([]string, error) {
+	maxPathComponents := limits.withDefaults().MaxPathComponents
+
+	parsedURL, err := Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	path := parsedURL.Path
+
+	paths := []string{"/"}
+	var pathComponents []string
+	for _, p := range strings.Split(path, "/") {
+		if p != "" {
+			pathComponents = append(pathComponents, p)
+		}
+	}
+
+	numComponents := len(pathComponents)
+	if numComponents > maxPathComponents {
+		numComponents = maxPathComponents
+	}
+
+	for i := 1; i < numComponents; i++ {
+		paths = append(paths, "/"+strings.Join(pathComponents[:i], "/")+"/")
+	}
+	if path != "/" {
+		paths = append(paths, path)
+	}
+	if len(parsedURL.RawQuery) > 0 {
+		paths = append(paths, path+"?"+parsedURL.RawQuery)
+	}
+	return paths, nil
+}
@@ -11,16 +11,18 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
-package webrisk
+
+package urls
 
 import (
+	"encoding/hex"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
 )
 
-func TestGeneratePatterns(t *testing.T) {
+func TestExpressions(t *testing.T) {
 	vectors := []struct {
 		url    string
 		output []string
@@ -49,6 +51,9 @@ func TestGeneratePatterns(t *testing.T) {
 	}, {
 		url:    "http://1.2.3.4/a/b",
 		output: []string{"1.2.3.4/a/b", "1.2.3.4/a/", "1.2.3.4/"},
+	}, {
+		url:    "http://[::ffff:1.2.3.4]/a",
+		output: []string{"[::ffff:102:304]/a", "[::ffff:102:304]/", "1.2.3.4/a", "1.2.3.4/"},
 	}, {
 		url:    "http://a.b/",
 		output: []string{"a.b/"},
@@ -70,7 +75,7 @@ func TestGeneratePatterns(t *testing.T) {
 	}}
 
 	for i, v := range vectors {
-		patterns, err := generatePatterns(v.url)
+		patterns, err := Expressions(v.url, Limits{})
 		if err != nil != v.fail {
 			if err != nil {
 				t.Errorf("test %d, unexpected error: %v", i, err)
@@ -82,7 +87,47 @@ func TestGeneratePatterns(t *testing.T) {
 		sort.Strings(patterns)
 		sort.Strings(v.output)
 		if !reflect.DeepEqual(patterns, v.output) {
-			t.Errorf("test %d, generatePatterns(%q):\ngot  %q\nwant %q", i, v.url, patterns, v.output)
+			t.Errorf("test %d, Expressions(%q):\ngot  %q\nwant %q", i, v.url, patterns, v.output)
+		}
+	}
+}
+
+func TestExpressionsLimits(t *testing.T) {
+	vectors := []struct {
+		url    string
+		limits Limits
+		output []string
+	}{{
+		url:    "http://a.b.c.d.e.f.g.h.i/1/2/3/4.html",
+		limits: Limits{MaxHostComponents: 3, MaxPathComponents: 2},
+		output: []string{
+			"a.b.c.d.e.f.g.h.i/", "a.b.c.d.e.f.g.h.i/1/", "a.b.c.d.e.f.g.h.i/1/2/3/4.html",
+			"g.h.i/", "g.h.i/1/", "g.h.i/1/2/3/4.html",
+			"h.i/", "h.i/1/", "h.i/1/2/3/4.html",
+		},
+	}, {
+		url:    "http://a.b.c/1/2.html?param=1/2",
+		limits: Limits{MaxHostComponents: 1, MaxPathComponents: 1},
+		output: []string{"a.b.c/", "a.b.c/1/2.html", "a.b.c/1/2.html?param=1/2"},
+	}, {
+		url:    "http://a.b.c/1/2/3/4/5/6/",
+		limits: Limits{MaxPathComponents: 6},
+		output: []string{
+			"a.b.c/", "a.b.c/1/", "a.b.c/1/2/", "a.b.c/1/2/3/", "a.b.c/1/2/3/4/", "a.b.c/1/2/3/4/5/", "a.b.c/1/2/3/4/5/6/",
+			"b.c/", "b.c/1/", "b.c/1/2/", "b.c/1/2/3/", "b.c/1/2/3/4/", "b.c/1/2/3/4/5/", "b.c/1/2/3/4/5/6/",
+		},
+	}}
+
+	for i, v := range vectors {
+		patterns, err := Expressions(v.url, v.limits)
+		if err != nil {
+			t.Errorf("test %d, unexpected error: %v", i, err)
+			continue
+		}
+		sort.Strings(patterns)
+		sort.Strings(v.output)
+		if !reflect.DeepEqual(patterns, v.output) {
+			t.Errorf("test %d, Expressions(%q, %+v):\ngot  %q\nwant %q", i, v.url, v.limits, patterns, v.output)
 		}
 	}
 }
@@ -125,7 +170,15 @@ func TestCanonicalHost(t *testing.T) {
 		{"http://..google.com/foo.html", "google.com", false},
 		{"http://[FEDC:BA98:7654:3210:FEDC:BA98:7654:3210]:80/index.html",
 			strings.ToLower("[FEDC:BA98:7654:3210:FEDC:BA98:7654:3210]"), false},
-		{"http://[::192.9.5.5]/ipng", "[::192.9.5.5]", false},
+		{"http://[::192.9.5.5]/ipng", "[::c009:505]", false},
+		{"http://[::FFFF:1.2.3.4]/", "[::ffff:102:304]", false},
+		{"http://[2001:DB8:0:0:1:0:0:1]/", "[2001:db8::1:0:0:1]", false},
+		{"http://[0:0:0:0:0:0:0:1]/", "[::1]", false},
+		{"http://[2001:db8:0:1:1:1:1:1]/", "[2001:db8:0:1:1:1:1:1]", false},
+		{"http://[fe80::1%25en0]:443/", "[fe80::1]", false},
+		{"http://[::1]x/", "", true},
+		{"http://[1.2.3.4]/", "", true},
+		{"http://[::g]/", "", true},
 		{"http://0x12.0x43.0x44.0x01", "18.67.68.1", false},
 		{"http://192.168.0.1:80/index.html", "192.168.0.1", false},
 		{"/asdf", "", true},
@@ -147,7 +200,35 @@ func TestCanonicalHost(t *testing.T) {
 	}
 }
 
-func TestGenerateLookupHosts(t *testing.T) {
+func TestIDNAHost(t *testing.T) {
+	vectors := []struct {
+		url    string
+		output string
+		fail   bool
+	}{
+		{"http://BÜCHER.example/", "xn--bcher-kva.example", false},
+		{"http://%C3%BC.com/", "xn--tda.com", false},
+		{"http://faß.de/", "xn--fa-hia.de", false},          // Deviation character, kept
+		{"http://ｅｘａｍｐｌｅ.com/", "example.com", false},       // Full-width letters
+		{"http://例え。テスト/", "xn--r8jz45g.xn--zckzah", false}, // Ideographic full stop
+		{"http://a_b.ü.com/", "a_b.xn--tda.com", false},
+		{"http://-ü-.com/", "xn-----xka.com", false},
+		{"http://aא.com/", "", true}, // Bidi rule
+		{"http://ü.xn--a.com/", "", true},
+	}
+	for i, v := range vectors {
+		host, err := canonicalHost(v.url)
+		if (err != nil) != v.fail {
+			t.Errorf("test %d, canonicalHost(%q) error = %v, want failure %v", i, v.url, err, v.fail)
+			continue
+		}
+		if host != v.output {
+			t.Errorf("test %d, canonicalHost(%q) = %q, want %q", i, v.url, host, v.output)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
 	vectors := []struct {
 		url    string
 		output []string
@@ -163,14 +244,17 @@ func TestGenerateLookupHosts(t *testing.T) {
 		output: []string{"a.b.c.d.e.f.kita.tokyo.jp", "c.d.e.f.kita.tokyo.jp", "d.e.f.kita.tokyo.jp", "e.f.kita.tokyo.jp", "f.kita.tokyo.jp", "kita.tokyo.jp", "tokyo.jp"},
 	}, {
 		url:    "http://[::192.9.5.5]/ipng",
-		output: []string{"[::192.9.5.5]"},
+		output: []string{"[::c009:505]"},
+	}, {
+		url:    "http://[::ffff:1.2.3.4]/",
+		output: []string{"[::ffff:102:304]", "1.2.3.4"},
 	}, {
 		url:  "/asdf",
 		fail: true,
 	}}
 
 	for i, v := range vectors {
-		hosts, err := generateLookupHosts(v.url)
+		hosts, err := Hosts(v.url, Limits{})
 		if err != nil != v.fail {
 			if err != nil {
 				t.Errorf("test %d, unexpected error: %v", i, err)
@@ -180,7 +264,7 @@ func TestGenerateLookupHosts(t *testing.T) {
 			continue
 		}
 		if !reflect.DeepEqual(hosts, v.output) {
-			t.Errorf("test %d, generateLookupHosts(%q):\ngot  %q\nwant %q", i, v.url, hosts, v.output)
+			t.Errorf("test %d, Hosts(%q):\ngot  %q\nwant %q", i, v.url, hosts, v.output)
 		}
 	}
 }
@@ -222,7 +306,7 @@ func TestCanonicalPath(t *testing.T) {
 	}
 }
 
-func TestGenerateLookupPaths(t *testing.T) {
+func TestPaths(t *testing.T) {
 	vectors := []struct {
 		url    string
 		output []string
@@ -235,7 +319,7 @@ func TestGenerateLookupPaths(t *testing.T) {
 	}
 
 	for i, v := range vectors {
-		paths, err := generateLookupPaths(v.url)
+		paths, err := Paths(v.url, Limits{})
 		if err != nil != v.fail {
 			if err != nil {
 				t.Errorf("test %d, unexpected error: %v", i, err)
@@ -245,7 +329,7 @@ func TestGenerateLookupPaths(t *testing.T) {
 			continue
 		}
 		if !reflect.DeepEqual(paths, v.output) {
-			t.Errorf("test %d, generateLookupPaths(%q) = %q, want %q", i, v.url, paths, v.output)
+			t.Errorf("test %d, Paths(%q) = %q, want %q", i, v.url, paths, v.output)
 		}
 	}
 }
@@ -337,3 +421,99 @@ func TestCanonicalURL(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonicalize(t *testing.T) {
+	vectors := []struct {
+		url    string
+		output string
+		fail   bool
+	}{
+		{"http://BAD.example.com/a/../?q=1#frag", "http://bad.example.com/?q=1", false},
+		{"www.google.com", "http://www.google.com/", false},
+		{"https://%31%36%38%2e%31%38%38%2e%39%39%2e%32%36/%2E%73%65%63%75%72%65/", "https://168.188.99.26/.secure/", false},
+		{"http://host/?", "http://host/", false},
+		{"http:///blah", "", true},
+	}
+	for i, v := range vectors {
+		got, err := Canonicalize(v.url)
+		if (err != nil) != v.fail {
+			t.Errorf("test %d, Canonicalize(%q) error = %v, want failure %v", i, v.url, err, v.fail)
+			continue
+		}
+		if got != v.output {
+			t.Errorf("test %d, Canonicalize(%q) = %q, want %q", i, v.url, got, v.output)
+		}
+	}
+}
+
+func TestComputeHashes(t *testing.T) {
+	hashes, err := ComputeHashes("http://a.b/c#frag", Limits{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		expression, hash, prefix string
+	}{
+		{"a.b/", "2ec5fbb022232244b6e2d13f70889a5a9a54cba166e92e35c339778cb8c0606d", "2ec5fbb0"},
+		{"a.b/c", "fc7cd9c4e073b50b1ba87db5b2901e7a8e565556ea86f837fee96481321da526", "fc7cd9c4"},
+	}
+	if len(hashes) != len(want) {
+		t.Fatalf("ComputeHashes() = %d hashes, want %d", len(hashes), len(want))
+	}
+	for i, w := range want {
+		h := hashes[i]
+		if h.Expression != w.expression || hex.EncodeToString(h.Hash[:]) != w.hash || hex.EncodeToString(h.Prefix()) != w.prefix {
+			t.Errorf("hash %d = {%s %x %x}, want {%s %s %s}", i, h.Expression, h.Hash, h.Prefix(), w.expression, w.hash, w.prefix)
+		}
+	}
+
+	if _, err := ComputeHashes("/asdf", Limits{}); err == nil {
+		t.Errorf("ComputeHashes() succeeded with an invalid URL")
+	}
+}
+
+func TestScheme(t *testing.T) {
+	vectors := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/", "http"},
+		{"  HTTPS://example.com/", "https"},
+		{"example.com/a:b", ""},
+		{"ftp://example.com/", "ftp"},
+		{"javascript:alert(1)", "javascript"},
+		{"data:text/html,hello", "data"},
+		{"intent://example.com/#Intent;scheme=https;end", "intent"},
+	}
+	for i, v := range vectors {
+		if got := Scheme(v.url); got != v.want {
+			t.Errorf("test %d, Scheme(%q) = %q, want %q", i, v.url, got, v.want)
+		}
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	vectors := []struct {
+		url  string
+		want string
+		ok   bool
+	}{
+		{"view-source:http://example.com/a", "http://example.com/a", true},
+		{"blob:https://example.com/0b2e", "https://example.com/0b2e", true},
+		{"filesystem:http://example.com/temporary/a.txt", "http://example.com/temporary/a.txt", true},
+		{"view-source:javascript:alert(1)", "", false},
+		{"intent://example.com/path#Intent;scheme=https;package=com.example;end", "https://example.com/path", true},
+		{"intent://scan/#Intent;scheme=zxing;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fapp;end", "https://example.com/app", true},
+		{"intent://scan/#Intent;scheme=zxing;package=com.example;end", "", false},
+		{"intent:#Intent;S.browser_fallback_url=javascript%3Aalert(1);end", "", false},
+		{"javascript:alert(1)", "", false},
+		{"data:text/html,hello", "", false},
+		{"ftp://example.com/", "", false},
+	}
+	for i, v := range vectors {
+		got, ok := Unwrap(v.url)
+		if got != v.want || ok != v.ok {
+			t.Errorf("test %d, Unwrap(%q) = (%q, %v), want (%q, %v)", i, v.url, got, ok, v.want, v.ok)
+		}
+	}
+}
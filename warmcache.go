@@ -0,0 +1,67 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import "context"
+
+// warmCacheBatchSize is the number of URLs looked up together by WarmCache.
+const warmCacheBatchSize = 100
+
+// WarmCache looks up urls, such as the most popular URLs of a service, so that
+// the cache holds the verdicts of those matching the local database before
+// they are requested, rather than the first lookups after a deployment
+// waiting for the Web Risk API. It waits until the threat lists are synced,
+// and skips the URLs that are not valid. No detection event is emitted for
+// the unsafe URLs.
+//
+// It returns the number of URLs whose verdict was fetched from the Web Risk
+// API, and the first error of the lookups, if any. Lookups go on after an
+// error until ctx is done.
+func (wr *UpdateClient) WarmCache(ctx context.Context, urls []string) (fetched int, err error) {
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		return 0, err
+	}
+	var batch []string
+	lookup := func() {
+		results, lerr := wr.lookupURLResults(ctx, batch)
+		for _, r := range results {
+			if r.Source == SourceAPI {
+				fetched++
+			}
+		}
+		if lerr != nil && err == nil {
+			err = lerr
+		}
+		batch = batch[:0]
+	}
+	for _, url := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		if !wr.config.SchemePolicy.ValidURL(url) {
+			continue
+		}
+		if batch = append(batch, url); len(batch) == warmCacheBatchSize {
+			lookup()
+		}
+	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		lookup()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return fetched, err
+}
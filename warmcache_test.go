@@ -0,0 +1,88 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestWarmCache(t *testing.T) {
+	fullHash := hashFromPattern("unsafe.test/")
+	prefix := fullHash[:minHashPrefixLength]
+	var lookups int
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefix)}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: hashPrefixes{prefix}.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			lookups++
+			return &pb.SearchHashesResponse{
+				Threats: []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(time.Now().Add(time.Hour)),
+				}},
+				NegativeExpireTime: timepb.New(time.Now().Add(time.Hour)),
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	fetched, err := wr.WarmCache(context.Background(), []string{"http://unsafe.test/", "http://[::1", "http://safe.test/", "http://www.unsafe.test/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetched != 2 || lookups != 1 {
+		t.Errorf("WarmCache() = %d with %d API calls, want 2 with 1", fetched, lookups)
+	}
+
+	results, err := wr.LookupURLResults(context.Background(), []string{"http://unsafe.test/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := results[0]; len(r.Threats) != 1 || r.Source != SourceCache {
+		t.Errorf("LookupURLResults() = %+v, want a threat from the cache", r)
+	}
+	if lookups != 1 {
+		t.Errorf("HashLookup called %d times after the warm-up, want 1", lookups)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := wr.WarmCache(ctx, []string{"http://unsafe.test/"}); err == nil {
+		t.Errorf("WarmCache() succeeded with a canceled context")
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebhookSignatureHeader holds the signature of the body of the requests of a
+// WebhookSink with a secret: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the body.
+const WebhookSignatureHeader = "X-Webrisk-Signature"
+
+// DefaultWebhookQueueSize is the default number of events queued for every
+// webhook of a WebhookSink.
+const DefaultWebhookQueueSize = 1000
+
+// WebhookSinkConfig sets up a WebhookSink.
+type WebhookSinkConfig struct {
+	// URLs are the HTTP or HTTPS URLs to which every event is posted as a
+	// JSON object. This field is required.
+	URLs []string
+
+	// Secret is the key with which the requests are signed in the
+	// WebhookSignatureHeader. If empty, requests are not signed.
+	Secret string
+
+	// HashURLs replaces the URLs of the events by their hash.
+	HashURLs bool
+
+	// QueueSize is the maximum number of events queued for every webhook,
+	// after which new events are dropped.
+	// If zero value, it defaults to DefaultWebhookQueueSize.
+	QueueSize int
+
+	// OnError is called with the error of every event that could not be
+	// delivered. If nil, errors are ignored.
+	OnError func(error)
+}
+
+// WebhookSink posts events to webhooks. Every webhook has its own bounded
+// queue and delivery goroutine, so that a slow or failing webhook neither
+// delays the others nor the lookups: events are dropped once its queue is
+// full. Deliveries are retried with exponential backoff on network errors,
+// 429 Too Many Requests and 5xx responses. Events are counted once for every
+// webhook in its statistics.
+type WebhookSink struct {
+	hashURLs bool
+	secret   []byte
+	onError  func(error)
+	client   *http.Client
+	retries  int           // Retries of a failed delivery
+	backoff  time.Duration // Delay before the first retry, doubled for every other
+	hooks    []*webhook
+	wg       sync.WaitGroup
+	stats    sinkStats
+
+	mu     sync.RWMutex // Protects closed
+	closed bool         // Whether the queues were closed
+}
+
+// webhook is a webhook endpoint and its queue of events.
+type webhook struct {
+	url    string
+	events chan []byte
+}
+
+// NewWebhookSink returns a sink posting events to the webhooks of conf, and
+// starts delivering them.
+func NewWebhookSink(conf WebhookSinkConfig) (*WebhookSink, error) {
+	if len(conf.URLs) == 0 {
+		return nil, errors.New("webrisk: no webhook URL")
+	}
+	if conf.QueueSize == 0 {
+		conf.QueueSize = DefaultWebhookQueueSize
+	}
+	if conf.QueueSize < 0 {
+		return nil, fmt.Errorf("webrisk: invalid webhook queue size %d", conf.QueueSize)
+	}
+	s := &WebhookSink{
+		hashURLs: conf.HashURLs,
+		onError:  conf.OnError,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		retries:  3,
+		backoff:  time.Second,
+	}
+	if conf.Secret != "" {
+		s.secret = []byte(conf.Secret)
+	}
+	for _, u := range conf.URLs {
+		if pu, err := url.Parse(u); err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return nil, fmt.Errorf("webrisk: invalid webhook URL %q", u)
+		}
+		s.hooks = append(s.hooks, &webhook{url: u, events: make(chan []byte, conf.QueueSize)})
+	}
+	for _, h := range s.hooks {
+		s.wg.Add(1)
+		go s.run(h)
+	}
+	return s, nil
+}
+
+// Emit queues e for every webhook whose queue is not full.
+func (s *WebhookSink) Emit(e Event) {
+	if s.hashURLs {
+		e = e.hashURL()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		atomic.AddInt64(&s.stats.failed, int64(len(s.hooks)))
+		s.fail(err)
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	for _, h := range s.hooks {
+		select {
+		case h.events <- body:
+		default:
+			atomic.AddInt64(&s.stats.dropped, 1)
+		}
+	}
+}
+
+// fail reports err to the OnError callback.
+func (s *WebhookSink) fail(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// run delivers the events queued for h until its queue is closed.
+func (s *WebhookSink) run(h *webhook) {
+	defer s.wg.Done()
+	for body := range h.events {
+		if err := s.deliver(h.url, body); err != nil {
+			atomic.AddInt64(&s.stats.failed, 1)
+			s.fail(fmt.Errorf("webrisk: unable to notify webhook %s: %v", h.url, err))
+			continue
+		}
+		atomic.AddInt64(&s.stats.sent, 1)
+	}
+}
+
+// deliver posts body to the webhook at u, retrying with exponential backoff
+// on network errors, 429 Too Many Requests and 5xx responses.
+func (s *WebhookSink) deliver(u string, body []byte) error {
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(u, body)
+		if err == nil || !retry || attempt == s.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes a single delivery attempt, and reports whether it is worth
+// retrying if it failed.
+func (s *WebhookSink) post(u string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != nil {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// Stats returns the current delivery statistics.
+func (s *WebhookSink) Stats() SinkStats {
+	return s.stats.snapshot()
+}
+
+// Close stops queuing events and waits until those already queued are
+// delivered, or until ctx is done. Events emitted after are dropped.
+func (s *WebhookSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		for _, h := range s.hooks {
+			close(h.events)
+		}
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if got, want := r.Header.Get(WebhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls == 1 {
+			// The first delivery is retried.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		events = append(events, e)
+	}))
+	defer ts.Close()
+
+	e := Event{
+		Type:        EventDetection,
+		Time:        time.Unix(1700000000, 0).UTC(),
+		URL:         "http://bad.example.com/",
+		ThreatTypes: []string{"MALWARE", "SOCIAL_ENGINEERING"},
+		Labels:      map[string]string{"tenant": "payments"},
+	}
+	vectors := []struct {
+		hashURLs bool
+		want     Event
+	}{
+		{false, e},
+		{true, e.hashURL()},
+	}
+	for i, v := range vectors {
+		s, err := NewWebhookSink(WebhookSinkConfig{URLs: []string{ts.URL}, Secret: "secret", HashURLs: v.hashURLs, QueueSize: 10})
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		s.backoff = time.Millisecond
+		s.Emit(e)
+		if err := s.Close(context.Background()); err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if got := s.Stats(); got != (SinkStats{Sent: 1}) {
+			t.Errorf("test %d, stats = %+v, want 1 event sent", i, got)
+		}
+		mu.Lock()
+		got := events
+		events = nil
+		mu.Unlock()
+		if want := []Event{v.want}; !cmp.Equal(got, want) {
+			t.Errorf("test %d, events = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// Events are dropped rather than blocking lookups once the queue of a
+	// webhook is full.
+	received, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer slow.Close()
+	s, err := NewWebhookSink(WebhookSinkConfig{URLs: []string{slow.URL}, QueueSize: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.Emit(e)
+	<-received
+	for i := 0; i < 3; i++ {
+		s.Emit(e)
+	}
+	close(release)
+	go func() {
+		for range received {
+		}
+	}()
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(received)
+	if got := s.Stats(); got != (SinkStats{Sent: 2, Dropped: 2}) {
+		t.Errorf("stats = %+v, want 2 events sent and 2 dropped", got)
+	}
+
+	for _, urls := range [][]string{nil, {"ftp://example.com/"}, {"http:///path"}} {
+		if _, err := NewWebhookSink(WebhookSinkConfig{URLs: urls}); err == nil {
+			t.Errorf("unexpected success with webhook URLs %q", urls)
+		}
+	}
+}
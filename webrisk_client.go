@@ -64,14 +64,18 @@ package webrisk
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	pb "github.com/google/webrisk/internal/webrisk_proto"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -90,6 +94,14 @@ const (
 	// DefaultRequestTimeout is the default amount of time a single
 	// api request can take.
 	DefaultRequestTimeout = time.Minute
+
+	// DefaultUpdateConcurrency is the default maximum number of threat lists
+	// that are updated concurrently.
+	DefaultUpdateConcurrency = 4
+
+	// DefaultReloadPeriod is the default period for how often a read-only
+	// UpdateClient checks its database file for changes.
+	DefaultReloadPeriod = time.Minute
 )
 
 // Errors specific to this package.
@@ -97,8 +109,23 @@ var (
 	errClosed     = errors.New("webrisk: handler is closed")
 	errStale      = errors.New("webrisk: threat list is stale")
 	errMaxEntries = errors.New("webrisk: max entries must be a power of 2 between 2 ** 10 and 2 ** 20")
+	errReadOnlyDB = errors.New("webrisk: read-only database requires a database path")
+	errChecksum   = errors.New("webrisk: threat list SHA256 mismatch")
 )
 
+// ErrNotReady is returned by lookups with Config.Strict set if the threat
+// lists were never successfully synced, so that no verdict can be given.
+var ErrNotReady = errors.New("webrisk: threat lists not synced yet")
+
+// ErrUpdateTooSoon is returned by UpdateNow if the minimum wait duration
+// requested by the Web Risk API since the last update has not yet elapsed.
+var ErrUpdateTooSoon = errors.New("webrisk: minimum wait duration before next update has not elapsed")
+
+// ErrPartialResults is returned by lookups whose context was done before every
+// URL was looked up. The results of the URLs that were not are marked
+// Undetermined, and the others hold their verdict.
+var ErrPartialResults = errors.New("webrisk: lookup context done before every URL was determined")
+
 // ThreatType is an enumeration type for threats classes. Examples of threat
 // classes are malware, social engineering, etc.
 type ThreatType uint16
@@ -128,6 +155,76 @@ var DefaultThreatLists = []ThreatType{
 type URLThreat struct {
 	Pattern string
 	ThreatType
+
+	// HashPrefix is the prefix of the hash of Pattern found in the local
+	// database, Source where the match was confirmed, and ExpireTime the time
+	// until which it may be cached, if known. They explain the verdict, such
+	// as in block messages or to debug it.
+	HashPrefix []byte
+	Source     LookupSource
+	ExpireTime time.Time
+}
+
+// A URLResult is the result of looking up a URL.
+type URLResult struct {
+	Threats    []URLThreat  // Threats matched by the URL, if any
+	ExpireTime time.Time    // Time until which the result may be cached; zero if unknown
+	Source     LookupSource // Where the result came from
+
+	// Unsupported reports that the URL was not looked up because of its
+	// scheme, according to Config.SchemePolicy.
+	Unsupported bool
+
+	// Stale reports that the result comes from expired cache entries,
+	// served with Config.ServeStale because the Web Risk API failed.
+	Stale bool
+
+	// Skipped reports that the URL was not looked up because of its host,
+	// according to Config.SkipPrivateHosts and Config.InternalHostSuffixes.
+	Skipped bool
+
+	// Undetermined reports that the context of the lookup was done before
+	// the URL could be fully looked up. Threats holds the threats found
+	// until then, if any.
+	Undetermined bool
+}
+
+// LookupSource tells where the result of a URL lookup came from, which is the
+// most costly of the sources needed by the expressions of the URL.
+type LookupSource int
+
+// List of LookupSource constants.
+const (
+	SourceDatabase LookupSource = iota // Ruled out by the local database alone
+	SourceCache                        // Answered by the cache of full hashes
+	SourceAPI                          // Required a call to the Web Risk API
+)
+
+func (s LookupSource) String() string {
+	switch s {
+	case SourceDatabase:
+		return "database"
+	case SourceCache:
+		return "cache"
+	case SourceAPI:
+		return "api"
+	}
+	return "unknown"
+}
+
+// A HashThreat is a full hash matching a hash prefix searched for with
+// SearchHashes, along with the threat lists it is on.
+type HashThreat struct {
+	Hash        []byte // The full SHA256 hash
+	ThreatTypes []ThreatType
+	ExpireTime  time.Time // Time until which the match may be cached
+}
+
+// ListConstraints limits the entries of a single threat list. A zero field
+// falls back to the corresponding global setting in Config.
+type ListConstraints struct {
+	MaxDiffEntries     int32
+	MaxDatabaseEntries int32
 }
 
 // Config sets up the UpdateClient object.
@@ -140,6 +237,11 @@ type Config struct {
 	// If empty, the underlying library uses $HTTP_PROXY environment variable.
 	ProxyURL string
 
+	// Transport is the http.RoundTripper used for the requests to the Web Risk
+	// API, for instance to instrument them. If set, ProxyURL is ignored.
+	// If empty, the requests are made with http.DefaultTransport.
+	Transport http.RoundTripper
+
 	// APIKey is the key used to authenticate with the Web Risk API
 	// service. This field is required.
 	APIKey string
@@ -157,10 +259,44 @@ type Config struct {
 	// of the UpdateClient object.
 	DBPath string
 
+	// SnapshotURL is the URL of a database snapshot, such as the one served by
+	// the /admin/database:export endpoint of wrserver, with which the database
+	// is seeded at startup if it could not be loaded from DBPath. Updates then
+	// continue with diffs from the version tokens of the snapshot, instead of
+	// downloading every threat list in full. Google Cloud Storage objects may
+	// be given as gs://bucket/object, which are downloaded from
+	// storage.googleapis.com. If the snapshot cannot be downloaded or fails
+	// verification, the threat lists are downloaded from the Web Risk API.
+	SnapshotURL string
+
+	// SnapshotHeader holds headers added to the request downloading
+	// SnapshotURL, such as an Authorization header.
+	SnapshotHeader http.Header
+
 	// UpdatePeriod determines how often we update the internal list database.
 	// If zero value, it defaults to DefaultUpdatePeriod.
 	UpdatePeriod time.Duration
 
+	// UpdateConcurrency is the maximum number of threat lists that are
+	// requested from the API concurrently during a database update.
+	// If zero value, it defaults to DefaultUpdateConcurrency.
+	UpdateConcurrency int
+
+	// ReadOnlyDB configures UpdateClient to share the database file at DBPath
+	// with another process that keeps it updated. The client never requests
+	// threat list updates itself; instead it reloads the file whenever the
+	// other process has written a new generation of it, or whenever the file
+	// was modified, such as when replaced by a copy of a file updated on
+	// another host. A new file that cannot be read is ignored until the next
+	// check, the database loaded last being kept meanwhile.
+	// This requires DBPath to be set.
+	ReadOnlyDB bool
+
+	// ReloadPeriod determines how often a client with ReadOnlyDB set checks
+	// the database file for a new generation.
+	// If zero value, it defaults to DefaultReloadPeriod.
+	ReloadPeriod time.Duration
+
 	// ThreatListArg is an optional string that will be parsed into ThreatLists.
 	// It is expected that names will be an exact match and comma-separated.
 	// For Example: 'MALWARE,SOCIAL_ENGINEERING'.
@@ -180,15 +316,114 @@ type Config struct {
 	// If set, this should be a power of 2 between 2 ** 10 and 2 ** 20.
 	MaxDatabaseEntries int32
 
+	// ListConstraints overrides MaxDiffEntries and MaxDatabaseEntries for
+	// individual threat lists. For example, this allows keeping the full
+	// MALWARE list while capping a larger list on memory-constrained nodes.
+	// The same power of 2 restrictions apply to every set value.
+	ListConstraints map[ThreatType]ListConstraints
+
+	// ListConstraintsArg is an optional string that will be parsed into
+	// ListConstraints, taking precedence over entries already in it.
+	// It is a comma-separated list of THREAT_TYPE.field=value assignments.
+	// For Example: 'SOCIAL_ENGINEERING_EXTENDED_COVERAGE.maxDatabaseEntries=65536'.
+	// The fields are maxDiffEntries and maxDatabaseEntries.
+	ListConstraintsArg string
+
 	// ThreatLists determines which threat lists that UpdateClient should
 	// subscribe to. The threats reported by LookupURLs will only be ones that
 	// are specified by this list.
 	// If empty, it defaults to DefaultThreatLists.
 	ThreatLists []ThreatType
 
+	// ExpressionLimits bounds the host-suffix and path-prefix expressions
+	// generated for every URL looked up, unless overridden for a lookup with
+	// WithExpressionLimits. Raising the limits covers deeply nested URLs at
+	// the cost of more hashes per URL, and lowering them caps the work per URL.
+	// Zero fields select DefaultMaxHostComponents and DefaultMaxPathComponents.
+	ExpressionLimits ExpressionLimits
+
+	// SchemePolicy is how lookups treat the URLs whose scheme is neither
+	// http nor https. If zero value, it defaults to SchemeLookup.
+	SchemePolicy SchemePolicy
+
+	// SkipPrivateHosts makes lookups skip the URLs whose host is a loopback,
+	// private, link-local or unspecified IP address, or localhost, which can
+	// never be on the threat lists, and report them as skipped in their
+	// URLResult. Host names are not resolved.
+	SkipPrivateHosts bool
+
+	// InternalHostSuffixes are host suffixes, such as corp.example.com, whose
+	// hosts and subdomains are skipped by lookups like with
+	// SkipPrivateHosts.
+	InternalHostSuffixes []string
+
 	// RequestTimeout determines the timeout value for the http client.
 	RequestTimeout time.Duration
 
+	// Strict makes lookups fail with an error wrapping ErrNotReady until the
+	// threat lists were successfully synced for the first time, so that
+	// callers cannot mistake the lack of data for a safe verdict.
+	Strict bool
+
+	// LiveLookupsUntilSynced makes lookups query the Web Risk API for the
+	// hash prefixes of every URL expression until the threat lists were
+	// successfully synced for the first time, rather than failing. It takes
+	// precedence over Strict.
+	LiveLookupsUntilSynced bool
+
+	// Cache is the cache of the verdicts of full hashes and hash prefixes
+	// searched for with the Web Risk API, consulted before it.
+	// If nil, it defaults to an in-memory cache private to the client.
+	// A cache shared with other clients is returned by NewSharedCache.
+	Cache Cache
+
+	// CacheRefreshAhead enables the background refresh of hot hash
+	// prefixes: once the threats cached for a prefix were hit
+	// CacheRefreshMinHits times within an update period, it is searched
+	// again when they expire within CacheRefreshAhead, so that lookups keep
+	// being answered by the cache rather than waiting for the API.
+	// Refreshes are disabled if zero.
+	CacheRefreshAhead time.Duration
+
+	// ServeStale is how long after they expired the entries of the cache
+	// may still be served by lookups of URLs when the Web Risk API fails,
+	// rather than failing the lookups. Such results are reported as
+	// URLResult.Stale. It requires a cache keeping expired entries, such as
+	// the in-memory cache, which then keeps them for ServeStale.
+	// Stale results are disabled if zero.
+	ServeStale time.Duration
+
+	// CacheRefreshMinHits is the number of cache hits after which a hash
+	// prefix is refreshed with CacheRefreshAhead.
+	// If zero value, it defaults to DefaultCacheRefreshMinHits.
+	CacheRefreshMinHits int
+
+	// TestThreats enables InjectTestThreats, to make lookups report harmless
+	// test URLs as unsafe. It is meant for tests and debugging only.
+	TestThreats bool
+
+	// OnUpdateAlert is called, from the goroutine updating the database,
+	// when the updates of a threat list failed UpdateAlertFailures
+	// consecutive times or the database is older than UpdateAlertAge, and
+	// again once neither holds. Alerts are also emitted to EventSink as
+	// EventAlert events.
+	OnUpdateAlert func(UpdateAlert)
+
+	// UpdateAlertFailures is the number of consecutive failed updates of a
+	// threat list after which an alert is raised.
+	// If zero value, it defaults to DefaultUpdateAlertFailures.
+	UpdateAlertFailures int
+
+	// UpdateAlertAge is the age of the database after which an alert is
+	// raised. Alerts on the age of the database are disabled if zero.
+	UpdateAlertAge time.Duration
+
+	// EventSink is an optional sink of the events of the client: the URLs
+	// found unsafe by lookups, the updates of the database and their
+	// failures. See FileSink, SyslogSink, WebhookSink and PubSubSink for the
+	// built-in sinks, and MultiSink to emit events to several of them.
+	EventSink EventSink
+
 	// Logger is an io.Writer that allows UpdateClient to write debug information
 	// intended for human consumption.
 	// If empty, no logs will be written.
@@ -216,9 +451,31 @@ func (c *Config) setDefaults() bool {
 	if c.RequestTimeout <= 0 {
 		c.RequestTimeout = DefaultRequestTimeout
 	}
+	if c.UpdateConcurrency <= 0 {
+		c.UpdateConcurrency = DefaultUpdateConcurrency
+	}
+	if c.ReloadPeriod <= 0 {
+		c.ReloadPeriod = DefaultReloadPeriod
+	}
+	if c.CacheRefreshMinHits <= 0 {
+		c.CacheRefreshMinHits = DefaultCacheRefreshMinHits
+	}
+	if c.UpdateAlertFailures <= 0 {
+		c.UpdateAlertFailures = DefaultUpdateAlertFailures
+	}
 	if c.compressionTypes == nil {
 		c.compressionTypes = []pb.CompressionType{pb.CompressionType_RAW, pb.CompressionType_RICE}
 	}
+	if c.ExpressionLimits.MaxHostComponents < 0 || c.ExpressionLimits.MaxPathComponents < 0 {
+		return false
+	}
+	if c.SchemePolicy < SchemeLookup || c.SchemePolicy > SchemeNormalize {
+		return false
+	}
+	var ok bool
+	if c.InternalHostSuffixes, ok = normalizeHostSuffixes(c.InternalHostSuffixes); !ok {
+		return false
+	}
 	return true
 }
 
@@ -242,6 +499,53 @@ func parseThreatTypes(args string) ([]ThreatType, error) {
 	return r, nil
 }
 
+// parseListConstraints accepts a string of comma-separated
+// THREAT_TYPE.field=value assignments and parses it into per-list constraints.
+// It is used to load command line arguments.
+func parseListConstraints(args string) (map[ThreatType]ListConstraints, error) {
+	r := make(map[ThreatType]ListConstraints)
+	if args == "" {
+		return r, nil
+	}
+	for _, v := range strings.Split(args, ",") {
+		i, j := strings.Index(v, "."), strings.Index(v, "=")
+		if i < 0 || j < i {
+			return nil, errors.New("webrisk: invalid list constraint: " + v)
+		}
+		tt := ThreatType(pb.ThreatType_value[v[:i]])
+		if tt == ThreatTypeUnspecified {
+			return nil, errors.New("webrisk: unknown threat type: " + v[:i])
+		}
+		n, err := strconv.ParseInt(v[j+1:], 10, 32)
+		if err != nil {
+			return nil, errors.New("webrisk: invalid list constraint value: " + v)
+		}
+		lc := r[tt]
+		switch v[i+1 : j] {
+		case "maxDiffEntries":
+			lc.MaxDiffEntries = int32(n)
+		case "maxDatabaseEntries":
+			lc.MaxDatabaseEntries = int32(n)
+		default:
+			return nil, errors.New("webrisk: unknown list constraint: " + v[i+1:j])
+		}
+		r[tt] = lc
+	}
+	return r, nil
+}
+
+// constraints returns the max entries settings that apply to the threat list.
+func (c *Config) constraints(td ThreatType) (maxDiffEntries, maxDatabaseEntries int32) {
+	maxDiffEntries, maxDatabaseEntries = c.MaxDiffEntries, c.MaxDatabaseEntries
+	if lc := c.ListConstraints[td]; lc.MaxDiffEntries != 0 {
+		maxDiffEntries = lc.MaxDiffEntries
+	}
+	if lc := c.ListConstraints[td]; lc.MaxDatabaseEntries != 0 {
+		maxDatabaseEntries = lc.MaxDatabaseEntries
+	}
+	return maxDiffEntries, maxDatabaseEntries
+}
+
 // validateMaxEntries validates a max entries argument, which must be either 0 or a power of 2
 // between 2 ** 10 and 2 ** 20.
 func validateMaxEntries(n int32) error {
@@ -258,6 +562,13 @@ func validateMaxEntries(n int32) error {
 func (c Config) copy() Config {
 	c2 := c
 	c2.ThreatLists = append([]ThreatType(nil), c.ThreatLists...)
+	if c.ListConstraints != nil {
+		c2.ListConstraints = make(map[ThreatType]ListConstraints)
+		for td, lc := range c.ListConstraints {
+			c2.ListConstraints[td] = lc
+		}
+	}
+	c2.InternalHostSuffixes = append([]string(nil), c.InternalHostSuffixes...)
 	c2.compressionTypes = append([]pb.CompressionType(nil), c.compressionTypes...)
 	return c2
 }
@@ -273,14 +584,20 @@ type UpdateClient struct {
 	config Config
 	api    api
 	db     database
-	c      cache
+	c      Cache
+	hot    hotPrefixes // Hash prefixes hit in the cache, with Config.CacheRefreshAhead
+	test   testThreats // Threats injected with InjectTestThreats
+
+	flights  singleflight.Group // API searches of hash prefixes in flight
+	alerting bool               // Whether an UpdateAlert is raised, only used by the updater
 
 	lists map[ThreatType]bool
 
 	log *log.Logger
 
-	closed uint32
-	done   chan bool // Signals that the updater routine should stop
+	closed    uint32
+	done      chan bool       // Signals that the updater routine should stop
+	updateNow chan chan error // Requests an immediate update from the updater routine
 }
 
 // Stats records statistics regarding UpdateClient's operation.
@@ -289,7 +606,41 @@ type Stats struct {
 	QueriesByCache    int64         // Number of queries satisfied by the cache alone
 	QueriesByAPI      int64         // Number of queries satisfied by an API call
 	QueriesFail       int64         // Number of queries that could not be satisfied
+	CacheMisses       int64         // Number of queries the cache had no valid result for
+	CacheRefreshes    int64         // Number of hash prefixes refreshed in the background
+	CacheRefreshFails int64         // Number of background refreshes that failed
+	QueriesStale      int64         // Number of queries satisfied by expired cache entries as the API failed
+	HashLookupsShared int64         // Number of API searches of hash prefixes shared with a concurrent identical one
+	DuplicateURLs     int64         // Number of URLs looked up along with an identical one, and not looked up again
+	QueriesSkipped    int64         // Number of URLs not looked up because of their private or internal host
+	UpdateAlerts      int64         // Number of alerts raised because the database failed to update
 	DatabaseUpdateLag time.Duration // Duration since last *missed* update. 0 if next update is in the future.
+	DatabaseAge       time.Duration // Duration since the database was last synced with the API
+
+	DatabaseFileBytes  int64                    // Size of the database file on disk. 0 if not persisted.
+	DatabaseLoadFails  int64                    // Number of times the database file could not be loaded
+	LastUpdateDuration time.Duration            // Wall time of the last database update
+	Lists              map[ThreatType]ListStats `json:",omitempty"` // Statistics per threat list
+
+	SharedCacheHits   int64 // Number of cache hits of a Config.Cache returned by NewSharedCache
+	SharedCacheErrors int64 // Number of failed reads and writes of the store of NewSharedCache
+
+	Cache CacheStats // Statistics of the entries of the lookup cache, if it reports them
+}
+
+// ListStats records statistics regarding a threat list in the local database.
+type ListStats struct {
+	HashPrefixes     int   // Number of hash prefixes stored
+	MemoryBytes      int64 // Approximate size of the stored hash prefixes in memory
+	LastAdditions    int   // Number of hash prefixes added by the last update
+	LastRemovals     int   // Number of hash prefixes removed by the last update
+	Additions        int64 // Total number of hash prefixes added by updates
+	Removals         int64 // Total number of hash prefixes removed by updates
+	UpdateFailures   int64 // Number of failed updates
+	ChecksumFailures int64 // Number of updates that failed checksum validation
+	Resets           int64 // Number of times the list was reset to download it again in full
+
+	LastSynced time.Time // Time the list was last synced with the API; zero if never
 }
 
 // NewUpdateClient creates a new UpdateClient.
@@ -313,15 +664,41 @@ func NewUpdateClient(conf Config) (*UpdateClient, error) {
 		conf.ThreatLists = tl
 	}
 
+	// Parse per-list constraints if args are passed.
+	if conf.ListConstraintsArg != "" {
+		lcs, err := parseListConstraints(conf.ListConstraintsArg)
+		if err != nil {
+			return nil, err
+		}
+		if conf.ListConstraints == nil {
+			conf.ListConstraints = make(map[ThreatType]ListConstraints)
+		}
+		for td, lc := range lcs {
+			conf.ListConstraints[td] = lc
+		}
+	}
+
 	// Validate max entries if args are passed.
 	if err := validateMaxEntries(conf.MaxDiffEntries); err != nil {
 		return nil, err
 	}
+	for _, lc := range conf.ListConstraints {
+		if err := validateMaxEntries(lc.MaxDiffEntries); err != nil {
+			return nil, err
+		}
+		if err := validateMaxEntries(lc.MaxDatabaseEntries); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.ReadOnlyDB && conf.DBPath == "" {
+		return nil, errReadOnlyDB
+	}
 
 	// Create the SafeBrowsing object.
 	if conf.api == nil {
 		var err error
-		conf.api, err = newNetAPI(conf.ServerURL, conf.APIKey, conf.ProxyURL)
+		conf.api, err = newNetAPI(conf.ServerURL, conf.APIKey, conf.ProxyURL, conf.Transport)
 		if err != nil {
 			return nil, err
 		}
@@ -332,7 +709,10 @@ func NewUpdateClient(conf Config) (*UpdateClient, error) {
 	wr := &UpdateClient{
 		config: conf,
 		api:    conf.api,
-		c:      cache{now: conf.now},
+		c:      conf.Cache,
+	}
+	if wr.c == nil {
+		wr.c = &cache{now: conf.now, retain: conf.ServeStale}
 	}
 
 	// TODO: Verify that config.ThreatLists is a subset of the list obtained
@@ -353,11 +733,32 @@ func NewUpdateClient(conf Config) (*UpdateClient, error) {
 
 	delay := time.Duration(0)
 	// If database file is provided, use that to initialize.
-	if !wr.db.Init(&wr.config, wr.log) {
+	loaded := wr.db.Init(&wr.config, wr.log)
+	if !loaded && !wr.config.ReadOnlyDB && wr.config.SnapshotURL != "" {
 		ctx, cancel := context.WithTimeout(context.Background(), wr.config.RequestTimeout)
-		delay, _ = wr.db.Update(ctx, wr.api)
+		if err := wr.bootstrap(ctx); err != nil {
+			wr.log.Printf("unable to bootstrap from snapshot: %v", err)
+		} else {
+			loaded = true
+		}
 		cancel()
-	} else {
+	}
+	switch {
+	case wr.config.ReadOnlyDB:
+		// Another process owns updates; just check back for a new generation.
+		delay = wr.config.ReloadPeriod
+	case !loaded:
+		ctx, cancel := context.WithTimeout(context.Background(), wr.config.RequestTimeout)
+		var ok bool
+		delay, ok = wr.db.Update(ctx, wr.api)
+		cancel()
+		switch err := wr.db.Status(); {
+		case ok:
+			wr.emitUpdate(nil)
+		case err != nil:
+			wr.emitUpdate(err)
+		}
+	default:
 		if age := wr.db.SinceLastUpdate(); age < wr.config.UpdatePeriod {
 			delay = wr.config.UpdatePeriod - age
 		}
@@ -365,10 +766,44 @@ func NewUpdateClient(conf Config) (*UpdateClient, error) {
 
 	// Start the background list updater.
 	wr.done = make(chan bool)
+	wr.updateNow = make(chan chan error)
 	go wr.updater(delay)
 	return wr, nil
 }
 
+// bootstrap seeds the database with the snapshot at config.SnapshotURL.
+func (wr *UpdateClient) bootstrap(ctx context.Context) error {
+	rawURL := wr.config.SnapshotURL
+	if strings.HasPrefix(rawURL, "gs://") {
+		rawURL = "https://storage.googleapis.com/" + strings.TrimPrefix(rawURL, "gs://")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range wr.config.SnapshotHeader {
+		req.Header[k] = vs
+	}
+	req.Header.Set("User-Agent", userAgentString)
+	client, err := newHTTPClient(wr.config.ProxyURL, wr.config.Transport)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webrisk: unable to download snapshot: %s", resp.Status)
+	}
+	if err := wr.db.Bootstrap(resp.Body); err != nil {
+		return err
+	}
+	wr.log.Printf("database bootstrapped from snapshot")
+	return nil
+}
+
 // Status reports the status of UpdateClient. It returns some statistics
 // regarding the operation, and an error representing the status of its
 // internal state. Most errors are transient and will recover themselves
@@ -379,7 +814,24 @@ func (wr *UpdateClient) Status() (Stats, error) {
 		QueriesByCache:    atomic.LoadInt64(&wr.stats.QueriesByCache),
 		QueriesByAPI:      atomic.LoadInt64(&wr.stats.QueriesByAPI),
 		QueriesFail:       atomic.LoadInt64(&wr.stats.QueriesFail),
+		CacheMisses:       atomic.LoadInt64(&wr.stats.CacheMisses),
+		CacheRefreshes:    atomic.LoadInt64(&wr.stats.CacheRefreshes),
+		CacheRefreshFails: atomic.LoadInt64(&wr.stats.CacheRefreshFails),
+		QueriesStale:      atomic.LoadInt64(&wr.stats.QueriesStale),
+		HashLookupsShared: atomic.LoadInt64(&wr.stats.HashLookupsShared),
+		DuplicateURLs:     atomic.LoadInt64(&wr.stats.DuplicateURLs),
+		QueriesSkipped:    atomic.LoadInt64(&wr.stats.QueriesSkipped),
+		UpdateAlerts:      atomic.LoadInt64(&wr.stats.UpdateAlerts),
 		DatabaseUpdateLag: wr.db.UpdateLag(),
+		DatabaseAge:       wr.db.SinceLastUpdate(),
+	}
+	stats.Lists, stats.DatabaseFileBytes, stats.LastUpdateDuration, stats.DatabaseLoadFails = wr.db.Stats()
+	if sc, ok := wr.c.(*sharedCache); ok {
+		stats.SharedCacheHits = atomic.LoadInt64(&sc.hits)
+		stats.SharedCacheErrors = atomic.LoadInt64(&sc.errors)
+	}
+	if cs, ok := wr.c.(cacheStatser); ok {
+		stats.Cache = cs.Stats()
 	}
 	return stats, wr.db.Status()
 }
@@ -420,40 +872,166 @@ func (wr *UpdateClient) LookupURLs(urls []string) (threats [][]URLThreat, err er
 	return threats, err
 }
 
+// expressionLimitsKey is the context key for per-request ExpressionLimits.
+type expressionLimitsKey struct{}
+
+// WithExpressionLimits returns a copy of ctx that makes LookupURLsContext
+// generate the URL expressions of each URL within the given limits.
+// This allows using different limits for different kinds of requests
+// served by the same UpdateClient. Zero fields of limits select those of
+// Config.ExpressionLimits.
+func WithExpressionLimits(ctx context.Context, limits ExpressionLimits) context.Context {
+	return context.WithValue(ctx, expressionLimitsKey{}, limits)
+}
+
+// expressionLimits returns the expression limits of the lookups made with
+// ctx.
+func (wr *UpdateClient) expressionLimits(ctx context.Context) ExpressionLimits {
+	limits, _ := ctx.Value(expressionLimitsKey{}).(ExpressionLimits)
+	if limits.MaxHostComponents <= 0 {
+		limits.MaxHostComponents = wr.config.ExpressionLimits.MaxHostComponents
+	}
+	if limits.MaxPathComponents <= 0 {
+		limits.MaxPathComponents = wr.config.ExpressionLimits.MaxPathComponents
+	}
+	return limits
+}
+
 // LookupURLsContext looks up the provided URLs. The request will be canceled
 // if the provided Context is canceled, or if Config.RequestTimeout has
 // elapsed. It is safe to call this method concurrently.
 //
+// If ctx carries ExpressionLimits set by WithExpressionLimits, they bound
+// the expressions generated for each URL.
+//
 // See LookupURLs for details on the returned results.
 func (wr *UpdateClient) LookupURLsContext(ctx context.Context, urls []string) (threats [][]URLThreat, err error) {
+	results, err := wr.LookupURLResults(ctx, urls)
+	threats = make([][]URLThreat, len(results))
+	for i, r := range results {
+		threats[i] = r.Threats
+	}
+	return threats, err
+}
+
+// LookupURLResults looks up the provided URLs like LookupURLsContext, and also
+// reports until when the result for every URL may be cached. It returns one
+// result for every URL requested, in the same order, even if an error occurs.
+//
+// URLs repeated in urls, as is or once canonicalized, are only looked up once.
+//
+// If ctx is done, or Config.RequestTimeout elapses, while the Web Risk API is
+// searched, the lookup returns ErrPartialResults along with the verdicts
+// already determined, and marks the other URLs Undetermined.
+//
+// A detection event is emitted to Config.EventSink for every URL found
+// unsafe, with the labels set in ctx by WithEventLabels.
+func (wr *UpdateClient) LookupURLResults(ctx context.Context, urls []string) (results []URLResult, err error) {
+	results, err = wr.lookupURLResults(ctx, urls)
+	wr.emitDetections(ctx, urls, results)
+	return results, err
+}
+
+// lookupURLResults implements LookupURLResults.
+func (wr *UpdateClient) lookupURLResults(ctx context.Context, urls []string) (results []URLResult, err error) {
 	ctx, cancel := context.WithTimeout(ctx, wr.config.RequestTimeout)
 	defer cancel()
 
-	threats = make([][]URLThreat, len(urls))
+	results = make([]URLResult, len(urls))
 
 	if atomic.LoadUint32(&wr.closed) != 0 {
-		return threats, errClosed
+		return results, errClosed
 	}
-	if err := wr.db.Status(); err != nil {
+	live, err := wr.liveLookups()
+	if err != nil {
 		wr.log.Printf("inconsistent database: %v", err)
 		atomic.AddInt64(&wr.stats.QueriesFail, int64(len(urls)))
-		return threats, err
+		return results, err
+	}
+	var liveThreats []ThreatType
+	if live {
+		for td := range wr.lists {
+			liveThreats = append(liveThreats, td)
+		}
 	}
 
+	limits := wr.expressionLimits(ctx)
 	hashes := make(map[hashPrefix]string)
 	hash2idxs := make(map[hashPrefix][]int)
 
+	// expire lowers the time until which the results of the given URLs may
+	// be cached to t.
+	expire := func(idxs []int, t time.Time) {
+		for _, i := range idxs {
+			if results[i].ExpireTime.IsZero() || t.Before(results[i].ExpireTime) {
+				results[i].ExpireTime = t
+			}
+		}
+	}
+	// source raises the source of the results of the given URLs to src.
+	source := func(idxs []int, src LookupSource) {
+		for _, i := range idxs {
+			if src > results[i].Source {
+				results[i].Source = src
+			}
+		}
+	}
+
 	// Construct the follow-up request being made to the server.
 	// In the request, we only ask for partial hashes for privacy reasons.
 	var reqs []*pb.SearchHashesRequest
+	var reqHashes []hashPrefix // The full hash each request is made for
+	partial := false           // Whether some requests were cut short by ctx
 	ttm := make(map[pb.ThreatType]bool)
 
+	// URLs identical to a previous one, as is or once canonicalized and
+	// stripped of their scheme, are not looked up again but get the result
+	// of the first one.
+	seen := make(map[string]int)
+	canonical := make(map[string]int)
+	dupOf := make(map[int]int)
+	defer func() {
+		for i, j := range dupOf {
+			results[i] = results[j]
+			results[i].Threats = append([]URLThreat(nil), results[j].Threats...)
+		}
+	}()
+
 	for i, url := range urls {
-		urlhashes, err := generateHashes(url)
+		if j, ok := seen[url]; ok {
+			dupOf[i] = j
+			atomic.AddInt64(&wr.stats.DuplicateURLs, 1)
+			continue
+		}
+		seen[url] = i
+		target, unsupported, err := wr.config.SchemePolicy.apply(url)
+		if unsupported {
+			results[i].Unsupported = true
+			continue
+		}
+		var key, host string
+		if err == nil {
+			key, host, err = lookupKey(target)
+		}
+		var urlhashes map[hashPrefix]string
+		if err == nil {
+			if j, ok := canonical[key]; ok {
+				dupOf[i] = j
+				atomic.AddInt64(&wr.stats.DuplicateURLs, 1)
+				continue
+			}
+			canonical[key] = i
+			if wr.config.skipHost(host) {
+				results[i].Skipped = true
+				atomic.AddInt64(&wr.stats.QueriesSkipped, 1)
+				continue
+			}
+			urlhashes, err = generateHashes(target, limits)
+		}
 		if err != nil {
 			wr.log.Printf("error generating urlhashes: %v", err)
 			atomic.AddInt64(&wr.stats.QueriesFail, int64(len(urls)-i))
-			return threats, err
+			return results, err
 		}
 
 		for fullHash, pattern := range urlhashes {
@@ -461,36 +1039,72 @@ func (wr *UpdateClient) LookupURLsContext(ctx context.Context, urls []string) (t
 			_, alreadyRequested := hashes[fullHash]
 			hashes[fullHash] = pattern
 
-			// Lookup in database according to threat list.
-			partialHash, unsureThreats := wr.db.Lookup(fullHash)
+			// Report the injected test threats as database hits.
+			if wr.config.TestThreats {
+				if tds := wr.test.lookup(fullHash); len(tds) > 0 {
+					ttl := wr.config.now().Add(localNegativeTTL)
+					for _, td := range tds {
+						results[i].Threats = append(results[i].Threats, URLThreat{
+							Pattern:    pattern,
+							ThreatType: td,
+							HashPrefix: []byte(fullHash[:minHashPrefixLength]),
+							Source:     SourceDatabase,
+							ExpireTime: ttl,
+						})
+					}
+					atomic.AddInt64(&wr.stats.QueriesByDatabase, 1)
+					expire([]int{i}, ttl)
+					continue
+				}
+			}
+
+			// Lookup in database according to threat list. Until it is
+			// synced, live lookups assume that every list may match.
+			partialHash, unsureThreats := fullHash[:minHashPrefixLength], liveThreats
+			if !live {
+				partialHash, unsureThreats = wr.db.Lookup(fullHash)
+			}
 			if len(unsureThreats) == 0 {
 				atomic.AddInt64(&wr.stats.QueriesByDatabase, 1)
+				expire([]int{i}, wr.config.now().Add(localNegativeTTL))
 				continue // There are definitely no threats for this full hash
 			}
 
 			// Lookup in cache according to recently seen values.
-			cachedThreats, cr := wr.c.Lookup(fullHash)
-			switch cr {
-			case positiveCacheHit:
+			cachedThreats, ttl, cached := wr.c.Get(ctx, []byte(fullHash))
+			switch {
+			case cached && len(cachedThreats) > 0:
 				// The cache remembers this full hash as a threat.
 				// The threats we return to the client is the set intersection
 				// of unsureThreats and cachedThreats.
 				for _, td := range unsureThreats {
-					if _, ok := cachedThreats[td]; ok {
-						threats[i] = append(threats[i], URLThreat{
-							Pattern:    pattern,
-							ThreatType: td,
-						})
+					for _, ctd := range cachedThreats {
+						if ctd == td {
+							results[i].Threats = append(results[i].Threats, URLThreat{
+								Pattern:    pattern,
+								ThreatType: td,
+								HashPrefix: []byte(partialHash),
+								Source:     SourceCache,
+								ExpireTime: ttl,
+							})
+							break
+						}
 					}
 				}
+				expire([]int{i}, ttl)
+				source([]int{i}, SourceCache)
 				atomic.AddInt64(&wr.stats.QueriesByCache, 1)
-			case negativeCacheHit:
+				wr.noteCacheHit(partialHash, unsureThreats, ttl)
+			case cached:
 				// This is cached as a non-threat.
+				expire([]int{i}, ttl)
+				source([]int{i}, SourceCache)
 				atomic.AddInt64(&wr.stats.QueriesByCache, 1)
 				continue
 			default:
 				// The cache knows nothing about this full hash, so we must make
 				// a request for it.
+				atomic.AddInt64(&wr.stats.CacheMisses, 1)
 				if alreadyRequested {
 					continue
 				}
@@ -507,47 +1121,386 @@ func (wr *UpdateClient) LookupURLsContext(ctx context.Context, urls []string) (t
 					HashPrefix:  []byte(partialHash),
 					ThreatTypes: tts,
 				})
+				reqHashes = append(reqHashes, fullHash)
 			}
 		}
 	}
 
-	for _, req := range reqs {
+	for j, req := range reqs {
 		// Actually query the Web Risk API for exact full hash matches.
-		resp, err := wr.api.HashLookup(ctx, req.HashPrefix, req.ThreatTypes)
+		resp, err := wr.hashLookup(ctx, req.HashPrefix, req.ThreatTypes)
 		if err != nil {
 			wr.log.Printf("HashLookup failure: %v", err)
+			if tds, ok := wr.staleThreats(ctx, reqHashes[j]); ok {
+				// Serve the expired verdict of the cache rather than
+				// failing, and do not let it be cached any further.
+				idxs, now := hash2idxs[reqHashes[j]], wr.config.now()
+				for _, tt := range req.ThreatTypes {
+					for _, td := range tds {
+						if td != ThreatType(tt) {
+							continue
+						}
+						for _, idx := range idxs {
+							results[idx].Threats = append(results[idx].Threats, URLThreat{
+								Pattern:    hashes[reqHashes[j]],
+								ThreatType: td,
+								HashPrefix: req.HashPrefix,
+								Source:     SourceCache,
+								ExpireTime: now,
+							})
+						}
+					}
+				}
+				for _, idx := range idxs {
+					results[idx].Stale = true
+				}
+				expire(idxs, now)
+				source(idxs, SourceCache)
+				atomic.AddInt64(&wr.stats.QueriesStale, 1)
+				continue
+			}
 			atomic.AddInt64(&wr.stats.QueriesFail, 1)
-			return threats, err
+			if ctx.Err() != nil {
+				// Keep the verdicts already determined, and let the
+				// results of the others be neither trusted nor cached.
+				idxs := hash2idxs[reqHashes[j]]
+				for _, idx := range idxs {
+					results[idx].Undetermined = true
+				}
+				expire(idxs, wr.config.now())
+				source(idxs, SourceAPI)
+				partial = true
+				continue
+			}
+			return results, err
 		}
 
 		// Update the cache.
-		wr.c.Update(req, resp)
+		now := wr.config.now()
+		threats, nttl := cacheEntries(resp, now)
+		wr.c.Set(ctx, req.HashPrefix, threats, nttl)
+		source(hash2idxs[reqHashes[j]], SourceAPI)
 
 		// Pull the information the client cares about out of the response.
+		matched := false
 		for _, threat := range resp.GetThreats() {
 			fullHash := hashPrefix(threat.Hash)
 			if !fullHash.IsFull() {
 				continue
 			}
+			matched = matched || fullHash == reqHashes[j]
 			pattern, ok := hashes[fullHash]
 			idxs, findidx := hash2idxs[fullHash]
 			if findidx && ok {
+				ttl := threatExpireTime(threat, now)
 				for _, td := range threat.ThreatTypes {
 					if !wr.lists[ThreatType(td)] {
 						continue
 					}
 					for _, idx := range idxs {
-						threats[idx] = append(threats[idx], URLThreat{
+						results[idx].Threats = append(results[idx].Threats, URLThreat{
 							Pattern:    pattern,
 							ThreatType: ThreatType(td),
+							HashPrefix: req.HashPrefix,
+							Source:     SourceAPI,
+							ExpireTime: ttl,
 						})
 					}
 				}
+				expire(idxs, ttl)
 			}
 		}
+		if nttl := resp.GetNegativeExpireTime(); nttl != nil && !matched {
+			expire(hash2idxs[reqHashes[j]], nttl.AsTime())
+		}
 		atomic.AddInt64(&wr.stats.QueriesByAPI, 1)
 	}
-	return threats, nil
+	if partial {
+		return results, ErrPartialResults
+	}
+	return results, nil
+}
+
+// hashLookup searches hashPrefix for the given threat types with the Web Risk
+// API. Concurrent identical searches, such as by lookups of a hot unsafe URL
+// missing the cache at the same time, share a single API call. The call is
+// bounded by Config.RequestTimeout rather than by the deadline of any of the
+// callers, so that one giving up does not fail the others; ctx only
+// determines how long the caller waits for the result. The call keeps the
+// values of the context of the first caller, such as its trace.
+func (wr *UpdateClient) hashLookup(ctx context.Context, hashPrefix []byte, threatTypes []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+	leader := false
+	ch := wr.flights.DoChan(flightKey(hashPrefix, threatTypes), func() (interface{}, error) {
+		leader = true
+		ctx, cancel := context.WithTimeout(valueOnlyContext{ctx}, wr.config.RequestTimeout)
+		defer cancel()
+		return wr.api.HashLookup(ctx, hashPrefix, threatTypes)
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		if !leader {
+			atomic.AddInt64(&wr.stats.HashLookupsShared, 1)
+		}
+		return r.Val.(*pb.SearchHashesResponse), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// valueOnlyContext is a context holding the values of another one, without
+// its deadline and cancellation.
+type valueOnlyContext struct{ context.Context }
+
+func (valueOnlyContext) Deadline() (deadline time.Time, ok bool) { return }
+func (valueOnlyContext) Done() <-chan struct{}                   { return nil }
+func (valueOnlyContext) Err() error                              { return nil }
+
+// flightKey returns the key of the searches of hashPrefix for the given
+// threat types that are shared by hashLookup.
+func flightKey(hashPrefix []byte, threatTypes []pb.ThreatType) string {
+	var b strings.Builder
+	b.Write(hashPrefix)
+	for _, tt := range threatTypes {
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(int(tt)))
+	}
+	return b.String()
+}
+
+// staleThreats returns the threat types of fullHash according to the cache
+// entries that expired less than Config.ServeStale ago, and whether there
+// are such entries.
+func (wr *UpdateClient) staleThreats(ctx context.Context, fullHash hashPrefix) ([]ThreatType, bool) {
+	sc, ok := wr.c.(staleCache)
+	if !ok || wr.config.ServeStale <= 0 {
+		return nil, false
+	}
+	tds, _, ok := sc.GetStale(ctx, []byte(fullHash), wr.config.ServeStale)
+	return tds, ok
+}
+
+// localNegativeTTL is how long a hash prefix matching none of the local
+// threat lists may be considered safe.
+const localNegativeTTL = 5 * time.Minute
+
+// SearchHashes returns the threats whose full hash starts with the given hash
+// prefix, for the given threat types or every configured threat list if none
+// are given. It also returns the time until which other full hashes starting
+// with the prefix may be considered safe. The search is answered from the
+// local database and cache when possible, and only forwarded to the Web Risk
+// API otherwise. It is safe to call this method concurrently.
+//
+// This allows serving clients that compute URL hashes themselves, as the
+// Web Risk hashes.search method does.
+func (wr *UpdateClient) SearchHashes(ctx context.Context, prefix []byte, threatTypes ...ThreatType) (threats []HashThreat, negativeExpireTime time.Time, err error) {
+	ctx, cancel := context.WithTimeout(ctx, wr.config.RequestTimeout)
+	defer cancel()
+
+	if atomic.LoadUint32(&wr.closed) != 0 {
+		return nil, time.Time{}, errClosed
+	}
+	hp := hashPrefix(prefix)
+	if !hp.IsValid() {
+		return nil, time.Time{}, errors.New("webrisk: invalid hash prefix length")
+	}
+	wanted := make(map[ThreatType]bool)
+	for _, td := range threatTypes {
+		if !wr.lists[td] {
+			return nil, time.Time{}, fmt.Errorf("webrisk: threat list %v is not configured", td)
+		}
+		wanted[td] = true
+	}
+	if len(wanted) == 0 {
+		wanted = wr.lists
+	}
+	live, err := wr.liveLookups()
+	if err != nil {
+		wr.log.Printf("inconsistent database: %v", err)
+		atomic.AddInt64(&wr.stats.QueriesFail, 1)
+		return nil, time.Time{}, err
+	}
+
+	// Lookup in database according to threat list. Until it is synced, live
+	// lookups assume that every wanted list may match.
+	var tds []ThreatType
+	if live {
+		for td := range wanted {
+			tds = append(tds, td)
+		}
+	} else {
+		tds = wr.db.LookupPrefix(hp)
+	}
+	var tts []pb.ThreatType
+	for _, td := range tds {
+		if wanted[td] {
+			tts = append(tts, pb.ThreatType(td))
+		}
+	}
+	if len(tts) == 0 {
+		atomic.AddInt64(&wr.stats.QueriesByDatabase, 1)
+		return nil, wr.config.now().Add(localNegativeTTL), nil
+	}
+
+	// Lookup in cache according to recently seen values.
+	if cached, nttl, ok := wr.c.GetPrefix(ctx, prefix); ok {
+		for _, ht := range cached {
+			var tds []ThreatType
+			for _, td := range ht.ThreatTypes {
+				if wanted[td] {
+					tds = append(tds, td)
+				}
+			}
+			if len(tds) > 0 {
+				threats = append(threats, HashThreat{Hash: ht.Hash, ThreatTypes: tds, ExpireTime: ht.ExpireTime})
+			}
+		}
+		atomic.AddInt64(&wr.stats.QueriesByCache, 1)
+		return threats, nttl, nil
+	}
+
+	// Actually query the Web Risk API for exact full hash matches.
+	atomic.AddInt64(&wr.stats.CacheMisses, 1)
+	resp, err := wr.hashLookup(ctx, prefix, tts)
+	if err != nil {
+		wr.log.Printf("HashLookup failure: %v", err)
+		atomic.AddInt64(&wr.stats.QueriesFail, 1)
+		return nil, time.Time{}, err
+	}
+	now := wr.config.now()
+	cacheThreats, nttl := cacheEntries(resp, now)
+	wr.c.Set(ctx, prefix, cacheThreats, nttl)
+	atomic.AddInt64(&wr.stats.QueriesByAPI, 1)
+
+	for _, threat := range resp.GetThreats() {
+		if !hashPrefix(threat.Hash).IsFull() || !hashPrefix(threat.Hash).HasPrefix(hp) {
+			continue
+		}
+		ht := HashThreat{Hash: threat.Hash, ExpireTime: threatExpireTime(threat, now)}
+		for _, td := range threat.ThreatTypes {
+			if wanted[ThreatType(td)] {
+				ht.ThreatTypes = append(ht.ThreatTypes, ThreatType(td))
+			}
+		}
+		if len(ht.ThreatTypes) > 0 {
+			threats = append(threats, ht)
+		}
+	}
+	if nttl := resp.GetNegativeExpireTime(); nttl != nil {
+		negativeExpireTime = nttl.AsTime()
+	}
+	return threats, negativeExpireTime, nil
+}
+
+// liveLookups reports whether lookups must be answered by the Web Risk API
+// alone because the threat lists were never synced and
+// Config.LiveLookupsUntilSynced is set. Otherwise, it returns the error
+// state of the database, if any.
+func (wr *UpdateClient) liveLookups() (bool, error) {
+	err := wr.db.Status()
+	if err == nil {
+		return false, nil
+	}
+	if wr.db.Synced() {
+		return false, err
+	}
+	if wr.config.LiveLookupsUntilSynced {
+		return true, nil
+	}
+	if wr.config.Strict {
+		return false, fmt.Errorf("%w: %v", ErrNotReady, err)
+	}
+	return false, err
+}
+
+// ExportCache writes a snapshot of the unexpired entries of the lookup cache
+// to w, which can be loaded into another client with ImportCache. Only the
+// in-memory cache supports snapshots: it fails if Config.Cache was set to
+// another implementation of Cache without Export and Import methods.
+func (wr *UpdateClient) ExportCache(w io.Writer) error {
+	s, ok := wr.c.(cacheSnapshotter)
+	if !ok {
+		return errNoCacheSnapshot
+	}
+	return s.Export(w)
+}
+
+// ImportCache merges a snapshot written by ExportCache into the lookup cache.
+// This allows warming up the cache of a new client from a peer instead of
+// building it up from live traffic. Like ExportCache, it fails if the cache
+// does not support snapshots.
+func (wr *UpdateClient) ImportCache(r io.Reader) error {
+	s, ok := wr.c.(cacheSnapshotter)
+	if !ok {
+		return errNoCacheSnapshot
+	}
+	return s.Import(r)
+}
+
+// ExportDatabase writes a snapshot of the local database to w, in the format
+// of the database file. The snapshot holds the hash prefixes, version token and
+// checksum of every threat list, so that other clients can be bootstrapped
+// from it instead of downloading the threat lists from the Web Risk API. It
+// fails with ErrNotReady if the threat lists were never synced.
+func (wr *UpdateClient) ExportDatabase(w io.Writer) error {
+	dbf, ok := wr.db.snapshot()
+	if !ok {
+		return ErrNotReady
+	}
+	return writeDatabase(w, dbf)
+}
+
+// PurgeCache removes all entries from the lookup cache, so that subsequent
+// lookups of URLs matching the local database query the API again, such as to
+// flush a cache holding stale or poisoned verdicts without a restart. It
+// returns the number of cached full and partial hashes that were removed.
+func (wr *UpdateClient) PurgeCache() int {
+	return wr.c.Clear()
+}
+
+// SetAPIKey changes the API key used by subsequent requests to the Web Risk
+// API, so that keys can be rotated without discarding the local database or
+// the cache. It fails if the client was not configured to use the API over
+// the network.
+func (wr *UpdateClient) SetAPIKey(key string) error {
+	if key == "" {
+		return errors.New("webrisk: empty API key")
+	}
+	a, ok := wr.api.(*netAPI)
+	if !ok {
+		return errors.New("webrisk: API key cannot be changed")
+	}
+	a.setKey(key)
+	return nil
+}
+
+// UpdateNow triggers an immediate out-of-band update of the local database,
+// instead of waiting for the next scheduled update, and returns its result.
+// The next scheduled update is then relative to this one.
+//
+// If the Web Risk API requested a minimum wait duration that has not elapsed
+// yet, no update is made and an error wrapping ErrUpdateTooSoon is returned.
+// With Config.ReadOnlyDB set, the database file is reloaded instead.
+func (wr *UpdateClient) UpdateNow(ctx context.Context) error {
+	if atomic.LoadUint32(&wr.closed) == 1 {
+		return errClosed
+	}
+	reply := make(chan error, 1)
+	select {
+	case wr.updateNow <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wr.done:
+		return errClosed
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // TODO: Add other types of lookup when available.
@@ -557,23 +1510,76 @@ func (wr *UpdateClient) LookupURLsContext(ctx context.Context, urls []string) (t
 // updater is a blocking method that periodically updates the local database.
 // This should be run as a separate goroutine and will be automatically stopped
 // when wr.Close is called.
+//
+// With Config.ReadOnlyDB set, the database is reloaded from disk instead.
+//
+// Updates requested through UpdateNow are also made by this routine, so that
+// the database is never updated concurrently.
 func (wr *UpdateClient) updater(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
 	for {
-		wr.log.Printf("Next update in %v", delay)
+		if !wr.config.ReadOnlyDB {
+			wr.log.Printf("Next update in %v", delay)
+		}
 		select {
-		case <-time.After(delay):
-			var ok bool
-			ctx, cancel := context.WithTimeout(context.Background(), wr.config.RequestTimeout)
-			if delay, ok = wr.db.Update(ctx, wr.api); ok {
-				wr.log.Printf("background threat list updated")
-				wr.c.Purge()
+		case <-timer.C:
+			delay, _ = wr.update()
+			wr.checkUpdateAlert()
+
+		case reply := <-wr.updateNow:
+			if wait := wr.db.MinUpdateWait(); wait > 0 && !wr.config.ReadOnlyDB {
+				reply <- fmt.Errorf("%w: retry in %v", ErrUpdateTooSoon, wait.Round(time.Second))
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if !wr.config.ReadOnlyDB {
+				wr.db.ScheduleNow()
 			}
-			cancel()
+			var err error
+			delay, err = wr.update()
+			wr.checkUpdateAlert()
+			reply <- err
 
 		case <-wr.done:
 			return
 		}
+		timer.Reset(delay)
+	}
+}
+
+// update updates the database, or reloads it with Config.ReadOnlyDB set, and
+// purges the cache if it changed. An update event is emitted whenever the
+// database changed, and an error event whenever the update failed. It returns
+// the delay until the next update and the status of the database.
+func (wr *UpdateClient) update() (time.Duration, error) {
+	wr.pruneHotPrefixes()
+	if wr.config.ReadOnlyDB {
+		if wr.db.Reload() {
+			wr.log.Printf("background threat list reloaded")
+			wr.c.Purge()
+			wr.emitUpdate(nil)
+		}
+		return wr.config.ReloadPeriod, wr.db.Status()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wr.config.RequestTimeout)
+	defer cancel()
+	delay, ok := wr.db.Update(ctx, wr.api)
+	err := wr.db.Status()
+	switch {
+	case ok:
+		wr.log.Printf("background threat list updated")
+		wr.c.Purge()
+		wr.emitUpdate(nil)
+	case err != nil:
+		wr.emitUpdate(err)
 	}
+	return delay, err
 }
 
 // Close cleans up all resources.
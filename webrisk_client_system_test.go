@@ -33,7 +33,7 @@ func TestNetworkAPIUpdate(t *testing.T) {
 		t.Skip()
 	}
 
-	nm, err := newNetAPI(DefaultServerURL, apiKey, "")
+	nm, err := newNetAPI(DefaultServerURL, apiKey, "", nil)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -73,7 +73,7 @@ func TestNetworkAPILookup(t *testing.T) {
 		t.Skip()
 	}
 
-	nm, err := newNetAPI(DefaultServerURL, apiKey, "")
+	nm, err := newNetAPI(DefaultServerURL, apiKey, "", nil)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -143,7 +143,7 @@ func TestWebriskClient(t *testing.T) {
 			t.Errorf("Database length: got %d,, want >0", hs.Len())
 		}
 	}
-	if len(sb.c.pttls) != 1 {
-		t.Errorf("Cache length: got %d, want 1", len(sb.c.pttls))
+	if len(sb.c.(*cache).pttls) != 1 {
+		t.Errorf("Cache length: got %d, want 1", len(sb.c.(*cache).pttls))
 	}
 }
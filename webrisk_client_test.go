@@ -14,9 +14,22 @@
 package webrisk
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	timepb "google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/webrisk/internal/webrisk_proto"
 )
 
 func TestParseThreatTypes(t *testing.T) {
@@ -112,3 +125,700 @@ func TestValidateMaxEntries(t *testing.T) {
 		}
 	}
 }
+
+func TestParseListConstraints(t *testing.T) {
+	vectors := []struct {
+		args   string
+		output map[ThreatType]ListConstraints
+		fail   bool
+	}{{
+		args:   "",
+		output: map[ThreatType]ListConstraints{},
+	}, {
+		args: "SOCIAL_ENGINEERING_EXTENDED_COVERAGE.maxDatabaseEntries=65536",
+		output: map[ThreatType]ListConstraints{
+			ThreatTypeSocialEngineeringExtended: {MaxDatabaseEntries: 65536},
+		},
+	}, {
+		args: "MALWARE.maxDiffEntries=1024,MALWARE.maxDatabaseEntries=4096,UNWANTED_SOFTWARE.maxDiffEntries=2048",
+		output: map[ThreatType]ListConstraints{
+			ThreatTypeMalware:          {MaxDiffEntries: 1024, MaxDatabaseEntries: 4096},
+			ThreatTypeUnwantedSoftware: {MaxDiffEntries: 2048},
+		},
+	}, {
+		args: "FAIL_TEST.maxDiffEntries=1024",
+		fail: true,
+	}, {
+		args: "MALWARE.maxEntries=1024",
+		fail: true,
+	}, {
+		args: "MALWARE.maxDiffEntries=many",
+		fail: true,
+	}, {
+		args: "MALWARE=1024",
+		fail: true,
+	}}
+
+	for i, v := range vectors {
+		lcs, err := parseListConstraints(v.args)
+		if err != nil != v.fail {
+			if err != nil {
+				t.Errorf("test %d, unexpected error: %v", i, err)
+			} else {
+				t.Errorf("test %d, unexpected success", i)
+			}
+			continue
+		}
+		if !v.fail && !cmp.Equal(lcs, v.output) {
+			t.Errorf("test %d, parseListConstraints(%q) = %v, want %v", i, v.args, lcs, v.output)
+		}
+	}
+}
+
+func TestConfigConstraints(t *testing.T) {
+	c := &Config{
+		MaxDiffEntries:     4096,
+		MaxDatabaseEntries: 1048576,
+		ListConstraints: map[ThreatType]ListConstraints{
+			ThreatTypeSocialEngineeringExtended: {MaxDatabaseEntries: 65536},
+			ThreatTypeUnwantedSoftware:          {MaxDiffEntries: 1024},
+		},
+	}
+	vectors := []struct {
+		td                 ThreatType
+		maxDiffEntries     int32
+		maxDatabaseEntries int32
+	}{
+		{ThreatTypeMalware, 4096, 1048576},
+		{ThreatTypeSocialEngineeringExtended, 4096, 65536},
+		{ThreatTypeUnwantedSoftware, 1024, 1048576},
+	}
+	for i, v := range vectors {
+		maxDiffEntries, maxDatabaseEntries := c.constraints(v.td)
+		if maxDiffEntries != v.maxDiffEntries || maxDatabaseEntries != v.maxDatabaseEntries {
+			t.Errorf("test %d, constraints(%v) = (%d, %d), want (%d, %d)", i, v.td,
+				maxDiffEntries, maxDatabaseEntries, v.maxDiffEntries, v.maxDatabaseEntries)
+		}
+	}
+}
+
+func TestExpressionLimits(t *testing.T) {
+	wr := &UpdateClient{config: Config{ExpressionLimits: ExpressionLimits{MaxHostComponents: 10}}}
+	vectors := []struct {
+		ctx  context.Context
+		want ExpressionLimits
+	}{
+		{context.Background(), ExpressionLimits{MaxHostComponents: 10}},
+		{WithExpressionLimits(context.Background(), ExpressionLimits{MaxPathComponents: 2}), ExpressionLimits{MaxHostComponents: 10, MaxPathComponents: 2}},
+		{WithExpressionLimits(context.Background(), ExpressionLimits{MaxHostComponents: 3}), ExpressionLimits{MaxHostComponents: 3}},
+	}
+	for i, v := range vectors {
+		if got := wr.expressionLimits(v.ctx); got != v.want {
+			t.Errorf("test %d, expressionLimits() = %+v, want %+v", i, got, v.want)
+		}
+	}
+
+	if _, err := NewUpdateClient(Config{ExpressionLimits: ExpressionLimits{MaxPathComponents: -1}}); err == nil {
+		t.Errorf("NewUpdateClient() succeeded with negative expression limits")
+	}
+}
+
+func TestUpdateNow(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var nextDiff *timepb.Timestamp
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:        pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken:     []byte("token"),
+				RecommendedNextDiff: nextDiff,
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+				},
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	vectors := []struct {
+		nextDiff  *timepb.Timestamp
+		wantErr   error
+		wantCalls int
+	}{
+		{nil, nil, 2},
+		{timepb.New(time.Now().Add(time.Hour)), nil, 3},
+		{nil, ErrUpdateTooSoon, 3},
+	}
+	for i, v := range vectors {
+		mu.Lock()
+		nextDiff = v.nextDiff
+		mu.Unlock()
+		if err := wr.UpdateNow(context.Background()); !errors.Is(err, v.wantErr) {
+			t.Errorf("test %d, UpdateNow() = %v, want %v", i, err, v.wantErr)
+		}
+		mu.Lock()
+		if calls != v.wantCalls {
+			t.Errorf("test %d, ListUpdate called %d times, want %d", i, calls, v.wantCalls)
+		}
+		mu.Unlock()
+	}
+
+	wr.Close()
+	if err := wr.UpdateNow(context.Background()); err != errClosed {
+		t.Errorf("UpdateNow() after Close = %v, want %v", err, errClosed)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	phs := newPartialHashes("snapshot", "aaaa", "bbbb")
+	var good bytes.Buffer
+	if err := writeDatabase(&good, databaseFormat{threatsForUpdate{ThreatTypeMalware: phs}, time.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bad := phs
+	bad.SHA256 = mustDecodeHex(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	var corrupt bytes.Buffer
+	if err := writeDatabase(&corrupt, databaseFormat{threatsForUpdate{ThreatTypeMalware: bad}, time.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		snapshot  []byte
+		auth      string
+		wantToken string // Version token of the first update
+	}{
+		{good.Bytes(), "Bearer s3cret", "snapshot"},
+		{good.Bytes(), "", ""},
+		{corrupt.Bytes(), "Bearer s3cret", ""},
+	}
+	for i, v := range vectors {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer s3cret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Write(v.snapshot)
+		}))
+		var mu sync.Mutex
+		var tokens []string
+		api := &mockAPI{
+			listUpdate: func(_ context.Context, _ pb.ThreatType, token []byte, _ []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				tokens = append(tokens, string(token))
+				return &pb.ComputeThreatListDiffResponse{
+					ResponseType:    pb.ComputeThreatListDiffResponse_DIFF,
+					NewVersionToken: []byte("next"),
+					Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: phs.SHA256},
+				}, nil
+			},
+		}
+		header := make(http.Header)
+		if v.auth != "" {
+			header.Set("Authorization", v.auth)
+		}
+		wr, err := NewUpdateClient(Config{
+			ThreatLists:    []ThreatType{ThreatTypeMalware},
+			SnapshotURL:    ts.URL + "/wrdb",
+			SnapshotHeader: header,
+			api:            api,
+		})
+		if err != nil {
+			t.Fatalf("test %d, unexpected error: %v", i, err)
+		}
+		if v.wantToken != "" {
+			// The database is ready without any update.
+			if _, err := wr.Status(); err != nil {
+				t.Errorf("test %d, unexpected status error: %v", i, err)
+			}
+			if err := wr.UpdateNow(context.Background()); err != nil {
+				t.Errorf("test %d, unexpected update error: %v", i, err)
+			}
+		}
+		mu.Lock()
+		if len(tokens) == 0 || tokens[0] != v.wantToken {
+			t.Errorf("test %d, version tokens of the updates = %q, want %q first", i, tokens, v.wantToken)
+		}
+		mu.Unlock()
+		wr.Close()
+		ts.Close()
+	}
+}
+
+func TestLookupURLsStrict(t *testing.T) {
+	vectors := []struct {
+		strict   bool
+		synced   bool
+		notReady bool
+	}{
+		{false, false, false},
+		{true, false, true},
+		{true, true, false},
+	}
+	for i, v := range vectors {
+		wr := &UpdateClient{
+			config: Config{Strict: v.strict, RequestTimeout: DefaultRequestTimeout},
+			log:    log.New(ioutil.Discard, "", 0),
+		}
+		wr.db.config = &Config{UpdatePeriod: DefaultUpdatePeriod, now: time.Now}
+		wr.db.err = errors.New("no database loaded")
+		wr.db.synced = v.synced
+
+		_, err := wr.LookupURLs([]string{"http://example.com/"})
+		if err == nil {
+			t.Errorf("test %d, unexpected success", i)
+			continue
+		}
+		if errors.Is(err, ErrNotReady) != v.notReady {
+			t.Errorf("test %d, LookupURLs() = %v, want ErrNotReady: %v", i, err, v.notReady)
+		}
+	}
+}
+
+func TestLookupURLsLive(t *testing.T) {
+	fullHash := hashFromPattern("bad.example.com/")
+	var lookups int
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return nil, errors.New("unavailable")
+		},
+		hashLookup: func(_ context.Context, hp []byte, tts []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			lookups++
+			if len(hp) != minHashPrefixLength || !cmp.Equal(tts, []pb.ThreatType{pb.ThreatType_MALWARE}) {
+				t.Errorf("unexpected HashLookup(%x, %v)", hp, tts)
+			}
+			resp := &pb.SearchHashesResponse{NegativeExpireTime: timepb.New(time.Now().Add(time.Hour))}
+			if bytes.HasPrefix([]byte(fullHash), hp) {
+				resp.Threats = []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(time.Now().Add(time.Hour)),
+				}}
+			}
+			return resp, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists:            []ThreatType{ThreatTypeMalware},
+		Strict:                 true,
+		LiveLookupsUntilSynced: true,
+		api:                    api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+
+	// The threat lists were never synced, so every expression is looked up.
+	threats, err := wr.LookupURLs([]string{"http://bad.example.com/", "http://good.example.com/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(threats[0]) != 1 || threats[0][0].ThreatType != ThreatTypeMalware || len(threats[1]) != 0 {
+		t.Errorf("LookupURLs() = %v, want only the first URL as MALWARE", threats)
+	}
+	if lookups == 0 {
+		t.Errorf("HashLookup not called")
+	}
+	found, _, err := wr.SearchHashes(context.Background(), []byte(fullHash[:4]))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("SearchHashes() = %v, want 1 threat", found)
+	}
+}
+
+func TestSearchHashes(t *testing.T) {
+	prefix := []byte("abcd")
+	fullHash := append([]byte("abcd"), make([]byte, 28)...)
+	var lookups int
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: prefix}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: hashPrefixes{hashPrefix(prefix)}.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(_ context.Context, hp []byte, tts []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			lookups++
+			if !bytes.HasPrefix(hp, prefix) || !cmp.Equal(tts, []pb.ThreatType{pb.ThreatType_MALWARE}) {
+				t.Errorf("unexpected HashLookup(%x, %v)", hp, tts)
+			}
+			return &pb.SearchHashesResponse{
+				Threats: []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        fullHash,
+					ExpireTime:  timepb.New(time.Now().Add(time.Hour)),
+				}},
+				NegativeExpireTime: timepb.New(time.Now().Add(time.Hour)),
+			}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vectors := []struct {
+		prefix      []byte
+		threatTypes []ThreatType
+		want        int // Number of threats found
+		lookups     int // Number of API calls made so far
+		fail        bool
+	}{
+		{[]byte("wxyz"), nil, 0, 0, false},
+		{prefix, nil, 1, 1, false},
+		{prefix, []ThreatType{ThreatTypeMalware}, 1, 1, false},
+		{fullHash, nil, 1, 2, false},
+		{[]byte("abc"), nil, 0, 2, true},
+		{prefix, []ThreatType{ThreatTypeSocialEngineering}, 0, 2, true},
+	}
+	for i, v := range vectors {
+		threats, nttl, err := wr.SearchHashes(context.Background(), v.prefix, v.threatTypes...)
+		if err != nil != v.fail {
+			t.Errorf("test %d, SearchHashes() error = %v, want failure %v", i, err, v.fail)
+			continue
+		}
+		if lookups != v.lookups {
+			t.Errorf("test %d, HashLookup called %d times, want %d", i, lookups, v.lookups)
+		}
+		if v.fail {
+			continue
+		}
+		if len(threats) != v.want {
+			t.Errorf("test %d, SearchHashes() = %v, want %d threats", i, threats, v.want)
+			continue
+		}
+		if !nttl.After(time.Now()) {
+			t.Errorf("test %d, negative expire time %v is not in the future", i, nttl)
+		}
+		for _, ht := range threats {
+			if string(ht.Hash) != string(fullHash) || !cmp.Equal(ht.ThreatTypes, []ThreatType{ThreatTypeMalware}) {
+				t.Errorf("test %d, SearchHashes() = %+v, want %x as MALWARE", i, ht, fullHash)
+			}
+		}
+	}
+}
+
+func TestLookupURLResults(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	prefixes := hashPrefixes{fullHash[:4], hashFromPattern("example.com/")[:4]}
+	prefixes.Sort()
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0] + prefixes[1])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: prefixes.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(_ context.Context, hp []byte, _ []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			resp := &pb.SearchHashesResponse{NegativeExpireTime: timepb.New(now.Add(2 * time.Hour))}
+			if hashPrefix(hp) == fullHash[:4] {
+				resp.Threats = []*pb.SearchHashesResponse_ThreatHash{{
+					ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+					Hash:        []byte(fullHash),
+					ExpireTime:  timepb.New(now.Add(time.Hour)),
+				}}
+			}
+			return resp, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+		now:         func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The second lookup is answered by the cache.
+	for i, source := range []LookupSource{SourceAPI, SourceCache} {
+		results, err := wr.LookupURLResults(context.Background(), []string{"http://good.example.org/", "http://example.com/", "http://bad.example.com/"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []URLResult{{
+			ExpireTime: now.Add(localNegativeTTL),
+			Source:     SourceDatabase,
+		}, {
+			ExpireTime: now.Add(2 * time.Hour),
+			Source:     source,
+		}, {
+			Threats: []URLThreat{{
+				Pattern:    "bad.example.com/",
+				ThreatType: ThreatTypeMalware,
+				HashPrefix: []byte(fullHash[:4]),
+				Source:     source,
+				ExpireTime: now.Add(time.Hour),
+			}},
+			ExpireTime: now.Add(time.Hour),
+			Source:     source,
+		}}
+		if !cmp.Equal(results, want) {
+			t.Errorf("lookup %d, LookupURLResults() = %+v, want %+v", i, results, want)
+		}
+	}
+}
+
+func TestLookupURLResultsPartial(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	badHash, slowHash := hashFromPattern("bad.example.com/"), hashFromPattern("slow.example.com/")
+	prefixes := hashPrefixes{badHash[:4], slowHash[:4]}
+	prefixes.Sort()
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0] + prefixes[1])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: prefixes.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(ctx context.Context, hp []byte, _ []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			if hashPrefix(hp) == slowHash[:4] {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &pb.SearchHashesResponse{Threats: []*pb.SearchHashesResponse_ThreatHash{{
+				ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+				Hash:        []byte(badHash),
+				ExpireTime:  timepb.New(now.Add(time.Hour)),
+			}}}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+		now:         func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results, err := wr.LookupURLResults(ctx, []string{"http://bad.example.com/", "http://slow.example.com/", "http://good.example.org/"})
+	if err != ErrPartialResults {
+		t.Fatalf("LookupURLResults() error = %v, want %v", err, ErrPartialResults)
+	}
+	want := []URLResult{{
+		Threats: []URLThreat{{
+			Pattern:    "bad.example.com/",
+			ThreatType: ThreatTypeMalware,
+			HashPrefix: []byte(badHash[:4]),
+			Source:     SourceAPI,
+			ExpireTime: now.Add(time.Hour),
+		}},
+		ExpireTime: now.Add(localNegativeTTL),
+		Source:     SourceAPI,
+	}, {
+		ExpireTime:   now,
+		Source:       SourceAPI,
+		Undetermined: true,
+	}, {
+		ExpireTime: now.Add(localNegativeTTL),
+		Source:     SourceDatabase,
+	}}
+	if !cmp.Equal(results, want) {
+		t.Errorf("LookupURLResults() = %+v, want %+v", results, want)
+	}
+	if got := atomic.LoadInt64(&wr.stats.QueriesFail); got != 1 {
+		t.Errorf("QueriesFail = %d, want 1", got)
+	}
+}
+
+func TestLookupURLResultsDuplicates(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fullHash := hashFromPattern("bad.example.com/")
+	prefixes := hashPrefixes{fullHash[:4]}
+	var calls int32
+	api := &mockAPI{
+		listUpdate: func(context.Context, pb.ThreatType, []byte, []pb.CompressionType) (*pb.ComputeThreatListDiffResponse, error) {
+			return &pb.ComputeThreatListDiffResponse{
+				ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+				NewVersionToken: []byte("token"),
+				Additions: &pb.ThreatEntryAdditions{
+					RawHashes: []*pb.RawHashes{{PrefixSize: 4, RawHashes: []byte(prefixes[0])}},
+				},
+				Checksum: &pb.ComputeThreatListDiffResponse_Checksum{
+					Sha256: prefixes.SHA256(),
+				},
+			}, nil
+		},
+		hashLookup: func(context.Context, []byte, []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+			atomic.AddInt32(&calls, 1)
+			return &pb.SearchHashesResponse{Threats: []*pb.SearchHashesResponse_ThreatHash{{
+				ThreatTypes: []pb.ThreatType{pb.ThreatType_MALWARE},
+				Hash:        []byte(fullHash),
+				ExpireTime:  timepb.New(now.Add(time.Hour)),
+			}}}, nil
+		},
+	}
+	wr, err := NewUpdateClient(Config{
+		ThreatLists: []ThreatType{ThreatTypeMalware},
+		api:         api,
+		now:         func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	if err := wr.WaitUntilReady(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	urls := []string{"http://bad.example.com/", "http://good.example.org/", "http://bad.example.com/", "HTTP://BAD.example.com/./#frag"}
+	results, err := wr.LookupURLResults(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bad := URLResult{
+		Threats: []URLThreat{{
+			Pattern:    "bad.example.com/",
+			ThreatType: ThreatTypeMalware,
+			HashPrefix: []byte(fullHash[:4]),
+			Source:     SourceAPI,
+			ExpireTime: now.Add(time.Hour),
+		}},
+		ExpireTime: now.Add(localNegativeTTL),
+		Source:     SourceAPI,
+	}
+	want := []URLResult{bad, {ExpireTime: now.Add(localNegativeTTL), Source: SourceDatabase}, bad, bad}
+	if !cmp.Equal(results, want) {
+		t.Errorf("LookupURLResults() = %+v, want %+v", results, want)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("HashLookup() called %d times, want 1", got)
+	}
+	if got := atomic.LoadInt64(&wr.stats.CacheMisses); got != 1 {
+		t.Errorf("CacheMisses = %d, want 1", got)
+	}
+	if got := atomic.LoadInt64(&wr.stats.DuplicateURLs); got != 2 {
+		t.Errorf("DuplicateURLs = %d, want 2", got)
+	}
+}
+
+func TestHashLookupShared(t *testing.T) {
+	const n = 10
+	var calls int32
+	release := make(chan struct{})
+	wr := &UpdateClient{
+		config: Config{RequestTimeout: DefaultRequestTimeout},
+		api: &mockAPI{
+			hashLookup: func(ctx context.Context, hashPrefix []byte, threatTypes []pb.ThreatType) (*pb.SearchHashesResponse, error) {
+				atomic.AddInt32(&calls, 1)
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				return &pb.SearchHashesResponse{}, nil
+			},
+		},
+	}
+
+	var wg sync.WaitGroup
+	var started sync.WaitGroup
+	started.Add(n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			if _, err := wr.hashLookup(context.Background(), []byte("aaaa"), []pb.ThreatType{pb.ThreatType_MALWARE}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	// Give every goroutine the time to join the search in flight.
+	started.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("HashLookup() called %d times, want 1", got)
+	}
+	if got := atomic.LoadInt64(&wr.stats.HashLookupsShared); got != n-1 {
+		t.Errorf("HashLookupsShared = %d, want %d", got, n-1)
+	}
+
+	// The search in flight outlives the caller that started it.
+	release = make(chan struct{})
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := wr.hashLookup(leaderCtx, []byte("bbbb"), []pb.ThreatType{pb.ThreatType_MALWARE})
+		leaderErr <- err
+	}()
+	for atomic.LoadInt32(&calls) != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	followerErr := make(chan error, 1)
+	go func() {
+		_, err := wr.hashLookup(context.Background(), []byte("bbbb"), []pb.ThreatType{pb.ThreatType_MALWARE})
+		followerErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("mismatching leader error: got %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-followerErr; err != nil {
+		t.Errorf("unexpected follower error: %v", err)
+	}
+
+	// Searches for other threat types are not shared.
+	if _, err := wr.hashLookup(context.Background(), []byte("aaaa"), []pb.ThreatType{pb.ThreatType_SOCIAL_ENGINEERING}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("HashLookup() called %d times, want 3", got)
+	}
+}
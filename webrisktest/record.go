@@ -0,0 +1,171 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// keyParam is the query parameter holding the API key, which is not recorded.
+const keyParam = "key"
+
+// interaction is a request to the Web Risk API and its response, as recorded
+// in a cassette file.
+type interaction struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"` // Without the API key
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body"`
+}
+
+// requestKey returns the URL of req without the API key and with its query
+// parameters sorted, to match requests with recorded interactions.
+func requestKey(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	q.Del(keyParam)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Recorder is an http.RoundTripper recording the responses of the Web Risk
+// API to a cassette file, to be replayed by a Replayer. It is set as the
+// Transport of the webrisk.Config of a client talking to the actual API, and
+// saved with Save once done. API keys are not recorded, so cassettes can be
+// checked in along with the tests using them.
+type Recorder struct {
+	path string
+	rt   http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []interaction
+}
+
+// NewRecorder returns a recorder of the requests made with rt, or with
+// http.DefaultTransport if nil, to be saved to the cassette file at path.
+func NewRecorder(path string, rt http.RoundTripper) *Recorder {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &Recorder{path: path, rt: rt}
+}
+
+// RoundTrip makes req with the underlying transport and records its response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction{
+		Method:      req.Method,
+		URL:         requestKey(req),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Save writes the interactions recorded so far to the cassette file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(b, '\n'), 0644)
+}
+
+// Replayer is an http.RoundTripper answering requests with the responses
+// recorded in a cassette file by a Recorder, without any network access.
+// Identical requests get the responses recorded for them in turn, the last
+// one being replayed once they are exhausted, so that clients updating their
+// threat lists periodically keep being answered. Requests that were not
+// recorded fail.
+type Replayer struct {
+	mu        sync.Mutex
+	responses map[string][]interaction // Responses not replayed yet, per method and URL
+}
+
+// NewReplayer returns a replayer of the cassette file at path.
+func NewReplayer(path string) (*Replayer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []interaction
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		return nil, fmt.Errorf("webrisktest: invalid cassette %s: %v", path, err)
+	}
+	r := &Replayer{responses: make(map[string][]interaction)}
+	for _, in := range interactions {
+		k := in.Method + " " + in.URL
+		r.responses[k] = append(r.responses[k], in)
+	}
+	return r, nil
+}
+
+// RoundTrip returns the next response recorded for req.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(ioutil.Discard, req.Body)
+		req.Body.Close()
+	}
+	k := req.Method + " " + requestKey(req)
+	r.mu.Lock()
+	ins := r.responses[k]
+	if len(ins) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("webrisktest: no recorded response for %s", k)
+	}
+	in := ins[0]
+	if len(ins) > 1 {
+		r.responses[k] = ins[1:]
+	}
+	r.mu.Unlock()
+
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(in.Body))),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}
+	if in.ContentType != "" {
+		resp.Header.Set("Content-Type", in.ContentType)
+	}
+	return resp, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisktest
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestRecordReplay(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	urls := []string{"http://malware.example.com/", "http://safe.example.com/"}
+
+	// lookup returns whether urls are unsafe according to a client making its
+	// requests with transport.
+	lookup := func(transport *webrisk.Config) []bool {
+		wr, err := webrisk.NewUpdateClient(*transport)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer wr.Close()
+		if err := wr.WaitUntilReady(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results, err := wr.LookupURLResults(ctx, urls)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		unsafe := make([]bool, len(results))
+		for i, r := range results {
+			unsafe[i] = len(r.Threats) > 0
+		}
+		return unsafe
+	}
+
+	srv := NewServer(Threat{URL: urls[0], ThreatType: webrisk.ThreatTypeMalware})
+	rec := NewRecorder(cassette, nil)
+	recorded := lookup(&webrisk.Config{
+		APIKey:      "secret",
+		ServerURL:   srv.URL,
+		ThreatLists: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		Transport:   rec,
+	})
+	srv.Close()
+	if err := rec.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rep, err := NewReplayer(cassette)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replayed := lookup(&webrisk.Config{
+		APIKey:      "another",
+		ServerURL:   srv.URL,
+		ThreatLists: []webrisk.ThreatType{webrisk.ThreatTypeMalware},
+		Transport:   rep,
+	})
+	if !recorded[0] || recorded[1] {
+		t.Errorf("recorded verdicts = %v, want [true false]", recorded)
+	}
+	if replayed[0] != recorded[0] || replayed[1] != recorded[1] {
+		t.Errorf("replayed verdicts = %v, want %v", replayed, recorded)
+	}
+	for k := range rep.responses {
+		if strings.Contains(k, "secret") {
+			t.Errorf("API key recorded in %s", k)
+		}
+	}
+
+	if _, err := rep.RoundTrip(httptest.NewRequest("GET", srv.URL+"/v1/unknown", nil)); err == nil {
+		t.Errorf("RoundTrip() of an unrecorded request succeeded")
+	}
+}
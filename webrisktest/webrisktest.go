@@ -0,0 +1,265 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webrisktest provides a fake Web Risk API server for the integration
+// tests of programs using the webrisk package.
+//
+// The server implements the threatLists:computeDiff and hashes:search
+// endpoints of the Web Risk API, with the threat lists seeded from a list of
+// unsafe URLs:
+//
+//	srv := webrisktest.NewServer(webrisktest.Threat{
+//		URL:        "http://malware.example.com/",
+//		ThreatType: webrisk.ThreatTypeMalware,
+//	})
+//	defer srv.Close()
+//	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+//		APIKey:    "test",
+//		ServerURL: srv.URL,
+//	})
+//
+// Lookups of the unsafe URLs, and of the URLs under them such as
+// http://malware.example.com/page?q=1, then report their threat type.
+package webrisktest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/webrisk"
+	pb "github.com/google/webrisk/internal/webrisk_proto"
+	"github.com/google/webrisk/urls"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Paths of the endpoints of the fake server.
+const (
+	computeDiffPath  = "/v1/threatLists:computeDiff"
+	searchHashesPath = "/v1/hashes:search"
+)
+
+// CacheDuration is how long the results of the hashes:search endpoint of the
+// fake server may be cached, both for threats and for the absence of threats.
+const CacheDuration = 5 * time.Minute
+
+// Threat is an unsafe URL of the threat lists of the fake server.
+type Threat struct {
+	URL        string
+	ThreatType webrisk.ThreatType
+}
+
+// Server is a fake Web Risk API server. It is safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server, to be set as the ServerURL of the
+	// webrisk.Config of the clients.
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	version  int                                      // Version of the threat lists
+	hashes   map[webrisk.ThreatType]map[[32]byte]bool // Full hashes of every threat list
+	diffs    int                                      // Number of computeDiff requests
+	searches int                                      // Number of hashes:search requests
+}
+
+// NewServer starts and returns a fake server whose threat lists hold threats.
+// It panics if the URL of a threat is invalid.
+func NewServer(threats ...Threat) *Server {
+	s := &Server{hashes: make(map[webrisk.ThreatType]map[[32]byte]bool)}
+	s.AddThreats(threats...)
+	mux := http.NewServeMux()
+	mux.HandleFunc(computeDiffPath, s.serveComputeDiff)
+	mux.HandleFunc(searchHashesPath, s.serveSearchHashes)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// AddThreats adds threats to the threat lists, as a new version that clients
+// get on their next update. It panics if the URL of a threat is invalid.
+func (s *Server) AddThreats(threats ...Threat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range threats {
+		if s.hashes[t.ThreatType] == nil {
+			s.hashes[t.ThreatType] = make(map[[32]byte]bool)
+		}
+		s.hashes[t.ThreatType][threatHash(t.URL)] = true
+	}
+	s.version++
+}
+
+// RemoveThreats removes threats from the threat lists, as a new version that
+// clients get on their next update. It panics if the URL of a threat is
+// invalid.
+func (s *Server) RemoveThreats(threats ...Threat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range threats {
+		delete(s.hashes[t.ThreatType], threatHash(t.URL))
+	}
+	s.version++
+}
+
+// Requests returns the number of computeDiff and hashes:search requests
+// served so far.
+func (s *Server) Requests() (diffs, searches int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.diffs, s.searches
+}
+
+// threatHash returns the full hash of the expression of url made of its exact
+// host, path and query.
+func threatHash(url string) [32]byte {
+	hosts, err := urls.Hosts(url, urls.Limits{})
+	if err != nil {
+		panic(fmt.Sprintf("webrisktest: invalid threat URL %q: %v", url, err))
+	}
+	paths, err := urls.Paths(url, urls.Limits{})
+	if err != nil {
+		panic(fmt.Sprintf("webrisktest: invalid threat URL %q: %v", url, err))
+	}
+	return sha256.Sum256([]byte(hosts[0] + paths[len(paths)-1]))
+}
+
+// serveComputeDiff implements the threatLists:computeDiff endpoint. Clients
+// get the whole list unless they already have its current version.
+func (s *Server) serveComputeDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tt, ok := pb.ThreatType_value[param(q, "threat_type", "threatType")]
+	if !ok || tt == 0 {
+		http.Error(w, "invalid threatType", http.StatusBadRequest)
+		return
+	}
+	token, err := base64.StdEncoding.DecodeString(param(q, "version_token", "versionToken"))
+	if err != nil {
+		http.Error(w, "invalid versionToken", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diffs++
+	prefixes := make([][]byte, 0, len(s.hashes[webrisk.ThreatType(tt)]))
+	seen := make(map[string]bool)
+	for h := range s.hashes[webrisk.ThreatType(tt)] {
+		if p := string(h[:urls.HashPrefixLength]); !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, []byte(p))
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return bytes.Compare(prefixes[i], prefixes[j]) < 0 })
+	sum := sha256.Sum256(bytes.Join(prefixes, nil))
+	resp := &pb.ComputeThreatListDiffResponse{
+		ResponseType:    pb.ComputeThreatListDiffResponse_RESET,
+		NewVersionToken: []byte(strconv.Itoa(s.version)),
+		Checksum:        &pb.ComputeThreatListDiffResponse_Checksum{Sha256: sum[:]},
+	}
+	if bytes.Equal(token, resp.NewVersionToken) {
+		resp.ResponseType = pb.ComputeThreatListDiffResponse_DIFF
+	} else if len(prefixes) > 0 {
+		resp.Additions = &pb.ThreatEntryAdditions{RawHashes: []*pb.RawHashes{{
+			PrefixSize: urls.HashPrefixLength,
+			RawHashes:  bytes.Join(prefixes, nil),
+		}}}
+	}
+	writeResponse(w, resp)
+}
+
+// serveSearchHashes implements the hashes:search endpoint.
+func (s *Server) serveSearchHashes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, err := base64.StdEncoding.DecodeString(param(q, "hash_prefix", "hashPrefix"))
+	if err != nil || len(prefix) < urls.HashPrefixLength || len(prefix) > sha256.Size {
+		http.Error(w, "invalid hashPrefix", http.StatusBadRequest)
+		return
+	}
+	var tts []webrisk.ThreatType
+	for _, name := range append(q["threat_types"], q["threatTypes"]...) {
+		tt, ok := pb.ThreatType_value[name]
+		if !ok || tt == 0 {
+			http.Error(w, "invalid threatTypes", http.StatusBadRequest)
+			return
+		}
+		tts = append(tts, webrisk.ThreatType(tt))
+	}
+	if len(tts) == 0 {
+		http.Error(w, "missing threatTypes", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches++
+	now := time.Now()
+	threats := make(map[[32]byte]*pb.SearchHashesResponse_ThreatHash)
+	for _, tt := range tts {
+		for h := range s.hashes[tt] {
+			if !bytes.HasPrefix(h[:], prefix) {
+				continue
+			}
+			if threats[h] == nil {
+				threats[h] = &pb.SearchHashesResponse_ThreatHash{
+					Hash:       append([]byte(nil), h[:]...),
+					ExpireTime: timestamppb.New(now.Add(CacheDuration)),
+				}
+			}
+			threats[h].ThreatTypes = append(threats[h].ThreatTypes, pb.ThreatType(tt))
+		}
+	}
+	resp := &pb.SearchHashesResponse{NegativeExpireTime: timestamppb.New(now.Add(CacheDuration))}
+	for _, t := range threats {
+		resp.Threats = append(resp.Threats, t)
+	}
+	sort.Slice(resp.Threats, func(i, j int) bool { return bytes.Compare(resp.Threats[i].Hash, resp.Threats[j].Hash) < 0 })
+	writeResponse(w, resp)
+}
+
+// param returns the value of the query parameter named either name or, as
+// the Web Risk API accepts both, its camel case alias.
+func param(q url.Values, name, alias string) string {
+	if v := q.Get(name); v != "" {
+		return v
+	}
+	return q.Get(alias)
+}
+
+// writeResponse writes m as the JSON body of a response.
+func writeResponse(w http.ResponseWriter, m proto.Message) {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
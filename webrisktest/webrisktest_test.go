@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webrisktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/webrisk"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer(
+		Threat{URL: "http://malware.example.com/", ThreatType: webrisk.ThreatTypeMalware},
+		Threat{URL: "http://example.org/phishing/login", ThreatType: webrisk.ThreatTypeSocialEngineering},
+	)
+	defer srv.Close()
+	wr, err := webrisk.NewUpdateClient(webrisk.Config{
+		APIKey:      "test",
+		ServerURL:   srv.URL,
+		ThreatLists: []webrisk.ThreatType{webrisk.ThreatTypeMalware, webrisk.ThreatTypeSocialEngineering},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer wr.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := wr.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lookup := func(url string) []webrisk.ThreatType {
+		results, err := wr.LookupURLResults(ctx, []string{url})
+		if err != nil {
+			t.Fatalf("unexpected error looking up %s: %v", url, err)
+		}
+		var tds []webrisk.ThreatType
+		for _, th := range results[0].Threats {
+			tds = append(tds, th.ThreatType)
+		}
+		return tds
+	}
+	vectors := []struct {
+		url  string
+		want []webrisk.ThreatType
+	}{
+		{"http://malware.example.com/", []webrisk.ThreatType{webrisk.ThreatTypeMalware}},
+		{"http://malware.example.com/?q=1", []webrisk.ThreatType{webrisk.ThreatTypeMalware}},
+		{"http://example.org/phishing/login", []webrisk.ThreatType{webrisk.ThreatTypeSocialEngineering}},
+		{"http://example.org/", nil},
+		{"http://safe.example.com/", nil},
+	}
+	for i, v := range vectors {
+		got := lookup(v.url)
+		if len(got) != len(v.want) || (len(got) > 0 && got[0] != v.want[0]) {
+			t.Errorf("test %d, threats of %s = %v, want %v", i, v.url, got, v.want)
+		}
+	}
+
+	// Threats added later are served once the clients updated.
+	srv.AddThreats(Threat{URL: "http://unwanted.example.com/", ThreatType: webrisk.ThreatTypeMalware})
+	if err := wr.UpdateNow(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := lookup("http://unwanted.example.com/"); len(got) != 1 {
+		t.Errorf("threats of the added URL = %v, want MALWARE", got)
+	}
+	if diffs, searches := srv.Requests(); diffs != 4 || searches != 3 {
+		t.Errorf("Requests() = (%d, %d), want (4, 3)", diffs, searches)
+	}
+}